@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+// requestIDHeader carries the request id in both directions
+const requestIDHeader = "X-Request-ID"
+
+// redacted replaces values that must not reach the logs
+const redacted = "[REDACTED]"
+
+// loggedQueryParams are query parameters whose values are logged as-is. Every
+// other value (search queries, addresses, signatures, tokens) is redacted.
+var loggedQueryParams = map[string]bool{
+	"provider": true, "type": true, "since": true, "until": true, "after_id": true,
+	"limit": true, "offset": true, "days": true, "tz": true, "top": true,
+	"sort": true, "folder": true, "as_of": true, "at": true, "format": true,
+}
+
+// redactedHeaders are logged as [REDACTED] (keeping the auth scheme)
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Service-Token":     true,
+	"X-Api-Key":           true,
+}
+
+// accessLogConfig is read from ACCESS_LOG (json, text or off) and
+// ACCESS_LOG_HEADERS
+type accessLogConfig struct {
+	format  string
+	headers bool
+}
+
+func accessLogSettings() (accessLogConfig, error) {
+	cfg := accessLogConfig{format: "json"}
+	if v := os.Getenv("ACCESS_LOG"); v != "" {
+		switch v {
+		case "json", "text", "off":
+			cfg.format = v
+		default:
+			return cfg, fmt.Errorf("invalid ACCESS_LOG %q: want json, text or off", v)
+		}
+	}
+	if v := os.Getenv("ACCESS_LOG_HEADERS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ACCESS_LOG_HEADERS %q: %w", v, err)
+		}
+		cfg.headers = b
+	}
+	return cfg, nil
+}
+
+// requestID assigns every request an id, reusing a well-formed one sent by
+// the client or proxy, and echoes it in the response
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set("request_id", id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// validRequestID accepts short ids of URL-safe characters, so a client can't
+// inject log content through the header
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// accessLog writes one structured line per request: id, route, redacted
+// query, status, latency, size and who made it. Raw paths (which carry
+// message and user ids) are only logged for unmatched routes.
+func accessLog(cfg accessLogConfig) gin.HandlerFunc {
+	if cfg.format == "off" {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, nil)
+	if cfg.format == "text" {
+		handler = slog.NewTextHandler(os.Stdout, nil)
+	}
+	logger := slog.New(handler)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("request_id", c.GetString("request_id")),
+			slog.String("method", c.Request.Method),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		} else {
+			attrs = append(attrs, slog.String("path", truncate(c.Request.URL.Path, 200)))
+		}
+		if q := redactQuery(c.Request.URL.RawQuery); q != "" {
+			attrs = append(attrs, slog.String("query", q))
+		}
+		if user, ok := c.Get("user"); ok {
+			if u, ok := user.(*auth.User); ok {
+				attrs = append(attrs, slog.String("user_id", u.ID))
+			}
+		}
+		if imp, ok := c.Get("impersonator"); ok {
+			if u, ok := imp.(*auth.User); ok {
+				attrs = append(attrs, slog.String("impersonator_id", u.ID))
+			}
+		}
+		if svc, ok := c.Get("service"); ok {
+			if p, ok := svc.(*auth.ServicePrincipal); ok {
+				attrs = append(attrs, slog.String("service", p.Name))
+			}
+		}
+		if code := c.GetString("error_code"); code != "" {
+			attrs = append(attrs, slog.String("error_code", code))
+		}
+		if cfg.headers {
+			attrs = append(attrs, slog.Any("headers", redactHeaders(c.Request.Header)))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// redactQuery keeps the values of loggedQueryParams and redacts the rest
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return redacted
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		for _, v := range values[key] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(key))
+			b.WriteByte('=')
+			if loggedQueryParams[key] {
+				b.WriteString(url.QueryEscape(v))
+			} else {
+				b.WriteString(redacted)
+			}
+		}
+	}
+	return truncate(b.String(), 500)
+}
+
+// redactHeaders flattens headers for logging, hiding credentials
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for key, vs := range h {
+		v := strings.Join(vs, ", ")
+		if redactedHeaders[key] {
+			if scheme, _, ok := strings.Cut(v, " "); ok && key == "Authorization" {
+				v = scheme + " " + redacted
+			} else {
+				v = redacted
+			}
+		}
+		out[key] = truncate(v, 200)
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// consumerPattern is what a consumer name may look like, e.g. brain.summarizer
+var consumerPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ackEventIDPattern bounds the event ids consumers ack: events.id or the
+// event_id of a mail event payload
+var ackEventIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// defaultUnackedAge is how old a mail event must be before GET
+// /events/consumers/:consumer/unacked reports it, giving consumers time to
+// process it
+const defaultUnackedAge = 5 * time.Minute
+
+// ackRequest is the body of POST /events/:id/ack
+type ackRequest struct {
+	Consumer  string `json:"consumer" binding:"required"`
+	Status    string `json:"status"` // processed (default) or failed
+	Detail    string `json:"detail"` // e.g. the failure
+	EventType string `json:"event_type"`
+}
+
+// ackLimit parses the limit query parameter of the ack listings
+func ackLimit(c *gin.Context) (int, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		return 0, invalidParam("limit", "limit must be between 1 and 500")
+	}
+	return limit, nil
+}
+
+// registerAckRoutes lets downstream consumers record which events they
+// processed, so the pipeline's stages and where it is stuck can be seen
+func registerAckRoutes(authorized *gin.RouterGroup) {
+	// Record that consumer processed (or failed to process) an event it
+	// received from NATS. Acking again replaces the status.
+	authorized.POST("/events/:id/ack", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		eventID := c.Param("id")
+		if !ackEventIDPattern.MatchString(eventID) {
+			respondError(c, invalidParam("id", "id must be an event id of at most 128 characters"))
+			return
+		}
+		var req ackRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		if !consumerPattern.MatchString(req.Consumer) {
+			respondError(c, invalidParam("consumer", "consumer must be 1-64 letters, digits or . _ -"))
+			return
+		}
+		switch req.Status {
+		case "":
+			req.Status = eventstore.AckProcessed
+		case eventstore.AckProcessed, eventstore.AckFailed:
+		default:
+			respondError(c, invalidParam("status", "status must be processed or failed"))
+			return
+		}
+		if len(req.Detail) > 2048 || len(req.EventType) > maxEventTypeLength {
+			respondError(c, badRequest("detail must be at most 2048 and event_type at most 128 characters"))
+			return
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		ack := &eventstore.EventAck{
+			EventID:   eventID,
+			Consumer:  req.Consumer,
+			EventType: req.EventType,
+			Status:    req.Status,
+			Detail:    req.Detail,
+		}
+		if err := store.AckEvent(c.Request.Context(), ack); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"event_id": eventID, "consumer": ack.Consumer, "status": ack.Status, "acked_at": ack.AckedAt})
+	})
+
+	// Which consumers processed an event
+	authorized.GET("/events/:id/acks", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		acks, err := reader.EventAcks(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"event_id": c.Param("id"), "acks": acks})
+	})
+
+	// Every consumer's processed and failed counts and latest ack
+	authorized.GET("/events/consumers", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		consumers, err := reader.ConsumerProgress(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"consumers": consumers})
+	})
+
+	// A consumer's acks, newest first (?status=failed for its failures)
+	authorized.GET("/events/consumers/:consumer/acks", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		status := c.Query("status")
+		if status != "" && status != eventstore.AckProcessed && status != eventstore.AckFailed {
+			respondError(c, invalidParam("status", "status must be processed or failed"))
+			return
+		}
+		limit, err := ackLimit(c)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		acks, err := reader.ListEventAcks(c.Request.Context(), c.Param("consumer"), status, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"consumer": c.Param("consumer"), "acks": acks})
+	})
+
+	// Received mail the consumer hasn't processed, oldest first: where it is
+	// stuck. Mail stored in the last older_than_seconds (default 300) is left
+	// out as still in flight.
+	authorized.GET("/events/consumers/:consumer/unacked", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		age := defaultUnackedAge
+		if v := c.Query("older_than_seconds"); v != "" {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs < 0 {
+				respondError(c, invalidParam("older_than_seconds", "older_than_seconds must be a non-negative integer"))
+				return
+			}
+			age = time.Duration(secs) * time.Second
+		}
+		limit, err := ackLimit(c)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		events, err := reader.UnackedMailEvents(c.Request.Context(), c.Param("consumer"), time.Now().Add(-age).Unix(), limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"consumer": c.Param("consumer"), "events": events})
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/audit"
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+	"github.com/Martian-dev/ai-brain-infra/internal/retention"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// Debug mode lifetime: defaultDebugTTL when the request doesn't say, never
+// longer than maxDebugTTL
+const (
+	defaultDebugTTL = time.Hour
+	maxDebugTTL     = 24 * time.Hour
+)
+
+// adminMiddleware rejects non-admins and writes an audit entry for every
+// admin request once it completes
+func adminMiddleware(auditLog *audit.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+		if !authUser.IsAdmin() {
+			respondError(c, forbidden("admin role required"))
+			return
+		}
+
+		c.Next()
+
+		auditLog.Log(audit.Entry{
+			Actor:  authUser.ID,
+			Action: c.Request.Method + " " + c.FullPath(),
+			Target: c.Param("user_id"),
+			Status: c.Writer.Status(),
+		})
+	}
+}
+
+// debugModeResponse reports a user's debug mode
+func debugModeResponse(mode *eventstore.DebugMode) gin.H {
+	if mode == nil {
+		return gin.H{"enabled": false}
+	}
+	return gin.H{"enabled": true, "debug": mode}
+}
+
+// registerAdminRoutes mounts support routes for admins (JWT role admin)
+func registerAdminRoutes(authorized *gin.RouterGroup, auditLog *audit.Logger, engine *projection.Engine, registry *retention.Store, configs *syncconfig.Store, off *offboarder, jobStore *jobs.Store, enrichVersion string) {
+	admin := authorized.Group("/admin", adminMiddleware(auditLog))
+	registerEventTypeRoutes(admin, registry)
+	registerOutboxAdminRoutes(admin, configs)
+	registerOffboardRoutes(admin, off)
+	registerSyncSettingsRoutes(admin)
+	registerReenrichRoutes(admin, jobStore, configs, enrichVersion)
+	registerQuarantineRoutes(admin)
+
+	// Progress of each registered projection
+	admin.GET("/projections", func(c *gin.Context) {
+		statuses, err := projections.Statuses(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		byName := make(map[string]projection.Status, len(statuses))
+		for _, st := range statuses {
+			byName[st.Name] = st
+		}
+		list := make([]projection.Status, 0, len(engine.Names()))
+		for _, name := range engine.Names() {
+			st, ok := byName[name]
+			if !ok {
+				st = projection.Status{Name: name}
+			}
+			list = append(list, st)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"projections": list})
+	})
+
+	// Rebuild a projection from its latest snapshot (from=snapshot, the
+	// default, falling back to the start without one) or the first retained
+	// event (from=start). The worker running projections picks the request up
+	// within 10 seconds.
+	admin.POST("/projections/:name/rebuild", func(c *gin.Context) {
+		name := c.Param("name")
+		if !slices.Contains(engine.Names(), name) {
+			respondError(c, notFound("no projection with that name"))
+			return
+		}
+		from := c.DefaultQuery("from", "snapshot")
+		if from != "snapshot" && from != "start" {
+			respondError(c, invalidParam("from", "from must be snapshot or start"))
+			return
+		}
+
+		if err := projections.RequestRebuild(c.Request.Context(), name, from == "start"); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"name": name, "from": from, "status": "rebuild requested"})
+	})
+
+	// Show a user's sync debug mode
+	admin.GET("/users/:user_id/debug", func(c *gin.Context) {
+		store, err := openEventStore(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		mode, err := store.LoadDebugMode(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, debugModeResponse(mode))
+	})
+
+	// Turn on verbose, sampled sync logging for a single user. Running syncs
+	// pick it up within 30 seconds.
+	admin.PUT("/users/:user_id/debug", func(c *gin.Context) {
+		var req struct {
+			SampleRate *float64 `json:"sample_rate"` // default 1
+			TTL        string   `json:"ttl"`         // default 1h, at most 24h
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		rate := 1.0
+		if req.SampleRate != nil {
+			rate = *req.SampleRate
+		}
+		if rate <= 0 || rate > 1 {
+			respondError(c, invalidParam("sample_rate", "sample_rate must be greater than 0 and at most 1"))
+			return
+		}
+
+		ttl := defaultDebugTTL
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 || d > maxDebugTTL {
+				respondError(c, invalidParam("ttl", "ttl must be a duration up to 24h, like 30m"))
+				return
+			}
+			ttl = d
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		store, err := openEventStore(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		now := time.Now()
+		mode := &eventstore.DebugMode{
+			SampleRate: rate,
+			ExpiresAt:  now.Add(ttl).Unix(),
+			SetBy:      authUser.ID,
+			SetAt:      now.Unix(),
+		}
+		if err := store.SaveDebugMode(c.Request.Context(), mode); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, debugModeResponse(mode))
+	})
+
+	// Turn a user's debug mode off
+	admin.DELETE("/users/:user_id/debug", func(c *gin.Context) {
+		store, err := openEventStore(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		if err := store.SaveDebugMode(c.Request.Context(), nil); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, debugModeResponse(nil))
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/nlquery"
+	"github.com/Martian-dev/ai-brain-infra/internal/ragcontext"
+	"github.com/Martian-dev/ai-brain-infra/internal/retention"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+	"github.com/Martian-dev/ai-brain-infra/internal/tasksink"
+	"github.com/Martian-dev/ai-brain-infra/internal/workflow"
+)
+
+// Error codes are stable, machine-readable identifiers returned in the "code"
+// field of every error response. Messages may change; codes don't.
+const (
+	CodeInvalidRequest      = "INVALID_REQUEST"
+	CodeUnauthenticated     = "UNAUTHENTICATED"
+	CodeForbidden           = "FORBIDDEN"
+	CodeNotFound            = "NOT_FOUND"
+	CodeTokenMissing        = "TOKEN_MISSING"
+	CodeProviderUnsupported = "PROVIDER_UNSUPPORTED"
+	CodeProviderCapability  = "PROVIDER_CAPABILITY_MISSING"
+	CodeAccountNotConnected = "ACCOUNT_NOT_CONNECTED"
+	CodeScopeMissing        = "SCOPE_MISSING"
+	CodeReauthRequired      = "REAUTH_REQUIRED"
+	CodeSyncAlreadyRunning  = "SYNC_ALREADY_RUNNING"
+	CodeSyncNotRunning      = "SYNC_NOT_RUNNING"
+	CodeFeatureDisabled     = "FEATURE_DISABLED"
+	CodeStoreBusy           = "STORE_BUSY"
+	CodeWorkflowFinished    = "WORKFLOW_FINISHED"
+	CodeDependencyDown      = "DEPENDENCY_UNAVAILABLE"
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeInternal            = "INTERNAL"
+)
+
+// apiError is the body of an error response:
+//
+//	{"error": "human readable message", "code": "SYNC_ALREADY_RUNNING", "details": {...}}
+//
+// "error" stays a string so existing clients keep working.
+type apiError struct {
+	Status  int                    `json:"-"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"error"`
+	Details map[string]interface{} `json:"details,omitempty"`
+
+	// cause is logged for server errors but never sent to the client
+	cause error
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.cause
+}
+
+// withDetail returns a copy of e with a detail field set
+func (e *apiError) withDetail(key string, value interface{}) *apiError {
+	cp := *e
+	cp.Details = make(map[string]interface{}, len(e.Details)+1)
+	for k, v := range e.Details {
+		cp.Details[k] = v
+	}
+	cp.Details[key] = value
+	return &cp
+}
+
+// withCause returns a copy of e that logs err as its underlying cause
+func (e *apiError) withCause(err error) *apiError {
+	cp := *e
+	cp.cause = err
+	return &cp
+}
+
+// Common errors
+var (
+	errUnauthenticated     = &apiError{Status: http.StatusUnauthorized, Code: CodeUnauthenticated, Message: "user not found in context"}
+	errInvalidToken        = &apiError{Status: http.StatusUnauthorized, Code: CodeUnauthenticated, Message: "invalid or expired token"}
+	errInvalidServiceToken = &apiError{Status: http.StatusUnauthorized, Code: CodeUnauthenticated, Message: "invalid or expired service token"}
+	errTokenMissing        = &apiError{Status: http.StatusUnauthorized, Code: CodeTokenMissing, Message: "missing token"}
+	errProviderUnsupported = &apiError{Status: http.StatusBadRequest, Code: CodeProviderUnsupported, Message: "unsupported provider"}
+	errSchedulerDisabled   = &apiError{Status: http.StatusServiceUnavailable, Code: CodeFeatureDisabled, Message: "scheduled actions are not enabled"}
+	errTaskSinksDisabled   = &apiError{Status: http.StatusServiceUnavailable, Code: CodeFeatureDisabled, Message: "task sinks are not enabled"}
+	errLLMDisabled         = &apiError{Status: http.StatusServiceUnavailable, Code: CodeFeatureDisabled, Message: "no language model is configured"}
+	errEmbeddingsDisabled  = &apiError{Status: http.StatusServiceUnavailable, Code: CodeFeatureDisabled, Message: "embeddings are not enabled"}
+	errAuthUnavailable     = &apiError{Status: http.StatusServiceUnavailable, Code: CodeDependencyDown, Message: "authentication keys not loaded yet, retry shortly"}
+	errEventRateLimited    = &apiError{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Message: "too many events written for this user, slow down"}
+	errInternal            = &apiError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal server error"}
+)
+
+// badRequest is an INVALID_REQUEST error with a client-facing message
+func badRequest(message string) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: message}
+}
+
+// invalidParam is an INVALID_REQUEST error naming the offending parameter
+func invalidParam(param, message string) *apiError {
+	return badRequest(message).withDetail("param", param)
+}
+
+// invalidRequest reports a request body or validation error
+func invalidRequest(err error) *apiError {
+	return badRequest(err.Error())
+}
+
+// notFound is a NOT_FOUND error
+func notFound(message string) *apiError {
+	return &apiError{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+// forbidden is a FORBIDDEN error
+func forbidden(message string) *apiError {
+	return &apiError{Status: http.StatusForbidden, Code: CodeForbidden, Message: message}
+}
+
+// errorMappings translate sentinel errors from internal packages. Their
+// messages are meant for callers, so they are passed through.
+var errorMappings = []struct {
+	target error
+	status int
+	code   string
+}{
+	{sync.ErrSyncAlreadyRunning, http.StatusConflict, CodeSyncAlreadyRunning},
+	{sync.ErrSyncNotRunning, http.StatusConflict, CodeSyncNotRunning},
+	{sync.ErrInboxConflict, http.StatusConflict, CodeSyncAlreadyRunning},
+	{sync.ErrUnsupportedProvider, http.StatusBadRequest, CodeProviderUnsupported},
+	{sync.ErrNotSupported, http.StatusNotImplemented, CodeProviderCapability},
+	{sync.ErrMessageNotFound, http.StatusNotFound, CodeNotFound},
+	{sync.ErrNoUnsubscribe, http.StatusBadRequest, CodeInvalidRequest},
+	{sync.ErrUnsubscribeFailed, http.StatusBadGateway, CodeDependencyDown},
+	{auth.ErrAccountNotConnected, http.StatusConflict, CodeAccountNotConnected},
+	{auth.ErrAuthRejected, http.StatusUnauthorized, CodeUnauthenticated},
+	{auth.ErrAuthServer, http.StatusServiceUnavailable, CodeDependencyDown},
+	{eventstore.ErrInvalidSort, http.StatusBadRequest, CodeInvalidRequest},
+	{eventstore.ErrInvalidMerge, http.StatusBadRequest, CodeInvalidRequest},
+	{eventstore.ErrInvalidSenderRule, http.StatusBadRequest, CodeInvalidRequest},
+	{eventstore.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{eventstore.ErrBusy, http.StatusServiceUnavailable, CodeStoreBusy},
+	{blob.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{nlquery.ErrEmptyQuestion, http.StatusBadRequest, CodeInvalidRequest},
+	{ragcontext.ErrEmptyTopic, http.StatusBadRequest, CodeInvalidRequest},
+	{tasksink.ErrUnknownSink, http.StatusNotFound, CodeNotFound},
+	{tasksink.ErrInvalidSettings, http.StatusBadRequest, CodeInvalidRequest},
+	{workflow.ErrUnknownWorkflow, http.StatusBadRequest, CodeInvalidRequest},
+	{workflow.ErrFinished, http.StatusConflict, CodeWorkflowFinished},
+	{retention.ErrInvalidTTL, http.StatusBadRequest, CodeInvalidRequest},
+	{sync.ErrInvalidSettings, http.StatusBadRequest, CodeInvalidRequest},
+	{sync.ErrMissingScopes, http.StatusForbidden, CodeScopeMissing},
+	{sync.ErrTokenExpired, http.StatusConflict, CodeReauthRequired},
+}
+
+// toAPIError converts err to the error sent to the client. Errors that are
+// neither apiErrors nor mapped sentinels become INTERNAL without their
+// message, which may contain paths, SQL or upstream responses.
+func toAPIError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			return &apiError{Status: m.status, Code: m.code, Message: err.Error()}
+		}
+	}
+	return errInternal
+}
+
+// respondError aborts the request with a typed error response. Server errors
+// are logged with the underlying error.
+func respondError(c *gin.Context, err error) {
+	apiErr := toAPIError(err)
+	if apiErr.Status >= http.StatusInternalServerError {
+		if apiErr == err && apiErr.cause != nil {
+			err = apiErr.cause
+		}
+		log.Printf("%s %s [%s]: %s: %v", c.Request.Method, c.FullPath(), c.GetString("request_id"), apiErr.Code, err)
+		reportRequestError(c, errreport.SourceHTTP, err, nil)
+	}
+	c.Set("error_code", apiErr.Code)
+	c.AbortWithStatusJSON(apiErr.Status, apiErr)
+}
+
+// recoverPanic answers a panicking request with INTERNAL and reports the
+// panic. gin's recovery middleware has already logged the stack.
+func recoverPanic(c *gin.Context, recovered interface{}) {
+	reportRequestError(c, errreport.SourcePanic, fmt.Errorf("panic: %v", recovered), debug.Stack())
+	c.Set("error_code", errInternal.Code)
+	c.AbortWithStatusJSON(errInternal.Status, errInternal)
+}
+
+// reportRequestError sends a request failure to the error reporter, tagged
+// with the route and the authenticated user
+func reportRequestError(c *gin.Context, source string, err error, stack []byte) {
+	ev := errreport.Event{
+		Source: source,
+		Err:    err,
+		Stack:  stack,
+		Tags: map[string]string{
+			"method":     c.Request.Method,
+			"route":      c.FullPath(),
+			"request_id": c.GetString("request_id"),
+		},
+	}
+	if user, ok := c.Get("user"); ok {
+		if u, ok := user.(*auth.User); ok {
+			ev.UserID = u.ID
+		}
+	}
+	errreport.Report(c.Request.Context(), reporter, ev)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/archive"
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+)
+
+// jobArchiveMessages moves messages past the hot window to object storage
+const jobArchiveMessages = "archive_messages"
+
+// newArchiver configures tiered storage from ARCHIVE_AFTER_DAYS: mail older
+// than that moves to segments in the blob store. Returns nil when it's off.
+func newArchiver(stores eventstore.Opener, blobStore blob.Store) (*archive.Archiver, error) {
+	v := os.Getenv("ARCHIVE_AFTER_DAYS")
+	if v == "" {
+		return nil, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 {
+		return nil, fmt.Errorf("invalid ARCHIVE_AFTER_DAYS %q: want a number of days", v)
+	}
+	if blobStore == nil {
+		return nil, fmt.Errorf("ARCHIVE_AFTER_DAYS needs BLOB_STORE")
+	}
+	if stores.Shared() {
+		return nil, fmt.Errorf("ARCHIVE_AFTER_DAYS needs per-user storage (STORAGE_MODE=per_user)")
+	}
+
+	cacheMB := 1024
+	if v := os.Getenv("ARCHIVE_CACHE_MB"); v != "" {
+		if cacheMB, err = strconv.Atoi(v); err != nil || cacheMB < 1 {
+			return nil, fmt.Errorf("invalid ARCHIVE_CACHE_MB %q", v)
+		}
+	}
+
+	return archive.New(stores, filepath.Join("data", "users"), blobStore,
+		time.Duration(days)*24*time.Hour, filepath.Join("data", "archive-cache"), int64(cacheMB)<<20), nil
+}
+
+// registerArchiveJob archives on ARCHIVE_SCHEDULE (default daily). archiver
+// may be nil.
+func registerArchiveJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, archiver *archive.Archiver) error {
+	// Registered even without tiering, so a leftover job doesn't sit
+	// unclaimed
+	runner.Register(jobArchiveMessages, jobs.Kind{
+		Timeout: time.Hour,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			if archiver == nil {
+				return nil
+			}
+			n, err := archiver.Run(ctx)
+			if n > 0 {
+				log.Printf("Archive: moved %d messages to object storage", n)
+			}
+			return err
+		},
+	})
+	if archiver == nil {
+		return nil
+	}
+
+	schedule := os.Getenv("ARCHIVE_SCHEDULE")
+	if schedule == "" {
+		schedule = "@daily"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid ARCHIVE_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobArchiveMessages, jobArchiveMessages, schedule, nil)
+	return err
+}
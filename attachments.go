@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/attachments"
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/extract"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// jobAttachmentText extracts a user's pending attachments, a batch per run,
+// queuing its own continuation until none are left
+const jobAttachmentText = "attachment_text"
+
+// maxAttachmentSize is the largest ATTACHMENT_MAX_SIZE; archive import keeps
+// no content beyond it
+const maxAttachmentSize = 32 << 20
+
+// attachmentPolicy reads ATTACHMENT_TYPES (default "pdf,docx,xlsx", "none"
+// to keep none) and ATTACHMENT_MAX_SIZE (default 10MB, in bytes)
+func attachmentPolicy() (*sync.AttachmentPolicy, error) {
+	policy := &sync.AttachmentPolicy{Types: make(map[string]bool), MaxSize: 10 << 20}
+
+	types := os.Getenv("ATTACHMENT_TYPES")
+	if types == "" {
+		types = strings.Join([]string{extract.PDF, extract.DOCX, extract.XLSX}, ",")
+	}
+	if types != "none" {
+		for _, t := range strings.Split(types, ",") {
+			switch t = strings.ToLower(strings.TrimSpace(t)); t {
+			case extract.PDF, extract.DOCX, extract.XLSX:
+				policy.Types[t] = true
+			default:
+				return nil, fmt.Errorf("invalid ATTACHMENT_TYPES entry %q: want pdf, docx or xlsx", t)
+			}
+		}
+	}
+
+	if v := os.Getenv("ATTACHMENT_MAX_SIZE"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > maxAttachmentSize {
+			return nil, fmt.Errorf("invalid ATTACHMENT_MAX_SIZE %q: want 1-%d bytes", v, maxAttachmentSize)
+		}
+		policy.MaxSize = n
+	}
+	return policy, nil
+}
+
+// registerAttachmentJob runs extraction for users with pending attachments
+func registerAttachmentJob(runner *jobs.Runner, store *jobs.Store, extractor *attachments.Extractor) {
+	runner.Register(jobAttachmentText, jobs.Kind{
+		Timeout: 10 * time.Minute,
+		Handler: func(ctx context.Context, job jobs.Job) error {
+			done, err := extractor.Run(ctx, job.UserID)
+			if err != nil || done {
+				return err
+			}
+			_, err = store.Enqueue(ctx, job.UserID, jobAttachmentText, nil, time.Now())
+			return err
+		},
+	})
+}
+
+// queueAttachmentText queues extraction for the user unless a run is
+// already waiting
+func queueAttachmentText(ctx context.Context, store *jobs.Store, userID string) error {
+	pending, err := store.ListPending(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, j := range pending {
+		if j.Kind == jobAttachmentText && j.Status == jobs.StatusPending {
+			return nil
+		}
+	}
+	_, err = store.Enqueue(ctx, userID, jobAttachmentText, nil, time.Now())
+	return err
+}
+
+// registerAttachmentRoutes lists a message's attachments with their
+// extracted text
+func registerAttachmentRoutes(authorized *gin.RouterGroup) {
+	authorized.GET("/mail/messages/:id/attachments", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider := strings.ToUpper(c.Query("provider"))
+		if provider == "" {
+			respondError(c, invalidParam("provider", "provider is required"))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		list, err := reader.MessageAttachments(c.Request.Context(), provider, c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message_id":  c.Param("id"),
+			"provider":    provider,
+			"attachments": list,
+		})
+	})
+}
@@ -238,6 +238,145 @@ app.get(
   }
 );
 
+// Internal token endpoint - lets the API fetch a user's provider token for
+// background work (scheduled actions) using an HS256 service token signed with
+// SERVICE_TOKEN_SECRET and carrying the tokens:read scope
+app.get(
+  "/api/internal/users/:userId/accounts/:provider/token",
+  async (req: Request, res: Response) => {
+    try {
+      const secret = process.env.SERVICE_TOKEN_SECRET;
+      if (!secret) {
+        return res.status(404).json({ error: "Not found" });
+      }
+
+      const authHeader = req.headers.authorization;
+      if (!authHeader?.startsWith("Bearer ")) {
+        return res.status(401).json({ error: "Missing authorization" });
+      }
+
+      try {
+        const decoded = jwt.verify(authHeader.substring(7), secret, {
+          algorithms: ["HS256"],
+          issuer: "ai-brain-api",
+        }) as any;
+        const scopes = String(decoded.scope || "").split(" ");
+        if (!String(decoded.sub || "").startsWith("svc:")) {
+          return res.status(401).json({ error: "Invalid token" });
+        }
+        if (!scopes.includes("tokens:read")) {
+          return res.status(403).json({ error: "Missing scope tokens:read" });
+        }
+      } catch (error) {
+        return res.status(401).json({ error: "Invalid token" });
+      }
+
+      const { userId, provider } = req.params;
+
+      const db = (auth as any).options.database;
+      const account = db
+        .prepare("SELECT * FROM account WHERE userId = ? AND providerId = ?")
+        .get(userId, provider);
+
+      if (!account) {
+        return res
+          .status(404)
+          .json({ error: `No ${provider} account connected` });
+      }
+
+      let expiresAt = 0;
+      if (account.accessTokenExpiresAt) {
+        if (typeof account.accessTokenExpiresAt === "string") {
+          expiresAt = Math.floor(
+            new Date(account.accessTokenExpiresAt).getTime() / 1000
+          );
+        } else {
+          expiresAt = account.accessTokenExpiresAt;
+        }
+      }
+
+      res.json({
+        access_token: account.accessToken,
+        refresh_token: account.refreshToken,
+        expires_at: expiresAt,
+      });
+    } catch (error) {
+      console.error("Error fetching account token:", error);
+      res.status(500).json({ error: "Failed to fetch token" });
+    }
+  }
+);
+
+// Revoke OAuth token - revokes at the provider (where supported) and unlinks the account
+app.delete(
+  "/api/auth/accounts/:provider/token",
+  async (req: Request, res: Response) => {
+    try {
+      const authHeader = req.headers.authorization;
+      if (!authHeader?.startsWith("Bearer ")) {
+        return res.status(401).json({ error: "Missing authorization" });
+      }
+
+      const token = authHeader.substring(7);
+
+      // Verify JWT and extract user ID
+      let userId: string;
+      try {
+        const decoded = jwt.verify(token, publicKey, {
+          algorithms: ["RS256"],
+        }) as any;
+        userId = decoded.sub;
+      } catch (error) {
+        return res.status(401).json({ error: "Invalid token" });
+      }
+
+      const provider = req.params.provider;
+
+      const db = (auth as any).options.database;
+      const account = db
+        .prepare("SELECT * FROM account WHERE userId = ? AND providerId = ?")
+        .get(userId, provider);
+
+      if (!account) {
+        return res
+          .status(404)
+          .json({ error: `No ${provider} account connected` });
+      }
+
+      // Google supports token revocation; Microsoft has no per-token revoke endpoint,
+      // so unlinking the account is the best we can do there
+      if (provider === "google") {
+        const revokeToken = account.refreshToken || account.accessToken;
+        if (revokeToken) {
+          const response = await fetch(
+            `https://oauth2.googleapis.com/revoke?token=${encodeURIComponent(revokeToken)}`,
+            {
+              method: "POST",
+              headers: { "Content-Type": "application/x-www-form-urlencoded" },
+            }
+          );
+          // 400 means the token is already invalid - treat as revoked
+          if (!response.ok && response.status !== 400) {
+            return res
+              .status(502)
+              .json({ error: `Provider revoke failed: ${response.status}` });
+          }
+        }
+      }
+
+      db.prepare("DELETE FROM account WHERE userId = ? AND providerId = ?").run(
+        userId,
+        provider
+      );
+
+      res.status(204).end();
+    } catch (error) {
+      console.error("Error revoking account token:", error);
+      res.status(500).json({ error: "Failed to revoke token" });
+    }
+  }
+);
+
 // Readiness probe - checks database connection
 app.get("/ready", async (req: Request, res: Response) => {
   try {
@@ -331,6 +470,7 @@ app.all("/api/auth/*", async (req: Request, res: Response) => {
             sub: responseData.user.id,
             email: responseData.user.email,
             name: responseData.user.name,
+            role: responseData.user.role,
           },
           privateKey,
           {
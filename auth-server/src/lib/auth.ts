@@ -1,5 +1,5 @@
 import { betterAuth } from "better-auth";
-import { jwt } from "better-auth/plugins";
+import { genericOAuth, jwt } from "better-auth/plugins";
 import Database from "better-sqlite3";
 import path from "path";
 import fs from "fs";
@@ -43,6 +43,17 @@ export const auth = betterAuth({
     // Auto-signin after signup for better UX
     autoSignIn: true,
   },
+  user: {
+    additionalFields: {
+      // "admin" unlocks the API's admin routes and impersonation. Operators
+      // set it in the database; users can't set it when signing up.
+      role: {
+        type: "string",
+        required: false,
+        input: false,
+      },
+    },
+  },
   socialProviders: {
     google: {
       clientId: process.env.GOOGLE_CLIENT_ID as string,
@@ -52,19 +63,79 @@ export const auth = betterAuth({
       scope: [
         "https://www.googleapis.com/auth/gmail.readonly",
         "https://www.googleapis.com/auth/gmail.metadata",
+        "https://www.googleapis.com/auth/gmail.send",
+        "https://www.googleapis.com/auth/gmail.modify",
       ],
     },
     microsoft: {
       clientId: process.env.MICROSOFT_CLIENT_ID as string,
       clientSecret: process.env.MICROSOFT_CLIENT_SECRET as string,
+      scope: ["Mail.ReadWrite", "Mail.Send"],
     },
+    // Task systems the API pushes extracted action items to (optional)
+    ...(process.env.LINEAR_CLIENT_ID && {
+      linear: {
+        clientId: process.env.LINEAR_CLIENT_ID,
+        clientSecret: process.env.LINEAR_CLIENT_SECRET as string,
+        scope: ["read", "write"],
+      },
+    }),
+    ...(process.env.NOTION_CLIENT_ID && {
+      notion: {
+        clientId: process.env.NOTION_CLIENT_ID,
+        clientSecret: process.env.NOTION_CLIENT_SECRET as string,
+      },
+    }),
   },
   plugins: [
+    // Todoist has no built-in provider; link it with
+    // POST /api/auth/oauth2/link {providerId: "todoist"}
+    ...(process.env.TODOIST_CLIENT_ID
+      ? [
+          genericOAuth({
+            config: [
+              {
+                providerId: "todoist",
+                clientId: process.env.TODOIST_CLIENT_ID,
+                clientSecret: process.env.TODOIST_CLIENT_SECRET as string,
+                authorizationUrl: "https://todoist.com/oauth/authorize",
+                tokenUrl: "https://todoist.com/oauth/access_token",
+                scopes: ["data:read_write"],
+                getUserInfo: async (tokens) => {
+                  const res = await fetch(
+                    "https://api.todoist.com/sync/v9/user",
+                    { headers: { Authorization: `Bearer ${tokens.accessToken}` } }
+                  );
+                  if (!res.ok) return null;
+                  const user = await res.json();
+                  return {
+                    id: String(user.id),
+                    email: user.email,
+                    name: user.full_name,
+                    emailVerified: true,
+                    createdAt: new Date(),
+                    updatedAt: new Date(),
+                  };
+                },
+              },
+            ],
+          }),
+        ]
+      : []),
     jwt({
       // Short-lived tokens for security, but long enough to avoid frequent renewal
       expiresIn: 60 * 60 * 2, // 2 hours (optimized balance)
       // Use RS256 for asymmetric signing (more secure for distributed systems)
       algorithm: "RS256",
+      jwt: {
+        // Claims the API reads (internal/auth/jwt.go); sub is the user ID
+        definePayload: ({ user }: { user: Record<string, any> }) => ({
+          id: user.id,
+          email: user.email,
+          name: user.name,
+          ...(user.role && { role: user.role }),
+        }),
+      },
     } as unknown as any),
   ],
   session: {
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore/sqlite"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/providers/fake"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// maxLatencySamples bounds the dispatch latencies kept for percentiles
+const maxLatencySamples = 200000
+
+// benchConfig is read from BENCH_* variables; the fake provider's FAKE_MAIL_*
+// variables shape each user's mail
+type benchConfig struct {
+	Users        int
+	Duration     time.Duration
+	PollInterval time.Duration // time between incremental cycles
+	Mail         fake.Config
+}
+
+func benchConfigFromEnv() (benchConfig, error) {
+	cfg := benchConfig{Users: 10, Duration: time.Minute, PollInterval: 5 * time.Second}
+	if v := os.Getenv("BENCH_USERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid BENCH_USERS %q: want a positive number", v)
+		}
+		cfg.Users = n
+	}
+	for env, dst := range map[string]*time.Duration{
+		"BENCH_DURATION":      &cfg.Duration,
+		"BENCH_POLL_INTERVAL": &cfg.PollInterval,
+	} {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return cfg, fmt.Errorf("invalid %s %q: want a positive duration like 30s", env, v)
+			}
+			*dst = d
+		}
+	}
+	mail, err := fakeProviderConfig()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Mail = mail
+	return cfg, nil
+}
+
+// runBench drives synthetic users through connect, initial backfill and
+// incremental cycles with the fake provider, against a throwaway data
+// directory and the configured NATS, then reports throughput, outbox dispatch
+// latency and write and publish rates. It returns the exit code.
+func runBench() int {
+	cfg, err := benchConfigFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	dir, err := os.MkdirTemp("", "ai-brain-bench-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	stores, err := benchStores(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer stores.Close()
+
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+	if os.Getenv("NATS_EMBEDDED") == "true" {
+		embedded, err := natsjs.StartEmbedded(natsjs.EmbeddedConfig{Dir: filepath.Join(dir, "nats"), Listen: "127.0.0.1:0"})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "start embedded NATS: %v\n", err)
+			return 1
+		}
+		defer embedded.Shutdown()
+		natsURL = embedded.URL()
+	}
+	publisher, err := natsjs.NewPublisher(natsURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connect to NATS: %v\n", err)
+		return 1
+	}
+	defer publisher.Close()
+
+	if _, ok := sync.LookupProvider(fake.ProviderFake); !ok {
+		fake.Register(cfg.Mail)
+	}
+
+	metrics := newBenchMetrics()
+	manager := sync.NewManager(&benchOpener{Opener: stores, metrics: metrics}, nil, publisher, sync.RegisteredProviders)
+
+	log.Printf("Bench: %d users for %s, %d backfill messages each, %g/min after, polling every %s, NATS %s, data in %s",
+		cfg.Users, cfg.Duration, cfg.Mail.Backfill, cfg.Mail.Rate, cfg.PollInterval, natsURL, dir)
+
+	ctx := context.Background()
+	start := time.Now()
+	var connects []time.Duration
+	for i := 0; i < cfg.Users; i++ {
+		t := time.Now()
+		err := manager.StartSync(ctx, sync.InboxConfig{
+			UserID:   fmt.Sprintf("bench-%04d", i),
+			InboxID:  defaultInboxID,
+			Provider: fake.ProviderFake,
+			Options:  sync.ProviderOptions{PollInterval: cfg.PollInterval},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "connect user %d: %v\n", i, err)
+			manager.StopAll()
+			return 1
+		}
+		connects = append(connects, time.Since(t))
+	}
+
+	// Wait out the run, noting when every initial backfill finished
+	var backfilled time.Duration
+	var backfillMessages int64
+	deadline := start.Add(cfg.Duration)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		if backfilled == 0 && backfillsDone(manager) {
+			backfilled = time.Since(start)
+			backfillMessages = metrics.messages.Load()
+		}
+	}
+	elapsed := time.Since(start)
+	manager.StopAll()
+	time.Sleep(time.Second) // let runners write their last heartbeat
+
+	report := benchReport{
+		cfg:              cfg,
+		elapsed:          elapsed,
+		connects:         connects,
+		backfilled:       backfilled,
+		backfillMessages: backfillMessages,
+		metrics:          metrics,
+	}
+	report.print()
+	return 0
+}
+
+// benchStores opens user storage in dir, honouring STORAGE_MODE
+func benchStores(dir string) (eventstore.Opener, error) {
+	switch mode := os.Getenv("STORAGE_MODE"); mode {
+	case "", "per_user":
+		return sqlite.NewOpener(filepath.Join(dir, "users")), nil
+	case "shared":
+		return sqlite.NewSharedOpener(filepath.Join(dir, "shared.db"))
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_MODE %q (want per_user or shared)", mode)
+	}
+}
+
+// backfillsDone reports whether every running sync finished its first cycle
+func backfillsDone(manager *sync.Manager) bool {
+	for _, s := range manager.GetRunningSyncs("") {
+		if s.Phase == sync.PhaseStarting || s.Phase == sync.PhaseBackfill {
+			return false
+		}
+	}
+	return true
+}
+
+// benchMetrics counts what the stores see during a run
+type benchMetrics struct {
+	messages     atomic.Int64 // new messages stored
+	outbox       atomic.Int64 // outbox entries committed
+	writeTxs     atomic.Int64 // committed write transactions
+	published    atomic.Int64 // outbox entries published to NATS
+	publishFails atomic.Int64
+
+	mu        gosync.Mutex
+	queued    map[string]time.Time // user|msg id → commit time, until published
+	latencies []time.Duration      // commit to publish
+}
+
+func newBenchMetrics() *benchMetrics {
+	return &benchMetrics{queued: make(map[string]time.Time)}
+}
+
+func (m *benchMetrics) committed(keys []string) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		m.queued[key] = now
+	}
+}
+
+func (m *benchMetrics) publishedKey(key string) {
+	m.published.Add(1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if at, ok := m.queued[key]; ok {
+		delete(m.queued, key)
+		if len(m.latencies) < maxLatencySamples {
+			m.latencies = append(m.latencies, time.Since(at))
+		}
+	}
+}
+
+// benchOpener wraps the stores the sync manager opens to count their writes
+type benchOpener struct {
+	eventstore.Opener
+	metrics *benchMetrics
+}
+
+func (o *benchOpener) Open(userID string) (eventstore.Store, error) {
+	store, err := o.Opener.Open(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &benchStore{Store: store, userID: userID, metrics: o.metrics, msgIDs: make(map[int64]string)}, nil
+}
+
+// benchStore counts write transactions and tracks outbox entries from commit
+// to publish
+type benchStore struct {
+	eventstore.Store
+	userID  string
+	metrics *benchMetrics
+
+	mu     gosync.Mutex
+	msgIDs map[int64]string // dequeued outbox id → msg id
+}
+
+func (s *benchStore) WithTx(ctx context.Context, fn func(tx eventstore.Tx) error) error {
+	var tx *benchTx
+	err := s.Store.WithTx(ctx, func(inner eventstore.Tx) error {
+		tx = &benchTx{Tx: inner, userID: s.userID} // fresh on every retry
+		return fn(tx)
+	})
+	if err == nil && tx != nil {
+		s.metrics.writeTxs.Add(1)
+		s.metrics.messages.Add(tx.messages)
+		s.metrics.outbox.Add(int64(len(tx.keys)))
+		s.metrics.committed(tx.keys)
+	}
+	return err
+}
+
+func (s *benchStore) DequeueOutbox(ctx context.Context, limit int) ([]eventstore.OutboxMessage, error) {
+	messages, err := s.Store.DequeueOutbox(ctx, limit)
+	s.mu.Lock()
+	for _, msg := range messages {
+		s.msgIDs[msg.ID] = msg.MsgID
+	}
+	s.mu.Unlock()
+	return messages, err
+}
+
+func (s *benchStore) MarkPublished(ctx context.Context, id int64, stream string, seq uint64) error {
+	err := s.Store.MarkPublished(ctx, id, stream, seq)
+	s.mu.Lock()
+	msgID := s.msgIDs[id]
+	delete(s.msgIDs, id)
+	s.mu.Unlock()
+	if err == nil {
+		s.metrics.publishedKey(s.userID + "|" + msgID)
+	}
+	return err
+}
+
+func (s *benchStore) MarkOutboxRetry(ctx context.Context, id int64, backoff time.Duration, lastError string) error {
+	s.metrics.publishFails.Add(1)
+	return s.Store.MarkOutboxRetry(ctx, id, backoff, lastError)
+}
+
+// benchTx notes the outbox entries of one transaction attempt
+type benchTx struct {
+	eventstore.Tx
+	userID   string
+	messages int64
+	keys     []string
+}
+
+func (t *benchTx) AppendEmailReceived(ctx context.Context, ev eventstore.EmailEvent, out eventstore.OutboxEntry) (bool, error) {
+	added, err := t.Tx.AppendEmailReceived(ctx, ev, out)
+	if added && err == nil {
+		t.messages++
+		t.keys = append(t.keys, t.userID+"|"+out.MsgID)
+	}
+	return added, err
+}
+
+func (t *benchTx) AppendOutbox(ctx context.Context, out eventstore.OutboxEntry) error {
+	err := t.Tx.AppendOutbox(ctx, out)
+	if err == nil {
+		t.keys = append(t.keys, t.userID+"|"+out.MsgID)
+	}
+	return err
+}
+
+// benchReport is the outcome of a run
+type benchReport struct {
+	cfg              benchConfig
+	elapsed          time.Duration
+	connects         []time.Duration
+	backfilled       time.Duration // 0 if backfills outlasted the run
+	backfillMessages int64
+	metrics          *benchMetrics
+}
+
+func (r benchReport) print() {
+	m := r.metrics
+	secs := r.elapsed.Seconds()
+	rate := func(n int64, secs float64) string {
+		if secs <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f/s", float64(n)/secs)
+	}
+
+	fmt.Printf("\nBench results (%d users, %s)\n", r.cfg.Users, r.elapsed.Round(time.Millisecond))
+	fmt.Printf("  connect             p50 %s  max %s\n", percentile(r.connects, 50), percentile(r.connects, 100))
+	if r.backfilled > 0 {
+		fmt.Printf("  initial backfills   %d messages in %s (%s)\n", r.backfillMessages, r.backfilled.Round(time.Millisecond),
+			rate(r.backfillMessages, r.backfilled.Seconds()))
+		incremental := m.messages.Load() - r.backfillMessages
+		fmt.Printf("  incremental         %d messages (%s)\n", incremental, rate(incremental, (r.elapsed-r.backfilled).Seconds()))
+	} else {
+		fmt.Printf("  initial backfills   not finished within the run\n")
+	}
+	fmt.Printf("  messages stored     %d (%s)\n", m.messages.Load(), rate(m.messages.Load(), secs))
+	fmt.Printf("  SQLite write txs    %d (%s)\n", m.writeTxs.Load(), rate(m.writeTxs.Load(), secs))
+	fmt.Printf("  outbox entries      %d (%s)\n", m.outbox.Load(), rate(m.outbox.Load(), secs))
+	fmt.Printf("  NATS publishes      %d (%s), %d failed\n", m.published.Load(), rate(m.published.Load(), secs), m.publishFails.Load())
+
+	m.mu.Lock()
+	latencies := m.latencies
+	backlog := len(m.queued)
+	m.mu.Unlock()
+	fmt.Printf("  dispatch latency    p50 %s  p95 %s  p99 %s  max %s\n",
+		percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99), percentile(latencies, 100))
+	fmt.Printf("  outbox backlog      %d unpublished at the end\n", backlog)
+}
+
+// percentile returns the pth percentile of ds, "-" if there are none
+func percentile(ds []time.Duration, p int) string {
+	if len(ds) == 0 {
+		return "-"
+	}
+	sorted := append([]time.Duration(nil), ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(i, 0)].Round(time.Microsecond).String()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+)
+
+// newBlobStore configures the blob backend from BLOB_STORE (local, s3, gcs).
+// Returns nil when blob storage is disabled.
+func newBlobStore() (blob.Store, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "":
+		return nil, nil
+	case "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = filepath.Join("data", "blobs")
+		}
+		baseURL := os.Getenv("BLOB_BASE_URL")
+		if baseURL == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			baseURL = "http://localhost:" + port
+		}
+		return blob.NewLocal(dir, baseURL, []byte(os.Getenv("BLOB_URL_SECRET")))
+	case "s3":
+		return blob.NewS3(blob.S3Config{
+			Endpoint:  os.Getenv("BLOB_ENDPOINT"),
+			Region:    os.Getenv("BLOB_REGION"),
+			Bucket:    os.Getenv("BLOB_BUCKET"),
+			AccessKey: os.Getenv("BLOB_ACCESS_KEY"),
+			SecretKey: os.Getenv("BLOB_SECRET_KEY"),
+		})
+	case "gcs":
+		return blob.NewGCS(os.Getenv("BLOB_BUCKET"), os.Getenv("BLOB_ACCESS_KEY"), os.Getenv("BLOB_SECRET_KEY"))
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q (want local, s3 or gcs)", os.Getenv("BLOB_STORE"))
+	}
+}
+
+// registerBlobRoutes adds signed-URL generation for the user's own blobs and,
+// for the local backend, the unauthenticated download route those URLs point at
+func registerBlobRoutes(r *gin.Engine, authorized *gin.RouterGroup, store blob.Store) {
+	authorized.GET("/blobs/url", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		key, err := blob.UserRelativeKey(authUser.ID, c.Query("key"))
+		if err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		ttl := 15 * time.Minute
+		if v := c.Query("ttl"); v != "" {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds < 1 || seconds > 7*24*3600 {
+				respondError(c, invalidParam("ttl", "ttl must be between 1 and 604800 seconds"))
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+
+		signed, err := store.SignedURL(c.Request.Context(), key, ttl)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"key":        key,
+			"url":        signed,
+			"expires_at": time.Now().Add(ttl).Unix(),
+		})
+	})
+
+	local, ok := store.(*blob.Local)
+	if !ok {
+		return
+	}
+
+	// The signature authorizes the download, so no JWT is required
+	r.GET("/blobs/download/*key", func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		if err := local.Verify(key, c.Query("expires"), c.Query("sig")); err != nil {
+			respondError(c, forbidden(err.Error()))
+			return
+		}
+
+		rc, obj, err := local.Get(c.Request.Context(), key)
+		if err == blob.ErrNotFound {
+			respondError(c, notFound("blob not found"))
+			return
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer rc.Close()
+
+		c.DataFromReader(http.StatusOK, obj.Size, obj.ContentType, io.Reader(rc), nil)
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// defaultInboxID is used when a connect or disconnect request names no inbox
+const defaultInboxID = "primary"
+
+// inboxIDPattern restricts inbox ids to characters safe in sync keys and logs
+var inboxIDPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// Limits of the per-inbox sync options accepted by /mail/connect
+const (
+	maxBackfillDays     = 3650
+	minPollIntervalSecs = 10
+	maxPollIntervalSecs = 3600
+)
+
+// connectRequest is the body of POST /mail/connect
+type connectRequest struct {
+	Provider            string   `json:"provider" binding:"required"`
+	InboxID             string   `json:"inbox_id"`              // default "primary"
+	IncludeSpam         bool     `json:"include_spam"`          // also sync spam/junk folders
+	BackfillDays        int      `json:"backfill_days"`         // initial backfill window; 0 backfills all mail
+	Folders             []string `json:"folders"`               // canonical folders to sync; empty for the defaults
+	PollIntervalSeconds int      `json:"poll_interval_seconds"` // 0 uses the default
+	Access              []string `json:"access"`                // metadata, body, send; checked against the granted scopes
+}
+
+// parseInboxID returns the inbox id of a request, defaulting to "primary"
+func parseInboxID(inboxID string) (string, error) {
+	if inboxID == "" {
+		return defaultInboxID, nil
+	}
+	if !inboxIDPattern.MatchString(inboxID) {
+		return "", invalidParam("inbox_id", "inbox_id must be 1-64 letters, digits or . _ @ -")
+	}
+	return inboxID, nil
+}
+
+// options validates the request's sync options
+func (r connectRequest) options() (sync.ProviderOptions, error) {
+	opts := sync.ProviderOptions{IncludeSpam: r.IncludeSpam}
+
+	if r.BackfillDays < 0 || r.BackfillDays > maxBackfillDays {
+		return opts, invalidParam("backfill_days", "backfill_days must be 0 (all mail) to 3650")
+	}
+	opts.BackfillWindow = time.Duration(r.BackfillDays) * 24 * time.Hour
+
+	seen := map[sync.Folder]bool{}
+	for _, name := range r.Folders {
+		f := sync.Folder(name)
+		switch f {
+		case sync.FolderInbox, sync.FolderSent, sync.FolderArchive, sync.FolderSpam, sync.FolderTrash, sync.FolderCustom:
+		default:
+			return opts, invalidParam("folders", "folders must be inbox, sent, archive, spam, trash or custom")
+		}
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		opts.Folders = append(opts.Folders, f)
+	}
+	// Selecting the spam folder is the same as include_spam
+	if seen[sync.FolderSpam] {
+		opts.IncludeSpam = true
+	}
+
+	if r.PollIntervalSeconds != 0 && (r.PollIntervalSeconds < minPollIntervalSecs || r.PollIntervalSeconds > maxPollIntervalSecs) {
+		return opts, invalidParam("poll_interval_seconds", "poll_interval_seconds must be 0 (default) or 10 to 3600")
+	}
+	opts.PollInterval = time.Duration(r.PollIntervalSeconds) * time.Second
+	return opts, nil
+}
+
+// access validates the access the request asks for besides syncing
+func (r connectRequest) access() ([]sync.Access, error) {
+	var access []sync.Access
+	for _, name := range r.Access {
+		a, ok := sync.ParseAccess(name)
+		if !ok {
+			return nil, invalidParam("access", "access must be metadata, body or send")
+		}
+		access = append(access, a)
+	}
+	return access, nil
+}
+
+// scopeError adds the access and the scopes that would grant it to a
+// missing scope error
+func scopeError(err error) error {
+	var scopeErr *sync.ScopeError
+	if !errors.As(err, &scopeErr) {
+		return err
+	}
+	return toAPIError(err).withDetail("access", scopeErr.Access).withDetail("any_of", scopeErr.AnyOf).withDetail("granted", scopeErr.Granted)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// Sync statuses of a connection besides the stored ones (SYNCING, HOOKED,
+// ERROR)
+const (
+	connectionPending    = "PENDING"     // a sync is set up but hasn't run yet
+	connectionNotSyncing = "NOT_SYNCING" // no sync is set up
+)
+
+// connection is one provider account of GET /me/connections: its link in
+// BetterAuth, its sync config and its sync state, any of which may be missing
+type connection struct {
+	Provider     string `json:"provider"` // API name, e.g. google
+	Email        string `json:"email,omitempty"`
+	Linked       *bool  `json:"linked,omitempty"` // BetterAuth has the account; unset if it couldn't be asked
+	Syncable     bool   `json:"syncable"`         // a mail provider, as opposed to e.g. a task system
+	ConnectedAt  int64  `json:"connected_at,omitempty"`
+	InboxID      string `json:"inbox_id,omitempty"`
+	SyncStatus   string `json:"sync_status"`
+	LastSyncedAt int64  `json:"last_synced_at,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+	ErrorCode    string `json:"error_code,omitempty"`
+	Liveness     string `json:"liveness,omitempty"`
+	WithinSLO    *bool  `json:"within_slo,omitempty"`
+}
+
+// apiProviderName is the name the API uses for a mail provider, e.g. google
+func apiProviderName(info sync.ProviderInfo) string {
+	if len(info.Aliases) > 0 {
+		return info.Aliases[0]
+	}
+	return strings.ToLower(string(info.Name))
+}
+
+// registerConnectionRoutes lets frontends show the user's accounts from one
+// response instead of asking BetterAuth and the sync endpoints separately
+func registerConnectionRoutes(authorized *gin.RouterGroup, authClient *auth.BetterAuthClient, configs *syncconfig.Store) {
+	// Linked accounts with their sync config and sync state. BetterAuth being
+	// unreachable doesn't fail the request: links_error says why linked is
+	// missing.
+	authorized.GET("/me/connections", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+		ctx := c.Request.Context()
+
+		byName := make(map[string]*connection)
+		get := func(name string, syncable bool) *connection {
+			conn, ok := byName[name]
+			if !ok {
+				conn = &connection{Provider: name, SyncStatus: connectionNotSyncing}
+				byName[name] = conn
+			}
+			conn.Syncable = conn.Syncable || syncable
+			return conn
+		}
+		mailNames := make(map[sync.ProviderName]string) // API names
+		authNames := make(map[auth.Provider]string)
+		for _, info := range sync.Providers() {
+			mailNames[info.Name] = apiProviderName(info)
+			if info.AuthProvider != "" {
+				authNames[info.AuthProvider] = apiProviderName(info)
+			}
+		}
+
+		// Links, which need the user's own JWT (none when impersonating)
+		linksError := ""
+		if jwt := bearerToken(c); jwt == "" {
+			linksError = "no user token to ask BetterAuth with"
+		} else if accounts, err := authClient.ListAccounts(ctx, jwt); err != nil {
+			linksError = err.Error()
+		} else {
+			for _, name := range authNames {
+				linked := false
+				get(name, true).Linked = &linked
+			}
+			for _, a := range accounts {
+				name, syncable := authNames[a.Provider]
+				if !syncable {
+					name = string(a.Provider)
+				}
+				conn := get(name, syncable)
+				linked := true
+				conn.Linked, conn.Email = &linked, a.Email
+				if !a.ConnectedAt.IsZero() {
+					conn.ConnectedAt = a.ConnectedAt.Unix()
+				}
+			}
+		}
+
+		// Syncs set up with POST /mail/connect
+		cfgs, err := configs.ListUser(ctx, authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		for _, cfg := range cfgs {
+			name, ok := mailNames[sync.ProviderName(cfg.Provider)]
+			if !ok {
+				name = strings.ToLower(cfg.Provider)
+			}
+			conn := get(name, true)
+			conn.InboxID, conn.SyncStatus = cfg.InboxID, connectionPending
+			if conn.ConnectedAt == 0 {
+				conn.ConnectedAt = cfg.CreatedAt.Unix()
+			}
+		}
+
+		// Sync state of configured syncs; a disconnected one's only keeps
+		// its last sync
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+		states, err := reader.SyncStates(ctx)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		now := time.Now()
+		for _, st := range states {
+			name, ok := mailNames[sync.ProviderName(st.Provider)]
+			if !ok {
+				continue
+			}
+			conn := get(name, true)
+			conn.LastSyncedAt = st.LastSyncedAt
+			if conn.SyncStatus == connectionNotSyncing {
+				continue
+			}
+			status := newInboxStatus(authUser.ID, st, now)
+			conn.SyncStatus, conn.LastError, conn.ErrorCode = st.Status, st.LastError, st.ErrorCode
+			conn.Liveness, conn.WithinSLO = status.Liveness, &status.WithinSLO
+		}
+
+		connections := make([]*connection, 0, len(byName))
+		for _, conn := range byName {
+			connections = append(connections, conn)
+		}
+		sort.Slice(connections, func(i, j int) bool { return connections[i].Provider < connections[j].Provider })
+
+		resp := gin.H{"user_id": authUser.ID, "connections": connections}
+		if linksError != "" {
+			resp["links_error"] = linksError
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+}
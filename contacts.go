@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/contactmerge"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/relationship"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// jobContactScores refreshes relationship scores and publishes contact.scored
+const jobContactScores = "contact_scores"
+
+// newRelationshipScorer configures scoring from CONTACT_SCORE_HALF_LIFE
+// (default 720h) and CONTACT_SCORE_WINDOW (default 4320h of mail)
+func newRelationshipScorer(stores eventstore.Opener) (*relationship.Scorer, error) {
+	halfLife, window := relationship.DefaultHalfLife, relationship.DefaultWindow
+	if v := os.Getenv("CONTACT_SCORE_HALF_LIFE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CONTACT_SCORE_HALF_LIFE %q: want a duration like 720h", v)
+		}
+		halfLife = d
+	}
+	if v := os.Getenv("CONTACT_SCORE_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CONTACT_SCORE_WINDOW %q: want a duration like 4320h", v)
+		}
+		window = d
+	}
+	return relationship.New(stores, halfLife, window), nil
+}
+
+// registerContactScoreJob rescores every user with a connected inbox on
+// CONTACT_SCORE_SCHEDULE (default daily)
+func registerContactScoreJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, scorer *relationship.Scorer, configs *syncconfig.Store) error {
+	runner.Register(jobContactScores, jobs.Kind{
+		Timeout: 30 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			users, err := connectedUsers(ctx, configs)
+			if err != nil {
+				return err
+			}
+
+			n, err := scorer.Run(ctx, users)
+			if n > 0 {
+				log.Printf("Contact scores: %d changed", n)
+			}
+			return err
+		},
+	})
+
+	schedule := os.Getenv("CONTACT_SCORE_SCHEDULE")
+	if schedule == "" {
+		schedule = "@daily"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid CONTACT_SCORE_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobContactScores, jobContactScores, schedule, nil)
+	return err
+}
+
+// maxDuplicateScan caps the contacts compared by GET /contacts/duplicates
+const maxDuplicateScan = 10000
+
+// registerContactMergeRoutes finds likely duplicate contacts and merges them
+func registerContactMergeRoutes(authorized *gin.RouterGroup) {
+	// Pairs of contacts that are likely the same person, most likely first
+	authorized.GET("/contacts/duplicates", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		minConfidence := contactmerge.DefaultMinConfidence
+		if v := c.Query("min_confidence"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 1 {
+				respondError(c, invalidParam("min_confidence", "min_confidence must be between 0 and 1"))
+				return
+			}
+			minConfidence = f
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 500"))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		contacts, err := reader.ListContacts(c.Request.Context(), eventstore.ContactQuery{
+			Sort:  eventstore.ContactSortRecent,
+			Limit: maxDuplicateScan,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		duplicates := contactmerge.Duplicates(contacts, minConfidence)
+		if len(duplicates) > limit {
+			duplicates = duplicates[:limit]
+		}
+		c.JSON(http.StatusOK, gin.H{"duplicates": duplicates})
+	})
+
+	// Merge contacts into a primary one; their mail, scores and details
+	// count towards it from then on
+	authorized.POST("/contacts/merge", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Primary    string   `json:"primary" binding:"required"`
+			Duplicates []string `json:"duplicates" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		merge, err := contactmerge.Merge(c.Request.Context(), store, authUser.ID, req.Primary, req.Duplicates)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, merge)
+	})
+
+	// Merge history, newest first, including undone merges
+	authorized.GET("/contacts/merges", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		merges, err := reader.ContactMerges(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"merges": merges})
+	})
+
+	// Split a merge's addresses back into their own contacts
+	authorized.POST("/contacts/merges/:id/undo", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		merge, err := contactmerge.Undo(c.Request.Context(), store, authUser.ID, c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, merge)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/ragcontext"
+)
+
+// eventTypeMemoryFact is the /events type other services store memory facts
+// under
+const eventTypeMemoryFact = "memory.fact"
+
+// memoryFacts returns the user's memory facts, newest first. A fact's data is
+// its text, or a JSON object with a "text" field.
+func memoryFacts(ctx context.Context, reader eventstore.Reader) ([]ragcontext.Fact, error) {
+	events, err := reader.GetEvents(ctx, eventTypeMemoryFact)
+	if err != nil {
+		return nil, err
+	}
+	facts := make([]ragcontext.Fact, 0, len(events))
+	for _, ev := range events {
+		text := ev.Data
+		var obj struct {
+			Text string `json:"text"`
+		}
+		if json.Unmarshal([]byte(ev.Data), &obj) == nil && obj.Text != "" {
+			text = obj.Text
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		facts = append(facts, ragcontext.Fact{
+			ID:        strconv.FormatInt(ev.ID, 10),
+			Text:      text,
+			CreatedAt: ev.CreatedAt.Unix(),
+		})
+	}
+	return facts, nil
+}
+
+// registerContextRoutes serves context blocks for other services' model
+// calls. Without an embedding model, items are ranked by shared words.
+func registerContextRoutes(authorized *gin.RouterGroup, builder *ragcontext.Builder) {
+	authorized.POST("/context", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Topic     string   `json:"topic"`
+			Prompt    string   `json:"prompt"` // alias of topic
+			MaxTokens int      `json:"max_tokens"`
+			Include   []string `json:"include"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		if req.Topic == "" {
+			req.Topic = req.Prompt
+		}
+		if req.MaxTokens < 0 || req.MaxTokens > ragcontext.MaxTokens {
+			respondError(c, invalidParam("max_tokens", fmt.Sprintf("max_tokens must be between 1 and %d", ragcontext.MaxTokens)))
+			return
+		}
+		for _, kind := range req.Include {
+			switch kind {
+			case ragcontext.KindEmail, ragcontext.KindFact, ragcontext.KindCalendar:
+			default:
+				respondError(c, invalidParam("include", "include may list email, fact and calendar"))
+				return
+			}
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		facts, err := memoryFacts(c.Request.Context(), reader)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		out, err := builder.Build(c.Request.Context(), reader, facts, ragcontext.Request{
+			Topic:     req.Topic,
+			MaxTokens: req.MaxTokens,
+			Include:   req.Include,
+		})
+		if err != nil {
+			respondError(c, llmError(err))
+			return
+		}
+		c.JSON(http.StatusOK, out)
+	})
+}
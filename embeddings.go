@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/semantic"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// Embedding backfill jobs: the scan queues a backfill for every user with
+// mail the current model hasn't embedded; each backfill works for a slice
+// and queues its own continuation until it catches up
+const (
+	jobEmbeddingScan     = "embedding_backfill_scan"
+	jobEmbeddingBackfill = "embedding_backfill"
+)
+
+// newEmbeddingBackfiller configures the backfill from EMBEDDING_BACKFILL_BATCH
+// (default 50 messages per model call) and EMBEDDING_BACKFILL_INTERVAL
+// (default 2s between calls)
+func newEmbeddingBackfiller(stores eventstore.Opener, client llm.Client) (*semantic.Backfiller, error) {
+	batch, interval := semantic.DefaultBackfillBatch, semantic.DefaultBackfillInterval
+	if v := os.Getenv("EMBEDDING_BACKFILL_BATCH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			return nil, fmt.Errorf("invalid EMBEDDING_BACKFILL_BATCH %q: want 1-500", v)
+		}
+		batch = n
+	}
+	if v := os.Getenv("EMBEDDING_BACKFILL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid EMBEDDING_BACKFILL_INTERVAL %q: want a duration like 2s", v)
+		}
+		interval = d
+	}
+	return semantic.NewBackfiller(stores, client, batch, interval), nil
+}
+
+// registerEmbeddingBackfillJobs scans every user with a connected inbox on
+// EMBEDDING_BACKFILL_SCHEDULE (default hourly)
+func registerEmbeddingBackfillJobs(ctx context.Context, runner *jobs.Runner, store *jobs.Store, backfiller *semantic.Backfiller, configs *syncconfig.Store) error {
+	runner.Register(jobEmbeddingBackfill, jobs.Kind{
+		Timeout: backfiller.Slice() + time.Minute,
+		Handler: func(ctx context.Context, job jobs.Job) error {
+			done, err := backfiller.Run(ctx, job.UserID)
+			if err != nil || done {
+				return err
+			}
+			_, err = store.Enqueue(ctx, job.UserID, jobEmbeddingBackfill, nil, time.Now().Add(backfiller.Interval()))
+			return err
+		},
+	})
+
+	runner.Register(jobEmbeddingScan, jobs.Kind{
+		Timeout: 10 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			users, err := connectedUsers(ctx, configs)
+			if err != nil {
+				return err
+			}
+
+			queued := 0
+			for _, userID := range users {
+				start, err := backfiller.Start(ctx, userID)
+				if err != nil {
+					log.Printf("Embedding backfill for %s: %v", userID, err)
+					continue
+				}
+				if !start {
+					continue
+				}
+				if _, err := store.Enqueue(ctx, userID, jobEmbeddingBackfill, nil, time.Now()); err != nil {
+					return err
+				}
+				queued++
+			}
+			if queued > 0 {
+				log.Printf("Embedding backfill: queued %d users", queued)
+			}
+			return nil
+		},
+	})
+
+	schedule := os.Getenv("EMBEDDING_BACKFILL_SCHEDULE")
+	if schedule == "" {
+		schedule = "@hourly"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid EMBEDDING_BACKFILL_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobEmbeddingScan, jobEmbeddingScan, schedule, nil)
+	return err
+}
+
+// registerEmbeddingRoutes reports how far the user's existing mail has been
+// embedded. backfiller is nil when embeddings are off.
+func registerEmbeddingRoutes(authorized *gin.RouterGroup, backfiller *semantic.Backfiller) {
+	authorized.GET("/mail/embeddings", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		if backfiller == nil {
+			respondError(c, errEmbeddingsDisabled)
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		progress, err := backfiller.Progress(c.Request.Context(), reader)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"backfill": progress})
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
+)
+
+// Default event write throttle per user
+const (
+	defaultEventWritesPerMinute = 600
+	defaultEventWriteBurst      = 100
+)
+
+// newEventWriteLimiter throttles generic event writes per user from
+// EVENTS_WRITE_RATE (events per minute, default 600, 0 turns it off) and
+// EVENTS_WRITE_BURST (default 100)
+func newEventWriteLimiter() (*ratelimit.Keyed, error) {
+	perMinute, burst := defaultEventWritesPerMinute, defaultEventWriteBurst
+	if v := os.Getenv("EVENTS_WRITE_RATE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid EVENTS_WRITE_RATE %q: want events per minute, 0 to disable", v)
+		}
+		perMinute = n
+	}
+	if v := os.Getenv("EVENTS_WRITE_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid EVENTS_WRITE_BURST %q: want a positive number", v)
+		}
+		burst = n
+	}
+	return ratelimit.NewKeyed(float64(perMinute)/60, burst), nil
+}
+
+// eventWriteLimit rejects event writes over the target user's rate with 429
+// and a Retry-After header. The user is the JWT subject, or the user_id path
+// parameter on internal routes.
+func eventWriteLimit(limiter *ratelimit.Keyed) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("user_id")
+		if user, ok := c.Get("user"); ok && userID == "" {
+			userID = user.(*auth.User).ID
+		}
+
+		if ok, wait := limiter.Allow(userID); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			respondError(c, errEventRateLimited.withDetail("retry_after_seconds", retryAfter))
+			return
+		}
+		c.Next()
+	}
+}
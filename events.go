@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// eventTypePattern is what an event type may look like: dot-separated
+// tokens, so it can be appended to the user's NATS subject as is
+var eventTypePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// maxEventTypeLength bounds event types (and with them NATS subjects)
+const maxEventTypeLength = 128
+
+// Sources of API-ingested events, set in their bus payload
+const (
+	eventSourceAPI     = "api"     // POST /events
+	eventSourceService = "service" // POST /internal/users/:user_id/events
+)
+
+// customEvent is the bus payload of an API-ingested event
+type customEvent struct {
+	EventID int64  `json:"event_id"`
+	UserID  string `json:"user_id"`
+	Type    string `json:"type"`
+	Data    string `json:"data"`
+	Source  string `json:"source"`
+	TS      int64  `json:"ts"`
+}
+
+// validateEventType rejects types that aren't valid NATS subject tokens
+func validateEventType(eventType string) error {
+	if len(eventType) > maxEventTypeLength || !eventTypePattern.MatchString(eventType) {
+		return badRequest(fmt.Sprintf("invalid event type %q: want dot-separated letters, digits, '_' and '-', at most %d characters", eventType, maxEventTypeLength))
+	}
+	return nil
+}
+
+// storeUserEvent stores an event and queues it for user.{id}.{type} in the
+// same transaction, so it reaches the bus through the outbox like synced
+// mail, then nudges publishing for users without a sync running here
+func storeUserEvent(ctx context.Context, userID string, req EventRequest, source string) (*eventstore.Event, error) {
+	if err := validateEventType(req.Type); err != nil {
+		return nil, err
+	}
+
+	store, err := openEventStore(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	var event *eventstore.Event
+	err = store.WithTx(ctx, func(tx eventstore.Tx) error {
+		var err error
+		if event, err = tx.AppendEvent(ctx, req.Type, req.Data); err != nil {
+			return err
+		}
+		payload, err := json.Marshal(customEvent{
+			EventID: event.ID,
+			UserID:  userID,
+			Type:    event.Type,
+			Data:    event.Data,
+			Source:  source,
+			TS:      event.CreatedAt.Unix(),
+		})
+		if err != nil {
+			return fmt.Errorf("encode event: %w", err)
+		}
+		return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+			Subject:     fmt.Sprintf("user.%s.%s", userID, event.Type),
+			EventType:   event.Type,
+			Payload:     payload,
+			MsgID:       fmt.Sprintf("event|%s|%d", userID, event.ID),
+			TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	syncManager.DispatchOutbox(userID)
+	return event, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// maxSenderRules bounds the rules a user can have, since every received
+// message is checked against them
+const maxSenderRules = 1000
+
+// registerSenderRuleRoutes manages the rules deciding which received mail is
+// synced
+func registerSenderRuleRoutes(authorized *gin.RouterGroup) {
+	// The user's sender rules, oldest first
+	authorized.GET("/mail/filters", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		rules, err := reader.ListSenderRules(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rules": rules})
+	})
+
+	// Block a sender, domain or header match, or allow one despite a block
+	authorized.POST("/mail/filters", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Action string `json:"action" binding:"required"` // block or allow
+			Kind   string `json:"kind" binding:"required"`   // sender, domain or header
+			Header string `json:"header"`
+			Value  string `json:"value"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		rule := eventstore.SenderRule{
+			ID:     uuid.NewString(),
+			Action: req.Action,
+			Kind:   req.Kind,
+			Header: req.Header,
+			Value:  req.Value,
+		}
+		if err := sync.NormalizeSenderRule(&rule); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		ctx := c.Request.Context()
+		rules, err := store.ListSenderRules(ctx)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if len(rules) >= maxSenderRules {
+			respondError(c, badRequest("too many sender rules, delete some first"))
+			return
+		}
+		if err := store.AddSenderRule(ctx, &rule); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, rule)
+	})
+
+	// Remove a rule; mail it blocked while it existed is not synced again
+	authorized.DELETE("/mail/filters/:id", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		deleted, err := store.DeleteSenderRule(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !deleted {
+			respondError(c, notFound("sender rule not found"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("id")})
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/followup"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// jobFollowUps publishes followup.due for threads that went unanswered
+const jobFollowUps = "followups"
+
+// newFollowUpTracker configures follow-ups from FOLLOWUP_AFTER (default 72h
+// without a reply) and FOLLOWUP_WINDOW (default 720h of sent mail)
+func newFollowUpTracker(stores eventstore.Opener) (*followup.Tracker, error) {
+	after, window := followup.DefaultAfter, followup.DefaultWindow
+	if v := os.Getenv("FOLLOWUP_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid FOLLOWUP_AFTER %q: want a duration like 72h", v)
+		}
+		after = d
+	}
+	if v := os.Getenv("FOLLOWUP_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= after {
+			return nil, fmt.Errorf("invalid FOLLOWUP_WINDOW %q: want a duration longer than FOLLOWUP_AFTER", v)
+		}
+		window = d
+	}
+	return followup.New(stores, after, window), nil
+}
+
+// registerFollowUpJob checks every user with a connected inbox on
+// FOLLOWUP_SCHEDULE (default hourly)
+func registerFollowUpJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, tracker *followup.Tracker, configs *syncconfig.Store) error {
+	runner.Register(jobFollowUps, jobs.Kind{
+		Timeout: 30 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			users, err := connectedUsers(ctx, configs)
+			if err != nil {
+				return err
+			}
+
+			n, err := tracker.Notify(ctx, users)
+			if n > 0 {
+				log.Printf("Follow-ups: %d due", n)
+			}
+			return err
+		},
+	})
+
+	schedule := os.Getenv("FOLLOWUP_SCHEDULE")
+	if schedule == "" {
+		schedule = "@hourly"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid FOLLOWUP_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobFollowUps, jobFollowUps, schedule, nil)
+	return err
+}
+
+// registerFollowUpRoutes lets users list, snooze and dismiss follow-ups
+func registerFollowUpRoutes(authorized *gin.RouterGroup, tracker *followup.Tracker) {
+	// Threads awaiting a reply to the user's last message, oldest due first
+	authorized.GET("/followups", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		status := c.DefaultQuery("status", eventstore.FollowUpDue)
+		switch status {
+		case eventstore.FollowUpDue, eventstore.FollowUpWaiting, eventstore.FollowUpSnoozed:
+		case "all":
+			status = ""
+		default:
+			respondError(c, invalidParam("status", "status must be due, waiting, snoozed or all"))
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 500 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 500"))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		q := tracker.Query(time.Now(), status)
+		q.Limit = limit
+		followUps, err := reader.FollowUps(c.Request.Context(), q)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"followups": followUps})
+	})
+
+	// Hide a follow-up until `until`; followup.due is published again then
+	authorized.POST("/followups/:thread_id/snooze", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Provider string    `json:"provider" binding:"required"`
+			Until    time.Time `json:"until" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		if !req.Until.After(time.Now()) {
+			respondError(c, invalidParam("until", "until must be in the future"))
+			return
+		}
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		ctx := c.Request.Context()
+		f, err := tracker.Find(ctx, store, string(provider), c.Param("thread_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if f == nil {
+			respondError(c, notFound("thread is not awaiting a reply"))
+			return
+		}
+		if err := store.SnoozeFollowUp(ctx, f.Provider, f.ProviderThreadID, f.ProviderMessageID, req.Until.Unix()); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		if f, err = tracker.Find(ctx, store, string(provider), c.Param("thread_id")); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, f)
+	})
+
+	// Stop following up on a thread until the user writes to it again
+	authorized.POST("/followups/:thread_id/dismiss", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Provider string `json:"provider" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		ctx := c.Request.Context()
+		f, err := tracker.Find(ctx, store, string(provider), c.Param("thread_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if f == nil {
+			respondError(c, notFound("thread is not awaiting a reply"))
+			return
+		}
+		if err := store.DismissFollowUp(ctx, f.Provider, f.ProviderThreadID, f.ProviderMessageID); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"dismissed": f.ProviderThreadID, "provider": f.Provider})
+	})
+}
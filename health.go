@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/chaos"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// healthCheckTimeout bounds each dependency check so /health stays fast when a
+// dependency hangs
+const healthCheckTimeout = 2 * time.Second
+
+// dependencyStatus is the result of one dependency check
+type dependencyStatus struct {
+	OK        bool        `json:"ok"`
+	LatencyMS float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// healthChecker probes the API's dependencies for GET /health
+type healthChecker struct {
+	mode       runMode
+	publisher  *natsjs.Publisher
+	authClient *auth.BetterAuthClient
+	usersRoot  string        // per-user database directory
+	sample     atomic.Uint64 // rotates the sampled user database
+}
+
+// check runs fn with a timeout and records its latency
+func check(ctx context.Context, fn func(ctx context.Context) (interface{}, error)) dependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := fn(ctx)
+	st := dependencyStatus{
+		OK:        err == nil,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   details,
+	}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	return st
+}
+
+// checkNATS reports the connection state and measures a server round trip
+func (h *healthChecker) checkNATS(ctx context.Context) (interface{}, error) {
+	status := h.publisher.Status()
+	if _, err := h.publisher.Ping(ctx); err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+// checkJWKS reports whether signing keys are loaded (false while a degraded
+// start is still waiting for them, or once they outlived JWKS_MAX_STALENESS)
+func (h *healthChecker) checkJWKS(ctx context.Context) (interface{}, error) {
+	return nil, jwtVerifier.KeysError()
+}
+
+// checkBetterAuth calls the auth server's health endpoint and reports whether
+// token calls are cut off after repeated failures
+func (h *healthChecker) checkBetterAuth(ctx context.Context) (interface{}, error) {
+	return gin.H{"circuit": h.authClient.CircuitState()}, h.authClient.Ping(ctx)
+}
+
+// checkUserDB opens one user's database read-only and runs a query. Per-user
+// deployments sample a different user on each call.
+func (h *healthChecker) checkUserDB(ctx context.Context) (interface{}, error) {
+	userID := "_health"
+	if !eventStores.Shared() {
+		entries, err := os.ReadDir(h.usersRoot)
+		if err != nil {
+			return nil, err
+		}
+		var users []string
+		for _, e := range entries {
+			if _, err := os.Stat(filepath.Join(h.usersRoot, e.Name(), "events.db")); e.IsDir() && err == nil {
+				users = append(users, e.Name())
+			}
+		}
+		if len(users) == 0 {
+			return gin.H{"sampled": false}, nil
+		}
+		userID = users[h.sample.Add(1)%uint64(len(users))]
+	}
+
+	store, err := openEventReader(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	if _, err := store.SyncStates(ctx); err != nil {
+		return nil, err
+	}
+	return gin.H{"sampled": true, "shared": eventStores.Shared()}, nil
+}
+
+// handle serves GET /health. Dependencies are checked concurrently; the
+// response is 200 with status "degraded" when any of them fails, so
+// orchestrators don't restart the API for an outage it can ride out.
+func (h *healthChecker) handle(c *gin.Context) {
+	checks := map[string]func(context.Context) (interface{}, error){
+		"nats":       h.checkNATS,
+		"betterauth": h.checkBetterAuth,
+		"user_db":    h.checkUserDB,
+	}
+	if h.mode.servesAPI() {
+		checks["jwks"] = h.checkJWKS
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		deps = make(map[string]dependencyStatus, len(checks))
+	)
+	for name, fn := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st := check(c.Request.Context(), fn)
+			mu.Lock()
+			deps[name] = st
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := "ok"
+	for _, d := range deps {
+		if !d.OK {
+			status = "degraded"
+		}
+	}
+
+	resp := gin.H{
+		"status":       status,
+		"service":      "ai-brain-api",
+		"mode":         h.mode,
+		"dependencies": deps,
+	}
+	if h.mode.servesAPI() {
+		resp["jwks_cache"] = jwtVerifier.GetCacheStats()
+	}
+	if chaos.Enabled() {
+		resp["chaos_mode"] = true
+	}
+	c.JSON(http.StatusOK, resp)
+}
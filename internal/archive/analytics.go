@@ -0,0 +1,184 @@
+package archive
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+)
+
+// analytics adds the archived messages dated since since to the hot tier's
+// aggregates. Segments are read only when the window reaches them; their
+// messages are counted the way the store's SQL counts stored ones, and the
+// backlog is recomputed across both tiers since a reply may sit in either.
+func (t *tiers) analytics(ctx context.Context, since int64, tzOffset, topN int) (*eventstore.Analytics, error) {
+	segs, err := t.hot.ArchiveSegments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var reached []eventstore.ArchiveSegment
+	for _, seg := range segs {
+		if seg.NewestAt >= since && seg.Live > seg.Deleted {
+			reached = append(reached, seg)
+		}
+	}
+	if len(reached) == 0 {
+		return t.hot.Analytics(ctx, since, tzOffset, topN)
+	}
+
+	// Uncapped, so the lists can be merged before they are cut to topN
+	hot, err := t.hot.Analytics(ctx, since, tzOffset, -1)
+	if err != nil {
+		return nil, err
+	}
+	after := &search.Query{Clauses: []search.Clause{{Field: search.FieldAfter, Time: time.Unix(since, 0)}}}
+	var archived []eventstore.StoredMessage
+	for _, seg := range reached {
+		msgs, err := t.segmentSearch(ctx, seg, after, seg.Messages)
+		if err != nil {
+			return nil, err
+		}
+		archived = append(archived, msgs...)
+	}
+
+	days := make(map[string]*eventstore.DayVolume)
+	for i := range hot.VolumePerDay {
+		days[hot.VolumePerDay[i].Date] = &hot.VolumePerDay[i]
+	}
+	senders := make(map[string]*eventstore.SenderCount)
+	for i := range hot.TopSenders {
+		senders[hot.TopSenders[i].Sender] = &hot.TopSenders[i]
+	}
+	hours := make(map[int]*eventstore.HourCount)
+	for i := range hot.BusiestHours {
+		hours[hot.BusiestHours[i].Hour] = &hot.BusiestHours[i]
+	}
+
+	for _, m := range archived {
+		local := time.Unix(m.MsgDate+int64(tzOffset), 0).UTC()
+		date := local.Format("2006-01-02")
+		d, ok := days[date]
+		if !ok {
+			d = &eventstore.DayVolume{Date: date}
+			days[date] = d
+		}
+		if m.Folder == "sent" {
+			d.Sent++
+		} else {
+			d.Received++
+		}
+
+		// NULL folders aren't "not sent" in the SQL either
+		if m.Folder == "" || m.Folder == "sent" {
+			continue
+		}
+		if m.Sender != "" {
+			sc, ok := senders[m.Sender]
+			if !ok {
+				sc = &eventstore.SenderCount{Sender: m.Sender}
+				senders[m.Sender] = sc
+			}
+			sc.Count++
+			if !m.IsRead {
+				sc.Unread++
+			}
+		}
+		h, ok := hours[local.Hour()]
+		if !ok {
+			h = &eventstore.HourCount{Hour: local.Hour()}
+			hours[local.Hour()] = h
+		}
+		h.Count++
+	}
+
+	a := &eventstore.Analytics{Since: since}
+	for _, d := range days {
+		a.VolumePerDay = append(a.VolumePerDay, *d)
+	}
+	sort.Slice(a.VolumePerDay, func(i, j int) bool { return a.VolumePerDay[i].Date < a.VolumePerDay[j].Date })
+	for _, sc := range senders {
+		a.TopSenders = append(a.TopSenders, *sc)
+	}
+	sort.Slice(a.TopSenders, func(i, j int) bool {
+		if a.TopSenders[i].Count != a.TopSenders[j].Count {
+			return a.TopSenders[i].Count > a.TopSenders[j].Count
+		}
+		return a.TopSenders[i].Sender < a.TopSenders[j].Sender
+	})
+	if topN >= 0 && len(a.TopSenders) > topN {
+		a.TopSenders = a.TopSenders[:topN]
+	}
+	for _, h := range hours {
+		a.BusiestHours = append(a.BusiestHours, *h)
+	}
+	sort.Slice(a.BusiestHours, func(i, j int) bool {
+		if a.BusiestHours[i].Count != a.BusiestHours[j].Count {
+			return a.BusiestHours[i].Count > a.BusiestHours[j].Count
+		}
+		return a.BusiestHours[i].Hour < a.BusiestHours[j].Hour
+	})
+
+	a.ResponseBacklog, err = t.backlog(ctx, since, hot.ResponseBacklog.Oldest, archived, topN)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// backlog recomputes the response backlog from the hot tier's items and the
+// archived messages: inbox mail from people with no later sent message in
+// the same thread in either tier
+func (t *tiers) backlog(ctx context.Context, since int64, hot []eventstore.BacklogItem, archived []eventstore.StoredMessage, topN int) (eventstore.Backlog, error) {
+	sent, err := t.hot.SearchMessages(ctx, &search.Query{Clauses: []search.Clause{
+		{Field: search.FieldIn, Value: "sent"},
+		{Field: search.FieldAfter, Time: time.Unix(since, 0)},
+	}}, math.MaxInt32)
+	if err != nil {
+		return eventstore.Backlog{}, err
+	}
+	// Latest sent message date by provider|thread
+	replied := make(map[string]int64)
+	for _, msgs := range [][]eventstore.StoredMessage{sent, archived} {
+		for _, m := range msgs {
+			key := m.Provider + "|" + m.ProviderThreadID
+			if m.Folder == "sent" && m.ProviderThreadID != "" && m.MsgDate > replied[key] {
+				replied[key] = m.MsgDate
+			}
+		}
+	}
+
+	items := hot
+	for _, m := range archived {
+		if m.Folder != "inbox" || m.IsList || (m.Kind != "" && m.Kind != "message") {
+			continue
+		}
+		items = append(items, eventstore.BacklogItem{
+			Provider:          m.Provider,
+			ProviderMessageID: m.ProviderMessageID,
+			ProviderThreadID:  m.ProviderThreadID,
+			Subject:           m.Subject,
+			Sender:            m.Sender,
+			MsgDate:           m.MsgDate,
+		})
+	}
+
+	var b eventstore.Backlog
+	for _, item := range items {
+		if item.ProviderThreadID != "" && replied[item.Provider+"|"+item.ProviderThreadID] > item.MsgDate {
+			continue
+		}
+		b.Oldest = append(b.Oldest, item)
+	}
+	sort.SliceStable(b.Oldest, func(i, j int) bool { return b.Oldest[i].MsgDate < b.Oldest[j].MsgDate })
+	b.Count = int64(len(b.Oldest))
+	if len(b.Oldest) > 0 {
+		b.OldestAt = b.Oldest[0].MsgDate
+	}
+	if topN >= 0 && len(b.Oldest) > topN {
+		b.Oldest = b.Oldest[:topN]
+	}
+	return b, nil
+}
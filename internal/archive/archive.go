@@ -0,0 +1,265 @@
+// Package archive tiers the per-user event stores: messages older than the
+// hot window move out of SQLite into gzipped segment databases in object
+// storage, and message reads (search, threads, as-of views, analytics) merge
+// them back in.
+//
+// A segment holds up to segmentMessages of one provider's messages with the
+// same schema as a user's database, so it is read with the same SQL. The
+// user's archive_segments table lists the live segments and archived_messages
+// indexes their messages: a segment is uploaded first and only then recorded
+// (moving its messages from the hot store to the index) in one transaction,
+// so a crash in between leaves an unreferenced blob that the next run
+// deletes, never a gap.
+//
+// A segment's copy of a message is served only while the index points at
+// that segment. Deletes at the provider tombstone the index entry; retention
+// and inbox purges remove entries, and the next run rewrites the segments
+// that lost messages without them.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// prefix is the root of all segment keys
+const prefix = "archive/"
+
+// segmentMessages is the most messages one segment holds
+const segmentMessages = 50000
+
+// orphanAge is how old an unreferenced segment must be before it is deleted,
+// so uploads that are about to be committed aren't
+const orphanAge = time.Hour
+
+// Archiver moves old messages to segments and serves them back to searches
+type Archiver struct {
+	stores eventstore.Opener
+	root   string // per-user databases: {root}/{user_id}/events.db
+	blobs  blob.Store
+	hotFor time.Duration
+	cache  *cache
+}
+
+// New creates an archiver that keeps hotFor of mail (by message date) in the
+// databases under root and caches up to cacheSize bytes of downloaded
+// segments in cacheDir
+func New(stores eventstore.Opener, root string, blobs blob.Store, hotFor time.Duration, cacheDir string, cacheSize int64) *Archiver {
+	return &Archiver{
+		stores: stores,
+		root:   root,
+		blobs:  blobs,
+		hotFor: hotFor,
+		cache:  &cache{dir: cacheDir, max: cacheSize},
+	}
+}
+
+// Run archives every user's messages older than the hot window and returns
+// how many it moved. A failed user doesn't stop the others.
+func (a *Archiver) Run(ctx context.Context) (int, error) {
+	entries, err := os.ReadDir(a.root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list user databases: %w", err)
+	}
+
+	before := time.Now().Add(-a.hotFor).Unix()
+	moved := 0
+	var errs []error
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if !e.IsDir() {
+			continue
+		}
+		n, err := a.archiveUser(ctx, e.Name(), before)
+		moved += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", e.Name(), err))
+		}
+	}
+	return moved, errors.Join(errs...)
+}
+
+// archiveUser moves a user's messages dated before before into segments,
+// rewrites segments whose messages left the index, then deletes segments no
+// longer referenced
+func (a *Archiver) archiveUser(ctx context.Context, userID string, before int64) (int, error) {
+	store, err := a.stores.Open(userID)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	states, err := store.SyncStates(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, st := range states {
+		for {
+			n, err := a.archiveBatch(ctx, store, st.Provider, before)
+			moved += n
+			if err != nil {
+				return moved, err
+			}
+			if n < segmentMessages {
+				break
+			}
+		}
+	}
+
+	if err := a.compact(ctx, store); err != nil {
+		return moved, err
+	}
+	return moved, a.sweep(ctx, store)
+}
+
+// compact rewrites each segment holding messages the index no longer serves
+// (expired, purged or archived again) with only the ones it does, and
+// forgets segments left with none. The old blobs go in the sweep.
+func (a *Archiver) compact(ctx context.Context, store eventstore.Store) error {
+	segs, err := store.ArchiveSegments(ctx)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		if seg.Live == seg.Messages {
+			continue
+		}
+		if seg.Live == 0 {
+			if err := store.ReplaceArchive(ctx, seg.Key, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := a.compactSegment(ctx, store, seg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactSegment writes, uploads and records the rewrite of one segment
+func (a *Archiver) compactSegment(ctx context.Context, store eventstore.Store, seg eventstore.ArchiveSegment) error {
+	src, err := a.cache.fetch(ctx, a.blobs, seg.Key)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "archive-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "segment.db")
+
+	compacted, err := store.CompactArchive(ctx, seg, src, path)
+	if err != nil {
+		return err
+	}
+	if compacted == nil {
+		return store.ReplaceArchive(ctx, seg.Key, nil)
+	}
+
+	compacted.Key = segmentKey(store.UserID(), seg.Provider, time.Now())
+	if err := blob.PutFileGzip(ctx, a.blobs, compacted.Key, path); err != nil {
+		return fmt.Errorf("failed to upload segment: %w", err)
+	}
+	return store.ReplaceArchive(ctx, seg.Key, compacted)
+}
+
+// archiveBatch exports, uploads and commits one segment
+func (a *Archiver) archiveBatch(ctx context.Context, store eventstore.Store, provider string, before int64) (int, error) {
+	dir, err := os.MkdirTemp("", "archive-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "segment.db")
+
+	seg, err := store.ExportArchive(ctx, provider, before, segmentMessages, path)
+	if err != nil || seg == nil {
+		return 0, err
+	}
+
+	seg.Key = segmentKey(store.UserID(), provider, time.Now())
+	if err := blob.PutFileGzip(ctx, a.blobs, seg.Key, path); err != nil {
+		return 0, fmt.Errorf("failed to upload segment: %w", err)
+	}
+	if err := store.CommitArchive(ctx, *seg, path); err != nil {
+		return 0, err
+	}
+	return seg.Messages, nil
+}
+
+// sweep deletes the user's segment blobs that aren't in archive_segments:
+// uploads whose commit failed and segments of purged providers
+func (a *Archiver) sweep(ctx context.Context, store eventstore.Store) error {
+	segs, err := store.ArchiveSegments(ctx)
+	if err != nil {
+		return err
+	}
+	live := make(map[string]bool, len(segs))
+	for _, seg := range segs {
+		live[seg.Key] = true
+	}
+
+	var orphans []string
+	err = a.blobs.List(ctx, prefix+store.UserID()+"/", func(obj blob.Object) error {
+		if !live[obj.Key] && time.Since(obj.ModTime) > orphanAge {
+			orphans = append(orphans, obj.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	for _, key := range orphans {
+		if err := a.blobs.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete segment %s: %w", key, err)
+		}
+		a.cache.remove(key)
+	}
+	return nil
+}
+
+// RemoveUser deletes all of an offboarded user's segments and returns how
+// many it deleted. Run only archives users with a database, so nothing else
+// would.
+func (a *Archiver) RemoveUser(ctx context.Context, userID string) (int, error) {
+	var keys []string
+	err := a.blobs.List(ctx, prefix+userID+"/", func(obj blob.Object) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	for i, key := range keys {
+		if err := a.blobs.Delete(ctx, key); err != nil {
+			return i, fmt.Errorf("failed to delete segment %s: %w", key, err)
+		}
+		a.cache.remove(key)
+	}
+	return len(keys), nil
+}
+
+// segmentKey names a provider's segment archived at t
+func segmentKey(userID, provider string, t time.Time) string {
+	return fmt.Sprintf("%s%s/%s-%d.db.gz", prefix, userID, strings.ToLower(provider), t.UnixNano())
+}
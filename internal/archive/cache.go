@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+)
+
+// evictGrace keeps recently used segments, so a search never loses the file
+// it is reading
+const evictGrace = time.Minute
+
+// cache keeps downloaded segments on local disk, evicting the least recently
+// used once they take more than max bytes
+type cache struct {
+	dir string
+	max int64
+
+	mu sync.Mutex // serializes downloads and eviction
+}
+
+// fetch returns the local path of a segment, downloading it on a miss
+func (c *cache) fetch(ctx context.Context, blobs blob.Store, key string) (string, error) {
+	path := c.path(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return path, nil
+	}
+	if err := blob.GetFileGzip(ctx, blobs, key, path); err != nil {
+		return "", err
+	}
+	c.evict()
+	return path, nil
+}
+
+// remove drops a deleted segment from the cache
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	os.Remove(c.path(key))
+}
+
+// path maps archive/{user_id}/{name}.db.gz to {dir}/{user_id}/{name}.db
+func (c *cache) path(key string) string {
+	rel := strings.TrimSuffix(strings.TrimPrefix(key, prefix), ".gz")
+	return filepath.Join(c.dir, filepath.FromSlash(rel))
+}
+
+// evict deletes the least recently used segments until the cache fits
+func (c *cache) evict() {
+	type entry struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var entries []entry
+	var total int64
+	filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if total <= c.max {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	for _, e := range entries {
+		if total <= c.max || time.Since(e.used) < evictGrace {
+			break
+		}
+		if err := os.Remove(e.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+			total -= e.size
+		}
+	}
+}
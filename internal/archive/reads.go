@@ -0,0 +1,173 @@
+package archive
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// served keeps the messages read from segment key that the index still
+// serves from it, with the deletes recorded since they were archived.
+// Deleted messages are dropped unless withDeleted is set.
+func (t *tiers) served(ctx context.Context, key string, msgs []eventstore.StoredMessage, withDeleted bool) ([]eventstore.StoredMessage, error) {
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ProviderMessageID
+	}
+	entries, err := t.hot.ArchivedMessages(ctx, eventstore.ArchivedQuery{SegmentKey: key, MessageIDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	return keepServed(msgs, key, indexByID(entries), withDeleted), nil
+}
+
+// keepServed filters msgs read from segment key against index entries keyed
+// by provider|message id
+func keepServed(msgs []eventstore.StoredMessage, key string, index map[string]eventstore.ArchivedMessage, withDeleted bool) []eventstore.StoredMessage {
+	kept := msgs[:0]
+	for _, m := range msgs {
+		entry, ok := index[m.Provider+"|"+m.ProviderMessageID]
+		if !ok || entry.SegmentKey != key {
+			continue
+		}
+		if entry.DeletedAt != 0 {
+			if !withDeleted {
+				continue
+			}
+			m.DeletedAt = entry.DeletedAt
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+func indexByID(entries []eventstore.ArchivedMessage) map[string]eventstore.ArchivedMessage {
+	index := make(map[string]eventstore.ArchivedMessage, len(entries))
+	for _, e := range entries {
+		index[e.Provider+"|"+e.ProviderMessageID] = e
+	}
+	return index
+}
+
+// threadMessages adds a thread's archived messages to the stored ones, in
+// date order. Only the segments the index lists for the thread are read.
+func (t *tiers) threadMessages(ctx context.Context, provider, threadID string) ([]eventstore.StoredMessage, error) {
+	msgs, err := t.hot.ThreadMessages(ctx, provider, threadID)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := t.archivedThread(ctx, provider, threadID, func(s eventstore.Segment) ([]eventstore.StoredMessage, error) {
+		return s.ThreadMessages(ctx, provider, threadID)
+	}, false)
+	if err != nil || len(archived) == 0 {
+		return msgs, err
+	}
+
+	msgs = merge(msgs, archived, len(msgs)+len(archived))
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if msgs[i].MsgDate != msgs[j].MsgDate {
+			return msgs[i].MsgDate < msgs[j].MsgDate
+		}
+		return msgs[i].TS < msgs[j].TS
+	})
+	return msgs, nil
+}
+
+// archivedThread reads a thread's messages from each segment the index lists
+// for it with read, keeping the ones it serves
+func (t *tiers) archivedThread(ctx context.Context, provider, threadID string, read func(eventstore.Segment) ([]eventstore.StoredMessage, error), withDeleted bool) ([]eventstore.StoredMessage, error) {
+	entries, err := t.hot.ArchivedMessages(ctx, eventstore.ArchivedQuery{Provider: provider, ThreadID: threadID})
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	index := indexByID(entries)
+	var keys []string
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if !seen[e.SegmentKey] {
+			seen[e.SegmentKey] = true
+			keys = append(keys, e.SegmentKey)
+		}
+	}
+
+	var archived []eventstore.StoredMessage
+	for _, key := range keys {
+		s, err := t.archiver.openSegment(ctx, t.userID, key)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := read(s)
+		s.Close()
+		if err != nil {
+			return nil, err
+		}
+		archived = append(archived, keepServed(msgs, key, index, withDeleted)...)
+	}
+	return archived, nil
+}
+
+// messagesAsOf replays archived messages along with the stored ones. A
+// thread reads the segments the index lists for it. A mailbox reads segments
+// newest first until the results are full of messages newer than anything
+// left, like search.
+func (t *tiers) messagesAsOf(ctx context.Context, q eventstore.AsOfQuery) ([]eventstore.StoredMessage, error) {
+	// Segments are replayed without a folder: the history may have moved
+	// their messages since
+	segQuery := eventstore.AsOfQuery{At: q.At, Provider: q.Provider, ThreadID: q.ThreadID}
+
+	if q.ThreadID != "" {
+		archived, err := t.archivedThread(ctx, q.Provider, q.ThreadID, func(s eventstore.Segment) ([]eventstore.StoredMessage, error) {
+			return s.MessagesAsOf(ctx, segQuery)
+		}, true)
+		if err != nil {
+			return nil, err
+		}
+		q.Archived = append(q.Archived, archived...)
+		return t.hot.MessagesAsOf(ctx, q)
+	}
+
+	msgs, err := t.hot.MessagesAsOf(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	segs, err := t.hot.ArchiveSegments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segs {
+		if q.Provider != "" && seg.Provider != q.Provider {
+			continue
+		}
+		if seg.Live == 0 {
+			continue
+		}
+		if q.Limit > 0 && len(msgs) >= q.Limit && msgs[q.Limit-1].MsgDate > seg.NewestAt {
+			break
+		}
+
+		s, err := t.archiver.openSegment(ctx, t.userID, seg.Key)
+		if err != nil {
+			return nil, err
+		}
+		archived, err := s.MessagesAsOf(ctx, segQuery)
+		s.Close()
+		if err != nil {
+			return nil, err
+		}
+		if archived, err = t.served(ctx, seg.Key, archived, true); err != nil {
+			return nil, err
+		}
+		if len(archived) == 0 {
+			continue
+		}
+		q.Archived = append(q.Archived, archived...)
+		if msgs, err = t.hot.MessagesAsOf(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+)
+
+// Opener returns an opener whose stores and readers read archived messages
+// too: searches, threads, as-of views and analytics merge the segments the
+// index still serves with the hot tier. Writes and every other read are
+// unchanged.
+func (a *Archiver) Opener() eventstore.Opener {
+	return &opener{Opener: a.stores, archiver: a}
+}
+
+type opener struct {
+	eventstore.Opener
+	archiver *Archiver
+}
+
+// Open wraps the user's store so its message reads span both tiers
+func (o *opener) Open(userID string) (eventstore.Store, error) {
+	s, err := o.Opener.Open(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &store{Store: s, tiers: &tiers{hot: s, userID: userID, archiver: o.archiver}}, nil
+}
+
+// OpenReader wraps the user's reader so its message reads span both tiers
+func (o *opener) OpenReader(userID string) (eventstore.Reader, error) {
+	r, err := o.Opener.OpenReader(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{Reader: r, tiers: &tiers{hot: r, userID: userID, archiver: o.archiver}}, nil
+}
+
+type store struct {
+	eventstore.Store
+	tiers *tiers
+}
+
+func (s *store) SearchMessages(ctx context.Context, q *search.Query, limit int) ([]eventstore.StoredMessage, error) {
+	return s.tiers.searchMessages(ctx, q, limit)
+}
+
+func (s *store) ThreadMessages(ctx context.Context, provider, threadID string) ([]eventstore.StoredMessage, error) {
+	return s.tiers.threadMessages(ctx, provider, threadID)
+}
+
+func (s *store) MessagesAsOf(ctx context.Context, q eventstore.AsOfQuery) ([]eventstore.StoredMessage, error) {
+	return s.tiers.messagesAsOf(ctx, q)
+}
+
+func (s *store) Analytics(ctx context.Context, since int64, tzOffset, topN int) (*eventstore.Analytics, error) {
+	return s.tiers.analytics(ctx, since, tzOffset, topN)
+}
+
+type reader struct {
+	eventstore.Reader
+	tiers *tiers
+}
+
+func (r *reader) SearchMessages(ctx context.Context, q *search.Query, limit int) ([]eventstore.StoredMessage, error) {
+	return r.tiers.searchMessages(ctx, q, limit)
+}
+
+func (r *reader) ThreadMessages(ctx context.Context, provider, threadID string) ([]eventstore.StoredMessage, error) {
+	return r.tiers.threadMessages(ctx, provider, threadID)
+}
+
+func (r *reader) MessagesAsOf(ctx context.Context, q eventstore.AsOfQuery) ([]eventstore.StoredMessage, error) {
+	return r.tiers.messagesAsOf(ctx, q)
+}
+
+func (r *reader) Analytics(ctx context.Context, since int64, tzOffset, topN int) (*eventstore.Analytics, error) {
+	return r.tiers.analytics(ctx, since, tzOffset, topN)
+}
+
+// tiers reads a user's messages from the hot store and the segments its
+// index points at
+type tiers struct {
+	hot      eventstore.Query
+	userID   string
+	archiver *Archiver
+}
+
+// searchMessages merges hot results with the segments that could hold newer
+// matches than the ones found so far, newest first. Segments are searched in
+// order of their newest message and skipped once the results are full of
+// messages newer than anything left.
+func (t *tiers) searchMessages(ctx context.Context, q *search.Query, limit int) ([]eventstore.StoredMessage, error) {
+	msgs, err := t.hot.SearchMessages(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	segs, err := t.hot.ArchiveSegments(ctx)
+	if err != nil || len(segs) == 0 {
+		return msgs, err
+	}
+
+	from, to := dateRange(q)
+	for _, seg := range segs {
+		if len(msgs) >= limit && msgs[limit-1].MsgDate > seg.NewestAt {
+			break
+		}
+		if seg.NewestAt < from || (to > 0 && seg.OldestAt >= to) {
+			continue
+		}
+
+		// Room for the copies the index no longer serves from it
+		older, err := t.segmentSearch(ctx, seg, q, limit+seg.Messages-seg.Live+seg.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		msgs = merge(msgs, older, limit)
+	}
+	return msgs, nil
+}
+
+// segmentSearch runs a search on one segment and keeps the matches it still
+// serves that weren't deleted
+func (t *tiers) segmentSearch(ctx context.Context, seg eventstore.ArchiveSegment, q *search.Query, limit int) ([]eventstore.StoredMessage, error) {
+	s, err := t.archiver.openSegment(ctx, t.userID, seg.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	msgs, err := s.SearchMessages(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	return t.served(ctx, seg.Key, msgs, false)
+}
+
+// openSegment opens one of the user's segments, downloading it if needed
+func (a *Archiver) openSegment(ctx context.Context, userID, key string) (eventstore.Segment, error) {
+	path, err := a.cache.fetch(ctx, a.blobs, key)
+	if err != nil {
+		return nil, err
+	}
+	s, err := a.stores.OpenSegment(path, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment %s: %w", key, err)
+	}
+	return s, nil
+}
+
+// merge combines two result sets newest first, up to limit. A message found
+// in both (re-synced after it was archived) is kept once, from a.
+func merge(a, b []eventstore.StoredMessage, limit int) []eventstore.StoredMessage {
+	seen := make(map[string]bool, len(a))
+	for _, m := range a {
+		seen[m.Provider+"|"+m.ProviderMessageID] = true
+	}
+	for _, m := range b {
+		if !seen[m.Provider+"|"+m.ProviderMessageID] {
+			a = append(a, m)
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool { return a[i].MsgDate > a[j].MsgDate })
+	if len(a) > limit {
+		a = a[:limit]
+	}
+	return a
+}
+
+// dateRange returns the message date bounds a query imposes: from inclusive,
+// to exclusive, 0 when unbounded
+func dateRange(q *search.Query) (from, to int64) {
+	for _, c := range q.Clauses {
+		if c.Negated {
+			continue
+		}
+		switch c.Field {
+		case search.FieldAfter:
+			if t := c.Time.Unix(); t > from {
+				from = t
+			}
+		case search.FieldBefore:
+			if t := c.Time.Unix(); to == 0 || t < to {
+				to = t
+			}
+		}
+	}
+	return from, to
+}
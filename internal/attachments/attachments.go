@@ -0,0 +1,138 @@
+// Package attachments extracts the text of stored message attachments. Sync
+// records allowed attachments as pending and uploads their content to the
+// blob store; the extractor works through a user's pending attachments in
+// batches, saves the text next to the record (indexed for search by the
+// store) and re-embeds the messages they belong to.
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/extract"
+	"github.com/Martian-dev/ai-brain-infra/internal/semantic"
+)
+
+// Extraction defaults
+const (
+	DefaultBatch   = 20
+	DefaultMaxText = 256 << 10 // bytes of text kept per attachment
+
+	// extractTimeout fails a document that takes longer to read, so one
+	// malformed file can't hold up the rest of the batch
+	extractTimeout = time.Minute
+)
+
+// Extractor turns pending attachments into text
+type Extractor struct {
+	stores  eventstore.Opener
+	blobs   blob.Store
+	indexer *semantic.Indexer // nil when embeddings are off
+	batch   int
+	maxText int
+}
+
+// New creates an extractor that handles batch attachments per run. indexer
+// may be nil.
+func New(stores eventstore.Opener, blobs blob.Store, indexer *semantic.Indexer, batch int) *Extractor {
+	if batch <= 0 {
+		batch = DefaultBatch
+	}
+	return &Extractor{stores: stores, blobs: blobs, indexer: indexer, batch: batch, maxText: DefaultMaxText}
+}
+
+// Run extracts one batch of the user's pending attachments and reports
+// whether none are left. A document that can't be read fails its record, not
+// the run.
+func (x *Extractor) Run(ctx context.Context, userID string) (bool, error) {
+	store, err := x.stores.Open(userID)
+	if err != nil {
+		return false, err
+	}
+	defer store.Close()
+
+	pending, err := store.PendingAttachments(ctx, x.batch)
+	if err != nil {
+		return false, err
+	}
+
+	type message struct{ provider, id string }
+	var extracted []message
+	seen := make(map[message]bool)
+	for i := range pending {
+		a := &pending[i]
+		if err := x.extract(ctx, a); err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			a.Status, a.Text, a.Error = eventstore.AttachmentFailed, "", err.Error()
+		}
+		if err := store.SaveAttachmentText(ctx, a); err != nil {
+			return false, err
+		}
+		if m := (message{a.Provider, a.ProviderMessageID}); a.Text != "" && !seen[m] {
+			seen[m] = true
+			extracted = append(extracted, m)
+		}
+	}
+
+	if x.indexer != nil {
+		for _, m := range extracted {
+			if err := x.reembed(ctx, store, m.provider, m.id); err != nil {
+				// The backfill doesn't revisit embedded mail, but search
+				// still finds the text
+				log.Printf("Error re-embedding %s/%s after attachment extraction: %v", m.provider, m.id, err)
+			}
+		}
+	}
+	return len(pending) < x.batch, nil
+}
+
+// extract reads an attachment's content from the blob store and extracts
+// its text
+func (x *Extractor) extract(ctx context.Context, a *eventstore.Attachment) error {
+	docType := extract.Type(a.ContentType, a.Filename)
+	if docType == "" {
+		return extract.ErrUnsupported
+	}
+
+	r, _, err := x.blobs.Get(ctx, a.BlobKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		return fmt.Errorf("content missing from blob store")
+	}
+	if err != nil {
+		return fmt.Errorf("read attachment: %w", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read attachment: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, extractTimeout)
+	defer cancel()
+	text, err := extract.Text(ctx, docType, data, x.maxText)
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", docType, err)
+	}
+	a.Status, a.Text, a.Error = eventstore.AttachmentExtracted, text, ""
+	if text == "" {
+		a.Error = "no text found"
+	}
+	return nil
+}
+
+// reembed replaces a message's vector with one that includes its attachments
+func (x *Extractor) reembed(ctx context.Context, store eventstore.Store, provider, providerMessageID string) error {
+	src, err := store.LoadEmbeddingSource(ctx, provider, providerMessageID)
+	if err != nil || src == nil {
+		return err
+	}
+	return x.indexer.Embed(ctx, store, src)
+}
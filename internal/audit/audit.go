@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Entry is a single audit record
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	Actor   string            `json:"actor"`            // user ID or service principal
+	Action  string            `json:"action"`           // e.g. "GET /internal/users/:user_id/events"
+	Target  string            `json:"target,omitempty"` // user whose data was touched
+	Status  int               `json:"status,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Logger appends audit entries as JSON lines to a file
+type Logger struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewLogger opens (or creates) the audit log at path
+func NewLogger(path string) (*Logger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &Logger{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Log writes an entry. Failures are logged but never block the caller.
+func (l *Logger) Log(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.enc.Encode(e); err != nil {
+		log.Printf("audit write failed: %v", err)
+	}
+}
+
+// Close closes the audit log file
+func (l *Logger) Close() error {
+	return l.file.Close()
+}
@@ -3,10 +3,16 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // Provider represents OAuth providers
@@ -15,6 +21,11 @@ type Provider string
 const (
 	ProviderGoogle    Provider = "google"
 	ProviderMicrosoft Provider = "microsoft"
+
+	// Task systems (internal/tasksink)
+	ProviderTodoist Provider = "todoist"
+	ProviderLinear  Provider = "linear"
+	ProviderNotion  Provider = "notion"
 )
 
 // Token represents OAuth tokens
@@ -24,10 +35,50 @@ type Token struct {
 	Expiry       time.Time
 }
 
+var (
+	// ErrAccountNotConnected is returned when BetterAuth has no linked account for a provider
+	ErrAccountNotConnected = errors.New("account not connected")
+
+	// ErrAuthRejected is returned when BetterAuth refuses the caller's token
+	// (expired or revoked session, missing scope); retrying won't help
+	ErrAuthRejected = errors.New("auth server rejected the credentials")
+
+	// ErrAuthServer is returned when BetterAuth can't be reached or fails
+	// (network errors, timeouts, 5xx and 429 responses) after retries
+	ErrAuthServer = errors.New("auth server error")
+
+	// ErrCircuitOpen is returned without calling BetterAuth while recent
+	// calls kept failing. It wraps ErrAuthServer.
+	ErrCircuitOpen = fmt.Errorf("%w: circuit open after repeated failures", ErrAuthServer)
+)
+
+// Retries and circuit breaking of calls to BetterAuth
+const (
+	authAttempts        = 3                      // per call, for server errors
+	authRetryDelay      = 200 * time.Millisecond // doubling between attempts
+	authBreakerFailures = 5                      // server errors in a row that open the circuit
+	authBreakerCooldown = 30 * time.Second       // open time before a trial call
+)
+
+// circuitOpens counts how often calls to BetterAuth were cut off
+var circuitOpens metric.Int64Counter
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/auth")
+
+	var err error
+	if circuitOpens, err = meter.Int64Counter("auth.betterauth.circuit.opens",
+		metric.WithDescription("Times calls to BetterAuth were stopped after repeated server errors"),
+		metric.WithUnit("{open}")); err != nil {
+		otel.Handle(err)
+	}
+}
+
 // BetterAuthClient fetches OAuth tokens from BetterAuth
 type BetterAuthClient struct {
 	baseURL string
 	client  *http.Client
+	breaker *breaker
 }
 
 // NewBetterAuthClient creates client to fetch tokens from BetterAuth
@@ -35,49 +86,172 @@ func NewBetterAuthClient(authServerURL string) *BetterAuthClient {
 	return &BetterAuthClient{
 		baseURL: authServerURL,
 		client:  &http.Client{Timeout: 10 * time.Second},
+		breaker: &breaker{threshold: authBreakerFailures, cooldown: authBreakerCooldown},
 	}
 }
 
+// CircuitState returns whether calls to BetterAuth go out: CircuitClosed,
+// CircuitOpen or CircuitHalfOpen (the next call is a trial)
+func (c *BetterAuthClient) CircuitState() string {
+	return c.breaker.state()
+}
+
 // GetToken fetches OAuth token from BetterAuth using user's JWT
 // BetterAuth handles storage, refresh, everything
 func (c *BetterAuthClient) GetToken(ctx context.Context, userJWT string, provider Provider) (*Token, error) {
 	url := fmt.Sprintf("%s/api/auth/accounts/%s/token", c.baseURL, provider)
+	return c.fetchToken(ctx, url, userJWT, provider)
+}
+
+// GetTokenForUser fetches a user's OAuth token with a service token (scope
+// tokens:read), for background work that runs without a user request
+func (c *BetterAuthClient) GetTokenForUser(ctx context.Context, serviceToken, userID string, provider Provider) (*Token, error) {
+	endpoint := fmt.Sprintf("%s/api/internal/users/%s/accounts/%s/token", c.baseURL, url.PathEscape(userID), provider)
+	return c.fetchToken(ctx, endpoint, serviceToken, provider)
+}
+
+// Account is a provider account the user linked in BetterAuth
+type Account struct {
+	Provider    Provider
+	Email       string    // the account's address at the provider, if BetterAuth knows it
+	ConnectedAt time.Time // zero if BetterAuth doesn't say
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// ListAccounts lists the provider accounts the user linked, using their JWT
+func (c *BetterAuthClient) ListAccounts(ctx context.Context, userJWT string) ([]Account, error) {
+	var accounts []Account
+	err := c.do(ctx, "GET", c.baseURL+"/api/auth/accounts", userJWT, "", func(resp *http.Response) error {
+		var result struct {
+			Accounts []struct {
+				Provider  Provider `json:"provider"`
+				Email     string   `json:"email"`
+				CreatedAt int64    `json:"created_at"` // unix timestamp
+			} `json:"accounts"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("%w: decode response: %v", ErrAuthServer, err)
+		}
+		for _, a := range result.Accounts {
+			account := Account{Provider: a.Provider, Email: a.Email}
+			if a.CreatedAt > 0 {
+				account.ConnectedAt = time.Unix(a.CreatedAt, 0)
+			}
+			accounts = append(accounts, account)
+		}
+		return nil
+	})
+	return accounts, err
+}
+
+// Ping checks that BetterAuth answers its health endpoint
+func (c *BetterAuthClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/health", nil)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return fmt.Errorf("create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+userJWT)
-
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return fmt.Errorf("request failed: %w", err)
 	}
-	defer resp.Body.Close()
+	resp.Body.Close()
 
-	if resp.StatusCode == 404 {
-		return nil, fmt.Errorf("no %s account connected", provider)
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
 	}
+	return nil
+}
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("bad status %d: %s", resp.StatusCode, string(body))
+// fetchToken calls a BetterAuth token endpoint with the given bearer token
+func (c *BetterAuthClient) fetchToken(ctx context.Context, endpoint, bearer string, provider Provider) (*Token, error) {
+	var token *Token
+	err := c.do(ctx, "GET", endpoint, bearer, provider, func(resp *http.Response) error {
+		var result struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresAt    int64  `json:"expires_at"` // unix timestamp
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("%w: decode response: %v", ErrAuthServer, err)
+		}
+		token = &Token{
+			AccessToken:  result.AccessToken,
+			RefreshToken: result.RefreshToken,
+			Expiry:       time.Unix(result.ExpiresAt, 0),
+		}
+		return nil
+	})
+	return token, err
+}
+
+// RevokeToken asks BetterAuth to revoke the provider token and unlink the account
+func (c *BetterAuthClient) RevokeToken(ctx context.Context, userJWT string, provider Provider) error {
+	url := fmt.Sprintf("%s/api/auth/accounts/%s/token", c.baseURL, provider)
+	return c.do(ctx, "DELETE", url, userJWT, provider, nil)
+}
+
+// do calls BetterAuth through the circuit breaker, retrying server errors
+// with backoff, and hands a successful response to read (if set). Errors
+// wrap ErrAccountNotConnected, ErrAuthRejected or ErrAuthServer.
+func (c *BetterAuthClient) do(ctx context.Context, method, endpoint, bearer string, provider Provider, read func(*http.Response) error) error {
+	delay := authRetryDelay
+	for attempt := 1; ; attempt++ {
+		if !c.breaker.allow() {
+			return ErrCircuitOpen
+		}
+		err := c.attempt(ctx, method, endpoint, bearer, provider, read)
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the server
+			c.breaker.abandon()
+			return err
+		}
+		serverError := errors.Is(err, ErrAuthServer)
+		if c.breaker.record(serverError) {
+			circuitOpens.Add(ctx, 1, metric.WithAttributes(attribute.String("method", method)))
+		}
+		if !serverError || attempt == authAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
 	}
+}
 
-	var result struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		ExpiresAt    int64  `json:"expires_at"` // unix timestamp
+// attempt makes one call to BetterAuth
+func (c *BetterAuthClient) attempt(ctx context.Context, method, endpoint, bearer string, provider Provider, read func(*http.Response) error) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+	req.Header.Set("Authorization", "Bearer "+bearer)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: request failed: %w", ErrAuthServer, err)
 	}
+	defer resp.Body.Close()
 
-	return &Token{
-		AccessToken:  result.AccessToken,
-		RefreshToken: result.RefreshToken,
-		Expiry:       time.Unix(result.ExpiresAt, 0),
-	}, nil
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("no %s account connected: %w", provider, ErrAccountNotConnected)
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: status %d", ErrAuthRejected, resp.StatusCode)
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("%w: status %d: %s", ErrAuthServer, resp.StatusCode, string(body))
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("bad status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if read == nil {
+		return nil
+	}
+	return read(resp)
 }
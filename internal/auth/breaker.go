@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states, see BetterAuthClient.CircuitState
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// breaker stops calls to a failing server for a cooldown after threshold
+// server errors in a row. After the cooldown one trial call goes through:
+// success closes the circuit, failure opens it again.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int       // server errors in a row
+	openUntil time.Time // zero while closed
+	trial     bool      // a half-open trial call is in flight
+}
+
+// allow reports whether a call may go out now
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return true
+	case time.Now().Before(b.openUntil) || b.trial:
+		return false
+	default:
+		b.trial = true
+		return true
+	}
+}
+
+// record notes a call's outcome and reports whether it opened the circuit.
+// Only server errors count against the server.
+func (b *breaker) record(serverError bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	trial := b.trial
+	b.trial = false
+	if !serverError {
+		b.failures, b.openUntil = 0, time.Time{}
+		return false
+	}
+	b.failures++
+	if trial || b.failures >= b.threshold {
+		opened := trial || b.openUntil.IsZero() // not a call that was in flight while open
+		b.openUntil = time.Now().Add(b.cooldown)
+		return opened
+	}
+	return false
+}
+
+// abandon notes a call that ended without an outcome, e.g. cancelled by its
+// caller, so a half-open circuit lets the next trial through
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// state returns CircuitClosed, CircuitOpen or CircuitHalfOpen
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openUntil.IsZero():
+		return CircuitClosed
+	case time.Now().Before(b.openUntil):
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
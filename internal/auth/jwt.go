@@ -2,13 +2,17 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // User represents an authenticated user from JWT token
@@ -16,16 +20,62 @@ type User struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
 	Name  string `json:"name"`
+	Role  string `json:"role,omitempty"`
+	OrgID string `json:"org_id,omitempty"` // tenant in multi-org deployments
+}
+
+// RoleAdmin is the role claim value granting admin access
+const RoleAdmin = "admin"
+
+// IsAdmin reports whether the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
 // JWTVerifier handles JWT token verification with cached JWKS
 type JWTVerifier struct {
-	jwksURL     string
-	cache       *jwk.Cache
-	keySet      jwk.Set
-	keySetMutex sync.RWMutex
-	lastFetch   time.Time
-	refreshTTL  time.Duration
+	jwksURL      string
+	cache        *jwk.Cache
+	keySet       jwk.Set
+	keySetMutex  sync.RWMutex
+	lastFetch    time.Time // last successful fetch
+	lastError    error     // latest failed fetch, nil after a success
+	failures     int       // fetches failed in a row
+	retryAt      time.Time // no fetch before this while lastError is set
+	refreshTTL   time.Duration
+	maxStaleness time.Duration // 0 keeps using the last keys indefinitely
+	verified     verifyCache   // optional, see SetVerifyCacheTTL
+}
+
+var (
+	// ErrKeysUnavailable is returned while no usable JWKS is loaded
+	ErrKeysUnavailable = errors.New("JWKS unavailable")
+
+	// ErrKeysStale is returned once the JWKS endpoint has failed for longer
+	// than the max staleness. It wraps ErrKeysUnavailable.
+	ErrKeysStale = fmt.Errorf("%w: keys older than the max staleness", ErrKeysUnavailable)
+)
+
+// keyRetryInterval is how long a failed JWKS fetch is remembered at first;
+// it doubles with every further failure, up to the refresh TTL
+const keyRetryInterval = 5 * time.Second
+
+// DefaultMaxStaleness is how long tokens are verified against the last
+// fetched keys while the JWKS endpoint fails
+const DefaultMaxStaleness = 24 * time.Hour
+
+// jwksFetchErrors counts failed JWKS fetches
+var jwksFetchErrors metric.Int64Counter
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/auth")
+
+	var err error
+	if jwksFetchErrors, err = meter.Int64Counter("auth.jwks.fetch.errors",
+		metric.WithDescription("JWKS fetches that failed; the last fetched keys stay in use"),
+		metric.WithUnit("{fetch}")); err != nil {
+		otel.Handle(err)
+	}
 }
 
 // NewJWTVerifier creates a new JWT verifier with JWKS caching
@@ -34,9 +84,21 @@ type JWTVerifier struct {
 // - No network call on most token verifications
 // - Minimal memory allocations
 func NewJWTVerifier(jwksURL string) (*JWTVerifier, error) {
+	return newJWTVerifier(jwksURL, true)
+}
+
+// NewLazyJWTVerifier creates a verifier that starts even if the JWKS can't be
+// fetched. Until the keys arrive (retried every few seconds) every token is
+// rejected with ErrKeysUnavailable.
+func NewLazyJWTVerifier(jwksURL string) (*JWTVerifier, error) {
+	return newJWTVerifier(jwksURL, false)
+}
+
+func newJWTVerifier(jwksURL string, requireKeys bool) (*JWTVerifier, error) {
 	verifier := &JWTVerifier{
-		jwksURL:    jwksURL,
-		refreshTTL: 5 * time.Minute, // Refresh keys every 5 minutes
+		jwksURL:      jwksURL,
+		refreshTTL:   5 * time.Minute, // Refresh keys every 5 minutes
+		maxStaleness: DefaultMaxStaleness,
 	}
 
 	// Initialize the cache with automatic refresh
@@ -54,13 +116,23 @@ func NewJWTVerifier(jwksURL string) (*JWTVerifier, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	keySet, err := verifier.fetchKeySet(ctx)
-	if err != nil {
+	if err := verifier.refresh(ctx); err != nil && requireKeys {
 		return nil, fmt.Errorf("failed initial JWKS fetch: %w", err)
 	}
 
-	verifier.keySet = keySet
-	verifier.lastFetch = time.Now()
+	// Report how old the keys in use are
+	_, err = otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/auth").Float64ObservableGauge("auth.jwks.staleness",
+		metric.WithDescription("Time since the JWKS in use was fetched"),
+		metric.WithUnit("s"),
+		metric.WithFloat64Callback(func(_ context.Context, o metric.Float64Observer) error {
+			if age, ok := verifier.keyAge(); ok {
+				o.Observe(age.Seconds())
+			}
+			return nil
+		}))
+	if err != nil {
+		otel.Handle(err)
+	}
 
 	// Start background refresh goroutine for proactive updates
 	go verifier.backgroundRefresh()
@@ -68,82 +140,215 @@ func NewJWTVerifier(jwksURL string) (*JWTVerifier, error) {
 	return verifier, nil
 }
 
-// fetchKeySet retrieves the JWKS from the cache (or fetches if needed)
+// SetMaxStaleness sets how long tokens are verified against the last fetched
+// keys while the JWKS endpoint fails (default DefaultMaxStaleness); 0 keeps
+// using them indefinitely
+func (v *JWTVerifier) SetMaxStaleness(d time.Duration) {
+	v.keySetMutex.Lock()
+	defer v.keySetMutex.Unlock()
+	v.maxStaleness = d
+}
+
+// fetchKeySet fetches the JWKS anew through the cache
 func (v *JWTVerifier) fetchKeySet(ctx context.Context) (jwk.Set, error) {
-	// Try to get from cache first (fastest path)
-	keySet, err := v.cache.Get(ctx, v.jwksURL)
-	if err != nil {
-		// Fallback to direct fetch if cache fails
-		return jwk.Fetch(ctx, v.jwksURL)
+	return v.cache.Refresh(ctx, v.jwksURL)
+}
+
+// refresh fetches the JWKS, keeping the current keys if that fails. A failure
+// is remembered (a negative cache) so a dead endpoint isn't fetched again
+// before the backoff, from keyRetryInterval doubling to the refresh TTL,
+// has passed.
+func (v *JWTVerifier) refresh(ctx context.Context) error {
+	v.keySetMutex.RLock()
+	lastError, retryAt := v.lastError, v.retryAt
+	v.keySetMutex.RUnlock()
+	if lastError != nil && time.Now().Before(retryAt) {
+		return lastError
+	}
+
+	keySet, err := v.fetchKeySet(ctx)
+	if err == nil {
+		v.setKeySet(keySet)
+		return nil
 	}
-	return keySet, nil
+
+	jwksFetchErrors.Add(ctx, 1)
+	v.keySetMutex.Lock()
+	defer v.keySetMutex.Unlock()
+	v.failures++
+	v.lastError = err
+	v.retryAt = time.Now().Add(min(keyRetryInterval<<min(v.failures-1, 16), v.refreshTTL))
+	return err
 }
 
 // backgroundRefresh proactively refreshes the JWKS in the background
 // This ensures we never block request handling for JWKS fetches
 func (v *JWTVerifier) backgroundRefresh() {
-	ticker := time.NewTicker(v.refreshTTL)
-	defer ticker.Stop()
-
-	for range ticker.C {
+	for {
+		time.Sleep(v.nextRefresh())
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		keySet, err := v.fetchKeySet(ctx)
+		_ = v.refresh(ctx) // keeps the current keys; retried after the backoff
 		cancel()
+	}
+}
 
-		if err == nil {
-			v.keySetMutex.Lock()
-			v.keySet = keySet
-			v.lastFetch = time.Now()
-			v.keySetMutex.Unlock()
-		}
-		// Silently continue on error - we'll retry on next tick
+// nextRefresh returns how long to wait before the next fetch: the refresh TTL
+// after a success, the remaining backoff after a failure
+func (v *JWTVerifier) nextRefresh() time.Duration {
+	v.keySetMutex.RLock()
+	defer v.keySetMutex.RUnlock()
+	if v.lastError != nil {
+		return max(time.Until(v.retryAt), 0)
+	}
+	if v.keySet == nil {
+		return keyRetryInterval
 	}
+	return v.refreshTTL
 }
 
-// getKeySet returns the cached key set (very fast, no network I/O)
-func (v *JWTVerifier) getKeySet() jwk.Set {
+// setKeySet installs a fetched key set. Tokens verified against the old keys
+// are verified again, so a removed key takes effect at once.
+func (v *JWTVerifier) setKeySet(keySet jwk.Set) {
+	v.keySetMutex.Lock()
+	v.keySet = keySet
+	v.lastFetch = time.Now()
+	v.lastError, v.failures, v.retryAt = nil, 0, time.Time{}
+	v.keySetMutex.Unlock()
+	v.verified.clear()
+}
+
+// Ready reports whether a JWKS has been loaded
+func (v *JWTVerifier) Ready() bool {
+	return v.KeysError() == nil
+}
+
+// KeysError returns why tokens can't be verified: ErrKeysUnavailable before
+// the first fetch, ErrKeysStale once the keys outlived the max staleness
+func (v *JWTVerifier) KeysError() error {
+	_, err := v.getKeySet()
+	return err
+}
+
+// keyAge returns how long ago the keys were fetched, false without keys
+func (v *JWTVerifier) keyAge() (time.Duration, bool) {
+	v.keySetMutex.RLock()
+	defer v.keySetMutex.RUnlock()
+	if v.keySet == nil {
+		return 0, false
+	}
+	return time.Since(v.lastFetch), true
+}
+
+// getKeySet returns the cached key set (very fast, no network I/O) unless it
+// is missing or too stale to trust
+func (v *JWTVerifier) getKeySet() (jwk.Set, error) {
 	v.keySetMutex.RLock()
 	defer v.keySetMutex.RUnlock()
-	return v.keySet
+	switch {
+	case v.keySet == nil:
+		return nil, ErrKeysUnavailable
+	case v.maxStaleness > 0 && time.Since(v.lastFetch) > v.maxStaleness:
+		return nil, ErrKeysStale
+	}
+	return v.keySet, nil
 }
 
-// UserFromRequest extracts and validates the JWT token from the request
-// This is the hot path - optimized for minimal allocations and latency
+// maxTokenLength bounds the bearer tokens worth parsing
+const maxTokenLength = 8 << 10
+
+var (
+	// ErrNoToken is returned when the request has no well-formed bearer token
+	ErrNoToken = errors.New("missing or malformed bearer token")
+
+	// ErrInvalidToken is returned for tokens that fail verification or lack
+	// a subject
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// userPool recycles the Users returned by UserFromRequest
+var userPool = sync.Pool{New: func() any { return new(User) }}
+
+// ReleaseUser returns a User from UserFromRequest to the pool. Call it once
+// nothing refers to the user any more, i.e. when the request is done.
+func ReleaseUser(u *User) {
+	if u != nil {
+		*u = User{}
+		userPool.Put(u)
+	}
+}
+
+// UserFromRequest extracts and validates the JWT token from the request.
+// This is the hot path: malformed headers are rejected before parsing, errors
+// are sentinels, the User comes from a pool (see ReleaseUser) and, with a
+// verification cache, repeated tokens skip signature checks.
 func (v *JWTVerifier) UserFromRequest(r *http.Request) (*User, error) {
-	// Parse the token from Authorization header
-	// jwt.ParseRequest handles "Bearer " prefix automatically
-	token, err := jwt.ParseRequest(
-		r,
-		jwt.WithKeySet(v.getKeySet()), // Use cached key set (no network I/O!)
-		jwt.WithValidate(true),         // Validate expiration and signature
-	)
+	keySet, err := v.getKeySet()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse JWT: %w", err)
+		return nil, err
 	}
 
-	// Extract user information from token claims
-	userID := token.Subject()
-	if userID == "" {
-		return nil, fmt.Errorf("token missing user ID (subject)")
+	raw, ok := bearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		return nil, ErrNoToken
 	}
 
-	// Extract email and name from custom claims
-	var email, name string
-	if emailClaim, ok := token.Get("email"); ok {
-		email, _ = emailClaim.(string)
+	u := userPool.Get().(*User)
+	if v.verified.get(raw, u) {
+		return u, nil
+	}
+
+	token, err := jwt.ParseString(raw, jwt.WithKeySet(keySet), jwt.WithValidate(true))
+	if err != nil {
+		ReleaseUser(u)
+		return nil, ErrInvalidToken
 	}
-	if nameClaim, ok := token.Get("name"); ok {
-		name, _ = nameClaim.(string)
+	if u.ID = token.Subject(); u.ID == "" {
+		ReleaseUser(u)
+		return nil, ErrInvalidToken
 	}
 
-	return &User{
-		ID:    userID,
-		Email: email,
-		Name:  name,
-	}, nil
+	// Email, name, role and org come from custom claims
+	u.Email = stringClaim(token, "email")
+	u.Name = stringClaim(token, "name")
+	u.Role = stringClaim(token, "role")
+	u.OrgID = stringClaim(token, "org_id")
+
+	v.verified.put(raw, u, token.Expiration())
+	return u, nil
+}
+
+func stringClaim(token jwt.Token, name string) string {
+	if claim, ok := token.Get(name); ok {
+		s, _ := claim.(string)
+		return s
+	}
+	return ""
 }
 
-// GetCacheStats returns statistics about the JWKS cache
+// bearerToken returns the token of an "Authorization: Bearer" header if it
+// has the shape of a compact JWS: three base64url segments
+func bearerToken(header string) (string, bool) {
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := header[7:]
+	if len(token) == 0 || len(token) > maxTokenLength {
+		return "", false
+	}
+	dots := 0
+	for i := 0; i < len(token); i++ {
+		switch c := token[i]; {
+		case c == '.':
+			dots++
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return "", false
+		}
+	}
+	return token, dots == 2
+}
+
+// GetCacheStats returns statistics about the JWKS and verification caches
 func (v *JWTVerifier) GetCacheStats() map[string]interface{} {
 	v.keySetMutex.RLock()
 	defer v.keySetMutex.RUnlock()
@@ -153,11 +358,22 @@ func (v *JWTVerifier) GetCacheStats() map[string]interface{} {
 		keyCount = v.keySet.Len()
 	}
 
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"keys_cached":   keyCount,
 		"last_fetch":    v.lastFetch,
 		"refresh_ttl":   v.refreshTTL,
 		"age_seconds":   time.Since(v.lastFetch).Seconds(),
+		"max_staleness": v.maxStaleness,
+		"stale":         v.keySet != nil && v.maxStaleness > 0 && time.Since(v.lastFetch) > v.maxStaleness,
 		"jwks_url":      v.jwksURL,
 	}
+	if v.lastError != nil {
+		stats["last_error"] = v.lastError.Error()
+		stats["failures"] = v.failures
+		stats["next_attempt"] = v.retryAt
+	}
+	for k, n := range v.verified.stats() {
+		stats[k] = n
+	}
+	return stats
 }
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// authServer serves a JWKS and signs tokens like auth-server's jwt plugin:
+// RS256, sub set to the user ID, and the claims of definePayload
+type authServer struct {
+	key jwk.Key
+	srv *httptest.Server
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Set(jwk.KeyIDKey, "test-key")
+	key.Set(jwk.AlgorithmKey, jwa.RS256)
+
+	pub, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	set.AddKey(pub)
+
+	a := &authServer{key: key}
+	a.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(a.srv.Close)
+	return a
+}
+
+// sign issues a token for the BetterAuth user row
+func (a *authServer) sign(t *testing.T, user map[string]any) string {
+	t.Helper()
+	tok := jwt.New()
+	for name, value := range map[string]any{
+		jwt.SubjectKey:    user["id"],
+		jwt.IssuerKey:     a.srv.URL,
+		jwt.AudienceKey:   a.srv.URL,
+		jwt.IssuedAtKey:   time.Now(),
+		jwt.ExpirationKey: time.Now().Add(2 * time.Hour),
+		"id":              user["id"],
+		"email":           user["email"],
+		"name":            user["name"],
+	} {
+		tok.Set(name, value)
+	}
+	if role, ok := user["role"]; ok {
+		tok.Set("role", role)
+	}
+	signed, err := jwt.Sign(tok, jwt.WithKey(jwa.RS256, a.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestUserFromRequestRole(t *testing.T) {
+	server := newAuthServer(t)
+	verifier, err := NewJWTVerifier(server.srv.URL)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		user  map[string]any
+		admin bool
+	}{
+		{"admin", map[string]any{"id": "u1", "email": "ops@example.com", "name": "Ops", "role": "admin"}, true},
+		{"no role", map[string]any{"id": "u2", "email": "ann@example.com", "name": "Ann"}, false},
+		{"other role", map[string]any{"id": "u3", "email": "bob@example.com", "name": "Bob", "role": "support"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+server.sign(t, tc.user))
+			u, err := verifier.UserFromRequest(req)
+			if err != nil {
+				t.Fatalf("UserFromRequest: %v", err)
+			}
+			defer ReleaseUser(u)
+			if u.ID != tc.user["id"] || u.Email != tc.user["email"] || u.Name != tc.user["name"] {
+				t.Errorf("user = %+v, want %v", u, tc.user)
+			}
+			if u.IsAdmin() != tc.admin {
+				t.Errorf("IsAdmin() = %v, want %v (role %q)", u.IsAdmin(), tc.admin, u.Role)
+			}
+		})
+	}
+}
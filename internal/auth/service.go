@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Service token scopes
+const (
+	ScopeEventsRead  = "events:read"
+	ScopeEventsWrite = "events:write"
+	ScopeTokensRead  = "tokens:read" // fetch users' provider tokens from BetterAuth
+)
+
+const (
+	serviceTokenIssuer   = "ai-brain-api"
+	serviceSubjectPrefix = "svc:"
+)
+
+// ServicePrincipal represents an internal worker authenticated with a service token
+type ServicePrincipal struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *ServicePrincipal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceTokenIssuer issues and verifies HMAC-signed service tokens for internal workers.
+// These are kept separate from user JWTs (RS256 via BetterAuth JWKS) so a leaked
+// user token can never be used against internal routes and vice versa.
+type ServiceTokenIssuer struct {
+	key jwk.Key
+}
+
+// NewServiceTokenIssuer creates an issuer from a shared secret
+func NewServiceTokenIssuer(secret []byte) (*ServiceTokenIssuer, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("service token secret must be at least 32 bytes")
+	}
+
+	key, err := jwk.FromRaw(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing key: %w", err)
+	}
+
+	return &ServiceTokenIssuer{key: key}, nil
+}
+
+// Issue signs a token for the named service with explicit scopes
+func (i *ServiceTokenIssuer) Issue(name string, scopes []string, ttl time.Duration) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("service name required")
+	}
+	if len(scopes) == 0 {
+		return "", fmt.Errorf("at least one scope required")
+	}
+
+	now := time.Now()
+	token, err := jwt.NewBuilder().
+		Issuer(serviceTokenIssuer).
+		Subject(serviceSubjectPrefix+name).
+		JwtID(uuid.NewString()).
+		IssuedAt(now).
+		Expiration(now.Add(ttl)).
+		Claim("scope", strings.Join(scopes, " ")).
+		Build()
+	if err != nil {
+		return "", fmt.Errorf("failed to build token: %w", err)
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, i.key))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return string(signed), nil
+}
+
+// PrincipalFromRequest extracts and validates a service token from the request
+func (i *ServiceTokenIssuer) PrincipalFromRequest(r *http.Request) (*ServicePrincipal, error) {
+	token, err := jwt.ParseRequest(
+		r,
+		jwt.WithKey(jwa.HS256, i.key),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(serviceTokenIssuer),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service token: %w", err)
+	}
+
+	name, ok := strings.CutPrefix(token.Subject(), serviceSubjectPrefix)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("token is not a service token")
+	}
+
+	var scopes []string
+	if scopeClaim, ok := token.Get("scope"); ok {
+		if s, ok := scopeClaim.(string); ok {
+			scopes = strings.Fields(s)
+		}
+	}
+
+	return &ServicePrincipal{
+		Name:   name,
+		Scopes: scopes,
+	}, nil
+}
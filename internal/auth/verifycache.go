@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MaxVerifyCacheTTL bounds how long a verified token is trusted without
+// checking its signature again
+const MaxVerifyCacheTTL = time.Minute
+
+// maxVerifiedTokens bounds the verification cache; it is emptied when full
+const maxVerifiedTokens = 10000
+
+// verifyCache remembers recently verified tokens by SHA-256, so a burst of
+// requests with the same token verifies its signature once. The zero value
+// is disabled.
+type verifyCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[[sha256.Size]byte]verifiedToken
+
+	hits, misses atomic.Int64
+}
+
+// hashBufs recycles the buffers tokens are hashed from, keeping cache hits
+// free of allocations
+var hashBufs = sync.Pool{New: func() any { return new([]byte) }}
+
+func tokenHash(token string) [sha256.Size]byte {
+	buf := hashBufs.Get().(*[]byte)
+	*buf = append((*buf)[:0], token...)
+	sum := sha256.Sum256(*buf)
+	hashBufs.Put(buf)
+	return sum
+}
+
+// verifiedToken is a cached verification result
+type verifiedToken struct {
+	user    User
+	expires time.Time // the earlier of the cache TTL and the token's exp
+}
+
+// SetVerifyCacheTTL enables the verification cache with entries living ttl
+// (at most MaxVerifyCacheTTL, and never past the token's expiry); 0
+// disables it
+func (v *JWTVerifier) SetVerifyCacheTTL(ttl time.Duration) {
+	v.verified.mu.Lock()
+	defer v.verified.mu.Unlock()
+	v.verified.ttl = min(ttl, MaxVerifyCacheTTL)
+	v.verified.entries = nil
+	if v.verified.ttl > 0 {
+		v.verified.entries = make(map[[sha256.Size]byte]verifiedToken)
+	}
+}
+
+// get copies the user of a cached, unexpired token into u
+func (c *verifyCache) get(token string, u *User) bool {
+	c.mu.RLock()
+	if c.entries == nil {
+		c.mu.RUnlock()
+		return false
+	}
+	entry, ok := c.entries[tokenHash(token)]
+	c.mu.RUnlock()
+
+	if !ok || !time.Now().Before(entry.expires) {
+		c.misses.Add(1)
+		return false
+	}
+	c.hits.Add(1)
+	*u = entry.user
+	return true
+}
+
+// put caches a verified token's user until the TTL or the token's expiry
+func (c *verifyCache) put(token string, u *User, exp time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		return
+	}
+	expires := time.Now().Add(c.ttl)
+	if !exp.IsZero() && exp.Before(expires) {
+		expires = exp
+	}
+	if len(c.entries) >= maxVerifiedTokens {
+		clear(c.entries)
+	}
+	c.entries[tokenHash(token)] = verifiedToken{user: *u, expires: expires}
+}
+
+// clear forgets every cached token
+func (c *verifyCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries != nil {
+		clear(c.entries)
+	}
+}
+
+func (c *verifyCache) stats() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return map[string]interface{}{
+		"verify_cache_ttl":     c.ttl,
+		"verify_cache_entries": len(c.entries),
+		"verify_cache_hits":    c.hits.Load(),
+		"verify_cache_misses":  c.misses.Load(),
+	}
+}
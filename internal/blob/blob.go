@@ -0,0 +1,133 @@
+// Package blob stores binary objects (attachments, offloaded event payloads)
+// on local disk or in S3/GCS buckets, under per-user key prefixes.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a key doesn't exist
+var ErrNotFound = errors.New("blob not found")
+
+// Object describes a stored blob
+type Object struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// Store is a blob backend
+type Store interface {
+	// Put writes r (size bytes, -1 if unknown) to key, replacing any existing blob
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens key for reading; the caller closes the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every blob whose key starts with prefix
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+	// SignedURL returns a URL that allows downloading key without credentials until ttl passes
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// userPrefix is the root of all per-user keys
+const userPrefix = "users/"
+
+// UserKey builds the key for a user's blob, e.g. UserKey("u1", "payloads", "x.json")
+// is "users/u1/payloads/x.json". It rejects empty or path-escaping segments.
+func UserKey(userID string, parts ...string) (string, error) {
+	segments := append([]string{userID}, parts...)
+	for _, s := range segments {
+		if s == "" || s == "." || s == ".." || strings.ContainsAny(s, "/\\") {
+			return "", fmt.Errorf("invalid blob key segment %q", s)
+		}
+	}
+	return userPrefix + strings.Join(segments, "/"), nil
+}
+
+// UserRelativeKey resolves a key relative to the user's prefix (as sent by
+// API clients), rejecting anything that would escape it
+func UserRelativeKey(userID, rel string) (string, error) {
+	rel = strings.TrimPrefix(rel, "/")
+	if rel == "" {
+		return "", fmt.Errorf("key required")
+	}
+	return UserKey(userID, strings.Split(rel, "/")...)
+}
+
+// validKey guards backends against keys that would escape their root
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LifecycleRule expires blobs under a user-relative prefix (e.g. "payloads/")
+// once they are older than MaxAge
+type LifecycleRule struct {
+	Prefix string
+	MaxAge time.Duration
+}
+
+// ParseLifecycle parses rules like "payloads/=720h,attachments/=2160h"
+func ParseLifecycle(spec string) ([]LifecycleRule, error) {
+	var rules []LifecycleRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		prefix, age, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid lifecycle rule %q (want prefix=duration)", part)
+		}
+		maxAge, err := time.ParseDuration(age)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("invalid lifecycle max age %q", age)
+		}
+		rules = append(rules, LifecycleRule{Prefix: strings.TrimPrefix(prefix, "/"), MaxAge: maxAge})
+	}
+	return rules, nil
+}
+
+// Sweep deletes every user blob matched by an expired rule and returns how
+// many were removed
+func Sweep(ctx context.Context, store Store, rules []LifecycleRule, now time.Time) (int, error) {
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	var expired []string
+	err := store.List(ctx, userPrefix, func(obj Object) error {
+		// users/{user_id}/{rel}
+		_, rel, ok := strings.Cut(strings.TrimPrefix(obj.Key, userPrefix), "/")
+		if !ok {
+			return nil
+		}
+		for _, rule := range rules {
+			if strings.HasPrefix(rel, rule.Prefix) && now.Sub(obj.ModTime) > rule.MaxAge {
+				expired = append(expired, obj.Key)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("list blobs: %w", err)
+	}
+
+	for i, key := range expired {
+		if err := store.Delete(ctx, key); err != nil {
+			return i, fmt.Errorf("delete %s: %w", key, err)
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,93 @@
+// Package calendar keeps the meeting proposals found in the user's mail. The
+// meetings enricher publishes calendar.suggestion events; the projection here
+// stores them in the user's store so readers (the context builder, agents)
+// can list upcoming proposals without replaying the stream.
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/enrich"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+)
+
+// linkOnlyLifetime is how long a proposal with a conference link but no time
+// stays relevant after it was found
+const linkOnlyLifetime = 7 * 24 * time.Hour
+
+// suggestion is the payload of a calendar.suggestion event
+type suggestion struct {
+	TS                int64                     `json:"ts"`
+	Provider          string                    `json:"provider"`
+	ProviderMessageID string                    `json:"provider_message_id"`
+	ProviderThreadID  string                    `json:"provider_thread_id"`
+	SourceEventID     string                    `json:"source_event_id"`
+	Title             string                    `json:"title"`
+	Candidates        []eventstore.CalendarSlot `json:"candidates"`
+	Attendees         []string                  `json:"attendees"`
+	Conference        *enrich.Conference        `json:"conference"`
+}
+
+// Projection returns the projection that stores calendar.suggestion events.
+// Suggestions are keyed by their source message, so replays overwrite.
+func Projection(stores eventstore.Opener) projection.Projection {
+	return projection.Projection{
+		Name:   "calendar",
+		Events: []string{enrich.EventCalendarSuggestion},
+		Apply: func(ctx context.Context, ev projection.Event) error {
+			var s suggestion
+			if err := json.Unmarshal(ev.Data, &s); err != nil || s.ProviderMessageID == "" {
+				return nil // not ours to fix
+			}
+
+			store, err := stores.Open(ev.UserID)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			return store.SaveCalendarSuggestion(ctx, record(&s, ev.Time))
+		},
+	}
+}
+
+// record converts an event into the stored suggestion. A proposal without
+// candidate times ends linkOnlyLifetime after it was found.
+func record(s *suggestion, published time.Time) eventstore.CalendarSuggestion {
+	found := s.TS
+	if found == 0 {
+		found = published.Unix()
+	}
+	cs := eventstore.CalendarSuggestion{
+		Provider:          s.Provider,
+		ProviderMessageID: s.ProviderMessageID,
+		ProviderThreadID:  s.ProviderThreadID,
+		SourceEventID:     s.SourceEventID,
+		Title:             s.Title,
+		Candidates:        s.Candidates,
+		Attendees:         s.Attendees,
+		CreatedAt:         found,
+	}
+	if cs.Candidates == nil {
+		cs.Candidates = []eventstore.CalendarSlot{}
+	}
+	if cs.Attendees == nil {
+		cs.Attendees = []string{}
+	}
+	if s.Conference != nil {
+		cs.ConferenceURL = s.Conference.URL
+	}
+
+	for _, c := range cs.Candidates {
+		if start := c.Start.Unix(); cs.StartsAt == 0 || start < cs.StartsAt {
+			cs.StartsAt = start
+		}
+		cs.EndsAt = max(cs.EndsAt, c.End.Unix())
+	}
+	if len(cs.Candidates) == 0 {
+		cs.EndsAt = found + int64(linkOnlyLifetime/time.Second)
+	}
+	return cs
+}
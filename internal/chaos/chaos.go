@@ -0,0 +1,162 @@
+// Package chaos injects faults at random into provider calls, NATS publishes
+// and SQLite transactions so retry, backoff and outbox paths can be exercised
+// in staging. It is off unless CHAOS_MODE is set.
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Fault is a kind of injected failure
+type Fault string
+
+const (
+	// ProviderError fails a provider HTTP call with a 503
+	ProviderError Fault = "provider_error"
+	// NATSPublish fails a JetStream publish
+	NATSPublish Fault = "nats_publish"
+	// SQLiteBusy fails an event store transaction as if the database were locked
+	SQLiteBusy Fault = "sqlite_busy"
+)
+
+// rateEnv maps each fault to the variable holding its probability
+var rateEnv = map[Fault]string{
+	ProviderError: "CHAOS_PROVIDER_ERROR_RATE",
+	NATSPublish:   "CHAOS_NATS_PUBLISH_ERROR_RATE",
+	SQLiteBusy:    "CHAOS_SQLITE_BUSY_RATE",
+}
+
+// ErrInjected marks every injected failure
+var ErrInjected = errors.New("chaos: injected fault")
+
+// Config holds the probability (0 to 1) of each fault per operation
+type Config map[Fault]float64
+
+// String lists the configured rates
+func (c Config) String() string {
+	parts := make([]string, 0, len(c))
+	for _, f := range []Fault{ProviderError, NATSPublish, SQLiteBusy} {
+		parts = append(parts, fmt.Sprintf("%s=%g", f, c[f]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FromEnv reads the fault rates. It returns nil unless CHAOS_MODE is true.
+func FromEnv() (Config, error) {
+	enabled, _ := strconv.ParseBool(os.Getenv("CHAOS_MODE"))
+	if !enabled {
+		return nil, nil
+	}
+
+	cfg := make(Config, len(rateEnv))
+	for f, env := range rateEnv {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid %s %q: want a probability between 0 and 1", env, v)
+		}
+		cfg[f] = rate
+	}
+	return cfg, nil
+}
+
+// active is the configuration in effect, nil when chaos mode is off
+var active atomic.Pointer[Config]
+
+// Enable starts injecting faults at cfg's rates. Call it at startup, before
+// clients are created with Transport.
+func Enable(cfg Config) {
+	active.Store(&cfg)
+}
+
+// Enabled reports whether chaos mode is on
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+// Inject returns an error wrapping ErrInjected with the fault's configured
+// probability, nil otherwise (always nil when chaos mode is off)
+func Inject(ctx context.Context, f Fault) error {
+	cfg := active.Load()
+	if cfg == nil {
+		return nil
+	}
+	rate := (*cfg)[f]
+	if rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+	injected.Add(ctx, 1, metric.WithAttributes(attribute.String("fault", string(f))))
+	return fmt.Errorf("%w (%s)", ErrInjected, f)
+}
+
+// injectedBody is returned by failed provider calls, shaped like a Google API
+// error so SDKs parse it
+const injectedBody = `{"error":{"code":503,"message":"chaos: injected provider error","status":"UNAVAILABLE"}}`
+
+// transport fails a share of requests with a 503 before they are sent
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport wraps base to fail provider calls at the ProviderError rate. It
+// returns base unchanged when chaos mode is off.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !Enabled() {
+		return base
+	}
+	return &transport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Inject(req.Context(), ProviderError) == nil {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:     "503 Service Unavailable",
+		StatusCode: http.StatusServiceUnavailable,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader([]byte(injectedBody))),
+		Request:    req,
+	}, nil
+}
+
+// injected counts faults, recorded through the global MeterProvider
+var injected metric.Int64Counter
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/chaos")
+
+	var err error
+	if injected, err = meter.Int64Counter("chaos.injected",
+		metric.WithDescription("Faults injected by chaos mode"),
+		metric.WithUnit("{fault}")); err != nil {
+		otel.Handle(err)
+	}
+}
@@ -0,0 +1,376 @@
+// Package contactmerge finds contacts that are likely the same person and
+// merges them. Candidates come from the contacts table alone: matching or
+// similar display names, a name spelled out in the other address, and alias
+// patterns of one mailbox (plus tags, Gmail dots, the same local part at a
+// sibling domain). A shared company domain strengthens a match but is never
+// one on its own, and freemail domains don't count as shared.
+//
+// A merge makes the merged addresses count towards the primary contact, so
+// its mail counts, relationship score and signature details cover all of
+// them. Merges are kept as history and can be undone; contact.merged and
+// contact.unmerged are published for each.
+package contactmerge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// Events published for merges
+const (
+	EventMerged   = "contact.merged"
+	EventUnmerged = "contact.unmerged"
+)
+
+// Reasons two contacts look like one person
+const (
+	ReasonAlias         = "alias"           // the same mailbox written differently
+	ReasonSameName      = "same_name"       // identical full names
+	ReasonSimilarName   = "similar_name"    // full names a typo or nickname apart
+	ReasonNameInAddress = "name_in_address" // one's name spelled as the other's address
+	ReasonSharedDomain  = "shared_domain"   // the same organisation's domain
+)
+
+// DefaultMinConfidence is the confidence below which candidates are dropped
+const DefaultMinConfidence = 0.5
+
+// Confidence of each signal; a shared domain adds sharedDomainBoost
+const (
+	aliasConfidence         = 0.95
+	siblingConfidence       = 0.75 // same local part at a sibling domain
+	sameNameConfidence      = 0.8
+	nameInAddressConfidence = 0.7
+	similarNameConfidence   = 0.6
+	sharedDomainBoost       = 0.1
+
+	similarNameThreshold = 0.92 // Jaro-Winkler similarity of full names
+	maxBucket            = 200  // larger blocking buckets are too common to tell people apart
+)
+
+// Candidate is a pair of contacts that are likely the same person
+type Candidate struct {
+	Contacts   []eventstore.Contact `json:"contacts"`
+	Confidence float64              `json:"confidence"`
+	Reasons    []string             `json:"reasons"`
+}
+
+// freemail domains are shared by unrelated people
+var freemail = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "outlook.com": true, "hotmail.com": true,
+	"live.com": true, "msn.com": true, "yahoo.com": true, "ymail.com": true,
+	"icloud.com": true, "me.com": true, "mac.com": true, "aol.com": true,
+	"proton.me": true, "protonmail.com": true, "gmx.com": true, "gmx.de": true,
+	"gmx.net": true, "mail.com": true, "yandex.ru": true, "zoho.com": true,
+	"fastmail.com": true, "web.de": true,
+}
+
+// roleLocals are local parts shared by whoever handles a role, not a person
+var roleLocals = map[string]bool{
+	"info": true, "admin": true, "support": true, "hello": true, "contact": true,
+	"sales": true, "office": true, "team": true, "billing": true, "help": true,
+	"mail": true, "noreply": true, "no-reply": true, "hr": true, "jobs": true,
+}
+
+// profile is a contact's normalized name and address parts
+type profile struct {
+	tokens    []string // name words, lowercased, letters and digits only
+	name      string   // tokens joined with spaces
+	nameKey   string   // tokens sorted, so word order doesn't matter
+	local     string   // address local part without its plus tag
+	domain    string
+	canonical string // local@domain with Gmail dots removed
+	sibling   string // local part at the domain's organisation name
+	spelled   map[string]bool
+}
+
+func newProfile(c eventstore.Contact) profile {
+	var p profile
+	for _, word := range strings.FieldsFunc(strings.ToLower(c.Name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		p.tokens = append(p.tokens, word)
+	}
+	p.name = strings.Join(p.tokens, " ")
+	sorted := append([]string(nil), p.tokens...)
+	sort.Strings(sorted)
+	p.nameKey = strings.Join(sorted, " ")
+
+	at := strings.LastIndex(c.Email, "@")
+	if at < 0 {
+		return p
+	}
+	p.local, p.domain = c.Email[:at], c.Email[at+1:]
+	if plus := strings.Index(p.local, "+"); plus > 0 {
+		p.local = p.local[:plus]
+	}
+	local, domain := p.local, p.domain
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	p.canonical = local + "@" + domain
+	if org := orgName(p.domain); org != "" && !freemail[p.domain] && !roleLocals[p.local] && len(p.local) >= 3 {
+		p.sibling = p.local + "@" + org
+	}
+
+	// Ways a name is commonly written as a local part
+	if len(p.tokens) >= 2 {
+		first, last := p.tokens[0], p.tokens[len(p.tokens)-1]
+		initial := string([]rune(first)[:1])
+		p.spelled = map[string]bool{}
+		for _, s := range []string{
+			first + last, first + "." + last, first + "_" + last, first + "-" + last,
+			last + first, last + "." + first, initial + last, initial + "." + last,
+		} {
+			p.spelled[s] = true
+		}
+	}
+	return p
+}
+
+// orgName returns the organisation label of a domain: "acme" for acme.com,
+// mail.acme.com and acme.co.uk
+func orgName(domain string) string {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	i := len(labels) - 2
+	switch labels[i] {
+	case "co", "com", "org", "net", "ac", "gov", "edu":
+		if len(labels[len(labels)-1]) == 2 && i > 0 {
+			i--
+		}
+	}
+	return labels[i]
+}
+
+// Duplicates returns pairs of contacts that are likely the same person with
+// at least minConfidence, most likely first
+func Duplicates(contacts []eventstore.Contact, minConfidence float64) []Candidate {
+	profiles := make([]profile, len(contacts))
+	buckets := map[string][]int{}
+	for i, c := range contacts {
+		p := newProfile(c)
+		profiles[i] = p
+
+		keys := []string{"c:" + p.canonical}
+		if p.sibling != "" {
+			keys = append(keys, "s:"+p.sibling)
+		}
+		if p.local != "" {
+			keys = append(keys, "l:"+p.local)
+		}
+		for s := range p.spelled {
+			keys = append(keys, "l:"+s)
+		}
+		if len(p.tokens) >= 2 {
+			for _, t := range p.tokens {
+				if len(t) >= 3 {
+					keys = append(keys, "t:"+t)
+				}
+			}
+		}
+		for _, k := range keys {
+			buckets[k] = append(buckets[k], i)
+		}
+	}
+
+	type pair struct{ a, b int }
+	compared := map[pair]bool{}
+	var out []Candidate
+	for _, members := range buckets {
+		if len(members) < 2 || len(members) > maxBucket {
+			continue
+		}
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				a, b := members[x], members[y]
+				if a > b {
+					a, b = b, a
+				}
+				if a == b || compared[pair{a, b}] {
+					continue
+				}
+				compared[pair{a, b}] = true
+
+				confidence, reasons := match(profiles[a], profiles[b])
+				if confidence < minConfidence || len(reasons) == 0 {
+					continue
+				}
+				out = append(out, Candidate{
+					Contacts:   []eventstore.Contact{contacts[a], contacts[b]},
+					Confidence: confidence,
+					Reasons:    reasons,
+				})
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Confidence != out[j].Confidence {
+			return out[i].Confidence > out[j].Confidence
+		}
+		if out[i].Contacts[0].Email != out[j].Contacts[0].Email {
+			return out[i].Contacts[0].Email < out[j].Contacts[0].Email
+		}
+		return out[i].Contacts[1].Email < out[j].Contacts[1].Email
+	})
+	return out
+}
+
+// match scores how likely two contacts are one person
+func match(a, b profile) (float64, []string) {
+	var (
+		confidence float64
+		reasons    []string
+	)
+	signal := func(reason string, c float64) {
+		reasons = append(reasons, reason)
+		if c > confidence {
+			confidence = c
+		}
+	}
+
+	switch {
+	case a.canonical == b.canonical:
+		signal(ReasonAlias, aliasConfidence)
+	case a.sibling != "" && a.sibling == b.sibling:
+		signal(ReasonAlias, siblingConfidence)
+	}
+
+	if len(a.tokens) >= 2 && len(b.tokens) >= 2 {
+		if a.nameKey == b.nameKey {
+			signal(ReasonSameName, sameNameConfidence)
+		} else if jaroWinkler(a.name, b.name) >= similarNameThreshold {
+			signal(ReasonSimilarName, similarNameConfidence)
+		}
+	}
+	if a.spelled[b.local] || b.spelled[a.local] {
+		signal(ReasonNameInAddress, nameInAddressConfidence)
+	}
+
+	if len(reasons) > 0 && a.domain == b.domain && !freemail[a.domain] {
+		reasons = append(reasons, ReasonSharedDomain)
+		confidence += sharedDomainBoost
+	}
+	if confidence > 0.99 {
+		confidence = 0.99
+	}
+	return confidence, reasons
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings, 0 to 1
+func jaroWinkler(s, t string) float64 {
+	a, b := []rune(s), []rune(t)
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	window := max(len(a), len(b))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matchedA := make([]bool, len(a))
+	matchedB := make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		for j := max(0, i-window); j < min(len(b), i+window+1); j++ {
+			if !matchedB[j] && a[i] == b[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range a {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(a), len(b)) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// Merge merges duplicates into the primary contact and queues contact.merged
+// in the same transaction
+func Merge(ctx context.Context, store eventstore.Store, userID, primary string, duplicates []string) (*eventstore.ContactMerge, error) {
+	m := &eventstore.ContactMerge{ID: uuid.NewString(), Primary: primary, Merged: duplicates}
+	err := store.WithTx(ctx, func(tx eventstore.Tx) error {
+		if err := tx.MergeContacts(ctx, m); err != nil {
+			return err
+		}
+		return queue(ctx, tx, userID, EventMerged, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Undo splits a merge's addresses out again and queues contact.unmerged in
+// the same transaction
+func Undo(ctx context.Context, store eventstore.Store, userID, id string) (*eventstore.ContactMerge, error) {
+	var m *eventstore.ContactMerge
+	err := store.WithTx(ctx, func(tx eventstore.Tx) error {
+		var err error
+		if m, err = tx.UndoContactMerge(ctx, id); err != nil {
+			return err
+		}
+		return queue(ctx, tx, userID, EventUnmerged, m)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func queue(ctx context.Context, tx eventstore.Tx, userID, eventType string, m *eventstore.ContactMerge) error {
+	payload, err := json.Marshal(map[string]any{
+		"user_id":  userID,
+		"ts":       time.Now().Unix(),
+		"merge_id": m.ID,
+		"primary":  m.Primary,
+		"merged":   m.Merged,
+	})
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+		Subject:     fmt.Sprintf("user.%s.%s", userID, eventType),
+		EventType:   eventType,
+		Payload:     payload,
+		MsgID:       fmt.Sprintf("%s|%s", eventType, m.ID),
+		TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+	})
+}
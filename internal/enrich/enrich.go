@@ -0,0 +1,284 @@
+// Package enrich derives new events from received mail. Enrichers look at
+// each email.received event and return the events it implies (a meeting
+// proposal becomes calendar.suggestion); the worker runs them as a
+// projection over the USER_EVENTS stream and queues their results in the
+// user's outbox, linked to the source message.
+//
+// What the enrichers derive is also recorded under the worker's enrichment
+// version. When their logic changes, Replay runs stored mail through them
+// again under the new version, so old and new results can be compared.
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+)
+
+// Message is the part of an email.received event enrichers read
+type Message struct {
+	EventID           string            `json:"event_id"`
+	MsgDate           int64             `json:"msg_date"`
+	Provider          string            `json:"provider"`
+	InboxID           string            `json:"inbox_id"`
+	UserID            string            `json:"user_id"`
+	ProviderMessageID string            `json:"provider_message_id"`
+	ProviderThreadID  string            `json:"provider_thread_id"`
+	Subject           string            `json:"subject"`
+	Sender            string            `json:"sender"`
+	To                []string          `json:"to_addrs"`
+	Cc                []string          `json:"cc_addrs"`
+	Snippet           string            `json:"snippet"`
+	Headers           map[string]string `json:"headers"`
+	Kind              string            `json:"kind"`
+	IsList            bool              `json:"is_list"`
+	PayloadRef        string            `json:"payload_ref"` // set when the payload was offloaded to blob storage
+}
+
+// Event is an event an enricher derived from a message. Payload gets the
+// source message's ids added before it is queued.
+type Event struct {
+	Type    string
+	Payload map[string]any
+}
+
+// Func derives events from a message. now is when the worker processes it,
+// so enrichers can skip proposals that are already in the past.
+type Func func(ctx context.Context, msg *Message, now time.Time) ([]Event, error)
+
+var (
+	registry   = map[string]Func{}
+	registryMu sync.RWMutex
+)
+
+// Register makes an enricher available to the worker by name. Registering
+// the same name twice replaces the earlier enricher.
+func Register(name string, fn Func) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = fn
+}
+
+// Registered lists the names of all registered enrichers
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type enricher struct {
+	name string
+	fn   Func
+}
+
+// DefaultVersion labels enrichment outputs unless the worker is given a
+// version
+const DefaultVersion = "1"
+
+// Worker runs enrichers over received mail
+type Worker struct {
+	stores    eventstore.Opener
+	blobs     blob.Store // reads offloaded payloads; nil skips them
+	enrichers []enricher
+	version   string
+}
+
+// New creates a worker running the named enrichers (comma-separated, e.g.
+// the ENRICHERS env var). An empty spec runs every registered enricher.
+// blobs may be nil.
+func New(stores eventstore.Opener, blobs blob.Store, spec string) (*Worker, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = Registered()
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	w := &Worker{stores: stores, blobs: blobs, version: DefaultVersion}
+	for _, name := range names {
+		fn, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown enricher %q", name)
+		}
+		w.enrichers = append(w.enrichers, enricher{name, fn})
+	}
+	return w, nil
+}
+
+// Names returns the enrichers the worker runs, in order
+func (w *Worker) Names() []string {
+	names := make([]string, 0, len(w.enrichers))
+	for _, e := range w.enrichers {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// SetVersion labels the outputs of the worker's enrichers (e.g. the
+// ENRICHMENT_VERSION env var). Change it with their logic.
+func (w *Worker) SetVersion(version string) {
+	w.version = version
+}
+
+// Version returns the label of the worker's outputs
+func (w *Worker) Version() string {
+	return w.version
+}
+
+// Projection returns the projection that feeds the worker received mail.
+// Events derived twice (a redelivery or a rebuild) carry the same Msg-Id, so
+// NATS drops repeats within its deduplication window.
+func (w *Worker) Projection() projection.Projection {
+	return projection.Projection{
+		Name:   "enrich",
+		Events: []string{"email.received"},
+		Apply:  w.apply,
+	}
+}
+
+// apply runs the enrichers on one received message and queues their events
+func (w *Worker) apply(ctx context.Context, ev projection.Event) error {
+	msg, err := w.message(ctx, ev.Data)
+	if err != nil || msg == nil {
+		return err
+	}
+	msg.UserID = ev.UserID
+
+	outputs, out, err := w.derive(ctx, msg, time.Now(), "")
+	if err != nil || len(out) == 0 {
+		return err
+	}
+
+	store, err := w.stores.Open(ev.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.WithTx(ctx, func(tx eventstore.Tx) error {
+		for _, entry := range out {
+			if err := tx.AppendOutbox(ctx, entry); err != nil {
+				return err
+			}
+		}
+		return tx.SaveEnrichmentOutputs(ctx, w.version, msg.EventID, outputs)
+	})
+}
+
+// derive runs the enrichers on a message, returning what they derived as
+// outputs to record and as outbox entries. msgIDSuffix is appended to the
+// entries' message ids.
+func (w *Worker) derive(ctx context.Context, msg *Message, now time.Time, msgIDSuffix string) ([]eventstore.EnrichmentOutput, []eventstore.OutboxEntry, error) {
+	var (
+		outputs []eventstore.EnrichmentOutput
+		out     []eventstore.OutboxEntry
+	)
+	for _, e := range w.enrichers {
+		derived, err := e.fn(ctx, msg, now)
+		if err != nil {
+			return nil, nil, fmt.Errorf("enricher %s: %w", e.name, err)
+		}
+		for i, d := range derived {
+			payload, err := json.Marshal(d.Payload)
+			if err != nil {
+				return nil, nil, fmt.Errorf("encode %s event: %w", d.Type, err)
+			}
+			outputs = append(outputs, eventstore.EnrichmentOutput{
+				Version:           w.version,
+				SourceEventID:     msg.EventID,
+				Provider:          msg.Provider,
+				ProviderMessageID: msg.ProviderMessageID,
+				Enricher:          e.name,
+				EventType:         d.Type,
+				Payload:           payload,
+			})
+
+			msgID := fmt.Sprintf("%s|%s|%s|%d", d.Type, msg.Provider, msg.ProviderMessageID, i) + msgIDSuffix
+			entry, err := outboxEntry(ctx, msg, d, msgID, w.version)
+			if err != nil {
+				return nil, nil, err
+			}
+			out = append(out, entry)
+		}
+	}
+	return outputs, out, nil
+}
+
+// message decodes an event payload, fetching it from blob storage if it was
+// offloaded. Returns nil for payloads that can't be read.
+func (w *Worker) message(ctx context.Context, data []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, nil // not an object; nothing to enrich
+	}
+	if msg.PayloadRef == "" {
+		return &msg, nil
+	}
+	if w.blobs == nil {
+		return nil, nil
+	}
+
+	r, _, err := w.blobs.Get(ctx, msg.PayloadRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payload %s: %w", msg.PayloadRef, err)
+	}
+	defer r.Close()
+	full, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payload %s: %w", msg.PayloadRef, err)
+	}
+	var offloaded Message
+	if err := json.Unmarshal(full, &offloaded); err != nil {
+		return nil, nil
+	}
+	return &offloaded, nil
+}
+
+// outboxEntry links a derived event to its source message and the
+// enrichment version that derived it
+func outboxEntry(ctx context.Context, msg *Message, ev Event, msgID, version string) (eventstore.OutboxEntry, error) {
+	payload := map[string]any{}
+	for k, v := range ev.Payload {
+		payload[k] = v
+	}
+	payload["user_id"] = msg.UserID
+	payload["ts"] = time.Now().Unix()
+	payload["provider"] = msg.Provider
+	payload["inbox_id"] = msg.InboxID
+	payload["source_event_id"] = msg.EventID
+	payload["provider_message_id"] = msg.ProviderMessageID
+	payload["provider_thread_id"] = msg.ProviderThreadID
+	payload["enrichment_version"] = version
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return eventstore.OutboxEntry{}, fmt.Errorf("encode %s event: %w", ev.Type, err)
+	}
+	return eventstore.OutboxEntry{
+		Subject:     fmt.Sprintf("user.%s.%s", msg.UserID, ev.Type),
+		EventType:   ev.Type,
+		Payload:     data,
+		MsgID:       msgID,
+		TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+	}, nil
+}
@@ -0,0 +1,531 @@
+package enrich
+
+import (
+	"context"
+	"html"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventCalendarSuggestion proposes a calendar entry for a meeting found in a
+// message
+const EventCalendarSuggestion = "calendar.suggestion"
+
+const (
+	defaultMeetingLength = 30 * time.Minute
+	maxCandidates        = 5
+	// staleAfter is how old a message without any dated proposal may be and
+	// still be suggested (a conference link alone could be for any day)
+	staleAfter = 7 * 24 * time.Hour
+	// pairDistance is how far apart (in bytes) a date and a time may be to
+	// form one candidate
+	pairDistance = 60
+)
+
+func init() {
+	Register("meetings", detectMeetings)
+}
+
+// Candidate is a proposed time slot
+type Candidate struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	AllDay bool      `json:"all_day"`
+	Text   string    `json:"text"` // the words it was parsed from
+}
+
+// Conference is a video call link
+type Conference struct {
+	Provider string `json:"provider"`
+	URL      string `json:"url"`
+}
+
+var conferenceLinks = []struct {
+	provider string
+	re       *regexp.Regexp
+}{
+	{"zoom", regexp.MustCompile(`https://[\w.-]*zoom\.us/(?:j|my|w)/[\w?=&.%-]+`)},
+	{"google_meet", regexp.MustCompile(`https://meet\.google\.com/[a-z]{3}-[a-z]{4}-[a-z]{3}`)},
+	{"teams", regexp.MustCompile(`https://teams\.microsoft\.com/l/meetup-join/[^\s"'<>]+`)},
+	{"webex", regexp.MustCompile(`https://[\w.-]*webex\.com/(?:meet|join|[\w.-]+/j\.php)[^\s"'<>]*`)},
+	{"whereby", regexp.MustCompile(`https://whereby\.com/[\w-]+`)},
+}
+
+var (
+	meetingIntent = regexp.MustCompile(`(?i)\b(meet|meeting|call|sync|catch[ -]up|chat|interview|demo|invite|invitation|availab(?:le|ility)|schedule|reschedule|calendar|coffee|lunch|appointment|slot)\b`)
+
+	relativeDay = regexp.MustCompile(`(?i)\b(today|tonight|tomorrow)\b`)
+	weekday     = regexp.MustCompile(`\b((?i:next|this)\s+)?((?i:monday|tuesday|wednesday|thursday|friday|saturday|sunday)|Mon|Tue|Tues|Wed|Thu|Thur|Thurs|Fri|Sat|Sun)\b\.?`)
+	monthDay    = regexp.MustCompile(`(?i)\b(` + monthNames + `)\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s+(\d{4})\b)?`)
+	dayMonth    = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?(` + monthNames + `)\b\.?(?:,?\s+(\d{4})\b)?`)
+	isoDate     = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+
+	// 2pm, 2:30 p.m., 2-3pm, 2:30pm to 4pm
+	clockRange = regexp.MustCompile(`(?i)\b(\d{1,2})(?::([0-5]\d))?\s*(am\b|pm\b|a\.m\.|p\.m\.)?\s*(?:-|–|to|until)\s*(\d{1,2})(?::([0-5]\d))?\s*(am\b|pm\b|a\.m\.|p\.m\.)`)
+	clock12    = regexp.MustCompile(`(?i)\b(\d{1,2})(?::([0-5]\d))?\s*(am\b|pm\b|a\.m\.|p\.m\.)`)
+	// 14:00, 14:00-15:30
+	clock24 = regexp.MustCompile(`\b([01]?\d|2[0-3]):([0-5]\d)\b(?:\s*(?:-|–|to)\s*([01]?\d|2[0-3]):([0-5]\d)\b)?`)
+	noon    = regexp.MustCompile(`(?i)\b(noon|midday)\b`)
+
+	duration = regexp.MustCompile(`(?i)\b(\d{1,3}|an?|half an)\s*-?\s*(hours?|hrs?|minutes?|mins?)\b`)
+	zoneAbbr = regexp.MustCompile(`\b(UTC|GMT|EST|EDT|ET|CST|CDT|CT|MST|MDT|MT|PST|PDT|PT|BST|CET|CEST)\b`)
+)
+
+const monthNames = `jan|january|feb|february|mar|march|apr|april|may|jun|june|jul|july|aug|august|sep|sept|september|oct|october|nov|november|dec|december`
+
+// zoneOffsets are the UTC offsets (hours) of common time zone abbreviations
+var zoneOffsets = map[string]int{
+	"UTC": 0, "GMT": 0,
+	"EST": -5, "EDT": -4, "ET": -5,
+	"CST": -6, "CDT": -5, "CT": -6,
+	"MST": -7, "MDT": -6, "MT": -7,
+	"PST": -8, "PDT": -7, "PT": -8,
+	"BST": 1, "CET": 1, "CEST": 2,
+}
+
+// genericZones follow daylight saving where the zone database is available;
+// otherwise they fall back to standard time
+var genericZones = map[string]string{
+	"ET": "America/New_York",
+	"CT": "America/Chicago",
+	"MT": "America/Denver",
+	"PT": "America/Los_Angeles",
+}
+
+// detectMeetings finds meeting proposals (times, attendees, conference
+// links) in a message's subject and snippet. Messages with candidate times
+// need wording that suggests a meeting; a conference link is enough on its
+// own.
+func detectMeetings(_ context.Context, msg *Message, now time.Time) ([]Event, error) {
+	if msg.IsList {
+		return nil, nil
+	}
+	text := html.UnescapeString(msg.Subject + "\n" + msg.Snippet)
+
+	conf := findConference(text)
+	intent := meetingIntent.MatchString(text)
+	if conf == nil && !intent {
+		return nil, nil
+	}
+
+	ref := referenceTime(msg)
+	all := findCandidates(text, ref)
+	candidates := []Candidate{}
+	for _, c := range all {
+		if c.End.After(now) {
+			candidates = append(candidates, c)
+		}
+	}
+	switch {
+	case len(candidates) > 0:
+	case len(all) > 0:
+		return nil, nil // every proposed time has passed
+	case conf == nil || now.Sub(ref) > staleAfter:
+		return nil, nil
+	}
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+
+	payload := map[string]any{
+		"title":      meetingTitle(msg.Subject),
+		"candidates": candidates,
+		"attendees":  attendees(msg),
+	}
+	if conf != nil {
+		payload["conference"] = conf
+	}
+	return []Event{{Type: EventCalendarSuggestion, Payload: payload}}, nil
+}
+
+// findConference returns the first video call link in text
+func findConference(text string) *Conference {
+	for _, link := range conferenceLinks {
+		if url := link.re.FindString(text); url != "" {
+			return &Conference{Provider: link.provider, URL: url}
+		}
+	}
+	return nil
+}
+
+// referenceTime is when the message was written, in the sender's zone (from
+// the Date header) so "tomorrow at 3pm" means their 3pm
+func referenceTime(msg *Message) time.Time {
+	ref := time.Unix(msg.MsgDate, 0).UTC()
+	if date, err := mail.ParseDate(msg.Header("Date")); err == nil {
+		ref = ref.In(date.Location())
+	}
+	return ref
+}
+
+// Header returns a header value, matching the name case-insensitively
+func (m *Message) Header(name string) string {
+	if v, ok := m.Headers[name]; ok {
+		return v
+	}
+	for k, v := range m.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+type mention struct {
+	start, end int
+	text       string
+}
+
+type dateMention struct {
+	mention
+	date time.Time // midnight in the reference zone
+}
+
+type clockMention struct {
+	mention
+	from, to time.Duration // since midnight; to is 0 when no end was given
+}
+
+// findCandidates parses the dates and times in text into slots. Each time is
+// paired with the nearest date (or the next time that clock comes round
+// after ref); dates without a time become all-day candidates.
+func findCandidates(text string, ref time.Time) []Candidate {
+	loc := ref.Location()
+	if m := zoneAbbr.FindString(text); m != "" {
+		loc = time.FixedZone(m, zoneOffsets[m]*3600)
+		if name, ok := genericZones[m]; ok {
+			if l, err := time.LoadLocation(name); err == nil {
+				loc = l
+			}
+		}
+	}
+	ref = ref.In(loc)
+	length := meetingLength(text)
+
+	dates := findDates(text, ref)
+	clocks := findClocks(text)
+
+	var candidates []Candidate
+	paired := make(map[int]bool)
+	for _, c := range clocks {
+		day, i := nearestDate(dates, c.mention)
+		text := c.text
+		if i >= 0 {
+			paired[i] = true
+			text = dates[i].text + " " + c.text
+		} else {
+			day = midnight(ref)
+			if ref.Sub(day) >= c.from {
+				day = day.AddDate(0, 0, 1)
+			}
+		}
+		start := day.Add(c.from)
+		end := start.Add(length)
+		if c.to > c.from {
+			end = day.Add(c.to)
+		}
+		candidates = append(candidates, Candidate{Start: start, End: end, Text: text})
+	}
+	for i, d := range dates {
+		if !paired[i] {
+			candidates = append(candidates, Candidate{Start: d.date, End: d.date.AddDate(0, 0, 1), AllDay: true, Text: d.text})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Start.Before(candidates[j].Start) })
+	unique := candidates[:0]
+	for i, c := range candidates {
+		if i == 0 || !c.Start.Equal(candidates[i-1].Start) || c.AllDay != candidates[i-1].AllDay {
+			unique = append(unique, c)
+		}
+	}
+	return unique
+}
+
+// findDates returns the calendar dates mentioned in text, in order
+func findDates(text string, ref time.Time) []dateMention {
+	today := midnight(ref)
+	var dates []dateMention
+	add := func(loc []int, date time.Time) {
+		dates = append(dates, dateMention{mention{loc[0], loc[1], text[loc[0]:loc[1]]}, date})
+	}
+
+	for _, m := range relativeDay.FindAllStringSubmatchIndex(text, -1) {
+		switch strings.ToLower(text[m[2]:m[3]]) {
+		case "today", "tonight":
+			add(m, today)
+		case "tomorrow":
+			add(m, today.AddDate(0, 0, 1))
+		}
+	}
+	for _, m := range weekday.FindAllStringSubmatchIndex(text, -1) {
+		want, ok := parseWeekday(text[m[4]:m[5]])
+		if !ok {
+			continue
+		}
+		days := (int(want) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7 // "Tuesday" written on a Tuesday means next week
+		}
+		add(m, today.AddDate(0, 0, days))
+	}
+	for _, m := range monthDay.FindAllStringSubmatchIndex(text, -1) {
+		if date, ok := calendarDate(text, m, 2, 4, 6, today); ok {
+			add(m, date)
+		}
+	}
+	for _, m := range dayMonth.FindAllStringSubmatchIndex(text, -1) {
+		if date, ok := calendarDate(text, m, 4, 2, 6, today); ok {
+			add(m, date)
+		}
+	}
+	for _, m := range isoDate.FindAllStringSubmatchIndex(text, -1) {
+		y, _ := strconv.Atoi(text[m[2]:m[3]])
+		mo, _ := strconv.Atoi(text[m[4]:m[5]])
+		d, _ := strconv.Atoi(text[m[6]:m[7]])
+		date := time.Date(y, time.Month(mo), d, 0, 0, 0, 0, today.Location())
+		if mo >= 1 && mo <= 12 && date.Day() == d {
+			add(m, date)
+		}
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].start < dates[j].start })
+	return dates
+}
+
+// calendarDate builds a date from the month, day and optional year groups of
+// a match. Without a year it is the next such date on or after today, within
+// reason (a date a few days back is still this year's).
+func calendarDate(text string, m []int, monthGroup, dayGroup, yearGroup int, today time.Time) (time.Time, bool) {
+	month := parseMonth(text[m[monthGroup]:m[monthGroup+1]])
+	day, _ := strconv.Atoi(text[m[dayGroup]:m[dayGroup+1]])
+	year := today.Year()
+	explicit := m[yearGroup] >= 0
+	if explicit {
+		year, _ = strconv.Atoi(text[m[yearGroup]:m[yearGroup+1]])
+	}
+
+	date := time.Date(year, month, day, 0, 0, 0, 0, today.Location())
+	if month == 0 || day < 1 || date.Day() != day {
+		return time.Time{}, false
+	}
+	if !explicit && today.Sub(date) > 30*24*time.Hour {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, true
+}
+
+// findClocks returns the times of day mentioned in text, in order. A range
+// (2-3pm) is one mention.
+func findClocks(text string) []clockMention {
+	var clocks []clockMention
+	taken := func(start, end int) bool {
+		for _, c := range clocks {
+			if start < c.end && end > c.start {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(start, end int, from, to time.Duration) {
+		if !taken(start, end) {
+			clocks = append(clocks, clockMention{mention{start, end, text[start:end]}, from, to})
+		}
+	}
+	group := func(m []int, i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return text[m[2*i]:m[2*i+1]]
+	}
+
+	for _, m := range clockRange.FindAllStringSubmatchIndex(text, -1) {
+		toMeridiem := group(m, 6)
+		fromMeridiem := group(m, 3)
+		if fromMeridiem == "" {
+			fromMeridiem = toMeridiem
+		}
+		from, ok1 := clock(group(m, 1), group(m, 2), fromMeridiem)
+		to, ok2 := clock(group(m, 4), group(m, 5), toMeridiem)
+		if !ok1 || !ok2 {
+			continue
+		}
+		if to <= from && group(m, 3) == "" {
+			// 11-1pm: the start is in the morning
+			from, ok1 = clock(group(m, 1), group(m, 2), "am")
+		}
+		if ok1 && to > from {
+			add(m[0], m[1], from, to)
+		}
+	}
+	for _, m := range clock12.FindAllStringSubmatchIndex(text, -1) {
+		if from, ok := clock(group(m, 1), group(m, 2), group(m, 3)); ok {
+			add(m[0], m[1], from, 0)
+		}
+	}
+	for _, m := range clock24.FindAllStringSubmatchIndex(text, -1) {
+		from, _ := clock(group(m, 1), group(m, 2), "")
+		var to time.Duration
+		if group(m, 3) != "" {
+			to, _ = clock(group(m, 3), group(m, 4), "")
+		}
+		// "3:30" in a message means the afternoon
+		if hour := group(m, 1); len(hour) == 1 && from >= time.Hour && from < 8*time.Hour {
+			from += 12 * time.Hour
+			if to > 0 && to < 12*time.Hour {
+				to += 12 * time.Hour
+			}
+		}
+		add(m[0], m[1], from, to)
+	}
+	for _, m := range noon.FindAllStringIndex(text, -1) {
+		add(m[0], m[1], 12*time.Hour, 0)
+	}
+
+	sort.Slice(clocks, func(i, j int) bool { return clocks[i].start < clocks[j].start })
+	return clocks
+}
+
+// clock converts an hour, optional minutes and optional am/pm to a time of
+// day
+func clock(hour, minute, meridiem string) (time.Duration, bool) {
+	h, err := strconv.Atoi(hour)
+	if err != nil {
+		return 0, false
+	}
+	m, _ := strconv.Atoi(minute)
+	switch strings.ToLower(strings.ReplaceAll(meridiem, ".", "")) {
+	case "am":
+		if h < 1 || h > 12 {
+			return 0, false
+		}
+		h %= 12
+	case "pm":
+		if h < 1 || h > 12 {
+			return 0, false
+		}
+		h = h%12 + 12
+	default:
+		if h > 23 {
+			return 0, false
+		}
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, true
+}
+
+// nearestDate returns the date mentioned closest to a time, if one is within
+// pairDistance, else the last date mentioned before it
+func nearestDate(dates []dateMention, c mention) (time.Time, int) {
+	best, bestDist := -1, pairDistance+1
+	last := -1
+	for i, d := range dates {
+		dist := c.start - d.end
+		if d.start >= c.end {
+			dist = d.start - c.end
+		} else {
+			last = i
+		}
+		if dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	if best < 0 {
+		best = last
+	}
+	if best < 0 {
+		return time.Time{}, -1
+	}
+	return dates[best].date, best
+}
+
+// meetingLength is the duration the text mentions (30 minutes, an hour),
+// defaultMeetingLength without one
+func meetingLength(text string) time.Duration {
+	m := duration.FindStringSubmatch(text)
+	if m == nil {
+		return defaultMeetingLength
+	}
+	unit := time.Minute
+	if strings.HasPrefix(strings.ToLower(m[2]), "h") {
+		unit = time.Hour
+	}
+	switch n := strings.ToLower(m[1]); n {
+	case "a", "an":
+		return unit
+	case "half an":
+		return unit / 2
+	default:
+		v, _ := strconv.Atoi(n)
+		if d := time.Duration(v) * unit; d > 0 && d <= 12*time.Hour {
+			return d
+		}
+		return defaultMeetingLength
+	}
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.HasPrefix(strings.ToLower(d.String()), s[:3]) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func parseMonth(s string) time.Month {
+	s = strings.ToLower(s)
+	for m := time.January; m <= time.December; m++ {
+		if strings.HasPrefix(strings.ToLower(m.String()), s[:3]) {
+			return m
+		}
+	}
+	return 0
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// meetingTitle strips reply and forward prefixes from a subject
+func meetingTitle(subject string) string {
+	for {
+		trimmed := strings.TrimSpace(subject)
+		lower := strings.ToLower(trimmed)
+		cut := false
+		for _, p := range []string{"re:", "fw:", "fwd:", "aw:"} {
+			if strings.HasPrefix(lower, p) {
+				trimmed, cut = trimmed[len(p):], true
+				break
+			}
+		}
+		if !cut {
+			return trimmed
+		}
+		subject = trimmed
+	}
+}
+
+// attendees returns the sender's and recipients' addresses, lowercased and
+// without duplicates
+func attendees(msg *Message) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, list := range [][]string{{msg.Sender}, msg.To, msg.Cc} {
+		for _, a := range list {
+			if parsed, err := mail.ParseAddress(a); err == nil {
+				a = parsed.Address
+			}
+			a = strings.ToLower(strings.TrimSpace(a))
+			if a != "" && !seen[a] {
+				seen[a] = true
+				out = append(out, a)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+package enrich
+
+import (
+	"context"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// replayBatch is how many stored messages Replay derives from per transaction
+const replayBatch = 200
+
+// StartReplay begins re-enriching a user's stored mail with the worker's
+// version, from the first message, replacing an earlier run of that version.
+// With publish the derived events are queued like live ones (under message
+// ids of their own, so NATS doesn't drop them as repeats); otherwise they are
+// only recorded for comparison.
+func (w *Worker) StartReplay(ctx context.Context, userID string, publish bool) error {
+	store, err := w.stores.Open(userID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.SaveEnrichmentRun(ctx, &eventstore.EnrichmentRun{
+		Version: w.version,
+		Status:  eventstore.BackfillRunning,
+		Publish: publish,
+	})
+}
+
+// Replay continues a user's re-enrichment for about slice and returns true
+// once every stored message was replayed. Messages are replayed as of when
+// they were stored, so enrichers skip what they skipped then; provider data
+// isn't fetched again.
+func (w *Worker) Replay(ctx context.Context, userID string, slice time.Duration) (bool, error) {
+	store, err := w.stores.Open(userID)
+	if err != nil {
+		return false, err
+	}
+	defer store.Close()
+
+	run, err := store.LoadEnrichmentRun(ctx, w.version)
+	if err != nil {
+		return false, err
+	}
+	if run == nil || run.Status == eventstore.BackfillDone {
+		return true, nil
+	}
+
+	deadline := time.Now().Add(slice)
+	for {
+		sources, err := store.EnrichmentSources(ctx, run.Cursor, replayBatch)
+		if err != nil {
+			return false, err
+		}
+		if len(sources) == 0 {
+			run.Status, run.LastError, run.FinishedAt = eventstore.BackfillDone, "", time.Now().Unix()
+			return true, store.SaveEnrichmentRun(ctx, run)
+		}
+
+		if err := w.replay(ctx, store, userID, sources, run); err != nil {
+			run.LastError = err.Error()
+			if saveErr := store.SaveEnrichmentRun(ctx, run); saveErr != nil {
+				return false, saveErr
+			}
+			return false, err
+		}
+		run.Cursor, run.LastError = sources[len(sources)-1].Seq, ""
+		if err := store.SaveEnrichmentRun(ctx, run); err != nil {
+			return false, err
+		}
+
+		if !time.Now().Before(deadline) {
+			return false, nil
+		}
+	}
+}
+
+// replay derives from one batch of stored messages and records the outputs
+// (queueing the events when the run publishes) in one transaction
+func (w *Worker) replay(ctx context.Context, store eventstore.Store, userID string, sources []eventstore.EnrichmentSource, run *eventstore.EnrichmentRun) error {
+	type derivation struct {
+		eventID string
+		outputs []eventstore.EnrichmentOutput
+		out     []eventstore.OutboxEntry
+	}
+	derived := make([]derivation, 0, len(sources))
+	for _, src := range sources {
+		msg := sourceMessage(src, userID)
+		outputs, out, err := w.derive(ctx, msg, time.Unix(src.TS, 0), "|"+w.version)
+		if err != nil {
+			return err
+		}
+		derived = append(derived, derivation{src.EventID, outputs, out})
+	}
+
+	err := store.WithTx(ctx, func(tx eventstore.Tx) error {
+		for _, d := range derived {
+			if run.Publish {
+				for _, entry := range d.out {
+					if err := tx.AppendOutbox(ctx, entry); err != nil {
+						return err
+					}
+				}
+			}
+			if err := tx.SaveEnrichmentOutputs(ctx, w.version, d.eventID, d.outputs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	run.Processed += int64(len(derived))
+	for _, d := range derived {
+		run.Derived += int64(len(d.outputs))
+	}
+	return nil
+}
+
+// sourceMessage is a stored message as the enrichers see it
+func sourceMessage(src eventstore.EnrichmentSource, userID string) *Message {
+	return &Message{
+		EventID:           src.EventID,
+		MsgDate:           src.MsgDate,
+		Provider:          src.Provider,
+		InboxID:           src.InboxID,
+		UserID:            userID,
+		ProviderMessageID: src.ProviderMessageID,
+		ProviderThreadID:  src.ProviderThreadID,
+		Subject:           src.Subject,
+		Sender:            src.Sender,
+		To:                src.To,
+		Cc:                src.Cc,
+		Snippet:           src.Snippet,
+		Headers:           src.Headers,
+		Kind:              src.Kind,
+		IsList:            src.IsList,
+	}
+}
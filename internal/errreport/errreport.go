@@ -0,0 +1,132 @@
+// Package errreport forwards unexpected failures (runner errors, panics, 5xx
+// responses) to an external error tracker. Reporters never block the caller:
+// reports are queued and dropped if the tracker can't keep up.
+package errreport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sources of reported errors
+const (
+	SourceRunner = "runner"
+	SourcePanic  = "panic"
+	SourceHTTP   = "http"
+	SourceOutbox = "outbox" // publishes the stream lost (see sync.PublishVerifier)
+)
+
+// Event is a single error report
+type Event struct {
+	Source   string            // SourceRunner, SourcePanic, SourceHTTP or SourceOutbox
+	Err      error             // the failure; required
+	UserID   string            // affected user, if any
+	Provider string            // mail provider, if any
+	Tags     map[string]string // extra searchable context (route, status, ...)
+	Stack    []byte            // goroutine stack for panics
+	Time     time.Time         // defaults to now
+	TraceID  string            // filled from ctx by Report
+}
+
+// Reporter receives error reports
+type Reporter interface {
+	Report(ctx context.Context, ev Event)
+}
+
+// Nop discards every report
+type Nop struct{}
+
+// Report implements Reporter
+func (Nop) Report(context.Context, Event) {}
+
+// multi fans a report out to several reporters
+type multi []Reporter
+
+func (m multi) Report(ctx context.Context, ev Event) {
+	for _, r := range m {
+		r.Report(ctx, ev)
+	}
+}
+
+// Multi returns a Reporter that forwards to every non-nil reporter
+func Multi(reporters ...Reporter) Reporter {
+	var m multi
+	for _, r := range reporters {
+		if r != nil {
+			m = append(m, r)
+		}
+	}
+	switch len(m) {
+	case 0:
+		return Nop{}
+	case 1:
+		return m[0]
+	}
+	return m
+}
+
+// Report sends ev to r, filling in the time and the trace id from ctx.
+// Recovered panics (*PanicError) are reported as SourcePanic with their
+// stack. It is a no-op for a nil reporter or error, so callers don't need to
+// check either.
+func Report(ctx context.Context, r Reporter, ev Event) {
+	if r == nil || ev.Err == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	var pe *PanicError
+	if errors.As(ev.Err, &pe) {
+		ev.Source = SourcePanic
+		if ev.Stack == nil {
+			ev.Stack = pe.Stack
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() && ev.TraceID == "" {
+		ev.TraceID = sc.TraceID().String()
+	}
+	r.Report(ctx, ev)
+}
+
+// Publisher publishes fire-and-forget messages (implemented by the NATS
+// publisher)
+type Publisher interface {
+	PublishCore(ctx context.Context, subject string, payload []byte) error
+}
+
+// FromEnv configures reporters from ERROR_REPORTERS, a comma-separated list
+// of "sentry" (SENTRY_DSN, SENTRY_ENVIRONMENT, SENTRY_RELEASE) and "nats"
+// (ERROR_REPORT_SUBJECT, default ops.errors). Returns Nop if unset.
+func FromEnv(pub Publisher) (Reporter, error) {
+	var reporters []Reporter
+	for _, name := range strings.Split(os.Getenv("ERROR_REPORTERS"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "sentry":
+			s, err := NewSentry(os.Getenv("SENTRY_DSN"), os.Getenv("SENTRY_ENVIRONMENT"), os.Getenv("SENTRY_RELEASE"))
+			if err != nil {
+				return nil, err
+			}
+			reporters = append(reporters, s)
+		case "nats":
+			if pub == nil {
+				return nil, fmt.Errorf("nats error reporter requires a NATS connection")
+			}
+			subject := os.Getenv("ERROR_REPORT_SUBJECT")
+			if subject == "" {
+				subject = DefaultSubject
+			}
+			reporters = append(reporters, NewNATS(pub, subject))
+		default:
+			return nil, fmt.Errorf("unknown error reporter %q (want sentry or nats)", name)
+		}
+	}
+	return Multi(reporters...), nil
+}
@@ -0,0 +1,60 @@
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultSubject is the NATS subject error reports are published to
+const DefaultSubject = "ops.errors"
+
+// NATS publishes reports as JSON on a plain NATS subject (not JetStream), so
+// reporting never competes with user events for stream storage
+type NATS struct {
+	pub      Publisher
+	subject  string
+	hostname string
+}
+
+// NewNATS creates a reporter publishing to subject
+func NewNATS(pub Publisher, subject string) *NATS {
+	hostname, _ := os.Hostname()
+	return &NATS{pub: pub, subject: subject, hostname: hostname}
+}
+
+// natsReport is the message published for each report
+type natsReport struct {
+	Source   string            `json:"source"`
+	Error    string            `json:"error"`
+	UserID   string            `json:"user_id,omitempty"`
+	Provider string            `json:"provider,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Stack    string            `json:"stack,omitempty"`
+	TraceID  string            `json:"trace_id,omitempty"`
+	Host     string            `json:"host,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// Report implements Reporter
+func (n *NATS) Report(ctx context.Context, ev Event) {
+	payload, err := json.Marshal(natsReport{
+		Source:   ev.Source,
+		Error:    ev.Err.Error(),
+		UserID:   ev.UserID,
+		Provider: ev.Provider,
+		Tags:     ev.Tags,
+		Stack:    string(ev.Stack),
+		TraceID:  ev.TraceID,
+		Host:     n.hostname,
+		Time:     ev.Time,
+	})
+	if err != nil {
+		return
+	}
+	if err := n.pub.PublishCore(ctx, n.subject, payload); err != nil {
+		log.Printf("errreport: nats: %v", err)
+	}
+}
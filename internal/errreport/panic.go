@@ -0,0 +1,28 @@
+package errreport
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is a recovered panic with the stack of the goroutine that
+// panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Catch runs fn and returns a *PanicError if it panics, so one bad message or
+// provider response can't take the whole process down
+func Catch(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,172 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sentryQueueSize bounds reports waiting to be sent; more are dropped
+const sentryQueueSize = 256
+
+// Sentry sends reports to a Sentry-compatible store endpoint (Sentry,
+// GlitchTip, self-hosted) over HTTP
+type Sentry struct {
+	endpoint    string
+	authHeader  string
+	environment string
+	release     string
+	serverName  string
+	client      *http.Client
+	queue       chan sentryEvent
+}
+
+// NewSentry creates a reporter for dsn
+// (https://<public_key>@<host>[/<path>]/<project_id>) and starts its sender
+func NewSentry(dsn, environment, release string) (*Sentry, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("SENTRY_DSN is required for the sentry error reporter")
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN")
+	}
+	path := strings.Trim(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	project := path[idx+1:]
+	if project == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: missing project id")
+	}
+	prefix := ""
+	if idx >= 0 {
+		prefix = "/" + path[:idx]
+	}
+
+	hostname, _ := os.Hostname()
+	s := &Sentry{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		authHeader:  fmt.Sprintf("Sentry sentry_version=7, sentry_client=ai-brain-infra/1.0, sentry_key=%s", u.User.Username()),
+		environment: environment,
+		release:     release,
+		serverName:  hostname,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan sentryEvent, sentryQueueSize),
+	}
+	go s.run()
+	return s, nil
+}
+
+// sentryEvent is the subset of the Sentry event payload we send
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Message     string            `json:"message"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        map[string]string `json:"user,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Report implements Reporter
+func (s *Sentry) Report(_ context.Context, ev Event) {
+	level := "error"
+	if ev.Source == SourcePanic {
+		level = "fatal"
+	}
+
+	tags := map[string]string{"source": ev.Source}
+	for k, v := range ev.Tags {
+		tags[k] = v
+	}
+	if ev.Provider != "" {
+		tags["provider"] = ev.Provider
+	}
+	if ev.TraceID != "" {
+		tags["trace_id"] = ev.TraceID
+	}
+
+	out := sentryEvent{
+		EventID:     strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Timestamp:   ev.Time.UTC().Format(time.RFC3339),
+		Platform:    "go",
+		Level:       level,
+		Logger:      ev.Source,
+		ServerName:  s.serverName,
+		Environment: s.environment,
+		Release:     s.release,
+		Message:     ev.Err.Error(),
+		Exception: &sentryExceptions{Values: []sentryException{{
+			Type:  fmt.Sprintf("%T", ev.Err),
+			Value: ev.Err.Error(),
+		}}},
+		Tags: tags,
+	}
+	if ev.UserID != "" {
+		out.User = map[string]string{"id": ev.UserID}
+	}
+	if len(ev.Stack) > 0 {
+		out.Extra = map[string]string{"stack": string(ev.Stack)}
+	}
+
+	select {
+	case s.queue <- out:
+	default:
+		log.Printf("errreport: sentry queue full, dropping report: %v", ev.Err)
+	}
+}
+
+// run sends queued events one at a time
+func (s *Sentry) run() {
+	for ev := range s.queue {
+		if err := s.send(ev); err != nil {
+			log.Printf("errreport: sentry: %v", err)
+		}
+	}
+}
+
+func (s *Sentry) send(ev sentryEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.authHeader)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("store endpoint returned %s", resp.Status)
+	}
+	return nil
+}
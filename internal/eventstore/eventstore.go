@@ -0,0 +1,554 @@
+// Package eventstore defines the storage contract for mail events, the
+// transactional outbox and sync state. The SQLite backend in
+// internal/eventstore/sqlite implements it; the sync runner and HTTP handlers
+// only depend on these interfaces so other backends (or test fakes) can be
+// swapped in.
+package eventstore
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+)
+
+// Store is a user's event store. Every operation is scoped to the user the
+// store was opened for.
+type Store interface {
+	Outbox
+	Checkpoints
+	Folders
+	Query
+	DebugFlags
+	Workflows
+	Archive
+	FollowUpState
+	TaskSinks
+	Embeddings
+	Calendar
+	Enrichments
+	Translations
+	Attachments
+	SubscriptionState
+	SenderRules
+	Quarantine
+	Events
+
+	// WithTx runs fn in a transaction, committing if it returns nil and
+	// rolling back otherwise
+	WithTx(ctx context.Context, fn func(Tx) error) error
+
+	// PurgeInbox deletes everything stored for one of a provider's inboxes
+	// and returns the number of events removed
+	PurgeInbox(ctx context.Context, provider, inboxID string) (int64, error)
+
+	// ExpireEvents deletes events of eventType stored before before (unix
+	// seconds) and returns how many were removed. Mail event types expire
+	// stored messages of that kind; other types expire generic events.
+	ExpireEvents(ctx context.Context, eventType string, before int64) (int64, error)
+
+	// Backup writes a consistent copy of the user's database to path (per-user
+	// storage only)
+	Backup(ctx context.Context, path string) error
+
+	// UserID returns the user the store is scoped to
+	UserID() string
+
+	// Close releases the store
+	Close() error
+}
+
+// Tx writes events, message state changes and outbox entries atomically
+type Tx interface {
+	// AppendEmailReceived stores an email event and queues its outbox entry.
+	// Returns false (and queues nothing) if the message was already stored.
+	AppendEmailReceived(ctx context.Context, ev EmailEvent, out OutboxEntry) (bool, error)
+
+	// AppendOutbox queues an event for publishing
+	AppendOutbox(ctx context.Context, out OutboxEntry) error
+
+	// AppendEvent stores a generic event of eventType with data, like
+	// Events.StoreEvent, so its outbox entry can be queued with it
+	AppendEvent(ctx context.Context, eventType, data string) (*Event, error)
+
+	// MarkFollowUpNotified records that followup.due was published for the
+	// user's last message in a thread
+	MarkFollowUpNotified(ctx context.Context, provider, threadID, messageID string, at int64) error
+
+	// SaveContactScore stores a contact's relationship score
+	SaveContactScore(ctx context.Context, score ContactScore) error
+
+	// SuggestUnsubscribe records a suggestion to leave a list, returning
+	// false if the list was suggested (or dismissed) before
+	SuggestUnsubscribe(ctx context.Context, s UnsubscribeSuggestion) (bool, error)
+
+	// AddAttachment records an attachment of a message stored in the same
+	// transaction
+	AddAttachment(ctx context.Context, a Attachment) error
+
+	// EnrichContact records signature details for a stored contact and
+	// returns the fields whose current value changed
+	EnrichContact(ctx context.Context, e ContactEnrichment) (changed []string, err error)
+
+	// SaveCalendarSuggestion stores a meeting proposal, like
+	// Calendar.SaveCalendarSuggestion
+	SaveCalendarSuggestion(ctx context.Context, s CalendarSuggestion) error
+
+	// MergeContacts merges m.Merged into m.Primary, normalizing the
+	// addresses and setting m.MergedAt. Both sides must be stored contacts.
+	MergeContacts(ctx context.Context, m *ContactMerge) error
+
+	// UndoContactMerge splits a merge's addresses out of its primary contact
+	UndoContactMerge(ctx context.Context, id string) (*ContactMerge, error)
+
+	// SaveEnrichmentOutputs replaces what a version's enrichers derived from
+	// a message; none clears it
+	SaveEnrichmentOutputs(ctx context.Context, version, sourceEventID string, outputs []EnrichmentOutput) error
+
+	// UpdateTaskDelivery saves a delivery's status, attempts, external task
+	// and last error
+	UpdateTaskDelivery(ctx context.Context, d *TaskDelivery) error
+
+	// UpdateMessageLabels replaces a message's labels (and folder, if set).
+	// known is false if the message isn't stored.
+	UpdateMessageLabels(ctx context.Context, provider, providerMessageID, labelsJSON, folder string) (known bool, err error)
+
+	// MarkMessageDeleted soft-deletes a message
+	MarkMessageDeleted(ctx context.Context, provider, providerMessageID string, deletedAt int64) (known bool, err error)
+
+	// MoveMessage re-keys a message whose provider id changed with its folder
+	MoveMessage(ctx context.Context, provider, oldMessageID, newMessageID, folder string) (known bool, err error)
+
+	// UpdateMessageState stores new read/flag state (nil leaves a value
+	// unchanged) and returns the previous state
+	UpdateMessageState(ctx context.Context, provider, providerMessageID string, isRead, isFlagged *bool) (prev MessageState, known bool, err error)
+}
+
+// Outbox is the publishing side of the transactional outbox
+type Outbox interface {
+	// DequeueOutbox returns up to limit unpublished messages that are ready
+	DequeueOutbox(ctx context.Context, limit int) ([]OutboxMessage, error)
+
+	// MarkPublished marks a message as published, recording the stream and
+	// sequence JetStream acknowledged it with (empty and 0 if unknown)
+	MarkPublished(ctx context.Context, id int64, stream string, seq uint64) error
+
+	// SamplePublished returns up to limit random messages published at or
+	// after since (unix seconds) with a known stream sequence
+	SamplePublished(ctx context.Context, since int64, limit int) ([]PublishedMessage, error)
+
+	// MarkOutboxRetry records a failed publish and schedules the message for
+	// another attempt after backoff
+	MarkOutboxRetry(ctx context.Context, id int64, backoff time.Duration, lastError string) error
+}
+
+// Checkpoints tracks provider sync cursors and status
+type Checkpoints interface {
+	LoadCheckpoint(ctx context.Context, provider string) (string, error)
+	SaveCheckpoint(ctx context.Context, provider, inboxID, cursor, status string) error
+	// UpdateSyncStatus records a status change; errorCode classifies errorMsg
+	// for the user (see sync.ErrorCode) and is cleared once the sync is HOOKED
+	UpdateSyncStatus(ctx context.Context, provider, status, errorCode, errorMsg string) error
+
+	// SaveSyncLag records the latest freshness measurement for a provider
+	SaveSyncLag(ctx context.Context, provider string, lag SyncLag) error
+
+	// SaveHeartbeat records a runner's liveness
+	SaveHeartbeat(ctx context.Context, hb Heartbeat) error
+}
+
+// DebugFlags holds the per-user verbose debug switch read by sync runners
+type DebugFlags interface {
+	// LoadDebugMode returns the user's debug mode, nil if it is off or expired
+	LoadDebugMode(ctx context.Context) (*DebugMode, error)
+
+	// SaveDebugMode turns debug mode on with the given settings, or off if
+	// mode is nil
+	SaveDebugMode(ctx context.Context, mode *DebugMode) error
+}
+
+// Workflows persists multi-step workflow instances
+type Workflows interface {
+	// CreateWorkflow stores a new instance. It returns false and stores
+	// nothing if an instance with the same non-empty TriggerKey exists.
+	CreateWorkflow(ctx context.Context, wf *Workflow) (bool, error)
+
+	// UpdateWorkflow saves an instance's status, step, state and wait if it
+	// is still at fromStatus and fromStep, returning false if another update
+	// got there first
+	UpdateWorkflow(ctx context.Context, wf *Workflow, fromStatus string, fromStep int) (bool, error)
+
+	// WaitingWorkflows returns the instances waiting for an event type
+	WaitingWorkflows(ctx context.Context, eventType string) ([]Workflow, error)
+}
+
+// FollowUpState records the user's decisions on threads awaiting a reply.
+// Each applies to the user's last message in the thread (messageID), so
+// sending another one starts the thread over.
+type FollowUpState interface {
+	// SnoozeFollowUp hides a follow-up until until (unix seconds)
+	SnoozeFollowUp(ctx context.Context, provider, threadID, messageID string, until int64) error
+
+	// DismissFollowUp hides a follow-up for good
+	DismissFollowUp(ctx context.Context, provider, threadID, messageID string) error
+}
+
+// SubscriptionState records the user's decisions on unsubscribe suggestions
+// (see internal/unsubscribe)
+type SubscriptionState interface {
+	// SetUnsubscribeStatus marks a list dismissed or unsubscribed (s.Status,
+	// with s.Method), creating its row from s if it was never suggested
+	SetUnsubscribeStatus(ctx context.Context, s UnsubscribeSuggestion) error
+}
+
+// SenderRules stores the user's rules for which received mail is synced (see
+// internal/sync)
+type SenderRules interface {
+	// AddSenderRule stores a rule, setting its creation time
+	AddSenderRule(ctx context.Context, rule *SenderRule) error
+
+	// DeleteSenderRule removes a rule, returning false if it didn't exist
+	DeleteSenderRule(ctx context.Context, id string) (bool, error)
+}
+
+// Quarantine holds received messages the sync pipeline couldn't ingest (see
+// internal/sync)
+type Quarantine interface {
+	// QuarantineMessage holds a message back. A message already held is
+	// updated with the new reason, counted and made pending again.
+	QuarantineMessage(ctx context.Context, q *QuarantinedMessage) error
+
+	// RequeuedMessages returns up to limit of a provider's requeued
+	// messages, oldest first
+	RequeuedMessages(ctx context.Context, provider string, limit int) ([]QuarantinedMessage, error)
+
+	// SetQuarantineStatus moves a message from one of the from statuses to
+	// status, returning false if it's in none of them
+	SetQuarantineStatus(ctx context.Context, id int64, status string, from ...string) (bool, error)
+}
+
+// Events stores generic events posted through /events
+type Events interface {
+	// StoreEvent appends an event of eventType with data
+	StoreEvent(ctx context.Context, eventType, data string) (*Event, error)
+
+	// AckEvent records a consumer's processing status of an event, replacing
+	// its earlier ack and counting the attempt
+	AckEvent(ctx context.Context, ack *EventAck) error
+}
+
+// TaskSinks stores the user's task system connections and the action items
+// pushed to them (see internal/tasksink)
+type TaskSinks interface {
+	// SaveTaskSink connects a task system or replaces its settings
+	SaveTaskSink(ctx context.Context, sink TaskSinkConfig) error
+
+	// DeleteTaskSink disconnects a task system, returning false if it wasn't
+	// connected. Its deliveries are kept.
+	DeleteTaskSink(ctx context.Context, name string) (bool, error)
+
+	// CreateTaskDelivery records an action item to push. It returns false
+	// and stores nothing if a delivery with the same ID exists.
+	CreateTaskDelivery(ctx context.Context, d *TaskDelivery) (bool, error)
+}
+
+// Embeddings stores message vectors for semantic search (see
+// internal/semantic)
+type Embeddings interface {
+	// SaveEmbedding stores a message's vector, replacing an earlier one
+	SaveEmbedding(ctx context.Context, e MessageEmbedding) error
+
+	// UnembeddedMessages returns up to limit messages after the cursor with
+	// no vector from model, in store order
+	UnembeddedMessages(ctx context.Context, model string, after int64, limit int) ([]EmbeddingSource, error)
+
+	// SaveEmbeddingBackfill records backfill progress
+	SaveEmbeddingBackfill(ctx context.Context, b *EmbeddingBackfill) error
+
+	// LoadEmbeddingSource returns the text inputs of a stored message (nil
+	// if unknown)
+	LoadEmbeddingSource(ctx context.Context, provider, providerMessageID string) (*EmbeddingSource, error)
+
+	// MessageVectors returns up to limit vectors from model for messages
+	// dated at or after since (unix seconds), newest first
+	MessageVectors(ctx context.Context, model string, since int64, limit int) ([]MessageVector, error)
+
+	// ReplaceTopics swaps the user's topics for a new clustering
+	ReplaceTopics(ctx context.Context, topics []Topic) error
+}
+
+// Translations stores machine translations of messages (see internal/translate)
+type Translations interface {
+	// SaveTranslation attaches a translation to a stored message, replacing
+	// an earlier one
+	SaveTranslation(ctx context.Context, provider, providerMessageID string, t Translation) error
+}
+
+// Attachments stores attachment records and their extracted text (see
+// internal/attachments)
+type Attachments interface {
+	// PendingAttachments returns up to limit attachments waiting for text
+	// extraction, oldest first
+	PendingAttachments(ctx context.Context, limit int) ([]Attachment, error)
+
+	// SaveAttachmentText stores the outcome of an extraction (Status, Text,
+	// Error)
+	SaveAttachmentText(ctx context.Context, a *Attachment) error
+}
+
+// Calendar stores meeting proposals found in mail (see internal/calendar)
+type Calendar interface {
+	// SaveCalendarSuggestion stores a proposal, replacing an earlier one
+	// from the same message. An invite supersedes the earlier versions of
+	// its event and is stored superseded if a later one is; a proposal found
+	// in the text never replaces an invite.
+	SaveCalendarSuggestion(ctx context.Context, s CalendarSuggestion) error
+}
+
+// Enrichments feeds stored mail to re-enrichment and keeps its progress (see
+// internal/enrich)
+type Enrichments interface {
+	// EnrichmentSources returns up to limit stored messages after the cursor,
+	// in store order
+	EnrichmentSources(ctx context.Context, after int64, limit int) ([]EnrichmentSource, error)
+
+	// SaveEnrichmentRun records re-enrichment progress
+	SaveEnrichmentRun(ctx context.Context, r *EnrichmentRun) error
+}
+
+// Archive moves old messages out of the store into cold segments (see
+// internal/archive)
+type Archive interface {
+	// ExportArchive copies up to limit of a provider's messages dated before
+	// before (unix seconds) into a new segment database at path, oldest
+	// first. It returns nil if there are none.
+	ExportArchive(ctx context.Context, provider string, before int64, limit int, path string) (*ArchiveSegment, error)
+
+	// CommitArchive records the segment at path, uploaded as seg.Key, and
+	// deletes its messages from the store, indexing them as archived
+	CommitArchive(ctx context.Context, seg ArchiveSegment, path string) error
+
+	// CompactArchive copies the messages of seg, downloaded to src, that the
+	// store still serves from it into a new segment database at dst. It
+	// returns nil (and leaves dst empty) if there are none.
+	CompactArchive(ctx context.Context, seg ArchiveSegment, src, dst string) (*ArchiveSegment, error)
+
+	// ReplaceArchive points the index at seg, uploaded as seg.Key, instead
+	// of the segment old, or forgets old if seg is nil
+	ReplaceArchive(ctx context.Context, old string, seg *ArchiveSegment) error
+}
+
+// Folders stores the provider folder tree and per-folder cursors
+type Folders interface {
+	UpsertFolders(ctx context.Context, provider string, folders []MailFolder) error
+	ListFolders(ctx context.Context, provider string) ([]MailFolder, error)
+	SetFolderSelected(ctx context.Context, provider, folderID string, selected bool) error
+	SelectFoldersByCategory(ctx context.Context, provider, folder string) error
+	SelectFolders(ctx context.Context, provider string, folders []string) error
+	LoadFolderCursors(ctx context.Context, provider string) (map[string]string, error)
+	SaveFolderCursors(ctx context.Context, provider string, cursors map[string]string) error
+}
+
+// Query reads stored messages and views derived from them
+type Query interface {
+	// LoadMessageLabels returns a message's labels JSON ("" if unknown)
+	LoadMessageLabels(ctx context.Context, provider, providerMessageID string) (string, error)
+
+	// LoadMessageRef returns reply linkage for a message (nil if unknown)
+	LoadMessageRef(ctx context.Context, provider, providerMessageID string) (*MessageRef, error)
+
+	ThreadMessages(ctx context.Context, provider, threadID string) ([]StoredMessage, error)
+	SearchMessages(ctx context.Context, q *search.Query, limit int) ([]StoredMessage, error)
+
+	// ListSubscriptions aggregates list mail dated at or after since (unix
+	// seconds, 0 for all), most active first
+	ListSubscriptions(ctx context.Context, since int64) ([]Subscription, error)
+
+	// LoadSubscription returns one list by key (nil if the user has no mail
+	// from it)
+	LoadSubscription(ctx context.Context, key string) (*Subscription, error)
+
+	// UnsubscribeSuggestions returns the lists suggested for unsubscribing,
+	// optionally with one status, newest first
+	UnsubscribeSuggestions(ctx context.Context, status string) ([]UnsubscribeSuggestion, error)
+	ListContacts(ctx context.Context, q ContactQuery) ([]Contact, error)
+
+	// ContactStats returns every contact's exchanges with the user since
+	// since (unix seconds)
+	ContactStats(ctx context.Context, since int64) ([]ContactStats, error)
+
+	// LoadContactScore returns the relationship score of an address ("Name
+	// <addr>" or bare), 0 if it isn't a scored contact
+	LoadContactScore(ctx context.Context, address string) (float64, error)
+
+	// ContactDetails returns the signature details recorded for an address
+	// with their provenance, newest first
+	ContactDetails(ctx context.Context, email string) ([]ContactDetail, error)
+
+	// ContactMerges returns the user's contact merges, newest first
+	ContactMerges(ctx context.Context) ([]ContactMerge, error)
+
+	// MessageAttachments returns a message's attachments with their
+	// extracted text
+	MessageAttachments(ctx context.Context, provider, providerMessageID string) ([]Attachment, error)
+	Analytics(ctx context.Context, since int64, tzOffset, topN int) (*Analytics, error)
+
+	// NewestMessageDate returns the newest message date (unix seconds) stored
+	// for a provider in a canonical folder, 0 if there is none
+	NewestMessageDate(ctx context.Context, provider, folder string) (int64, error)
+
+	// SyncStates returns the sync status, lag and runner heartbeat of every
+	// provider
+	SyncStates(ctx context.Context) ([]SyncState, error)
+
+	// SyncState returns one provider's sync state, nil if it never synced
+	SyncState(ctx context.Context, provider string) (*SyncState, error)
+
+	// MessagesAsOf reconstructs messages (labels, folder, read/flag state) as
+	// they were at a point in time
+	MessagesAsOf(ctx context.Context, q AsOfQuery) ([]StoredMessage, error)
+
+	// LoadWorkflow returns a workflow instance (nil if unknown)
+	LoadWorkflow(ctx context.Context, id string) (*Workflow, error)
+
+	// ListWorkflows returns the newest instances, optionally with one status
+	ListWorkflows(ctx context.Context, status string, limit int) ([]Workflow, error)
+
+	// ArchiveSegments returns the user's cold segments, newest messages first
+	ArchiveSegments(ctx context.Context) ([]ArchiveSegment, error)
+
+	// ArchivedMessages returns the index entries of archived messages
+	// matching q
+	ArchivedMessages(ctx context.Context, q ArchivedQuery) ([]ArchivedMessage, error)
+
+	// FollowUps returns the threads where the user sent the last message,
+	// oldest due first
+	FollowUps(ctx context.Context, q FollowUpQuery) ([]FollowUp, error)
+
+	// ListTaskSinks returns the user's connected task systems
+	ListTaskSinks(ctx context.Context) ([]TaskSinkConfig, error)
+
+	// ListSenderRules returns the user's sender rules, oldest first
+	ListSenderRules(ctx context.Context) ([]SenderRule, error)
+
+	// GetEvents returns up to 1000 generic events, optionally of one type,
+	// newest first
+	GetEvents(ctx context.Context, eventType string) ([]Event, error)
+
+	// ExportEvents calls fn for every matching generic event in id order,
+	// streaming rows instead of loading them into memory
+	ExportEvents(ctx context.Context, filter EventFilter, fn func(Event) error) error
+
+	// OutboxBacklog summarises the unpublished outbox messages with up to
+	// samples of their latest publish errors
+	OutboxBacklog(ctx context.Context, samples int) (*OutboxBacklog, error)
+
+	// LoadTaskDelivery returns a delivery (nil if unknown)
+	LoadTaskDelivery(ctx context.Context, id string) (*TaskDelivery, error)
+
+	// ListTaskDeliveries returns the newest deliveries, optionally with one
+	// status
+	ListTaskDeliveries(ctx context.Context, status string, limit int) ([]TaskDelivery, error)
+
+	// SemanticSearch returns the messages whose vectors are most similar to
+	// q.Vector, best first. Messages without a vector from q.Model are
+	// skipped.
+	SemanticSearch(ctx context.Context, q SemanticQuery) ([]ScoredMessage, error)
+
+	// LoadEmbeddingBackfill returns the backfill progress for model (nil if
+	// it never ran), with Remaining counted
+	LoadEmbeddingBackfill(ctx context.Context, model string) (*EmbeddingBackfill, error)
+
+	// LoadEnrichmentRun returns a version's re-enrichment progress (nil if
+	// it never ran)
+	LoadEnrichmentRun(ctx context.Context, version string) (*EnrichmentRun, error)
+
+	// EnrichmentRuns returns the user's re-enrichment runs, newest first
+	EnrichmentRuns(ctx context.Context) ([]EnrichmentRun, error)
+
+	// CompareEnrichments compares the outputs of two enrichment versions
+	// message by message, returning up to limit differing messages
+	CompareEnrichments(ctx context.Context, from, to string, limit int) (*EnrichmentComparison, error)
+
+	// EventAcks returns the consumers' acks of an event, by consumer
+	EventAcks(ctx context.Context, eventID string) ([]EventAck, error)
+
+	// ConsumerProgress summarises each consumer's acks, by consumer
+	ConsumerProgress(ctx context.Context) ([]ConsumerProgress, error)
+
+	// ListEventAcks returns up to limit of a consumer's acks, optionally with
+	// one status, newest first
+	ListEventAcks(ctx context.Context, consumer, status string, limit int) ([]EventAck, error)
+
+	// UnackedMailEvents returns up to limit received mail events stored
+	// before before (unix seconds) that consumer hasn't processed, oldest
+	// first
+	UnackedMailEvents(ctx context.Context, consumer string, before int64, limit int) ([]UnackedEvent, error)
+
+	// ListQuarantined returns the newest held-back messages, optionally with
+	// one status
+	ListQuarantined(ctx context.Context, status string, limit int) ([]QuarantinedMessage, error)
+
+	// LoadQuarantined returns a held-back message (nil if unknown)
+	LoadQuarantined(ctx context.Context, id int64) (*QuarantinedMessage, error)
+
+	// CalendarSuggestions returns the proposals ending after after (unix
+	// seconds), soonest first
+	CalendarSuggestions(ctx context.Context, after int64, limit int) ([]CalendarSuggestion, error)
+
+	// Topics returns the user's topic clusters, largest first
+	Topics(ctx context.Context) ([]Topic, error)
+
+	// TopicMessages returns up to limit messages in a topic, newest first
+	TopicMessages(ctx context.Context, topicID string, limit int) ([]StoredMessage, error)
+}
+
+// Segment is a read-only cold segment of archived messages
+type Segment interface {
+	SearchMessages(ctx context.Context, q *search.Query, limit int) ([]StoredMessage, error)
+	ThreadMessages(ctx context.Context, provider, threadID string) ([]StoredMessage, error)
+	MessagesAsOf(ctx context.Context, q AsOfQuery) ([]StoredMessage, error)
+	Close() error
+}
+
+// Reader is a read-only handle on a user's store for query endpoints. Backends
+// may serve it from connections that never wait on the sync writer.
+type Reader interface {
+	Query
+	ListFolders(ctx context.Context, provider string) ([]MailFolder, error)
+	UserID() string
+	Close() error
+}
+
+// userIDPattern is the format of a user ID: BetterAuth's IDs, and nothing
+// that could name another path, NATS subject or blob prefix
+var userIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// ValidUserID reports whether id can be a user ID
+func ValidUserID(id string) bool {
+	return userIDPattern.MatchString(id)
+}
+
+// Opener opens user-scoped stores
+type Opener interface {
+	// Open returns the store for a user; close it when done
+	Open(userID string) (Store, error)
+
+	// OpenReader returns a read-only handle for a user; close it when done
+	OpenReader(userID string) (Reader, error)
+
+	// OpenSegment opens a downloaded archive segment of a user's messages
+	OpenSegment(path, userID string) (Segment, error)
+
+	// Shared reports whether all users share one database
+	Shared() bool
+
+	// RemoveUser deletes all of a user's stored data, first copying it into
+	// a SQLite database at archivePath unless that is empty. It returns false
+	// if the user had no data.
+	RemoveUser(ctx context.Context, userID, archivePath string) (bool, error)
+
+	// Close releases resources shared by the stores
+	Close() error
+}
@@ -0,0 +1,144 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// ackColumns is the column list scanned by scanAckRows
+const ackColumns = `event_id, consumer, event_type, status, detail, attempts, first_acked_at, acked_at`
+
+// AckEvent records a consumer's processing status of an event, replacing its
+// earlier ack and counting the attempt
+func (s *Store) AckEvent(ctx context.Context, ack *EventAck) error {
+	now := time.Now().Unix()
+	_, err := s.exec(ctx, "ack_event", `
+		INSERT INTO processing_status (user_id, event_id, consumer, event_type, status, detail, attempts,
+			first_acked_at, acked_at)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT(user_id, event_id, consumer) DO UPDATE SET
+			event_type = CASE WHEN excluded.event_type != '' THEN excluded.event_type ELSE event_type END,
+			status = excluded.status, detail = excluded.detail, attempts = attempts + 1,
+			acked_at = excluded.acked_at
+	`, s.userID, ack.EventID, ack.Consumer, ack.EventType, ack.Status, ack.Detail, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to ack event: %w", err)
+	}
+	ack.AckedAt = now
+	return nil
+}
+
+// EventAcks returns the consumers' acks of an event, by consumer
+func (s *Store) EventAcks(ctx context.Context, eventID string) ([]EventAck, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+ackColumns+` FROM processing_status
+		WHERE user_id = ? AND event_id = ?
+		ORDER BY consumer
+	`, s.userID, eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event acks: %w", err)
+	}
+	return scanAckRows(rows)
+}
+
+// ListEventAcks returns up to limit of a consumer's acks, optionally with one
+// status, newest first
+func (s *Store) ListEventAcks(ctx context.Context, consumer, status string, limit int) ([]EventAck, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+ackColumns+` FROM processing_status
+		WHERE user_id = ? AND consumer = ? AND (? = '' OR status = ?)
+		ORDER BY acked_at DESC, event_id
+		LIMIT ?
+	`, s.userID, consumer, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event acks: %w", err)
+	}
+	return scanAckRows(rows)
+}
+
+// ConsumerProgress summarises each consumer's acks, by consumer
+func (s *Store) ConsumerProgress(ctx context.Context) ([]ConsumerProgress, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT p.consumer,
+		       SUM(p.status = ?), SUM(p.status = ?), MAX(p.acked_at),
+		       (SELECT l.event_id FROM processing_status l
+		        WHERE l.user_id = p.user_id AND l.consumer = p.consumer
+		        ORDER BY l.acked_at DESC, l.event_id DESC LIMIT 1)
+		FROM processing_status p
+		WHERE p.user_id = ?
+		GROUP BY p.consumer
+		ORDER BY p.consumer
+	`, eventstore.AckProcessed, eventstore.AckFailed, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query consumer progress: %w", err)
+	}
+	defer rows.Close()
+
+	list := []ConsumerProgress{}
+	for rows.Next() {
+		var p ConsumerProgress
+		if err := rows.Scan(&p.Consumer, &p.Processed, &p.Failed, &p.LastAckedAt, &p.LastEventID); err != nil {
+			return nil, fmt.Errorf("failed to scan consumer progress: %w", err)
+		}
+		list = append(list, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read consumer progress: %w", err)
+	}
+	return list, nil
+}
+
+// UnackedMailEvents returns up to limit received mail events stored before
+// before that consumer hasn't processed (no ack, or a failed one), oldest
+// first
+func (s *Store) UnackedMailEvents(ctx context.Context, consumer string, before int64, limit int) ([]UnackedEvent, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT e.event_id, e.ts, COALESCE(e.subject, ''), COALESCE(p.status, ''), COALESCE(p.detail, '')
+		FROM email_received_events e
+		LEFT JOIN processing_status p
+		  ON p.user_id = e.user_id AND p.event_id = e.event_id AND p.consumer = ?
+		WHERE e.user_id = ? AND e.ts < ? AND (p.status IS NULL OR p.status != ?)
+		ORDER BY e.ts, e.event_id
+		LIMIT ?
+	`, consumer, s.userID, before, eventstore.AckProcessed, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unacked events: %w", err)
+	}
+	defer rows.Close()
+
+	list := []UnackedEvent{}
+	for rows.Next() {
+		var e UnackedEvent
+		if err := rows.Scan(&e.EventID, &e.TS, &e.Subject, &e.Status, &e.Detail); err != nil {
+			return nil, fmt.Errorf("failed to scan unacked event: %w", err)
+		}
+		list = append(list, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read unacked events: %w", err)
+	}
+	return list, nil
+}
+
+// scanAckRows reads ackColumns rows
+func scanAckRows(rows *sql.Rows) ([]EventAck, error) {
+	defer rows.Close()
+
+	list := []EventAck{}
+	for rows.Next() {
+		var a EventAck
+		if err := rows.Scan(&a.EventID, &a.Consumer, &a.EventType, &a.Status, &a.Detail, &a.Attempts,
+			&a.FirstAckedAt, &a.AckedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event ack: %w", err)
+		}
+		list = append(list, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event acks: %w", err)
+	}
+	return list, nil
+}
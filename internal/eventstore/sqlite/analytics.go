@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// backlogWhere selects the user's (?) inbox messages awaiting a reply since ?
+const backlogWhere = `
+	FROM email_received_events e
+	WHERE e.user_id = ? AND e.msg_date >= ? AND e.deleted_at IS NULL AND e.folder = 'inbox'
+	  AND COALESCE(e.kind, 'message') = 'message' AND COALESCE(e.is_list, 0) = 0
+	  AND NOT EXISTS (
+	    SELECT 1 FROM email_received_events s
+	    WHERE s.user_id = e.user_id AND s.provider = e.provider AND s.provider_thread_id = e.provider_thread_id
+	      AND s.folder = 'sent' AND s.msg_date > e.msg_date
+	  )`
+
+// Analytics aggregates messages dated since `since` (unix seconds). tzOffset
+// (seconds east of UTC) buckets days and hours; topN limits the sender list.
+func (s *Store) Analytics(ctx context.Context, since int64, tzOffset, topN int) (*Analytics, error) {
+	a := &Analytics{Since: since}
+
+	// Volume per day
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT date(msg_date + ?, 'unixepoch') AS day,
+		       SUM(CASE WHEN folder = 'sent' THEN 0 ELSE 1 END),
+		       SUM(CASE WHEN folder = 'sent' THEN 1 ELSE 0 END)
+		FROM email_received_events
+		WHERE user_id = ? AND msg_date >= ? AND deleted_at IS NULL
+		GROUP BY day
+		ORDER BY day
+	`, tzOffset, s.userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query daily volume: %w", err)
+	}
+	for rows.Next() {
+		var d DayVolume
+		if err := rows.Scan(&d.Date, &d.Received, &d.Sent); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan daily volume: %w", err)
+		}
+		a.VolumePerDay = append(a.VolumePerDay, d)
+	}
+	rows.Close()
+
+	// Top senders
+	rows, err = s.read.QueryContext(ctx, `
+		SELECT sender, COUNT(*), SUM(CASE WHEN is_read = 0 THEN 1 ELSE 0 END)
+		FROM email_received_events
+		WHERE user_id = ? AND msg_date >= ? AND deleted_at IS NULL AND folder != 'sent' AND sender != ''
+		GROUP BY sender
+		ORDER BY COUNT(*) DESC
+		LIMIT ?
+	`, s.userID, since, topN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top senders: %w", err)
+	}
+	for rows.Next() {
+		var (
+			sc     SenderCount
+			unread sql.NullInt64
+		)
+		if err := rows.Scan(&sc.Sender, &sc.Count, &unread); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan top senders: %w", err)
+		}
+		sc.Unread = unread.Int64
+		a.TopSenders = append(a.TopSenders, sc)
+	}
+	rows.Close()
+
+	// Busiest hours
+	rows, err = s.read.QueryContext(ctx, `
+		SELECT CAST(strftime('%H', msg_date + ?, 'unixepoch') AS INTEGER) AS hour, COUNT(*)
+		FROM email_received_events
+		WHERE user_id = ? AND msg_date >= ? AND deleted_at IS NULL AND folder != 'sent'
+		GROUP BY hour
+		ORDER BY COUNT(*) DESC
+	`, tzOffset, s.userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query busiest hours: %w", err)
+	}
+	for rows.Next() {
+		var h HourCount
+		if err := rows.Scan(&h.Hour, &h.Count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan busiest hours: %w", err)
+		}
+		a.BusiestHours = append(a.BusiestHours, h)
+	}
+	rows.Close()
+
+	// Response-needed backlog
+	var oldestAt sql.NullInt64
+	if err := s.read.QueryRowContext(ctx, `SELECT COUNT(*), MIN(e.msg_date) `+backlogWhere, s.userID, since).Scan(&a.ResponseBacklog.Count, &oldestAt); err != nil {
+		return nil, fmt.Errorf("failed to count backlog: %w", err)
+	}
+	a.ResponseBacklog.OldestAt = oldestAt.Int64
+
+	rows, err = s.read.QueryContext(ctx, `
+		SELECT e.provider, e.provider_message_id, e.provider_thread_id, e.subject, e.sender, e.msg_date
+	`+backlogWhere+`
+		ORDER BY e.msg_date
+		LIMIT ?
+	`, s.userID, since, topN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backlog: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			item                   BacklogItem
+			threadID, subj, sender sql.NullString
+		)
+		if err := rows.Scan(&item.Provider, &item.ProviderMessageID, &threadID, &subj, &sender, &item.MsgDate); err != nil {
+			return nil, fmt.Errorf("failed to scan backlog: %w", err)
+		}
+		item.ProviderThreadID = threadID.String
+		item.Subject = subj.String
+		item.Sender = sender.String
+		a.ResponseBacklog.Oldest = append(a.ResponseBacklog.Oldest, item)
+	}
+
+	return a, rows.Err()
+}
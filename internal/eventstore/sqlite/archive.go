@@ -0,0 +1,373 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// archiveBatch bounds the message ids bound in one statement
+const archiveBatch = 500
+
+// ExportArchive copies up to limit of a provider's messages dated before
+// before into a new segment database at path, oldest first. The segment has
+// the full schema, so OpenSegment can read it like a user's database.
+// Returns nil (and leaves path empty) if there is nothing to archive.
+func (s *Store) ExportArchive(ctx context.Context, provider string, before int64, limit int, path string) (*ArchiveSegment, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT * FROM email_received_events
+		WHERE user_id = ? AND provider = ? AND msg_date < ?
+		ORDER BY msg_date, rowid
+		LIMIT ?
+	`, s.userID, provider, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages to archive: %w", err)
+	}
+	defer rows.Close()
+	return writeSegment(ctx, rows, path, s.userID, provider, nil)
+}
+
+// CompactArchive copies the messages of seg, downloaded to src, that the
+// index still serves from it into a new segment at dst, dropping the ones
+// that expired, were purged or were archived again since
+func (s *Store) CompactArchive(ctx context.Context, seg ArchiveSegment, src, dst string) (*ArchiveSegment, error) {
+	live, err := s.ArchivedMessages(ctx, ArchivedQuery{SegmentKey: seg.Key})
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]bool, len(live))
+	for _, m := range live {
+		keep[m.ProviderMessageID] = true
+	}
+
+	db, err := openReader(src, s.userID, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.QueryContext(ctx, `SELECT * FROM email_received_events WHERE user_id = ? ORDER BY msg_date, rowid`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment: %w", err)
+	}
+	defer rows.Close()
+	return writeSegment(ctx, rows, dst, s.userID, seg.Provider, func(id string) bool { return keep[id] })
+}
+
+// writeSegment copies email_received_events rows (all columns) into a new
+// segment database at path, skipping the message ids keep rejects (nil keeps
+// all). Returns nil (and leaves path empty) if it copied none.
+func writeSegment(ctx context.Context, rows *sql.Rows, path, userID, provider string, keep func(id string) bool) (*ArchiveSegment, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages to archive: %w", err)
+	}
+	var msgDate, messageID int
+	for i, c := range cols {
+		switch c {
+		case "msg_date":
+			msgDate = i
+		case "provider_message_id":
+			messageID = i
+		}
+	}
+
+	var seg *ArchiveSegment
+	var db *sql.DB
+	var tx *sql.Tx
+	var insert *sql.Stmt
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+
+	values := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if keep != nil {
+			id, _ := values[messageID].(string)
+			if !keep(id) {
+				continue
+			}
+		}
+
+		if seg == nil {
+			// Created on the first row, so an empty export leaves no database
+			if db, err = openDB(path, userID); err != nil {
+				return nil, err
+			}
+			if tx, err = db.BeginTx(ctx, nil); err != nil {
+				return nil, fmt.Errorf("failed to begin transaction: %w", err)
+			}
+			defer tx.Rollback()
+			insert, err = tx.PrepareContext(ctx, `INSERT INTO email_received_events (`+strings.Join(cols, ", ")+
+				`) VALUES (?`+strings.Repeat(", ?", len(cols)-1)+`)`)
+			if err != nil {
+				return nil, fmt.Errorf("failed to prepare segment insert: %w", err)
+			}
+			seg = &ArchiveSegment{Provider: provider}
+		}
+
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return nil, fmt.Errorf("failed to write segment: %w", err)
+		}
+		date, _ := values[msgDate].(int64)
+		if seg.Messages == 0 || date < seg.OldestAt {
+			seg.OldestAt = date
+		}
+		if date > seg.NewestAt {
+			seg.NewestAt = date
+		}
+		seg.Messages++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages to archive: %w", err)
+	}
+	if seg == nil {
+		return nil, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit segment: %w", err)
+	}
+	// A self-contained file: no WAL left next to it
+	if _, err := db.ExecContext(ctx, `PRAGMA journal_mode=DELETE`); err != nil {
+		return nil, fmt.Errorf("failed to finish segment: %w", err)
+	}
+	if err := db.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close segment: %w", err)
+	}
+	db = nil
+	return seg, nil
+}
+
+// segmentMessage is a message of a segment file, as the index records it
+type segmentMessage struct {
+	eventID, messageID, threadID, inboxID, kind string
+	msgDate, ts                                 int64
+}
+
+// CommitArchive records a segment uploaded as seg.Key and moves the messages
+// in the segment file at path from the store to the archived_messages index,
+// in one transaction. A message archived before (stored again by a resync)
+// is served from the new segment from then on.
+func (s *Store) CommitArchive(ctx context.Context, seg ArchiveSegment, path string) error {
+	msgs, err := segmentMessages(ctx, path, s.userID)
+	if err != nil {
+		return err
+	}
+
+	return s.writeTx(ctx, "commit_archive", func(tx *sql.Tx) error {
+		for start := 0; start < len(msgs); start += archiveBatch {
+			batch := msgs[start:min(len(msgs), start+archiveBatch)]
+
+			args := []interface{}{s.userID}
+			for _, m := range batch {
+				args = append(args, m.eventID)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM email_received_events
+				WHERE user_id = ? AND event_id IN (?`+strings.Repeat(", ?", len(batch)-1)+`)
+			`, args...); err != nil {
+				return fmt.Errorf("failed to delete archived messages: %w", err)
+			}
+		}
+
+		index, err := tx.PrepareContext(ctx, `
+			INSERT OR REPLACE INTO archived_messages
+				(user_id, provider, provider_message_id, provider_thread_id, inbox_id, segment_key, kind, msg_date, ts)
+			VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?, ?)
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare archive index: %w", err)
+		}
+		defer index.Close()
+		for _, m := range msgs {
+			if _, err := index.ExecContext(ctx, s.userID, seg.Provider, m.messageID, m.threadID,
+				m.inboxID, seg.Key, m.kind, m.msgDate, m.ts); err != nil {
+				return fmt.Errorf("failed to index archived message: %w", err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO archive_segments (user_id, key, provider, messages, oldest_at, newest_at, archived_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, s.userID, seg.Key, seg.Provider, seg.Messages, seg.OldestAt, seg.NewestAt, time.Now().Unix()); err != nil {
+			return fmt.Errorf("failed to record segment: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReplaceArchive points the index entries of segment old at seg, uploaded as
+// seg.Key, and forgets old; with a nil seg it only forgets old. The blob of
+// old is left for the archive job's sweep.
+func (s *Store) ReplaceArchive(ctx context.Context, old string, seg *ArchiveSegment) error {
+	return s.writeTx(ctx, "replace_archive", func(tx *sql.Tx) error {
+		if seg != nil {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE archived_messages SET segment_key = ? WHERE user_id = ? AND segment_key = ?
+			`, seg.Key, s.userID, old); err != nil {
+				return fmt.Errorf("failed to move archive index: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO archive_segments (user_id, key, provider, messages, oldest_at, newest_at, archived_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, s.userID, seg.Key, seg.Provider, seg.Messages, seg.OldestAt, seg.NewestAt, time.Now().Unix()); err != nil {
+				return fmt.Errorf("failed to record segment: %w", err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM archive_segments WHERE user_id = ? AND key = ?
+		`, s.userID, old); err != nil {
+			return fmt.Errorf("failed to forget segment: %w", err)
+		}
+		return nil
+	})
+}
+
+// segmentMessages lists the messages in a segment file
+func segmentMessages(ctx context.Context, path, userID string) ([]segmentMessage, error) {
+	db, err := openReader(path, userID, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT event_id, provider_message_id, COALESCE(provider_thread_id, ''), inbox_id,
+		       COALESCE(kind, ''), COALESCE(msg_date, 0), ts
+		FROM email_received_events
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []segmentMessage
+	for rows.Next() {
+		var m segmentMessage
+		if err := rows.Scan(&m.eventID, &m.messageID, &m.threadID, &m.inboxID, &m.kind, &m.msgDate, &m.ts); err != nil {
+			return nil, fmt.Errorf("failed to read segment: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// ArchiveSegments returns the user's cold segments, newest messages first,
+// with how many of their messages the index still serves
+func (s *Store) ArchiveSegments(ctx context.Context) ([]ArchiveSegment, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT s.key, s.provider, s.messages, s.oldest_at, s.newest_at, s.archived_at,
+		       COUNT(a.provider_message_id), COUNT(a.deleted_at)
+		FROM archive_segments s
+		LEFT JOIN archived_messages a ON a.user_id = s.user_id AND a.segment_key = s.key
+		WHERE s.user_id = ?
+		GROUP BY s.key
+		ORDER BY s.newest_at DESC
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segs []ArchiveSegment
+	for rows.Next() {
+		var seg ArchiveSegment
+		if err := rows.Scan(&seg.Key, &seg.Provider, &seg.Messages, &seg.OldestAt, &seg.NewestAt, &seg.ArchivedAt,
+			&seg.Live, &seg.Deleted); err != nil {
+			return nil, fmt.Errorf("failed to scan archive segment: %w", err)
+		}
+		segs = append(segs, seg)
+	}
+	return segs, rows.Err()
+}
+
+// ArchivedMessages returns the index entries of archived messages matching
+// q. Message ids are looked up in batches.
+func (s *Store) ArchivedMessages(ctx context.Context, q ArchivedQuery) ([]ArchivedMessage, error) {
+	conds := []string{"user_id = ?"}
+	args := []interface{}{s.userID}
+	if q.Provider != "" {
+		conds = append(conds, "provider = ?")
+		args = append(args, q.Provider)
+	}
+	if q.ThreadID != "" {
+		conds = append(conds, "provider_thread_id = ?")
+		args = append(args, q.ThreadID)
+	}
+	if q.SegmentKey != "" {
+		conds = append(conds, "segment_key = ?")
+		args = append(args, q.SegmentKey)
+	}
+	query := `
+		SELECT provider, provider_message_id, COALESCE(provider_thread_id, ''), segment_key,
+		       COALESCE(msg_date, 0), COALESCE(deleted_at, 0)
+		FROM archived_messages
+		WHERE ` + strings.Join(conds, " AND ")
+	if len(q.MessageIDs) == 0 {
+		return s.archivedMessages(ctx, query, args)
+	}
+
+	var found []ArchivedMessage
+	for start := 0; start < len(q.MessageIDs); start += archiveBatch {
+		batch := q.MessageIDs[start:min(len(q.MessageIDs), start+archiveBatch)]
+		batchArgs := append([]interface{}{}, args...)
+		for _, id := range batch {
+			batchArgs = append(batchArgs, id)
+		}
+		msgs, err := s.archivedMessages(ctx, query+` AND provider_message_id IN (?`+strings.Repeat(", ?", len(batch)-1)+`)`, batchArgs)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, msgs...)
+	}
+	return found, nil
+}
+
+func (s *Store) archivedMessages(ctx context.Context, query string, args []interface{}) ([]ArchivedMessage, error) {
+	rows, err := s.read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query archived messages: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []ArchivedMessage
+	for rows.Next() {
+		var m ArchivedMessage
+		if err := rows.Scan(&m.Provider, &m.ProviderMessageID, &m.ProviderThreadID, &m.SegmentKey, &m.MsgDate, &m.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan archived message: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// OpenSegment opens a downloaded segment read-only. Its queries are scoped to
+// userID like a user's store; only message reads are meaningful on it, and
+// they don't know the index (see internal/archive). Segments exported by
+// older versions are migrated first (path is a local copy).
+func (o *Opener) OpenSegment(path, userID string) (eventstore.Segment, error) {
+	db, err := openDB(path, userID)
+	if err != nil {
+		return nil, err
+	}
+	db.Close()
+
+	read, err := openReader(path, userID, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{read: read, userID: userID}, nil
+}
@@ -0,0 +1,225 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// replayedEventTypes are the outbox events that set or change message state
+var replayedEventTypes = []string{
+	"email.received", "email.auto_reply", "email.bounce",
+	"email.labels_changed", "email.read", "email.unread", "email.flagged", "email.moved",
+}
+
+// replayedEvent is the subset of an outbox payload that affects message state
+type replayedEvent struct {
+	Provider          string   `json:"provider"`
+	ProviderMessageID string   `json:"provider_message_id"`
+	PreviousMessageID string   `json:"previous_provider_message_id"`
+	Labels            []string `json:"labels"`
+	Folder            string   `json:"folder"`
+	IsRead            *bool    `json:"is_read"`
+	IsFlagged         *bool    `json:"is_flagged"`
+	Flagged           *bool    `json:"flagged"`
+	PayloadRef        string   `json:"payload_ref"`
+}
+
+// MessagesAsOf reconstructs messages as they were at q.At by replaying the
+// outbox history (received, label, read/flag and move events) up to that time
+// over the stored rows. Messages ingested later or deleted by then are left
+// out. State the history doesn't cover (rows stored before state events, or
+// offloaded payloads) falls back to the current values. q.Archived rows are
+// replayed the same way; a stored copy of the same message wins.
+func (s *Store) MessagesAsOf(ctx context.Context, q AsOfQuery) ([]StoredMessage, error) {
+	conds := []string{"user_id = ?", "ts <= ?"}
+	args := []interface{}{s.userID, q.At}
+	if q.Provider != "" {
+		conds = append(conds, "provider = ?")
+		args = append(args, q.Provider)
+	}
+	if q.ThreadID != "" {
+		conds = append(conds, "provider_thread_id = ?")
+		args = append(args, q.ThreadID)
+	}
+
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM email_received_events
+		WHERE `+strings.Join(conds, " AND "), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	// Keyed by provider|current provider message id
+	msgs := make(map[string]*StoredMessage)
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if m.DeletedAt > q.At {
+			m.DeletedAt = 0
+		}
+		msgs[m.Provider+"|"+m.ProviderMessageID] = &m
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, m := range q.Archived {
+		key := m.Provider + "|" + m.ProviderMessageID
+		if _, ok := msgs[key]; ok || m.TS > q.At {
+			continue
+		}
+		if m.DeletedAt > q.At {
+			m.DeletedAt = 0
+		}
+		msgs[key] = &m
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	// Moves re-key rows, so map every id a message ever had to its current one
+	renamed, err := s.messageRenames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := func(provider, id string) string {
+		key := provider + "|" + id
+		for seen := 0; seen < 100; seen++ {
+			next, ok := renamed[key]
+			if !ok {
+				break
+			}
+			key = next
+		}
+		return key
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(replayedEventTypes)), ",")
+	args = []interface{}{s.userID, q.At}
+	for _, t := range replayedEventTypes {
+		args = append(args, t)
+	}
+	rows, err = s.read.QueryContext(ctx, `
+		SELECT event_type, decompress(payload) FROM outbox
+		WHERE user_id = ? AND ts <= ? AND event_type IN (`+placeholders+`)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			eventType string
+			payload   []byte
+			ev        replayedEvent
+		)
+		if err := rows.Scan(&eventType, &payload); err != nil {
+			return nil, fmt.Errorf("failed to scan history: %w", err)
+		}
+		if json.Unmarshal(payload, &ev) != nil {
+			continue
+		}
+
+		id := ev.ProviderMessageID
+		if eventType == "email.moved" {
+			id = ev.PreviousMessageID
+		}
+		m, ok := msgs[current(ev.Provider, id)]
+		if !ok {
+			continue
+		}
+
+		switch eventType {
+		case "email.read", "email.unread":
+			m.IsRead = eventType == "email.read"
+		case "email.flagged":
+			if ev.Flagged != nil {
+				m.IsFlagged = *ev.Flagged
+			}
+		case "email.moved":
+			m.ProviderMessageID = ev.ProviderMessageID
+			if ev.Folder != "" {
+				m.Folder = ev.Folder
+			}
+		case "email.labels_changed":
+			m.Labels = ev.Labels
+			if ev.Folder != "" {
+				m.Folder = ev.Folder
+			}
+		default: // received: the state at ingest, unless the payload was offloaded
+			if ev.PayloadRef != "" {
+				continue
+			}
+			m.ProviderMessageID = ev.ProviderMessageID
+			m.Labels = ev.Labels
+			if ev.Folder != "" {
+				m.Folder = ev.Folder
+			}
+			if ev.IsRead != nil {
+				m.IsRead = *ev.IsRead
+			}
+			if ev.IsFlagged != nil {
+				m.IsFlagged = *ev.IsFlagged
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]StoredMessage, 0, len(msgs))
+	for _, m := range msgs {
+		if m.DeletedAt != 0 || (q.Folder != "" && m.Folder != q.Folder) {
+			continue
+		}
+		result = append(result, *m)
+	}
+
+	// Threads read oldest first, mailboxes newest first
+	sort.Slice(result, func(i, j int) bool {
+		if q.ThreadID != "" {
+			return result[i].MsgDate < result[j].MsgDate
+		}
+		return result[i].MsgDate > result[j].MsgDate
+	})
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result, nil
+}
+
+// messageRenames maps provider|old id to provider|new id for every move in the
+// outbox history
+func (s *Store) messageRenames(ctx context.Context) (map[string]string, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT decompress(payload) FROM outbox WHERE user_id = ? AND event_type = 'email.moved' ORDER BY id
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query moves: %w", err)
+	}
+	defer rows.Close()
+
+	renamed := make(map[string]string)
+	for rows.Next() {
+		var (
+			payload []byte
+			ev      replayedEvent
+		)
+		if err := rows.Scan(&payload); err != nil {
+			return nil, fmt.Errorf("failed to scan move: %w", err)
+		}
+		if json.Unmarshal(payload, &ev) != nil || ev.PreviousMessageID == "" {
+			continue
+		}
+		renamed[ev.Provider+"|"+ev.PreviousMessageID] = ev.Provider + "|" + ev.ProviderMessageID
+	}
+	return renamed, rows.Err()
+}
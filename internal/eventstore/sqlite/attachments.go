@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// attachmentColumns are the attachments columns read by scanAttachment
+const attachmentColumns = `id, event_id, provider, provider_message_id, filename, content_type, size,
+	COALESCE(blob_key, ''), status, COALESCE(text, ''), COALESCE(error, ''), created_at, COALESCE(extracted_at, 0)`
+
+func scanAttachment(rows *sql.Rows) (Attachment, error) {
+	var a Attachment
+	err := rows.Scan(&a.ID, &a.EventID, &a.Provider, &a.ProviderMessageID, &a.Filename, &a.ContentType, &a.Size,
+		&a.BlobKey, &a.Status, &a.Text, &a.Error, &a.CreatedAt, &a.ExtractedAt)
+	if err != nil {
+		return a, fmt.Errorf("failed to scan attachment: %w", err)
+	}
+	return a, nil
+}
+
+// AddAttachmentTx records an attachment of a message
+func (s *Store) AddAttachmentTx(ctx context.Context, tx *sql.Tx, a Attachment) error {
+	if a.CreatedAt == 0 {
+		a.CreatedAt = time.Now().Unix()
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO attachments (user_id, id, event_id, provider, provider_message_id, filename, content_type, size,
+		                         blob_key, status, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), ?)
+		ON CONFLICT(user_id, id) DO NOTHING
+	`, s.userID, a.ID, a.EventID, a.Provider, a.ProviderMessageID, a.Filename, a.ContentType, a.Size,
+		a.BlobKey, a.Status, a.Error, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add attachment: %w", err)
+	}
+	return nil
+}
+
+// PendingAttachments returns up to limit attachments waiting for text
+// extraction, oldest first
+func (s *Store) PendingAttachments(ctx context.Context, limit int) ([]Attachment, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE user_id = ? AND status = ?
+		ORDER BY created_at, id
+		LIMIT ?
+	`, s.userID, eventstore.AttachmentPending, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// SaveAttachmentText stores the outcome of an extraction. The text is
+// indexed for search by the attachment_fts triggers.
+func (s *Store) SaveAttachmentText(ctx context.Context, a *Attachment) error {
+	a.ExtractedAt = time.Now().Unix()
+	_, err := s.exec(ctx, "save_attachment_text", `
+		UPDATE attachments SET status = ?, text = NULLIF(?, ''), error = NULLIF(?, ''), extracted_at = ?
+		WHERE user_id = ? AND id = ?
+	`, a.Status, a.Text, a.Error, a.ExtractedAt, s.userID, a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save attachment text: %w", err)
+	}
+	return nil
+}
+
+// MessageAttachments returns a message's attachments with their extracted
+// text
+func (s *Store) MessageAttachments(ctx context.Context, provider, providerMessageID string) ([]Attachment, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+		ORDER BY created_at, id
+	`, s.userID, provider, providerMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
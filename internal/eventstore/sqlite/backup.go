@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	moderncsqlite "modernc.org/sqlite"
+)
+
+// backupConn is the modernc connection's online backup API
+type backupConn interface {
+	NewBackup(dstURI string) (*moderncsqlite.Backup, error)
+}
+
+// Backup writes a consistent copy of the user's database to path using the
+// SQLite online backup API. Pages are copied as they are, so rowids and the
+// full-text index stay valid (unlike VACUUM INTO). It reads through a reader
+// connection, so syncs keep writing meanwhile.
+func (s *Store) Backup(ctx context.Context, path string) error {
+	if s.shared {
+		return fmt.Errorf("per-user backups need per-user storage")
+	}
+
+	conn, err := s.read.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(dc any) error {
+		if timed, ok := dc.(*timedConn); ok {
+			dc = timed.conn
+		}
+		bc, ok := dc.(backupConn)
+		if !ok {
+			return fmt.Errorf("driver doesn't support backups")
+		}
+
+		backup, err := bc.NewBackup(path)
+		if err != nil {
+			return fmt.Errorf("failed to start backup: %w", err)
+		}
+		for more := true; more; {
+			if more, err = backup.Step(-1); err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to copy database: %w", err)
+			}
+		}
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("failed to finish backup: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// SaveCalendarSuggestion stores a meeting proposal, replacing an earlier one
+// from the same message (see SaveCalendarSuggestionTx)
+func (s *Store) SaveCalendarSuggestion(ctx context.Context, cs CalendarSuggestion) error {
+	return s.writeTx(ctx, "save_calendar_suggestion", func(tx *sql.Tx) error {
+		return s.SaveCalendarSuggestionTx(ctx, tx, cs)
+	})
+}
+
+// SaveCalendarSuggestionTx stores a meeting proposal, replacing an earlier
+// one from the same message. An invite supersedes the stored versions of its
+// event (same UID) from other messages, unless one of them is later: a higher
+// SEQUENCE, or a cancellation of the same one. Then the invite is stored
+// superseded, so the message keeps its record either way. A proposal the
+// meetings enricher found in the text never replaces an invite's record.
+func (s *Store) SaveCalendarSuggestionTx(ctx context.Context, tx *sql.Tx, cs CalendarSuggestion) error {
+	candidates, err := json.Marshal(cs.Candidates)
+	if err != nil {
+		return fmt.Errorf("encode candidates: %w", err)
+	}
+	attendees, err := json.Marshal(cs.Attendees)
+	if err != nil {
+		return fmt.Errorf("encode attendees: %w", err)
+	}
+	if cs.CreatedAt == 0 {
+		cs.CreatedAt = time.Now().Unix()
+	}
+	if cs.Source == "" {
+		cs.Source = eventstore.SuggestionFromText
+	}
+	if cs.Status == "" {
+		cs.Status = eventstore.SuggestionActive
+	}
+
+	if cs.InviteUID != "" {
+		var later int
+		err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM calendar_suggestions
+			WHERE user_id = ? AND invite_uid = ? AND NOT (provider = ? AND provider_message_id = ?)
+			  AND (invite_sequence > ? OR (invite_sequence = ? AND status = ? AND ? != ?))
+		`, s.userID, cs.InviteUID, cs.Provider, cs.ProviderMessageID, cs.InviteSequence, cs.InviteSequence,
+			eventstore.SuggestionCancelled, cs.Status, eventstore.SuggestionCancelled).Scan(&later)
+		if err != nil {
+			return fmt.Errorf("failed to query invite versions: %w", err)
+		}
+		if later > 0 {
+			cs.Status = eventstore.SuggestionSuperseded
+		} else if _, err := tx.ExecContext(ctx, `
+			UPDATE calendar_suggestions SET status = ?
+			WHERE user_id = ? AND invite_uid = ? AND NOT (provider = ? AND provider_message_id = ?) AND status = ?
+		`, eventstore.SuggestionSuperseded, s.userID, cs.InviteUID, cs.Provider, cs.ProviderMessageID,
+			eventstore.SuggestionActive); err != nil {
+			return fmt.Errorf("failed to supersede invite versions: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO calendar_suggestions (user_id, provider, provider_message_id, provider_thread_id, source_event_id,
+			title, candidates, attendees, conference_url, starts_at, ends_at, created_at,
+			source, invite_uid, invite_sequence, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+		ON CONFLICT(user_id, provider, provider_message_id) DO UPDATE SET
+			provider_thread_id = excluded.provider_thread_id, source_event_id = excluded.source_event_id,
+			title = excluded.title, candidates = excluded.candidates, attendees = excluded.attendees,
+			conference_url = excluded.conference_url, starts_at = excluded.starts_at, ends_at = excluded.ends_at,
+			source = excluded.source, invite_uid = excluded.invite_uid, invite_sequence = excluded.invite_sequence,
+			status = excluded.status
+		WHERE calendar_suggestions.source != ? OR excluded.source = ?
+	`, s.userID, cs.Provider, cs.ProviderMessageID, cs.ProviderThreadID, cs.SourceEventID,
+		cs.Title, string(candidates), string(attendees), cs.ConferenceURL, cs.StartsAt, cs.EndsAt, cs.CreatedAt,
+		cs.Source, cs.InviteUID, cs.InviteSequence, cs.Status,
+		eventstore.SuggestionFromInvite, eventstore.SuggestionFromInvite)
+	if err != nil {
+		return fmt.Errorf("failed to save calendar suggestion: %w", err)
+	}
+	return nil
+}
+
+// CalendarSuggestions returns the active proposals ending after after,
+// soonest first
+func (s *Store) CalendarSuggestions(ctx context.Context, after int64, limit int) ([]CalendarSuggestion, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT provider, provider_message_id, COALESCE(provider_thread_id, ''), COALESCE(source_event_id, ''),
+		       title, candidates, attendees, COALESCE(conference_url, ''), starts_at, ends_at, created_at,
+		       source, COALESCE(invite_uid, ''), invite_sequence, status
+		FROM calendar_suggestions
+		WHERE user_id = ? AND ends_at >= ? AND status = ?
+		ORDER BY CASE WHEN starts_at = 0 THEN ends_at ELSE starts_at END, provider_message_id
+		LIMIT ?
+	`, s.userID, after, eventstore.SuggestionActive, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calendar suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	suggestions := []CalendarSuggestion{}
+	for rows.Next() {
+		var (
+			cs                    CalendarSuggestion
+			candidates, attendees string
+		)
+		if err := rows.Scan(&cs.Provider, &cs.ProviderMessageID, &cs.ProviderThreadID, &cs.SourceEventID,
+			&cs.Title, &candidates, &attendees, &cs.ConferenceURL, &cs.StartsAt, &cs.EndsAt, &cs.CreatedAt,
+			&cs.Source, &cs.InviteUID, &cs.InviteSequence, &cs.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan calendar suggestion: %w", err)
+		}
+		_ = json.Unmarshal([]byte(candidates), &cs.Candidates)
+		_ = json.Unmarshal([]byte(attendees), &cs.Attendees)
+		suggestions = append(suggestions, cs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar suggestions: %w", err)
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// LoadMessageLabels returns the stored labels JSON for a message ("" if unknown)
+func (s *Store) LoadMessageLabels(ctx context.Context, provider, providerMessageID string) (string, error) {
+	var labels sql.NullString
+	err := s.read.QueryRowContext(ctx, `
+		SELECT labels_json FROM email_received_events
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, s.userID, provider, providerMessageID).Scan(&labels)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to load labels: %w", err)
+	}
+	return labels.String, nil
+}
+
+// UpdateMessageLabelsTx replaces the stored label state (and canonical folder,
+// when given) of a message. Returns false if the message isn't stored locally.
+func (s *Store) UpdateMessageLabelsTx(ctx context.Context, tx *sql.Tx, provider, providerMessageID, labelsJSON, folder string) (bool, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE email_received_events
+		SET labels_json = ?,
+		    folder = COALESCE(NULLIF(?, ''), folder)
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, labelsJSON, folder, s.userID, provider, providerMessageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update labels: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// MarkMessageDeletedTx records that a message was deleted at the provider.
+// An archived message gets a tombstone in its index entry instead. Returns
+// false if the message isn't stored locally or was already deleted.
+func (s *Store) MarkMessageDeletedTx(ctx context.Context, tx *sql.Tx, provider, providerMessageID string, deletedAt int64) (bool, error) {
+	for _, table := range []string{"email_received_events", "archived_messages"} {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE `+table+`
+			SET deleted_at = ?
+			WHERE user_id = ? AND provider = ? AND provider_message_id = ? AND deleted_at IS NULL
+		`, deletedAt, s.userID, provider, providerMessageID)
+		if err != nil {
+			return false, fmt.Errorf("failed to mark deleted: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MoveMessageTx records a move that changed the message's provider id (Outlook).
+// A copy already synced under the new id is replaced. Returns false if the
+// message isn't stored locally.
+func (s *Store) MoveMessageTx(ctx context.Context, tx *sql.Tx, provider, oldMessageID, newMessageID, folder string) (bool, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE OR REPLACE email_received_events
+		SET provider_message_id = ?, folder = ?
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, newMessageID, folder, s.userID, provider, oldMessageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to move message: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE OR REPLACE message_embeddings SET provider_message_id = ?
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, newMessageID, s.userID, provider, oldMessageID); err != nil {
+		return false, fmt.Errorf("failed to move embedding: %w", err)
+	}
+	return true, nil
+}
+
+// UpdateMessageStateTx stores new read/flag state for a message (nil leaves a
+// value unchanged) and returns the previous state. known is false if the
+// message isn't stored locally.
+func (s *Store) UpdateMessageStateTx(ctx context.Context, tx *sql.Tx, provider, providerMessageID string, isRead, isFlagged *bool) (prev MessageState, known bool, err error) {
+	err = tx.QueryRowContext(ctx, `
+		SELECT is_read, is_flagged FROM email_received_events
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, s.userID, provider, providerMessageID).Scan(&prev.IsRead, &prev.IsFlagged)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return prev, false, nil
+		}
+		return prev, false, fmt.Errorf("failed to load message state: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE email_received_events
+		SET is_read = COALESCE(?, is_read),
+		    is_flagged = COALESCE(?, is_flagged)
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, isRead, isFlagged, s.userID, provider, providerMessageID)
+	if err != nil {
+		return prev, true, fmt.Errorf("failed to update message state: %w", err)
+	}
+
+	return prev, true, nil
+}
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	moderncsqlite "modernc.org/sqlite"
+)
+
+// Outbox payloads and message headers at least compressThreshold bytes long
+// are stored zstd-compressed behind compressedMarker. Values without the
+// marker are stored as written, so older rows and small values read as
+// before. SQL that looks inside these columns goes through decompress().
+var compressedMarker = []byte{0x00, 'z', 's', '1'}
+
+// DefaultCompressThreshold is the size from which values are compressed
+const DefaultCompressThreshold = 1024
+
+// maxDecompressedSize bounds a decompressed value
+const maxDecompressedSize = 64 << 20
+
+var compressThreshold atomic.Int64
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedSize))
+)
+
+func init() {
+	compressThreshold.Store(DefaultCompressThreshold)
+
+	// decompress(x) returns a compressed column value as text and any other
+	// value unchanged
+	moderncsqlite.MustRegisterDeterministicScalarFunction("decompress", 1, func(_ *moderncsqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		b, ok := args[0].([]byte)
+		if !ok || !bytes.HasPrefix(b, compressedMarker) {
+			return args[0], nil
+		}
+		out, err := decompress(b)
+		if err != nil {
+			return nil, err
+		}
+		return string(out), nil
+	})
+}
+
+// SetCompressThreshold sets the size from which payloads and headers are
+// stored compressed; 0 stores everything uncompressed. It applies to values
+// written afterwards.
+func SetCompressThreshold(n int) {
+	compressThreshold.Store(int64(n))
+}
+
+// compress returns b compressed behind the marker if it is over the
+// threshold and compression makes it smaller, b otherwise
+func compress(b []byte) []byte {
+	threshold := compressThreshold.Load()
+	if threshold <= 0 || int64(len(b)) < threshold {
+		return b
+	}
+	out := zstdEncoder.EncodeAll(b, append(make([]byte, 0, len(b)/2), compressedMarker...))
+	if len(out) >= len(b) {
+		return b
+	}
+	return out
+}
+
+// compressText is compress for text columns. Uncompressed values stay text
+// so they remain readable with plain SQL.
+func compressText(s string) any {
+	if out := compress([]byte(s)); len(out) != len(s) {
+		return out
+	}
+	return s
+}
+
+// decompress reverses compress; values without the marker are returned as is
+func decompress(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, compressedMarker) {
+		return b, nil
+	}
+	out, err := zstdDecoder.DecodeAll(b[len(compressedMarker):], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress stored value: %w", err)
+	}
+	return out, nil
+}
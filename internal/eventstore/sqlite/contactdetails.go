@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// maxContactPhones caps the phone numbers shown on a contact
+const maxContactPhones = 5
+
+// EnrichContactTx records a message's signature details for its sender and
+// refreshes the contact's current values: the value seen in the newest
+// message wins for each field, and the newest phone numbers are kept. Details
+// of a merged address go to its primary contact. Returns the fields whose
+// current value changed.
+func (s *Store) EnrichContactTx(ctx context.Context, tx *sql.Tx, e ContactEnrichment) ([]string, error) {
+	primary, err := resolveContact(ctx, tx, s.userID, e.Email)
+	if err != nil {
+		return nil, err
+	}
+	before, err := contactDetailValues(ctx, tx, s.userID, primary)
+	if err != nil || before == nil {
+		return nil, err // not a contact (list or automatic mail)
+	}
+
+	now := time.Now().Unix()
+	add := func(field, value string) error {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO contact_details (user_id, email, field, value, event_id, provider, provider_message_id, msg_date, first_seen, last_seen)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, email, field, value) DO UPDATE SET
+				event_id = CASE WHEN excluded.msg_date >= contact_details.msg_date THEN excluded.event_id ELSE contact_details.event_id END,
+				provider = CASE WHEN excluded.msg_date >= contact_details.msg_date THEN excluded.provider ELSE contact_details.provider END,
+				provider_message_id = CASE WHEN excluded.msg_date >= contact_details.msg_date
+				                           THEN excluded.provider_message_id ELSE contact_details.provider_message_id END,
+				msg_date   = MAX(contact_details.msg_date, excluded.msg_date),
+				last_seen  = excluded.last_seen,
+				seen_count = contact_details.seen_count + 1
+		`, s.userID, e.Email, field, value, e.EventID, e.Provider, e.ProviderMessageID, e.MsgDate, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to save contact %s: %w", field, err)
+		}
+		return nil
+	}
+
+	for _, d := range []struct{ field, value string }{
+		{eventstore.DetailTitle, e.Title},
+		{eventstore.DetailCompany, e.Company},
+		{eventstore.DetailAddress, e.Address},
+		{eventstore.DetailWebsite, e.Website},
+	} {
+		if err := add(d.field, d.value); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range e.Phones {
+		if err := add(eventstore.DetailPhone, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := refreshContactDetailsTx(ctx, tx, s.userID, primary); err != nil {
+		return nil, err
+	}
+	after, err := contactDetailValues(ctx, tx, s.userID, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, field := range []string{eventstore.DetailTitle, eventstore.DetailCompany, eventstore.DetailPhone, eventstore.DetailAddress, eventstore.DetailWebsite} {
+		if before[field] != after[field] {
+			changed = append(changed, field)
+		}
+	}
+	return changed, nil
+}
+
+// contactDetailValues returns a contact's current detail columns keyed by
+// field (phones as stored JSON), nil if the contact doesn't exist
+func contactDetailValues(ctx context.Context, tx *sql.Tx, userID, email string) (map[string]string, error) {
+	var title, company, phones, address, website string
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(title, ''), COALESCE(company, ''), COALESCE(phones, ''), COALESCE(address, ''), COALESCE(website, '')
+		FROM contacts WHERE user_id = ? AND email = ?
+	`, userID, email).Scan(&title, &company, &phones, &address, &website)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contact: %w", err)
+	}
+	return map[string]string{
+		eventstore.DetailTitle:   title,
+		eventstore.DetailCompany: company,
+		eventstore.DetailPhone:   phones,
+		eventstore.DetailAddress: address,
+		eventstore.DetailWebsite: website,
+	}, nil
+}
+
+// contactDetailsOf matches the contact_details rows d of a contact and of the
+// addresses merged into it
+const contactDetailsOf = `d.user_id = contacts.user_id AND (d.email = contacts.email OR d.email IN (
+	SELECT a.email FROM contact_aliases a WHERE a.user_id = contacts.user_id AND a.primary_email = contacts.email))`
+
+// refreshContactDetailsTx recomputes the detail columns of a contact (or,
+// with email "", of every contact with details) from contact_details
+func refreshContactDetailsTx(ctx context.Context, tx *sql.Tx, userID, email string) error {
+	latest := func(field string) string {
+		return `(SELECT value FROM contact_details d
+		         WHERE ` + contactDetailsOf + ` AND d.field = '` + field + `'
+		         ORDER BY msg_date DESC, seen_count DESC LIMIT 1)`
+	}
+
+	where := `user_id = ? AND email IN (
+		SELECT COALESCE(a.primary_email, d.email) FROM contact_details d
+		LEFT JOIN contact_aliases a ON a.user_id = d.user_id AND a.email = d.email
+		WHERE d.user_id = ?)`
+	args := []interface{}{maxContactPhones, userID, userID}
+	if email != "" {
+		where = "user_id = ? AND email = ?"
+		args = []interface{}{maxContactPhones, userID, email}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE contacts SET
+			title   = `+latest(eventstore.DetailTitle)+`,
+			company = `+latest(eventstore.DetailCompany)+`,
+			address = `+latest(eventstore.DetailAddress)+`,
+			website = `+latest(eventstore.DetailWebsite)+`,
+			phones  = (SELECT NULLIF(json_group_array(value), '[]') FROM (
+			             SELECT value FROM contact_details d
+			             WHERE `+contactDetailsOf+` AND d.field = 'phone'
+			             ORDER BY msg_date DESC, seen_count DESC LIMIT ?)),
+			enriched_at = (SELECT MAX(last_seen) FROM contact_details d
+			               WHERE `+contactDetailsOf+`)
+		WHERE `+where, args...)
+	if err != nil {
+		return fmt.Errorf("failed to refresh contact details: %w", err)
+	}
+	return nil
+}
+
+// ContactDetails returns the signature details recorded for an address and
+// the addresses merged with it, with their provenance, newest first
+func (s *Store) ContactDetails(ctx context.Context, email string) ([]ContactDetail, error) {
+	_, email = parseContact(email)
+	primary, err := resolveContact(ctx, s.read, s.userID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT email, field, value, event_id, provider, provider_message_id, msg_date, first_seen, last_seen, seen_count
+		FROM contact_details
+		WHERE user_id = ? AND (email = ? OR email IN (SELECT email FROM contact_aliases WHERE user_id = ? AND primary_email = ?))
+		ORDER BY msg_date DESC, field, value
+	`, s.userID, primary, s.userID, primary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact details: %w", err)
+	}
+	defer rows.Close()
+
+	var details []ContactDetail
+	for rows.Next() {
+		var d ContactDetail
+		if err := rows.Scan(&d.Email, &d.Field, &d.Value, &d.EventID, &d.Provider, &d.ProviderMessageID, &d.MsgDate, &d.FirstSeen, &d.LastSeen, &d.SeenCount); err != nil {
+			return nil, fmt.Errorf("failed to scan contact detail: %w", err)
+		}
+		details = append(details, d)
+	}
+	return details, rows.Err()
+}
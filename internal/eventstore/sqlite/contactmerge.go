@@ -0,0 +1,321 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// contactAliases maps merged addresses to the contact they count towards
+type contactAliases map[string]string
+
+// resolve returns the contact an address counts towards
+func (a contactAliases) resolve(email string) string {
+	if primary, ok := a[email]; ok {
+		return primary
+	}
+	return email
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// loadContactAliases returns a user's merged addresses
+func loadContactAliases(ctx context.Context, q queryer, userID string) (contactAliases, error) {
+	rows, err := q.QueryContext(ctx, `SELECT email, primary_email FROM contact_aliases WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact aliases: %w", err)
+	}
+	defer rows.Close()
+
+	aliases := contactAliases{}
+	for rows.Next() {
+		var email, primary string
+		if err := rows.Scan(&email, &primary); err != nil {
+			return nil, fmt.Errorf("failed to scan contact alias: %w", err)
+		}
+		aliases[email] = primary
+	}
+	return aliases, rows.Err()
+}
+
+// resolveContact returns the contact an address counts towards
+func resolveContact(ctx context.Context, q queryer, userID, email string) (string, error) {
+	var primary string
+	err := q.QueryRowContext(ctx, `
+		SELECT primary_email FROM contact_aliases WHERE user_id = ? AND email = ?
+	`, userID, email).Scan(&primary)
+	if errors.Is(err, sql.ErrNoRows) {
+		return email, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve contact: %w", err)
+	}
+	return primary, nil
+}
+
+// MergeContactsTx merges m.Merged into m.Primary. Addresses already merged
+// into one of m.Merged follow it to the new primary. The contacts involved
+// are re-derived from the stored messages; the primary keeps its score until
+// the next scoring run.
+func (s *Store) MergeContactsTx(ctx context.Context, tx *sql.Tx, m *ContactMerge) error {
+	_, m.Primary = parseContact(m.Primary)
+	var merged []string
+	seen := map[string]bool{}
+	for _, raw := range m.Merged {
+		_, email := parseContact(raw)
+		if email == "" || seen[email] {
+			continue
+		}
+		if email == m.Primary {
+			return fmt.Errorf("%w: can't merge %s into itself", ErrInvalidMerge, email)
+		}
+		seen[email] = true
+		merged = append(merged, email)
+	}
+	if m.Primary == "" || len(merged) == 0 {
+		return fmt.Errorf("%w: a primary contact and an address to merge are required", ErrInvalidMerge)
+	}
+	m.Merged = merged
+
+	aliases, err := loadContactAliases(ctx, tx, s.userID)
+	if err != nil {
+		return err
+	}
+	for _, email := range append([]string{m.Primary}, m.Merged...) {
+		if primary, ok := aliases[email]; ok {
+			return fmt.Errorf("%w: %s is already merged into %s", ErrInvalidMerge, email, primary)
+		}
+		var isSelf bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT is_self FROM contacts WHERE user_id = ? AND email = ?
+		`, s.userID, email).Scan(&isSelf)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("contact %s: %w", email, eventstore.ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load contact: %w", err)
+		}
+		if isSelf {
+			return fmt.Errorf("%w: %s is the user's own address", ErrInvalidMerge, email)
+		}
+	}
+
+	m.MergedAt = time.Now().Unix()
+	list, _ := json.Marshal(m.Merged)
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO contact_merges (user_id, id, primary_email, merged, merged_at) VALUES (?, ?, ?, ?, ?)
+	`, s.userID, m.ID, m.Primary, string(list), m.MergedAt); err != nil {
+		return fmt.Errorf("failed to save contact merge: %w", err)
+	}
+
+	affected := append([]string{m.Primary}, m.Merged...)
+	for _, email := range m.Merged {
+		for alias, primary := range aliases {
+			if primary == email {
+				affected = append(affected, alias)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE contact_aliases SET primary_email = ? WHERE user_id = ? AND primary_email = ?
+		`, m.Primary, s.userID, email); err != nil {
+			return fmt.Errorf("failed to move contact aliases: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO contact_aliases (user_id, email, primary_email, merge_id) VALUES (?, ?, ?, ?)
+		`, s.userID, email, m.Primary, m.ID); err != nil {
+			return fmt.Errorf("failed to save contact alias: %w", err)
+		}
+	}
+	return rederiveContactsTx(ctx, tx, s.userID, affected)
+}
+
+// UndoContactMergeTx splits a merge's addresses out of its primary contact.
+// Later merges are kept: an address merged into one of them still counts
+// towards that merge's primary.
+func (s *Store) UndoContactMergeTx(ctx context.Context, tx *sql.Tx, id string) (*ContactMerge, error) {
+	merges, err := queryContactMerges(ctx, tx, `WHERE user_id = ? AND id = ?`, s.userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(merges) == 0 {
+		return nil, fmt.Errorf("contact merge %s: %w", id, eventstore.ErrNotFound)
+	}
+	m := &merges[0]
+	if m.UndoneAt != 0 {
+		return nil, fmt.Errorf("%w: merge %s was already undone", ErrInvalidMerge, id)
+	}
+
+	// Everything counting towards the merge's current primary is re-derived
+	aliases, err := loadContactAliases(ctx, tx, s.userID)
+	if err != nil {
+		return nil, err
+	}
+	current := aliases.resolve(m.Primary)
+	affected := []string{current}
+	for alias, primary := range aliases {
+		if primary == current {
+			affected = append(affected, alias)
+		}
+	}
+
+	m.UndoneAt = time.Now().Unix()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE contact_merges SET undone_at = ? WHERE user_id = ? AND id = ?
+	`, m.UndoneAt, s.userID, id); err != nil {
+		return nil, fmt.Errorf("failed to undo contact merge: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM contact_aliases WHERE user_id = ? AND merge_id = ?
+	`, s.userID, id); err != nil {
+		return nil, fmt.Errorf("failed to delete contact aliases: %w", err)
+	}
+	if err := flattenContactAliasesTx(ctx, tx, s.userID); err != nil {
+		return nil, err
+	}
+	if err := rederiveContactsTx(ctx, tx, s.userID, affected); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// flattenContactAliasesTx points every alias at the end of its chain of
+// merges: the primary of its own merge, or, if that primary was merged
+// later, where that one points
+func flattenContactAliasesTx(ctx context.Context, tx *sql.Tx, userID string) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT a.email, a.primary_email, m.primary_email
+		FROM contact_aliases a
+		JOIN contact_merges m ON m.user_id = a.user_id AND m.id = a.merge_id
+		WHERE a.user_id = ?
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query contact aliases: %w", err)
+	}
+	current := map[string]string{}
+	direct := map[string]string{}
+	for rows.Next() {
+		var email, primary, mergedInto string
+		if err := rows.Scan(&email, &primary, &mergedInto); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan contact alias: %w", err)
+		}
+		current[email], direct[email] = primary, mergedInto
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for email := range direct {
+		// A merge's primary wasn't an alias when it was made, so chains end
+		primary := direct[email]
+		for i := 0; i < len(direct); i++ {
+			next, ok := direct[primary]
+			if !ok {
+				break
+			}
+			primary = next
+		}
+		if primary == current[email] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE contact_aliases SET primary_email = ? WHERE user_id = ? AND email = ?
+		`, primary, userID, email); err != nil {
+			return fmt.Errorf("failed to update contact alias: %w", err)
+		}
+	}
+	return nil
+}
+
+// rederiveContactsTx re-derives the contacts of addresses whose merges
+// changed from the stored messages. Rows of merged addresses are removed;
+// primaries keep their scores.
+func rederiveContactsTx(ctx context.Context, tx *sql.Tx, userID string, emails []string) error {
+	aliases, err := loadContactAliases(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	primaries := map[string]bool{}
+	for _, email := range emails {
+		primary := aliases.resolve(email)
+		primaries[primary] = true
+		if primary == email {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM contacts WHERE user_id = ? AND email = ?`, userID, email); err != nil {
+			return fmt.Errorf("failed to delete merged contact: %w", err)
+		}
+	}
+	for email := range primaries {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE contacts SET name = '', first_seen = ?, last_seen = 0,
+			       from_count = 0, to_count = 0, cc_count = 0, sent_count = 0, is_self = 0
+			WHERE user_id = ? AND email = ?
+		`, int64(math.MaxInt64), userID, email); err != nil {
+			return fmt.Errorf("failed to reset contact: %w", err)
+		}
+	}
+
+	events, err := contactEventsTx(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if err := applyContactsTx(ctx, tx, ev, aliases, primaries); err != nil {
+			return err
+		}
+	}
+
+	for email := range primaries {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM contacts WHERE user_id = ? AND email = ? AND last_seen = 0
+		`, userID, email); err != nil {
+			return fmt.Errorf("failed to delete contact: %w", err)
+		}
+		if err := refreshContactDetailsTx(ctx, tx, userID, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContactMerges returns the user's contact merges, newest first
+func (s *Store) ContactMerges(ctx context.Context) ([]ContactMerge, error) {
+	return queryContactMerges(ctx, s.read, `WHERE user_id = ? ORDER BY merged_at DESC, id`, s.userID)
+}
+
+func queryContactMerges(ctx context.Context, q queryer, where string, args ...any) ([]ContactMerge, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, primary_email, merged, merged_at, COALESCE(undone_at, 0)
+		FROM contact_merges `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact merges: %w", err)
+	}
+	defer rows.Close()
+
+	var merges []ContactMerge
+	for rows.Next() {
+		var (
+			m      ContactMerge
+			merged string
+		)
+		if err := rows.Scan(&m.ID, &m.Primary, &merged, &m.MergedAt, &m.UndoneAt); err != nil {
+			return nil, fmt.Errorf("failed to scan contact merge: %w", err)
+		}
+		m.Merged = jsonList(merged)
+		merges = append(merges, m)
+	}
+	return merges, rows.Err()
+}
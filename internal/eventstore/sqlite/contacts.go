@@ -0,0 +1,357 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// contactsSchema is created by ensureContacts so existing databases can be
+// backfilled from their stored messages the first time
+var contactsSchema = []string{
+	`CREATE TABLE IF NOT EXISTS contacts (
+		user_id     TEXT NOT NULL,
+		email       TEXT NOT NULL,                    -- lowercased address
+		name        TEXT NOT NULL DEFAULT '',         -- most recent display name
+		first_seen  INTEGER NOT NULL,
+		last_seen   INTEGER NOT NULL,
+		from_count  INTEGER NOT NULL DEFAULT 0,       -- messages they sent
+		to_count    INTEGER NOT NULL DEFAULT 0,       -- messages with them in To
+		cc_count    INTEGER NOT NULL DEFAULT 0,       -- messages with them in Cc
+		sent_count  INTEGER NOT NULL DEFAULT 0,       -- messages the user sent them
+		is_self     INTEGER NOT NULL DEFAULT 0,       -- the user's own address
+		score       REAL,                             -- relationship score (internal/relationship)
+		reply_rate  REAL,
+		initiation  REAL,                             -- initiation balance
+		scored_at   INTEGER,
+		title       TEXT,                             -- signature details (contact_details)
+		company     TEXT,
+		phones      TEXT,                             -- JSON array
+		address     TEXT,
+		website     TEXT,
+		enriched_at INTEGER,
+		PRIMARY KEY (user_id, email)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_contacts_last_seen ON contacts(user_id, last_seen DESC)`,
+}
+
+// contactScoreColumns were added to contacts after its initial release
+var contactScoreColumns = []struct{ name, decl string }{
+	{"score", "REAL"},
+	{"reply_rate", "REAL"},
+	{"initiation", "REAL"},
+	{"scored_at", "INTEGER"},
+}
+
+// contactDetailColumns were added to contacts with signature enrichment
+var contactDetailColumns = []struct{ name, decl string }{
+	{"title", "TEXT"},
+	{"company", "TEXT"},
+	{"phones", "TEXT"},
+	{"address", "TEXT"},
+	{"website", "TEXT"},
+	{"enriched_at", "INTEGER"},
+}
+
+// ensureContacts creates the contacts table, backfilling a per-user database
+// (userID set) from its stored messages the first time
+func ensureContacts(db *sql.DB, userID string) error {
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'contacts'`).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check contacts table: %w", err)
+	}
+
+	// Contacts are derived data: recreate tables from before user scoping
+	if exists == 1 {
+		scoped, err := hasColumn(db, "contacts", "user_id")
+		if err != nil {
+			return err
+		}
+		if !scoped {
+			if _, err := db.Exec(`DROP TABLE contacts`); err != nil {
+				return fmt.Errorf("failed to drop contacts table: %w", err)
+			}
+			exists = 0
+		}
+	}
+
+	for _, stmt := range contactsSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create contacts table: %w", err)
+		}
+	}
+	for _, col := range append(contactScoreColumns, contactDetailColumns...) {
+		exists, err := hasColumn(db, "contacts", col.name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if _, err := db.Exec("ALTER TABLE contacts ADD COLUMN " + col.name + " " + col.decl); err != nil {
+				return fmt.Errorf("failed to add contacts.%s: %w", col.name, err)
+			}
+		}
+	}
+
+	if exists == 0 && userID != "" {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := rebuildContactsTx(context.Background(), tx, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	return nil
+}
+
+// rebuildContactsTx re-derives a user's contacts from their stored messages
+func rebuildContactsTx(ctx context.Context, tx *sql.Tx, userID string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM contacts WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to clear contacts: %w", err)
+	}
+
+	aliases, err := loadContactAliases(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	events, err := contactEventsTx(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if err := applyContactsTx(ctx, tx, ev, aliases, nil); err != nil {
+			return err
+		}
+	}
+	return refreshContactDetailsTx(ctx, tx, userID, "")
+}
+
+// contactEventsTx reads the address fields of a user's stored messages
+func contactEventsTx(ctx context.Context, tx *sql.Tx, userID string) ([]EmailEvent, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT ts, COALESCE(msg_date, 0), COALESCE(sender, ''), COALESCE(to_addrs, ''), COALESCE(cc_addrs, ''),
+		       COALESCE(folder, ''), COALESCE(kind, ''), COALESCE(is_list, 0)
+		FROM email_received_events
+		WHERE user_id = ? AND deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+	defer rows.Close()
+
+	var events []EmailEvent
+	for rows.Next() {
+		ev := EmailEvent{UserID: userID}
+		if err := rows.Scan(&ev.TS, &ev.MsgDate, &ev.Sender, &ev.ToAddrs, &ev.CcAddrs, &ev.Folder, &ev.Kind, &ev.IsList); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// contactDelta is one address's contribution from a single message
+type contactDelta struct {
+	name                       string
+	from, to, cc, sent, isSelf int
+}
+
+// updateContactsTx records the addresses of a newly stored message. List mail,
+// bounces and auto-replies are skipped so contacts stay person-to-person.
+func updateContactsTx(ctx context.Context, tx *sql.Tx, ev EmailEvent) error {
+	if ev.IsList || (ev.Kind != "" && ev.Kind != "message") {
+		return nil
+	}
+	aliases, err := loadContactAliases(ctx, tx, ev.UserID)
+	if err != nil {
+		return err
+	}
+	return applyContactsTx(ctx, tx, ev, aliases, nil)
+}
+
+// applyContactsTx adds a message to the contacts of its addresses, merged
+// addresses counting towards their primary. With only set, other contacts
+// are left alone.
+func applyContactsTx(ctx context.Context, tx *sql.Tx, ev EmailEvent, aliases contactAliases, only map[string]bool) error {
+	if ev.IsList || (ev.Kind != "" && ev.Kind != "message") {
+		return nil
+	}
+
+	seen := ev.MsgDate
+	if seen == 0 {
+		seen = ev.TS
+	}
+	sent := ev.Folder == "sent"
+
+	deltas := map[string]*contactDelta{}
+	add := func(raw string, apply func(*contactDelta)) {
+		name, email := parseContact(raw)
+		email = aliases.resolve(email)
+		if email == "" || (only != nil && !only[email]) {
+			return
+		}
+		d, ok := deltas[email]
+		if !ok {
+			d = &contactDelta{}
+			deltas[email] = d
+		}
+		if name != "" {
+			d.name = name
+		}
+		apply(d)
+	}
+
+	if sent {
+		// The sender of a sent message is the user
+		add(ev.Sender, func(d *contactDelta) { d.isSelf = 1 })
+	} else {
+		add(ev.Sender, func(d *contactDelta) { d.from = 1 })
+	}
+	for _, addr := range jsonList(ev.ToAddrs) {
+		add(addr, func(d *contactDelta) {
+			d.to = 1
+			if sent {
+				d.sent = 1
+			}
+		})
+	}
+	for _, addr := range jsonList(ev.CcAddrs) {
+		add(addr, func(d *contactDelta) {
+			d.cc = 1
+			if sent {
+				d.sent = 1
+			}
+		})
+	}
+
+	for email, d := range deltas {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO contacts (user_id, email, name, first_seen, last_seen, from_count, to_count, cc_count, sent_count, is_self)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, email) DO UPDATE SET
+				name = CASE WHEN excluded.name != '' AND (contacts.name = '' OR excluded.last_seen >= contacts.last_seen)
+				            THEN excluded.name ELSE contacts.name END,
+				first_seen = MIN(contacts.first_seen, excluded.first_seen),
+				last_seen  = MAX(contacts.last_seen, excluded.last_seen),
+				from_count = contacts.from_count + excluded.from_count,
+				to_count   = contacts.to_count + excluded.to_count,
+				cc_count   = contacts.cc_count + excluded.cc_count,
+				sent_count = contacts.sent_count + excluded.sent_count,
+				is_self    = MAX(contacts.is_self, excluded.is_self)
+		`, ev.UserID, email, d.name, seen, seen, d.from, d.to, d.cc, d.sent, d.isSelf)
+		if err != nil {
+			return fmt.Errorf("failed to update contact: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseContact splits "Name <addr>" (or a bare address) into a display name
+// and lowercased address
+func parseContact(raw string) (name, email string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ""
+	}
+	if addr, err := mail.ParseAddress(raw); err == nil {
+		return strings.TrimSpace(addr.Name), strings.ToLower(addr.Address)
+	}
+
+	// Fall back to a bare "<addr>" or address-like string
+	if open := strings.LastIndex(raw, "<"); open >= 0 {
+		if close := strings.Index(raw[open:], ">"); close > 0 {
+			name = strings.Trim(strings.TrimSpace(raw[:open]), `"`)
+			raw = raw[open+1 : open+close]
+		}
+	}
+	if !strings.Contains(raw, "@") {
+		return "", ""
+	}
+	return name, strings.ToLower(strings.TrimSpace(raw))
+}
+
+// jsonList decodes a JSON string array column, ignoring malformed values
+func jsonList(s string) []string {
+	var list []string
+	_ = json.Unmarshal([]byte(s), &list)
+	return list
+}
+
+// contactOrder maps sort names to ORDER BY clauses
+var contactOrder = map[string]string{
+	ContactSortStrength: "strength DESC, last_seen DESC",
+	ContactSortScore:    "COALESCE(score, 0) DESC, last_seen DESC",
+	ContactSortRecent:   "last_seen DESC",
+	ContactSortCount:    "(from_count + to_count + cc_count) DESC, last_seen DESC",
+	ContactSortName:     "COALESCE(NULLIF(name, ''), email) COLLATE NOCASE ASC",
+}
+
+// ListContacts returns the user's contacts, excluding their own addresses.
+// Interaction strength weighs mail the user sent (3) over mail received from
+// the contact (1) and shared To/Cc (0.5), decayed by time since last contact
+// (halved after 30 days).
+func (s *Store) ListContacts(ctx context.Context, q ContactQuery) ([]Contact, error) {
+	if q.Sort == "" {
+		q.Sort = ContactSortStrength
+	}
+	order, ok := contactOrder[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w %q (want strength, score, recent, count or name)", ErrInvalidSort, q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+
+	where := "user_id = ? AND is_self = 0"
+	args := []interface{}{time.Now().Unix(), s.userID}
+	if q.Search != "" {
+		where += ` AND (email LIKE ? ESCAPE '\' OR name LIKE ? ESCAPE '\' OR email IN (
+			SELECT primary_email FROM contact_aliases WHERE user_id = contacts.user_id AND email LIKE ? ESCAPE '\'))`
+		pattern := likePattern(q.Search)
+		args = append(args, pattern, pattern, pattern)
+	}
+	args = append(args, q.Limit)
+
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT email, name, first_seen, last_seen, from_count, to_count, cc_count, sent_count,
+		       (3.0 * sent_count + from_count + 0.5 * (to_count + cc_count - sent_count))
+		         / (1.0 + MAX(? - last_seen, 0) / (30.0 * 86400)) AS strength,
+		       COALESCE(score, 0), COALESCE(reply_rate, 0), COALESCE(initiation, 0), COALESCE(scored_at, 0),
+		       COALESCE(title, ''), COALESCE(company, ''), COALESCE(phones, ''), COALESCE(address, ''),
+		       COALESCE(website, ''), COALESCE(enriched_at, 0),
+		       COALESCE((SELECT json_group_array(email) FROM contact_aliases a
+		                 WHERE a.user_id = contacts.user_id AND a.primary_email = contacts.email), '')
+		FROM contacts
+		WHERE `+where+`
+		ORDER BY `+order+`
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contacts: %w", err)
+	}
+	defer rows.Close()
+
+	var contacts []Contact
+	for rows.Next() {
+		var (
+			c               Contact
+			phones, aliases string
+		)
+		if err := rows.Scan(&c.Email, &c.Name, &c.FirstSeen, &c.LastSeen, &c.FromCount, &c.ToCount, &c.CcCount, &c.SentCount, &c.Strength,
+			&c.Score, &c.ReplyRate, &c.InitiationBalance, &c.ScoredAt,
+			&c.Title, &c.Company, &phones, &c.Address, &c.Website, &c.EnrichedAt, &aliases); err != nil {
+			return nil, fmt.Errorf("failed to scan contact: %w", err)
+		}
+		c.Phones = jsonList(phones)
+		c.Aliases = jsonList(aliases)
+		contacts = append(contacts, c)
+	}
+	return contacts, rows.Err()
+}
@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ContactStats returns every contact's exchanges with the user since since,
+// read thread by thread from person-to-person mail: who started each thread,
+// and which of a contact's messages the user answered later in the thread.
+// Mail with merged addresses counts towards their primary contact. Contacts
+// with no mail in the window are returned with zero counts so their scores
+// can decay.
+func (s *Store) ContactStats(ctx context.Context, since int64) ([]ContactStats, error) {
+	byEmail := map[string]*ContactStats{}
+	var order []string
+
+	aliases, err := loadContactAliases(ctx, s.read, s.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT email, last_seen, COALESCE(score, 0), COALESCE(scored_at, 0)
+		FROM contacts
+		WHERE user_id = ? AND is_self = 0
+		ORDER BY email
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contacts: %w", err)
+	}
+	for rows.Next() {
+		var st ContactStats
+		if err := rows.Scan(&st.Email, &st.LastSeen, &st.Score, &st.ScoredAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan contact: %w", err)
+		}
+		byEmail[st.Email] = &st
+		order = append(order, st.Email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read contacts: %w", err)
+	}
+
+	rows, err = s.read.QueryContext(ctx, `
+		SELECT provider, COALESCE(NULLIF(provider_thread_id, ''), event_id), COALESCE(folder, '') = 'sent',
+		       COALESCE(sender, ''), COALESCE(to_addrs, ''), COALESCE(cc_addrs, '')
+		FROM email_received_events
+		WHERE user_id = ? AND deleted_at IS NULL AND msg_date >= ?
+		  AND COALESCE(is_list, 0) = 0 AND COALESCE(kind, 'message') = 'message'
+		ORDER BY provider, 2, msg_date, event_id
+	`, s.userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	type message struct {
+		sent       bool
+		sender     string
+		recipients []string
+	}
+	var (
+		thread       []message
+		lastProvider string
+		lastThread   string
+	)
+	flush := func() {
+		if len(thread) == 0 {
+			return
+		}
+		first := thread[0]
+		if first.sent {
+			for _, email := range first.recipients {
+				if st := byEmail[email]; st != nil {
+					st.UserStarted++
+				}
+			}
+		} else if st := byEmail[first.sender]; st != nil {
+			st.TheyStarted++
+		}
+
+		// Walk back so each received message knows whether the user wrote after it
+		userLater := false
+		for i := len(thread) - 1; i >= 0; i-- {
+			m := thread[i]
+			if m.sent {
+				userLater = true
+				for _, email := range m.recipients {
+					if st := byEmail[email]; st != nil {
+						st.Sent++
+					}
+				}
+				continue
+			}
+			if st := byEmail[m.sender]; st != nil {
+				st.Received++
+				if userLater {
+					st.Replied++
+				}
+			}
+		}
+		thread = thread[:0]
+	}
+
+	for rows.Next() {
+		var (
+			provider, threadID, sender, to, cc string
+			sent                               bool
+		)
+		if err := rows.Scan(&provider, &threadID, &sent, &sender, &to, &cc); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if provider != lastProvider || threadID != lastThread {
+			flush()
+			lastProvider, lastThread = provider, threadID
+		}
+
+		m := message{sent: sent}
+		_, m.sender = parseContact(sender)
+		m.sender = aliases.resolve(m.sender)
+		seen := map[string]bool{}
+		for _, raw := range append(jsonList(to), jsonList(cc)...) {
+			_, email := parseContact(raw)
+			if email = aliases.resolve(email); email != "" && !seen[email] {
+				seen[email] = true
+				m.recipients = append(m.recipients, email)
+			}
+		}
+		thread = append(thread, m)
+	}
+	if err := rows.Err(); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+	flush()
+
+	stats := make([]ContactStats, 0, len(order))
+	for _, email := range order {
+		stats = append(stats, *byEmail[email])
+	}
+	return stats, nil
+}
+
+// LoadContactScore returns the relationship score of an address (that of
+// its primary contact if it was merged), 0 if it isn't a scored contact
+func (s *Store) LoadContactScore(ctx context.Context, address string) (float64, error) {
+	_, email := parseContact(address)
+	if email == "" {
+		return 0, nil
+	}
+	var score float64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(score, 0) FROM contacts
+		WHERE user_id = ? AND is_self = 0
+		  AND email = COALESCE((SELECT primary_email FROM contact_aliases WHERE user_id = ? AND email = ?), ?)
+	`, s.userID, s.userID, email, email).Scan(&score)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to load contact score: %w", err)
+	}
+	return score, nil
+}
+
+// SaveContactScoreTx stores a contact's relationship score
+func (s *Store) SaveContactScoreTx(ctx context.Context, tx *sql.Tx, score ContactScore) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE contacts SET score = ?, reply_rate = ?, initiation = ?, scored_at = ?
+		WHERE user_id = ? AND email = ?
+	`, score.Score, score.ReplyRate, score.InitiationBalance, score.ScoredAt, s.userID, score.Email)
+	if err != nil {
+		return fmt.Errorf("failed to save contact score: %w", err)
+	}
+	return nil
+}
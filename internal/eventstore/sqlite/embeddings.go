@@ -0,0 +1,253 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+)
+
+// SaveEmbedding stores a message's vector, replacing an earlier one
+func (s *Store) SaveEmbedding(ctx context.Context, e MessageEmbedding) error {
+	_, err := s.exec(ctx, "save_embedding", `
+		INSERT INTO message_embeddings (user_id, provider, provider_message_id, model, dims, vector, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, provider, provider_message_id) DO UPDATE SET
+			model = excluded.model, dims = excluded.dims, vector = excluded.vector, created_at = excluded.created_at
+	`, s.userID, e.Provider, e.ProviderMessageID, e.Model, len(e.Vector), encodeVector(e.Vector), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save embedding: %w", err)
+	}
+	return nil
+}
+
+// SemanticSearch compares q.Vector with the vectors of the messages matching
+// q.Filter and returns the closest, best first. Vectors are scanned in full;
+// a user's mailbox is small enough that this beats keeping an index in sync.
+func (s *Store) SemanticSearch(ctx context.Context, q SemanticQuery) ([]ScoredMessage, error) {
+	filter := &search.Query{}
+	if q.Filter != nil {
+		for _, c := range q.Filter.Clauses {
+			if c.Field != search.FieldText {
+				filter.Clauses = append(filter.Clauses, c)
+			}
+		}
+	}
+	where, args := searchWhere(filter)
+
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT e.event_id, v.vector
+		FROM message_embeddings v
+		JOIN (SELECT event_id, provider, provider_message_id FROM email_received_events
+		      WHERE user_id = ? AND `+where+`) e
+		  ON e.provider = v.provider AND e.provider_message_id = v.provider_message_id
+		WHERE v.user_id = ? AND v.model = ? AND v.dims = ?
+	`, append(append([]interface{}{s.userID}, args...), s.userID, q.Model, len(q.Vector))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embeddings: %w", err)
+	}
+
+	type hit struct {
+		eventID string
+		score   float64
+	}
+	var hits []hit
+	for rows.Next() {
+		var (
+			eventID string
+			blob    []byte
+		)
+		if err := rows.Scan(&eventID, &blob); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan embedding: %w", err)
+		}
+		if score := llm.Cosine(q.Vector, decodeVector(blob)); score >= q.MinScore {
+			hits = append(hits, hit{eventID, score})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	if len(hits) == 0 {
+		return []ScoredMessage{}, nil
+	}
+
+	placeholders := make([]string, len(hits))
+	args = []interface{}{s.userID}
+	for i, h := range hits {
+		placeholders[i] = "?"
+		args = append(args, h.eventID)
+	}
+	rows, err = s.read.QueryContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM email_received_events
+		WHERE user_id = ? AND event_id IN (`+strings.Join(placeholders, ", ")+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]StoredMessage, len(hits))
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[m.EventID] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	msgs := make([]ScoredMessage, 0, len(hits))
+	for _, h := range hits {
+		if m, ok := byID[h.eventID]; ok {
+			msgs = append(msgs, ScoredMessage{StoredMessage: m, Score: math.Round(h.score*1000) / 1000})
+		}
+	}
+	return msgs, nil
+}
+
+// encodeVector packs a vector as little-endian float32s
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+// decodeVector unpacks a vector stored by encodeVector
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+// unembedded selects the messages after a cursor with no vector from a model.
+// Auto-replies and bounces aren't email.received events, so they aren't
+// embedded either.
+const unembedded = `
+	FROM email_received_events e
+	WHERE e.user_id = ? AND e.rowid > ? AND e.deleted_at IS NULL
+	  AND COALESCE(e.kind, 'message') = 'message'
+	  AND NOT EXISTS (
+	    SELECT 1 FROM message_embeddings v
+	    WHERE v.user_id = e.user_id AND v.provider = e.provider
+	      AND v.provider_message_id = e.provider_message_id AND v.model = ?
+	  )`
+
+// attachmentText selects the extracted text of a message's attachments
+const attachmentText = `(SELECT COALESCE(group_concat(a.text, char(10)), '') FROM attachments a
+	WHERE a.user_id = e.user_id AND a.event_id = e.event_id AND a.status = 'extracted')`
+
+// UnembeddedMessages returns up to limit messages after the cursor (a rowid)
+// with no vector from model, oldest stored first
+func (s *Store) UnembeddedMessages(ctx context.Context, model string, after int64, limit int) ([]EmbeddingSource, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT e.rowid, e.provider, e.provider_message_id, COALESCE(e.subject, ''), COALESCE(e.sender, ''), COALESCE(e.snippet, ''),
+		       `+attachmentText+`
+		`+unembedded+`
+		ORDER BY e.rowid
+		LIMIT ?
+	`, s.userID, after, model, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unembedded messages: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []EmbeddingSource
+	for rows.Next() {
+		var m EmbeddingSource
+		if err := rows.Scan(&m.Seq, &m.Provider, &m.ProviderMessageID, &m.Subject, &m.Sender, &m.Snippet, &m.Attachments); err != nil {
+			return nil, fmt.Errorf("failed to scan unembedded message: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read unembedded messages: %w", err)
+	}
+	return msgs, nil
+}
+
+// LoadEmbeddingSource returns the text inputs of a stored message, nil if
+// unknown
+func (s *Store) LoadEmbeddingSource(ctx context.Context, provider, providerMessageID string) (*EmbeddingSource, error) {
+	var m EmbeddingSource
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT e.rowid, e.provider, e.provider_message_id, COALESCE(e.subject, ''), COALESCE(e.sender, ''), COALESCE(e.snippet, ''),
+		       `+attachmentText+`
+		FROM email_received_events e
+		WHERE e.user_id = ? AND e.provider = ? AND e.provider_message_id = ? AND e.deleted_at IS NULL
+	`, s.userID, provider, providerMessageID).Scan(&m.Seq, &m.Provider, &m.ProviderMessageID, &m.Subject, &m.Sender, &m.Snippet, &m.Attachments)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message: %w", err)
+	}
+	return &m, nil
+}
+
+// LoadEmbeddingBackfill returns the backfill progress for model, nil if it
+// never ran
+func (s *Store) LoadEmbeddingBackfill(ctx context.Context, model string) (*EmbeddingBackfill, error) {
+	var (
+		b          = EmbeddingBackfill{Model: model}
+		lastError  sql.NullString
+		finishedAt sql.NullInt64
+	)
+	err := s.read.QueryRowContext(ctx, `
+		SELECT status, cursor, embedded, skipped, last_error, started_at, updated_at, finished_at
+		FROM embedding_backfills WHERE user_id = ? AND model = ?
+	`, s.userID, model).Scan(&b.Status, &b.Cursor, &b.Embedded, &b.Skipped, &lastError, &b.StartedAt, &b.UpdatedAt, &finishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedding backfill: %w", err)
+	}
+	b.LastError, b.FinishedAt = lastError.String, finishedAt.Int64
+
+	if err := s.read.QueryRowContext(ctx, `SELECT COUNT(*) `+unembedded, s.userID, b.Cursor, model).Scan(&b.Remaining); err != nil {
+		return nil, fmt.Errorf("failed to count unembedded messages: %w", err)
+	}
+	return &b, nil
+}
+
+// SaveEmbeddingBackfill records backfill progress
+func (s *Store) SaveEmbeddingBackfill(ctx context.Context, b *EmbeddingBackfill) error {
+	b.UpdatedAt = time.Now().Unix()
+	if b.StartedAt == 0 {
+		b.StartedAt = b.UpdatedAt
+	}
+	_, err := s.exec(ctx, "save_embedding_backfill", `
+		INSERT INTO embedding_backfills (user_id, model, status, cursor, embedded, skipped, last_error, started_at, updated_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, 0))
+		ON CONFLICT(user_id, model) DO UPDATE SET
+			status = excluded.status, cursor = excluded.cursor, embedded = excluded.embedded, skipped = excluded.skipped,
+			last_error = excluded.last_error, started_at = excluded.started_at, updated_at = excluded.updated_at,
+			finished_at = excluded.finished_at
+	`, s.userID, b.Model, b.Status, b.Cursor, b.Embedded, b.Skipped, b.LastError, b.StartedAt, b.UpdatedAt, b.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save embedding backfill: %w", err)
+	}
+	return nil
+}
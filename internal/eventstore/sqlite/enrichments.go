@@ -0,0 +1,226 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EnrichmentSources returns up to limit stored messages after the cursor (a
+// rowid), oldest stored first. Like the enrichment projection, which reads
+// email.received, it skips auto-replies and bounces, and deleted messages.
+func (s *Store) EnrichmentSources(ctx context.Context, after int64, limit int) ([]EnrichmentSource, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT rowid, event_id, ts, COALESCE(msg_date, 0), provider, COALESCE(inbox_id, ''), provider_message_id,
+		       COALESCE(provider_thread_id, ''), COALESCE(subject, ''), COALESCE(sender, ''),
+		       COALESCE(to_addrs, ''), COALESCE(cc_addrs, ''), COALESCE(snippet, ''),
+		       COALESCE(decompress(headers_json), ''), COALESCE(kind, 'message'), COALESCE(is_list, 0)
+		FROM email_received_events
+		WHERE user_id = ? AND rowid > ? AND deleted_at IS NULL AND COALESCE(kind, 'message') = 'message'
+		ORDER BY rowid
+		LIMIT ?
+	`, s.userID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query enrichment sources: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []EnrichmentSource
+	for rows.Next() {
+		var (
+			m               EnrichmentSource
+			to, cc, headers string
+		)
+		if err := rows.Scan(&m.Seq, &m.EventID, &m.TS, &m.MsgDate, &m.Provider, &m.InboxID, &m.ProviderMessageID,
+			&m.ProviderThreadID, &m.Subject, &m.Sender, &to, &cc, &m.Snippet, &headers, &m.Kind, &m.IsList); err != nil {
+			return nil, fmt.Errorf("failed to scan enrichment source: %w", err)
+		}
+		_ = json.Unmarshal([]byte(to), &m.To)
+		_ = json.Unmarshal([]byte(cc), &m.Cc)
+		_ = json.Unmarshal([]byte(headers), &m.Headers)
+		sources = append(sources, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read enrichment sources: %w", err)
+	}
+	return sources, nil
+}
+
+// SaveEnrichmentOutputsTx replaces a version's outputs for a message within tx
+func (s *Store) SaveEnrichmentOutputsTx(ctx context.Context, tx *sql.Tx, version, sourceEventID string, outputs []EnrichmentOutput) error {
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM enrichment_outputs WHERE user_id = ? AND version = ? AND source_event_id = ?
+	`, s.userID, version, sourceEventID); err != nil {
+		return fmt.Errorf("failed to clear enrichment outputs: %w", err)
+	}
+
+	now := time.Now().Unix()
+	for i, o := range outputs {
+		if o.CreatedAt == 0 {
+			o.CreatedAt = now
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO enrichment_outputs (user_id, version, source_event_id, position, provider, provider_message_id,
+				enricher, event_type, payload, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, s.userID, version, sourceEventID, i, o.Provider, o.ProviderMessageID, o.Enricher, o.EventType, string(o.Payload), o.CreatedAt); err != nil {
+			return fmt.Errorf("failed to save enrichment output: %w", err)
+		}
+	}
+	return nil
+}
+
+// enrichmentRunColumns is the column list scanned by scanEnrichmentRun
+const enrichmentRunColumns = `version, status, publish, cursor, processed, derived, last_error, started_at, updated_at, finished_at`
+
+func scanEnrichmentRun(row interface{ Scan(...any) error }) (*EnrichmentRun, error) {
+	var (
+		r          EnrichmentRun
+		lastError  sql.NullString
+		finishedAt sql.NullInt64
+	)
+	if err := row.Scan(&r.Version, &r.Status, &r.Publish, &r.Cursor, &r.Processed, &r.Derived, &lastError,
+		&r.StartedAt, &r.UpdatedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	r.LastError, r.FinishedAt = lastError.String, finishedAt.Int64
+	return &r, nil
+}
+
+// LoadEnrichmentRun returns a version's re-enrichment progress, nil if it
+// never ran
+func (s *Store) LoadEnrichmentRun(ctx context.Context, version string) (*EnrichmentRun, error) {
+	r, err := scanEnrichmentRun(s.read.QueryRowContext(ctx, `
+		SELECT `+enrichmentRunColumns+` FROM enrichment_runs WHERE user_id = ? AND version = ?
+	`, s.userID, version))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrichment run: %w", err)
+	}
+	return r, nil
+}
+
+// EnrichmentRuns returns the user's re-enrichment runs, newest first
+func (s *Store) EnrichmentRuns(ctx context.Context) ([]EnrichmentRun, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+enrichmentRunColumns+` FROM enrichment_runs WHERE user_id = ? ORDER BY started_at DESC, version
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query enrichment runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []EnrichmentRun{}
+	for rows.Next() {
+		r, err := scanEnrichmentRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan enrichment run: %w", err)
+		}
+		runs = append(runs, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read enrichment runs: %w", err)
+	}
+	return runs, nil
+}
+
+// SaveEnrichmentRun records re-enrichment progress
+func (s *Store) SaveEnrichmentRun(ctx context.Context, r *EnrichmentRun) error {
+	r.UpdatedAt = time.Now().Unix()
+	if r.StartedAt == 0 {
+		r.StartedAt = r.UpdatedAt
+	}
+	_, err := s.exec(ctx, "save_enrichment_run", `
+		INSERT INTO enrichment_runs (user_id, `+enrichmentRunColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, NULLIF(?, 0))
+		ON CONFLICT(user_id, version) DO UPDATE SET
+			status = excluded.status, publish = excluded.publish, cursor = excluded.cursor,
+			processed = excluded.processed, derived = excluded.derived, last_error = excluded.last_error,
+			started_at = excluded.started_at, updated_at = excluded.updated_at, finished_at = excluded.finished_at
+	`, s.userID, r.Version, r.Status, r.Publish, r.Cursor, r.Processed, r.Derived, r.LastError, r.StartedAt, r.UpdatedAt, r.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save enrichment run: %w", err)
+	}
+	return nil
+}
+
+// CompareEnrichments compares the outputs of two versions message by
+// message. Outputs are equal when the same enrichers derived the same event
+// types with the same payloads, in order. Messages without outputs in either
+// version aren't compared.
+func (s *Store) CompareEnrichments(ctx context.Context, from, to string, limit int) (*EnrichmentComparison, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT version, source_event_id, provider, provider_message_id, enricher, event_type, payload, created_at
+		FROM enrichment_outputs
+		WHERE user_id = ? AND version IN (?, ?)
+		ORDER BY source_event_id, version, position
+	`, s.userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query enrichment outputs: %w", err)
+	}
+	defer rows.Close()
+
+	cmp := &EnrichmentComparison{From: from, To: to, Diffs: []EnrichmentDiff{}}
+	var cur *EnrichmentDiff
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cmp.Compared++
+		if !sameOutputs(cur.From, cur.To) {
+			cmp.Changed++
+			if len(cmp.Diffs) < limit {
+				cmp.Diffs = append(cmp.Diffs, *cur)
+			}
+		}
+	}
+	for rows.Next() {
+		var (
+			o       EnrichmentOutput
+			payload string
+		)
+		if err := rows.Scan(&o.Version, &o.SourceEventID, &o.Provider, &o.ProviderMessageID, &o.Enricher, &o.EventType, &payload, &o.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan enrichment output: %w", err)
+		}
+		o.Payload = json.RawMessage(payload)
+
+		if cur == nil || cur.SourceEventID != o.SourceEventID {
+			flush()
+			cur = &EnrichmentDiff{
+				SourceEventID:     o.SourceEventID,
+				Provider:          o.Provider,
+				ProviderMessageID: o.ProviderMessageID,
+				From:              []EnrichmentOutput{},
+				To:                []EnrichmentOutput{},
+			}
+		}
+		if o.Version == from {
+			cur.From = append(cur.From, o)
+		} else {
+			cur.To = append(cur.To, o)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read enrichment outputs: %w", err)
+	}
+	flush()
+	return cmp, nil
+}
+
+func sameOutputs(a, b []EnrichmentOutput) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Enricher != b[i].Enricher || a[i].EventType != b[i].EventType || !bytes.Equal(a[i].Payload, b[i].Payload) {
+			return false
+		}
+	}
+	return true
+}
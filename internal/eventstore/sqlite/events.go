@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// expireBatch bounds the rows one ExpireEvents delete removes, so a large
+// backlog doesn't hold the write lock for long
+const expireBatch = 1000
+
+// mailEventKinds maps mail event types to the kind of stored message they
+// describe
+var mailEventKinds = map[string]string{
+	"email.received":   "message",
+	"email.auto_reply": "auto_reply",
+	"email.bounce":     "bounce",
+}
+
+// eventTimeFormat is how events.created_at is written. It is the format the
+// earlier mattn/go-sqlite3 store used, so old and new rows compare in order.
+const eventTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// StoreEvent appends a generic event
+func (s *Store) StoreEvent(ctx context.Context, eventType, data string) (*Event, error) {
+	event := &Event{Type: eventType, Data: data, CreatedAt: time.Now()}
+	res, err := s.exec(ctx, "store_event", `
+		INSERT INTO events (user_id, type, data, created_at) VALUES (?, ?, ?, ?)
+	`, s.userID, event.Type, event.Data, event.CreatedAt.Format(eventTimeFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store event: %w", err)
+	}
+
+	if event.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("failed to get event ID: %w", err)
+	}
+	return event, nil
+}
+
+// StoreEventTx appends a generic event within tx
+func (s *Store) StoreEventTx(ctx context.Context, tx *sql.Tx, eventType, data string) (*Event, error) {
+	event := &Event{Type: eventType, Data: data, CreatedAt: time.Now()}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO events (user_id, type, data, created_at) VALUES (?, ?, ?, ?)
+	`, s.userID, event.Type, event.Data, event.CreatedAt.Format(eventTimeFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store event: %w", err)
+	}
+
+	if event.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("failed to get event ID: %w", err)
+	}
+	return event, nil
+}
+
+// GetEvents returns up to 1000 events, optionally of one type, newest first
+func (s *Store) GetEvents(ctx context.Context, eventType string) ([]Event, error) {
+	query := "SELECT id, type, data, created_at FROM events WHERE user_id = ?"
+	args := []any{s.userID}
+	if eventType != "" {
+		query += " AND type = ?"
+		args = append(args, eventType)
+	}
+	query += " ORDER BY created_at DESC LIMIT 1000"
+
+	var events []Event
+	err := s.queryEvents(ctx, query, args, func(ev Event) error {
+		events = append(events, ev)
+		return nil
+	})
+	return events, err
+}
+
+// ExportEvents calls fn for every matching event in id order, streaming rows
+// from the database instead of loading them into memory
+func (s *Store) ExportEvents(ctx context.Context, filter EventFilter, fn func(Event) error) error {
+	query := "SELECT id, type, data, created_at FROM events WHERE user_id = ? AND id > ?"
+	args := []any{s.userID, filter.AfterID}
+	if filter.Type != "" {
+		query += " AND type = ?"
+		args = append(args, filter.Type)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, filter.Since.Local().Format(eventTimeFormat))
+	}
+	if !filter.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, filter.Until.Local().Format(eventTimeFormat))
+	}
+	query += " ORDER BY id"
+
+	return s.queryEvents(ctx, query, args, fn)
+}
+
+func (s *Store) queryEvents(ctx context.Context, query string, args []any, fn func(Event) error) error {
+	rows, err := s.read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ev Event
+		if err := rows.Scan(&ev.ID, &ev.Type, &ev.Data, &ev.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan event: %w", err)
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExpireEvents deletes events of eventType stored before before (unix
+// seconds), in batches. Mail event types remove stored messages of their
+// kind, archived ones included: their index entries go, and the archive job
+// rewrites their segments without them. Other types remove generic events.
+// Published outbox entries of the type go too.
+func (s *Store) ExpireEvents(ctx context.Context, eventType string, before int64) (int64, error) {
+	queries := []string{`
+		DELETE FROM events WHERE rowid IN (
+			SELECT rowid FROM events WHERE user_id = ? AND type = ? AND created_at < ? LIMIT ?
+		)`}
+	args := []any{s.userID, eventType, time.Unix(before, 0).Local().Format(eventTimeFormat), expireBatch}
+	if kind, ok := mailEventKinds[eventType]; ok {
+		queries = nil
+		for _, table := range []string{"email_received_events", "archived_messages"} {
+			queries = append(queries, `
+				DELETE FROM `+table+` WHERE rowid IN (
+					SELECT rowid FROM `+table+`
+					WHERE user_id = ? AND COALESCE(kind, 'message') = ? AND ts < ? LIMIT ?
+				)`)
+		}
+		args = []any{s.userID, kind, before, expireBatch}
+	}
+
+	var expired int64
+	for _, query := range queries {
+		for {
+			res, err := s.exec(ctx, "expire_events", query, args...)
+			if err != nil {
+				return expired, fmt.Errorf("failed to expire %s events: %w", eventType, err)
+			}
+			n, _ := res.RowsAffected()
+			expired += n
+			if n < expireBatch {
+				break
+			}
+		}
+	}
+
+	if _, err := s.exec(ctx, "expire_events", `
+		DELETE FROM outbox WHERE user_id = ? AND event_type = ? AND published_at IS NOT NULL AND ts < ?
+	`, s.userID, eventType, before); err != nil {
+		return expired, fmt.Errorf("failed to expire %s outbox entries: %w", eventType, err)
+	}
+	return expired, nil
+}
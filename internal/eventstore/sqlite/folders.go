@@ -0,0 +1,208 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// UpsertFolders replaces the stored folder tree for a provider. Existing folders
+// keep their selection and delta link; new folders use the Selected value given;
+// folders no longer present at the provider are removed.
+func (s *Store) UpsertFolders(ctx context.Context, provider string, folders []MailFolder) error {
+	return s.writeTx(ctx, "upsert_folders", func(tx *sql.Tx) error {
+		now := time.Now().Unix()
+		seen := make(map[string]bool, len(folders))
+		for _, f := range folders {
+			seen[f.ID] = true
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO mail_folders (user_id, provider, folder_id, parent_id, display_name, folder, selected, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT DO UPDATE SET
+					parent_id = excluded.parent_id,
+					display_name = excluded.display_name,
+					folder = excluded.folder,
+					updated_at = excluded.updated_at
+			`, s.userID, provider, f.ID, f.ParentID, f.DisplayName, f.Folder, f.Selected, now)
+			if err != nil {
+				return fmt.Errorf("failed to upsert folder %s: %w", f.ID, err)
+			}
+		}
+
+		existing, err := listFolderIDs(ctx, tx, s.userID, provider)
+		if err != nil {
+			return err
+		}
+		for _, id := range existing {
+			if seen[id] {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM mail_folders WHERE user_id = ? AND provider = ? AND folder_id = ?
+			`, s.userID, provider, id); err != nil {
+				return fmt.Errorf("failed to delete folder %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// listFolderIDs returns a user's stored folder ids for a provider
+func listFolderIDs(ctx context.Context, tx *sql.Tx, userID, provider string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT folder_id FROM mail_folders WHERE user_id = ? AND provider = ?
+	`, userID, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query folders: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListFolders returns the stored folder tree for a provider
+func (s *Store) ListFolders(ctx context.Context, provider string) ([]MailFolder, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT folder_id, parent_id, display_name, folder, selected, delta_link, updated_at
+		FROM mail_folders
+		WHERE user_id = ? AND provider = ?
+		ORDER BY display_name
+	`, s.userID, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query folders: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []MailFolder
+	for rows.Next() {
+		var (
+			f         MailFolder
+			parentID  sql.NullString
+			name      sql.NullString
+			folder    sql.NullString
+			deltaLink sql.NullString
+			updatedAt sql.NullInt64
+		)
+		if err := rows.Scan(&f.ID, &parentID, &name, &folder, &f.Selected, &deltaLink, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		f.ParentID = parentID.String
+		f.DisplayName = name.String
+		f.Folder = folder.String
+		f.Synced = deltaLink.String != ""
+		f.UpdatedAt = updatedAt.Int64
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+// SetFolderSelected includes or excludes a folder from sync. Deselecting a
+// folder clears its delta link so re-selecting it starts a fresh delta round.
+func (s *Store) SetFolderSelected(ctx context.Context, provider, folderID string, selected bool) error {
+	res, err := s.exec(ctx, "set_folder_selected", `
+		UPDATE mail_folders
+		SET selected = ?,
+		    delta_link = CASE WHEN ? THEN delta_link ELSE NULL END,
+		    updated_at = ?
+		WHERE user_id = ? AND provider = ? AND folder_id = ?
+	`, selected, selected, time.Now().Unix(), s.userID, provider, folderID)
+	if err != nil {
+		return fmt.Errorf("failed to update folder: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("folder %s: %w", folderID, eventstore.ErrNotFound)
+	}
+	return nil
+}
+
+// SelectFoldersByCategory selects every folder of a canonical category (e.g. spam)
+// that isn't already selected
+func (s *Store) SelectFoldersByCategory(ctx context.Context, provider, folder string) error {
+	_, err := s.exec(ctx, "select_folders", `
+		UPDATE mail_folders SET selected = 1, updated_at = ?
+		WHERE user_id = ? AND provider = ? AND folder = ? AND selected = 0
+	`, time.Now().Unix(), s.userID, provider, folder)
+	if err != nil {
+		return fmt.Errorf("failed to select %s folders: %w", folder, err)
+	}
+	return nil
+}
+
+// SelectFolders selects exactly the folders of the given canonical categories.
+// Deselected folders lose their delta link, as with SetFolderSelected.
+func (s *Store) SelectFolders(ctx context.Context, provider string, folders []string) error {
+	list, _ := json.Marshal(folders)
+	_, err := s.exec(ctx, "select_folders", `
+		UPDATE mail_folders
+		SET selected = folder IN (SELECT value FROM json_each(?)),
+		    delta_link = CASE WHEN folder IN (SELECT value FROM json_each(?)) THEN delta_link ELSE NULL END,
+		    updated_at = ?
+		WHERE user_id = ? AND provider = ?
+	`, string(list), string(list), time.Now().Unix(), s.userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to select folders: %w", err)
+	}
+	return nil
+}
+
+// LoadFolderCursors returns delta links for all selected folders, keyed by
+// folder id. Folders never synced map to an empty cursor. Returns nil when no
+// folder tree has been stored yet (as opposed to an empty selection).
+func (s *Store) LoadFolderCursors(ctx context.Context, provider string) (map[string]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT folder_id, selected, delta_link FROM mail_folders
+		WHERE user_id = ? AND provider = ?
+	`, s.userID, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query folder cursors: %w", err)
+	}
+	defer rows.Close()
+
+	var cursors map[string]string
+	for rows.Next() {
+		var (
+			id       string
+			selected bool
+			link     sql.NullString
+		)
+		if err := rows.Scan(&id, &selected, &link); err != nil {
+			return nil, fmt.Errorf("failed to scan folder cursor: %w", err)
+		}
+		if cursors == nil {
+			cursors = make(map[string]string)
+		}
+		if selected {
+			cursors[id] = link.String
+		}
+	}
+	return cursors, rows.Err()
+}
+
+// SaveFolderCursors stores delta links returned by a sync round
+func (s *Store) SaveFolderCursors(ctx context.Context, provider string, cursors map[string]string) error {
+	now := time.Now().Unix()
+	return s.writeTx(ctx, "save_folder_cursors", func(tx *sql.Tx) error {
+		for id, link := range cursors {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE mail_folders SET delta_link = ?, updated_at = ?
+				WHERE user_id = ? AND provider = ? AND folder_id = ? AND selected = 1
+			`, link, now, s.userID, provider, id); err != nil {
+				return fmt.Errorf("failed to save cursor for folder %s: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
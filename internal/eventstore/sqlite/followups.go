@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// FollowUps returns the threads where the user sent the last message since
+// q.Since, oldest due first. A later sent message, or any later message from
+// someone else other than an auto-reply or bounce, ends the wait; dismissed
+// follow-ups are left out.
+func (s *Store) FollowUps(ctx context.Context, q FollowUpQuery) ([]FollowUp, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT e.provider, e.provider_thread_id, e.provider_message_id, e.subject, e.to_addrs, e.msg_date,
+		       COALESCE(f.snoozed_until, 0), COALESCE(f.notified_at, 0)
+		FROM email_received_events e
+		LEFT JOIN followups f
+		  ON f.user_id = e.user_id AND f.provider = e.provider AND f.thread_id = e.provider_thread_id
+		 AND f.message_id = e.provider_message_id
+		WHERE e.user_id = ? AND e.folder = 'sent' AND e.deleted_at IS NULL AND e.msg_date >= ?
+		  AND COALESCE(e.provider_thread_id, '') != '' AND f.dismissed_at IS NULL
+		  AND (? = '' OR (e.provider = ? AND e.provider_thread_id = ?))
+		  AND NOT EXISTS (
+		    SELECT 1 FROM email_received_events r
+		    WHERE r.user_id = e.user_id AND r.provider = e.provider AND r.provider_thread_id = e.provider_thread_id
+		      AND r.deleted_at IS NULL AND r.event_id != e.event_id
+		      AND (r.msg_date > e.msg_date OR (r.msg_date = e.msg_date AND r.event_id > e.event_id))
+		      AND (r.folder = 'sent' OR COALESCE(r.kind, 'message') = 'message')
+		  )
+	`, s.userID, q.Since, q.ThreadID, q.Provider, q.ThreadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query follow-ups: %w", err)
+	}
+	defer rows.Close()
+
+	followUps := []FollowUp{}
+	for rows.Next() {
+		var (
+			f             FollowUp
+			subject, to   sql.NullString
+			snoozed, sent int64
+		)
+		if err := rows.Scan(&f.Provider, &f.ProviderThreadID, &f.ProviderMessageID, &subject, &to, &sent,
+			&snoozed, &f.NotifiedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan follow-up: %w", err)
+		}
+		f.Subject = subject.String
+		_ = json.Unmarshal([]byte(to.String), &f.To)
+		f.SentAt = sent
+		f.DueAt = sent + q.After
+
+		switch {
+		case snoozed > q.Now:
+			f.Status = eventstore.FollowUpSnoozed
+			f.SnoozedUntil = snoozed
+			f.DueAt = max(f.DueAt, snoozed)
+		case f.DueAt > q.Now:
+			f.Status = eventstore.FollowUpWaiting
+		default:
+			f.Status = eventstore.FollowUpDue
+			f.DueAt = max(f.DueAt, snoozed)
+		}
+		if q.Status == "" || q.Status == f.Status {
+			followUps = append(followUps, f)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(followUps, func(i, j int) bool { return followUps[i].DueAt < followUps[j].DueAt })
+	if q.Limit > 0 && len(followUps) > q.Limit {
+		followUps = followUps[:q.Limit]
+	}
+	return followUps, nil
+}
+
+// SnoozeFollowUp hides a follow-up until until (unix seconds)
+func (s *Store) SnoozeFollowUp(ctx context.Context, provider, threadID, messageID string, until int64) error {
+	return s.retryBusy(ctx, "snooze_followup", func() error {
+		return s.setFollowUp(ctx, s.DB, provider, threadID, messageID, "snoozed_until", until)
+	})
+}
+
+// DismissFollowUp hides a follow-up for good
+func (s *Store) DismissFollowUp(ctx context.Context, provider, threadID, messageID string) error {
+	return s.retryBusy(ctx, "dismiss_followup", func() error {
+		return s.setFollowUp(ctx, s.DB, provider, threadID, messageID, "dismissed_at", time.Now().Unix())
+	})
+}
+
+// MarkFollowUpNotifiedTx records that followup.due was published
+func (s *Store) MarkFollowUpNotifiedTx(ctx context.Context, tx *sql.Tx, provider, threadID, messageID string, at int64) error {
+	return s.setFollowUp(ctx, tx, provider, threadID, messageID, "notified_at", at)
+}
+
+// execer is a database or transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// setFollowUp sets one column of a thread's follow-up state. State recorded
+// for an earlier message of the thread is cleared.
+func (s *Store) setFollowUp(ctx context.Context, db execer, provider, threadID, messageID, column string, value int64) error {
+	keep := func(col string) string {
+		if col == column {
+			return col + " = excluded." + col
+		}
+		return fmt.Sprintf("%s = CASE WHEN message_id = excluded.message_id THEN %s END", col, col)
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO followups (user_id, provider, thread_id, message_id, `+column+`, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, provider, thread_id) DO UPDATE SET
+			`+keep("snoozed_until")+`, `+keep("dismissed_at")+`, `+keep("notified_at")+`,
+			message_id = excluded.message_id, updated_at = excluded.updated_at
+	`, s.userID, provider, threadID, messageID, value, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to update follow-up: %w", err)
+	}
+	return nil
+}
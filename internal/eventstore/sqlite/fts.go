@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ftsSchema creates the full-text index over message metadata. It's an
+// external-content FTS5 table keyed by the events table's rowid and kept in
+// sync by triggers (don't VACUUM without rebuilding it, rowids may change).
+var ftsSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS email_fts USING fts5(
+		subject, sender, to_addrs, snippet,
+		content='email_received_events', content_rowid='rowid'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS email_fts_ai AFTER INSERT ON email_received_events BEGIN
+		INSERT INTO email_fts(rowid, subject, sender, to_addrs, snippet)
+		VALUES (new.rowid, new.subject, new.sender, new.to_addrs, new.snippet);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS email_fts_ad AFTER DELETE ON email_received_events BEGIN
+		INSERT INTO email_fts(email_fts, rowid, subject, sender, to_addrs, snippet)
+		VALUES ('delete', old.rowid, old.subject, old.sender, old.to_addrs, old.snippet);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS email_fts_au AFTER UPDATE OF subject, sender, to_addrs, snippet ON email_received_events BEGIN
+		INSERT INTO email_fts(email_fts, rowid, subject, sender, to_addrs, snippet)
+		VALUES ('delete', old.rowid, old.subject, old.sender, old.to_addrs, old.snippet);
+		INSERT INTO email_fts(rowid, subject, sender, to_addrs, snippet)
+		VALUES (new.rowid, new.subject, new.sender, new.to_addrs, new.snippet);
+	END`,
+}
+
+// translationFTSSchema indexes machine translations the same way, so free
+// text finds messages written in another language
+var translationFTSSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS translation_fts USING fts5(
+		translated_subject, translated_snippet,
+		content='email_received_events', content_rowid='rowid'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS translation_fts_ai AFTER INSERT ON email_received_events BEGIN
+		INSERT INTO translation_fts(rowid, translated_subject, translated_snippet)
+		VALUES (new.rowid, new.translated_subject, new.translated_snippet);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS translation_fts_ad AFTER DELETE ON email_received_events BEGIN
+		INSERT INTO translation_fts(translation_fts, rowid, translated_subject, translated_snippet)
+		VALUES ('delete', old.rowid, old.translated_subject, old.translated_snippet);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS translation_fts_au AFTER UPDATE OF translated_subject, translated_snippet ON email_received_events BEGIN
+		INSERT INTO translation_fts(translation_fts, rowid, translated_subject, translated_snippet)
+		VALUES ('delete', old.rowid, old.translated_subject, old.translated_snippet);
+		INSERT INTO translation_fts(rowid, translated_subject, translated_snippet)
+		VALUES (new.rowid, new.translated_subject, new.translated_snippet);
+	END`,
+}
+
+// attachmentFTSSchema indexes the text extracted from attachments; matches
+// map back to messages through attachments.event_id
+var attachmentFTSSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS attachment_fts USING fts5(
+		filename, text,
+		content='attachments', content_rowid='rowid'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS attachment_fts_ai AFTER INSERT ON attachments BEGIN
+		INSERT INTO attachment_fts(rowid, filename, text) VALUES (new.rowid, new.filename, new.text);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS attachment_fts_ad AFTER DELETE ON attachments BEGIN
+		INSERT INTO attachment_fts(attachment_fts, rowid, filename, text) VALUES ('delete', old.rowid, old.filename, old.text);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS attachment_fts_au AFTER UPDATE OF filename, text ON attachments BEGIN
+		INSERT INTO attachment_fts(attachment_fts, rowid, filename, text) VALUES ('delete', old.rowid, old.filename, old.text);
+		INSERT INTO attachment_fts(rowid, filename, text) VALUES (new.rowid, new.filename, new.text);
+	END`,
+}
+
+// ensureFTS creates the full-text indexes, indexing existing rows the first
+// time
+func ensureFTS(db *sql.DB) error {
+	if err := ensureIndex(db, "email_fts", ftsSchema); err != nil {
+		return err
+	}
+	if err := ensureIndex(db, "translation_fts", translationFTSSchema); err != nil {
+		return err
+	}
+	return ensureIndex(db, "attachment_fts", attachmentFTSSchema)
+}
+
+func ensureIndex(db *sql.DB, table string, schema []string) error {
+	var exists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check fts table: %w", err)
+	}
+
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create fts index: %w", err)
+		}
+	}
+
+	if exists == 0 {
+		if _, err := db.Exec(`INSERT INTO ` + table + `(` + table + `) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("failed to build fts index: %w", err)
+		}
+	}
+	return nil
+}
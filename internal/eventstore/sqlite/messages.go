@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// LoadMessageRef returns reply linkage for a stored message (nil if unknown)
+func (s *Store) LoadMessageRef(ctx context.Context, provider, providerMessageID string) (*MessageRef, error) {
+	var threadID, subject, headers sql.NullString
+	err := s.read.QueryRowContext(ctx, `
+		SELECT provider_thread_id, subject, decompress(headers_json) FROM email_received_events
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, s.userID, provider, providerMessageID).Scan(&threadID, &subject, &headers)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load message: %w", err)
+	}
+	return &MessageRef{
+		ThreadID:    threadID.String,
+		Subject:     subject.String,
+		HeadersJSON: headers.String,
+	}, nil
+}
+
+// messageColumns is the column list scanned by scanMessage
+const messageColumns = `event_id, provider, provider_message_id, provider_thread_id, subject, sender,
+	to_addrs, cc_addrs, bcc_addrs, snippet, labels_json, folder, is_read, is_flagged, kind,
+	is_list, list_id, msg_date, ts, deleted_at, language, translation_lang, translated_subject, translated_snippet`
+
+// scanMessage scans a row selected with messageColumns
+func scanMessage(rows *sql.Rows) (StoredMessage, error) {
+	var (
+		m                                  StoredMessage
+		threadID, subject, sender, snippet sql.NullString
+		to, cc, bcc, labels, folder, kind  sql.NullString
+		listID, language                   sql.NullString
+		trLang, trSubject, trSnippet       sql.NullString
+		isRead, isFlagged, isList          sql.NullBool
+		msgDate, deletedAt                 sql.NullInt64
+	)
+	if err := rows.Scan(&m.EventID, &m.Provider, &m.ProviderMessageID, &threadID, &subject, &sender,
+		&to, &cc, &bcc, &snippet, &labels, &folder, &isRead, &isFlagged, &kind,
+		&isList, &listID, &msgDate, &m.TS, &deletedAt, &language, &trLang, &trSubject, &trSnippet); err != nil {
+		return m, fmt.Errorf("failed to scan message: %w", err)
+	}
+
+	m.ProviderThreadID = threadID.String
+	m.Subject = subject.String
+	m.Sender = sender.String
+	m.Snippet = snippet.String
+	m.Folder = folder.String
+	m.Kind = kind.String
+	m.IsRead = isRead.Bool
+	m.IsFlagged = isFlagged.Bool
+	m.IsList = isList.Bool
+	m.ListID = listID.String
+	m.MsgDate = msgDate.Int64
+	m.DeletedAt = deletedAt.Int64
+	m.Language = language.String
+	if trLang.Valid {
+		m.Translation = &Translation{Language: trLang.String, Subject: trSubject.String, Snippet: trSnippet.String}
+	}
+	_ = json.Unmarshal([]byte(to.String), &m.To)
+	_ = json.Unmarshal([]byte(cc.String), &m.Cc)
+	_ = json.Unmarshal([]byte(bcc.String), &m.Bcc)
+	_ = json.Unmarshal([]byte(labels.String), &m.Labels)
+	return m, nil
+}
+
+// ThreadMessages returns the stored messages of a thread in date order. An
+// empty provider matches the thread id across providers.
+func (s *Store) ThreadMessages(ctx context.Context, provider, threadID string) ([]StoredMessage, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM email_received_events
+		WHERE user_id = ? AND provider_thread_id = ? AND (? = '' OR provider = ?) AND deleted_at IS NULL
+		ORDER BY msg_date, ts
+	`, s.userID, threadID, provider, provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query thread: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []StoredMessage
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
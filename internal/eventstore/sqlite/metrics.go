@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	moderncsqlite "modernc.org/sqlite"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// Store instruments. They record through the global OpenTelemetry
+// MeterProvider, so they are no-ops until the process installs one.
+var (
+	insertDuration metric.Float64Histogram
+	txDuration     metric.Float64Histogram
+	dequeueSize    metric.Int64Histogram
+	txRetries      metric.Int64Counter
+	busyErrors     metric.Int64Counter
+)
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/eventstore/sqlite")
+
+	var err error
+	if insertDuration, err = meter.Float64Histogram("eventstore.insert.duration",
+		metric.WithDescription("Time to insert an email event and its outbox entry"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	if txDuration, err = meter.Float64Histogram("eventstore.tx.duration",
+		metric.WithDescription("Time to run a write transaction, including retries"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	if dequeueSize, err = meter.Int64Histogram("eventstore.outbox.dequeue.size",
+		metric.WithDescription("Outbox messages returned per dequeue"),
+		metric.WithUnit("{message}")); err != nil {
+		otel.Handle(err)
+	}
+	if txRetries, err = meter.Int64Counter("eventstore.tx.retries",
+		metric.WithDescription("Write transactions retried after SQLITE_BUSY"),
+		metric.WithUnit("{retry}")); err != nil {
+		otel.Handle(err)
+	}
+	if busyErrors, err = meter.Int64Counter("eventstore.busy.errors",
+		metric.WithDescription("Operations that failed with SQLITE_BUSY or SQLITE_LOCKED"),
+		metric.WithUnit("{error}")); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// observeInsert records the latency and outcome of an event insert
+func observeInsert(ctx context.Context, start time.Time, inserted bool, err error) {
+	result := "inserted"
+	switch {
+	case err != nil:
+		result = "error"
+	case !inserted:
+		result = "duplicate"
+	}
+	insertDuration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(attribute.String("result", result)))
+}
+
+// observeBusy counts err against op if SQLite reported the database busy or
+// locked, and marks it with eventstore.ErrBusy so callers can tell it is
+// worth retrying
+func observeBusy(ctx context.Context, op string, err error) error {
+	if err == nil || !isBusy(err) {
+		return err
+	}
+	busyErrors.Add(ctx, 1, metric.WithAttributes(attribute.String("op", op)))
+	if errors.Is(err, eventstore.ErrBusy) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", eventstore.ErrBusy, err)
+}
+
+// isBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED (including
+// extended codes)
+func isBusy(err error) bool {
+	if errors.Is(err, eventstore.ErrBusy) {
+		return true
+	}
+	var serr *moderncsqlite.Error
+	if !errors.As(err, &serr) {
+		return false
+	}
+	switch serr.Code() & 0xff {
+	case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+		return true
+	}
+	return false
+}
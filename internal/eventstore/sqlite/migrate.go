@@ -0,0 +1,129 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// columnMigrations lists columns added to tables after their initial release.
+// schema.sql already contains them for new databases; existing databases get
+// them added here since CREATE TABLE IF NOT EXISTS won't alter a table.
+var columnMigrations = []struct {
+	table  string
+	column string
+	decl   string
+}{
+	{"email_received_events", "folder", "TEXT"},
+	{"email_received_events", "deleted_at", "INTEGER"},
+	{"email_received_events", "is_read", "INTEGER"},
+	{"email_received_events", "is_flagged", "INTEGER"},
+	{"email_received_events", "kind", "TEXT"},
+	{"email_received_events", "is_list", "INTEGER"},
+	{"email_received_events", "list_id", "TEXT"},
+	{"email_received_events", "list_name", "TEXT"},
+	{"email_received_events", "list_unsubscribe", "TEXT"},
+	{"provider_sync_state", "user_id", "TEXT NOT NULL DEFAULT ''"},
+	{"outbox", "user_id", "TEXT NOT NULL DEFAULT ''"},
+	{"mail_folders", "user_id", "TEXT NOT NULL DEFAULT ''"},
+	{"outbox", "trace_parent", "TEXT"},
+	{"provider_sync_state", "provider_newest_at", "INTEGER"},
+	{"provider_sync_state", "local_newest_at", "INTEGER"},
+	{"provider_sync_state", "lag_seconds", "INTEGER"},
+	{"provider_sync_state", "lag_checked_at", "INTEGER"},
+	{"email_received_events", "language", "TEXT"},
+	{"email_received_events", "translation_lang", "TEXT"},
+	{"email_received_events", "translated_subject", "TEXT"},
+	{"email_received_events", "translated_snippet", "TEXT"},
+	{"events", "user_id", "TEXT NOT NULL DEFAULT ''"},
+	{"outbox", "last_error", "TEXT"},
+	{"outbox", "last_error_at", "INTEGER"},
+	{"runner_heartbeats", "backfill_from", "INTEGER"},
+	{"runner_heartbeats", "oldest_seen", "INTEGER"},
+	{"runner_heartbeats", "newest_seen", "INTEGER"},
+	{"outbox", "stream", "TEXT"},
+	{"outbox", "stream_seq", "INTEGER"},
+	{"provider_sync_state", "error_code", "TEXT"},
+	{"calendar_suggestions", "source", "TEXT NOT NULL DEFAULT 'text'"},
+	{"calendar_suggestions", "invite_uid", "TEXT"},
+	{"calendar_suggestions", "invite_sequence", "INTEGER NOT NULL DEFAULT 0"},
+	{"calendar_suggestions", "status", "TEXT NOT NULL DEFAULT 'active'"},
+}
+
+// indexMigrations are indexes on migrated columns. They can't live in schema.sql,
+// which runs before the columns are added to existing databases.
+var indexMigrations = []string{
+	`CREATE INDEX IF NOT EXISTS idx_email_events_list ON email_received_events(is_list, list_id)`,
+	// Covering index for analytics (daily volume, top senders, busiest hours)
+	`CREATE INDEX IF NOT EXISTS idx_email_events_analytics ON email_received_events(msg_date, deleted_at, folder, sender, is_read)`,
+	// Reply lookups within a thread (response backlog, thread detail)
+	`CREATE INDEX IF NOT EXISTS idx_email_events_thread ON email_received_events(provider, provider_thread_id, folder, msg_date)`,
+	// User-scoped lookups in shared databases
+	`CREATE INDEX IF NOT EXISTS idx_email_events_user ON email_received_events(user_id, msg_date)`,
+	`CREATE INDEX IF NOT EXISTS idx_outbox_user_ready ON outbox(user_id, published_at, next_attempt_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_events_user_type ON events(user_id, type, created_at DESC)`,
+	`CREATE INDEX IF NOT EXISTS idx_calendar_suggestions_invite ON calendar_suggestions(user_id, invite_uid)`,
+}
+
+// migrate adds any missing columns, indexes, the full-text index and the
+// contacts table to existing databases. userID is the owner of a per-user
+// database (used to backfill user_id columns); empty for shared databases.
+func migrate(db *sql.DB, userID string) error {
+	for _, m := range columnMigrations {
+		exists, err := hasColumn(db, m.table, m.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.decl)); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.table, m.column, err)
+		}
+
+		// Rows written before user scoping belong to the database's owner
+		if m.column == "user_id" && userID != "" {
+			if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET user_id = ? WHERE user_id = ''", m.table), userID); err != nil {
+				return fmt.Errorf("failed to backfill %s.user_id: %w", m.table, err)
+			}
+		}
+	}
+
+	for _, stmt := range indexMigrations {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+
+	if err := ensureFTS(db); err != nil {
+		return err
+	}
+	return ensureContacts(db, userID)
+}
+
+// hasColumn reports whether table already has column
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan column info: %w", err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
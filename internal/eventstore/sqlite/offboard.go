@@ -0,0 +1,151 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// userTablesQuery lists the tables holding per-user rows. Full-text indexes
+// have no user_id; their triggers follow the deletes.
+const userTablesQuery = `
+	SELECT m.name FROM sqlite_master m
+	WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+	  AND EXISTS (SELECT 1 FROM pragma_table_info(m.name) WHERE name = 'user_id')
+	ORDER BY m.name
+`
+
+// RemoveUser deletes everything stored for a user: their database directory
+// in per-user mode, their rows in shared mode. With an archivePath the rows
+// are first copied into a new SQLite database there, one table per store
+// table (without indexes). It returns false if the user had no data.
+func (o *Opener) RemoveUser(ctx context.Context, userID, archivePath string) (bool, error) {
+	if !eventstore.ValidUserID(userID) {
+		return false, fmt.Errorf("invalid user id %q", userID)
+	}
+	if archivePath != "" {
+		if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+			return false, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+
+	if o.shared != nil {
+		return o.removeSharedUser(ctx, userID, archivePath)
+	}
+
+	path := o.userPath(userID)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	store, err := OpenUserDB(path, userID)
+	if err != nil {
+		return false, err
+	}
+	if archivePath != "" {
+		err = archiveUser(ctx, store.DB, store.gate, userID, archivePath)
+	}
+	store.Close()
+	if err != nil {
+		return false, err
+	}
+
+	o.migrated.Delete(path)
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		return false, fmt.Errorf("failed to remove user directory: %w", err)
+	}
+	return true, nil
+}
+
+// removeSharedUser archives a user's rows in the shared database, then
+// deletes them in one transaction
+func (o *Opener) removeSharedUser(ctx context.Context, userID, archivePath string) (bool, error) {
+	if archivePath != "" {
+		if err := archiveUser(ctx, o.shared, o.gate, userID, archivePath); err != nil {
+			return false, err
+		}
+	}
+
+	tables, err := userTables(ctx, o.shared)
+	if err != nil {
+		return false, err
+	}
+
+	store := &Store{DB: o.shared, gate: o.gate, userID: userID, shared: true}
+	var deleted int64
+	err = store.writeTx(ctx, "remove_user", func(tx *sql.Tx) error {
+		deleted = 0
+		for _, table := range tables {
+			res, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %q WHERE user_id = ?`, table), userID)
+			if err != nil {
+				return fmt.Errorf("failed to delete from %s: %w", table, err)
+			}
+			n, _ := res.RowsAffected()
+			deleted += n
+		}
+		return nil
+	})
+	return deleted > 0, err
+}
+
+// archiveUser copies a user's rows into a new database at archivePath. The
+// copy runs on one connection holding the write gate, so it sees no
+// half-finished writes.
+func archiveUser(ctx context.Context, db *sql.DB, gate writeGate, userID, archivePath string) error {
+	if _, err := os.Stat(archivePath); err == nil {
+		return fmt.Errorf("archive %s already exists", archivePath)
+	}
+
+	tables, err := userTables(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	if err := gate.acquire(ctx); err != nil {
+		return err
+	}
+	defer gate.release()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE ? AS archive`, archivePath); err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `DETACH DATABASE archive`)
+
+	for _, table := range tables {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE archive.%q AS SELECT * FROM main.%q WHERE user_id = ?`, table, table), userID)
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// userTables returns the tables with a user_id column
+func userTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, userTablesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// Opener opens user-scoped stores. By default each user gets their own
+// database file under root; in shared mode all users live in one database and
+// are separated by the user_id scoping every Store query applies.
+type Opener struct {
+	root   string  // per-user mode: {root}/{user_id}/events.db
+	shared *sql.DB // shared mode writer connection
+	read   *sql.DB // shared mode reader pool
+	gate   writeGate
+
+	migrated sync.Map // per-user database paths brought up to date by this process
+}
+
+// sharedReaderConns is the size of the shared database reader pool
+const sharedReaderConns = 32
+
+// NewOpener creates an opener for one database per user under root
+func NewOpener(root string) *Opener {
+	return &Opener{root: root}
+}
+
+// NewSharedOpener creates an opener backed by a single database at dbPath
+func NewSharedOpener(dbPath string) (*Opener, error) {
+	db, err := openDB(dbPath, "")
+	if err != nil {
+		return nil, err
+	}
+	read, err := openReader(dbPath, "", sharedReaderConns)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Opener{shared: db, read: read, gate: gateFor(dbPath)}, nil
+}
+
+// Shared reports whether all users share one database
+func (o *Opener) Shared() bool {
+	return o.shared != nil
+}
+
+// Open returns the store for a user. Close it when done; in shared mode that
+// leaves the shared pool open.
+func (o *Opener) Open(userID string) (eventstore.Store, error) {
+	if !eventstore.ValidUserID(userID) {
+		return nil, fmt.Errorf("invalid user id %q", userID)
+	}
+	if o.shared != nil {
+		return &Store{DB: o.shared, read: o.read, gate: o.gate, userID: userID, shared: true}, nil
+	}
+
+	path := o.userPath(userID)
+	store, err := OpenUserDB(path, userID)
+	if err != nil {
+		return nil, err
+	}
+	o.migrated.Store(path, true)
+	return store, nil
+}
+
+// OpenReader returns a read-only handle for a user's store, backed only by
+// query_only connections. A per-user database is created and migrated through
+// Open the first time this process sees it.
+func (o *Opener) OpenReader(userID string) (eventstore.Reader, error) {
+	if !eventstore.ValidUserID(userID) {
+		return nil, fmt.Errorf("invalid user id %q", userID)
+	}
+	if o.shared != nil {
+		return &Store{read: o.read, userID: userID, shared: true}, nil
+	}
+
+	path := o.userPath(userID)
+	if _, ok := o.migrated.Load(path); !ok {
+		store, err := o.Open(userID)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+
+	read, err := openReader(path, userID, readerConns)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{read: read, userID: userID}, nil
+}
+
+// userPath is the database file of a user in per-user mode
+func (o *Opener) userPath(userID string) string {
+	return filepath.Join(o.root, userID, "events.db")
+}
+
+// Close closes the shared database, if any
+func (o *Opener) Close() error {
+	if o.shared == nil {
+		return nil
+	}
+	err := o.shared.Close()
+	if rerr := o.read.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// maxOutboxError bounds the publish error kept on an outbox row
+const maxOutboxError = 500
+
+// OutboxBacklog summarises the unpublished outbox messages with up to samples
+// of their latest publish errors
+func (s *Store) OutboxBacklog(ctx context.Context, samples int) (*OutboxBacklog, error) {
+	backlog := &OutboxBacklog{Retries: map[string]int64{}, RecentErrors: []OutboxError{}}
+	for _, bucket := range eventstore.RetryBuckets {
+		backlog.Retries[bucket] = 0
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT CASE
+		         WHEN COALESCE(retries, 0) = 0 THEN '0'
+		         WHEN retries = 1 THEN '1'
+		         WHEN retries < 5 THEN '2-4'
+		         WHEN retries < 10 THEN '5-9'
+		         ELSE '10+'
+		       END AS bucket,
+		       COUNT(*), MIN(ts)
+		FROM outbox
+		WHERE user_id = ? AND published_at IS NULL
+		GROUP BY bucket
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox backlog: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			bucket string
+			count  int64
+			oldest int64
+		)
+		if err := rows.Scan(&bucket, &count, &oldest); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox backlog: %w", err)
+		}
+		backlog.Retries[bucket] = count
+		backlog.Pending += count
+		if backlog.OldestPendingAt == 0 || oldest < backlog.OldestPendingAt {
+			backlog.OldestPendingAt = oldest
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query outbox backlog: %w", err)
+	}
+
+	if samples <= 0 || backlog.Pending == 0 {
+		return backlog, nil
+	}
+
+	errRows, err := s.DB.QueryContext(ctx, `
+		SELECT id, subject, event_type, COALESCE(retries, 0), last_error, last_error_at
+		FROM outbox
+		WHERE user_id = ? AND published_at IS NULL AND last_error IS NOT NULL
+		ORDER BY last_error_at DESC, id DESC
+		LIMIT ?
+	`, s.userID, samples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox errors: %w", err)
+	}
+	defer errRows.Close()
+
+	for errRows.Next() {
+		e := OutboxError{UserID: s.userID}
+		if err := errRows.Scan(&e.ID, &e.Subject, &e.EventType, &e.Retries, &e.Error, &e.FailedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox error: %w", err)
+		}
+		backlog.RecentErrors = append(backlog.RecentErrors, e)
+	}
+	return backlog, errRows.Err()
+}
+
+// SamplePublished returns up to limit random messages published at or after
+// since with a known stream sequence
+func (s *Store) SamplePublished(ctx context.Context, since int64, limit int) ([]PublishedMessage, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT id, subject, msg_id, stream, stream_seq, published_at
+		FROM outbox
+		WHERE user_id = ? AND published_at >= ? AND stream_seq IS NOT NULL
+		ORDER BY random()
+		LIMIT ?
+	`, s.userID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample published outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var sample []PublishedMessage
+	for rows.Next() {
+		var m PublishedMessage
+		if err := rows.Scan(&m.ID, &m.Subject, &m.MsgID, &m.Stream, &m.Sequence, &m.PublishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan published outbox: %w", err)
+		}
+		sample = append(sample, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read published outbox: %w", err)
+	}
+	return sample, nil
+}
@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// quarantineColumns is the column list scanned by scanQuarantined
+const quarantineColumns = `id, provider, inbox_id, provider_message_id, reason, detail, decompress(message), status, attempts, created_at, updated_at`
+
+func scanQuarantined(row interface{ Scan(...any) error }) (*QuarantinedMessage, error) {
+	var (
+		q       QuarantinedMessage
+		message []byte
+	)
+	if err := row.Scan(&q.ID, &q.Provider, &q.InboxID, &q.ProviderMessageID, &q.Reason, &q.Detail, &message,
+		&q.Status, &q.Attempts, &q.CreatedAt, &q.UpdatedAt); err != nil {
+		return nil, err
+	}
+	q.Message = json.RawMessage(message)
+	return &q, nil
+}
+
+// QuarantineMessage holds a message back. A message already held is updated
+// with the new reason, counted and made pending again.
+func (s *Store) QuarantineMessage(ctx context.Context, q *QuarantinedMessage) error {
+	now := time.Now().Unix()
+	q.Status, q.CreatedAt, q.UpdatedAt = eventstore.QuarantinePending, now, now
+	_, err := s.exec(ctx, "quarantine_message", `
+		INSERT INTO quarantined_messages (user_id, provider, inbox_id, provider_message_id, reason, detail, message,
+			status, attempts, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT(user_id, provider, provider_message_id) DO UPDATE SET
+			inbox_id = excluded.inbox_id, reason = excluded.reason, detail = excluded.detail,
+			message = excluded.message, status = excluded.status, attempts = attempts + 1,
+			updated_at = excluded.updated_at
+	`, s.userID, q.Provider, q.InboxID, q.ProviderMessageID, q.Reason, q.Detail, compress(q.Message),
+		q.Status, q.CreatedAt, q.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message: %w", err)
+	}
+	return nil
+}
+
+// RequeuedMessages returns up to limit of a provider's requeued messages,
+// oldest first
+func (s *Store) RequeuedMessages(ctx context.Context, provider string, limit int) ([]QuarantinedMessage, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+quarantineColumns+`
+		FROM quarantined_messages
+		WHERE user_id = ? AND status = ? AND provider = ?
+		ORDER BY id
+		LIMIT ?
+	`, s.userID, eventstore.QuarantineRequeued, provider, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query requeued messages: %w", err)
+	}
+	return scanQuarantinedRows(rows)
+}
+
+// SetQuarantineStatus moves a message from one of the from statuses to
+// status, returning false if it's in none of them
+func (s *Store) SetQuarantineStatus(ctx context.Context, id int64, status string, from ...string) (bool, error) {
+	if len(from) == 0 {
+		return false, nil
+	}
+	args := []any{status, time.Now().Unix(), s.userID, id}
+	for _, f := range from {
+		args = append(args, f)
+	}
+	res, err := s.exec(ctx, "set_quarantine_status", `
+		UPDATE quarantined_messages SET status = ?, updated_at = ?
+		WHERE user_id = ? AND id = ? AND status IN (?`+strings.Repeat(", ?", len(from)-1)+`)
+	`, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update quarantined message: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListQuarantined returns the newest held-back messages, optionally with one
+// status
+func (s *Store) ListQuarantined(ctx context.Context, status string, limit int) ([]QuarantinedMessage, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+quarantineColumns+`
+		FROM quarantined_messages
+		WHERE user_id = ? AND (? = '' OR status = ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`, s.userID, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantined messages: %w", err)
+	}
+	return scanQuarantinedRows(rows)
+}
+
+// LoadQuarantined returns a held-back message (nil if unknown)
+func (s *Store) LoadQuarantined(ctx context.Context, id int64) (*QuarantinedMessage, error) {
+	q, err := scanQuarantined(s.read.QueryRowContext(ctx, `
+		SELECT `+quarantineColumns+` FROM quarantined_messages WHERE user_id = ? AND id = ?
+	`, s.userID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quarantined message: %w", err)
+	}
+	return q, nil
+}
+
+// scanQuarantinedRows reads quarantineColumns rows
+func scanQuarantinedRows(rows *sql.Rows) ([]QuarantinedMessage, error) {
+	defer rows.Close()
+
+	list := []QuarantinedMessage{}
+	for rows.Next() {
+		q, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined message: %w", err)
+		}
+		list = append(list, *q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read quarantined messages: %w", err)
+	}
+	return list, nil
+}
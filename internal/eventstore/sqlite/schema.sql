@@ -2,16 +2,27 @@ PRAGMA journal_mode=WAL;
 PRAGMA synchronous=NORMAL;
 PRAGMA busy_timeout=5000;
 
+-- Every table is scoped by user_id so the same schema serves one database per
+-- user and a single shared database. Older per-user databases get the column
+-- (and backfilled values) from migrate.go.
+
 -- Provider sync state table
 CREATE TABLE IF NOT EXISTS provider_sync_state (
-  provider            TEXT PRIMARY KEY,
+  user_id             TEXT NOT NULL DEFAULT '',
+  provider            TEXT NOT NULL,
   inbox_id            TEXT NOT NULL,
   cursor              TEXT,            -- outlook deltaLink, gmail historyId or custom
   last_synced_at      INTEGER,
   status              TEXT,            -- INIT|SYNCING|HOOKED|PAUSED|ERROR
   last_error          TEXT,
+  error_code          TEXT,            -- what the user can do about last_error, see sync.ErrorCode
   retry_count         INTEGER DEFAULT 0,
-  updated_at          INTEGER
+  updated_at          INTEGER,
+  provider_newest_at  INTEGER,         -- newest inbox message at the provider
+  local_newest_at     INTEGER,         -- newest inbox message stored
+  lag_seconds         INTEGER,
+  lag_checked_at      INTEGER,
+  PRIMARY KEY (user_id, provider)
 );
 
 -- Email received events table
@@ -32,22 +43,426 @@ CREATE TABLE IF NOT EXISTS email_received_events (
   snippet             TEXT,
   headers_json        TEXT,                           -- JSON map
   labels_json         TEXT,                           -- JSON array
-  UNIQUE(provider, provider_message_id)
+  folder              TEXT,                           -- inbox|sent|archive|spam|trash|custom
+  deleted_at          INTEGER,                        -- set when deleted at the provider
+  is_read             INTEGER,
+  is_flagged          INTEGER,
+  kind                TEXT,                           -- message|auto_reply|bounce
+  is_list             INTEGER,                        -- mailing list / newsletter
+  list_id             TEXT,
+  list_name           TEXT,
+  list_unsubscribe    TEXT,
+  language            TEXT,                           -- ISO 639-1, detected on ingest
+  translation_lang    TEXT,                           -- language of the translation below
+  translated_subject  TEXT,
+  translated_snippet  TEXT,
+  UNIQUE(user_id, provider, provider_message_id)
 );
 
 -- Transactional outbox for reliable NATS publishing
 CREATE TABLE IF NOT EXISTS outbox (
   id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id             TEXT NOT NULL DEFAULT '',
   ts                  INTEGER NOT NULL,
   subject             TEXT NOT NULL,                  -- NATS subject
   event_type          TEXT NOT NULL,                  -- email.received
   payload             BLOB NOT NULL,
   msg_id              TEXT NOT NULL,                  -- deterministic idempotency key
+  trace_parent        TEXT,                           -- W3C traceparent of the producing operation
   published_at        INTEGER,
   retries             INTEGER DEFAULT 0,
-  next_attempt_at     INTEGER
+  next_attempt_at     INTEGER,
+  last_error          TEXT,                           -- latest publish failure
+  last_error_at       INTEGER,
+  stream              TEXT,                           -- JetStream stream that acked the publish
+  stream_seq          INTEGER                         -- its sequence there
+);
+
+-- Provider folder tree with per-folder sync cursors (Outlook delta links)
+CREATE TABLE IF NOT EXISTS mail_folders (
+  user_id             TEXT NOT NULL DEFAULT '',
+  provider            TEXT NOT NULL,
+  folder_id           TEXT NOT NULL,
+  parent_id           TEXT,
+  display_name        TEXT,
+  folder              TEXT,                           -- canonical folder
+  selected            INTEGER NOT NULL DEFAULT 1,     -- included in sync
+  delta_link          TEXT,
+  updated_at          INTEGER,
+  PRIMARY KEY (user_id, provider, folder_id)
+);
+
+-- Runner liveness: written on every loop so a dead or stuck sync can be
+-- diagnosed from the database alone
+CREATE TABLE IF NOT EXISTS runner_heartbeats (
+  user_id             TEXT NOT NULL DEFAULT '',
+  provider            TEXT NOT NULL,
+  inbox_id            TEXT NOT NULL,
+  instance            TEXT,                           -- host:pid of the API process
+  phase               TEXT,                           -- starting|backfill|incremental|idle|stopped
+  started_at          INTEGER,
+  beat_at             INTEGER,
+  cycles              INTEGER NOT NULL DEFAULT 0,
+  messages            INTEGER NOT NULL DEFAULT 0,
+  changes             INTEGER NOT NULL DEFAULT 0,
+  errors              INTEGER NOT NULL DEFAULT 0,
+  last_error          TEXT,
+  backfill_from       INTEGER,                        -- backfill window start, NULL for all mail
+  oldest_seen         INTEGER,                        -- backfill progress: message date range processed
+  newest_seen         INTEGER,
+  PRIMARY KEY (user_id, provider)
+);
+
+-- Per-user verbose sync logging, toggled by admins and read by runners
+CREATE TABLE IF NOT EXISTS sync_debug (
+  user_id             TEXT PRIMARY KEY,
+  sample_rate         REAL NOT NULL DEFAULT 1,
+  expires_at          INTEGER NOT NULL,
+  set_by              TEXT,
+  set_at              INTEGER
+);
+
+-- Workflow instances (internal/workflow): steps run as jobs, so only the
+-- progress and state live here
+CREATE TABLE IF NOT EXISTS workflows (
+  id                  TEXT PRIMARY KEY,
+  user_id             TEXT NOT NULL,
+  name                TEXT NOT NULL,
+  status              TEXT NOT NULL,                  -- running|waiting|completed|failed|cancelling|cancelled
+  step                INTEGER NOT NULL DEFAULT 0,     -- next step to run
+  state               TEXT NOT NULL DEFAULT '{}',     -- JSON inputs and step outputs
+  wait_event          TEXT,                           -- event type a waiting instance needs
+  wait_field          TEXT,
+  wait_value          TEXT,
+  wake_at             INTEGER,                        -- timer or wait deadline
+  trigger_key         TEXT,                           -- event that started it, unique per user
+  last_error          TEXT,
+  created_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL
+);
+
+-- Cold-tier segments (internal/archive): old messages moved out of
+-- email_received_events into gzipped databases in object storage
+CREATE TABLE IF NOT EXISTS archive_segments (
+  user_id             TEXT NOT NULL,
+  key                 TEXT NOT NULL,                  -- blob key of the segment
+  provider            TEXT NOT NULL,
+  messages            INTEGER NOT NULL,
+  oldest_at           INTEGER NOT NULL,               -- msg_date range
+  newest_at           INTEGER NOT NULL,
+  archived_at         INTEGER NOT NULL,
+  PRIMARY KEY (user_id, key)
+);
+
+-- Archived messages, one per message: the segment that serves it and a
+-- tombstone for deletes at the provider since. Retention and purges delete
+-- rows here; the archive job then rewrites the segments.
+CREATE TABLE IF NOT EXISTS archived_messages (
+  user_id             TEXT NOT NULL,
+  provider            TEXT NOT NULL,
+  provider_message_id TEXT NOT NULL,
+  provider_thread_id  TEXT,
+  inbox_id            TEXT NOT NULL,
+  segment_key         TEXT NOT NULL,
+  kind                TEXT,
+  msg_date            INTEGER,
+  ts                  INTEGER NOT NULL,               -- ingested at
+  deleted_at          INTEGER,                        -- deleted at the provider after archiving
+  PRIMARY KEY (user_id, provider, provider_message_id)
+);
+CREATE INDEX IF NOT EXISTS idx_archived_messages_thread ON archived_messages(user_id, provider_thread_id);
+CREATE INDEX IF NOT EXISTS idx_archived_messages_segment ON archived_messages(user_id, segment_key);
+
+-- The user's decisions on threads awaiting a reply, for their last message
+-- in the thread (message_id); a newer sent message makes the row stale
+CREATE TABLE IF NOT EXISTS followups (
+  user_id             TEXT NOT NULL,
+  provider            TEXT NOT NULL,
+  thread_id           TEXT NOT NULL,
+  message_id          TEXT NOT NULL,
+  snoozed_until       INTEGER,
+  dismissed_at        INTEGER,
+  notified_at         INTEGER,                        -- followup.due published
+  updated_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, provider, thread_id)
+);
+
+-- External task systems the user connected (internal/tasksink)
+CREATE TABLE IF NOT EXISTS task_sinks (
+  user_id             TEXT NOT NULL,
+  name                TEXT NOT NULL,
+  settings            TEXT NOT NULL DEFAULT '{}',     -- JSON sink settings
+  created_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, name)
+);
+
+-- Action items pushed to task sinks, one row per item and sink
+CREATE TABLE IF NOT EXISTS task_deliveries (
+  user_id             TEXT NOT NULL,
+  id                  TEXT NOT NULL,                  -- {source_id}:{sink}:{item index}
+  sink                TEXT NOT NULL,
+  provider            TEXT NOT NULL,
+  thread_id           TEXT NOT NULL,
+  source_id           TEXT NOT NULL,
+  title               TEXT NOT NULL,
+  notes               TEXT,
+  due                 TEXT,
+  status              TEXT NOT NULL,                  -- pending, delivered, failed
+  attempts            INTEGER NOT NULL DEFAULT 0,
+  external_id         TEXT,
+  external_url        TEXT,
+  last_error          TEXT,
+  created_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, id)
+);
+
+-- Message vectors for semantic search (internal/semantic)
+CREATE TABLE IF NOT EXISTS message_embeddings (
+  user_id             TEXT NOT NULL,
+  provider            TEXT NOT NULL,
+  provider_message_id TEXT NOT NULL,
+  model               TEXT NOT NULL,
+  dims                INTEGER NOT NULL,
+  vector              BLOB NOT NULL,                  -- little-endian float32s
+  created_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, provider, provider_message_id)
+);
+
+-- Progress of embedding existing mail, per model (internal/semantic)
+CREATE TABLE IF NOT EXISTS embedding_backfills (
+  user_id             TEXT NOT NULL,
+  model               TEXT NOT NULL,
+  status              TEXT NOT NULL,                  -- running, done
+  cursor              INTEGER NOT NULL DEFAULT 0,     -- email_received_events rowid
+  embedded            INTEGER NOT NULL DEFAULT 0,
+  skipped             INTEGER NOT NULL DEFAULT 0,
+  last_error          TEXT,
+  started_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL,
+  finished_at         INTEGER,
+  PRIMARY KEY (user_id, model)
+);
+
+-- What each enrichment version derived from stored mail (internal/enrich)
+CREATE TABLE IF NOT EXISTS enrichment_outputs (
+  user_id             TEXT NOT NULL,
+  version             TEXT NOT NULL,
+  source_event_id     TEXT NOT NULL,                  -- email_received_events.event_id
+  position            INTEGER NOT NULL,               -- order of the derived events
+  provider            TEXT NOT NULL,
+  provider_message_id TEXT NOT NULL,
+  enricher            TEXT NOT NULL,
+  event_type          TEXT NOT NULL,
+  payload             TEXT NOT NULL,                  -- JSON object
+  created_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, version, source_event_id, position)
+);
+
+-- Re-enrichment progress per enrichment version
+CREATE TABLE IF NOT EXISTS enrichment_runs (
+  user_id             TEXT NOT NULL,
+  version             TEXT NOT NULL,
+  status              TEXT NOT NULL,                  -- running, done
+  publish             INTEGER NOT NULL DEFAULT 0,
+  cursor              INTEGER NOT NULL DEFAULT 0,     -- email_received_events rowid
+  processed           INTEGER NOT NULL DEFAULT 0,
+  derived             INTEGER NOT NULL DEFAULT 0,
+  last_error          TEXT,
+  started_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL,
+  finished_at         INTEGER,
+  PRIMARY KEY (user_id, version)
+);
+
+-- Meeting proposals found in mail (internal/calendar)
+CREATE TABLE IF NOT EXISTS calendar_suggestions (
+  user_id             TEXT NOT NULL,
+  provider            TEXT NOT NULL,
+  provider_message_id TEXT NOT NULL,
+  provider_thread_id  TEXT,
+  source_event_id     TEXT,
+  title               TEXT NOT NULL,
+  candidates          TEXT NOT NULL DEFAULT '[]',     -- JSON array of slots
+  attendees           TEXT NOT NULL DEFAULT '[]',     -- JSON array
+  conference_url      TEXT,
+  starts_at           INTEGER NOT NULL,               -- earliest candidate start, 0 if none
+  ends_at             INTEGER NOT NULL,
+  created_at          INTEGER NOT NULL,
+  source              TEXT NOT NULL DEFAULT 'text',   -- text (meetings enricher) or invite (iCalendar part)
+  invite_uid          TEXT,                           -- the invite's UID, shared by its versions
+  invite_sequence     INTEGER NOT NULL DEFAULT 0,
+  status              TEXT NOT NULL DEFAULT 'active', -- active, cancelled or superseded
+  PRIMARY KEY (user_id, provider, provider_message_id)
+);
+
+-- Topic clusters of related mail, replaced on every clustering (internal/topics)
+CREATE TABLE IF NOT EXISTS topics (
+  user_id             TEXT NOT NULL,
+  topic_id            TEXT NOT NULL,
+  name                TEXT NOT NULL,
+  keywords            TEXT NOT NULL DEFAULT '[]',     -- JSON array
+  model               TEXT NOT NULL,
+  size                INTEGER NOT NULL,
+  latest_at           INTEGER NOT NULL,               -- newest member's msg_date
+  computed_at         INTEGER NOT NULL,
+  PRIMARY KEY (user_id, topic_id)
+);
+
+CREATE TABLE IF NOT EXISTS topic_members (
+  user_id             TEXT NOT NULL,
+  topic_id            TEXT NOT NULL,
+  event_id            TEXT NOT NULL,                  -- email_received_events.event_id
+  provider            TEXT NOT NULL,
+  similarity          REAL NOT NULL,
+  PRIMARY KEY (user_id, topic_id, event_id)
+);
+
+-- Signature details per contact with the message they were last seen in.
+-- Bodies aren't stored, so unlike contacts these can't be re-derived.
+CREATE TABLE IF NOT EXISTS contact_details (
+  user_id             TEXT NOT NULL,
+  email               TEXT NOT NULL,                  -- contacts.email
+  field               TEXT NOT NULL,                  -- title, company, phone, address or website
+  value               TEXT NOT NULL,
+  event_id            TEXT NOT NULL,                  -- email_received_events.event_id
+  provider            TEXT NOT NULL,
+  provider_message_id TEXT NOT NULL,
+  msg_date            INTEGER NOT NULL,
+  first_seen          INTEGER NOT NULL,
+  last_seen           INTEGER NOT NULL,
+  seen_count          INTEGER NOT NULL DEFAULT 1,
+  PRIMARY KEY (user_id, email, field, value)
+);
+
+-- Contacts the user merged. Unlike contacts these can't be re-derived, so a
+-- rebuild keeps merged addresses counting towards their primary.
+CREATE TABLE IF NOT EXISTS contact_merges (
+  user_id             TEXT NOT NULL,
+  id                  TEXT NOT NULL,
+  primary_email       TEXT NOT NULL,
+  merged              TEXT NOT NULL,                  -- JSON array of the addresses merged in
+  merged_at           INTEGER NOT NULL,
+  undone_at           INTEGER,
+  PRIMARY KEY (user_id, id)
+);
+
+-- Addresses of active merges and the contact they count towards, which
+-- follows later merges of the primary
+CREATE TABLE IF NOT EXISTS contact_aliases (
+  user_id             TEXT NOT NULL,
+  email               TEXT NOT NULL,
+  primary_email       TEXT NOT NULL,                  -- contacts.email
+  merge_id            TEXT NOT NULL,                  -- contact_merges.id
+  PRIMARY KEY (user_id, email)
 );
 
+-- Lists suggested for unsubscribing and the user's decision; a dismissed
+-- list is never suggested again
+CREATE TABLE IF NOT EXISTS unsubscribe_suggestions (
+  user_id             TEXT NOT NULL,
+  list_key            TEXT NOT NULL,                  -- List-Id, or the sender
+  list_id             TEXT,
+  name                TEXT,
+  sender              TEXT,
+  message_count       INTEGER NOT NULL DEFAULT 0,
+  read_rate           REAL NOT NULL DEFAULT 0,
+  status              TEXT NOT NULL,                  -- suggested, dismissed or unsubscribed
+  method              TEXT,                           -- one_click or mailto
+  suggested_at        INTEGER,
+  updated_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, list_key)
+);
+
+-- Message attachments; the files are in the blob store, text is extracted
+-- by the attachment_text job
+CREATE TABLE IF NOT EXISTS attachments (
+  user_id             TEXT NOT NULL,
+  id                  TEXT NOT NULL,
+  event_id            TEXT NOT NULL,                  -- email_received_events.event_id
+  provider            TEXT NOT NULL,
+  provider_message_id TEXT NOT NULL,
+  filename            TEXT NOT NULL DEFAULT '',
+  content_type        TEXT NOT NULL DEFAULT '',
+  size                INTEGER NOT NULL,
+  blob_key            TEXT,
+  status              TEXT NOT NULL,                  -- pending, extracted, skipped or failed
+  text                TEXT,
+  error               TEXT,
+  created_at          INTEGER NOT NULL,
+  extracted_at        INTEGER,
+  PRIMARY KEY (user_id, id)
+);
+
+-- Rules deciding which received mail is synced (block, or allow despite a block)
+CREATE TABLE IF NOT EXISTS sender_rules (
+  user_id             TEXT NOT NULL,
+  id                  TEXT NOT NULL,
+  action              TEXT NOT NULL,                  -- block or allow
+  kind                TEXT NOT NULL,                  -- sender, domain or header
+  header              TEXT,                           -- header name, for kind header
+  value               TEXT NOT NULL DEFAULT '',
+  created_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, id)
+);
+
+-- Received messages the sync pipeline held back (internal/sync), kept for
+-- review and requeueing
+CREATE TABLE IF NOT EXISTS quarantined_messages (
+  id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id             TEXT NOT NULL,
+  provider            TEXT NOT NULL,
+  inbox_id            TEXT NOT NULL DEFAULT '',
+  provider_message_id TEXT NOT NULL,
+  reason              TEXT NOT NULL,                  -- validation, stage, size or store
+  detail              TEXT NOT NULL DEFAULT '',
+  message             TEXT NOT NULL,                  -- JSON, as the provider returned it
+  status              TEXT NOT NULL,                  -- pending, requeued, released or discarded
+  attempts            INTEGER NOT NULL DEFAULT 1,
+  created_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL,
+  UNIQUE (user_id, provider, provider_message_id)
+);
+
+-- Generic events posted through /events (memory facts and the like)
+CREATE TABLE IF NOT EXISTS events (
+  id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id             TEXT NOT NULL DEFAULT '',
+  type                TEXT NOT NULL,
+  data                TEXT NOT NULL,
+  created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_type ON events(type);
+CREATE INDEX IF NOT EXISTS idx_events_created_at ON events(created_at DESC);
+
+-- Downstream consumers' acknowledgments of published events (POST
+-- /events/:id/ack): which stage processed which event
+CREATE TABLE IF NOT EXISTS processing_status (
+  user_id             TEXT NOT NULL,
+  event_id            TEXT NOT NULL,                  -- the event_id of the published payload
+  consumer            TEXT NOT NULL,                  -- e.g. brain.summarizer
+  event_type          TEXT NOT NULL DEFAULT '',
+  status              TEXT NOT NULL,                  -- processed or failed
+  detail              TEXT NOT NULL DEFAULT '',
+  attempts            INTEGER NOT NULL DEFAULT 1,     -- acks received
+  first_acked_at      INTEGER NOT NULL,
+  acked_at            INTEGER NOT NULL,
+  PRIMARY KEY (user_id, event_id, consumer)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processing_status_consumer ON processing_status(user_id, consumer, status, acked_at);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflows_trigger ON workflows(user_id, trigger_key) WHERE trigger_key IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_workflows_waiting ON workflows(user_id, status, wait_event);
+CREATE INDEX IF NOT EXISTS idx_task_deliveries_created ON task_deliveries(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_calendar_suggestions_ends ON calendar_suggestions(user_id, ends_at);
+CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(user_id, provider, provider_message_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_event ON attachments(user_id, event_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_pending ON attachments(user_id, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_contact_aliases_primary ON contact_aliases(user_id, primary_email);
+CREATE INDEX IF NOT EXISTS idx_quarantined_status ON quarantined_messages(user_id, status, id);
 CREATE INDEX IF NOT EXISTS idx_outbox_ready ON outbox(published_at, next_attempt_at);
 CREATE INDEX IF NOT EXISTS idx_email_events_ts ON email_received_events(ts DESC);
 CREATE INDEX IF NOT EXISTS idx_email_events_provider ON email_received_events(provider, provider_message_id);
@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+)
+
+// SearchMessages returns stored messages matching q, newest first
+func (s *Store) SearchMessages(ctx context.Context, q *search.Query, limit int) ([]StoredMessage, error) {
+	where, args := searchWhere(q)
+	where = "user_id = ? AND " + where
+	args = append([]interface{}{s.userID}, args...)
+
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM email_received_events
+		WHERE `+where+`
+		ORDER BY msg_date DESC
+		LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []StoredMessage
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// searchWhere translates query clauses into a WHERE expression. Free text goes
+// through the FTS index; operators become column filters.
+func searchWhere(q *search.Query) (string, []interface{}) {
+	conds := []string{"deleted_at IS NULL"}
+	var args []interface{}
+
+	for _, c := range q.Clauses {
+		var (
+			cond    string
+			condArg []interface{}
+		)
+
+		switch c.Field {
+		case search.FieldText:
+			cond = "(rowid IN (SELECT rowid FROM email_fts WHERE email_fts MATCH ?)" +
+				" OR rowid IN (SELECT rowid FROM translation_fts WHERE translation_fts MATCH ?)" +
+				" OR event_id IN (SELECT event_id FROM attachments WHERE rowid IN" +
+				" (SELECT rowid FROM attachment_fts WHERE attachment_fts MATCH ?)))"
+			condArg = []interface{}{ftsPhrase(c.Value), ftsPhrase(c.Value), ftsPhrase(c.Value)}
+		case search.FieldFrom:
+			cond = "sender LIKE ? ESCAPE '\\'"
+			condArg = []interface{}{likePattern(c.Value)}
+		case search.FieldTo:
+			cond = "(to_addrs LIKE ? ESCAPE '\\' OR cc_addrs LIKE ? ESCAPE '\\')"
+			condArg = []interface{}{likePattern(c.Value), likePattern(c.Value)}
+		case search.FieldSubject:
+			cond = "subject LIKE ? ESCAPE '\\'"
+			condArg = []interface{}{likePattern(c.Value)}
+		case search.FieldLabel:
+			cond = "labels_json LIKE ? ESCAPE '\\'"
+			condArg = []interface{}{likePattern(`"` + c.Value + `"`)}
+		case search.FieldLang:
+			cond = "language = ?"
+			condArg = []interface{}{c.Value}
+		case search.FieldIn:
+			cond = "folder = ?"
+			condArg = []interface{}{c.Value}
+		case search.FieldIs:
+			switch c.Value {
+			case "read":
+				cond = "is_read = 1"
+			case "unread":
+				cond = "is_read = 0"
+			default: // starred, flagged
+				cond = "is_flagged = 1"
+			}
+		case search.FieldHas:
+			// Only imported mail has attachment records; for synced mail
+			// multipart/mixed is the usual marker
+			cond = "(decompress(headers_json) LIKE ? ESCAPE '\\' OR event_id IN (SELECT event_id FROM attachments))"
+			condArg = []interface{}{likePattern("multipart/mixed")}
+		case search.FieldBefore:
+			cond = "msg_date < ?"
+			condArg = []interface{}{c.Time.Unix()}
+		case search.FieldAfter:
+			cond = "msg_date >= ?"
+			condArg = []interface{}{c.Time.Unix()}
+		default:
+			continue
+		}
+
+		if c.Negated {
+			cond = "NOT COALESCE(" + cond + ", 0)"
+		}
+		conds = append(conds, cond)
+		args = append(args, condArg...)
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// ftsPhrase quotes free text as an FTS5 phrase so operators in user input are literal
+func ftsPhrase(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// likePattern builds a case-insensitive substring pattern, escaping wildcards
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
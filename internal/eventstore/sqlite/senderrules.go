@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AddSenderRule stores a rule, setting its creation time
+func (s *Store) AddSenderRule(ctx context.Context, rule *SenderRule) error {
+	rule.CreatedAt = time.Now().Unix()
+	_, err := s.exec(ctx, "add_sender_rule", `
+		INSERT INTO sender_rules (user_id, id, action, kind, header, value, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+	`, s.userID, rule.ID, rule.Action, rule.Kind, rule.Header, rule.Value, rule.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save sender rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteSenderRule removes a rule, returning false if it didn't exist
+func (s *Store) DeleteSenderRule(ctx context.Context, id string) (bool, error) {
+	res, err := s.exec(ctx, "delete_sender_rule", `
+		DELETE FROM sender_rules WHERE user_id = ? AND id = ?
+	`, s.userID, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete sender rule: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListSenderRules returns the user's sender rules, oldest first
+func (s *Store) ListSenderRules(ctx context.Context) ([]SenderRule, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT id, action, kind, COALESCE(header, ''), value, created_at
+		FROM sender_rules
+		WHERE user_id = ?
+		ORDER BY created_at, id
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sender rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []SenderRule{}
+	for rows.Next() {
+		var r SenderRule
+		if err := rows.Scan(&r.ID, &r.Action, &r.Kind, &r.Header, &r.Value, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sender rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -15,36 +16,59 @@ import (
 //go:embed schema.sql
 var schemaSQL string
 
-// Store represents a per-user event store
+// Store is a user's event store. Every query is scoped to userID, so a Store
+// can sit on a per-user database file or on a database shared by all users.
+//
+// Writes go through DB, a single connection, and a write gate shared by every
+// Store on the same file, so writers queue instead of fighting over the
+// SQLite write lock; writes that still find it busy are retried with backoff.
+// Read-only queries use a separate query_only pool and never wait behind a
+// sync transaction.
 type Store struct {
-	DB *sql.DB
+	DB     *sql.DB // writer; nil for read-only handles
+	read   *sql.DB // query_only readers
+	gate   writeGate
+	userID string
+	shared bool // pools belong to an Opener and outlive the Store
 }
 
-// OutboxMessage represents a message in the outbox
-type OutboxMessage struct {
-	ID      int64
-	Subject string
-	Payload []byte
-	MsgID   string
-}
+// readerConns is the size of a per-user reader pool
+const readerConns = 4
 
 // OpenUserDB opens or creates a per-user event database
-func OpenUserDB(dbPath string) (*Store, error) {
+func OpenUserDB(dbPath, userID string) (*Store, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("user id required")
+	}
+
+	db, err := openDB(dbPath, userID)
+	if err != nil {
+		return nil, err
+	}
+	read, err := openReader(dbPath, userID, readerConns)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{DB: db, read: read, gate: gateFor(dbPath), userID: userID}, nil
+}
+
+// openDB opens a database and applies the schema. userID is the owner of a
+// per-user database, empty for a shared one.
+func openDB(dbPath, userID string) (*sql.DB, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Open database with optimized settings
-	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
+	// Open database with optimized settings; slow statements are logged
+	db := openTimed(dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)", dbLabel(userID))
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
+	// One writer connection: SQLite allows a single writer anyway, and
+	// serializing in the pool avoids SQLITE_BUSY between our own writers
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(time.Hour)
 
 	// Apply schema
@@ -53,57 +77,95 @@ func OpenUserDB(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to apply schema: %w", err)
 	}
 
-	return &Store{DB: db}, nil
+	// Bring databases created by older versions up to date
+	if err := migrate(db, userID); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return db, nil
 }
 
-// Close closes the database connection
+// openReader opens a pool of read-only connections to an existing database.
+// WAL mode lets them read while the writer holds the write lock. userID is
+// the owner of a per-user database, empty for a shared one.
+func openReader(dbPath, userID string, conns int) (*sql.DB, error) {
+	db := openTimed(dbPath+"?_pragma=query_only(1)&_pragma=busy_timeout(5000)", dbLabel(userID))
+
+	db.SetMaxOpenConns(conns)
+	db.SetMaxIdleConns(conns)
+	db.SetConnMaxLifetime(time.Hour)
+	return db, nil
+}
+
+// Close closes the database connections (a no-op for shared databases)
 func (s *Store) Close() error {
-	return s.DB.Close()
-}
-
-// AppendEmailReceivedTx appends an email event and outbox entry in a transaction
-func (s *Store) AppendEmailReceivedTx(
-	ctx context.Context,
-	tx *sql.Tx,
-	eventID string,
-	ts int64,
-	msgDate int64,
-	provider string,
-	inboxID string,
-	userID string,
-	providerMessageID string,
-	providerThreadID string,
-	subject string,
-	sender string,
-	toAddrs string,
-	ccAddrs string,
-	bccAddrs string,
-	snippet string,
-	headersJSON string,
-	labelsJSON string,
-	natsSubject string,
-	eventType string,
-	payload []byte,
-	msgID string,
-) error {
-	// Insert email event (UNIQUE constraint on provider+message_id prevents duplicates)
-	_, err := tx.ExecContext(ctx, `
+	if s.shared {
+		return nil
+	}
+	var err error
+	if s.DB != nil {
+		err = s.DB.Close()
+	}
+	if s.read != nil {
+		if rerr := s.read.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// UserID returns the user the store is scoped to
+func (s *Store) UserID() string {
+	return s.userID
+}
+
+// AppendEmailReceivedTx appends an email event and outbox entry in a transaction.
+// Returns false (and queues nothing) if the message was already stored.
+func (s *Store) AppendEmailReceivedTx(ctx context.Context, tx *sql.Tx, ev EmailEvent, out OutboxEntry) (bool, error) {
+	// Events are always written under the store's user
+	ev.UserID = s.userID
+
+	start := time.Now()
+	inserted, err := s.appendEmailReceivedTx(ctx, tx, ev, out)
+	observeInsert(ctx, start, inserted, err)
+	return inserted, err
+}
+
+// appendEmailReceivedTx is AppendEmailReceivedTx without instrumentation
+func (s *Store) appendEmailReceivedTx(ctx context.Context, tx *sql.Tx, ev EmailEvent, out OutboxEntry) (bool, error) {
+	// Insert email event (UNIQUE constraint on user+provider+message_id prevents duplicates)
+	res, err := tx.ExecContext(ctx, `
 		INSERT OR IGNORE INTO email_received_events
 		(event_id, ts, msg_date, provider, inbox_id, user_id, provider_message_id, provider_thread_id,
-		 subject, sender, to_addrs, cc_addrs, bcc_addrs, snippet, headers_json, labels_json)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, eventID, ts, msgDate, provider, inboxID, userID, providerMessageID, providerThreadID,
-		subject, sender, toAddrs, ccAddrs, bccAddrs, snippet, headersJSON, labelsJSON)
+		 subject, sender, to_addrs, cc_addrs, bcc_addrs, snippet, headers_json, labels_json, folder,
+		 is_read, is_flagged, kind, is_list, list_id, list_name, list_unsubscribe, language)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
+	`, ev.EventID, ev.TS, ev.MsgDate, ev.Provider, ev.InboxID, ev.UserID, ev.ProviderMessageID, ev.ProviderThreadID,
+		ev.Subject, ev.Sender, ev.ToAddrs, ev.CcAddrs, ev.BccAddrs, ev.Snippet, compressText(ev.HeadersJSON), ev.LabelsJSON, ev.Folder,
+		ev.IsRead, ev.IsFlagged, ev.Kind, ev.IsList, ev.ListID, ev.ListName, ev.ListUnsubscribe, ev.Language)
 	
 	if err != nil {
-		return fmt.Errorf("failed to insert email event: %w", err)
+		return false, fmt.Errorf("failed to insert email event: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	if err := updateContactsTx(ctx, tx, ev); err != nil {
+		return false, err
 	}
 
-	// Insert outbox entry
-	_, err = tx.ExecContext(ctx, `
-		INSERT INTO outbox (ts, subject, event_type, payload, msg_id, next_attempt_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, time.Now().Unix(), natsSubject, eventType, payload, msgID, time.Now().Unix())
+	return true, s.AppendOutboxTx(ctx, tx, out)
+}
+
+// AppendOutboxTx inserts an outbox entry as part of an existing transaction
+func (s *Store) AppendOutboxTx(ctx context.Context, tx *sql.Tx, out OutboxEntry) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox (user_id, ts, subject, event_type, payload, msg_id, trace_parent, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.userID, time.Now().Unix(), out.Subject, out.EventType, compress(out.Payload), out.MsgID, out.TraceParent, time.Now().Unix())
 	
 	if err != nil {
 		return fmt.Errorf("failed to insert outbox entry: %w", err)
@@ -117,36 +179,39 @@ func (s *Store) DequeueOutbox(ctx context.Context, limit int) ([]OutboxMessage,
 	now := time.Now().Unix()
 	
 	rows, err := s.DB.QueryContext(ctx, `
-		SELECT id, subject, payload, msg_id
+		SELECT id, subject, decompress(payload), msg_id, COALESCE(trace_parent, ''), ts
 		FROM outbox
-		WHERE published_at IS NULL
+		WHERE user_id = ?
+		  AND published_at IS NULL
 		  AND next_attempt_at <= ?
 		ORDER BY id
 		LIMIT ?
-	`, now, limit)
+	`, s.userID, now, limit)
 	
 	if err != nil {
-		return nil, fmt.Errorf("failed to query outbox: %w", err)
+		return nil, fmt.Errorf("failed to query outbox: %w", observeBusy(ctx, "dequeue", err))
 	}
 	defer rows.Close()
 
 	var messages []OutboxMessage
 	for rows.Next() {
 		var msg OutboxMessage
-		if err := rows.Scan(&msg.ID, &msg.Subject, &msg.Payload, &msg.MsgID); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.Subject, &msg.Payload, &msg.MsgID, &msg.TraceParent, &msg.TS); err != nil {
 			return nil, fmt.Errorf("failed to scan outbox row: %w", err)
 		}
 		messages = append(messages, msg)
 	}
 
+	dequeueSize.Record(ctx, int64(len(messages)))
 	return messages, nil
 }
 
-// MarkPublished marks an outbox message as published
-func (s *Store) MarkPublished(ctx context.Context, id int64) error {
-	_, err := s.DB.ExecContext(ctx, `
-		UPDATE outbox SET published_at = ? WHERE id = ?
-	`, time.Now().Unix(), id)
+// MarkPublished marks an outbox message as published, recording the stream
+// and sequence JetStream acknowledged it with
+func (s *Store) MarkPublished(ctx context.Context, id int64, stream string, seq uint64) error {
+	_, err := s.exec(ctx, "mark_published", `
+		UPDATE outbox SET published_at = ?, stream = NULLIF(?, ''), stream_seq = NULLIF(?, 0) WHERE id = ? AND user_id = ?
+	`, time.Now().Unix(), stream, int64(seq), id, s.userID)
 	
 	if err != nil {
 		return fmt.Errorf("failed to mark published: %w", err)
@@ -155,14 +220,20 @@ func (s *Store) MarkPublished(ctx context.Context, id int64) error {
 	return nil
 }
 
-// MarkOutboxRetry updates retry count and next attempt time
-func (s *Store) MarkOutboxRetry(ctx context.Context, id int64, backoff time.Duration) error {
-	_, err := s.DB.ExecContext(ctx, `
+// MarkOutboxRetry updates retry count, last error and next attempt time
+func (s *Store) MarkOutboxRetry(ctx context.Context, id int64, backoff time.Duration, lastError string) error {
+	if len(lastError) > maxOutboxError {
+		lastError = lastError[:maxOutboxError]
+	}
+	now := time.Now()
+	_, err := s.exec(ctx, "mark_retry", `
 		UPDATE outbox 
 		SET retries = retries + 1,
-		    next_attempt_at = ?
-		WHERE id = ?
-	`, time.Now().Add(backoff).Unix(), id)
+		    next_attempt_at = ?,
+		    last_error = ?,
+		    last_error_at = ?
+		WHERE id = ? AND user_id = ?
+	`, now.Add(backoff).Unix(), lastError, now.Unix(), id, s.userID)
 	
 	if err != nil {
 		return fmt.Errorf("failed to mark retry: %w", err)
@@ -175,8 +246,8 @@ func (s *Store) MarkOutboxRetry(ctx context.Context, id int64, backoff time.Dura
 func (s *Store) LoadCheckpoint(ctx context.Context, provider string) (string, error) {
 	var cursor sql.NullString
 	err := s.DB.QueryRowContext(ctx, `
-		SELECT cursor FROM provider_sync_state WHERE provider = ?
-	`, provider).Scan(&cursor)
+		SELECT cursor FROM provider_sync_state WHERE user_id = ? AND provider = ?
+	`, s.userID, provider).Scan(&cursor)
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -188,17 +259,21 @@ func (s *Store) LoadCheckpoint(ctx context.Context, provider string) (string, er
 	return cursor.String, nil
 }
 
-// SaveCheckpoint saves sync checkpoint for a provider
+// SaveCheckpoint saves sync checkpoint for a provider. A HOOKED checkpoint
+// ends a run of failures, so it resets the retry count.
 func (s *Store) SaveCheckpoint(ctx context.Context, provider, inboxID, cursor, status string) error {
-	_, err := s.DB.ExecContext(ctx, `
-		INSERT INTO provider_sync_state (provider, inbox_id, cursor, last_synced_at, status, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(provider) DO UPDATE SET
+	_, err := s.exec(ctx, "save_checkpoint", `
+		INSERT INTO provider_sync_state (user_id, provider, inbox_id, cursor, last_synced_at, status, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO UPDATE SET
+			inbox_id = excluded.inbox_id,
 			cursor = excluded.cursor,
 			last_synced_at = excluded.last_synced_at,
 			status = excluded.status,
+			retry_count = CASE WHEN excluded.status = 'HOOKED' THEN 0 ELSE retry_count END,
+			error_code = CASE WHEN excluded.status = 'HOOKED' THEN NULL ELSE error_code END,
 			updated_at = excluded.updated_at
-	`, provider, inboxID, cursor, time.Now().Unix(), status, time.Now().Unix())
+	`, s.userID, provider, inboxID, cursor, time.Now().Unix(), status, time.Now().Unix())
 	
 	if err != nil {
 		return fmt.Errorf("failed to save checkpoint: %w", err)
@@ -208,15 +283,198 @@ func (s *Store) SaveCheckpoint(ctx context.Context, provider, inboxID, cursor, s
 }
 
 // UpdateSyncStatus updates sync status with error info
-func (s *Store) UpdateSyncStatus(ctx context.Context, provider, status, errorMsg string) error {
-	_, err := s.DB.ExecContext(ctx, `
+func (s *Store) UpdateSyncStatus(ctx context.Context, provider, status, errorCode, errorMsg string) error {
+	_, err := s.exec(ctx, "update_sync_status", `
 		UPDATE provider_sync_state
 		SET status = ?,
 		    last_error = ?,
+		    error_code = ?,
 		    retry_count = CASE WHEN ? != '' THEN retry_count + 1 ELSE retry_count END,
 		    updated_at = ?
-		WHERE provider = ?
-	`, status, errorMsg, errorMsg, time.Now().Unix(), provider)
+		WHERE user_id = ? AND provider = ?
+	`, status, errorMsg, errorCode, errorMsg, time.Now().Unix(), s.userID, provider)
 	
 	return err
 }
+
+// PurgeInbox deletes what was synced from one of a provider's inboxes:
+// its email events, sync state, heartbeat and quarantined messages, and the
+// follow-up state, task deliveries, embeddings, calendar suggestions,
+// enrichment outputs, topic memberships, attachment records, contact details
+// and outbox entries (published or not) of its messages. Its archived
+// messages leave the index, so the archive job rewrites their segments
+// without them. Folders and archive segments are kept per provider, so they
+// go with the provider's last inbox, as do the derived rows of archived mail.
+// Contacts are rebuilt from the remaining messages. Returns the number of
+// events deleted.
+func (s *Store) PurgeInbox(ctx context.Context, provider, inboxID string) (int64, error) {
+	var deleted int64
+	err := s.writeTx(ctx, "purge_inbox", func(tx *sql.Tx) error {
+		var shared bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM email_received_events WHERE user_id = ? AND provider = ? AND inbox_id != ?)
+			    OR EXISTS (SELECT 1 FROM archived_messages WHERE user_id = ? AND provider = ? AND inbox_id != ?)
+			    OR EXISTS (SELECT 1 FROM runner_heartbeats WHERE user_id = ? AND provider = ? AND inbox_id != ?)
+		`, s.userID, provider, inboxID, s.userID, provider, inboxID, s.userID, provider, inboxID).Scan(&shared); err != nil {
+			return fmt.Errorf("failed to check other inboxes: %w", err)
+		}
+
+		// Rows derived from mail cover the inbox's messages while another
+		// inbox of the provider is kept, and all of the provider's otherwise
+		inbox := func(column, eventColumn string) (string, []interface{}) {
+			if !shared {
+				return "user_id = ? AND provider = ?", []interface{}{s.userID, provider}
+			}
+			return "user_id = ? AND provider = ? AND " + column + ` IN (
+				SELECT ` + eventColumn + ` FROM email_received_events WHERE user_id = ? AND provider = ? AND inbox_id = ?
+			)`, []interface{}{s.userID, provider, s.userID, provider, inboxID}
+		}
+		var messages map[string]bool
+		if shared {
+			var err error
+			if messages, err = inboxMessagesTx(ctx, tx, s.userID, provider, inboxID); err != nil {
+				return err
+			}
+		}
+		if err := purgeOutboxTx(ctx, tx, s.userID, provider, messages); err != nil {
+			return err
+		}
+
+		for _, d := range []struct {
+			table, column, eventColumn, what string
+		}{
+			{"followups", "message_id", "provider_message_id", "follow-ups"},
+			{"task_deliveries", "thread_id", "provider_thread_id", "task deliveries"},
+			{"message_embeddings", "provider_message_id", "provider_message_id", "embeddings"},
+			{"calendar_suggestions", "provider_message_id", "provider_message_id", "calendar suggestions"},
+			{"enrichment_outputs", "provider_message_id", "provider_message_id", "enrichment outputs"},
+			{"topic_members", "event_id", "event_id", "topic members"},
+			{"attachments", "provider_message_id", "provider_message_id", "attachments"},
+			{"contact_details", "provider_message_id", "provider_message_id", "contact details"},
+		} {
+			where, args := inbox(d.column, d.eventColumn)
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+d.table+` WHERE `+where, args...); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", d.what, err)
+			}
+		}
+
+		for _, d := range []struct{ table, what string }{
+			{"provider_sync_state", "sync state"},
+			{"runner_heartbeats", "heartbeat"},
+			{"quarantined_messages", "quarantined messages"},
+			{"archived_messages", "archived messages"},
+		} {
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM `+d.table+` WHERE user_id = ? AND provider = ? AND inbox_id = ?
+			`, s.userID, provider, inboxID); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", d.what, err)
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM email_received_events WHERE user_id = ? AND provider = ? AND inbox_id = ?
+		`, s.userID, provider, inboxID)
+		if err != nil {
+			return fmt.Errorf("failed to delete email events: %w", err)
+		}
+		deleted, _ = res.RowsAffected()
+
+		if !shared {
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM mail_folders WHERE user_id = ? AND provider = ?
+			`, s.userID, provider); err != nil {
+				return fmt.Errorf("failed to delete folders: %w", err)
+			}
+
+			// Forgetting the segments hides them from reads; the archive job
+			// deletes the unreferenced blobs
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM archive_segments WHERE user_id = ? AND provider = ?
+			`, s.userID, provider); err != nil {
+				return fmt.Errorf("failed to delete archive segments: %w", err)
+			}
+		}
+
+		// Contacts aggregate across providers, so re-derive them from what's left
+		if err := rebuildContactsTx(ctx, tx, s.userID); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// inboxMessagesTx returns the provider message IDs stored for an inbox
+func inboxMessagesTx(ctx context.Context, tx *sql.Tx, userID, provider, inboxID string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT provider_message_id FROM email_received_events
+		WHERE user_id = ? AND provider = ? AND inbox_id = ?
+	`, userID, provider, inboxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan inbox message: %w", err)
+		}
+		messages[id] = true
+	}
+	return messages, rows.Err()
+}
+
+// purgeOutboxTx deletes the outbox entries about a provider's messages,
+// published or not; only those about messages when it isn't nil. Their
+// msg_id is "<event_type>|<provider>|<provider_message_id>", possibly
+// followed by "|" and more.
+func purgeOutboxTx(ctx context.Context, tx *sql.Tx, userID, provider string, messages map[string]bool) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, msg_id FROM outbox WHERE user_id = ? AND msg_id LIKE ?
+	`, userID, "%|"+provider+"|%")
+	if err != nil {
+		return fmt.Errorf("failed to query outbox entries: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var (
+			id    int64
+			msgID string
+		)
+		if err := rows.Scan(&id, &msgID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan outbox entry: %w", err)
+		}
+		parts := strings.SplitN(msgID, "|", 3)
+		if len(parts) == 3 && parts[1] == provider && (messages == nil || aboutMessage(parts[2], messages)) {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query outbox entries: %w", err)
+	}
+
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM outbox WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete outbox entries: %w", err)
+		}
+	}
+	return nil
+}
+
+// aboutMessage reports whether the message part of an outbox msg_id, which
+// may carry a "|..." suffix, names one of messages
+func aboutMessage(rest string, messages map[string]bool) bool {
+	for i := len(rest); i >= 0; i = strings.LastIndexByte(rest[:i], '|') {
+		if messages[rest[:i]] {
+			return true
+		}
+	}
+	return false
+}
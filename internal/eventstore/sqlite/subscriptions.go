@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// subscriptionsQuery aggregates list/newsletter mail by List-Id (or sender
+// when the message has no List-Id). Engagement comes from read and flag
+// state and from sent mail in the same threads.
+const subscriptionsQuery = `
+	WITH replied AS (
+		SELECT DISTINCT provider, provider_thread_id
+		FROM email_received_events
+		WHERE user_id = ? AND folder = 'sent' AND provider_thread_id <> '' AND deleted_at IS NULL
+	)
+	SELECT COALESCE(NULLIF(e.list_id, ''), e.sender) AS list_key,
+	       MAX(e.list_id),
+	       MAX(e.list_name),
+	       MAX(e.sender),
+	       MAX(e.list_unsubscribe),
+	       MAX(CASE WHEN decompress(e.headers_json) LIKE '%List-Unsubscribe=One-Click%' THEN 1 ELSE 0 END),
+	       COUNT(*),
+	       SUM(CASE WHEN e.is_read = 0 THEN 1 ELSE 0 END),
+	       SUM(CASE WHEN e.is_flagged = 1 THEN 1 ELSE 0 END),
+	       SUM(CASE WHEN r.provider IS NOT NULL THEN 1 ELSE 0 END),
+	       MIN(e.msg_date),
+	       MAX(e.msg_date)
+	FROM email_received_events e
+	LEFT JOIN replied r ON r.provider = e.provider AND r.provider_thread_id = e.provider_thread_id
+	WHERE e.user_id = ? AND e.is_list = 1 AND e.deleted_at IS NULL AND COALESCE(e.msg_date, e.ts) >= ?`
+
+// ListSubscriptions aggregates list mail dated at or after since, most
+// active first
+func (s *Store) ListSubscriptions(ctx context.Context, since int64) ([]Subscription, error) {
+	return s.querySubscriptions(ctx, subscriptionsQuery+`
+		GROUP BY list_key
+		ORDER BY COUNT(*) DESC
+	`, s.userID, s.userID, since)
+}
+
+// LoadSubscription returns one list by key, nil if there's no mail from it
+func (s *Store) LoadSubscription(ctx context.Context, key string) (*Subscription, error) {
+	subs, err := s.querySubscriptions(ctx, subscriptionsQuery+`
+		AND COALESCE(NULLIF(e.list_id, ''), e.sender) = ?
+		GROUP BY list_key
+	`, s.userID, s.userID, 0, key)
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+	return &subs[0], nil
+}
+
+func (s *Store) querySubscriptions(ctx context.Context, query string, args ...any) ([]Subscription, error) {
+	rows, err := s.read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []Subscription
+	for rows.Next() {
+		var (
+			sub                         Subscription
+			listID, name, sender, unsub sql.NullString
+			unread, flagged, replied    sql.NullInt64
+			first, last                 sql.NullInt64
+		)
+		if err := rows.Scan(&sub.Key, &listID, &name, &sender, &unsub, &sub.OneClick, &sub.MessageCount,
+			&unread, &flagged, &replied, &first, &last); err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		sub.ListID = listID.String
+		sub.Name = name.String
+		sub.Sender = sender.String
+		sub.Unsubscribe = unsub.String
+		sub.UnreadCount = unread.Int64
+		sub.FlaggedCount = flagged.Int64
+		sub.RepliedCount = replied.Int64
+		sub.FirstMessageAt = first.Int64
+		sub.LastMessageAt = last.Int64
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// SuggestUnsubscribeTx records a suggestion unless the list already has a row
+func (s *Store) SuggestUnsubscribeTx(ctx context.Context, tx *sql.Tx, sug UnsubscribeSuggestion) (bool, error) {
+	now := time.Now().Unix()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO unsubscribe_suggestions (user_id, list_key, list_id, name, sender, message_count, read_rate,
+		                                     status, suggested_at, updated_at)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, list_key) DO NOTHING
+	`, s.userID, sug.Key, sug.ListID, sug.Name, sug.Sender, sug.MessageCount, sug.ReadRate,
+		eventstore.UnsubscribeSuggested, now, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to save unsubscribe suggestion: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// SetUnsubscribeStatus records the user's decision on a list
+func (s *Store) SetUnsubscribeStatus(ctx context.Context, sug UnsubscribeSuggestion) error {
+	_, err := s.exec(ctx, "set_unsubscribe_status", `
+		INSERT INTO unsubscribe_suggestions (user_id, list_key, list_id, name, sender, status, method, updated_at)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, NULLIF(?, ''), ?)
+		ON CONFLICT(user_id, list_key) DO UPDATE SET
+			status = excluded.status, method = excluded.method, updated_at = excluded.updated_at
+	`, s.userID, sug.Key, sug.ListID, sug.Name, sug.Sender, sug.Status, sug.Method, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to update unsubscribe suggestion: %w", err)
+	}
+	return nil
+}
+
+// UnsubscribeSuggestions returns suggestions, optionally with one status,
+// newest first
+func (s *Store) UnsubscribeSuggestions(ctx context.Context, status string) ([]UnsubscribeSuggestion, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT list_key, COALESCE(list_id, ''), COALESCE(name, ''), COALESCE(sender, ''), message_count, read_rate,
+		       status, COALESCE(method, ''), COALESCE(suggested_at, 0), updated_at
+		FROM unsubscribe_suggestions
+		WHERE user_id = ? AND (? = '' OR status = ?)
+		ORDER BY updated_at DESC, list_key
+	`, s.userID, status, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unsubscribe suggestions: %w", err)
+	}
+	defer rows.Close()
+
+	var out []UnsubscribeSuggestion
+	for rows.Next() {
+		var sug UnsubscribeSuggestion
+		if err := rows.Scan(&sug.Key, &sug.ListID, &sug.Name, &sug.Sender, &sug.MessageCount, &sug.ReadRate,
+			&sug.Status, &sug.Method, &sug.SuggestedAt, &sug.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan unsubscribe suggestion: %w", err)
+		}
+		out = append(out, sug)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SaveSyncLag records the latest freshness measurement for a provider
+func (s *Store) SaveSyncLag(ctx context.Context, provider string, lag SyncLag) error {
+	_, err := s.exec(ctx, "save_sync_lag", `
+		UPDATE provider_sync_state
+		SET provider_newest_at = ?,
+		    local_newest_at = ?,
+		    lag_seconds = ?,
+		    lag_checked_at = ?
+		WHERE user_id = ? AND provider = ?
+	`, lag.ProviderNewestAt, lag.LocalNewestAt, lag.LagSeconds, lag.CheckedAt, s.userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to save sync lag: %w", err)
+	}
+	return nil
+}
+
+// NewestMessageDate returns the newest message date (unix seconds) stored for
+// a provider in a canonical folder, 0 if there is none
+func (s *Store) NewestMessageDate(ctx context.Context, provider, folder string) (int64, error) {
+	var newest sql.NullInt64
+	err := s.read.QueryRowContext(ctx, `
+		SELECT MAX(msg_date) FROM email_received_events
+		WHERE user_id = ? AND provider = ? AND folder = ? AND deleted_at IS NULL
+	`, s.userID, provider, folder).Scan(&newest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query newest message: %w", err)
+	}
+	return newest.Int64, nil
+}
+
+// SaveHeartbeat records a runner's liveness
+func (s *Store) SaveHeartbeat(ctx context.Context, hb Heartbeat) error {
+	_, err := s.exec(ctx, "save_heartbeat", `
+		INSERT INTO runner_heartbeats (user_id, provider, inbox_id, instance, phase, started_at,
+		                               beat_at, cycles, messages, changes, errors, last_error,
+		                               backfill_from, oldest_seen, newest_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, provider) DO UPDATE SET
+			inbox_id = excluded.inbox_id,
+			instance = excluded.instance,
+			phase = excluded.phase,
+			started_at = excluded.started_at,
+			beat_at = excluded.beat_at,
+			cycles = excluded.cycles,
+			messages = excluded.messages,
+			changes = excluded.changes,
+			errors = excluded.errors,
+			last_error = excluded.last_error,
+			backfill_from = excluded.backfill_from,
+			oldest_seen = excluded.oldest_seen,
+			newest_seen = excluded.newest_seen
+	`, s.userID, hb.Provider, hb.InboxID, hb.Instance, hb.Phase, hb.StartedAt,
+		hb.BeatAt, hb.Cycles, hb.Messages, hb.Changes, hb.Errors, sql.NullString{String: hb.LastError, Valid: hb.LastError != ""},
+		hb.BackfillFrom, hb.OldestSeen, hb.NewestSeen)
+	if err != nil {
+		return fmt.Errorf("failed to save heartbeat: %w", err)
+	}
+	return nil
+}
+
+// SyncStates returns the sync status, lag and runner heartbeat of every
+// provider
+func (s *Store) SyncStates(ctx context.Context) ([]SyncState, error) {
+	return s.querySyncStates(ctx, `WHERE s.user_id = ? ORDER BY s.provider`, s.userID)
+}
+
+// SyncState returns one provider's sync state, nil if it never synced
+func (s *Store) SyncState(ctx context.Context, provider string) (*SyncState, error) {
+	states, err := s.querySyncStates(ctx, `WHERE s.user_id = ? AND s.provider = ?`, s.userID, provider)
+	if err != nil || len(states) == 0 {
+		return nil, err
+	}
+	return &states[0], nil
+}
+
+func (s *Store) querySyncStates(ctx context.Context, where string, args ...any) ([]SyncState, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT s.provider, s.inbox_id, COALESCE(s.status, ''), COALESCE(s.cursor, ''), COALESCE(s.last_synced_at, 0),
+		       COALESCE(s.last_error, ''), COALESCE(s.error_code, ''), COALESCE(s.retry_count, 0), COALESCE(s.updated_at, 0),
+		       COALESCE(s.provider_newest_at, 0),
+		       COALESCE(s.local_newest_at, 0), COALESCE(s.lag_seconds, 0), COALESCE(s.lag_checked_at, 0),
+		       h.beat_at IS NOT NULL, COALESCE(h.instance, ''), COALESCE(h.phase, ''),
+		       COALESCE(h.started_at, 0), COALESCE(h.beat_at, 0), COALESCE(h.cycles, 0),
+		       COALESCE(h.messages, 0), COALESCE(h.changes, 0), COALESCE(h.errors, 0),
+		       COALESCE(h.last_error, ''), COALESCE(h.backfill_from, 0), COALESCE(h.oldest_seen, 0),
+		       COALESCE(h.newest_seen, 0)
+		FROM provider_sync_state s
+		LEFT JOIN runner_heartbeats h ON h.user_id = s.user_id AND h.provider = s.provider
+		`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync state: %w", err)
+	}
+	defer rows.Close()
+
+	var states []SyncState
+	for rows.Next() {
+		var (
+			st      SyncState
+			hb      Heartbeat
+			hasBeat bool
+		)
+		if err := rows.Scan(&st.Provider, &st.InboxID, &st.Status, &st.Cursor, &st.LastSyncedAt, &st.LastError,
+			&st.ErrorCode, &st.RetryCount, &st.UpdatedAt, &st.ProviderNewestAt, &st.LocalNewestAt, &st.LagSeconds, &st.CheckedAt,
+			&hasBeat, &hb.Instance, &hb.Phase, &hb.StartedAt, &hb.BeatAt, &hb.Cycles,
+			&hb.Messages, &hb.Changes, &hb.Errors, &hb.LastError, &hb.BackfillFrom, &hb.OldestSeen,
+			&hb.NewestSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan sync state: %w", err)
+		}
+		if hasBeat {
+			hb.Provider, hb.InboxID = st.Provider, st.InboxID
+			st.Heartbeat = &hb
+		}
+		states = append(states, st)
+	}
+	return states, rows.Err()
+}
+
+// LoadDebugMode returns the user's debug mode, nil if it is off or expired
+func (s *Store) LoadDebugMode(ctx context.Context) (*DebugMode, error) {
+	var mode DebugMode
+	err := s.read.QueryRowContext(ctx, `
+		SELECT sample_rate, expires_at, COALESCE(set_by, ''), COALESCE(set_at, 0)
+		FROM sync_debug
+		WHERE user_id = ? AND expires_at > ?
+	`, s.userID, time.Now().Unix()).Scan(&mode.SampleRate, &mode.ExpiresAt, &mode.SetBy, &mode.SetAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load debug mode: %w", err)
+	}
+	return &mode, nil
+}
+
+// SaveDebugMode turns debug mode on with the given settings, or off if mode
+// is nil
+func (s *Store) SaveDebugMode(ctx context.Context, mode *DebugMode) error {
+	var err error
+	if mode == nil {
+		_, err = s.exec(ctx, "save_debug_mode", `DELETE FROM sync_debug WHERE user_id = ?`, s.userID)
+	} else {
+		_, err = s.exec(ctx, "save_debug_mode", `
+			INSERT INTO sync_debug (user_id, sample_rate, expires_at, set_by, set_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET
+				sample_rate = excluded.sample_rate,
+				expires_at = excluded.expires_at,
+				set_by = excluded.set_by,
+				set_at = excluded.set_at
+		`, s.userID, mode.SampleRate, mode.ExpiresAt, mode.SetBy, mode.SetAt)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save debug mode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SaveTaskSink connects a task system or replaces its settings
+func (s *Store) SaveTaskSink(ctx context.Context, sink TaskSinkConfig) error {
+	settings, err := json.Marshal(sink.Settings)
+	if err != nil {
+		return fmt.Errorf("encode task sink settings: %w", err)
+	}
+	now := time.Now().Unix()
+	_, err = s.exec(ctx, "save_task_sink", `
+		INSERT INTO task_sinks (user_id, name, settings, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, name) DO UPDATE SET settings = excluded.settings, updated_at = excluded.updated_at
+	`, s.userID, sink.Name, string(settings), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save task sink: %w", err)
+	}
+	return nil
+}
+
+// DeleteTaskSink disconnects a task system, returning false if it wasn't
+// connected
+func (s *Store) DeleteTaskSink(ctx context.Context, name string) (bool, error) {
+	res, err := s.exec(ctx, "delete_task_sink", `
+		DELETE FROM task_sinks WHERE user_id = ? AND name = ?
+	`, s.userID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete task sink: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListTaskSinks returns the user's connected task systems by name
+func (s *Store) ListTaskSinks(ctx context.Context) ([]TaskSinkConfig, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT name, settings, created_at, updated_at FROM task_sinks WHERE user_id = ? ORDER BY name
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task sinks: %w", err)
+	}
+	defer rows.Close()
+
+	sinks := []TaskSinkConfig{}
+	for rows.Next() {
+		var sink TaskSinkConfig
+		var settings string
+		if err := rows.Scan(&sink.Name, &settings, &sink.CreatedAt, &sink.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan task sink: %w", err)
+		}
+		if err := json.Unmarshal([]byte(settings), &sink.Settings); err != nil || sink.Settings == nil {
+			sink.Settings = map[string]string{}
+		}
+		sinks = append(sinks, sink)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read task sinks: %w", err)
+	}
+	return sinks, nil
+}
+
+// taskDeliveryColumns is the column list scanTaskDeliveries reads
+const taskDeliveryColumns = `id, sink, provider, thread_id, source_id, title, COALESCE(notes, ''), COALESCE(due, ''),
+	status, attempts, COALESCE(external_id, ''), COALESCE(external_url, ''), COALESCE(last_error, ''),
+	created_at, updated_at`
+
+// CreateTaskDelivery records an action item to push. It returns false and
+// stores nothing if a delivery with the same ID exists.
+func (s *Store) CreateTaskDelivery(ctx context.Context, d *TaskDelivery) (bool, error) {
+	now := time.Now().Unix()
+	d.CreatedAt, d.UpdatedAt = now, now
+	res, err := s.exec(ctx, "create_task_delivery", `
+		INSERT INTO task_deliveries (user_id, id, sink, provider, thread_id, source_id, title, notes, due,
+			status, attempts, external_id, external_url, last_error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?)
+		ON CONFLICT DO NOTHING
+	`, s.userID, d.ID, d.Sink, d.Provider, d.ProviderThreadID, d.SourceID, d.Title, d.Notes, d.Due,
+		d.Status, d.Attempts, d.ExternalID, d.ExternalURL, d.LastError, d.CreatedAt, d.UpdatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to create task delivery: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// UpdateTaskDeliveryTx saves a delivery's status, attempts, external task and
+// last error
+func (s *Store) UpdateTaskDeliveryTx(ctx context.Context, tx *sql.Tx, d *TaskDelivery) error {
+	d.UpdatedAt = time.Now().Unix()
+	_, err := tx.ExecContext(ctx, `
+		UPDATE task_deliveries SET status = ?, attempts = ?, external_id = NULLIF(?, ''), external_url = NULLIF(?, ''),
+			last_error = NULLIF(?, ''), updated_at = ?
+		WHERE user_id = ? AND id = ?
+	`, d.Status, d.Attempts, d.ExternalID, d.ExternalURL, d.LastError, d.UpdatedAt, s.userID, d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update task delivery: %w", err)
+	}
+	return nil
+}
+
+// LoadTaskDelivery returns a delivery (nil if unknown)
+func (s *Store) LoadTaskDelivery(ctx context.Context, id string) (*TaskDelivery, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+taskDeliveryColumns+` FROM task_deliveries WHERE user_id = ? AND id = ?
+	`, s.userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task delivery: %w", err)
+	}
+	deliveries, err := scanTaskDeliveries(rows)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+// ListTaskDeliveries returns the newest deliveries, optionally with one status
+func (s *Store) ListTaskDeliveries(ctx context.Context, status string, limit int) ([]TaskDelivery, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+taskDeliveryColumns+`
+		FROM task_deliveries
+		WHERE user_id = ? AND (? = '' OR status = ?)
+		ORDER BY created_at DESC, id
+		LIMIT ?
+	`, s.userID, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task deliveries: %w", err)
+	}
+	return scanTaskDeliveries(rows)
+}
+
+// scanTaskDeliveries reads taskDeliveryColumns rows
+func scanTaskDeliveries(rows *sql.Rows) ([]TaskDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []TaskDelivery{}
+	for rows.Next() {
+		var d TaskDelivery
+		if err := rows.Scan(&d.ID, &d.Sink, &d.Provider, &d.ProviderThreadID, &d.SourceID, &d.Title, &d.Notes,
+			&d.Due, &d.Status, &d.Attempts, &d.ExternalID, &d.ExternalURL, &d.LastError,
+			&d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan task delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read task deliveries: %w", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/slowlog"
+)
+
+// openTimed opens dsn with the SQLite driver wrapped so statements slower
+// than the slowlog threshold are logged. user labels the log lines (a user
+// hash, or "shared").
+func openTimed(dsn, user string) *sql.DB {
+	return sql.OpenDB(&timedConnector{dsn: dsn, user: user})
+}
+
+// dbLabel is the slow-log label for a database owned by userID (empty for
+// the shared database)
+func dbLabel(userID string) string {
+	if userID == "" {
+		return "shared"
+	}
+	return slowlog.UserHash(userID)
+}
+
+// sqliteDriver is the driver registered as "sqlite". Its connections have
+// the SQL functions this package registers (see compress.go), which a new
+// Driver value's don't.
+var sqliteDriver = func() driver.Driver {
+	db, _ := sql.Open("sqlite", "")
+	defer db.Close()
+	return db.Driver()
+}()
+
+// timedConnector opens timed connections
+type timedConnector struct {
+	dsn  string
+	user string
+}
+
+func (c *timedConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := sqliteDriver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn: conn, user: c.user}, nil
+}
+
+func (c *timedConnector) Driver() driver.Driver {
+	return sqliteDriver
+}
+
+// sqliteConn is the set of driver interfaces the SQLite connection provides
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// timedConn times statements on one connection
+type timedConn struct {
+	conn driver.Conn
+	user string
+}
+
+func (c *timedConn) inner() sqliteConn {
+	return c.conn.(sqliteConn)
+}
+
+func (c *timedConn) observe(query string, start time.Time) {
+	slowlog.Observe(slowlog.SQL, query, c.user, time.Since(start))
+}
+
+func (c *timedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.inner().PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *timedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *timedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.inner().BeginTx(ctx, opts)
+	c.observe("BEGIN", start)
+	if err != nil {
+		return nil, err
+	}
+	return &timedTx{tx: tx, conn: c}, nil
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	defer c.observe(query, start)
+	return c.inner().ExecContext(ctx, query, args)
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.inner().QueryContext(ctx, query, args)
+	if err != nil {
+		c.observe(query, start)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, conn: c, query: query, start: start}, nil
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	return c.inner().Ping(ctx)
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	return c.inner().ResetSession(ctx)
+}
+
+func (c *timedConn) IsValid() bool {
+	return c.inner().IsValid()
+}
+
+// timedTx times commits, where SQLite syncs the WAL
+type timedTx struct {
+	tx   driver.Tx
+	conn *timedConn
+}
+
+func (t *timedTx) Commit() error {
+	start := time.Now()
+	defer t.conn.observe("COMMIT", start)
+	return t.tx.Commit()
+}
+
+func (t *timedTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// timedStmt times executions of a prepared statement
+type timedStmt struct {
+	stmt  driver.Stmt
+	conn  *timedConn
+	query string
+}
+
+func (s *timedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *timedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *timedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	defer s.conn.observe(s.query, start)
+	return s.stmt.Exec(args)
+}
+
+func (s *timedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.stmt.Query(args)
+	if err != nil {
+		s.conn.observe(s.query, start)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, conn: s.conn, query: s.query, start: start}, nil
+}
+
+func (s *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	defer s.conn.observe(s.query, start)
+	return s.stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+}
+
+func (s *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		s.conn.observe(s.query, start)
+		return nil, err
+	}
+	return &timedRows{Rows: rows, conn: s.conn, query: s.query, start: start}, nil
+}
+
+// timedRows measures a query until its rows are closed, since SQLite does
+// most of the work while they are read
+type timedRows struct {
+	driver.Rows
+	conn  *timedConn
+	query string
+	start time.Time
+}
+
+func (r *timedRows) Close() error {
+	err := r.Rows.Close()
+	r.conn.observe(r.query, r.start)
+	return err
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// MessageVectors returns up to limit vectors from model for messages dated at
+// or after since, newest first
+func (s *Store) MessageVectors(ctx context.Context, model string, since int64, limit int) ([]MessageVector, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT e.event_id, e.provider, COALESCE(e.subject, ''), COALESCE(e.msg_date, e.ts), v.vector
+		FROM message_embeddings v
+		JOIN email_received_events e
+		  ON e.user_id = v.user_id AND e.provider = v.provider AND e.provider_message_id = v.provider_message_id
+		WHERE v.user_id = ? AND v.model = ? AND e.deleted_at IS NULL AND COALESCE(e.msg_date, e.ts) >= ?
+		ORDER BY COALESCE(e.msg_date, e.ts) DESC
+		LIMIT ?
+	`, s.userID, model, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message vectors: %w", err)
+	}
+	defer rows.Close()
+
+	var vectors []MessageVector
+	for rows.Next() {
+		var (
+			v    MessageVector
+			blob []byte
+		)
+		if err := rows.Scan(&v.EventID, &v.Provider, &v.Subject, &v.MsgDate, &blob); err != nil {
+			return nil, fmt.Errorf("failed to scan message vector: %w", err)
+		}
+		v.Vector = decodeVector(blob)
+		vectors = append(vectors, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read message vectors: %w", err)
+	}
+	return vectors, nil
+}
+
+// ReplaceTopics swaps the user's topics and their members for a new
+// clustering in one transaction
+func (s *Store) ReplaceTopics(ctx context.Context, topics []Topic) error {
+	return s.writeTx(ctx, "replace_topics", func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM topic_members WHERE user_id = ?`, s.userID); err != nil {
+			return fmt.Errorf("failed to delete topic members: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM topics WHERE user_id = ?`, s.userID); err != nil {
+			return fmt.Errorf("failed to delete topics: %w", err)
+		}
+
+		for _, t := range topics {
+			keywords, err := json.Marshal(t.Keywords)
+			if err != nil {
+				return fmt.Errorf("encode keywords: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO topics (user_id, topic_id, name, keywords, model, size, latest_at, computed_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, s.userID, t.ID, t.Name, string(keywords), t.Model, t.Size, t.LatestAt, t.ComputedAt); err != nil {
+				return fmt.Errorf("failed to insert topic: %w", err)
+			}
+			for _, m := range t.Members {
+				if _, err := tx.ExecContext(ctx, `
+					INSERT OR IGNORE INTO topic_members (user_id, topic_id, event_id, provider, similarity)
+					VALUES (?, ?, ?, ?, ?)
+				`, s.userID, t.ID, m.EventID, m.Provider, m.Similarity); err != nil {
+					return fmt.Errorf("failed to insert topic member: %w", err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Topics returns the user's topics, largest first
+func (s *Store) Topics(ctx context.Context) ([]Topic, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT topic_id, name, keywords, model, size, latest_at, computed_at
+		FROM topics
+		WHERE user_id = ?
+		ORDER BY size DESC, latest_at DESC, topic_id
+	`, s.userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query topics: %w", err)
+	}
+	defer rows.Close()
+
+	topics := []Topic{}
+	for rows.Next() {
+		var (
+			t        Topic
+			keywords string
+		)
+		if err := rows.Scan(&t.ID, &t.Name, &keywords, &t.Model, &t.Size, &t.LatestAt, &t.ComputedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan topic: %w", err)
+		}
+		_ = json.Unmarshal([]byte(keywords), &t.Keywords)
+		if t.Keywords == nil {
+			t.Keywords = []string{}
+		}
+		topics = append(topics, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read topics: %w", err)
+	}
+	return topics, nil
+}
+
+// TopicMessages returns up to limit messages in a topic, newest first.
+// Messages deleted since the clustering are left out.
+func (s *Store) TopicMessages(ctx context.Context, topicID string, limit int) ([]StoredMessage, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+messageColumns+`
+		FROM email_received_events
+		WHERE user_id = ? AND deleted_at IS NULL AND event_id IN (
+			SELECT event_id FROM topic_members WHERE user_id = ? AND topic_id = ?
+		)
+		ORDER BY COALESCE(msg_date, ts) DESC
+		LIMIT ?
+	`, s.userID, s.userID, topicID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query topic messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := []StoredMessage{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read topic messages: %w", err)
+	}
+	return msgs, nil
+}
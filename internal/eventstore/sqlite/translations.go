@@ -0,0 +1,21 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+)
+
+// SaveTranslation stores a machine translation of a message's subject and
+// snippet, replacing an earlier one. The full-text index picks it up through
+// its triggers. Unknown messages are ignored.
+func (s *Store) SaveTranslation(ctx context.Context, provider, providerMessageID string, t Translation) error {
+	_, err := s.exec(ctx, "save_translation", `
+		UPDATE email_received_events
+		SET translation_lang = ?, translated_subject = ?, translated_snippet = ?
+		WHERE user_id = ? AND provider = ? AND provider_message_id = ?
+	`, t.Language, t.Subject, t.Snippet, s.userID, provider, providerMessageID)
+	if err != nil {
+		return fmt.Errorf("failed to save translation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/chaos"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// maxTxAttempts bounds how often WithTx runs a transaction that hit SQLITE_BUSY
+const maxTxAttempts = 3
+
+// WithTx runs fn in a database transaction, committing if it returns nil.
+// Transactions that fail because the database is busy (another process holds
+// the write lock past busy_timeout) are rolled back and run again, so fn must
+// only touch the database through the Tx it is given.
+func (s *Store) WithTx(ctx context.Context, fn func(eventstore.Tx) error) error {
+	start := time.Now()
+	defer func() {
+		txDuration.Record(ctx, time.Since(start).Seconds())
+	}()
+
+	for attempt := 1; ; attempt++ {
+		err := s.runTx(ctx, fn)
+		if !isBusy(err) || attempt == maxTxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		txRetries.Add(ctx, 1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		}
+	}
+}
+
+// runTx runs fn in one transaction, holding the store's write gate
+func (s *Store) runTx(ctx context.Context, fn func(eventstore.Tx) error) error {
+	if err := chaos.Inject(ctx, chaos.SQLiteBusy); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", observeBusy(ctx, "begin", fmt.Errorf("%w: %w", eventstore.ErrBusy, err)))
+	}
+
+	if err := s.gate.acquire(ctx); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", observeBusy(ctx, "begin", err))
+	}
+	defer s.gate.release()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", observeBusy(ctx, "begin", err))
+	}
+	defer tx.Rollback()
+
+	if err := fn(storeTx{s: s, tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", observeBusy(ctx, "commit", err))
+	}
+	return nil
+}
+
+// storeTx adapts the *Tx store methods to eventstore.Tx
+type storeTx struct {
+	s  *Store
+	tx *sql.Tx
+}
+
+func (t storeTx) AppendEmailReceived(ctx context.Context, ev EmailEvent, out OutboxEntry) (bool, error) {
+	inserted, err := t.s.AppendEmailReceivedTx(ctx, t.tx, ev, out)
+	return inserted, observeBusy(ctx, "append_event", err)
+}
+
+func (t storeTx) AppendOutbox(ctx context.Context, out OutboxEntry) error {
+	return observeBusy(ctx, "append_outbox", t.s.AppendOutboxTx(ctx, t.tx, out))
+}
+
+func (t storeTx) AppendEvent(ctx context.Context, eventType, data string) (*Event, error) {
+	event, err := t.s.StoreEventTx(ctx, t.tx, eventType, data)
+	return event, observeBusy(ctx, "store_event", err)
+}
+
+func (t storeTx) SaveEnrichmentOutputs(ctx context.Context, version, sourceEventID string, outputs []EnrichmentOutput) error {
+	return observeBusy(ctx, "save_enrichment_outputs", t.s.SaveEnrichmentOutputsTx(ctx, t.tx, version, sourceEventID, outputs))
+}
+
+func (t storeTx) MarkFollowUpNotified(ctx context.Context, provider, threadID, messageID string, at int64) error {
+	return observeBusy(ctx, "notify_followup", t.s.MarkFollowUpNotifiedTx(ctx, t.tx, provider, threadID, messageID, at))
+}
+
+func (t storeTx) SaveContactScore(ctx context.Context, score ContactScore) error {
+	return observeBusy(ctx, "save_contact_score", t.s.SaveContactScoreTx(ctx, t.tx, score))
+}
+
+func (t storeTx) SuggestUnsubscribe(ctx context.Context, s UnsubscribeSuggestion) (bool, error) {
+	created, err := t.s.SuggestUnsubscribeTx(ctx, t.tx, s)
+	return created, observeBusy(ctx, "suggest_unsubscribe", err)
+}
+
+func (t storeTx) AddAttachment(ctx context.Context, a Attachment) error {
+	return observeBusy(ctx, "add_attachment", t.s.AddAttachmentTx(ctx, t.tx, a))
+}
+
+func (t storeTx) EnrichContact(ctx context.Context, e ContactEnrichment) ([]string, error) {
+	changed, err := t.s.EnrichContactTx(ctx, t.tx, e)
+	return changed, observeBusy(ctx, "enrich_contact", err)
+}
+
+func (t storeTx) SaveCalendarSuggestion(ctx context.Context, cs CalendarSuggestion) error {
+	return observeBusy(ctx, "save_calendar_suggestion", t.s.SaveCalendarSuggestionTx(ctx, t.tx, cs))
+}
+
+func (t storeTx) MergeContacts(ctx context.Context, m *ContactMerge) error {
+	return observeBusy(ctx, "merge_contacts", t.s.MergeContactsTx(ctx, t.tx, m))
+}
+
+func (t storeTx) UndoContactMerge(ctx context.Context, id string) (*ContactMerge, error) {
+	m, err := t.s.UndoContactMergeTx(ctx, t.tx, id)
+	return m, observeBusy(ctx, "undo_contact_merge", err)
+}
+
+func (t storeTx) UpdateTaskDelivery(ctx context.Context, d *TaskDelivery) error {
+	return observeBusy(ctx, "update_task_delivery", t.s.UpdateTaskDeliveryTx(ctx, t.tx, d))
+}
+
+func (t storeTx) UpdateMessageLabels(ctx context.Context, provider, providerMessageID, labelsJSON, folder string) (bool, error) {
+	known, err := t.s.UpdateMessageLabelsTx(ctx, t.tx, provider, providerMessageID, labelsJSON, folder)
+	return known, observeBusy(ctx, "update_labels", err)
+}
+
+func (t storeTx) MarkMessageDeleted(ctx context.Context, provider, providerMessageID string, deletedAt int64) (bool, error) {
+	known, err := t.s.MarkMessageDeletedTx(ctx, t.tx, provider, providerMessageID, deletedAt)
+	return known, observeBusy(ctx, "mark_deleted", err)
+}
+
+func (t storeTx) MoveMessage(ctx context.Context, provider, oldMessageID, newMessageID, folder string) (bool, error) {
+	known, err := t.s.MoveMessageTx(ctx, t.tx, provider, oldMessageID, newMessageID, folder)
+	return known, observeBusy(ctx, "move_message", err)
+}
+
+func (t storeTx) UpdateMessageState(ctx context.Context, provider, providerMessageID string, isRead, isFlagged *bool) (MessageState, bool, error) {
+	prev, known, err := t.s.UpdateMessageStateTx(ctx, t.tx, provider, providerMessageID, isRead, isFlagged)
+	return prev, known, observeBusy(ctx, "update_state", err)
+}
@@ -0,0 +1,98 @@
+package sqlite
+
+import "github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+
+// The row and view types are shared by every backend and live in the
+// eventstore package; the aliases keep this package's API unchanged.
+type (
+	OutboxMessage = eventstore.OutboxMessage
+	EmailEvent    = eventstore.EmailEvent
+	OutboxEntry   = eventstore.OutboxEntry
+	OutboxBacklog = eventstore.OutboxBacklog
+	OutboxError   = eventstore.OutboxError
+	MessageState  = eventstore.MessageState
+	MessageRef    = eventstore.MessageRef
+	StoredMessage = eventstore.StoredMessage
+	ThreadSummary = eventstore.ThreadSummary
+	Analytics     = eventstore.Analytics
+	DayVolume     = eventstore.DayVolume
+	SenderCount   = eventstore.SenderCount
+	HourCount     = eventstore.HourCount
+	Backlog       = eventstore.Backlog
+	BacklogItem   = eventstore.BacklogItem
+	Contact       = eventstore.Contact
+	ContactQuery  = eventstore.ContactQuery
+	ContactStats  = eventstore.ContactStats
+	ContactScore  = eventstore.ContactScore
+	ContactDetail = eventstore.ContactDetail
+	MailFolder    = eventstore.MailFolder
+	Subscription  = eventstore.Subscription
+	AsOfQuery     = eventstore.AsOfQuery
+	SyncState     = eventstore.SyncState
+	SyncLag       = eventstore.SyncLag
+	Heartbeat     = eventstore.Heartbeat
+	DebugMode     = eventstore.DebugMode
+	Workflow      = eventstore.Workflow
+
+	ArchiveSegment  = eventstore.ArchiveSegment
+	ArchivedMessage = eventstore.ArchivedMessage
+	ArchivedQuery   = eventstore.ArchivedQuery
+	FollowUp        = eventstore.FollowUp
+	FollowUpQuery   = eventstore.FollowUpQuery
+	TaskSinkConfig  = eventstore.TaskSinkConfig
+	TaskDelivery    = eventstore.TaskDelivery
+
+	MessageEmbedding = eventstore.MessageEmbedding
+	SemanticQuery    = eventstore.SemanticQuery
+	ScoredMessage    = eventstore.ScoredMessage
+	EmbeddingSource  = eventstore.EmbeddingSource
+
+	EmbeddingBackfill = eventstore.EmbeddingBackfill
+
+	EnrichmentSource     = eventstore.EnrichmentSource
+	EnrichmentOutput     = eventstore.EnrichmentOutput
+	EnrichmentRun        = eventstore.EnrichmentRun
+	EnrichmentComparison = eventstore.EnrichmentComparison
+	EnrichmentDiff       = eventstore.EnrichmentDiff
+
+	QuarantinedMessage = eventstore.QuarantinedMessage
+	EventAck           = eventstore.EventAck
+	ConsumerProgress   = eventstore.ConsumerProgress
+	UnackedEvent       = eventstore.UnackedEvent
+	PublishedMessage   = eventstore.PublishedMessage
+
+	CalendarSuggestion = eventstore.CalendarSuggestion
+	CalendarSlot       = eventstore.CalendarSlot
+	MessageVector      = eventstore.MessageVector
+	Topic              = eventstore.Topic
+	TopicMember        = eventstore.TopicMember
+	Translation        = eventstore.Translation
+	ContactEnrichment  = eventstore.ContactEnrichment
+	Attachment         = eventstore.Attachment
+
+	UnsubscribeSuggestion = eventstore.UnsubscribeSuggestion
+	ContactMerge          = eventstore.ContactMerge
+	SenderRule            = eventstore.SenderRule
+	Event                 = eventstore.Event
+	EventFilter           = eventstore.EventFilter
+)
+
+// Contact sort orders
+const (
+	ContactSortStrength = eventstore.ContactSortStrength
+	ContactSortScore    = eventstore.ContactSortScore
+	ContactSortRecent   = eventstore.ContactSortRecent
+	ContactSortCount    = eventstore.ContactSortCount
+	ContactSortName     = eventstore.ContactSortName
+)
+
+// ErrInvalidSort is returned for unknown ContactQuery.Sort values
+var ErrInvalidSort = eventstore.ErrInvalidSort
+
+// ErrInvalidMerge is returned for contact merges that can't be made or undone
+var ErrInvalidMerge = eventstore.ErrInvalidMerge
+
+var (
+	_ eventstore.Store  = (*Store)(nil)
+	_ eventstore.Opener = (*Opener)(nil)
+)
@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// workflowColumns is the column list scanWorkflows reads
+const workflowColumns = `id, name, status, step, state, COALESCE(wait_event, ''), COALESCE(wait_field, ''),
+	COALESCE(wait_value, ''), COALESCE(wake_at, 0), COALESCE(trigger_key, ''), COALESCE(last_error, ''),
+	created_at, updated_at`
+
+// CreateWorkflow stores a new instance. It returns false and stores nothing
+// if an instance with the same non-empty TriggerKey exists.
+func (s *Store) CreateWorkflow(ctx context.Context, wf *Workflow) (bool, error) {
+	now := time.Now().Unix()
+	wf.CreatedAt, wf.UpdatedAt = now, now
+	res, err := s.exec(ctx, "create_workflow", `
+		INSERT INTO workflows (id, user_id, name, status, step, state, wait_event, wait_field, wait_value,
+			wake_at, trigger_key, last_error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, ''), ?, ?)
+		ON CONFLICT DO NOTHING
+	`, wf.ID, s.userID, wf.Name, wf.Status, wf.Step, string(wf.State), wf.WaitEvent, wf.WaitField, wf.WaitValue,
+		wf.WakeAt, wf.TriggerKey, wf.LastError, wf.CreatedAt, wf.UpdatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to create workflow: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// UpdateWorkflow saves an instance's status, step, state and wait if it is
+// still at fromStatus and fromStep, returning false if another update got
+// there first
+func (s *Store) UpdateWorkflow(ctx context.Context, wf *Workflow, fromStatus string, fromStep int) (bool, error) {
+	wf.UpdatedAt = time.Now().Unix()
+	res, err := s.exec(ctx, "update_workflow", `
+		UPDATE workflows SET status = ?, step = ?, state = ?, wait_event = NULLIF(?, ''), wait_field = NULLIF(?, ''),
+			wait_value = NULLIF(?, ''), wake_at = NULLIF(?, 0), last_error = NULLIF(?, ''), updated_at = ?
+		WHERE id = ? AND user_id = ? AND status = ? AND step = ?
+	`, wf.Status, wf.Step, string(wf.State), wf.WaitEvent, wf.WaitField, wf.WaitValue, wf.WakeAt, wf.LastError,
+		wf.UpdatedAt, wf.ID, s.userID, fromStatus, fromStep)
+	if err != nil {
+		return false, fmt.Errorf("failed to update workflow: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// WaitingWorkflows returns the instances waiting for an event type
+func (s *Store) WaitingWorkflows(ctx context.Context, eventType string) ([]Workflow, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+workflowColumns+`
+		FROM workflows
+		WHERE user_id = ? AND status = 'waiting' AND wait_event = ?
+	`, s.userID, eventType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query waiting workflows: %w", err)
+	}
+	return scanWorkflows(rows)
+}
+
+// LoadWorkflow returns a workflow instance (nil if unknown)
+func (s *Store) LoadWorkflow(ctx context.Context, id string) (*Workflow, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+workflowColumns+` FROM workflows WHERE user_id = ? AND id = ?
+	`, s.userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workflow: %w", err)
+	}
+	workflows, err := scanWorkflows(rows)
+	if err != nil || len(workflows) == 0 {
+		return nil, err
+	}
+	return &workflows[0], nil
+}
+
+// ListWorkflows returns the newest instances, optionally with one status
+func (s *Store) ListWorkflows(ctx context.Context, status string, limit int) ([]Workflow, error) {
+	rows, err := s.read.QueryContext(ctx, `
+		SELECT `+workflowColumns+`
+		FROM workflows
+		WHERE user_id = ? AND (? = '' OR status = ?)
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, s.userID, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workflows: %w", err)
+	}
+	return scanWorkflows(rows)
+}
+
+// scanWorkflows reads workflowColumns rows
+func scanWorkflows(rows *sql.Rows) ([]Workflow, error) {
+	defer rows.Close()
+
+	workflows := []Workflow{}
+	for rows.Next() {
+		var wf Workflow
+		var state string
+		if err := rows.Scan(&wf.ID, &wf.Name, &wf.Status, &wf.Step, &state, &wf.WaitEvent, &wf.WaitField,
+			&wf.WaitValue, &wf.WakeAt, &wf.TriggerKey, &wf.LastError, &wf.CreatedAt, &wf.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow: %w", err)
+		}
+		wf.State = []byte(state)
+		workflows = append(workflows, wf)
+	}
+	if err := rows.Err(); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to read workflows: %w", err)
+	}
+	return workflows, nil
+}
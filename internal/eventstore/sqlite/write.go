@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// Busy retries for writes outside WithTx
+const (
+	maxWriteAttempts = 5
+	writeBackoff     = 25 * time.Millisecond // doubled per attempt
+	maxWriteBackoff  = 500 * time.Millisecond
+
+	// gateWait bounds the wait for another writer in this process, like
+	// busy_timeout does for writers in other processes
+	gateWait = 5 * time.Second
+)
+
+// writeGate lets one writer at a time into a database file. Every Store on
+// the same file shares a gate, so the API handlers and the sync runner queue
+// here instead of racing for the SQLite write lock on separate connections.
+type writeGate chan struct{}
+
+// writeGates holds the gate of each database path opened by this process
+var writeGates sync.Map
+
+// gateFor returns the write gate of a database file
+func gateFor(dbPath string) writeGate {
+	if abs, err := filepath.Abs(dbPath); err == nil {
+		dbPath = abs
+	}
+	gate, _ := writeGates.LoadOrStore(dbPath, make(writeGate, 1))
+	return gate.(writeGate)
+}
+
+// acquire waits for the gate. Waiting longer than gateWait reports the
+// database busy so the caller's retry applies.
+func (g writeGate) acquire(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	timer := time.NewTimer(gateWait)
+	defer timer.Stop()
+	select {
+	case g <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return fmt.Errorf("%w: waited %s for another writer", eventstore.ErrBusy, gateWait)
+	}
+}
+
+func (g writeGate) release() {
+	if g != nil {
+		<-g
+	}
+}
+
+// retryBusy runs write until it succeeds, fails with something other than
+// SQLITE_BUSY or runs out of attempts, backing off between attempts. Each
+// attempt holds the store's write gate. A final busy error is counted against
+// op and marked with eventstore.ErrBusy.
+func (s *Store) retryBusy(ctx context.Context, op string, write func() error) error {
+	backoff := writeBackoff
+	for attempt := 1; ; attempt++ {
+		err := s.gate.acquire(ctx)
+		if err == nil {
+			err = write()
+			s.gate.release()
+		}
+		if !isBusy(err) || attempt == maxWriteAttempts || ctx.Err() != nil {
+			return observeBusy(ctx, op, err)
+		}
+
+		txRetries.Add(ctx, 1)
+		select {
+		case <-ctx.Done():
+			return observeBusy(ctx, op, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxWriteBackoff)
+	}
+}
+
+// exec runs a write statement through the write gate, retrying while the
+// database is busy
+func (s *Store) exec(ctx context.Context, op, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := s.retryBusy(ctx, op, func() error {
+		var err error
+		res, err = s.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
+
+// writeTx runs fn in a transaction through the write gate, committing if it
+// returns nil. Busy transactions are rolled back and run again, so fn must
+// only touch the database through tx.
+func (s *Store) writeTx(ctx context.Context, op string, fn func(*sql.Tx) error) error {
+	return s.retryBusy(ctx, op, func() error {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	})
+}
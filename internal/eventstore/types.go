@@ -0,0 +1,982 @@
+package eventstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+)
+
+// OutboxMessage represents a message in the outbox
+type OutboxMessage struct {
+	ID          int64
+	Subject     string
+	Payload     []byte
+	MsgID       string
+	TraceParent string // W3C traceparent to publish with, may be empty
+	TS          int64  // when it was queued (unix seconds)
+}
+
+// PublishedMessage is a published outbox message and where JetStream stored
+// it, sampled to verify the stream still has it
+type PublishedMessage struct {
+	ID          int64
+	Subject     string
+	MsgID       string
+	Stream      string
+	Sequence    uint64
+	PublishedAt int64
+}
+
+// EmailEvent is a row in email_received_events
+type EmailEvent struct {
+	EventID           string
+	TS                int64 // ingested at
+	MsgDate           int64 // provider message date
+	Provider          string
+	InboxID           string
+	UserID            string
+	ProviderMessageID string
+	ProviderThreadID  string
+	Subject           string
+	Sender            string
+	ToAddrs           string // JSON array
+	CcAddrs           string // JSON array
+	BccAddrs          string // JSON array
+	Snippet           string
+	HeadersJSON       string // JSON map
+	LabelsJSON        string // JSON array
+	Folder            string // canonical folder (inbox|sent|archive|spam|trash|custom)
+	IsRead            bool
+	IsFlagged         bool
+	Kind              string // message|auto_reply|bounce
+	IsList            bool
+	ListID            string
+	ListName          string
+	ListUnsubscribe   string
+	Language          string // ISO 639-1, "" if unknown
+}
+
+// OutboxEntry is an event waiting to be published to NATS
+type OutboxEntry struct {
+	Subject   string // NATS subject
+	EventType string
+	Payload   []byte
+	MsgID     string // deterministic idempotency key
+
+	// TraceParent is the W3C traceparent of the operation that produced the
+	// event; the dispatcher publishes it as a message header
+	TraceParent string
+}
+
+// MessageState is the stored read/flag state of a message
+type MessageState struct {
+	IsRead    sql.NullBool
+	IsFlagged sql.NullBool
+}
+
+// MessageRef is the subset of a stored message needed to reply to it
+type MessageRef struct {
+	ThreadID    string
+	Subject     string
+	HeadersJSON string // JSON map
+}
+
+// StoredMessage is a message as stored locally
+type StoredMessage struct {
+	EventID           string   `json:"event_id"`
+	Provider          string   `json:"provider"`
+	ProviderMessageID string   `json:"provider_message_id"`
+	ProviderThreadID  string   `json:"provider_thread_id"`
+	Subject           string   `json:"subject"`
+	Sender            string   `json:"sender"`
+	To                []string `json:"to_addrs"`
+	Cc                []string `json:"cc_addrs"`
+	Bcc               []string `json:"bcc_addrs"`
+	Snippet           string   `json:"snippet"`
+	Labels            []string `json:"labels"`
+	Folder            string   `json:"folder"`
+	IsRead            bool     `json:"is_read"`
+	IsFlagged         bool     `json:"is_flagged"`
+	Kind              string   `json:"kind"`
+	IsList            bool     `json:"is_list"`
+	ListID            string   `json:"list_id,omitempty"`
+	MsgDate           int64    `json:"msg_date"`
+	TS                int64    `json:"ts"`
+	DeletedAt         int64    `json:"deleted_at,omitempty"`
+	Language          string   `json:"language,omitempty"`
+
+	// Translation is a machine translation of the subject and snippet, when
+	// the message isn't in the user's language
+	Translation *Translation `json:"translation,omitempty"`
+}
+
+// Translation is a message's subject and snippet in another language
+type Translation struct {
+	Language string `json:"language"`
+	Subject  string `json:"subject"`
+	Snippet  string `json:"snippet"`
+}
+
+// ThreadSummary aggregates a thread's messages
+type ThreadSummary struct {
+	Subject      string   `json:"subject"`
+	MessageCount int      `json:"message_count"`
+	UnreadCount  int      `json:"unread_count"`
+	Participants []string `json:"participants"`
+	FirstAt      int64    `json:"first_at"`
+	LastAt       int64    `json:"last_at"`
+	Folders      []string `json:"folders"`
+	Labels       []string `json:"labels"`
+	Tags         []string `json:"tags"` // flagged, unread, list, auto_reply, bounce, awaiting_reply
+}
+
+// SummarizeThread builds a summary of messages sorted by date
+func SummarizeThread(msgs []StoredMessage) ThreadSummary {
+	var sum ThreadSummary
+	if len(msgs) == 0 {
+		return sum
+	}
+
+	seen := make(map[string]bool)
+	add := func(list *[]string, prefix, v string) {
+		if v == "" || seen[prefix+v] {
+			return
+		}
+		seen[prefix+v] = true
+		*list = append(*list, v)
+	}
+
+	sum.Subject = msgs[0].Subject
+	sum.MessageCount = len(msgs)
+	sum.FirstAt = msgs[0].MsgDate
+	sum.LastAt = msgs[len(msgs)-1].MsgDate
+
+	for _, m := range msgs {
+		if !m.IsRead {
+			sum.UnreadCount++
+			add(&sum.Tags, "t:", "unread")
+		}
+		if m.IsFlagged {
+			add(&sum.Tags, "t:", "flagged")
+		}
+		if m.IsList {
+			add(&sum.Tags, "t:", "list")
+		}
+		if m.Kind != "" && m.Kind != "message" {
+			add(&sum.Tags, "t:", m.Kind)
+		}
+
+		add(&sum.Participants, "p:", m.Sender)
+		for _, addr := range m.To {
+			add(&sum.Participants, "p:", addr)
+		}
+		for _, addr := range m.Cc {
+			add(&sum.Participants, "p:", addr)
+		}
+		add(&sum.Folders, "f:", m.Folder)
+		for _, l := range m.Labels {
+			add(&sum.Labels, "l:", l)
+		}
+	}
+
+	if last := msgs[len(msgs)-1]; last.Folder != "sent" && (last.Kind == "" || last.Kind == "message") && !last.IsList {
+		add(&sum.Tags, "t:", "awaiting_reply")
+	}
+
+	return sum
+}
+
+// Analytics is a server-side summary of mail traffic
+type Analytics struct {
+	Since           int64         `json:"since"`
+	VolumePerDay    []DayVolume   `json:"volume_per_day"`
+	TopSenders      []SenderCount `json:"top_senders"`
+	BusiestHours    []HourCount   `json:"busiest_hours"`
+	ResponseBacklog Backlog       `json:"response_backlog"`
+}
+
+// DayVolume is the number of messages received and sent on a day
+type DayVolume struct {
+	Date     string `json:"date"` // YYYY-MM-DD in the requested time zone
+	Received int64  `json:"received"`
+	Sent     int64  `json:"sent"`
+}
+
+// SenderCount is the number of messages from a sender
+type SenderCount struct {
+	Sender string `json:"sender"`
+	Count  int64  `json:"count"`
+	Unread int64  `json:"unread"`
+}
+
+// HourCount is the number of messages received in an hour of the day
+type HourCount struct {
+	Hour  int   `json:"hour"` // 0-23 in the requested time zone
+	Count int64 `json:"count"`
+}
+
+// Backlog is inbox mail from people (not lists, auto-replies or bounces) with
+// no later reply from the user in the same thread
+type Backlog struct {
+	Count    int64         `json:"count"`
+	Oldest   []BacklogItem `json:"oldest"`
+	OldestAt int64         `json:"oldest_at,omitempty"`
+}
+
+// BacklogItem is a message waiting for a reply
+type BacklogItem struct {
+	Provider          string `json:"provider"`
+	ProviderMessageID string `json:"provider_message_id"`
+	ProviderThreadID  string `json:"provider_thread_id"`
+	Subject           string `json:"subject"`
+	Sender            string `json:"sender"`
+	MsgDate           int64  `json:"msg_date"`
+}
+
+// Contact is an address the user has exchanged mail with
+type Contact struct {
+	Email     string  `json:"email"`
+	Name      string  `json:"name,omitempty"`
+	FirstSeen int64   `json:"first_seen"`
+	LastSeen  int64   `json:"last_seen"`
+	FromCount int64   `json:"from_count"`
+	ToCount   int64   `json:"to_count"`
+	CcCount   int64   `json:"cc_count"`
+	SentCount int64   `json:"sent_count"`
+	Strength  float64 `json:"strength"`
+
+	// Relationship score, 0 to 1, and its components as of ScoredAt (see
+	// internal/relationship); zero until the first scoring run
+	Score             float64 `json:"score"`
+	ReplyRate         float64 `json:"reply_rate"`
+	InitiationBalance float64 `json:"initiation_balance"`
+	ScoredAt          int64   `json:"scored_at,omitempty"`
+
+	// Details from the contact's email signatures, the most recent value of
+	// each (see ContactDetail for provenance)
+	Title      string   `json:"title,omitempty"`
+	Company    string   `json:"company,omitempty"`
+	Phones     []string `json:"phones,omitempty"`
+	Address    string   `json:"address,omitempty"`
+	Website    string   `json:"website,omitempty"`
+	EnrichedAt int64    `json:"enriched_at,omitempty"`
+
+	// Addresses merged into this contact (see ContactMerge); their mail
+	// counts towards it
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// Contact detail fields
+const (
+	DetailTitle   = "title"
+	DetailCompany = "company"
+	DetailPhone   = "phone"
+	DetailAddress = "address"
+	DetailWebsite = "website"
+)
+
+// ContactEnrichment is what a message's signature says about its sender
+type ContactEnrichment struct {
+	Email   string // lowercased address
+	Title   string
+	Company string
+	Phones  []string
+	Address string
+	Website string
+
+	// The message the signature came from
+	EventID           string
+	Provider          string
+	ProviderMessageID string
+	MsgDate           int64
+}
+
+// ContactDetail is one value learned about a contact and the most recent
+// message it was seen in
+type ContactDetail struct {
+	Email             string `json:"email"` // the address the signature came from
+	Field             string `json:"field"`
+	Value             string `json:"value"`
+	EventID           string `json:"event_id"`
+	Provider          string `json:"provider"`
+	ProviderMessageID string `json:"provider_message_id"`
+	MsgDate           int64  `json:"msg_date"`
+	FirstSeen         int64  `json:"first_seen"`
+	LastSeen          int64  `json:"last_seen"`
+	SeenCount         int64  `json:"seen_count"`
+}
+
+// ContactMerge records addresses merged into a primary contact. Undoing it
+// splits them out again.
+type ContactMerge struct {
+	ID       string   `json:"id"`
+	Primary  string   `json:"primary"`
+	Merged   []string `json:"merged"`
+	MergedAt int64    `json:"merged_at"`
+	UndoneAt int64    `json:"undone_at,omitempty"`
+}
+
+// ErrInvalidMerge is returned for merges of the user's own or already merged
+// addresses, and for undoing a merge twice
+var ErrInvalidMerge = errors.New("invalid merge")
+
+// ContactStats are a contact's exchanges with the user since a point in
+// time, the input to relationship scoring
+type ContactStats struct {
+	Email       string
+	Received    int64   // person-to-person messages from them
+	Replied     int64   // of those, answered by the user later in the thread
+	Sent        int64   // messages the user sent them (To or Cc)
+	TheyStarted int64   // threads they started with the user
+	UserStarted int64   // threads the user started with them
+	LastSeen    int64   // last message either way, all time
+	Score       float64 // stored score
+	ScoredAt    int64
+}
+
+// ContactScore is a contact's relationship score and its components
+type ContactScore struct {
+	Email             string  `json:"email"`
+	Score             float64 `json:"score"`
+	ReplyRate         float64 `json:"reply_rate"`         // share of their messages the user answered
+	InitiationBalance float64 `json:"initiation_balance"` // 1 when both start conversations equally
+	ScoredAt          int64   `json:"scored_at"`
+}
+
+// ContactQuery filters and orders ListContacts
+type ContactQuery struct {
+	Sort   string // strength (default), score, recent, count or name
+	Search string // substring of name or address
+	Limit  int
+}
+
+// Contact sort orders
+const (
+	ContactSortStrength = "strength"
+	ContactSortScore    = "score"
+	ContactSortRecent   = "recent"
+	ContactSortCount    = "count"
+	ContactSortName     = "name"
+)
+
+// ErrInvalidSort is returned for unknown ContactQuery.Sort values
+var ErrInvalidSort = errors.New("invalid sort")
+
+// MailFolder represents a row in mail_folders
+type MailFolder struct {
+	ID          string `json:"id"`
+	ParentID    string `json:"parent_id,omitempty"`
+	DisplayName string `json:"display_name"`
+	Folder      string `json:"folder"`
+	Selected    bool   `json:"selected"`
+	Synced      bool   `json:"synced"` // has a delta link
+	UpdatedAt   int64  `json:"updated_at"`
+}
+
+// Subscription is an aggregated view of a mailing list or newsletter the user receives
+type Subscription struct {
+	Key            string `json:"key"` // List-Id, or the sender for lists without one
+	ListID         string `json:"list_id,omitempty"`
+	Name           string `json:"name,omitempty"`
+	Sender         string `json:"sender"`
+	Unsubscribe    string `json:"unsubscribe,omitempty"`
+	OneClick       bool   `json:"one_click"` // List-Unsubscribe-Post: List-Unsubscribe=One-Click
+	MessageCount   int64  `json:"message_count"`
+	UnreadCount    int64  `json:"unread_count"`
+	FlaggedCount   int64  `json:"flagged_count"`
+	RepliedCount   int64  `json:"replied_count"` // messages in threads the user replied to
+	FirstMessageAt int64  `json:"first_message_at"`
+	LastMessageAt  int64  `json:"last_message_at"`
+}
+
+// Unsubscribe suggestion statuses
+const (
+	UnsubscribeSuggested    = "suggested"
+	UnsubscribeDismissed    = "dismissed"
+	UnsubscribeUnsubscribed = "unsubscribed"
+)
+
+// UnsubscribeSuggestion is a list the user ignores, as it was when suggested
+type UnsubscribeSuggestion struct {
+	Key          string  `json:"key"`
+	ListID       string  `json:"list_id,omitempty"`
+	Name         string  `json:"name,omitempty"`
+	Sender       string  `json:"sender"`
+	MessageCount int64   `json:"message_count"` // in the engagement window
+	ReadRate     float64 `json:"read_rate"`
+	Status       string  `json:"status"`
+	Method       string  `json:"method,omitempty"` // how the user unsubscribed
+	SuggestedAt  int64   `json:"suggested_at"`
+	UpdatedAt    int64   `json:"updated_at"`
+}
+
+// AsOfQuery selects messages for MessagesAsOf
+type AsOfQuery struct {
+	At       int64  // unix seconds
+	Provider string // optional
+	ThreadID string // optional; one thread in date order instead of the mailbox
+	Folder   string // optional canonical folder
+	Limit    int    // 0 for no limit
+
+	// Archived are messages read from archive segments, replayed along with
+	// the stored ones; a stored copy of the same message wins
+	Archived []StoredMessage
+}
+
+// ErrNotFound is returned when a referenced row doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrBusy marks errors caused by a busy or locked database; the operation can
+// be retried
+var ErrBusy = errors.New("store busy")
+
+// SyncState is a provider's sync status and freshness for a user
+type SyncState struct {
+	Provider     string `json:"provider"`
+	InboxID      string `json:"inbox_id"`
+	Status       string `json:"status"`
+	Cursor       string `json:"cursor,omitempty"` // Gmail history id or Outlook delta link
+	LastSyncedAt int64  `json:"last_synced_at,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+	ErrorCode    string `json:"error_code,omitempty"` // what to do about LastError, e.g. REAUTH_REQUIRED
+	RetryCount   int64  `json:"retry_count"`          // failed syncs since the last successful one
+	UpdatedAt    int64  `json:"updated_at,omitempty"`
+	SyncLag
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"` // nil if no runner ever beat
+}
+
+// Heartbeat is a sync runner's liveness record. Runners rewrite it on every
+// loop, so a beat that stops advancing means the runner died or is stuck.
+type Heartbeat struct {
+	Provider  string `json:"-"`
+	InboxID   string `json:"-"`
+	Instance  string `json:"instance"` // host:pid of the API process running it
+	Phase     string `json:"phase"`    // starting, backfill, incremental, idle, stopped
+	StartedAt int64  `json:"started_at"`
+	BeatAt    int64  `json:"beat_at"`
+	Cycles    int64  `json:"cycles"`   // completed sync cycles
+	Messages  int64  `json:"messages"` // messages processed since start
+	Changes   int64  `json:"changes"`  // message changes processed since start
+	Errors    int64  `json:"errors"`   // failed cycles since start
+	LastError string `json:"last_error,omitempty"`
+
+	// Initial backfill progress, recorded while the phase is backfill
+	BackfillFrom int64 `json:"backfill_from,omitempty"` // start of the backfill window, 0 for all mail
+	OldestSeen   int64 `json:"oldest_seen,omitempty"`   // oldest message date processed
+	NewestSeen   int64 `json:"newest_seen,omitempty"`   // newest message date processed
+}
+
+// DebugMode enables verbose, sampled logging of a user's syncs: provider
+// calls, checkpoint writes and ingested events. It expires on its own so a
+// forgotten toggle doesn't keep logging.
+type DebugMode struct {
+	SampleRate float64 `json:"sample_rate"` // share of provider calls and events logged, 0 to 1
+	ExpiresAt  int64   `json:"expires_at"`
+	SetBy      string  `json:"set_by"` // admin who enabled it
+	SetAt      int64   `json:"set_at"`
+}
+
+// SyncLag compares the newest inbox message at the provider with the newest
+// one in the store. A sync can report HOOKED and still fall behind; lag is
+// what catches that.
+type SyncLag struct {
+	ProviderNewestAt int64 `json:"provider_newest_at,omitempty"` // unix seconds, 0 if unknown
+	LocalNewestAt    int64 `json:"local_newest_at,omitempty"`    // unix seconds, 0 if nothing stored
+	LagSeconds       int64 `json:"lag_seconds"`
+	CheckedAt        int64 `json:"lag_checked_at,omitempty"` // 0 if never measured
+}
+
+// Workflow is a persisted instance of a multi-step workflow (see
+// internal/workflow). Step is the index of the next step to run; completed
+// steps are the ones before it.
+type Workflow struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Status     string          `json:"status"` // running, waiting, completed, failed, cancelling, cancelled
+	Step       int             `json:"step"`
+	State      json.RawMessage `json:"state"` // inputs and step outputs
+	WaitEvent  string          `json:"wait_event,omitempty"`
+	WaitField  string          `json:"wait_field,omitempty"` // payload field the event must match
+	WaitValue  string          `json:"wait_value,omitempty"`
+	WakeAt     int64           `json:"wake_at,omitempty"` // timer or wait deadline, unix seconds
+	TriggerKey string          `json:"-"`                 // dedupes event-triggered starts
+	LastError  string          `json:"last_error,omitempty"`
+	CreatedAt  int64           `json:"created_at"`
+	UpdatedAt  int64           `json:"updated_at"`
+}
+
+// ArchiveSegment describes a batch of one provider's messages moved to
+// object storage. OldestAt and NewestAt bound their message dates. Live
+// counts the messages the store still serves from it: expired, purged and
+// re-archived ones are left out until the archiver rewrites the segment.
+// Deleted counts the live ones deleted at the provider since.
+type ArchiveSegment struct {
+	Key        string `json:"key"`
+	Provider   string `json:"provider"`
+	Messages   int    `json:"messages"`
+	Live       int    `json:"live"`
+	Deleted    int    `json:"deleted"`
+	OldestAt   int64  `json:"oldest_at"`
+	NewestAt   int64  `json:"newest_at"`
+	ArchivedAt int64  `json:"archived_at"`
+}
+
+// ArchivedMessage is the store's index entry for a message moved to a
+// segment. Reads serve a segment's copy of the message only while its entry
+// names that segment; DeletedAt is set when the provider deleted it after it
+// was archived.
+type ArchivedMessage struct {
+	Provider          string
+	ProviderMessageID string
+	ProviderThreadID  string
+	SegmentKey        string
+	MsgDate           int64
+	DeletedAt         int64
+}
+
+// ArchivedQuery selects index entries of archived messages: a thread's
+// (Provider optional), a segment's, or those of some message ids
+type ArchivedQuery struct {
+	Provider   string
+	ThreadID   string
+	SegmentKey string
+	MessageIDs []string
+}
+
+// Follow-up statuses
+const (
+	FollowUpWaiting = "waiting" // sent recently; no reply expected yet
+	FollowUpDue     = "due"     // no reply within the follow-up delay
+	FollowUpSnoozed = "snoozed" // hidden until SnoozedUntil
+)
+
+// FollowUp is a thread where the user sent the last message and nobody has
+// replied. DueAt is when the follow-up delay ends, or the snooze if later.
+type FollowUp struct {
+	Provider          string   `json:"provider"`
+	ProviderThreadID  string   `json:"provider_thread_id"`
+	ProviderMessageID string   `json:"provider_message_id"` // the user's last message
+	Subject           string   `json:"subject"`
+	To                []string `json:"to"`
+	SentAt            int64    `json:"sent_at"`
+	Status            string   `json:"status"`
+	DueAt             int64    `json:"due_at"`
+	SnoozedUntil      int64    `json:"snoozed_until,omitempty"`
+	NotifiedAt        int64    `json:"notified_at,omitempty"`
+}
+
+// FollowUpQuery selects follow-ups
+type FollowUpQuery struct {
+	Now      int64  // unix seconds
+	After    int64  // seconds without a reply before a follow-up is due
+	Since    int64  // ignore messages sent before (unix seconds)
+	Status   string // one status; empty for all
+	Provider string // with ThreadID, one thread
+	ThreadID string
+	Limit    int // 0 for no limit
+}
+
+// Task delivery statuses
+const (
+	TaskDeliveryPending   = "pending"   // queued or being retried
+	TaskDeliveryDelivered = "delivered" // created in the task system
+	TaskDeliveryFailed    = "failed"    // gave up; see LastError
+)
+
+// TaskSinkConfig connects a user to an external task system. The OAuth token
+// comes from BetterAuth; Settings hold what the sink needs besides it.
+type TaskSinkConfig struct {
+	Name      string            `json:"name"`     // todoist, linear, notion
+	Settings  map[string]string `json:"settings"` // e.g. Linear team_id
+	CreatedAt int64             `json:"created_at"`
+	UpdatedAt int64             `json:"updated_at"`
+}
+
+// TaskDelivery is an action item extracted from a thread and pushed, or to
+// be pushed, to one task sink
+type TaskDelivery struct {
+	ID               string `json:"id"`
+	Sink             string `json:"sink"`
+	Provider         string `json:"provider"`
+	ProviderThreadID string `json:"provider_thread_id"`
+	SourceID         string `json:"source_id"` // workflow that extracted the item
+	Title            string `json:"title"`
+	Notes            string `json:"notes,omitempty"`
+	Due              string `json:"due,omitempty"` // YYYY-MM-DD
+	Status           string `json:"status"`
+	Attempts         int    `json:"attempts"`
+	ExternalID       string `json:"external_id,omitempty"`
+	ExternalURL      string `json:"external_url,omitempty"`
+	LastError        string `json:"last_error,omitempty"`
+	CreatedAt        int64  `json:"created_at"`
+	UpdatedAt        int64  `json:"updated_at"`
+}
+
+// MessageEmbedding is a message's vector for semantic search (see
+// internal/semantic)
+type MessageEmbedding struct {
+	Provider          string
+	ProviderMessageID string
+	Model             string // vectors from different models aren't comparable
+	Vector            []float32
+}
+
+// EmbeddingSource is the text a stored message is embedded from
+type EmbeddingSource struct {
+	Seq               int64 // position in the store, the backfill cursor
+	Provider          string
+	ProviderMessageID string
+	Subject           string
+	Sender            string
+	Snippet           string
+	Attachments       string // extracted attachment text, "" if none
+}
+
+// Embedding backfill statuses
+const (
+	BackfillRunning = "running" // a job is queued or working through the mail
+	BackfillDone    = "done"    // caught up with the mail stored when it last ran
+)
+
+// EmbeddingBackfill is the progress of embedding a user's existing mail with
+// one model
+type EmbeddingBackfill struct {
+	Model      string `json:"model"`
+	Status     string `json:"status"`
+	Cursor     int64  `json:"-"`         // last message processed
+	Embedded   int64  `json:"embedded"`  // messages given a vector
+	Skipped    int64  `json:"skipped"`   // messages without text to embed
+	Remaining  int64  `json:"remaining"` // messages after the cursor without a vector, when loaded
+	LastError  string `json:"last_error,omitempty"`
+	StartedAt  int64  `json:"started_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+}
+
+// SemanticQuery ranks messages by similarity to a vector
+type SemanticQuery struct {
+	Vector   []float32
+	Model    string        // only vectors from this model are compared
+	Filter   *search.Query // optional operators messages must match; free text is ignored
+	MinScore float64       // drop messages less similar than this
+	Limit    int
+}
+
+// ScoredMessage is a message with its similarity to a semantic query
+type ScoredMessage struct {
+	StoredMessage
+	Score float64 `json:"score"`
+}
+
+// EnrichmentSource is a stored message as re-enrichment replays it through
+// the enrichers (see internal/enrich)
+type EnrichmentSource struct {
+	Seq               int64 // position in the store, the re-enrichment cursor
+	EventID           string
+	TS                int64 // ingested at
+	MsgDate           int64
+	Provider          string
+	InboxID           string
+	ProviderMessageID string
+	ProviderThreadID  string
+	Subject           string
+	Sender            string
+	To                []string
+	Cc                []string
+	Snippet           string
+	Headers           map[string]string
+	Kind              string
+	IsList            bool
+}
+
+// EnrichmentOutput is an event an enricher derived from a message, kept per
+// enrichment version so the results of two versions can be compared
+type EnrichmentOutput struct {
+	Version           string          `json:"version"`
+	SourceEventID     string          `json:"source_event_id"`
+	Provider          string          `json:"provider"`
+	ProviderMessageID string          `json:"provider_message_id"`
+	Enricher          string          `json:"enricher"`
+	EventType         string          `json:"event_type"`
+	Payload           json.RawMessage `json:"payload"` // as the enricher returned it
+	CreatedAt         int64           `json:"created_at"`
+}
+
+// EnrichmentRun is the progress of re-enriching a user's stored mail with
+// one enrichment version. Statuses are those of EmbeddingBackfill.
+type EnrichmentRun struct {
+	Version    string `json:"version"`
+	Status     string `json:"status"`
+	Publish    bool   `json:"publish"` // derived events are queued, not only recorded
+	Cursor     int64  `json:"-"`       // last message processed
+	Processed  int64  `json:"processed"`
+	Derived    int64  `json:"derived"`
+	LastError  string `json:"last_error,omitempty"`
+	StartedAt  int64  `json:"started_at"`
+	UpdatedAt  int64  `json:"updated_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+}
+
+// EnrichmentComparison lists the messages whose enrichment outputs differ
+// between two versions
+type EnrichmentComparison struct {
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	Compared int              `json:"compared"` // messages with outputs in either version
+	Changed  int              `json:"changed"`
+	Diffs    []EnrichmentDiff `json:"diffs"` // up to the requested limit
+}
+
+// EnrichmentDiff is a message's outputs under both versions
+type EnrichmentDiff struct {
+	SourceEventID     string             `json:"source_event_id"`
+	Provider          string             `json:"provider"`
+	ProviderMessageID string             `json:"provider_message_id"`
+	From              []EnrichmentOutput `json:"from"`
+	To                []EnrichmentOutput `json:"to"`
+}
+
+// Calendar suggestion sources
+const (
+	SuggestionFromText   = "text"   // the meetings enricher read it from the subject and snippet
+	SuggestionFromInvite = "invite" // an iCalendar invite attached to the message
+)
+
+// Calendar suggestion statuses. Only active suggestions are read back; the
+// others keep an invite's older versions from being taken up again.
+const (
+	SuggestionActive     = "active"
+	SuggestionCancelled  = "cancelled"  // the invite was called off
+	SuggestionSuperseded = "superseded" // a later version of the invite is stored
+)
+
+// CalendarSuggestion is a meeting proposal found in a message (see the
+// meetings enricher) or an invite sent with it, kept so later readers don't
+// need the event stream. An invite's candidates are all booked, not
+// alternatives.
+type CalendarSuggestion struct {
+	Provider          string         `json:"provider"`
+	ProviderMessageID string         `json:"provider_message_id"`
+	ProviderThreadID  string         `json:"provider_thread_id"`
+	SourceEventID     string         `json:"source_event_id"`
+	Title             string         `json:"title"`
+	Candidates        []CalendarSlot `json:"candidates"`
+	Attendees         []string       `json:"attendees"`
+	ConferenceURL     string         `json:"conference_url,omitempty"`
+	StartsAt          int64          `json:"starts_at"` // earliest candidate start, 0 if none
+	EndsAt            int64          `json:"ends_at"`   // latest candidate end, or when a link-only proposal goes stale
+	CreatedAt         int64          `json:"created_at"`
+	Source            string         `json:"source"`               // SuggestionFromText if empty
+	InviteUID         string         `json:"invite_uid,omitempty"` // set for invites
+	InviteSequence    int            `json:"-"`
+	Status            string         `json:"-"` // SuggestionActive if empty
+}
+
+// CalendarSlot is a proposed time, in the zone it was proposed in
+type CalendarSlot struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	AllDay bool      `json:"all_day"`
+	Text   string    `json:"text,omitempty"`
+}
+
+// MessageVector is a stored message's embedding with what's needed to
+// cluster and name it
+type MessageVector struct {
+	EventID  string
+	Provider string
+	Subject  string
+	MsgDate  int64
+	Vector   []float32
+}
+
+// Topic is a cluster of related messages (see internal/topics), replaced
+// wholesale each time the user's mail is clustered
+type Topic struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Keywords   []string      `json:"keywords"`
+	Model      string        `json:"model"`     // embedding model the cluster came from
+	Size       int           `json:"size"`      // member messages
+	LatestAt   int64         `json:"latest_at"` // newest member's msg_date
+	ComputedAt int64         `json:"computed_at"`
+	Members    []TopicMember `json:"-"`
+}
+
+// TopicMember is a message in a topic
+type TopicMember struct {
+	EventID    string
+	Provider   string
+	Similarity float64 // to the topic's centroid
+}
+
+// Attachment extraction statuses
+const (
+	AttachmentPending   = "pending"   // queued for text extraction
+	AttachmentExtracted = "extracted" // Text holds the document's text
+	AttachmentSkipped   = "skipped"   // type or size not allowed, or not stored
+	AttachmentFailed    = "failed"    // Error says why
+)
+
+// Attachment is a file attached to a stored message. The file itself lives
+// in the blob store under BlobKey while its text waits to be extracted.
+type Attachment struct {
+	ID                string `json:"id"`
+	EventID           string `json:"event_id"`
+	Provider          string `json:"provider"`
+	ProviderMessageID string `json:"provider_message_id"`
+	Filename          string `json:"filename"`
+	ContentType       string `json:"content_type"`
+	Size              int64  `json:"size"`
+	BlobKey           string `json:"-"`
+	Status            string `json:"status"`
+	Text              string `json:"text,omitempty"`
+	Error             string `json:"error,omitempty"`
+	CreatedAt         int64  `json:"created_at"`
+	ExtractedAt       int64  `json:"extracted_at,omitempty"`
+}
+
+// Sender rule actions
+const (
+	SenderRuleBlock = "block" // matching mail is not synced
+	SenderRuleAllow = "allow" // matching mail is synced even if a block rule matches
+)
+
+// Sender rule kinds, what a rule matches
+const (
+	SenderRuleSender = "sender" // the sender's address
+	SenderRuleDomain = "domain" // the sender's domain or a subdomain of it
+	SenderRuleHeader = "header" // a header containing Value, or present when Value is empty
+)
+
+// SenderRule decides whether received mail is synced
+type SenderRule struct {
+	ID        string `json:"id"`
+	Action    string `json:"action"`
+	Kind      string `json:"kind"`
+	Header    string `json:"header,omitempty"` // header name, for kind header
+	Value     string `json:"value"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ErrInvalidSenderRule is returned for sender rules with an unknown action or
+// kind or a missing value
+var ErrInvalidSenderRule = errors.New("invalid sender rule")
+
+// Quarantine reasons, why the sync pipeline held a received message back
+// instead of storing and publishing it
+const (
+	QuarantineValidation = "validation" // the message is malformed, e.g. has no id
+	QuarantineStage      = "stage"      // a pipeline stage failed on it
+	QuarantineSize       = "size"       // its event is too large to publish
+	QuarantineStore      = "store"      // the store rejected it
+)
+
+// Quarantine statuses
+const (
+	QuarantinePending   = "pending"   // waiting for review
+	QuarantineRequeued  = "requeued"  // to be ingested by the next sync cycle
+	QuarantineReleased  = "released"  // ingested after a requeue
+	QuarantineDiscarded = "discarded" // dropped by an admin
+)
+
+// QuarantinedMessage is a received message the sync pipeline held back, kept
+// as the provider returned it so it can be requeued
+type QuarantinedMessage struct {
+	ID                int64           `json:"id"`
+	Provider          string          `json:"provider"`
+	InboxID           string          `json:"inbox_id"`
+	ProviderMessageID string          `json:"provider_message_id"`
+	Reason            string          `json:"reason"`
+	Detail            string          `json:"detail"`
+	Message           json.RawMessage `json:"message"`
+	Status            string          `json:"status"`
+	Attempts          int             `json:"attempts"` // times it was held back
+	CreatedAt         int64           `json:"created_at"`
+	UpdatedAt         int64           `json:"updated_at"`
+}
+
+// Event is a generic event other services store through /events, such as
+// memory facts
+type Event struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EventFilter selects events for ExportEvents. Zero values match everything.
+type EventFilter struct {
+	Type    string
+	Since   time.Time
+	Until   time.Time
+	AfterID int64 // resume after this event id
+}
+
+// Event processing statuses a consumer acknowledges
+const (
+	AckProcessed = "processed"
+	AckFailed    = "failed"
+)
+
+// EventAck is a downstream consumer's acknowledgment of an event it received
+// from NATS. A later ack by the same consumer replaces it.
+type EventAck struct {
+	EventID      string `json:"event_id"` // the event_id of the published payload
+	Consumer     string `json:"consumer"`
+	EventType    string `json:"event_type,omitempty"`
+	Status       string `json:"status"` // processed or failed
+	Detail       string `json:"detail,omitempty"`
+	Attempts     int    `json:"attempts"` // acks received
+	FirstAckedAt int64  `json:"first_acked_at"`
+	AckedAt      int64  `json:"acked_at"`
+}
+
+// ConsumerProgress summarises a consumer's acknowledgments
+type ConsumerProgress struct {
+	Consumer    string `json:"consumer"`
+	Processed   int64  `json:"processed"`
+	Failed      int64  `json:"failed"` // events whose latest ack is failed
+	LastAckedAt int64  `json:"last_acked_at"`
+	LastEventID string `json:"last_event_id"`
+}
+
+// UnackedEvent is a received mail event a consumer hasn't processed
+type UnackedEvent struct {
+	EventID string `json:"event_id"`
+	TS      int64  `json:"ts"` // stored at
+	Subject string `json:"subject,omitempty"`
+	Status  string `json:"status,omitempty"` // failed, or empty with no ack at all
+	Detail  string `json:"detail,omitempty"`
+}
+
+// OutboxBacklog describes the outbox messages not yet published to NATS
+type OutboxBacklog struct {
+	Pending         int64 `json:"pending"`
+	OldestPendingAt int64 `json:"oldest_pending_at,omitempty"` // unix seconds, 0 with nothing pending
+
+	// Retries counts pending messages by failed attempts, in the buckets
+	// of RetryBuckets
+	Retries map[string]int64 `json:"retries"`
+
+	// RecentErrors are the latest publish failures of pending messages,
+	// newest first
+	RecentErrors []OutboxError `json:"recent_errors"`
+}
+
+// RetryBuckets are the keys of OutboxBacklog.Retries
+var RetryBuckets = []string{"0", "1", "2-4", "5-9", "10+"}
+
+// OutboxError is the last publish failure of an outbox message
+type OutboxError struct {
+	ID        int64  `json:"id"`
+	UserID    string `json:"user_id"`
+	Subject   string `json:"subject"`
+	EventType string `json:"event_type"`
+	Retries   int    `json:"retries"`
+	Error     string `json:"error"`
+	FailedAt  int64  `json:"failed_at"`
+}
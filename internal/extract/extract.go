@@ -0,0 +1,142 @@
+// Package extract pulls plain text out of document attachments (PDF, DOCX
+// and XLSX) so they can be searched and embedded. The extractors use only the
+// standard library: Office documents are zipped XML, and PDF text is read
+// from the show-text operators of page content streams, mapped through the
+// fonts' ToUnicode tables where present. Layout is approximated with line
+// breaks and spaces; scanned PDFs (images only) yield no text.
+package extract
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document types
+const (
+	PDF  = "pdf"
+	DOCX = "docx"
+	XLSX = "xlsx"
+)
+
+// ErrUnsupported is returned for documents no extractor handles
+var ErrUnsupported = errors.New("unsupported document type")
+
+// contentTypes maps MIME types to document types
+var contentTypes = map[string]string{
+	"application/pdf": PDF,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": DOCX,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       XLSX,
+}
+
+// Type returns the document type of an attachment from its content type,
+// falling back to the file extension (mail clients often send
+// application/octet-stream). Returns "" for unsupported files.
+func Type(contentType, filename string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if t, ok := contentTypes[strings.ToLower(mediaType)]; ok {
+			return t
+		}
+	}
+	switch ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), ".")); ext {
+	case PDF, DOCX, XLSX:
+		return ext
+	}
+	return ""
+}
+
+// Text extracts up to maxLen bytes of text from a document of the given type.
+// It stops with ctx's error once ctx is done.
+func Text(ctx context.Context, docType string, data []byte, maxLen int) (string, error) {
+	w := &textWriter{ctx: ctx, max: maxLen}
+	var err error
+	switch docType {
+	case PDF:
+		err = pdfText(data, w)
+	case DOCX:
+		err = docxText(data, w)
+	case XLSX:
+		err = xlsxText(data, w)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil && !errors.Is(err, errFull) {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// errFull stops an extractor once maxLen is reached
+var errFull = errors.New("text limit reached")
+
+// checkEvery is how many tokens an extractor reads between context checks
+const checkEvery = 1024
+
+// textWriter collects extracted text up to max bytes. Separators are held
+// back until more text follows, so output never ends in stray whitespace and
+// blank lines don't pile up.
+type textWriter struct {
+	ctx     context.Context
+	b       strings.Builder
+	max     int
+	pending string // separator written before the next text
+	ticks   int
+}
+
+// check returns the context's error every checkEvery calls, so extractors
+// can call it per token
+func (w *textWriter) check() error {
+	if w.ticks++; w.ticks%checkEvery != 0 {
+		return nil
+	}
+	return w.ctx.Err()
+}
+
+// write appends s, returning errFull once the limit is reached
+func (w *textWriter) write(s string) error {
+	if s == "" {
+		return nil
+	}
+	if w.b.Len() > 0 {
+		s = w.pending + s
+	}
+	w.pending = ""
+
+	if w.max > 0 && w.b.Len()+len(s) > w.max {
+		s = s[:w.max-w.b.Len()]
+		for !utf8.ValidString(s) {
+			s = s[:len(s)-1]
+		}
+		w.b.WriteString(s)
+		return errFull
+	}
+	w.b.WriteString(s)
+	return nil
+}
+
+// sep sets the separator before the next text unless a line break is pending
+func (w *textWriter) sep(s string) {
+	if !strings.Contains(w.pending, "\n") {
+		w.pending = s
+	}
+}
+
+func (w *textWriter) space() { w.sep(" ") }
+func (w *textWriter) tab()   { w.sep("\t") }
+
+// newline ends a line; two in a row leave a blank line, more are dropped
+func (w *textWriter) newline() {
+	if strings.Contains(w.pending, "\n") {
+		w.pending = "\n\n"
+		return
+	}
+	w.pending = "\n"
+}
+
+// String returns the text without leading or trailing whitespace
+func (w *textWriter) String() string {
+	return strings.TrimSpace(w.b.String())
+}
@@ -0,0 +1,248 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPartSize caps how much of a zip entry is read, guarding against
+// compression bombs
+const maxPartSize = 64 << 20
+
+// openPart returns a reader for a zip entry, nil if it doesn't exist
+func openPart(zr *zip.Reader, name string) (io.ReadCloser, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return nil, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, maxPartSize), f}, nil
+}
+
+// docxText reads the paragraphs of word/document.xml
+func docxText(data []byte, w *textWriter) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("open docx: %w", err)
+	}
+	part, err := openPart(zr, "word/document.xml")
+	if err != nil || part == nil {
+		return fmt.Errorf("open docx: no word/document.xml")
+	}
+	defer part.Close()
+
+	dec := xml.NewDecoder(part)
+	inText := false
+	for {
+		if err := w.check(); err != nil {
+			return err
+		}
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("parse docx: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				w.tab()
+			case "br", "cr":
+				w.newline()
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				w.newline()
+			case "tc": // table cell
+				w.tab()
+			}
+		case xml.CharData:
+			if inText {
+				err = w.write(string(t))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// xlsxText reads every worksheet, one row per line with tab-separated cells
+func xlsxText(data []byte, w *textWriter) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("open xlsx: %w", err)
+	}
+
+	shared, err := sharedStrings(zr)
+	if err != nil {
+		return err
+	}
+
+	var sheets []string
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "xl/worksheets/sheet") && strings.HasSuffix(f.Name, ".xml") {
+			sheets = append(sheets, f.Name)
+		}
+	}
+	if len(sheets) == 0 {
+		return fmt.Errorf("open xlsx: no worksheets")
+	}
+	// sheet2.xml before sheet10.xml
+	sort.Slice(sheets, func(i, j int) bool {
+		if len(sheets[i]) != len(sheets[j]) {
+			return len(sheets[i]) < len(sheets[j])
+		}
+		return sheets[i] < sheets[j]
+	})
+
+	for _, name := range sheets {
+		if err := sheetText(zr, name, shared, w); err != nil {
+			return err
+		}
+		w.newline()
+		w.newline()
+	}
+	return nil
+}
+
+// sharedStrings reads the workbook's string table
+func sharedStrings(zr *zip.Reader) ([]string, error) {
+	part, err := openPart(zr, "xl/sharedStrings.xml")
+	if err != nil || part == nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	var (
+		table  []string
+		cur    strings.Builder
+		inText bool
+	)
+	dec := xml.NewDecoder(part)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse xlsx strings: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				cur.Reset()
+			case "t":
+				inText = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				table = append(table, cur.String())
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				cur.Write(t)
+			}
+		}
+	}
+}
+
+// sheetText writes a worksheet's cell values
+func sheetText(zr *zip.Reader, name string, shared []string, w *textWriter) error {
+	part, err := openPart(zr, name)
+	if err != nil || part == nil {
+		return err
+	}
+	defer part.Close()
+
+	var (
+		cellType string
+		value    strings.Builder
+		inValue  bool
+		cells    int
+	)
+	dec := xml.NewDecoder(part)
+	for {
+		if err := w.check(); err != nil {
+			return err
+		}
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("parse xlsx sheet: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				cells = 0
+			case "c":
+				cellType = ""
+				for _, a := range t.Attr {
+					if a.Name.Local == "t" {
+						cellType = a.Value
+					}
+				}
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				v := value.String()
+				if cellType == "s" {
+					i, err := strconv.Atoi(strings.TrimSpace(v))
+					if err != nil || i < 0 || i >= len(shared) {
+						continue
+					}
+					v = shared[i]
+				}
+				if v = strings.TrimSpace(v); v == "" {
+					continue
+				}
+				if cells > 0 {
+					w.tab()
+				}
+				err = w.write(v)
+				cells++
+			case "row":
+				if cells > 0 {
+					w.newline()
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
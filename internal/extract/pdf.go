@@ -0,0 +1,764 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Limits on what a PDF can make the extractor do
+const (
+	maxStreamSize  = 32 << 20 // bytes of a decompressed stream
+	maxCMapEntries = 1 << 16  // codes mapped by one ToUnicode CMap
+	maxCMapRange   = 0xFFFF   // codes spanned by one bfrange
+)
+
+var (
+	pdfObj       = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfRef       = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfLength    = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfFilter    = regexp.MustCompile(`/Filter\s*\[?\s*/(\w+)`)
+	pdfFilters   = regexp.MustCompile(`/Filter\s*\[([^\]]*)\]`)
+	pdfObjStm    = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfFirst     = regexp.MustCompile(`/First\s+(\d+)`)
+	pdfRoot      = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	pdfPages     = regexp.MustCompile(`/Pages\s+(\d+)\s+\d+\s+R`)
+	pdfKids      = regexp.MustCompile(`/Kids\s*\[([^\]]*)\]`)
+	pdfPage      = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfContents  = regexp.MustCompile(`/Contents\s*(\[[^\]]*\]|\d+\s+\d+\s+R)`)
+	pdfFontDict  = regexp.MustCompile(`/Font\s*(<<[^>]*>>|\d+\s+\d+\s+R)`)
+	pdfFontEntry = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+	pdfToUnicode = regexp.MustCompile(`/ToUnicode\s+(\d+)\s+\d+\s+R`)
+	pdfIdentity  = regexp.MustCompile(`/Encoding\s*/Identity-[HV]\b`)
+	pdfEncrypt   = regexp.MustCompile(`/Encrypt\s`)
+)
+
+// pdfFile indexes a PDF's objects by number
+type pdfFile struct {
+	data    []byte
+	objects map[int][]byte
+}
+
+// pdfFont decodes the strings shown in one font
+type pdfFont struct {
+	cmap    map[uint32]string // ToUnicode mapping, nil if none
+	twoByte bool              // codes are two bytes (CID fonts)
+}
+
+// pdfText writes the text of every page in order
+func pdfText(data []byte, w *textWriter) error {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return fmt.Errorf("open pdf: not a PDF file")
+	}
+	f := &pdfFile{data: data, objects: map[int][]byte{}}
+	f.index()
+	if pdfEncrypt.Match(f.trailer()) {
+		return fmt.Errorf("open pdf: encrypted")
+	}
+
+	fonts := f.fonts(w.ctx)
+	for _, contents := range f.pageContents() {
+		for _, ref := range contents {
+			if err := w.ctx.Err(); err != nil {
+				return err
+			}
+			stream, ok := f.stream(ref)
+			if !ok {
+				continue
+			}
+			if err := showText(stream, fonts, w); err != nil {
+				return err
+			}
+		}
+		w.newline()
+		w.newline()
+	}
+	return nil
+}
+
+// index finds every object, including those packed in object streams
+func (f *pdfFile) index() {
+	locs := pdfObj.FindAllSubmatchIndex(f.data, -1)
+	for i, loc := range locs {
+		num, _ := strconv.Atoi(string(f.data[loc[2]:loc[3]]))
+		end := len(f.data)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		body := f.data[loc[1]:end]
+		if j := bytes.LastIndex(body, []byte("endobj")); j >= 0 {
+			body = body[:j]
+		}
+		f.objects[num] = body // later revisions win
+	}
+
+	for num, body := range f.objects {
+		if pdfObjStm.Match(dict(body)) {
+			f.unpackObjStm(num)
+		}
+	}
+}
+
+// unpackObjStm adds the objects of an object stream that aren't stored
+// directly
+func (f *pdfFile) unpackObjStm(num int) {
+	data, ok := f.stream(num)
+	if !ok {
+		return
+	}
+	m := pdfFirst.FindSubmatch(dict(f.objects[num]))
+	if m == nil {
+		return
+	}
+	first, err := strconv.Atoi(string(m[1]))
+	if err != nil || first < 0 || first > len(data) {
+		return
+	}
+
+	header := bytes.Fields(data[:first])
+	for i := 0; i+1 < len(header); i += 2 {
+		obj, err1 := strconv.Atoi(string(header[i]))
+		off, err2 := strconv.Atoi(string(header[i+1]))
+		if err1 != nil || err2 != nil || off < 0 || off > len(data)-first {
+			return
+		}
+		end := len(data)
+		if i+3 < len(header) {
+			if next, err := strconv.Atoi(string(header[i+3])); err == nil && next >= off && next <= len(data)-first {
+				end = first + next
+			}
+		}
+		if _, ok := f.objects[obj]; !ok {
+			f.objects[obj] = data[first+off : end]
+		}
+	}
+}
+
+// trailer returns the trailer dictionary, or the cross-reference stream's
+// dictionary in PDF 1.5+ files
+func (f *pdfFile) trailer() []byte {
+	if i := bytes.LastIndex(f.data, []byte("trailer")); i >= 0 {
+		return f.data[i:]
+	}
+	for _, body := range f.objects {
+		d := dict(body)
+		if bytes.Contains(d, []byte("/XRef")) && pdfRoot.Match(d) {
+			return d
+		}
+	}
+	return nil
+}
+
+// dict returns the dictionary part of an object, before any stream data
+func dict(body []byte) []byte {
+	if i := bytes.Index(body, []byte("stream")); i >= 0 {
+		return body[:i]
+	}
+	return body
+}
+
+// stream returns the decoded stream of an object
+func (f *pdfFile) stream(num int) ([]byte, bool) {
+	body, ok := f.objects[num]
+	if !ok {
+		return nil, false
+	}
+	i := bytes.Index(body, []byte("stream"))
+	if i < 0 {
+		return nil, false
+	}
+	d := body[:i]
+	raw := body[i+len("stream"):]
+	raw = bytes.TrimPrefix(raw, []byte("\r"))
+	raw = bytes.TrimPrefix(raw, []byte("\n"))
+
+	// Trust a direct /Length; otherwise stop at endstream
+	if m := pdfLength.FindSubmatch(d); m != nil && len(m[2]) == 0 {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n <= len(raw) {
+			raw = raw[:n]
+		}
+	} else if j := bytes.LastIndex(raw, []byte("endstream")); j >= 0 {
+		raw = bytes.TrimRight(raw[:j], "\r\n")
+	}
+
+	var filters []string
+	if m := pdfFilters.FindSubmatch(d); m != nil {
+		for _, name := range bytes.Fields(bytes.ReplaceAll(m[1], []byte("/"), []byte(" /"))) {
+			filters = append(filters, string(bytes.TrimPrefix(name, []byte("/"))))
+		}
+	} else if m := pdfFilter.FindSubmatch(d); m != nil {
+		filters = []string{string(m[1])}
+	}
+
+	for _, filter := range filters {
+		if filter != "FlateDecode" {
+			return nil, false // images and exotic encodings hold no text we can read
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, false
+		}
+		out, err := io.ReadAll(io.LimitReader(zr, maxStreamSize))
+		if err != nil && len(out) == 0 {
+			return nil, false
+		}
+		raw = out
+	}
+	return raw, true
+}
+
+// refs returns the object numbers referenced in b
+func refs(b []byte) []int {
+	var nums []int
+	for _, m := range pdfRef.FindAllSubmatch(b, -1) {
+		n, _ := strconv.Atoi(string(m[1]))
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+// pageContents returns each page's content streams in page order, walking
+// the page tree from the catalog, or every page object in object order if
+// the tree can't be followed
+func (f *pdfFile) pageContents() [][]int {
+	var pages []int
+	seen := map[int]bool{}
+	var walk func(num int)
+	walk = func(num int) {
+		if seen[num] {
+			return
+		}
+		seen[num] = true
+		d := dict(f.objects[num])
+		if m := pdfKids.FindSubmatch(d); m != nil {
+			for _, kid := range refs(m[1]) {
+				walk(kid)
+			}
+			return
+		}
+		if pdfPage.Match(d) {
+			pages = append(pages, num)
+		}
+	}
+	if m := pdfRoot.FindSubmatch(f.trailer()); m != nil {
+		root, _ := strconv.Atoi(string(m[1]))
+		if m := pdfPages.FindSubmatch(dict(f.objects[root])); m != nil {
+			n, _ := strconv.Atoi(string(m[1]))
+			walk(n)
+		}
+	}
+
+	if len(pages) == 0 {
+		for num, body := range f.objects {
+			if pdfPage.Match(dict(body)) {
+				pages = append(pages, num)
+			}
+		}
+		sort.Ints(pages)
+	}
+
+	var contents [][]int
+	for _, page := range pages {
+		m := pdfContents.FindSubmatch(dict(f.objects[page]))
+		if m == nil {
+			continue
+		}
+		streams := refs(m[1])
+		// A single reference may be an array object of streams
+		if len(streams) == 1 {
+			if body := bytes.TrimSpace(f.objects[streams[0]]); bytes.HasPrefix(body, []byte("[")) {
+				streams = refs(body)
+			}
+		}
+		contents = append(contents, streams)
+	}
+	return contents
+}
+
+// fonts maps font resource names to their decoders. Resource names are
+// per page in PDF; merging them is right for nearly all real files. Stops
+// early once ctx is done.
+func (f *pdfFile) fonts(ctx context.Context) map[string]*pdfFont {
+	fonts := map[string]*pdfFont{}
+	for _, body := range f.objects {
+		if ctx.Err() != nil {
+			break
+		}
+		d := dict(body)
+		for _, m := range pdfFontDict.FindAllSubmatch(d, -1) {
+			entries := m[1]
+			if !bytes.HasPrefix(entries, []byte("<<")) {
+				if r := refs(entries); len(r) == 1 {
+					entries = dict(f.objects[r[0]])
+				}
+			}
+			for _, e := range pdfFontEntry.FindAllSubmatch(entries, -1) {
+				name := string(e[1])
+				if _, ok := fonts[name]; ok {
+					continue
+				}
+				num, _ := strconv.Atoi(string(e[2]))
+				fonts[name] = f.font(num)
+			}
+		}
+	}
+	return fonts
+}
+
+// font loads a font's ToUnicode map
+func (f *pdfFile) font(num int) *pdfFont {
+	d := dict(f.objects[num])
+	font := &pdfFont{twoByte: pdfIdentity.Match(d)}
+	if m := pdfToUnicode.FindSubmatch(d); m != nil {
+		n, _ := strconv.Atoi(string(m[1]))
+		if data, ok := f.stream(n); ok {
+			var twoByte bool
+			font.cmap, twoByte = parseCMap(data)
+			font.twoByte = font.twoByte || twoByte
+		}
+	}
+	return font
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap and
+// whether its codes are two bytes wide. Mappings past maxCMapEntries are
+// dropped.
+func parseCMap(data []byte) (map[uint32]string, bool) {
+	cmap := map[uint32]string{}
+	twoByte := false
+	lx := &pdfLexer{data: data}
+
+	var operands []pdfToken
+	for {
+		tok, ok := lx.next()
+		if !ok {
+			break
+		}
+		if tok.kind != tokOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch string(tok.value) {
+		case "endcodespacerange":
+			for _, op := range operands {
+				if op.kind == tokString && len(op.value) >= 2 {
+					twoByte = true
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands) && len(cmap) < maxCMapEntries; i += 2 {
+				if operands[i].kind == tokString && operands[i+1].kind == tokString {
+					cmap[code(operands[i].value)] = utf16BE(operands[i+1].value)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, hi, dst := operands[i], operands[i+1], operands[i+2]
+				if lo.kind != tokString || hi.kind != tokString {
+					continue
+				}
+				// Counted in 64 bits: a range ending at 0xFFFFFFFF would
+				// wrap a 32-bit counter and never end
+				start, end := uint64(code(lo.value)), uint64(code(hi.value))
+				if end < start || end-start > maxCMapRange {
+					continue
+				}
+				switch dst.kind {
+				case tokString:
+					base := []rune(utf16BE(dst.value))
+					if len(base) == 0 {
+						continue
+					}
+					for c := start; c <= end && len(cmap) < maxCMapEntries; c++ {
+						r := append([]rune{}, base...)
+						r[len(r)-1] += rune(c - start)
+						cmap[uint32(c)] = string(r)
+					}
+				case tokArray:
+					for j, item := range dst.items {
+						c := start + uint64(j)
+						if c > end || len(cmap) >= maxCMapEntries {
+							break
+						}
+						if item.kind == tokString {
+							cmap[uint32(c)] = utf16BE(item.value)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return cmap, twoByte
+}
+
+// code reads a big-endian character code
+func code(b []byte) uint32 {
+	var c uint32
+	for _, x := range b {
+		c = c<<8 | uint32(x)
+	}
+	return c
+}
+
+// utf16BE decodes a ToUnicode destination
+func utf16BE(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// decode maps a shown string to text
+func (font *pdfFont) decode(b []byte) string {
+	var out []rune
+	step := 1
+	if font != nil && font.twoByte {
+		step = 2
+	}
+	for i := 0; i+step <= len(b); i += step {
+		c := code(b[i : i+step])
+		if font != nil && font.cmap != nil {
+			if s, ok := font.cmap[c]; ok {
+				out = append(out, []rune(s)...)
+			}
+			continue
+		}
+		if step == 2 {
+			continue // CID codes without a map are glyph ids
+		}
+		// Simple fonts without a map: standard encoding is close to Latin-1
+		switch {
+		case c == '\t' || c == '\n' || c == '\r':
+			out = append(out, ' ')
+		case c >= 0x20 && c < 0x7F, c >= 0xA0:
+			out = append(out, rune(c))
+		}
+	}
+	return string(out)
+}
+
+// showText interprets a content stream's text operators
+func showText(content []byte, fonts map[string]*pdfFont, w *textWriter) error {
+	var (
+		operands []pdfToken
+		font     *pdfFont
+		lastY    float64
+		haveY    bool
+	)
+	show := func(b []byte) error {
+		return w.write(font.decode(b))
+	}
+	moveTo := func(y float64) {
+		if haveY && y != lastY {
+			w.newline()
+		} else {
+			w.space()
+		}
+		lastY, haveY = y, true
+	}
+	num := func(i int) float64 {
+		if i < 0 || i >= len(operands) || operands[i].kind != tokNumber {
+			return 0
+		}
+		v, _ := strconv.ParseFloat(string(operands[i].value), 64)
+		return v
+	}
+
+	lx := &pdfLexer{data: content}
+	for {
+		if err := w.check(); err != nil {
+			return err
+		}
+		tok, ok := lx.next()
+		if !ok {
+			return nil
+		}
+		if tok.kind != tokOperator {
+			operands = append(operands, tok)
+			continue
+		}
+
+		var err error
+		n := len(operands)
+		switch string(tok.value) {
+		case "Tf":
+			if n >= 2 && operands[n-2].kind == tokName {
+				font = fonts[string(operands[n-2].value)]
+			}
+		case "Td", "TD":
+			if n >= 2 {
+				if dy := num(n - 1); dy != 0 {
+					w.newline()
+					lastY += dy
+				} else {
+					w.space()
+				}
+			}
+		case "Tm":
+			if n >= 6 {
+				moveTo(num(n - 1))
+			}
+		case "T*":
+			w.newline()
+		case "Tj":
+			if n >= 1 && operands[n-1].kind == tokString {
+				err = show(operands[n-1].value)
+			}
+		case "'", "\"":
+			w.newline()
+			if n >= 1 && operands[n-1].kind == tokString {
+				err = show(operands[n-1].value)
+			}
+		case "TJ":
+			if n >= 1 && operands[n-1].kind == tokArray {
+				for _, item := range operands[n-1].items {
+					switch item.kind {
+					case tokString:
+						err = show(item.value)
+					case tokNumber:
+						// A large negative adjustment is a word gap
+						if v, _ := strconv.ParseFloat(string(item.value), 64); v < -200 {
+							w.space()
+						}
+					}
+					if err != nil {
+						break
+					}
+				}
+			}
+		case "ET":
+			w.space()
+		case "BI":
+			lx.skipInlineImage()
+		}
+		if err != nil {
+			return err
+		}
+		operands = operands[:0]
+	}
+}
+
+// PDF content tokens
+const (
+	tokNumber = iota
+	tokString // literal or hex string, decoded to bytes
+	tokName
+	tokArray
+	tokDict
+	tokOperator
+)
+
+type pdfToken struct {
+	kind  int
+	value []byte
+	items []pdfToken // array elements
+}
+
+// pdfLexer tokenizes content streams and CMaps
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
+
+// next returns the next token, false at the end of the data
+func (lx *pdfLexer) next() (pdfToken, bool) {
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		switch {
+		case isPDFSpace(c):
+			lx.pos++
+		case c == '%':
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' && lx.data[lx.pos] != '\r' {
+				lx.pos++
+			}
+		case c == '(':
+			return pdfToken{kind: tokString, value: lx.literal()}, true
+		case c == '<' && lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '<':
+			lx.skipDict()
+			return pdfToken{kind: tokDict}, true
+		case c == '<':
+			return pdfToken{kind: tokString, value: lx.hex()}, true
+		case c == '[':
+			lx.pos++
+			var items []pdfToken
+			for {
+				save := lx.pos
+				tok, ok := lx.next()
+				if !ok || (tok.kind == tokOperator && string(tok.value) == "]") {
+					break
+				}
+				if tok.kind == tokOperator { // malformed; let the caller see it
+					lx.pos = save
+					break
+				}
+				items = append(items, tok)
+			}
+			return pdfToken{kind: tokArray, items: items}, true
+		case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+			lx.pos++
+			return pdfToken{kind: tokOperator, value: []byte{c}}, true
+		case c == '/':
+			start := lx.pos + 1
+			lx.pos++
+			for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelim(lx.data[lx.pos]) {
+				lx.pos++
+			}
+			return pdfToken{kind: tokName, value: lx.data[start:lx.pos]}, true
+		default:
+			start := lx.pos
+			for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelim(lx.data[lx.pos]) {
+				lx.pos++
+			}
+			word := lx.data[start:lx.pos]
+			if _, err := strconv.ParseFloat(string(word), 64); err == nil {
+				return pdfToken{kind: tokNumber, value: word}, true
+			}
+			return pdfToken{kind: tokOperator, value: word}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+// literal reads a (string) with escapes and balanced parentheses
+func (lx *pdfLexer) literal() []byte {
+	lx.pos++ // (
+	var out []byte
+	depth := 1
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		lx.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return out
+			}
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				return out
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+					lx.pos++
+				}
+				continue // line continuation
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; k++ {
+						v = v*8 + int(lx.data[lx.pos]-'0')
+						lx.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hex reads a <hex string>
+func (lx *pdfLexer) hex() []byte {
+	lx.pos++ // <
+	var digits []byte
+	for lx.pos < len(lx.data) && lx.data[lx.pos] != '>' {
+		if c := lx.data[lx.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		lx.pos++
+	}
+	lx.pos++ // >
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return out
+		}
+		out = append(out, byte(v))
+	}
+	return out
+}
+
+// skipDict skips a << dictionary >>, including nested ones
+func (lx *pdfLexer) skipDict() {
+	depth := 0
+	for lx.pos+1 < len(lx.data) {
+		switch {
+		case lx.data[lx.pos] == '<' && lx.data[lx.pos+1] == '<':
+			depth++
+			lx.pos += 2
+		case lx.data[lx.pos] == '>' && lx.data[lx.pos+1] == '>':
+			depth--
+			lx.pos += 2
+			if depth == 0 {
+				return
+			}
+		case lx.data[lx.pos] == '(':
+			lx.literal()
+		default:
+			lx.pos++
+		}
+	}
+	lx.pos = len(lx.data)
+}
+
+// skipInlineImage skips the binary data of an inline image (BI ... ID data EI)
+func (lx *pdfLexer) skipInlineImage() {
+	i := bytes.Index(lx.data[lx.pos:], []byte("ID"))
+	if i < 0 {
+		lx.pos = len(lx.data)
+		return
+	}
+	lx.pos += i + 3
+	for lx.pos+2 <= len(lx.data) {
+		j := bytes.Index(lx.data[lx.pos:], []byte("EI"))
+		if j < 0 {
+			break
+		}
+		end := lx.pos + j
+		if end > 0 && isPDFSpace(lx.data[end-1]) && (end+2 == len(lx.data) || isPDFSpace(lx.data[end+2])) {
+			lx.pos = end + 2
+			return
+		}
+		lx.pos = end + 2
+	}
+	lx.pos = len(lx.data)
+}
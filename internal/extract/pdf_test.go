@@ -0,0 +1,142 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pdfDoc builds a one-page PDF showing content, with extra objects appended
+func pdfDoc(content string, extra ...string) []byte {
+	var b strings.Builder
+	b.WriteString("%PDF-1.7\n")
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	b.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	b.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>\nendobj\n")
+	fmt.Fprintf(&b, "4 0 obj\n<< >>\nstream\n%s\nendstream\nendobj\n", content)
+	b.WriteString("5 0 obj\n<< /Type /Font /Subtype /Type0 /Encoding /Identity-H /ToUnicode 6 0 R >>\nendobj\n")
+	for i, obj := range extra {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", 6+i, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return []byte(b.String())
+}
+
+// cmapStream wraps CMap operators in a stream object
+func cmapStream(body string) string {
+	return "<< >>\nstream\nbegincmap\n1 begincodespacerange <0000> <FFFF> endcodespacerange\n" + body + "\nendcmap\nendstream"
+}
+
+// parse runs parseCMap, failing the test if it doesn't return in time
+func parse(t *testing.T, data string) map[uint32]string {
+	t.Helper()
+	done := make(chan map[uint32]string, 1)
+	go func() {
+		cmap, _ := parseCMap([]byte(data))
+		done <- cmap
+	}()
+	select {
+	case cmap := <-done:
+		return cmap
+	case <-time.After(5 * time.Second):
+		t.Fatal("parseCMap did not return")
+		return nil
+	}
+}
+
+func TestPDFText(t *testing.T) {
+	doc := pdfDoc("BT /F1 12 Tf <00480069> Tj ET",
+		cmapStream("2 beginbfchar <0048> <0048> <0069> <0069> endbfchar"))
+	text, err := Text(context.Background(), PDF, doc, 0)
+	if err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+	if text != "Hi" {
+		t.Errorf("Text = %q, want %q", text, "Hi")
+	}
+}
+
+func TestParseCMapRangeAtMaxCode(t *testing.T) {
+	// The last code of a 32-bit range used to wrap the counter to 0
+	cmap := parse(t, "1 beginbfrange <FFFFFFF0> <FFFFFFFF> <0041> endbfrange")
+	if len(cmap) != 16 {
+		t.Errorf("got %d mappings, want 16", len(cmap))
+	}
+	if got := cmap[0xFFFFFFFF]; got != "P" {
+		t.Errorf("cmap[0xFFFFFFFF] = %q, want %q", got, "P")
+	}
+
+	cmap = parse(t, "1 beginbfrange <FFFFFFFE> <FFFFFFFF> [<0041> <0042> <0043>] endbfrange")
+	if len(cmap) != 2 || cmap[0xFFFFFFFF] != "B" {
+		t.Errorf("array range = %v, want 2 mappings ending in B", cmap)
+	}
+}
+
+func TestParseCMapLimits(t *testing.T) {
+	// Wider than maxCMapRange: skipped
+	if cmap := parse(t, "1 beginbfrange <00000000> <00010000> <0041> endbfrange"); len(cmap) != 0 {
+		t.Errorf("oversized range gave %d mappings", len(cmap))
+	}
+
+	var b strings.Builder
+	b.WriteString("8 beginbfrange\n")
+	for i := 0; i < 8; i++ {
+		fmt.Fprintf(&b, "<%04X0000> <%04XFFFF> <0041>\n", i, i)
+	}
+	b.WriteString("endbfrange")
+	if cmap := parse(t, b.String()); len(cmap) != maxCMapEntries {
+		t.Errorf("got %d mappings, want the cap of %d", len(cmap), maxCMapEntries)
+	}
+}
+
+func TestUnpackObjStmBadOffsets(t *testing.T) {
+	for _, header := range []string{
+		"7 -10",                    // negative offset
+		"7 9223372036854775807",    // offset that overflows First+offset
+		"7 0 8 -3",                 // negative next offset
+		"7 0 8 922337203685477580", // next offset past the data
+	} {
+		t.Run(header, func(t *testing.T) {
+			data := header + " (x) (y)"
+			f := &pdfFile{objects: map[int][]byte{
+				1: []byte(fmt.Sprintf("<< /Type /ObjStm /N 1 /First %d >>\nstream\n%s\nendstream", len(header)+1, data)),
+			}}
+			f.unpackObjStm(1)
+		})
+	}
+}
+
+func TestTextStopsWhenCancelled(t *testing.T) {
+	content := strings.Repeat("BT (a) Tj ET\n", 4*checkEvery)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Text(ctx, PDF, pdfDoc(content), 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Text with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func FuzzParseCMap(f *testing.F) {
+	f.Add([]byte("1 beginbfchar <0041> <0061> endbfchar"))
+	f.Add([]byte("1 beginbfrange <0000> <00FF> <0020> endbfrange"))
+	f.Add([]byte("1 beginbfrange <FFFFFFF0> <FFFFFFFF> [<0041> <0042>] endbfrange"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cmap, _ := parseCMap(data)
+		if len(cmap) > maxCMapEntries {
+			t.Fatalf("%d mappings, more than maxCMapEntries", len(cmap))
+		}
+	})
+}
+
+func FuzzPDFText(f *testing.F) {
+	f.Add(pdfDoc("BT /F1 12 Tf <0041> Tj ET", cmapStream("1 beginbfrange <0000> <FFFF> <0000> endbfrange")))
+	f.Add([]byte("%PDF-1.5\n1 0 obj\n<< /Type /ObjStm /N 2 /First 9 >>\nstream\n2 0 3 -4 (a) (b)\nendstream\nendobj\n"))
+	f.Add([]byte("%PDF-1.5\n1 0 obj\n<< /Type /ObjStm /First 99999 >>\nstream\n2 0\nendstream\nendobj\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		Text(ctx, PDF, data, 1<<16)
+	})
+}
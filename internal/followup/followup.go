@@ -0,0 +1,139 @@
+// Package followup reminds users about threads where they sent the last
+// message and nobody replied. Follow-ups are derived from the synced Sent
+// folder on demand; the user's store only keeps snoozes, dismissals and when
+// followup.due was last published for a thread.
+package followup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// EventDue is published once per follow-up when it becomes due, and again
+// when a snooze ends
+const EventDue = "followup.due"
+
+// Defaults for New
+const (
+	DefaultAfter  = 3 * 24 * time.Hour
+	DefaultWindow = 30 * 24 * time.Hour
+)
+
+// Tracker finds follow-ups and publishes followup.due
+type Tracker struct {
+	stores eventstore.Opener
+	after  time.Duration // without a reply before a follow-up is due
+	window time.Duration // sent messages older than this are never followed up
+}
+
+// New creates a tracker. Threads are due after going unanswered for after;
+// messages sent longer than window ago are ignored.
+func New(stores eventstore.Opener, after, window time.Duration) *Tracker {
+	return &Tracker{stores: stores, after: after, window: window}
+}
+
+// Query returns the query for a user's follow-ups at now with one status
+// (empty for all)
+func (t *Tracker) Query(now time.Time, status string) eventstore.FollowUpQuery {
+	return eventstore.FollowUpQuery{
+		Now:    now.Unix(),
+		After:  int64(t.after / time.Second),
+		Since:  now.Add(-t.window).Unix(),
+		Status: status,
+	}
+}
+
+// Find returns a thread's follow-up, nil if the thread isn't awaiting a reply
+func (t *Tracker) Find(ctx context.Context, store eventstore.Query, provider, threadID string) (*eventstore.FollowUp, error) {
+	q := t.Query(time.Now(), "")
+	q.Provider, q.ThreadID = provider, threadID
+	followUps, err := store.FollowUps(ctx, q)
+	if err != nil || len(followUps) == 0 {
+		return nil, err
+	}
+	return &followUps[0], nil
+}
+
+// Notify publishes followup.due for each of the users' follow-ups that became
+// due since it was last published, and returns how many it published. A
+// failed user doesn't stop the others.
+func (t *Tracker) Notify(ctx context.Context, userIDs []string) (int, error) {
+	published := 0
+	var errs []error
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := t.notifyUser(ctx, userID)
+		published += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+		}
+	}
+	return published, errors.Join(errs...)
+}
+
+func (t *Tracker) notifyUser(ctx context.Context, userID string) (int, error) {
+	store, err := t.stores.Open(userID)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	now := time.Now()
+	due, err := store.FollowUps(ctx, t.Query(now, eventstore.FollowUpDue))
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, f := range due {
+		// Published already, and not snoozed since
+		if f.NotifiedAt >= f.DueAt {
+			continue
+		}
+		if err := publishDue(ctx, store, userID, f, now); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// publishDue queues followup.due and records it in one transaction
+func publishDue(ctx context.Context, store eventstore.Store, userID string, f eventstore.FollowUp, now time.Time) error {
+	payload, err := json.Marshal(map[string]any{
+		"user_id":             userID,
+		"ts":                  now.Unix(),
+		"provider":            f.Provider,
+		"provider_thread_id":  f.ProviderThreadID,
+		"provider_message_id": f.ProviderMessageID,
+		"subject":             f.Subject,
+		"to":                  f.To,
+		"sent_at":             f.SentAt,
+		"due_at":              f.DueAt,
+	})
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	return store.WithTx(ctx, func(tx eventstore.Tx) error {
+		if err := tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+			Subject:   fmt.Sprintf("user.%s.%s", userID, EventDue),
+			EventType: EventDue,
+			Payload:   payload,
+			// Once per message and due time: a snooze makes a new one
+			MsgID:       fmt.Sprintf("%s|%s|%s|%d", EventDue, f.Provider, f.ProviderMessageID, f.DueAt),
+			TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+		}); err != nil {
+			return err
+		}
+		return tx.MarkFollowUpNotified(ctx, f.Provider, f.ProviderThreadID, f.ProviderMessageID, now.Unix())
+	})
+}
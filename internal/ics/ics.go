@@ -0,0 +1,481 @@
+// Package ics parses iCalendar (RFC 5545) invites, as sent with meeting
+// requests in text/calendar parts and .ics attachments. It reads the
+// calendar's method and each VEVENT's identity, times, people and conference
+// link; recurrence rules are noted but not expanded, so a recurring event is
+// its first occurrence.
+package ics
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned for data without a VCALENDAR
+var ErrNotCalendar = errors.New("not an iCalendar object")
+
+// maxEvents bounds the events read from one calendar
+const maxEvents = 20
+
+// Calendar is a parsed iCalendar object
+type Calendar struct {
+	Method string // REQUEST, CANCEL, PUBLISH, REPLY...; "" if absent
+	Events []Event
+}
+
+// Event is a VEVENT. Times are in the zone they were given in; floating times
+// (no zone) are read as UTC.
+type Event struct {
+	UID         string
+	Sequence    int
+	Status      string // CONFIRMED, TENTATIVE, CANCELLED; "" if absent
+	Summary     string
+	Description string
+	Location    string
+	Conference  string // video call link
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Recurring   bool
+	Organizer   string   // address
+	Attendees   []string // addresses
+}
+
+// Cancelled reports whether the event is called off, by the calendar's
+// method or its own status
+func (c *Calendar) Cancelled(e *Event) bool {
+	return c.Method == "CANCEL" || e.Status == "CANCELLED"
+}
+
+// conferenceProps are the vendor properties carrying a video call link, in
+// order of preference
+var conferenceProps = []string{
+	"X-GOOGLE-CONFERENCE",
+	"X-MICROSOFT-SKYPETEAMSMEETINGURL",
+	"X-MICROSOFT-ONLINEMEETINGEXTERNALLINK",
+}
+
+// property is a content line: NAME;PARAM=value:VALUE
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads a calendar. Events without a start are skipped; a calendar
+// with none left is still returned, so cancellations without times can be
+// told apart from data that isn't a calendar.
+func Parse(data []byte) (*Calendar, error) {
+	var (
+		cal     *Calendar
+		stack   []string
+		event   map[string][]property
+		zones   = map[string]*zone{}
+		tz      *zone
+		tzID    string
+		rule    *transition
+		clock   time.Duration // of the transition, from its DTSTART
+		offset  int
+		isDST   bool
+		inRule  bool
+		results []map[string][]property
+	)
+	for _, line := range unfold(string(data)) {
+		p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch p.name {
+		case "BEGIN":
+			comp := strings.ToUpper(p.value)
+			stack = append(stack, comp)
+			switch comp {
+			case "VCALENDAR":
+				if cal == nil {
+					cal = &Calendar{}
+				}
+			case "VEVENT":
+				event = map[string][]property{}
+			case "VTIMEZONE":
+				tz, tzID = &zone{}, ""
+			case "STANDARD", "DAYLIGHT":
+				rule, clock, offset, isDST, inRule = nil, 0, 0, comp == "DAYLIGHT", true
+			}
+			continue
+		case "END":
+			comp := strings.ToUpper(p.value)
+			if n := len(stack); n > 0 && stack[n-1] == comp {
+				stack = stack[:n-1]
+			}
+			switch comp {
+			case "VEVENT":
+				if event != nil && len(results) < maxEvents {
+					results = append(results, event)
+				}
+				event = nil
+			case "VTIMEZONE":
+				if tz != nil && tzID != "" {
+					zones[tzID] = tz
+				}
+				tz = nil
+			case "STANDARD", "DAYLIGHT":
+				if rule != nil {
+					rule.clock = clock
+				}
+				if tz != nil {
+					if isDST {
+						tz.dst, tz.dstStart = offset, rule
+					} else {
+						tz.std, tz.stdStart = offset, rule
+					}
+				}
+				inRule = false
+			}
+			continue
+		}
+
+		switch {
+		case inRule && tz != nil:
+			switch p.name {
+			case "TZOFFSETTO":
+				offset, _ = parseOffset(p.value)
+			case "DTSTART":
+				if t, err := time.Parse("20060102T150405", p.value); err == nil {
+					clock = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+				}
+			case "RRULE":
+				rule = parseYearlyRule(p.value)
+			}
+		case tz != nil && p.name == "TZID":
+			tzID = p.value
+		case event != nil && len(stack) > 0 && stack[len(stack)-1] == "VEVENT":
+			event[p.name] = append(event[p.name], p)
+		case cal != nil && len(stack) == 1 && p.name == "METHOD":
+			cal.Method = strings.ToUpper(p.value)
+		}
+	}
+	if cal == nil {
+		return nil, ErrNotCalendar
+	}
+
+	for _, props := range results {
+		if e, ok := buildEvent(props, zones); ok {
+			cal.Events = append(cal.Events, e)
+		}
+	}
+	return cal, nil
+}
+
+// buildEvent reads an event's properties; false if it has no start
+func buildEvent(props map[string][]property, zones map[string]*zone) (Event, bool) {
+	first := func(name string) *property {
+		if list := props[name]; len(list) > 0 {
+			return &list[0]
+		}
+		return nil
+	}
+	text := func(name string) string {
+		if p := first(name); p != nil {
+			return unescape(p.value)
+		}
+		return ""
+	}
+
+	start := first("DTSTART")
+	if start == nil {
+		return Event{}, false
+	}
+	e := Event{
+		UID:         text("UID"),
+		Status:      strings.ToUpper(text("STATUS")),
+		Summary:     text("SUMMARY"),
+		Description: text("DESCRIPTION"),
+		Location:    text("LOCATION"),
+		Recurring:   first("RRULE") != nil || first("RDATE") != nil,
+		Organizer:   address(text("ORGANIZER")),
+		Attendees:   []string{},
+	}
+	e.Sequence, _ = strconv.Atoi(text("SEQUENCE"))
+
+	var err error
+	if e.Start, e.AllDay, err = parseTime(start, zones); err != nil {
+		return Event{}, false
+	}
+	switch {
+	case first("DTEND") != nil:
+		if e.End, _, err = parseTime(first("DTEND"), zones); err != nil || e.End.Before(e.Start) {
+			e.End = e.Start
+		}
+	case first("DURATION") != nil:
+		if d, ok := parseDuration(text("DURATION")); ok {
+			e.End = e.Start.Add(d)
+		} else {
+			e.End = e.Start
+		}
+	case e.AllDay:
+		e.End = e.Start.AddDate(0, 0, 1)
+	default:
+		e.End = e.Start
+	}
+
+	for _, name := range conferenceProps {
+		if v := text(name); strings.HasPrefix(v, "https://") {
+			e.Conference = v
+			break
+		}
+	}
+	if e.Conference == "" {
+		for _, v := range []string{text("URL"), e.Location} {
+			if strings.HasPrefix(v, "https://") && !strings.ContainsAny(v, " \n") {
+				e.Conference = v
+				break
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, p := range props["ATTENDEE"] {
+		if a := address(p.value); a != "" && !seen[a] {
+			seen[a] = true
+			e.Attendees = append(e.Attendees, a)
+		}
+	}
+	return e, true
+}
+
+// unfold joins folded content lines (a line break followed by a space or
+// tab continues the line)
+func unfold(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\n ", "")
+	s = strings.ReplaceAll(s, "\n\t", "")
+	return strings.Split(s, "\n")
+}
+
+// parseLine splits a content line into name, parameters and value
+func parseLine(line string) (property, bool) {
+	line = strings.TrimRight(line, "\r")
+	colon, quoted := -1, false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return property{}, false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	p := property{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		if k, v, ok := strings.Cut(param, "="); ok {
+			p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return p, true
+}
+
+// parseTime reads a DATE or DATE-TIME value, in its TZID if it has one
+func parseTime(p *property, zones map[string]*zone) (time.Time, bool, error) {
+	v := strings.TrimSpace(p.value)
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(v) == 8 {
+		t, err := time.Parse("20060102", v)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+	t, err := time.Parse("20060102T150405", v)
+	if err != nil {
+		return t, false, err
+	}
+	id := p.params["TZID"]
+	if id == "" {
+		return t, false, nil
+	}
+	if loc, err := time.LoadLocation(strings.TrimPrefix(id, "/")); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), false, nil
+	}
+	if z, ok := zones[id]; ok {
+		// Zones named outside the zone database (Outlook's "W. Europe
+		// Standard Time") are defined by the calendar's VTIMEZONE
+		offset := z.offsetAt(t)
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone(id, offset)), false, nil
+	}
+	return t, false, nil
+}
+
+// parseDuration reads a duration such as PT1H30M, P1D or P2W
+func parseDuration(v string) (time.Duration, bool) {
+	v = strings.TrimPrefix(strings.ToUpper(v), "+")
+	if !strings.HasPrefix(v, "P") {
+		return 0, false
+	}
+	var (
+		d      time.Duration
+		n      int
+		digits bool
+	)
+	for _, r := range v[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			n, digits = n*10+int(r-'0'), true
+			continue
+		case r == 'T':
+			continue
+		}
+		if !digits {
+			return 0, false
+		}
+		switch r {
+		case 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case 'H':
+			d += time.Duration(n) * time.Hour
+		case 'M':
+			d += time.Duration(n) * time.Minute
+		case 'S':
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, false
+		}
+		n, digits = 0, false
+	}
+	return d, d > 0
+}
+
+// unescape undoes TEXT value escaping
+func unescape(v string) string {
+	if !strings.Contains(v, `\`) {
+		return strings.TrimSpace(v)
+	}
+	r := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return strings.TrimSpace(r.Replace(v))
+}
+
+// address returns the lowercased address of a mailto: calendar user
+func address(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 7 && strings.EqualFold(v[:7], "mailto:") {
+		v = v[7:]
+	}
+	if !strings.Contains(v, "@") {
+		return ""
+	}
+	return strings.ToLower(v)
+}
+
+// zone is a VTIMEZONE: standard and daylight offsets (seconds east of UTC)
+// and when each starts
+type zone struct {
+	std, dst           int
+	stdStart, dstStart *transition
+}
+
+// transition is a yearly change of offset, e.g. the last Sunday of March at
+// 02:00. week is 1-5, or -1 for the last such weekday.
+type transition struct {
+	month   time.Month
+	week    int
+	weekday time.Weekday
+	clock   time.Duration
+}
+
+// offsetAt is the zone's offset at a wall-clock time. Without both rules the
+// standard offset applies all year.
+func (z *zone) offsetAt(t time.Time) int {
+	if z.dstStart == nil || z.stdStart == nil {
+		return z.std
+	}
+	dst, std := z.dstStart.in(t.Year()), z.stdStart.in(t.Year())
+	inDST := !t.Before(dst) && t.Before(std)
+	if dst.After(std) { // southern hemisphere
+		inDST = !t.Before(dst) || t.Before(std)
+	}
+	if inDST {
+		return z.dst
+	}
+	return z.std
+}
+
+// in returns the transition's wall-clock time in year, as UTC fields
+func (tr *transition) in(year int) time.Time {
+	var day time.Time
+	if tr.week < 0 {
+		day = time.Date(year, tr.month+1, 0, 0, 0, 0, 0, time.UTC)
+		for day.Weekday() != tr.weekday {
+			day = day.AddDate(0, 0, -1)
+		}
+	} else {
+		day = time.Date(year, tr.month, 1, 0, 0, 0, 0, time.UTC)
+		for day.Weekday() != tr.weekday {
+			day = day.AddDate(0, 0, 1)
+		}
+		day = day.AddDate(0, 0, 7*(tr.week-1))
+	}
+	return day.Add(tr.clock)
+}
+
+// parseYearlyRule reads the FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU rules of
+// VTIMEZONE transitions
+func parseYearlyRule(v string) *transition {
+	tr := &transition{}
+	yearly := false
+	for _, part := range strings.Split(v, ";") {
+		k, val, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			yearly = strings.EqualFold(val, "YEARLY")
+		case "BYMONTH":
+			m, _ := strconv.Atoi(val)
+			tr.month = time.Month(m)
+		case "BYDAY":
+			if len(val) < 3 {
+				return nil
+			}
+			week, err := strconv.Atoi(val[:len(val)-2])
+			if err != nil || week == 0 || week > 5 || week < -1 {
+				return nil
+			}
+			tr.week = week
+			wd, ok := weekdays[strings.ToUpper(val[len(val)-2:])]
+			if !ok {
+				return nil
+			}
+			tr.weekday = wd
+		}
+	}
+	if !yearly || tr.month < 1 || tr.month > 12 || tr.week == 0 {
+		return nil
+	}
+	return tr
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseOffset reads a UTC offset such as +0100 or -0530, in seconds
+func parseOffset(v string) (int, bool) {
+	if len(v) < 5 || (v[0] != '+' && v[0] != '-') {
+		return 0, false
+	}
+	h, err1 := strconv.Atoi(v[1:3])
+	m, err2 := strconv.Atoi(v[3:5])
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	s := h*3600 + m*60
+	if v[0] == '-' {
+		s = -s
+	}
+	return s, true
+}
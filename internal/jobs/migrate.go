@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// columnMigrations lists columns added after the jobs table was first
+// released. schema.sql already contains them for new databases.
+var columnMigrations = []struct {
+	column string
+	decl   string
+}{
+	{"name", "TEXT"},
+	{"schedule", "TEXT"},
+	{"lease_owner", "TEXT"},
+	{"lease_until", "INTEGER"},
+}
+
+// indexMigrations are indexes on migrated columns
+var indexMigrations = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_name ON jobs(user_id, name) WHERE name IS NOT NULL`,
+	`CREATE INDEX IF NOT EXISTS idx_jobs_lease ON jobs(status, lease_until)`,
+}
+
+// migrate adds missing columns and indexes to existing databases
+func migrate(db *sql.DB) error {
+	existing := make(map[string]bool)
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('jobs')`)
+	if err != nil {
+		return fmt.Errorf("failed to read jobs columns: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read jobs columns: %w", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, m := range columnMigrations {
+		if existing[m.column] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE jobs ADD COLUMN %s %s", m.column, m.decl)); err != nil {
+			return fmt.Errorf("failed to add jobs.%s: %w", m.column, err)
+		}
+	}
+
+	for _, stmt := range indexMigrations {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+)
+
+const (
+	pollInterval       = 15 * time.Second
+	defaultMaxAttempts = 5
+	defaultTimeout     = time.Minute
+	leaseMargin        = 30 * time.Second
+)
+
+// Handler executes one job. A returned error is retried with backoff until
+// the kind's attempts run out.
+type Handler func(ctx context.Context, job Job) error
+
+// Kind describes how jobs of one kind run
+type Kind struct {
+	Handler     Handler
+	MaxAttempts int                                           // default 5
+	Timeout     time.Duration                                 // per attempt, default 1m
+	Backoff     func(attempt int) time.Duration               // default attempt² minutes
+	OnFinish    func(ctx context.Context, job Job, err error) // after success or the final failure
+}
+
+// Runner claims due jobs from the store and runs them with their kind's
+// handler. Several runners may share a store: jobs are leased to one runner
+// at a time, and a job whose runner died is picked up once its lease
+// expires.
+type Runner struct {
+	store    *Store
+	owner    string
+	kinds    map[string]Kind
+	reporter errreport.Reporter
+
+	claimMu sync.Mutex // keeps the kinds' claims from contending for the database
+}
+
+// NewRunner creates a runner that leases jobs as owner
+func NewRunner(store *Store, owner string) *Runner {
+	return &Runner{
+		store:    store,
+		owner:    owner,
+		kinds:    make(map[string]Kind),
+		reporter: errreport.Nop{},
+	}
+}
+
+// SetErrorReporter sets where permanent job failures are reported
+func (r *Runner) SetErrorReporter(reporter errreport.Reporter) {
+	if reporter != nil {
+		r.reporter = reporter
+	}
+}
+
+// Register sets the handler for a kind. Jobs of unregistered kinds stay
+// pending, so a runner only claims work it can do. Register before Run.
+func (r *Runner) Register(kind string, k Kind) {
+	if k.MaxAttempts <= 0 {
+		k.MaxAttempts = defaultMaxAttempts
+	}
+	if k.Timeout <= 0 {
+		k.Timeout = defaultTimeout
+	}
+	if k.Backoff == nil {
+		k.Backoff = func(attempt int) time.Duration {
+			return time.Duration(attempt*attempt) * time.Minute
+		}
+	}
+	r.kinds[kind] = k
+}
+
+// Kinds returns the registered kinds, sorted
+func (r *Runner) Kinds() []string {
+	kinds := make([]string, 0, len(r.kinds))
+	for name := range r.kinds {
+		kinds = append(kinds, name)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Run polls for due jobs until ctx is cancelled. Each kind has its own
+// loop, so a long job (an archive run, say) never holds up a send-later or a
+// workflow step; jobs of one kind run one at a time.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, kind := range r.Kinds() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.runKind(ctx, kind)
+		}()
+	}
+	wg.Wait()
+}
+
+// runKind polls for due jobs of one kind until ctx is cancelled
+func (r *Runner) runKind(ctx context.Context, kind string) {
+	lease := r.kinds[kind].Timeout + leaseMargin
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.runDue(ctx, kind, lease)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue executes due jobs of a kind until none are left. Each job is
+// claimed right before it runs, so its lease covers its own run rather than
+// the jobs queued ahead of it.
+func (r *Runner) runDue(ctx context.Context, kind string, lease time.Duration) {
+	for ctx.Err() == nil {
+		r.claimMu.Lock()
+		due, err := r.store.ClaimDue(ctx, r.owner, []string{kind}, time.Now(), lease, 1)
+		r.claimMu.Unlock()
+		if err != nil {
+			log.Printf("Error claiming %s jobs: %v", kind, err)
+			return
+		}
+		if len(due) == 0 {
+			return
+		}
+		r.execute(ctx, due[0])
+	}
+}
+
+// execute runs one claimed job and records the outcome
+func (r *Runner) execute(ctx context.Context, job Job) {
+	k := r.kinds[job.Kind]
+
+	jobCtx, cancel := context.WithTimeout(ctx, k.Timeout)
+	err := errreport.Catch(func() error { return k.Handler(jobCtx, job) })
+	cancel()
+
+	if err == nil {
+		if err := r.store.Complete(ctx, job); err != nil {
+			log.Printf("Error completing job %s: %v", job.ID, err)
+		}
+		if k.OnFinish != nil {
+			k.OnFinish(ctx, job, nil)
+		}
+		return
+	}
+
+	log.Printf("Job %s (%s) failed (attempt %d): %v", job.ID, job.Kind, job.Attempts, err)
+
+	var retryAt time.Time
+	if job.Attempts < k.MaxAttempts {
+		retryAt = time.Now().Add(k.Backoff(job.Attempts))
+	}
+	if err := r.store.Fail(ctx, job, err, retryAt); err != nil {
+		log.Printf("Error recording job failure %s: %v", job.ID, err)
+		if errors.Is(err, ErrLeaseLost) {
+			return
+		}
+	}
+	if !retryAt.IsZero() {
+		return
+	}
+
+	if k.OnFinish != nil {
+		k.OnFinish(ctx, job, err)
+	}
+	errreport.Report(ctx, r.reporter, errreport.Event{
+		Source: errreport.SourceRunner,
+		Err:    fmt.Errorf("job %s (%s) failed after %d attempts: %w", job.ID, job.Kind, job.Attempts, err),
+		UserID: job.UserID,
+		Tags:   map[string]string{"job_kind": job.Kind},
+	})
+}
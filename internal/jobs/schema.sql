@@ -0,0 +1,27 @@
+PRAGMA journal_mode=WAL;
+PRAGMA synchronous=NORMAL;
+PRAGMA busy_timeout=5000;
+
+-- Deferred and recurring jobs, shared across users. One-off jobs (snooze,
+-- send-later) finish as done or failed; recurring jobs (schedule set) go back
+-- to pending at their next run time. Running jobs hold a lease; a job whose
+-- lease expired (its worker died) is claimed again.
+CREATE TABLE IF NOT EXISTS jobs (
+  id                  TEXT PRIMARY KEY,
+  user_id             TEXT NOT NULL,                  -- '' for system jobs
+  kind                TEXT NOT NULL,                  -- snooze|send_later|blob_lifecycle|...
+  payload             TEXT NOT NULL,                  -- JSON, kind specific
+  run_at              INTEGER NOT NULL,
+  status              TEXT NOT NULL,                  -- pending|running|done|failed|cancelled
+  attempts            INTEGER DEFAULT 0,
+  last_error          TEXT,
+  created_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL,
+  name                TEXT,                           -- recurring jobs: unique per user
+  schedule            TEXT,                           -- recurring jobs: cron spec
+  lease_owner         TEXT,                           -- worker running the job
+  lease_until         INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(status, run_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id, status);
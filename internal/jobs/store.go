@@ -0,0 +1,340 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusDone      Status = "done"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// ErrLeaseLost is returned when finishing a job whose lease expired and was
+// claimed by another worker
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Job is a deferred or recurring unit of work
+type Job struct {
+	ID         string          `json:"id"`
+	UserID     string          `json:"user_id"`
+	Kind       string          `json:"kind"`
+	Payload    json.RawMessage `json:"payload"`
+	RunAt      time.Time       `json:"run_at"`
+	Status     Status          `json:"status"`
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"last_error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Name       string          `json:"name,omitempty"`     // recurring jobs only
+	Schedule   string          `json:"schedule,omitempty"` // recurring jobs only
+	LeaseOwner string          `json:"-"`
+}
+
+// jobColumns is the column list scanJobs reads
+const jobColumns = `id, user_id, kind, payload, run_at, status, attempts, last_error, created_at,
+	COALESCE(name, ''), COALESCE(schedule, ''), COALESCE(lease_owner, '')`
+
+// Store persists jobs in a single SQLite database so they survive restarts
+type Store struct {
+	DB *sql.DB
+}
+
+// Open opens or creates the jobs database
+func Open(dbPath string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if _, err := db.Exec(schemaSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{DB: db}, nil
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+// Enqueue schedules a job to run at runAt
+func (s *Store) Enqueue(ctx context.Context, userID, kind string, payload interface{}, runAt time.Time) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Kind:      kind,
+		Payload:   data,
+		RunAt:     runAt,
+		Status:    StatusPending,
+		CreatedAt: now,
+	}
+
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO jobs (id, user_id, kind, payload, run_at, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, userID, kind, string(data), runAt.Unix(), StatusPending, now.Unix(), now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert job: %w", err)
+	}
+
+	return job, nil
+}
+
+// EnsureRecurring registers a recurring job identified by (userID, name),
+// first running at the schedule's next time. Calling it again with the same
+// name updates the schedule and payload, so it is safe on every startup.
+func (s *Store) EnsureRecurring(ctx context.Context, userID, name, kind, schedule string, payload interface{}) (*Job, error) {
+	sched, err := ParseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	now := time.Now()
+	runAt := sched.Next(now)
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO jobs (id, user_id, kind, payload, run_at, status, created_at, updated_at, name, schedule)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, name) WHERE name IS NOT NULL DO UPDATE SET
+			kind = excluded.kind,
+			payload = excluded.payload,
+			run_at = CASE WHEN jobs.schedule IS excluded.schedule THEN jobs.run_at ELSE excluded.run_at END,
+			schedule = excluded.schedule,
+			status = CASE WHEN jobs.status = 'running' THEN jobs.status ELSE 'pending' END,
+			updated_at = excluded.updated_at
+	`, uuid.NewString(), userID, kind, string(data), runAt.Unix(), StatusPending, now.Unix(), now.Unix(), name, schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register recurring job %s: %w", name, err)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE user_id = ? AND name = ?`, userID, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job: %w", err)
+	}
+	jobs, err := scanJobs(rows)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// ClaimDue leases up to limit due jobs of the given kinds to owner until
+// now+lease and returns them. Due jobs are pending ones whose run time has
+// come and running ones whose lease expired because their worker died
+// (running jobs from before leases have none and are claimed at once).
+func (s *Store) ClaimDue(ctx context.Context, owner string, kinds []string, now time.Time, lease time.Duration, limit int) ([]Job, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{StatusPending, now.Unix(), StatusRunning, now.Unix()}
+	for _, k := range kinds {
+		args = append(args, k)
+	}
+	args = append(args, limit)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE ((status = ? AND run_at <= ?) OR (status = ? AND COALESCE(lease_until, 0) < ?))
+		  AND kind IN (?`+strings.Repeat(", ?", len(kinds)-1)+`)
+		ORDER BY run_at
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due jobs: %w", err)
+	}
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Another worker may have claimed a job since the select
+	claimed := jobs[:0]
+	for _, job := range jobs {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE jobs SET status = ?, attempts = attempts + 1, lease_owner = ?, lease_until = ?, updated_at = ?
+			WHERE id = ? AND status = ? AND COALESCE(lease_owner, '') = ?
+		`, StatusRunning, owner, now.Add(lease).Unix(), now.Unix(), job.ID, job.Status, job.LeaseOwner)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim job %s: %w", job.ID, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		job.Status = StatusRunning
+		job.Attempts++
+		job.LeaseOwner = owner
+		claimed = append(claimed, job)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit claims: %w", err)
+	}
+	return claimed, nil
+}
+
+// Complete finishes a claimed job: one-off jobs are marked done, recurring
+// ones go back to pending at their next run time
+func (s *Store) Complete(ctx context.Context, job Job) error {
+	if job.Schedule != "" {
+		return s.reschedule(ctx, job, "")
+	}
+	return s.finish(ctx, job, StatusDone, "")
+}
+
+// Fail records an error for a claimed job. The job is retried at retryAt;
+// when retryAt is zero a one-off job is marked failed and a recurring one
+// waits for its next run time.
+func (s *Store) Fail(ctx context.Context, job Job, jobErr error, retryAt time.Time) error {
+	switch {
+	case !retryAt.IsZero():
+		return s.update(ctx, job, `status = ?, run_at = ?, last_error = ?`, StatusPending, retryAt.Unix(), jobErr.Error())
+	case job.Schedule != "":
+		return s.reschedule(ctx, job, jobErr.Error())
+	default:
+		return s.finish(ctx, job, StatusFailed, jobErr.Error())
+	}
+}
+
+// reschedule returns a recurring job to pending at its next run time
+func (s *Store) reschedule(ctx context.Context, job Job, lastError string) error {
+	sched, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return s.finish(ctx, job, StatusFailed, err.Error())
+	}
+	return s.update(ctx, job, `status = ?, run_at = ?, attempts = 0, last_error = NULLIF(?, '')`,
+		StatusPending, sched.Next(time.Now()).Unix(), lastError)
+}
+
+// finish moves a claimed job to a final status
+func (s *Store) finish(ctx context.Context, job Job, status Status, lastError string) error {
+	return s.update(ctx, job, `status = ?, last_error = NULLIF(?, '')`, status, lastError)
+}
+
+// update applies set to a job the caller still holds the lease on, releasing
+// the lease
+func (s *Store) update(ctx context.Context, job Job, set string, args ...interface{}) error {
+	args = append(args, time.Now().Unix(), job.ID, job.LeaseOwner, StatusRunning)
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE jobs SET `+set+`, lease_owner = NULL, lease_until = NULL, updated_at = ?
+		WHERE id = ? AND lease_owner = ? AND status = ?
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update job %s: %w", job.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, job.ID)
+	}
+	return nil
+}
+
+// PruneFinished deletes one-off jobs that finished (done, failed or
+// cancelled) before cutoff and returns how many were removed
+func (s *Store) PruneFinished(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM jobs WHERE schedule IS NULL AND status IN (?, ?, ?) AND updated_at < ?
+	`, StatusDone, StatusFailed, StatusCancelled, cutoff.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Cancel cancels a pending job owned by userID. Returns false if no such
+// pending job exists.
+func (s *Store) Cancel(ctx context.Context, userID, id string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE jobs SET status = ?, updated_at = ?
+		WHERE id = ? AND user_id = ? AND status = ?
+	`, StatusCancelled, time.Now().Unix(), id, userID, StatusPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel job: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListPending returns a user's pending jobs, soonest first
+func (s *Store) ListPending(ctx context.Context, userID string) ([]Job, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+jobColumns+`
+		FROM jobs
+		WHERE user_id = ? AND status IN (?, ?) AND schedule IS NULL
+		ORDER BY run_at
+	`, userID, StatusPending, StatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	return scanJobs(rows)
+}
+
+// scanJobs reads job rows and closes rows
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var (
+			j         Job
+			payload   string
+			runAt     int64
+			lastError sql.NullString
+			createdAt int64
+		)
+		if err := rows.Scan(&j.ID, &j.UserID, &j.Kind, &payload, &runAt, &j.Status, &j.Attempts, &lastError, &createdAt,
+			&j.Name, &j.Schedule, &j.LeaseOwner); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		j.Payload = json.RawMessage(payload)
+		j.RunAt = time.Unix(runAt, 0)
+		j.LastError = lastError.String
+		j.CreatedAt = time.Unix(createdAt, 0)
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
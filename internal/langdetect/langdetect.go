@@ -0,0 +1,173 @@
+// Package langdetect guesses the language of short message text (a subject
+// and snippet) without a model. Non-Latin scripts identify most languages on
+// their own; Latin-script text is scored by common function words and the
+// letters particular to each language. The answer is an ISO 639-1 code, or ""
+// when the text is too short or too ambiguous to say.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minLetters is the least text worth guessing from
+const minLetters = 12
+
+// minScriptShare is the share of letters a non-Latin script needs to decide
+// the language; mail in any language is full of Latin names and addresses
+const minScriptShare = 0.3
+
+// scripts maps non-Latin scripts to their usual language. Han and kana are
+// handled separately since Japanese mixes both.
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// Detect returns the language of text, "" if unsure
+func Detect(text string) string {
+	var (
+		letters, latin, han, kana int
+		other                     = make([]int, len(scripts))
+	)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case r < 0x250 || unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		default:
+			for i, s := range scripts {
+				if unicode.Is(s.table, r) {
+					other[i]++
+					break
+				}
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// CJK text carries a lot per character, so a few are enough
+	share := func(n int) float64 { return float64(n) / float64(letters) }
+	switch {
+	case kana > 0 && share(kana+han) >= minScriptShare:
+		return "ja"
+	case han >= 4 && share(han) >= minScriptShare:
+		return "zh"
+	}
+	best := -1
+	for i, n := range other {
+		if share(n) >= minScriptShare && (best < 0 || n > other[best]) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		return refineScript(scripts[best].lang, text)
+	}
+
+	if letters < minLetters || share(latin) < 0.5 {
+		return ""
+	}
+	return detectLatin(text)
+}
+
+// refineScript tells apart languages sharing a script by their own letters
+func refineScript(lang, text string) string {
+	switch lang {
+	case "ru":
+		if strings.ContainsAny(text, "іїєґІЇЄҐ") {
+			return "uk"
+		}
+	case "ar":
+		if strings.ContainsAny(text, "پچژگی") {
+			return "fa"
+		}
+	}
+	return lang
+}
+
+// latin holds, per language, frequent short words and the letters that
+// mostly occur in it
+var latin = []struct {
+	lang    string
+	words   map[string]bool
+	letters string
+}{
+	{"en", set("the and to of is you for your in on with this that are be have will we it our not please thanks can from"), ""},
+	{"es", set("el la de que y en los las por para con una un es del se no su al como gracias hola saludos"), "ñ¿¡"},
+	{"fr", set("le la les de des et est un une pour que dans vous nous pas sur au avec ce merci bonjour du"), "çœèêàù"},
+	{"de", set("der die das und ist ich sie nicht mit den ein eine zu auf für von wir ihr bitte danke grüße im"), "ßäöü"},
+	{"it", set("il di che la e per un una non sono con del della le gli grazie ciao alla nel questo"), "ìò"},
+	{"pt", set("o a de que e do da em um uma para com não os as por obrigado olá você no na"), "ãõç"},
+	{"nl", set("de het een en van is dat niet op te met voor zijn ik je wij bedankt groeten"), "ĳ"},
+	{"sv", set("och att det som en är på för med inte jag du vi av till hej tack"), "åäö"},
+	{"pl", set("i w nie na się że do jest z to o jak dla dziękuję pozdrawiam"), "łąęśżźćń"},
+	{"tr", set("ve bir bu da de için ile ne çok var mı teşekkürler merhaba"), "ğşı"},
+}
+
+func set(words string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		m[w] = true
+	}
+	return m
+}
+
+// detectLatin scores each language by function words (1 each) and its own
+// letters (2 each, at most 3 counted) and returns the clear winner
+func detectLatin(text string) string {
+	text = strings.ToLower(text)
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) })
+
+	scores := make([]int, len(latin))
+	for i, l := range latin {
+		for _, w := range words {
+			if l.words[w] {
+				scores[i]++
+			}
+		}
+		if l.letters != "" {
+			n := 0
+			for _, r := range text {
+				if strings.ContainsRune(l.letters, r) {
+					n++
+				}
+			}
+			scores[i] += 2 * min(n, 3)
+		}
+	}
+
+	best, second := -1, 0
+	for i, s := range scores {
+		switch {
+		case best < 0 || s > scores[best]:
+			if best >= 0 {
+				second = scores[best]
+			}
+			best = i
+		case s > second:
+			second = s
+		}
+	}
+	// Two hits at least, and ahead of the runner-up
+	if scores[best] < 2 || scores[best] == second {
+		return ""
+	}
+	return latin[best].lang
+}
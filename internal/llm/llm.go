@@ -0,0 +1,88 @@
+// Package llm is the abstraction over the language models the service calls:
+// chat completions for planning and answering questions about the user's mail,
+// and embeddings for semantic search. The OpenAI implementation speaks the
+// OpenAI HTTP API, which most hosted and self-hosted model servers (Azure,
+// vLLM, Ollama, LiteLLM) also accept.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrNoEmbeddings is returned by Embed when no embedding model is configured
+var ErrNoEmbeddings = errors.New("no embedding model configured")
+
+// Message is one turn of a chat
+type Message struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// Request is a chat completion request
+type Request struct {
+	Messages  []Message
+	JSON      bool // ask for a single JSON object
+	MaxTokens int  // 0 leaves the model's default
+}
+
+// Client calls a language model
+type Client interface {
+	// Complete returns the model's reply to a chat
+	Complete(ctx context.Context, req Request) (string, error)
+
+	// Embed returns one vector per text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+
+	// EmbeddingModel names the model Embed uses, so vectors from different
+	// models are never compared ("" if embeddings are off)
+	EmbeddingModel() string
+}
+
+// StatusError is a non-2xx response from the model server
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("llm: HTTP %d: %s", e.Status, e.Body)
+}
+
+// Cosine returns the cosine similarity of two vectors, 0 if their lengths
+// differ or either is zero
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// DecodeJSON decodes a JSON reply, tolerating the Markdown code fence some
+// models wrap it in
+func DecodeJSON(reply string, v any) error {
+	reply = strings.TrimSpace(reply)
+	if strings.HasPrefix(reply, "```") {
+		reply = strings.TrimPrefix(reply, "```json")
+		reply = strings.TrimPrefix(reply, "```")
+		reply = strings.TrimSuffix(strings.TrimSpace(reply), "```")
+	}
+	if err := json.Unmarshal([]byte(reply), v); err != nil {
+		return fmt.Errorf("llm: invalid JSON reply: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults for Config
+const (
+	DefaultBaseURL        = "https://api.openai.com/v1"
+	DefaultModel          = "gpt-4o-mini"
+	DefaultEmbeddingModel = "text-embedding-3-small"
+	DefaultTimeout        = 60 * time.Second
+)
+
+// maxEmbedBatch is the most texts sent in one embeddings request
+const maxEmbedBatch = 96
+
+// Config configures an OpenAI-compatible client
+type Config struct {
+	BaseURL        string // e.g. https://api.openai.com/v1
+	APIKey         string // sent as a bearer token when set
+	Model          string // chat model
+	EmbeddingModel string // "" turns embeddings off
+	Timeout        time.Duration
+}
+
+// OpenAI is a Client for the OpenAI chat completions and embeddings APIs
+type OpenAI struct {
+	cfg    Config
+	client *http.Client
+}
+
+// NewOpenAI creates a client. Empty BaseURL, Model and Timeout get the
+// defaults.
+func NewOpenAI(cfg Config) *OpenAI {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &OpenAI{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Model returns the chat model
+func (o *OpenAI) Model() string {
+	return o.cfg.Model
+}
+
+// EmbeddingModel returns the embedding model, "" if embeddings are off
+func (o *OpenAI) EmbeddingModel() string {
+	return o.cfg.EmbeddingModel
+}
+
+// Complete returns the model's reply to a chat. Sampling is deterministic
+// (temperature 0) since answers are about stored mail, not creative.
+func (o *OpenAI) Complete(ctx context.Context, req Request) (string, error) {
+	body := map[string]any{
+		"model":       o.cfg.Model,
+		"messages":    req.Messages,
+		"temperature": 0,
+	}
+	if req.JSON {
+		body["response_format"] = map[string]string{"type": "json_object"}
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message Message `json:"message"`
+		} `json:"choices"`
+	}
+	if err := o.post(ctx, "/chat/completions", body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("llm: completion returned no choices")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// Embed returns one vector per text, batching large inputs
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if o.cfg.EmbeddingModel == "" {
+		return nil, ErrNoEmbeddings
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbedBatch {
+		batch := texts[start:min(start+maxEmbedBatch, len(texts))]
+
+		var resp struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			} `json:"data"`
+		}
+		body := map[string]any{"model": o.cfg.EmbeddingModel, "input": batch}
+		if err := o.post(ctx, "/embeddings", body, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Data) != len(batch) {
+			return nil, fmt.Errorf("llm: got %d embeddings for %d texts", len(resp.Data), len(batch))
+		}
+
+		out := make([][]float32, len(batch))
+		for _, d := range resp.Data {
+			if d.Index < 0 || d.Index >= len(batch) {
+				return nil, fmt.Errorf("llm: embedding index %d out of range", d.Index)
+			}
+			out[d.Index] = d.Embedding
+		}
+		vectors = append(vectors, out...)
+	}
+	return vectors, nil
+}
+
+// post sends a JSON request to path and decodes the response into out
+func (o *OpenAI) post(ctx context.Context, path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.cfg.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.cfg.APIKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("llm request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read llm response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := strings.TrimSpace(string(respBody))
+		if len(msg) > 500 {
+			msg = strings.ToValidUTF8(msg[:500], "")
+		}
+		return &StatusError{Status: resp.StatusCode, Body: msg}
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode llm response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package natsjs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+)
+
+// Handler processes a delivered event. ctx carries the trace context the
+// publisher attached to the message.
+type Handler func(ctx context.Context, msg *nats.Msg) error
+
+// Consume binds a durable JetStream consumer on the USER_EVENTS stream and
+// calls handler for each message matching subject. Messages are acked when
+// handler returns nil and redelivered (nak) otherwise; a panicking handler is
+// recovered, reported and treated as an error. opts are added to the
+// subscription (nats.MaxAckPending(1) for in-order processing). The
+// subscription ends when ctx is cancelled. The stream is created if it
+// doesn't exist yet (a fresh server).
+func (p *Publisher) Consume(ctx context.Context, subject, durable string, handler Handler, opts ...nats.SubOpt) error {
+	if err := p.EnsureStream(ctx); err != nil {
+		return err
+	}
+
+	sub, err := p.js.Subscribe(subject, func(msg *nats.Msg) {
+		msgCtx := ContextFromMsg(ctx, msg)
+		err := errreport.Catch(func() error { return handler(msgCtx, msg) })
+		var panicErr *errreport.PanicError
+		if errors.As(err, &panicErr) {
+			log.Printf("Panic handling %s: %v\n%s", msg.Subject, panicErr.Value, panicErr.Stack)
+			errreport.Report(msgCtx, p.reporter, errreport.Event{
+				Err:  err,
+				Tags: map[string]string{"subject": msg.Subject, "consumer": durable},
+			})
+		}
+		if err != nil {
+			log.Printf("Error handling %s: %v", msg.Subject, err)
+			_ = msg.Nak()
+			return
+		}
+		_ = msg.Ack()
+	}, append([]nats.SubOpt{nats.BindStream("USER_EVENTS"), nats.Durable(durable), nats.ManualAck(), nats.DeliverAll()}, opts...)...)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = sub.Drain()
+	}()
+	return nil
+}
+
+// DeleteConsumer deletes a durable consumer on the USER_EVENTS stream, so
+// the next Consume with that name starts again from the first event
+func (p *Publisher) DeleteConsumer(durable string) error {
+	err := p.js.DeleteConsumer("USER_EVENTS", durable)
+	if err != nil && !errors.Is(err, nats.ErrConsumerNotFound) {
+		return fmt.Errorf("failed to delete consumer %s: %w", durable, err)
+	}
+	return nil
+}
+
+// Subscribe calls fn for each plain NATS message on subject, such as the
+// operational notifications sent with PublishCore. Nothing is persisted, so
+// messages sent while disconnected are lost. The subscription ends when ctx
+// is cancelled.
+func (p *Publisher) Subscribe(ctx context.Context, subject string, fn func(ctx context.Context, msg *nats.Msg)) error {
+	sub, err := p.nc.Subscribe(subject, func(msg *nats.Msg) {
+		fn(ContextFromMsg(ctx, msg), msg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = sub.Unsubscribe()
+	}()
+	return nil
+}
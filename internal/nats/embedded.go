@@ -0,0 +1,34 @@
+package natsjs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ErrEmbeddedUnavailable is returned by StartEmbedded in binaries built
+// with the no_embedded_nats tag
+var ErrEmbeddedUnavailable = errors.New("built without the embedded NATS server (no_embedded_nats)")
+
+// EmbeddedConfig configures the in-process NATS server
+type EmbeddedConfig struct {
+	Dir    string // JetStream storage directory
+	Listen string // host:port for clients; port 0 picks a free one
+}
+
+// hostPort splits Listen, mapping port 0 to nats-server's random port (-1)
+func (c EmbeddedConfig) hostPort() (string, int, error) {
+	host, portStr, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid listen address %q: %w", c.Listen, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid listen port %q", portStr)
+	}
+	if port == 0 {
+		port = -1
+	}
+	return host, port, nil
+}
@@ -0,0 +1,59 @@
+//go:build !no_embedded_nats
+
+package natsjs
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// EmbeddedServer is a nats-server with JetStream running inside this process,
+// for single-binary installs without a NATS deployment
+type EmbeddedServer struct {
+	ns *server.Server
+}
+
+// StartEmbedded starts the embedded server and waits until it accepts
+// clients
+func StartEmbedded(cfg EmbeddedConfig) (*EmbeddedServer, error) {
+	host, port, err := cfg.hostPort()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "ai-brain-embedded",
+		Host:       host,
+		Port:       port,
+		JetStream:  true,
+		StoreDir:   cfg.Dir,
+		NoSigs:     true, // the process handles its own signals
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure embedded NATS: %w", err)
+	}
+
+	go ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("embedded NATS didn't start listening on %s", cfg.Listen)
+	}
+	return &EmbeddedServer{ns: ns}, nil
+}
+
+// URL is the client URL of the server
+func (s *EmbeddedServer) URL() string {
+	return s.ns.ClientURL()
+}
+
+// Shutdown stops the server, flushing JetStream state to disk
+func (s *EmbeddedServer) Shutdown() {
+	s.ns.Shutdown()
+	s.ns.WaitForShutdown()
+}
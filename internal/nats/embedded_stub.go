@@ -0,0 +1,20 @@
+//go:build no_embedded_nats
+
+package natsjs
+
+// EmbeddedServer is left out by the no_embedded_nats tag
+type EmbeddedServer struct{}
+
+// StartEmbedded fails: this binary doesn't include the server
+func StartEmbedded(cfg EmbeddedConfig) (*EmbeddedServer, error) {
+	if _, _, err := cfg.hostPort(); err != nil {
+		return nil, err
+	}
+	return nil, ErrEmbeddedUnavailable
+}
+
+// URL is empty
+func (s *EmbeddedServer) URL() string { return "" }
+
+// Shutdown does nothing
+func (s *EmbeddedServer) Shutdown() {}
@@ -2,21 +2,46 @@ package natsjs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/chaos"
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
 )
 
 // Publisher wraps NATS JetStream for publishing events
 type Publisher struct {
-	nc *nats.Conn
-	js nats.JetStreamContext
+	nc          *nats.Conn
+	js          nats.JetStreamContext
+	streamReady atomic.Bool        // USER_EVENTS is known to exist
+	reporter    errreport.Reporter // receives consumer handler panics
+
+	tenants     Tenants    // nil unless per-org isolation is on
+	orgStreams  sync.Map   // org ids whose stream is known to be provisioned
+	provisionMu sync.Mutex // serializes org stream provisioning
 }
 
-// NewPublisher creates a new NATS JetStream publisher
+// NewPublisher creates a new NATS JetStream publisher. It fails if the server
+// can't be reached.
 func NewPublisher(url string) (*Publisher, error) {
-	nc, err := nats.Connect(url)
+	return newPublisher(url)
+}
+
+// NewLazyPublisher creates a publisher that returns immediately even if the
+// server is down, connecting (and reconnecting) in the background forever.
+// Publishes fail until the connection is up, so events wait in the outbox.
+func NewLazyPublisher(url string) (*Publisher, error) {
+	return newPublisher(url, nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+}
+
+func newPublisher(url string, opts ...nats.Option) (*Publisher, error) {
+	nc, err := nats.Connect(url, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
@@ -30,47 +55,185 @@ func NewPublisher(url string) (*Publisher, error) {
 	return &Publisher{nc: nc, js: js}, nil
 }
 
-// EnsureStream ensures the USER_EVENTS stream exists
+// EnsureStream ensures the USER_EVENTS stream exists. Once it has succeeded
+// it returns immediately.
 func (p *Publisher) EnsureStream(ctx context.Context) error {
+	if p.streamReady.Load() {
+		return nil
+	}
+
 	// Check if stream exists
 	streamInfo, err := p.js.StreamInfo("USER_EVENTS")
 	if err == nil && streamInfo != nil {
+		p.streamReady.Store(true)
 		return nil // Stream already exists
 	}
 
 	// Create stream
-	_, err = p.js.AddStream(&nats.StreamConfig{
-		Name:       "USER_EVENTS",
-		Subjects:   []string{"user.*.>"},
-		Storage:    nats.FileStorage,
-		Retention:  nats.LimitsPolicy,
-		Duplicates: 10 * time.Minute,
-		MaxAge:     30 * 24 * time.Hour, // Keep events for 30 days
-	})
+	_, err = p.js.AddStream(streamConfig("USER_EVENTS", "user.*.>"))
 
 	if err != nil {
 		// Check if error is "stream name already in use"
 		if err.Error() == "stream name already in use" || err == nats.ErrStreamNameAlreadyInUse {
+			p.streamReady.Store(true)
 			return nil
 		}
 		return fmt.Errorf("failed to create stream: %w", err)
 	}
 
+	p.streamReady.Store(true)
 	return nil
 }
 
-// Publish publishes a message to NATS JetStream with deduplication
-func (p *Publisher) Publish(subject string, payload []byte, msgID string) error {
-	_, err := p.js.Publish(subject, payload, nats.MsgId(msgID))
+// streamConfig is the configuration of USER_EVENTS and the org streams
+func streamConfig(name, subjects string) *nats.StreamConfig {
+	return &nats.StreamConfig{
+		Name:        name,
+		Subjects:    []string{subjects},
+		Storage:     nats.FileStorage,
+		Retention:   nats.LimitsPolicy,
+		Duplicates:  10 * time.Minute,
+		MaxAge:      30 * 24 * time.Hour, // Keep events for 30 days
+		AllowDirect: true,                // for CheckPublished
+	}
+}
+
+// Publish publishes a message to NATS JetStream with deduplication. The
+// trace context in ctx is sent as W3C traceparent/tracestate headers. With
+// tenancy on, user events go to their org's subjects (see SetTenants).
+func (p *Publisher) Publish(ctx context.Context, subject string, payload []byte, msgID string) error {
+	_, err := p.PublishAck(ctx, subject, payload, msgID)
+	return err
+}
+
+// PubAck is where JetStream stored a published message. A duplicate's
+// sequence is the one of the message it duplicates.
+type PubAck struct {
+	Stream    string
+	Sequence  uint64
+	Duplicate bool
+}
+
+// PublishAck is Publish returning JetStream's acknowledgment
+func (p *Publisher) PublishAck(ctx context.Context, subject string, payload []byte, msgID string) (*PubAck, error) {
+	if err := chaos.Inject(ctx, chaos.NATSPublish); err != nil {
+		return nil, fmt.Errorf("failed to publish message: %w", err)
+	}
+	subject, err := p.routeSubject(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	msg := &nats.Msg{Subject: subject, Data: payload, Header: nats.Header{}}
+	traceContext.Inject(ctx, headerCarrier(msg.Header))
+
+	ack, err := p.js.PublishMsg(msg, nats.MsgId(msgID))
 	if err != nil {
+		return nil, fmt.Errorf("failed to publish message: %w", err)
+	}
+	return &PubAck{Stream: ack.Stream, Sequence: ack.Sequence, Duplicate: ack.Duplicate}, nil
+}
+
+// Outcomes of CheckPublished
+const (
+	PublishFound    = "found"    // the stream has the message at its sequence
+	PublishMissing  = "missing"  // nothing is stored at the sequence
+	PublishMismatch = "mismatch" // another message is stored at the sequence
+)
+
+// CheckPublished looks up the message stored at seq in stream and compares
+// its Nats-Msg-Id header with msgID, to catch acknowledged publishes the
+// stream lost. It uses a direct get where the stream allows one.
+func (p *Publisher) CheckPublished(ctx context.Context, stream string, seq uint64, msgID string) (string, error) {
+	msg, err := p.js.GetMsg(stream, seq, nats.DirectGet(), nats.Context(ctx))
+	if err != nil && !errors.Is(err, nats.ErrMsgNotFound) {
+		// Streams created without allow_direct only answer the API get
+		msg, err = p.js.GetMsg(stream, seq, nats.Context(ctx))
+	}
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return PublishMissing, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get message %d from %s: %w", seq, stream, err)
+	}
+	if msg.Header.Get(nats.MsgIdHdr) != msgID {
+		return PublishMismatch, nil
+	}
+	return PublishFound, nil
+}
+
+// PublishCore publishes a fire-and-forget message on plain NATS, outside
+// JetStream. Use it for operational messages that shouldn't be persisted.
+func (p *Publisher) PublishCore(ctx context.Context, subject string, payload []byte) error {
+	msg := &nats.Msg{Subject: subject, Data: payload, Header: nats.Header{}}
+	traceContext.Inject(ctx, headerCarrier(msg.Header))
+
+	if err := p.nc.PublishMsg(msg); err != nil {
 		return fmt.Errorf("failed to publish message: %w", err)
 	}
 	return nil
 }
 
+// SetErrorReporter sets where panics in Consume handlers are reported
+func (p *Publisher) SetErrorReporter(r errreport.Reporter) {
+	p.reporter = r
+}
+
+// ConnStatus describes the NATS connection
+type ConnStatus struct {
+	State        string `json:"state"` // connected, reconnecting, closed, ...
+	URL          string `json:"url,omitempty"`
+	PendingBytes int    `json:"pending_bytes"` // buffered while disconnected
+	Reconnects   uint64 `json:"reconnects"`
+}
+
+// Status reports the connection state without any network I/O
+func (p *Publisher) Status() ConnStatus {
+	st := ConnStatus{
+		State:      strings.ToLower(p.nc.Status().String()),
+		URL:        p.nc.ConnectedUrlRedacted(),
+		Reconnects: p.nc.Stats().Reconnects,
+	}
+	if n, err := p.nc.Buffered(); err == nil {
+		st.PendingBytes = n
+	}
+	return st
+}
+
+// Ping round-trips to the server, returning the latency
+func (p *Publisher) Ping(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	if err := p.nc.FlushWithContext(ctx); err != nil {
+		return 0, fmt.Errorf("nats ping: %w", err)
+	}
+	return time.Since(start), nil
+}
+
 // Close closes the NATS connection
 func (p *Publisher) Close() {
 	if p.nc != nil {
 		p.nc.Close()
 	}
 }
+
+// KeyValue returns a JetStream key-value bucket, creating it if needed. Keys
+// not rewritten within ttl expire (0 keeps them).
+func (p *Publisher) KeyValue(bucket string, ttl time.Duration) (nats.KeyValue, error) {
+	kv, err := p.js.KeyValue(bucket)
+	if err == nil {
+		return kv, nil
+	}
+	if !errors.Is(err, nats.ErrBucketNotFound) {
+		return nil, fmt.Errorf("failed to open bucket %s: %w", bucket, err)
+	}
+
+	kv, err = p.js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:  bucket,
+		TTL:     ttl,
+		Storage: nats.MemoryStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+	}
+	return kv, nil
+}
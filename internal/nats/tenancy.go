@@ -0,0 +1,158 @@
+package natsjs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Tenants maps users to the org whose subjects and stream receive their
+// events; *tenant.Store implements it
+type Tenants interface {
+	OrgFor(ctx context.Context, userID string) (string, error)
+}
+
+// SetTenants turns on per-org isolation. Events of a user in an org are
+// published as org.{org_id}.user.{user_id}.{type} into the org's own stream
+// (OrgStream), which is created on first use, so credentials limited to that
+// stream and subject prefix only ever see the org's events. USER_EVENTS
+// sources every org stream with the prefix stripped, so internal consumers
+// (projections) keep reading user.{user_id}.{type} for all users. Users
+// without an org stay on user.{user_id}.{type}. Set before publishing.
+func (p *Publisher) SetTenants(t Tenants) {
+	p.tenants = t
+}
+
+// OrgStream names an org's stream
+func OrgStream(orgID string) string {
+	return "ORG_" + orgID
+}
+
+// OrgSubjects is the subject filter of an org's events
+func OrgSubjects(orgID string) string {
+	return "org." + orgID + ".>"
+}
+
+// routeSubject returns the subject a user event is published on: prefixed
+// with the user's org when tenancy is on and they have one
+func (p *Publisher) routeSubject(ctx context.Context, subject string) (string, error) {
+	if p.tenants == nil {
+		return subject, nil
+	}
+	rest, ok := strings.CutPrefix(subject, "user.")
+	if !ok {
+		return subject, nil
+	}
+	userID, _, _ := strings.Cut(rest, ".")
+
+	orgID, err := p.tenants.OrgFor(ctx, userID)
+	if err != nil || orgID == "" {
+		return subject, err
+	}
+	if err := p.ensureOrgStream(ctx, orgID); err != nil {
+		return "", err
+	}
+	return "org." + orgID + "." + subject, nil
+}
+
+// ensureOrgStream creates an org's stream and adds it to the sources of
+// USER_EVENTS. Once it has succeeded for an org it returns immediately.
+func (p *Publisher) ensureOrgStream(ctx context.Context, orgID string) error {
+	if _, ok := p.orgStreams.Load(orgID); ok {
+		return nil
+	}
+	p.provisionMu.Lock()
+	defer p.provisionMu.Unlock()
+	if _, ok := p.orgStreams.Load(orgID); ok {
+		return nil
+	}
+
+	if err := p.EnsureStream(ctx); err != nil {
+		return err
+	}
+
+	name := OrgStream(orgID)
+	_, err := p.js.StreamInfo(name, nats.Context(ctx))
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = p.js.AddStream(streamConfig(name, OrgSubjects(orgID)), nats.Context(ctx))
+		if errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", name, err)
+	}
+
+	if err := p.sourceOrgStream(ctx, orgID); err != nil {
+		return err
+	}
+	p.orgStreams.Store(orgID, true)
+	return nil
+}
+
+// sourceOrgStream adds an org's stream to the sources of USER_EVENTS,
+// mapping org.{org_id}.user.> back to user.>. The update replaces the whole
+// config, so it is checked afterwards and retried if another process's
+// update won.
+func (p *Publisher) sourceOrgStream(ctx context.Context, orgID string) error {
+	name := OrgStream(orgID)
+	for attempt := 0; ; attempt++ {
+		info, err := p.js.StreamInfo("USER_EVENTS", nats.Context(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to read stream USER_EVENTS: %w", err)
+		}
+		for _, src := range info.Config.Sources {
+			if src.Name == name {
+				return nil
+			}
+		}
+		if attempt == 3 {
+			return fmt.Errorf("failed to add source %s to USER_EVENTS: concurrent updates", name)
+		}
+
+		cfg := info.Config
+		cfg.Sources = append(cfg.Sources, &nats.StreamSource{
+			Name: name,
+			SubjectTransforms: []nats.SubjectTransformConfig{
+				{Source: "org." + orgID + ".user.>", Destination: "user.>"},
+			},
+		})
+		if _, err := p.js.UpdateStream(&cfg, nats.Context(ctx)); err != nil {
+			return fmt.Errorf("failed to add source %s to USER_EVENTS: %w", name, err)
+		}
+	}
+}
+
+// PurgeUser deletes a user's events from USER_EVENTS and, with tenancy on,
+// from their org's stream
+func (p *Publisher) PurgeUser(ctx context.Context, userID string) error {
+	if userID == "" || strings.ContainsAny(userID, ".*> ") {
+		return fmt.Errorf("invalid user id %q", userID)
+	}
+	if err := p.EnsureStream(ctx); err != nil {
+		return err
+	}
+
+	subject := "user." + userID + ".>"
+	if err := p.js.PurgeStream("USER_EVENTS", &nats.StreamPurgeRequest{Subject: subject}); err != nil {
+		return fmt.Errorf("failed to purge %s: %w", subject, err)
+	}
+
+	if p.tenants == nil {
+		return nil
+	}
+	orgID, err := p.tenants.OrgFor(ctx, userID)
+	if err != nil || orgID == "" {
+		return err
+	}
+	name := OrgStream(orgID)
+	subject = "org." + orgID + "." + subject
+	err = p.js.PurgeStream(name, &nats.StreamPurgeRequest{Subject: subject})
+	if err != nil && !errors.Is(err, nats.ErrStreamNotFound) {
+		return fmt.Errorf("failed to purge %s: %w", subject, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package natsjs
+
+import (
+	"context"
+	"crypto/rand"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceContext reads and writes W3C traceparent/tracestate headers
+var traceContext = propagation.TraceContext{}
+
+// headerCarrier adapts NATS message headers to the propagation API
+type headerCarrier nats.Header
+
+func (h headerCarrier) Get(key string) string {
+	return nats.Header(h).Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	nats.Header(h).Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// mapCarrier holds a single traceparent value
+type mapCarrier map[string]string
+
+func (m mapCarrier) Get(key string) string { return m[key] }
+func (m mapCarrier) Set(key, value string) { m[key] = value }
+func (m mapCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// TraceParent returns the W3C traceparent of the span in ctx, or "" if ctx
+// carries no valid span context. Persist it with an event so the publisher
+// can continue the trace later.
+func TraceParent(ctx context.Context) string {
+	carrier := mapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier["traceparent"]
+}
+
+// WithTraceParent returns ctx with the remote span context encoded in
+// traceParent; ctx is returned unchanged if traceParent is empty or invalid
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return traceContext.Extract(ctx, mapCarrier{"traceparent": traceParent})
+}
+
+// EnsureTrace returns ctx unchanged if it already carries a span context,
+// otherwise a context with a new sampled root span context. Without an
+// OpenTelemetry SDK no spans are recorded, but the ids still tie an event's
+// log lines and NATS messages together.
+func EnsureTrace(ctx context.Context) context.Context {
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	var (
+		traceID trace.TraceID
+		spanID  trace.SpanID
+	)
+	_, _ = rand.Read(traceID[:])
+	_, _ = rand.Read(spanID[:])
+	return trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+}
+
+// ContextFromMsg returns ctx with the trace context propagated in a
+// delivered message's headers
+func ContextFromMsg(ctx context.Context, msg *nats.Msg) context.Context {
+	if msg.Header == nil {
+		return ctx
+	}
+	return traceContext.Extract(ctx, headerCarrier(msg.Header))
+}
@@ -0,0 +1,292 @@
+// Package nlquery answers natural-language questions about the user's mail
+// ("what did Alice say about the contract last week?"). The model first
+// translates the question into a plan: search operators for the structured
+// store query (see internal/search), keywords for full-text search and a
+// phrase for semantic search. Both searches run, their results are merged by
+// reciprocal rank, and the model answers from the merged messages, citing the
+// ones it used.
+package nlquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+	"github.com/Martian-dev/ai-brain-infra/internal/semantic"
+)
+
+// ErrEmptyQuestion is returned for a blank question
+var ErrEmptyQuestion = errors.New("question is required")
+
+// Limits on the sources given to the model
+const (
+	DefaultSources = 10
+	MaxSources     = 30
+)
+
+// rrfK damps reciprocal rank fusion so the top few ranks don't dominate
+const rrfK = 60
+
+// noSources is the answer when neither search finds anything
+const noSources = "I couldn't find any messages that answer this question."
+
+// Plan is the model's translation of a question into searches
+type Plan struct {
+	Filters  string `json:"filters"`  // search operators, e.g. from:alice after:2024/05/01
+	Keywords string `json:"keywords"` // words the messages must contain
+	Semantic string `json:"semantic"` // what the messages are about
+}
+
+// Citation is a message an answer draws on
+type Citation struct {
+	Ref               int     `json:"ref"` // the [n] marker in the answer
+	EventID           string  `json:"event_id"`
+	Provider          string  `json:"provider"`
+	ProviderMessageID string  `json:"provider_message_id"`
+	ProviderThreadID  string  `json:"provider_thread_id"`
+	Subject           string  `json:"subject"`
+	Sender            string  `json:"sender"`
+	MsgDate           int64   `json:"msg_date"`
+	Snippet           string  `json:"snippet"`
+	Score             float64 `json:"score,omitempty"` // semantic similarity, when it was found that way
+}
+
+// Answer is the reply to a question
+type Answer struct {
+	Question  string     `json:"question"`
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+	Plan      Plan       `json:"plan"`
+	Sources   int        `json:"sources"` // messages the model read
+}
+
+// Engine answers questions
+type Engine struct {
+	llm llm.Client
+	now func() time.Time
+}
+
+// New creates an engine. Semantic search is skipped when client has no
+// embedding model.
+func New(client llm.Client) *Engine {
+	return &Engine{llm: client, now: time.Now}
+}
+
+// Ask answers a question from the messages in reader, reading at most
+// sources messages
+func (e *Engine) Ask(ctx context.Context, reader eventstore.Reader, question string, sources int) (*Answer, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, ErrEmptyQuestion
+	}
+	if sources <= 0 {
+		sources = DefaultSources
+	}
+
+	plan, err := e.plan(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := e.retrieve(ctx, reader, plan, question, sources)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := &Answer{Question: question, Plan: *plan, Citations: []Citation{}, Sources: len(msgs)}
+	if len(msgs) == 0 {
+		answer.Answer = noSources
+		return answer, nil
+	}
+	if err := e.answer(ctx, question, msgs, answer); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
+
+// retrieve runs the plan's searches and merges their results by reciprocal
+// rank. Semantic search applies the plan's operators itself, so operators
+// alone only run as a store query (newest first) when it can't. Operators
+// that don't parse are dropped; embedding errors only cost the semantic half.
+func (e *Engine) retrieve(ctx context.Context, reader eventstore.Reader, plan *Plan, question string, limit int) ([]eventstore.ScoredMessage, error) {
+	filter, err := search.Parse(plan.Filters)
+	if err != nil {
+		filter = &search.Query{}
+	}
+
+	var ranked [][]eventstore.ScoredMessage
+	if e.llm.EmbeddingModel() != "" {
+		text := strings.TrimSpace(plan.Semantic)
+		if text == "" {
+			text = question
+		}
+		msgs, err := semantic.Search(ctx, reader, e.llm, text, filter, limit)
+		if err != nil {
+			log.Printf("Semantic search failed for %s: %v", reader.UserID(), err)
+		} else {
+			ranked = append(ranked, msgs)
+		}
+	}
+
+	keywords := strings.Fields(plan.Keywords)
+	if len(keywords) > 0 || (len(ranked) == 0 && !filter.Empty()) {
+		q := &search.Query{Clauses: append([]search.Clause(nil), filter.Clauses...)}
+		for _, word := range keywords {
+			q.Clauses = append(q.Clauses, search.Clause{Field: search.FieldText, Value: word})
+		}
+		msgs, err := reader.SearchMessages(ctx, q, limit)
+		if err != nil {
+			return nil, err
+		}
+		ranked = append(ranked, scored(msgs))
+	}
+	return fuse(ranked, limit), nil
+}
+
+func scored(msgs []eventstore.StoredMessage) []eventstore.ScoredMessage {
+	out := make([]eventstore.ScoredMessage, len(msgs))
+	for i, m := range msgs {
+		out[i] = eventstore.ScoredMessage{StoredMessage: m}
+	}
+	return out
+}
+
+// fuse merges ranked lists with reciprocal rank fusion, keeping the first
+// copy of each message (and its similarity score, if any)
+func fuse(lists [][]eventstore.ScoredMessage, limit int) []eventstore.ScoredMessage {
+	type entry struct {
+		msg  eventstore.ScoredMessage
+		rank float64
+	}
+	byID := map[string]*entry{}
+	var order []string
+	for _, list := range lists {
+		for i, m := range list {
+			en := byID[m.EventID]
+			if en == nil {
+				en = &entry{msg: m}
+				byID[m.EventID] = en
+				order = append(order, m.EventID)
+			} else if m.Score > en.msg.Score {
+				en.msg.Score = m.Score
+			}
+			en.rank += 1 / float64(rrfK+i+1)
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return byID[order[i]].rank > byID[order[j]].rank })
+	if len(order) > limit {
+		order = order[:limit]
+	}
+	out := make([]eventstore.ScoredMessage, len(order))
+	for i, id := range order {
+		out[i] = byID[id].msg
+	}
+	return out
+}
+
+// plan asks the model to translate the question into searches
+func (e *Engine) plan(ctx context.Context, question string) (*Plan, error) {
+	now := e.now().UTC()
+	system := fmt.Sprintf(`You translate questions about the user's email into searches.
+Today is %s (UTC).
+
+Reply with a JSON object with three string fields:
+- "filters": search operators the messages must match, space separated. Operators:
+  from:<name or address>, to:<name or address>, subject:<text>, label:<label>,
+  in:inbox|sent|archive|spam|trash, is:read|unread|starred, has:attachment,
+  lang:<ISO 639-1 code, e.g. de>,
+  after:YYYY/MM/DD (on or after), before:YYYY/MM/DD (exclusive).
+  Quote values with spaces: from:"Alice Smith". Turn relative dates ("last week",
+  "yesterday") into after:/before: dates. Leave empty if the question names none.
+- "keywords": at most three words the messages must literally contain, or "" when
+  the topic may be worded differently.
+- "semantic": a short description of what the relevant messages are about.`, now.Format("Monday, 2006-01-02"))
+
+	reply, err := e.llm.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{Role: "system", Content: system},
+			{Role: "user", Content: question},
+		},
+		JSON:      true,
+		MaxTokens: 300,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("plan query: %w", err)
+	}
+
+	var plan Plan
+	if err := llm.DecodeJSON(reply, &plan); err != nil {
+		// An unusable plan still leaves semantic search on the question
+		return &Plan{Semantic: question}, nil
+	}
+	return &plan, nil
+}
+
+// answer asks the model to answer from the numbered messages and fills in
+// the citations it used
+func (e *Engine) answer(ctx context.Context, question string, msgs []eventstore.ScoredMessage, out *Answer) error {
+	var sources strings.Builder
+	for i, m := range msgs {
+		fmt.Fprintf(&sources, "[%d] Date: %s\nFrom: %s\nSubject: %s\n%s\n",
+			i+1, time.Unix(m.MsgDate, 0).UTC().Format("2006-01-02 15:04"), m.Sender, m.Subject, m.Snippet)
+		if tr := m.Translation; tr != nil {
+			fmt.Fprintf(&sources, "Translation (%s): %s\n%s\n", tr.Language, tr.Subject, tr.Snippet)
+		}
+		sources.WriteString("\n")
+	}
+
+	reply, err := e.llm.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{Role: "system", Content: `You answer questions about the user's email using only the numbered messages given.
+Cite the messages you use with their [n] markers in the answer. If the messages
+don't answer the question, say so. Reply with a JSON object:
+{"answer": "<answer with [n] markers>", "citations": [<n>, ...]}`},
+			{Role: "user", Content: "Messages:\n\n" + sources.String() + "Question: " + question},
+		},
+		JSON:      true,
+		MaxTokens: 800,
+	})
+	if err != nil {
+		return fmt.Errorf("answer query: %w", err)
+	}
+
+	var parsed struct {
+		Answer    string `json:"answer"`
+		Citations []int  `json:"citations"`
+	}
+	if err := llm.DecodeJSON(reply, &parsed); err != nil {
+		// Keep a plain-text answer rather than failing the request
+		parsed.Answer = strings.TrimSpace(reply)
+	}
+	out.Answer = parsed.Answer
+
+	seen := map[int]bool{}
+	for _, ref := range parsed.Citations {
+		if ref < 1 || ref > len(msgs) || seen[ref] {
+			continue // the model cited a message it wasn't given
+		}
+		seen[ref] = true
+		m := msgs[ref-1]
+		out.Citations = append(out.Citations, Citation{
+			Ref:               ref,
+			EventID:           m.EventID,
+			Provider:          m.Provider,
+			ProviderMessageID: m.ProviderMessageID,
+			ProviderThreadID:  m.ProviderThreadID,
+			Subject:           m.Subject,
+			Sender:            m.Sender,
+			MsgDate:           m.MsgDate,
+			Snippet:           m.Snippet,
+			Score:             m.Score,
+		})
+	}
+	sort.Slice(out.Citations, func(i, j int) bool { return out.Citations[i].Ref < out.Citations[j].Ref })
+	return nil
+}
@@ -0,0 +1,122 @@
+package projection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ActivityDay is the number of events of one type a user had on a UTC day
+type ActivityDay struct {
+	Date      string `json:"date"` // YYYY-MM-DD
+	EventType string `json:"event_type"`
+	Count     int64  `json:"count"`
+}
+
+// activityRow is one activity_daily row in a snapshot
+type activityRow struct {
+	UserID    string `json:"u"`
+	Day       string `json:"d"`
+	EventType string `json:"t"`
+	Count     int64  `json:"c"`
+}
+
+// Activity counts each user's events per UTC day and event type, in the
+// store's activity_daily table. Its snapshots keep counts for days the
+// stream no longer retains across rebuilds.
+func Activity(store *Store) Projection {
+	return Projection{
+		Name:    "activity",
+		Version: 1,
+		Apply: func(ctx context.Context, ev Event) error {
+			_, err := store.DB.ExecContext(ctx, `
+				INSERT INTO activity_daily (user_id, day, event_type, count) VALUES (?, ?, ?, 1)
+				ON CONFLICT(user_id, day, event_type) DO UPDATE SET count = count + 1
+			`, ev.UserID, ev.Time.UTC().Format(time.DateOnly), ev.Type)
+			if err != nil {
+				return fmt.Errorf("failed to count event: %w", err)
+			}
+			return nil
+		},
+		Reset: func(ctx context.Context) error {
+			if _, err := store.DB.ExecContext(ctx, `DELETE FROM activity_daily`); err != nil {
+				return fmt.Errorf("failed to clear activity: %w", err)
+			}
+			return nil
+		},
+		Snapshot: store.snapshotActivity,
+		Restore:  store.restoreActivity,
+	}
+}
+
+// snapshotActivity encodes every activity_daily row
+func (s *Store) snapshotActivity(ctx context.Context) ([]byte, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT user_id, day, event_type, count FROM activity_daily`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activity: %w", err)
+	}
+	defer rows.Close()
+
+	all := []activityRow{}
+	for rows.Next() {
+		var r activityRow
+		if err := rows.Scan(&r.UserID, &r.Day, &r.EventType, &r.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		all = append(all, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(all)
+}
+
+// restoreActivity loads a snapshot into the (emptied) activity_daily table
+func (s *Store) restoreActivity(ctx context.Context, data []byte) error {
+	var all []activityRow
+	if err := json.Unmarshal(data, &all); err != nil {
+		return fmt.Errorf("failed to decode activity snapshot: %w", err)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, r := range all {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO activity_daily (user_id, day, event_type, count) VALUES (?, ?, ?, ?)
+		`, r.UserID, r.Day, r.EventType, r.Count); err != nil {
+			return fmt.Errorf("failed to restore activity: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to restore activity: %w", err)
+	}
+	return nil
+}
+
+// Activity returns a user's daily event counts since the given day
+func (s *Store) Activity(ctx context.Context, userID string, since time.Time) ([]ActivityDay, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT day, event_type, count
+		FROM activity_daily
+		WHERE user_id = ? AND day >= ?
+		ORDER BY day, event_type
+	`, userID, since.UTC().Format(time.DateOnly))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activity: %w", err)
+	}
+	defer rows.Close()
+
+	days := []ActivityDay{}
+	for rows.Next() {
+		var d ActivityDay
+		if err := rows.Scan(&d.Date, &d.EventType, &d.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
@@ -0,0 +1,336 @@
+// Package projection builds read models from the user events in the
+// USER_EVENTS stream. A projection names the event types it handles and an
+// apply function; the engine feeds it events in stream order through a
+// durable consumer, records its position, and rebuilds it on request: from
+// its latest snapshot if it has one, otherwise from the first retained event.
+package projection
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+const (
+	checkInterval = 10 * time.Second // leadership and rebuild requests
+	retryDelay    = 5 * time.Second  // before redelivering an event that failed to apply
+)
+
+// Event is a user event read from the stream. Type and UserID come from the
+// subject, user.{user_id}.{type}.
+type Event struct {
+	UserID   string
+	Type     string          // email.received, email.sent, ...
+	Sequence uint64          // stream sequence, increasing
+	Time     time.Time       // when the stream stored the event
+	Data     json.RawMessage // the published payload
+}
+
+// Projection builds one read model. Apply sees events at least once and in
+// stream order, so it must tolerate a repeat of the last event (after a crash
+// between applying and recording the position).
+type Projection struct {
+	Name   string
+	Events []string // event types to apply; empty applies all
+	Apply  func(ctx context.Context, ev Event) error
+	Reset  func(ctx context.Context) error // empties the read model before a rebuild
+
+	// Snapshot and Restore, if both are set, let the engine save the read
+	// model periodically and rebuild from the latest snapshot instead of
+	// replaying the stream. Snapshot runs between events, so it sees the
+	// state as of the last applied one; Restore runs after Reset. Bump
+	// Version when a logic change makes older snapshots wrong; rebuilds only
+	// use snapshots of the current version.
+	Version  int
+	Snapshot func(ctx context.Context) ([]byte, error)
+	Restore  func(ctx context.Context, data []byte) error
+}
+
+// snapshots reports whether a projection supports snapshots
+func (p Projection) snapshots() bool {
+	return p.Snapshot != nil && p.Restore != nil
+}
+
+// Source delivers stream events; *natsjs.Publisher implements it
+type Source interface {
+	Consume(ctx context.Context, subject, durable string, handler natsjs.Handler, opts ...nats.SubOpt) error
+	DeleteConsumer(durable string) error
+}
+
+// Engine runs registered projections. Only one process should run each
+// projection; with several workers, SetLeader picks the one that does.
+type Engine struct {
+	source        Source
+	store         *Store
+	leader        func() bool
+	snapshotEvery time.Duration
+	projections   []Projection
+	running       map[string]context.CancelFunc
+}
+
+// NewEngine creates an engine reading from source and recording positions in
+// store
+func NewEngine(source Source, store *Store) *Engine {
+	return &Engine{
+		source:        source,
+		store:         store,
+		snapshotEvery: DefaultSnapshotInterval,
+		running:       make(map[string]context.CancelFunc),
+	}
+}
+
+// DefaultSnapshotInterval is how often projections that support it are
+// snapshotted unless SetSnapshotInterval changes it
+const DefaultSnapshotInterval = 24 * time.Hour
+
+// SetSnapshotInterval sets how often projections are snapshotted; 0 turns
+// snapshots off. Set before Run.
+func (e *Engine) SetSnapshotInterval(d time.Duration) {
+	e.snapshotEvery = d
+}
+
+// Register adds a projection. Register before Run.
+func (e *Engine) Register(p Projection) {
+	for _, existing := range e.projections {
+		if existing.Name == p.Name {
+			panic(fmt.Sprintf("projection %q registered twice", p.Name))
+		}
+	}
+	e.projections = append(e.projections, p)
+}
+
+// SetLeader sets the check deciding whether this process runs the
+// projections. Without one it always does.
+func (e *Engine) SetLeader(fn func() bool) {
+	e.leader = fn
+}
+
+// Names returns the registered projection names, sorted
+func (e *Engine) Names() []string {
+	names := make([]string, 0, len(e.projections))
+	for _, p := range e.projections {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run drives the projections until ctx is cancelled, starting them while
+// this process leads and carrying out rebuild requests
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		e.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			for name, cancel := range e.running {
+				cancel()
+				delete(e.running, name)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check starts, stops and rebuilds projections
+func (e *Engine) check(ctx context.Context) {
+	leading := e.leader == nil || e.leader()
+	for _, p := range e.projections {
+		cancel, running := e.running[p.Name]
+		if !leading {
+			if running {
+				cancel()
+				delete(e.running, p.Name)
+				log.Printf("Projection %s: handed over to the leading worker", p.Name)
+			}
+			continue
+		}
+
+		rebuild, fromSnapshot, err := e.store.rebuildRequested(ctx, p.Name)
+		if err != nil {
+			log.Printf("Projection %s: %v", p.Name, err)
+			continue
+		}
+		if rebuild {
+			if running {
+				cancel()
+				delete(e.running, p.Name)
+				running = false
+			}
+			snap, err := e.rebuild(ctx, p, fromSnapshot)
+			if err != nil {
+				log.Printf("Projection %s: rebuild failed: %v", p.Name, err)
+				continue
+			}
+			if snap != nil {
+				log.Printf("Projection %s: rebuilding from the snapshot at position %d", p.Name, snap.Position)
+			} else {
+				log.Printf("Projection %s: rebuilding from the start of the stream", p.Name)
+			}
+		}
+
+		if !running {
+			e.start(ctx, p)
+		}
+	}
+}
+
+// rebuild empties a projection and rewinds it: to its latest snapshot of the
+// current version if fromSnapshot and there is one (returned), otherwise to
+// the first retained event
+func (e *Engine) rebuild(ctx context.Context, p Projection, fromSnapshot bool) (*Snapshot, error) {
+	var snap *Snapshot
+	if fromSnapshot && p.snapshots() {
+		var err error
+		if snap, err = e.store.LatestSnapshot(ctx, p.Name, p.Version); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := e.source.DeleteConsumer(durable(p.Name)); err != nil {
+		return nil, err
+	}
+	if p.Reset != nil {
+		if err := p.Reset(ctx); err != nil {
+			return nil, fmt.Errorf("reset: %w", err)
+		}
+	}
+	if snap == nil {
+		return nil, e.store.reset(ctx, p.Name, 0)
+	}
+
+	data, err := e.store.snapshotData(ctx, snap.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Restore(ctx, data); err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	return snap, e.store.reset(ctx, p.Name, snap.Position)
+}
+
+// start subscribes a projection's durable consumer. One event is in flight at
+// a time, so events apply in stream order. A consumer recreated after a
+// restore starts right after the snapshot; the start sequence is kept so the
+// same consumer binds again on later starts.
+func (e *Engine) start(ctx context.Context, p Projection) {
+	pos, startSeq, err := e.store.consumerStart(ctx, p.Name)
+	if err != nil {
+		log.Printf("Projection %s: %v", p.Name, err)
+		return
+	}
+	opts := []nats.SubOpt{nats.MaxAckPending(1)}
+	if startSeq > 0 {
+		opts = append(opts, nats.StartSequence(startSeq))
+	}
+
+	var lastSnapshot time.Time
+	if p.snapshots() {
+		snap, err := e.store.LatestSnapshot(ctx, p.Name, p.Version)
+		if err != nil {
+			log.Printf("Projection %s: %v", p.Name, err)
+			return
+		}
+		if snap != nil {
+			lastSnapshot = snap.TakenAt
+		}
+	}
+
+	pctx, cancel := context.WithCancel(ctx)
+	if err := e.source.Consume(pctx, "user.*.>", durable(p.Name), e.handler(p, pos, lastSnapshot), opts...); err != nil {
+		cancel()
+		log.Printf("Projection %s: %v", p.Name, err)
+		return
+	}
+	e.running[p.Name] = cancel
+	log.Printf("✓ Projection %s running from position %d", p.Name, pos)
+}
+
+// handler applies one delivered event. Events at or below the recorded
+// position were applied before and are skipped. Once the snapshot interval
+// has passed since lastSnapshot, the read model is snapshotted after the next
+// applied event.
+func (e *Engine) handler(p Projection, last uint64, lastSnapshot time.Time) natsjs.Handler {
+	handles := make(map[string]bool, len(p.Events))
+	for _, t := range p.Events {
+		handles[t] = true
+	}
+
+	return func(ctx context.Context, msg *nats.Msg) error {
+		meta, err := msg.Metadata()
+		if err != nil {
+			return fmt.Errorf("read metadata: %w", err)
+		}
+		seq := meta.Sequence.Stream
+		if seq <= last {
+			return nil
+		}
+
+		ev, ok := parseSubject(msg.Subject)
+		if ok && (len(handles) == 0 || handles[ev.Type]) {
+			ev.Sequence = seq
+			ev.Time = meta.Timestamp
+			ev.Data = msg.Data
+			if err := p.Apply(ctx, ev); err != nil {
+				_ = e.store.RecordError(ctx, p.Name, err)
+				// Nak redelivers at once; wait so a persistent failure doesn't spin
+				select {
+				case <-time.After(retryDelay):
+				case <-ctx.Done():
+				}
+				return fmt.Errorf("projection %s: %w", p.Name, err)
+			}
+			if err := e.store.Advance(ctx, p.Name, seq); err != nil {
+				return err
+			}
+			if p.snapshots() && e.snapshotEvery > 0 && time.Since(lastSnapshot) >= e.snapshotEvery {
+				if err := e.snapshot(ctx, p, seq); err != nil {
+					log.Printf("Projection %s: snapshot failed: %v", p.Name, err)
+				}
+				lastSnapshot = time.Now()
+			}
+		}
+		last = seq
+		return nil
+	}
+}
+
+// snapshot saves the read model as of the event at seq
+func (e *Engine) snapshot(ctx context.Context, p Projection, seq uint64) error {
+	start := time.Now()
+	data, err := p.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	if err := e.store.SaveSnapshot(ctx, p.Name, p.Version, seq, data); err != nil {
+		return err
+	}
+	log.Printf("Projection %s: snapshot at position %d (%d bytes) in %s", p.Name, seq, len(data), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// parseSubject splits user.{user_id}.{event type}
+func parseSubject(subject string) (Event, bool) {
+	parts := strings.SplitN(subject, ".", 3)
+	if len(parts) != 3 || parts[0] != "user" {
+		return Event{}, false
+	}
+	return Event{UserID: parts[1], Type: parts[2]}, true
+}
+
+// durable names a projection's consumer
+func durable(name string) string {
+	return "projection_" + name
+}
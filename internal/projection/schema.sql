@@ -0,0 +1,39 @@
+PRAGMA journal_mode=WAL;
+PRAGMA synchronous=NORMAL;
+PRAGMA busy_timeout=5000;
+
+-- How far each projection has read the USER_EVENTS stream. A projection is
+-- rebuilt (from its latest snapshot unless rebuild_from_start) when
+-- rebuild_requested_at is set. Columns added later are in store.go.
+CREATE TABLE IF NOT EXISTS projection_positions (
+  name                  TEXT PRIMARY KEY,
+  position              INTEGER NOT NULL DEFAULT 0,   -- last applied stream sequence
+  applied               INTEGER NOT NULL DEFAULT 0,   -- events applied since the last rebuild
+  updated_at            INTEGER NOT NULL,
+  rebuilt_at            INTEGER,
+  rebuild_requested_at  INTEGER,
+  last_error            TEXT
+);
+
+-- Saved read models, so a rebuild restores one and replays only the events
+-- after position. The latest few per projection are kept.
+CREATE TABLE IF NOT EXISTS projection_snapshots (
+  id                    INTEGER PRIMARY KEY AUTOINCREMENT,
+  name                  TEXT NOT NULL,
+  version               INTEGER NOT NULL,             -- Projection.Version that took it
+  position              INTEGER NOT NULL,             -- last stream sequence it includes
+  data                  BLOB NOT NULL,
+  size                  INTEGER NOT NULL,
+  taken_at              INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_projection_snapshots_name ON projection_snapshots(name, version, id);
+
+-- activity projection: events per user, UTC day and event type
+CREATE TABLE IF NOT EXISTS activity_daily (
+  user_id             TEXT NOT NULL,
+  day                 TEXT NOT NULL,                  -- YYYY-MM-DD
+  event_type          TEXT NOT NULL,                  -- email.received, email.sent, ...
+  count               INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (user_id, day, event_type)
+);
@@ -0,0 +1,317 @@
+package projection
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+// columnMigrations adds the projection_positions columns introduced after
+// the table's first release (CREATE TABLE IF NOT EXISTS won't)
+var columnMigrations = []struct {
+	column string
+	decl   string
+}{
+	{"start_seq", "INTEGER NOT NULL DEFAULT 0"},          // consumer start after a restore, 0 = first event
+	{"rebuild_from_start", "INTEGER NOT NULL DEFAULT 0"}, // requested rebuild ignores snapshots
+}
+
+// snapshotsKept is how many snapshots are kept per projection
+const snapshotsKept = 3
+
+// Store persists projection positions and the built-in read models
+type Store struct {
+	DB *sql.DB
+}
+
+// Status is a projection's progress
+type Status struct {
+	Name               string     `json:"name"`
+	Position           uint64     `json:"position"` // last applied stream sequence
+	Applied            int64      `json:"applied"`  // events applied since the last rebuild
+	UpdatedAt          time.Time  `json:"updated_at"`
+	RebuiltAt          *time.Time `json:"rebuilt_at,omitempty"`
+	RebuildRequestedAt *time.Time `json:"rebuild_requested_at,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+	Snapshot           *Snapshot  `json:"snapshot,omitempty"` // latest
+}
+
+// Snapshot describes a saved read model
+type Snapshot struct {
+	ID       int64     `json:"id"`
+	Version  int       `json:"version"`
+	Position uint64    `json:"position"` // last stream sequence it includes
+	Size     int64     `json:"size"`
+	TakenAt  time.Time `json:"taken_at"`
+}
+
+// Open opens or creates the projections database
+func Open(dbPath string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if _, err := db.Exec(schemaSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	return &Store{DB: db}, nil
+}
+
+// migrate adds missing projection_positions columns
+func migrate(db *sql.DB) error {
+	existing := map[string]bool{}
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('projection_positions')`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range columnMigrations {
+		if existing[m.column] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE projection_positions ADD COLUMN ` + m.column + ` ` + m.decl); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", m.column, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+// Position returns the last stream sequence applied by a projection
+func (s *Store) Position(ctx context.Context, name string) (uint64, error) {
+	pos, _, err := s.consumerStart(ctx, name)
+	return pos, err
+}
+
+// consumerStart returns a projection's position and the start sequence of
+// its consumer (0 for the first event)
+func (s *Store) consumerStart(ctx context.Context, name string) (pos, startSeq uint64, err error) {
+	err = s.DB.QueryRowContext(ctx, `SELECT position, start_seq FROM projection_positions WHERE name = ?`, name).Scan(&pos, &startSeq)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, 0, fmt.Errorf("failed to read position of %s: %w", name, err)
+	}
+	return pos, startSeq, nil
+}
+
+// Advance records that a projection applied the event at seq
+func (s *Store) Advance(ctx context.Context, name string, seq uint64) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO projection_positions (name, position, applied, updated_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			position = excluded.position,
+			applied = applied + 1,
+			updated_at = excluded.updated_at,
+			last_error = NULL
+	`, name, seq, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save position of %s: %w", name, err)
+	}
+	return nil
+}
+
+// RecordError keeps the last apply error of a projection for its status
+func (s *Store) RecordError(ctx context.Context, name string, applyErr error) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO projection_positions (name, updated_at, last_error) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET last_error = excluded.last_error, updated_at = excluded.updated_at
+	`, name, time.Now().Unix(), applyErr.Error())
+	if err != nil {
+		return fmt.Errorf("failed to record error of %s: %w", name, err)
+	}
+	return nil
+}
+
+// RequestRebuild asks the engine running a projection to rebuild it, from
+// its latest snapshot unless fromStart. Any process sharing the database can
+// request one.
+func (s *Store) RequestRebuild(ctx context.Context, name string, fromStart bool) error {
+	now := time.Now().Unix()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO projection_positions (name, updated_at, rebuild_requested_at, rebuild_from_start) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			rebuild_requested_at = excluded.rebuild_requested_at,
+			rebuild_from_start = excluded.rebuild_from_start
+	`, name, now, now, fromStart)
+	if err != nil {
+		return fmt.Errorf("failed to request rebuild of %s: %w", name, err)
+	}
+	return nil
+}
+
+// rebuildRequested reports whether a rebuild of the projection is pending and
+// whether it may start from a snapshot
+func (s *Store) rebuildRequested(ctx context.Context, name string) (requested, fromSnapshot bool, err error) {
+	var requestedAt sql.NullInt64
+	var fromStart bool
+	err = s.DB.QueryRowContext(ctx, `
+		SELECT rebuild_requested_at, rebuild_from_start FROM projection_positions WHERE name = ?
+	`, name).Scan(&requestedAt, &fromStart)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, fmt.Errorf("failed to read rebuild request of %s: %w", name, err)
+	}
+	return requestedAt.Valid, !fromStart, nil
+}
+
+// reset starts a projection over after position: 0 for the beginning of the
+// stream, or the position of the snapshot it was restored from
+func (s *Store) reset(ctx context.Context, name string, position uint64) error {
+	var startSeq uint64
+	if position > 0 {
+		startSeq = position + 1
+	}
+	now := time.Now().Unix()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO projection_positions (name, position, start_seq, updated_at, rebuilt_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			position = excluded.position, start_seq = excluded.start_seq, applied = 0,
+			updated_at = excluded.updated_at, rebuilt_at = excluded.rebuilt_at,
+			rebuild_requested_at = NULL, rebuild_from_start = 0, last_error = NULL
+	`, name, position, startSeq, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to reset %s: %w", name, err)
+	}
+	return nil
+}
+
+// Statuses returns the progress of every projection that has run
+func (s *Store) Statuses(ctx context.Context) ([]Status, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT name, position, applied, updated_at, rebuilt_at, rebuild_requested_at, COALESCE(last_error, '')
+		FROM projection_positions
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query projections: %w", err)
+	}
+	defer rows.Close()
+
+	var statuses []Status
+	for rows.Next() {
+		var st Status
+		var updatedAt int64
+		var rebuiltAt, requestedAt sql.NullInt64
+		if err := rows.Scan(&st.Name, &st.Position, &st.Applied, &updatedAt, &rebuiltAt, &requestedAt, &st.LastError); err != nil {
+			return nil, fmt.Errorf("failed to scan projection: %w", err)
+		}
+		st.UpdatedAt = time.Unix(updatedAt, 0)
+		if rebuiltAt.Valid {
+			t := time.Unix(rebuiltAt.Int64, 0)
+			st.RebuiltAt = &t
+		}
+		if requestedAt.Valid {
+			t := time.Unix(requestedAt.Int64, 0)
+			st.RebuildRequestedAt = &t
+		}
+		statuses = append(statuses, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range statuses {
+		snap, err := s.LatestSnapshot(ctx, statuses[i].Name, -1)
+		if err != nil {
+			return nil, err
+		}
+		statuses[i].Snapshot = snap
+	}
+	return statuses, nil
+}
+
+// SaveSnapshot stores a projection's read model as of position and deletes
+// its older snapshots beyond the last few
+func (s *Store) SaveSnapshot(ctx context.Context, name string, version int, position uint64, data []byte) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO projection_snapshots (name, version, position, data, size, taken_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, name, version, position, data, len(data), time.Now().Unix()); err != nil {
+		return fmt.Errorf("failed to save snapshot of %s: %w", name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM projection_snapshots
+		WHERE name = ? AND id NOT IN (
+			SELECT id FROM projection_snapshots WHERE name = ? ORDER BY id DESC LIMIT ?
+		)
+	`, name, name, snapshotsKept); err != nil {
+		return fmt.Errorf("failed to prune snapshots of %s: %w", name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save snapshot of %s: %w", name, err)
+	}
+	return nil
+}
+
+// LatestSnapshot returns a projection's newest snapshot of a version (any
+// version if negative), nil if there is none
+func (s *Store) LatestSnapshot(ctx context.Context, name string, version int) (*Snapshot, error) {
+	var snap Snapshot
+	var takenAt int64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, version, position, size, taken_at
+		FROM projection_snapshots
+		WHERE name = ? AND (? < 0 OR version = ?)
+		ORDER BY id DESC
+		LIMIT 1
+	`, name, version, version).Scan(&snap.ID, &snap.Version, &snap.Position, &snap.Size, &takenAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot of %s: %w", name, err)
+	}
+	snap.TakenAt = time.Unix(takenAt, 0)
+	return &snap, nil
+}
+
+// snapshotData loads a snapshot's read model
+func (s *Store) snapshotData(ctx context.Context, id int64) ([]byte, error) {
+	var data []byte
+	if err := s.DB.QueryRowContext(ctx, `SELECT data FROM projection_snapshots WHERE id = ?`, id).Scan(&data); err != nil {
+		return nil, fmt.Errorf("failed to load snapshot %d: %w", id, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,161 @@
+// Package archive parses mail archives (mbox, zip of .eml files, single .eml)
+// such as Google Takeout exports into normalized MessageMeta for import.
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// maxMessageSize bounds a single message read from an archive
+const maxMessageSize = 50 << 20
+
+// Format is an archive format
+type Format string
+
+const (
+	FormatMbox Format = "mbox"
+	FormatZip  Format = "zip"
+	FormatEML  Format = "eml"
+)
+
+// DetectFormat guesses the archive format from its first bytes
+func DetectFormat(head []byte) Format {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return FormatZip
+	case bytes.HasPrefix(head, []byte("From ")):
+		return FormatMbox
+	default:
+		return FormatEML
+	}
+}
+
+// Read parses the archive in r (size bytes) and calls fn for each message.
+// Messages that fail to parse are skipped and counted in skipped.
+func Read(r io.ReaderAt, size int64, fn func(sync.MessageMeta) error) (skipped int, err error) {
+	head := make([]byte, 5)
+	n, _ := r.ReadAt(head, 0)
+
+	emit := func(raw []byte) error {
+		meta, err := Parse(raw)
+		if err != nil {
+			skipped++
+			return nil
+		}
+		return fn(meta)
+	}
+
+	switch DetectFormat(head[:n]) {
+	case FormatZip:
+		err = readZip(r, size, emit)
+	case FormatMbox:
+		err = readMbox(io.NewSectionReader(r, 0, size), emit)
+	default:
+		raw, readErr := io.ReadAll(io.LimitReader(io.NewSectionReader(r, 0, size), maxMessageSize))
+		if readErr != nil {
+			return 0, readErr
+		}
+		err = emit(raw)
+	}
+	return skipped, err
+}
+
+// readZip emits every .eml file in a zip archive (and mbox files inside it)
+func readZip(r io.ReaderAt, size int64, emit func([]byte) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip: %w", err)
+	}
+
+	for _, f := range zr.File {
+		ext := strings.ToLower(path.Ext(f.Name))
+		if f.FileInfo().IsDir() || (ext != ".eml" && ext != ".mbox") {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("open %s: %w", f.Name, err)
+		}
+
+		if ext == ".mbox" {
+			err = readMbox(rc, emit)
+		} else {
+			var raw []byte
+			raw, err = io.ReadAll(io.LimitReader(rc, maxMessageSize))
+			if err == nil {
+				err = emit(raw)
+			}
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMbox splits an mbox stream on "From " separator lines, undoing mboxrd
+// ">From " quoting
+func readMbox(r io.Reader, emit func([]byte) error) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+
+	var (
+		msg       bytes.Buffer
+		started   bool
+		prevBlank = true
+	)
+
+	flush := func() error {
+		if !started || msg.Len() == 0 {
+			return nil
+		}
+		raw := append([]byte(nil), msg.Bytes()...)
+		msg.Reset()
+		return emit(raw)
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case prevBlank && bytes.HasPrefix(line, []byte("From ")):
+				if err := flush(); err != nil {
+					return err
+				}
+				started = true
+			case started && msg.Len() < maxMessageSize:
+				if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+					line = line[1:]
+				}
+				msg.Write(line)
+			}
+			prevBlank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read mbox: %w", err)
+		}
+	}
+
+	return flush()
+}
+
+// contentID derives a stable id for messages without a Message-ID header
+func contentID(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:16])
+}
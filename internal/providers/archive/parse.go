@@ -0,0 +1,283 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// snippetLength matches the length of provider snippets
+const snippetLength = 200
+
+// maxBodyLength caps the plain-text body kept for pipeline stages
+const maxBodyLength = 64 << 10
+
+var wordDecoder = &mime.WordDecoder{}
+
+// Parse normalizes a raw RFC 5322 message. Gmail Takeout headers
+// (X-GM-THRID, X-Gmail-Labels) provide thread ids, labels and read state.
+func Parse(raw []byte) (sync.MessageMeta, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return sync.MessageMeta{}, fmt.Errorf("parse message: %w", err)
+	}
+
+	headers := make(map[string]string, len(msg.Header))
+	for name, values := range msg.Header {
+		if len(values) > 0 {
+			headers[name] = decodeHeader(values[0])
+		}
+	}
+
+	meta := sync.MessageMeta{
+		Provider: sync.ProviderImport,
+		InboxID:  "import",
+		Subject:  headers["Subject"],
+		Sender:   headers["From"],
+		To:       addressList(msg.Header.Get("To")),
+		Cc:       addressList(msg.Header.Get("Cc")),
+		Bcc:      addressList(msg.Header.Get("Bcc")),
+		Headers:  headers,
+		IsRead:   true,
+	}
+
+	meta.MessageID = strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>")
+	if meta.MessageID == "" {
+		meta.MessageID = contentID(raw)
+	}
+	meta.ThreadID = threadID(msg.Header, meta.MessageID)
+
+	if date, err := msg.Header.Date(); err == nil {
+		meta.MessageDate = date
+	} else {
+		meta.MessageDate = time.Unix(0, 0)
+	}
+
+	if labels := msg.Header.Get("X-Gmail-Labels"); labels != "" {
+		for _, l := range strings.Split(decodeHeader(labels), ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				meta.ProviderLabels = append(meta.ProviderLabels, l)
+			}
+		}
+	}
+	meta.Folder = takeoutFolder(meta.ProviderLabels)
+	for _, l := range meta.ProviderLabels {
+		switch strings.ToLower(l) {
+		case "unread":
+			meta.IsRead = false
+		case "starred":
+			meta.IsFlagged = true
+		}
+	}
+
+	var b body
+	b.walk(msg.Header, msg.Body)
+	meta.Body = b.text
+	meta.Snippet = snippet(b.text)
+	meta.Attachments = b.attachments
+	meta.CalendarParts = b.calendar
+	meta.Kind = sync.ClassifyMessage(meta.Sender, headers)
+	meta.List = sync.DetectMailingList(headers)
+
+	return meta, nil
+}
+
+// threadID uses Gmail's thread id when present, else the root of the
+// References chain, else the message itself
+func threadID(h mail.Header, messageID string) string {
+	if id := strings.TrimSpace(h.Get("X-Gm-Thrid")); id != "" {
+		return id
+	}
+	if refs := strings.Fields(h.Get("References")); len(refs) > 0 {
+		return strings.Trim(refs[0], "<>")
+	}
+	if parent := strings.TrimSpace(h.Get("In-Reply-To")); parent != "" {
+		return strings.Trim(parent, "<>")
+	}
+	return messageID
+}
+
+// takeoutFolder maps Takeout label names onto the canonical folder taxonomy
+func takeoutFolder(labels []string) sync.Folder {
+	has := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		has[strings.ToLower(l)] = true
+	}
+
+	switch {
+	case has["trash"]:
+		return sync.FolderTrash
+	case has["spam"]:
+		return sync.FolderSpam
+	case has["inbox"]:
+		return sync.FolderInbox
+	case has["sent"]:
+		return sync.FolderSent
+	default:
+		return sync.FolderArchive
+	}
+}
+
+// decodeHeader decodes RFC 2047 encoded words, falling back to the raw value
+func decodeHeader(v string) string {
+	decoded, err := wordDecoder.DecodeHeader(v)
+	if err != nil {
+		return v
+	}
+	return decoded
+}
+
+// addressList parses an address header into bare addresses
+func addressList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	addrs, err := mail.ParseAddressList(v)
+	if err != nil {
+		var result []string
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				result = append(result, p)
+			}
+		}
+		return result
+	}
+
+	result := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		result = append(result, a.Address)
+	}
+	return result
+}
+
+// maxCalendarPart caps the inline text/calendar parts kept; larger ones are
+// dropped
+const maxCalendarPart = 1 << 20
+
+// maxAttachmentSize caps the attachment content kept in memory; larger files
+// are recorded by size only
+const maxAttachmentSize = 32 << 20
+
+// partHeader is the header of a message or MIME part
+type partHeader interface {
+	Get(key string) string
+}
+
+// body collects the first text/plain part, the inline calendar parts and the
+// attachments of a message
+type body struct {
+	text        string
+	calendar    [][]byte
+	attachments []sync.Attachment
+}
+
+// walk visits a message or MIME part, descending into multipart containers
+func (b *body) walk(h partHeader, r io.Reader) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				return
+			}
+			b.walk(part.Header, part)
+		}
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	filename = decodeHeader(filename)
+
+	r = decodeTransfer(h.Get("Content-Transfer-Encoding"), r)
+	switch {
+	case disposition == "attachment" || (filename != "" && mediaType != "text/plain"):
+		b.attachments = append(b.attachments, readAttachment(filename, mediaType, r))
+	case mediaType == "text/plain" && b.text == "":
+		b.text = readText(r)
+	case mediaType == "text/calendar":
+		// An invite's iCalendar alternative to its text
+		if data, _ := io.ReadAll(io.LimitReader(r, maxCalendarPart+1)); len(data) <= maxCalendarPart {
+			b.calendar = append(b.calendar, data)
+		}
+	}
+}
+
+// decodeTransfer undoes a part's Content-Transfer-Encoding
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	}
+	return r
+}
+
+// readAttachment reads an attachment, keeping its content only if it is at
+// most maxAttachmentSize
+func readAttachment(filename, contentType string, r io.Reader) sync.Attachment {
+	a := sync.Attachment{Filename: filename, ContentType: contentType}
+	data, _ := io.ReadAll(io.LimitReader(r, maxAttachmentSize+1))
+	a.Size = int64(len(data))
+	if a.Size > maxAttachmentSize {
+		rest, _ := io.Copy(io.Discard, r)
+		a.Size += rest
+		return a
+	}
+	a.Data = data
+	return a
+}
+
+// readText reads a text part, up to maxBodyLength
+func readText(r io.Reader) string {
+	buf := make([]byte, maxBodyLength)
+	n, _ := io.ReadFull(r, buf)
+	text := string(buf[:n])
+	if n == maxBodyLength {
+		// Drop a rune cut off by the limit
+		for i := 0; i < utf8.UTFMax-1 && len(text) > 0; i++ {
+			if r, _ := utf8.DecodeLastRuneInString(text); r != utf8.RuneError {
+				break
+			}
+			text = text[:len(text)-1]
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return text
+}
+
+// snippet collapses the start of a body to snippetLength
+func snippet(body string) string {
+	if len(body) > snippetLength*4 {
+		body = body[:snippetLength*4]
+	}
+	text := strings.Join(strings.Fields(body), " ")
+
+	if len(text) > snippetLength {
+		text = text[:snippetLength]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text
+}
@@ -0,0 +1,294 @@
+// Package fake is a simulated mail provider for local development. It
+// generates synthetic mail (senders, threads, newsletters, auto-replies) so
+// the pipeline, outbox and NATS can be exercised without OAuth accounts.
+// Generation is seeded by the user id, so a user's backfill is the same on
+// every run and restarts don't create duplicates.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// ProviderFake is the name of the simulated provider
+const ProviderFake sync.ProviderName = "FAKE"
+
+// maxPerSync bounds the messages one incremental sync generates, so an inbox
+// left idle for days catches up over several polls
+const maxPerSync = 500
+
+// Config shapes the generated traffic
+type Config struct {
+	Backfill   int           // messages in the initial backfill
+	Senders    int           // distinct correspondents
+	ThreadSize int           // messages per thread; 1 for no threads
+	Rate       float64       // new messages per minute after the backfill
+	Span       time.Duration // how far back the backfill reaches
+}
+
+// DefaultConfig is a small, busy inbox
+var DefaultConfig = Config{Backfill: 500, Senders: 40, ThreadSize: 4, Rate: 2, Span: 90 * 24 * time.Hour}
+
+// Validate checks that c can generate mail
+func (c Config) Validate() error {
+	switch {
+	case c.Backfill < 0:
+		return fmt.Errorf("backfill must not be negative")
+	case c.Senders < 1:
+		return fmt.Errorf("senders must be at least 1")
+	case c.ThreadSize < 1:
+		return fmt.Errorf("thread size must be at least 1")
+	case c.Rate < 0:
+		return fmt.Errorf("rate must not be negative")
+	case c.Span <= 0:
+		return fmt.Errorf("span must be positive")
+	}
+	return nil
+}
+
+// Register adds the fake provider to the sync registry. It needs no OAuth
+// token, so only register it where anyone may connect it, e.g. in dev mode.
+func Register(cfg Config) {
+	sync.RegisterProvider(sync.ProviderInfo{
+		Name:         ProviderFake,
+		Aliases:      []string{"fake"},
+		Capabilities: []sync.Capability{sync.CapHealth},
+		New: func(ctx context.Context, _ *auth.Token, opts sync.ProviderOptions) (sync.MailProvider, error) {
+			return New(cfg, opts), nil
+		},
+	})
+}
+
+// Adapter implements MailProvider with generated mail. It is immutable, so it
+// is safe for concurrent use.
+type Adapter struct {
+	cfg    Config
+	userID string
+	seed   uint64
+	since  time.Time // backfill only mail received after this; zero for cfg.Span
+}
+
+// New creates a fake adapter for opts.UserID. With opts.BackfillWindow the
+// backfill reaches back no further than that.
+func New(cfg Config, opts sync.ProviderOptions) *Adapter {
+	h := fnv.New64a()
+	h.Write([]byte(opts.UserID))
+	a := &Adapter{cfg: cfg, userID: opts.UserID, seed: h.Sum64()}
+	if opts.BackfillWindow > 0 {
+		a.since = time.Now().Add(-opts.BackfillWindow)
+	}
+	return a
+}
+
+// InitialBackfill generates cfg.Backfill messages spread over the backfill
+// span, newest first like the real providers
+func (a *Adapter) InitialBackfill(ctx context.Context, user string, cp *sync.Checkpoint, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
+	now := time.Now()
+	from := now.Add(-a.cfg.Span)
+	if a.since.After(from) {
+		from = a.since
+	}
+	if a.cfg.Backfill > 0 {
+		step := now.Sub(from) / time.Duration(a.cfg.Backfill)
+		for seq := a.cfg.Backfill - 1; seq >= 0; seq-- {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := fn(a.message(uint64(seq), from.Add(step*time.Duration(seq)))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &sync.Checkpoint{Cursor: formatCursor(uint64(a.cfg.Backfill), now)}, nil
+}
+
+// IncrementalSync generates the messages that arrived at cfg.Rate since the
+// checkpoint
+func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Checkpoint, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
+	if cp.Cursor == "" {
+		return a.InitialBackfill(ctx, user, &cp, fn)
+	}
+	next, last, err := parseCursor(cp.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if a.cfg.Rate == 0 {
+		return &cp, nil
+	}
+
+	interval := time.Duration(float64(time.Minute) / a.cfg.Rate)
+	now := time.Now()
+	n := int(now.Sub(last) / interval)
+	if n > maxPerSync {
+		n = maxPerSync
+	}
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		last = last.Add(interval)
+		if err := fn(a.message(next, last)); err != nil {
+			return nil, err
+		}
+		next++
+	}
+	// Time not yet worth a message carries over to the next poll
+	return &sync.Checkpoint{Cursor: formatCursor(next, last)}, nil
+}
+
+// CheckHealth always succeeds; there is no account behind the adapter
+func (a *Adapter) CheckHealth(ctx context.Context) error {
+	return nil
+}
+
+// message generates message seq of the user's mailbox, received at date
+func (a *Adapter) message(seq uint64, date time.Time) sync.MessageMeta {
+	thread := seq / uint64(a.cfg.ThreadSize)
+	pos := seq % uint64(a.cfg.ThreadSize)
+
+	// Thread-level choices come from the thread's generator so every message
+	// in it agrees; the rest from the message's own
+	trng := rand.New(rand.NewPCG(a.seed, thread))
+	rng := rand.New(rand.NewPCG(a.seed, seq<<32|0xfa4e))
+
+	me := a.address()
+	other := correspondent(a.seed, trng.IntN(a.cfg.Senders))
+	subject := subjects[trng.IntN(len(subjects))]
+	newsletter := other.newsletter
+
+	from, to := other.String(), me
+	folder, labels := sync.FolderInbox, []string{"INBOX"}
+	if !newsletter && pos%2 == 1 {
+		// Odd replies in a conversation are the user's own
+		from, to = me, other.String()
+		folder, labels = sync.FolderSent, []string{"SENT"}
+	}
+	if pos > 0 && !newsletter {
+		subject = "Re: " + subject
+	}
+
+	headers := map[string]string{
+		"From":       from,
+		"To":         to,
+		"Subject":    subject,
+		"Date":       date.Format(time.RFC1123Z),
+		"Message-ID": fmt.Sprintf("<%d.%d@fake.local>", a.seed, seq),
+	}
+	if newsletter {
+		headers["List-Id"] = fmt.Sprintf("<news.%s>", other.domain)
+		headers["List-Unsubscribe"] = fmt.Sprintf("<https://%s/unsubscribe>", other.domain)
+		headers["Precedence"] = "bulk"
+	} else if folder == sync.FolderInbox && rng.IntN(50) == 0 {
+		headers["Auto-Submitted"] = "auto-replied"
+		headers["Subject"] = "Automatic reply: " + subject
+	}
+
+	// Older mail is mostly read
+	isRead := folder == sync.FolderSent || time.Since(date) > 24*time.Hour && rng.IntN(10) > 0
+	isFlagged := !newsletter && rng.IntN(20) == 0
+	if !isRead {
+		labels = append(labels, "UNREAD")
+	}
+	if isFlagged {
+		labels = append(labels, "STARRED")
+	}
+
+	return sync.MessageMeta{
+		Provider:       ProviderFake,
+		UserID:         a.userID,
+		InboxID:        "primary",
+		MessageID:      fmt.Sprintf("fake-%d", seq),
+		ThreadID:       fmt.Sprintf("fake-thread-%d", thread),
+		Subject:        headers["Subject"],
+		Sender:         from,
+		To:             []string{to},
+		Snippet:        snippets[rng.IntN(len(snippets))],
+		ProviderLabels: labels,
+		Folder:         folder,
+		IsRead:         isRead,
+		IsFlagged:      isFlagged,
+		Kind:           sync.ClassifyMessage(from, headers),
+		List:           sync.DetectMailingList(headers),
+		Headers:        headers,
+		MessageDate:    date,
+	}
+}
+
+// address is the user's own generated address
+func (a *Adapter) address() string {
+	return fmt.Sprintf("%s@fake.local", strings.ToLower(a.userID))
+}
+
+// person is a generated correspondent
+type person struct {
+	name, local, domain string
+	newsletter          bool
+}
+
+func (p person) String() string {
+	return fmt.Sprintf("%s <%s@%s>", p.name, p.local, p.domain)
+}
+
+// correspondent returns sender i of the user's mailbox. Every eighth one is
+// a newsletter.
+func correspondent(seed uint64, i int) person {
+	rng := rand.New(rand.NewPCG(seed, uint64(i)<<40|0x5e4d))
+	if i%8 == 7 {
+		name := newsletters[rng.IntN(len(newsletters))]
+		return person{name: name, local: "news", domain: strings.ToLower(strings.ReplaceAll(name, " ", "")) + ".example", newsletter: true}
+	}
+	first := firstNames[rng.IntN(len(firstNames))]
+	last := lastNames[rng.IntN(len(lastNames))]
+	return person{
+		name:   first + " " + last,
+		local:  strings.ToLower(first + "." + last),
+		domain: domains[rng.IntN(len(domains))],
+	}
+}
+
+// formatCursor encodes the next message sequence and the arrival time of the
+// last generated message
+func formatCursor(next uint64, last time.Time) string {
+	return strconv.FormatUint(next, 10) + ":" + strconv.FormatInt(last.UnixNano(), 10)
+}
+
+func parseCursor(cursor string) (uint64, time.Time, error) {
+	seq, nanos, ok := strings.Cut(cursor, ":")
+	next, err1 := strconv.ParseUint(seq, 10, 64)
+	last, err2 := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid fake cursor %q", cursor)
+	}
+	return next, time.Unix(0, last), nil
+}
+
+var (
+	firstNames  = []string{"Ada", "Ben", "Chloe", "Dev", "Elena", "Farid", "Grace", "Hiro", "Ines", "Jonas", "Kemi", "Liam", "Maya", "Nikhil", "Olga", "Priya", "Quinn", "Rosa", "Sam", "Tariq"}
+	lastNames   = []string{"Adler", "Banerjee", "Costa", "Dubois", "Eze", "Fischer", "Garcia", "Hansen", "Ito", "Jensen", "Kowalski", "Lopez", "Moreau", "Nakamura", "Okafor", "Petrov", "Rossi", "Silva", "Tanaka", "Weber"}
+	domains     = []string{"acme.example", "globex.example", "initech.example", "umbrella.example", "hooli.example", "gmail.example"}
+	newsletters = []string{"Weekly Digest", "Product Updates", "Dev Newsletter", "Market Brief", "Travel Deals"}
+	subjects    = []string{
+		"Quarterly planning", "Invoice for March", "Lunch on Thursday?", "Design review notes",
+		"Contract renewal", "Onboarding checklist", "Your order has shipped", "Interview schedule",
+		"Budget approval needed", "Offsite agenda", "Bug triage", "Customer feedback summary",
+		"Hiring update", "Release 2.4 retro", "Intro: partnership opportunity", "Travel itinerary",
+	}
+	snippets = []string{
+		"Hi, just following up on this. Could you take a look before Friday?",
+		"Thanks for sending this over. A few comments inline below.",
+		"Attached is the latest version. Let me know if anything is missing.",
+		"Can we move our call to next week? Something came up on my side.",
+		"Great news: the team signed off on the proposal this morning.",
+		"Reminder that the deadline is end of day tomorrow.",
+		"Here is this week's roundup of what's new.",
+		"Sounds good to me. I'll update the doc and share it with everyone.",
+	}
+)
@@ -0,0 +1,65 @@
+package gmail
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/gmail/v1"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// ApplyAction executes action as a label modification (or trash) and returns
+// the message's label state afterwards
+func (a *Adapter) ApplyAction(ctx context.Context, messageID string, action sync.MessageAction) (*sync.MessageChange, error) {
+	var add, remove []string
+
+	switch action.Type {
+	case sync.ActionRead:
+		remove = []string{"UNREAD"}
+	case sync.ActionUnread:
+		add = []string{"UNREAD"}
+	case sync.ActionArchive:
+		remove = []string{"INBOX"}
+	case sync.ActionAddLabels:
+		add = action.Labels
+	case sync.ActionRemoveLabels:
+		remove = action.Labels
+	case sync.ActionMove:
+		switch sync.Folder(action.Destination) {
+		case sync.FolderInbox:
+			add, remove = []string{"INBOX"}, []string{"SPAM"}
+		case sync.FolderArchive:
+			remove = []string{"INBOX"}
+		case sync.FolderSpam:
+			add, remove = []string{"SPAM"}, []string{"INBOX"}
+		case sync.FolderTrash:
+			m, err := a.svc.Users.Messages.Trash("me", messageID).Context(ctx).Do()
+			if err != nil {
+				return nil, fmt.Errorf("failed to trash message: %w", err)
+			}
+			change := labelChange(m, sync.ChangeLabelsAdded, []string{"TRASH"}, "")
+			return &change, nil
+		default:
+			// Gmail label id: label the message and take it out of the inbox
+			add, remove = []string{action.Destination}, []string{"INBOX"}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported action: %s", action.Type)
+	}
+
+	m, err := a.svc.Users.Messages.Modify("me", messageID, &gmail.ModifyMessageRequest{
+		AddLabelIds:    add,
+		RemoveLabelIds: remove,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to modify message: %w", err)
+	}
+
+	// Report the dominant direction; CurrentLabels carries the full state
+	change := labelChange(m, sync.ChangeLabelsAdded, add, "")
+	if len(add) == 0 {
+		change = labelChange(m, sync.ChangeLabelsRemoved, remove, "")
+	}
+	return &change, nil
+}
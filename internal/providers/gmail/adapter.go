@@ -3,26 +3,56 @@ package gmail
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 
 	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
 	"github.com/Martian-dev/ai-brain-infra/internal/sync"
 )
 
-// Adapter implements MailProvider for Gmail
+// DefaultRateLimits keep well inside Gmail's per-user quota (250 units/s, a
+// metadata get costs 5) and leave headroom in the project-wide quota
+var DefaultRateLimits = ratelimit.Limits{Global: 400, GlobalBurst: 400, User: 40, UserBurst: 50}
+
+func init() {
+	sync.RegisterProvider(sync.ProviderInfo{
+		Name:         sync.ProviderGoogle,
+		Aliases:      []string{"google"},
+		AuthProvider: auth.ProviderGoogle,
+		Capabilities: []sync.Capability{sync.CapChanges, sync.CapHealth, sync.CapFreshness, sync.CapSend, sync.CapActions},
+		RateLimits:   DefaultRateLimits,
+		New: func(ctx context.Context, tok *auth.Token, opts sync.ProviderOptions) (sync.MailProvider, error) {
+			return New(ctx, tok, opts)
+		},
+		ScopeNeeds:    scopeNeeds,
+		GrantedScopes: grantedScopes,
+	})
+}
+
+// Adapter implements MailProvider for Gmail. It is immutable once built, so
+// the manager shares it between an account's syncs and one-off calls.
 type Adapter struct {
-	svc *gmail.Service
+	svc         *gmail.Service
+	includeSpam bool          // sync SPAM-labeled messages too
+	since       time.Time     // backfill only mail received after this; zero for all
+	timeouts    sync.Timeouts // per-call deadlines
 }
 
-// New creates a new Gmail adapter
-func New(ctx context.Context, tok *auth.Token) (*Adapter, error) {
+// New creates a new Gmail adapter. With opts.IncludeSpam, messages labeled
+// SPAM are synced as well (trash is always excluded); with
+// opts.BackfillWindow, the initial backfill stops at that age. Each API call is bounded
+// by the matching timeout and goes through opts.Transport.
+func New(ctx context.Context, tok *auth.Token, opts sync.ProviderOptions) (*Adapter, error) {
 	// Create OAuth2 client
 	oauth2Token := &oauth2.Token{
 		AccessToken:  tok.AccessToken,
@@ -35,42 +65,74 @@ func New(ctx context.Context, tok *auth.Token) (*Adapter, error) {
 	}
 
 	httpClient := config.Client(ctx, oauth2Token)
+	httpClient.Transport = opts.Transport(httpClient.Transport)
 
 	svc, err := gmail.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gmail service: %w", err)
 	}
 
-	return &Adapter{svc: svc}, nil
+	a := &Adapter{svc: svc, includeSpam: opts.IncludeSpam, timeouts: opts.Timeouts}
+	if opts.BackfillWindow > 0 {
+		a.since = time.Now().Add(-opts.BackfillWindow)
+	}
+	return a, nil
+}
+
+// getMetadata fetches a message's metadata within the Get timeout
+func (a *Adapter) getMetadata(ctx context.Context, user, id string) (*gmail.Message, error) {
+	ctx, cancel := sync.WithTimeout(ctx, a.timeouts.Get)
+	defer cancel()
+	return a.svc.Users.Messages.Get(user, id).Format("metadata").Context(ctx).Do()
 }
 
 // InitialBackfill performs full import of messages
 func (a *Adapter) InitialBackfill(ctx context.Context, user string, cp *sync.Checkpoint, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
 	// List all messages (paginated)
-	call := a.svc.Users.Messages.List(user).IncludeSpamTrash(false).MaxResults(100)
+	call := a.svc.Users.Messages.List(user).IncludeSpamTrash(a.includeSpam).MaxResults(100)
+	var query []string
+	if a.includeSpam {
+		query = append(query, "-in:trash")
+	}
+	if !a.since.IsZero() {
+		query = append(query, fmt.Sprintf("after:%d", a.since.Unix()))
+	}
+	if len(query) > 0 {
+		call = call.Q(strings.Join(query, " "))
+	}
+
+	// Paged by hand (not call.Pages) so each page request gets its own deadline
+	for pageToken := ""; ; {
+		listCtx, cancel := sync.WithTimeout(ctx, a.timeouts.List)
+		page, err := call.PageToken(pageToken).Context(listCtx).Do()
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to backfill messages: %w", err)
+		}
 
-	err := call.Pages(ctx, func(page *gmail.ListMessagesResponse) error {
 		for _, m := range page.Messages {
 			// Fetch message metadata only (requires gmail.metadata scope)
-			meta, err := a.svc.Users.Messages.Get(user, m.Id).Format("metadata").Do()
+			meta, err := a.getMetadata(ctx, user, m.Id)
 			if err != nil {
-				return fmt.Errorf("failed to get message %s: %w", m.Id, err)
+				return nil, fmt.Errorf("failed to backfill messages: failed to get message %s: %w", m.Id, err)
 			}
 
 			normalized := normalize(meta, user)
 			if err := fn(normalized); err != nil {
-				return err
+				return nil, fmt.Errorf("failed to backfill messages: %w", err)
 			}
 		}
-		return nil
-	})
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to backfill messages: %w", err)
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
 	}
 
 	// Get current history ID as checkpoint
-	profile, err := a.svc.Users.GetProfile(user).Do()
+	profileCtx, cancel := sync.WithTimeout(ctx, a.timeouts.Get)
+	defer cancel()
+	profile, err := a.svc.Users.GetProfile(user).Context(profileCtx).Do()
 	if err == nil && profile.HistoryId != 0 {
 		return &sync.Checkpoint{Cursor: fmt.Sprintf("%d", profile.HistoryId)}, nil
 	}
@@ -80,6 +142,12 @@ func (a *Adapter) InitialBackfill(ctx context.Context, user string, cp *sync.Che
 
 // IncrementalSync performs incremental sync from checkpoint
 func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Checkpoint, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
+	return a.IncrementalSyncChanges(ctx, user, cp, fn, nil)
+}
+
+// IncrementalSyncChanges performs incremental sync from checkpoint, reporting
+// label changes and deletions to onChange (if non-nil) alongside new messages
+func (a *Adapter) IncrementalSyncChanges(ctx context.Context, user string, cp sync.Checkpoint, fn func(sync.MessageMeta) error, onChange func(sync.MessageChange) error) (*sync.Checkpoint, error) {
 	if cp.Cursor == "" {
 		// No checkpoint, perform initial backfill
 		return a.InitialBackfill(ctx, user, &cp, fn)
@@ -97,7 +165,7 @@ func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Chec
 	var latestHistoryID uint64 = startHistoryID
 	processedMessages := make(map[string]bool)
 
-	err = call.Pages(ctx, func(page *gmail.ListHistoryResponse) error {
+	err = a.historyPages(ctx, call, func(page *gmail.ListHistoryResponse) error {
 		for _, history := range page.History {
 			// Update latest history ID
 			if history.Id > latestHistoryID {
@@ -112,8 +180,13 @@ func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Chec
 				}
 				processedMessages[msgID] = true
 
+				// History reports spam deliveries too; skip them unless enabled
+				if !a.includeSpam && hasLabel(record.Message.LabelIds, "SPAM") {
+					continue
+				}
+
 				// Fetch metadata only
-				meta, err := a.svc.Users.Messages.Get(user, msgID).Format("metadata").Do()
+				meta, err := a.getMetadata(ctx, user, msgID)
 				if err != nil {
 					return fmt.Errorf("failed to get message %s: %w", msgID, err)
 				}
@@ -123,6 +196,37 @@ func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Chec
 					return err
 				}
 			}
+
+			if onChange == nil {
+				continue
+			}
+
+			changeID := fmt.Sprintf("%d", history.Id)
+
+			for _, record := range history.LabelsAdded {
+				if err := onChange(labelChange(record.Message, sync.ChangeLabelsAdded, record.LabelIds, changeID)); err != nil {
+					return err
+				}
+			}
+
+			for _, record := range history.LabelsRemoved {
+				if err := onChange(labelChange(record.Message, sync.ChangeLabelsRemoved, record.LabelIds, changeID)); err != nil {
+					return err
+				}
+			}
+
+			for _, record := range history.MessagesDeleted {
+				change := sync.MessageChange{
+					Provider:  sync.ProviderGoogle,
+					MessageID: record.Message.Id,
+					ThreadID:  record.Message.ThreadId,
+					ChangeID:  changeID,
+					Type:      sync.ChangeDeleted,
+				}
+				if err := onChange(change); err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	})
@@ -139,6 +243,115 @@ func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Chec
 	return &sync.Checkpoint{Cursor: fmt.Sprintf("%d", latestHistoryID)}, nil
 }
 
+// historyPages calls fn for each page of a history listing, giving every
+// page request its own Delta deadline
+func (a *Adapter) historyPages(ctx context.Context, call *gmail.UsersHistoryListCall, fn func(*gmail.ListHistoryResponse) error) error {
+	for pageToken := ""; ; {
+		pageCtx, cancel := sync.WithTimeout(ctx, a.timeouts.Delta)
+		page, err := call.PageToken(pageToken).Context(pageCtx).Do()
+		cancel()
+		if err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// CheckHealth verifies the token with a cheap getProfile call
+func (a *Adapter) CheckHealth(ctx context.Context) error {
+	ctx, cancel := sync.WithTimeout(ctx, a.timeouts.Get)
+	defer cancel()
+
+	_, err := a.svc.Users.GetProfile("me").Context(ctx).Do()
+	if err == nil {
+		return nil
+	}
+	return a.ClassifyError(fmt.Errorf("get profile: %w", err))
+}
+
+// ClassifyError tells Gmail's token, permission, quota and server errors
+// apart (see sync.ErrorClassifier)
+func (a *Adapter) ClassifyError(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusUnauthorized:
+			return fmt.Errorf("%w: %w", sync.ErrTokenExpired, err)
+		case apiErr.Code == http.StatusTooManyRequests, apiErr.Code == http.StatusForbidden && rateLimitReason(apiErr):
+			return fmt.Errorf("%w: %w", sync.ErrRateLimited, err)
+		case apiErr.Code == http.StatusForbidden:
+			return fmt.Errorf("%w: %w", sync.ErrMissingScopes, err)
+		case apiErr.Code >= 500:
+			return fmt.Errorf("%w: %w", sync.ErrProviderUnavailable, err)
+		}
+	}
+
+	// oauth2 refresh failures surface as *oauth2.RetrieveError
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return fmt.Errorf("%w: %s: %w", sync.ErrTokenExpired, retrieveErr.ErrorCode, err)
+	}
+	return err
+}
+
+// rateLimitReason reports whether a 403 is Gmail's quota error rather than a
+// permission problem
+func rateLimitReason(apiErr *googleapi.Error) bool {
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded", "dailyLimitExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// NewestInboxMessage returns the date of the newest message in INBOX. Gmail
+// lists messages newest first, so one list call and one minimal get suffice.
+func (a *Adapter) NewestInboxMessage(ctx context.Context, user string) (time.Time, error) {
+	listCtx, cancel := sync.WithTimeout(ctx, a.timeouts.List)
+	defer cancel()
+	list, err := a.svc.Users.Messages.List(user).LabelIds("INBOX").MaxResults(1).Context(listCtx).Do()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("list inbox: %w", err)
+	}
+	if len(list.Messages) == 0 {
+		return time.Time{}, nil
+	}
+
+	getCtx, cancel := sync.WithTimeout(ctx, a.timeouts.Get)
+	defer cancel()
+	msg, err := a.svc.Users.Messages.Get(user, list.Messages[0].Id).Format("minimal").Context(getCtx).Do()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get message: %w", err)
+	}
+	return time.UnixMilli(msg.InternalDate), nil
+}
+
+// labelChange builds a MessageChange from a label history record. Gmail includes
+// the message's full label set after the change, so the folder is recomputed too.
+func labelChange(m *gmail.Message, changeType sync.ChangeType, labels []string, changeID string) sync.MessageChange {
+	isRead, isFlagged := readFlagState(m.LabelIds)
+	return sync.MessageChange{
+		Provider:      sync.ProviderGoogle,
+		MessageID:     m.Id,
+		ThreadID:      m.ThreadId,
+		ChangeID:      changeID,
+		Type:          changeType,
+		Labels:        labels,
+		CurrentLabels: m.LabelIds,
+		Folder:        gmailFolder(m.LabelIds),
+		IsRead:        &isRead,
+		IsFlagged:     &isFlagged,
+	}
+}
+
 // normalize converts Gmail message to MessageMeta
 func normalize(m *gmail.Message, userID string) sync.MessageMeta {
 	headers := make(map[string]string)
@@ -146,6 +359,8 @@ func normalize(m *gmail.Message, userID string) sync.MessageMeta {
 		headers[kv.Name] = kv.Value
 	}
 
+	isRead, isFlagged := readFlagState(m.LabelIds)
+
 	return sync.MessageMeta{
 		Provider:       sync.ProviderGoogle,
 		UserID:         userID,
@@ -159,11 +374,69 @@ func normalize(m *gmail.Message, userID string) sync.MessageMeta {
 		Bcc:            splitAddrs(headers["Bcc"]),
 		Snippet:        m.Snippet,
 		ProviderLabels: m.LabelIds,
+		Folder:         gmailFolder(m.LabelIds),
+		IsRead:         isRead,
+		IsFlagged:      isFlagged,
+		Kind:           sync.ClassifyMessage(headers["From"], headers),
+		List:           sync.DetectMailingList(headers),
 		Headers:        headers,
 		MessageDate:    time.UnixMilli(m.InternalDate),
 	}
 }
 
+// gmailFolder maps Gmail system labels onto the canonical folder taxonomy.
+// Gmail has no folders: a message without INBOX is archived, and user labels
+// (Label_*) on an archived message are treated as a custom folder.
+func gmailFolder(labels []string) sync.Folder {
+	has := make(map[string]bool, len(labels))
+	custom := false
+	for _, l := range labels {
+		has[l] = true
+		if strings.HasPrefix(l, "Label_") {
+			custom = true
+		}
+	}
+
+	switch {
+	case has["TRASH"]:
+		return sync.FolderTrash
+	case has["SPAM"]:
+		return sync.FolderSpam
+	case has["INBOX"]:
+		return sync.FolderInbox
+	case has["SENT"]:
+		return sync.FolderSent
+	case custom:
+		return sync.FolderCustom
+	default:
+		return sync.FolderArchive
+	}
+}
+
+// hasLabel reports whether labels contains label
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// readFlagState derives read and starred state from Gmail labels
+func readFlagState(labels []string) (isRead, isFlagged bool) {
+	isRead = true
+	for _, l := range labels {
+		switch l {
+		case "UNREAD":
+			isRead = false
+		case "STARRED":
+			isFlagged = true
+		}
+	}
+	return isRead, isFlagged
+}
+
 // splitAddrs parses comma-separated email addresses
 func splitAddrs(s string) []string {
 	if s == "" {
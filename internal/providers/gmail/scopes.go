@@ -0,0 +1,71 @@
+package gmail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// tokenInfoURL is Google's endpoint describing an access token
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// readScopes grant message content, and with it search queries
+var readScopes = []string{gmail.MailGoogleComScope, gmail.GmailModifyScope, gmail.GmailReadonlyScope}
+
+// scopeNeeds lists the scopes a sync with opts needs. gmail.metadata covers
+// the metadata the sync reads but not the search query that filters the
+// backfill by date or keeps trash out when syncing spam.
+func scopeNeeds(opts sync.ProviderOptions, access []sync.Access) []sync.ScopeNeed {
+	metadata := readScopes
+	if !opts.IncludeSpam && opts.BackfillWindow <= 0 {
+		metadata = append(metadata[:len(metadata):len(metadata)], gmail.GmailMetadataScope)
+	}
+	needs := []sync.ScopeNeed{{Access: sync.AccessMetadata, AnyOf: metadata}}
+	for _, a := range access {
+		switch a {
+		case sync.AccessBody:
+			needs = append(needs, sync.ScopeNeed{Access: a, AnyOf: readScopes})
+		case sync.AccessSend:
+			needs = append(needs, sync.ScopeNeed{Access: a, AnyOf: []string{
+				gmail.MailGoogleComScope, gmail.GmailModifyScope, gmail.GmailComposeScope, gmail.GmailSendScope,
+			}})
+		}
+	}
+	return needs
+}
+
+// grantedScopes asks Google's tokeninfo endpoint which scopes tok was granted
+func grantedScopes(ctx context.Context, tok *auth.Token) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenInfoURL+"?access_token="+url.QueryEscape(tok.AccessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tokeninfo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest:
+		// Google's answer for an expired or revoked token
+		return nil, fmt.Errorf("%w: tokeninfo rejected the access token", sync.ErrTokenExpired)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("tokeninfo: HTTP %d", resp.StatusCode)
+	}
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("decode tokeninfo: %w", err)
+	}
+	return strings.Fields(info.Scope), nil
+}
@@ -0,0 +1,60 @@
+package gmail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// SendMessage sends msg with messages.send. Replies carry the parent's thread id
+// plus In-Reply-To/References so Gmail threads them.
+func (a *Adapter) SendMessage(ctx context.Context, msg sync.OutgoingMessage) (*sync.SentMessage, error) {
+	out := &gmail.Message{
+		Raw:      base64.URLEncoding.EncodeToString(buildRaw(msg)),
+		ThreadId: msg.ThreadID,
+	}
+
+	sent, err := a.svc.Users.Messages.Send("me", out).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return &sync.SentMessage{MessageID: sent.Id, ThreadID: sent.ThreadId}, nil
+}
+
+// buildRaw renders msg as an RFC 5322 message. Gmail fills in From and Date.
+func buildRaw(msg sync.OutgoingMessage) []byte {
+	var b bytes.Buffer
+	header := func(name, value string) {
+		if value == "" {
+			return
+		}
+		// Strip line breaks so values can't inject extra headers
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+
+	header("To", strings.Join(msg.To, ", "))
+	header("Cc", strings.Join(msg.Cc, ", "))
+	header("Bcc", strings.Join(msg.Bcc, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("In-Reply-To", msg.InReplyTo)
+	header("References", msg.References)
+	header("MIME-Version", "1.0")
+	if msg.HTML {
+		header("Content-Type", `text/html; charset="UTF-8"`)
+	} else {
+		header("Content-Type", `text/plain; charset="UTF-8"`)
+	}
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	return b.Bytes()
+}
@@ -0,0 +1,137 @@
+package outlook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/users"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// moveTargets maps canonical folders to Graph well-known folder names
+var moveTargets = map[sync.Folder]string{
+	sync.FolderInbox:   "inbox",
+	sync.FolderSent:    "sentitems",
+	sync.FolderArchive: "archive",
+	sync.FolderSpam:    "junkemail",
+	sync.FolderTrash:   "deleteditems",
+}
+
+// ApplyAction executes action with Graph. Read state is a PATCH, labels are
+// Outlook categories, and archive/move use the move action (which assigns the
+// message a new id).
+func (a *Adapter) ApplyAction(ctx context.Context, messageID string, action sync.MessageAction) (*sync.MessageChange, error) {
+	item := a.client.Me().Messages().ByMessageId(messageID)
+
+	switch action.Type {
+	case sync.ActionRead, sync.ActionUnread:
+		isRead := action.Type == sync.ActionRead
+		patch := models.NewMessage()
+		patch.SetIsRead(&isRead)
+		m, err := item.Patch(ctx, patch, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update message: %w", err)
+		}
+		return &sync.MessageChange{
+			Provider:  sync.ProviderMicrosoft,
+			MessageID: messageID,
+			ThreadID:  stringValue(m.GetConversationId()),
+			Type:      sync.ChangeState,
+			IsRead:    &isRead,
+		}, nil
+
+	case sync.ActionAddLabels, sync.ActionRemoveLabels:
+		current, err := item.Get(ctx, &users.ItemMessagesMessageItemRequestBuilderGetRequestConfiguration{
+			QueryParameters: &users.ItemMessagesMessageItemRequestBuilderGetQueryParameters{
+				Select: []string{"categories"},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get message: %w", err)
+		}
+
+		changeType := sync.ChangeLabelsAdded
+		if action.Type == sync.ActionRemoveLabels {
+			changeType = sync.ChangeLabelsRemoved
+		}
+		categories := updateCategories(current.GetCategories(), action.Labels, changeType == sync.ChangeLabelsAdded)
+
+		patch := models.NewMessage()
+		patch.SetCategories(categories)
+		m, err := item.Patch(ctx, patch, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update categories: %w", err)
+		}
+		return &sync.MessageChange{
+			Provider:      sync.ProviderMicrosoft,
+			MessageID:     messageID,
+			ThreadID:      stringValue(m.GetConversationId()),
+			Type:          changeType,
+			Labels:        action.Labels,
+			CurrentLabels: categories,
+		}, nil
+
+	case sync.ActionArchive, sync.ActionMove:
+		destination := action.Destination
+		if action.Type == sync.ActionArchive {
+			destination = string(sync.FolderArchive)
+		}
+		if name, ok := moveTargets[sync.Folder(destination)]; ok {
+			destination = name
+		}
+
+		body := users.NewItemMessagesItemMovePostRequestBody()
+		body.SetDestinationId(&destination)
+		m, err := item.Move().Post(ctx, body, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move message: %w", err)
+		}
+
+		newID := stringValue(m.GetId())
+		if newID == "" {
+			newID = messageID
+		}
+
+		a.loadFolderIDs(ctx, "me")
+		return &sync.MessageChange{
+			Provider:     sync.ProviderMicrosoft,
+			MessageID:    messageID,
+			ThreadID:     stringValue(m.GetConversationId()),
+			Type:         sync.ChangeMoved,
+			Folder:       a.folderFor(m.GetParentFolderId()),
+			NewMessageID: newID,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported action: %s", action.Type)
+	}
+}
+
+// updateCategories adds or removes names from a category list, keeping order
+func updateCategories(current, names []string, add bool) []string {
+	drop := make(map[string]bool, len(names))
+	for _, n := range names {
+		drop[n] = true
+	}
+
+	result := make([]string, 0, len(current)+len(names))
+	for _, c := range current {
+		if !drop[c] {
+			result = append(result, c)
+		}
+	}
+	if add {
+		result = append(result, names...)
+	}
+	return result
+}
+
+// stringValue dereferences an optional Graph string
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
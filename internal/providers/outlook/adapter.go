@@ -3,119 +3,458 @@ package outlook
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	gosync "sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	azauth "github.com/microsoft/kiota-authentication-azure-go"
+	khttp "github.com/microsoft/kiota-http-go"
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	msgraphcore "github.com/microsoftgraph/msgraph-sdk-go-core"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
 	"github.com/microsoftgraph/msgraph-sdk-go/users"
 
 	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
 	"github.com/Martian-dev/ai-brain-infra/internal/sync"
 )
 
-// Adapter implements MailProvider for Outlook/Microsoft Graph
+// DefaultRateLimits stay under Graph's mailbox limit (10,000 requests per 10
+// minutes per app and mailbox) with room for the SDK's own retries
+var DefaultRateLimits = ratelimit.Limits{Global: 200, GlobalBurst: 200, User: 12, UserBurst: 20}
+
+func init() {
+	sync.RegisterProvider(sync.ProviderInfo{
+		Name:         sync.ProviderMicrosoft,
+		Aliases:      []string{"microsoft"},
+		AuthProvider: auth.ProviderMicrosoft,
+		Capabilities: []sync.Capability{sync.CapFolders, sync.CapHealth, sync.CapFreshness, sync.CapSend, sync.CapActions},
+		RateLimits:   DefaultRateLimits,
+		New: func(ctx context.Context, tok *auth.Token, opts sync.ProviderOptions) (sync.MailProvider, error) {
+			return New(ctx, tok, opts)
+		},
+		ScopeNeeds:    scopeNeeds,
+		GrantedScopes: grantedScopes,
+	})
+}
+
+// Adapter implements MailProvider for Outlook/Microsoft Graph. It is safe for
+// concurrent use, so the manager shares it between an account's syncs and
+// one-off calls.
 type Adapter struct {
-	client *msgraphsdk.GraphServiceClient
-	userID string
+	client    *msgraphsdk.GraphServiceClient
+	userID    string
+	folderMu  gosync.Mutex           // guards folderIDs and skipIDs
+	folderIDs map[string]sync.Folder // well-known folder id -> canonical folder, nil until resolved
+	skipIDs   map[string]bool        // well-known folders not synced by default
+	since     time.Time              // fresh delta rounds start at mail received after this
+	timeouts  sync.Timeouts          // per-call deadlines
+}
+
+// wellKnownFolders maps Graph well-known folder names to canonical folders
+var wellKnownFolders = map[string]sync.Folder{
+	"inbox":        sync.FolderInbox,
+	"sentitems":    sync.FolderSent,
+	"archive":      sync.FolderArchive,
+	"junkemail":    sync.FolderSpam,
+	"deleteditems": sync.FolderTrash,
 }
 
-// New creates a new Outlook adapter
-func New(ctx context.Context, tok *auth.Token, userID string) (*Adapter, error) {
+// unsyncedFolders are well-known folders left out of sync unless selected
+var unsyncedFolders = []string{"drafts", "outbox", "conversationhistory"}
+
+// New creates a new Outlook adapter for opts.UserID. With
+// opts.BackfillWindow, a folder's first delta round only covers mail of that
+// age. Each Graph call is bounded by the matching timeout and goes through
+// opts.Transport; with opts.RefreshToken the access token is replaced before
+// it expires.
+func New(ctx context.Context, tok *auth.Token, opts sync.ProviderOptions) (*Adapter, error) {
 	// Create token credential
-	cred := &staticTokenCredential{token: tok.AccessToken}
+	cred := &tokenCredential{token: tok, refresh: opts.RefreshToken}
 
-	client, err := msgraphsdk.NewGraphServiceClientWithCredentials(cred, []string{})
+	authProvider, err := azauth.NewAzureIdentityAuthenticationProviderWithScopes(cred, []string{"https://graph.microsoft.com/.default"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Graph client: %w", err)
 	}
 
-	return &Adapter{
-		client: client,
-		userID: userID,
-	}, nil
+	// Our transport sits beneath the SDK middleware, so its retries are paced
+	// and timed too
+	clientOpts := msgraphsdk.GetDefaultClientOptions()
+	httpClient := msgraphcore.GetDefaultClient(&clientOpts)
+	httpClient.Transport = khttp.NewCustomTransportWithParentTransport(
+		opts.Transport(khttp.GetDefaultTransport()),
+		msgraphcore.GetDefaultMiddlewaresWithOptions(&clientOpts)...,
+	)
+
+	adapter, err := msgraphsdk.NewGraphRequestAdapterWithParseNodeFactoryAndSerializationWriterFactoryAndHttpClient(authProvider, nil, nil, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Graph client: %w", err)
+	}
+	client := msgraphsdk.NewGraphServiceClient(adapter)
+
+	a := &Adapter{
+		client:   client,
+		userID:   opts.UserID,
+		timeouts: opts.Timeouts,
+	}
+	if opts.BackfillWindow > 0 {
+		a.since = time.Now().Add(-opts.BackfillWindow)
+	}
+	return a, nil
 }
 
-// InitialBackfill performs full import of messages
+// messageSelect is the set of message fields fetched from Graph
+var messageSelect = []string{"id", "conversationId", "subject", "from", "toRecipients", "ccRecipients", "bccRecipients", "bodyPreview", "receivedDateTime", "internetMessageHeaders", "parentFolderId", "isRead", "flag"}
+
+// InitialBackfill performs full import of messages via an initial delta round per folder
 func (a *Adapter) InitialBackfill(ctx context.Context, user string, cp *sync.Checkpoint, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
-	// Use Microsoft Graph to list messages
-	requestConfig := &users.ItemMessagesRequestBuilderGetRequestConfiguration{
-		QueryParameters: &users.ItemMessagesRequestBuilderGetQueryParameters{
-			Top:    Int32Ptr(100),
-			Select: []string{"id", "conversationId", "subject", "from", "toRecipients", "ccRecipients", "bccRecipients", "bodyPreview", "receivedDateTime", "internetMessageHeaders"},
-		},
+	var cursors map[string]string
+	if cp != nil && cp.FolderCursors != nil {
+		cursors = make(map[string]string, len(cp.FolderCursors))
+		for id := range cp.FolderCursors {
+			cursors[id] = "" // start fresh
+		}
 	}
+	return a.syncFolders(ctx, user, cursors, fn)
+}
 
-	result, err := a.client.Users().ByUserId(user).Messages().Get(ctx, requestConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list messages: %w", err)
+// IncrementalSync performs incremental sync using per-folder delta links
+func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Checkpoint, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
+	if cp.Cursor == "" {
+		// No checkpoint, perform initial backfill
+		return a.InitialBackfill(ctx, user, &cp, fn)
 	}
 
-	// Process messages
-	for _, msg := range result.GetValue() {
-		meta := normalizeOutlook(msg, user)
-		if err := fn(meta); err != nil {
+	return a.syncFolders(ctx, user, cp.FolderCursors, fn)
+}
+
+// syncFolders runs a delta round for each folder in cursors and returns the new
+// delta links. With nil cursors (folder tree unknown), every default-selected
+// folder is synced.
+func (a *Adapter) syncFolders(ctx context.Context, user string, cursors map[string]string, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
+	a.loadFolderIDs(ctx, user)
+
+	if cursors == nil {
+		folders, err := a.ListFolders(ctx, user)
+		if err != nil {
 			return nil, err
 		}
+		cursors = make(map[string]string)
+		for _, f := range folders {
+			if f.Selected {
+				cursors[f.ID] = ""
+			}
+		}
 	}
 
-	// For now, we'll use a simple cursor based on the last message ID
-	// In production, you would use the delta link from the response
-	messages := result.GetValue()
-	if len(messages) > 0 {
-		if lastMsg := messages[len(messages)-1]; lastMsg != nil {
-			if id := lastMsg.GetId(); id != nil {
-				return &sync.Checkpoint{Cursor: *id}, nil
-			}
+	next := make(map[string]string, len(cursors))
+	for folderID, deltaLink := range cursors {
+		link, err := a.syncFolder(ctx, user, folderID, deltaLink, fn)
+		if err != nil && deltaLink != "" && isSyncStateExpired(err) {
+			// Delta token expired - restart this folder from scratch
+			link, err = a.syncFolder(ctx, user, folderID, "", fn)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("folder %s: %w", folderID, err)
 		}
+		next[folderID] = link
 	}
 
-	return &sync.Checkpoint{}, nil
+	return &sync.Checkpoint{
+		Cursor:        time.Now().UTC().Format(time.RFC3339),
+		FolderCursors: next,
+	}, nil
 }
 
-// IncrementalSync performs incremental sync using delta query
-func (a *Adapter) IncrementalSync(ctx context.Context, user string, cp sync.Checkpoint, fn func(sync.MessageMeta) error) (*sync.Checkpoint, error) {
-	if cp.Cursor == "" {
-		// No checkpoint, perform initial backfill
-		return a.InitialBackfill(ctx, user, &cp, fn)
+// syncFolder pages through one delta round for a folder and returns the new delta link
+func (a *Adapter) syncFolder(ctx context.Context, user, folderID, deltaLink string, fn func(sync.MessageMeta) error) (string, error) {
+	builder := a.client.Users().ByUserId(user).MailFolders().ByMailFolderId(folderID).Messages().Delta()
+
+	var config *users.ItemMailFoldersItemMessagesDeltaRequestBuilderGetRequestConfiguration
+	if deltaLink != "" {
+		builder = builder.WithUrl(deltaLink)
+	} else {
+		config = &users.ItemMailFoldersItemMessagesDeltaRequestBuilderGetRequestConfiguration{
+			QueryParameters: &users.ItemMailFoldersItemMessagesDeltaRequestBuilderGetQueryParameters{
+				Select: messageSelect,
+			},
+		}
+		if !a.since.IsZero() {
+			filter := "receivedDateTime ge " + a.since.UTC().Format(time.RFC3339)
+			config.QueryParameters.Filter = &filter
+		}
+	}
+
+	for {
+		pageCtx, cancel := sync.WithTimeout(ctx, a.timeouts.Delta)
+		page, err := builder.GetAsDeltaGetResponse(pageCtx, config)
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("delta query failed: %w", err)
+		}
+
+		for _, msg := range page.GetValue() {
+			// Removed messages only carry an id and the @removed annotation
+			if _, removed := msg.GetAdditionalData()["@removed"]; removed {
+				continue
+			}
+
+			meta := normalizeOutlook(msg, user)
+			meta.Folder = a.folderFor(msg.GetParentFolderId())
+			if err := fn(meta); err != nil {
+				return "", err
+			}
+		}
+
+		if next := page.GetOdataNextLink(); next != nil && *next != "" {
+			builder = builder.WithUrl(*next)
+			config = nil
+			continue
+		}
+
+		if delta := page.GetOdataDeltaLink(); delta != nil {
+			return *delta, nil
+		}
+		return "", nil
 	}
+}
+
+// isSyncStateExpired reports whether Graph rejected a stale delta token
+func isSyncStateExpired(err error) bool {
+	var apiErr abstractions.ApiErrorable
+	return errors.As(err, &apiErr) && apiErr.GetStatusCode() == http.StatusGone
+}
 
-	// Use delta link for incremental sync
-	// Note: In production, you'd use the delta link URL directly
-	// For now, we'll use the regular messages endpoint with filter
-	requestConfig := &users.ItemMessagesRequestBuilderGetRequestConfiguration{
-		QueryParameters: &users.ItemMessagesRequestBuilderGetQueryParameters{
-			Top:    Int32Ptr(100),
-			Select: []string{"id", "conversationId", "subject", "from", "toRecipients", "ccRecipients", "bccRecipients", "bodyPreview", "receivedDateTime", "internetMessageHeaders"},
+// ListFolders walks the user's mail folder tree
+func (a *Adapter) ListFolders(ctx context.Context, user string) ([]sync.MailFolder, error) {
+	a.loadFolderIDs(ctx, user)
+
+	listCtx, cancel := sync.WithTimeout(ctx, a.timeouts.List)
+	result, err := a.client.Users().ByUserId(user).MailFolders().Get(listCtx, &users.ItemMailFoldersRequestBuilderGetRequestConfiguration{
+		QueryParameters: &users.ItemMailFoldersRequestBuilderGetQueryParameters{
+			Top: Int32Ptr(100),
 		},
+	})
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+
+	var folders []sync.MailFolder
+	for {
+		for _, f := range result.GetValue() {
+			sub, err := a.walkFolder(ctx, user, f)
+			if err != nil {
+				return nil, err
+			}
+			folders = append(folders, sub...)
+		}
+
+		next := result.GetOdataNextLink()
+		if next == nil || *next == "" {
+			break
+		}
+		listCtx, cancel := sync.WithTimeout(ctx, a.timeouts.List)
+		result, err = a.client.Users().ByUserId(user).MailFolders().WithUrl(*next).Get(listCtx, nil)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list folders: %w", err)
+		}
 	}
 
-	result, err := a.client.Users().ByUserId(user).Messages().Get(ctx, requestConfig)
+	return folders, nil
+}
+
+// walkFolder returns f and all of its descendants
+func (a *Adapter) walkFolder(ctx context.Context, user string, f models.MailFolderable) ([]sync.MailFolder, error) {
+	if f.GetId() == nil {
+		return nil, nil
+	}
+
+	folder := sync.MailFolder{
+		ID:     *f.GetId(),
+		Folder: a.folderFor(f.GetId()),
+	}
+	if parent := f.GetParentFolderId(); parent != nil {
+		folder.ParentID = *parent
+	}
+	if name := f.GetDisplayName(); name != nil {
+		folder.Name = *name
+	}
+	folder.Selected = folder.Folder != sync.FolderSpam && folder.Folder != sync.FolderTrash && !a.skipped(folder.ID)
+
+	folders := []sync.MailFolder{folder}
+	if count := f.GetChildFolderCount(); count == nil || *count == 0 {
+		return folders, nil
+	}
+
+	listCtx, cancel := sync.WithTimeout(ctx, a.timeouts.List)
+	children, err := a.client.Users().ByUserId(user).MailFolders().ByMailFolderId(folder.ID).ChildFolders().Get(listCtx, &users.ItemMailFoldersItemChildFoldersRequestBuilderGetRequestConfiguration{
+		QueryParameters: &users.ItemMailFoldersItemChildFoldersRequestBuilderGetQueryParameters{
+			Top: Int32Ptr(100),
+		},
+	})
+	cancel()
 	if err != nil {
-		return nil, fmt.Errorf("failed to sync messages: %w", err)
+		return nil, fmt.Errorf("failed to list child folders of %s: %w", folder.ID, err)
 	}
 
-	// Process new/updated messages
-	for _, msg := range result.GetValue() {
-		meta := normalizeOutlook(msg, user)
-		if err := fn(meta); err != nil {
+	for _, child := range children.GetValue() {
+		sub, err := a.walkFolder(ctx, user, child)
+		if err != nil {
 			return nil, err
 		}
+		folders = append(folders, sub...)
 	}
 
-	// Update checkpoint with the last message ID
-	messages := result.GetValue()
-	if len(messages) > 0 {
-		if lastMsg := messages[len(messages)-1]; lastMsg != nil {
-			if id := lastMsg.GetId(); id != nil {
-				return &sync.Checkpoint{Cursor: *id}, nil
-			}
+	return folders, nil
+}
+
+// loadFolderIDs resolves the ids of the well-known folders once per adapter;
+// concurrent callers wait for the one resolving. The ids are kept only once
+// every lookup succeeded, so after a Graph error the next call tries again
+// (folders map to custom until then). Folders that don't exist (e.g. no
+// archive folder) are skipped. The ids outlive the call, so the lookups
+// ignore ctx's cancellation and are bounded by the Get timeout alone.
+func (a *Adapter) loadFolderIDs(ctx context.Context, user string) {
+	a.folderMu.Lock()
+	defer a.folderMu.Unlock()
+	if a.folderIDs != nil {
+		return
+	}
+
+	folderIDs, skipIDs, err := a.resolveFolderIDs(context.WithoutCancel(ctx), user)
+	if err != nil {
+		log.Printf("Error resolving Outlook folders for user %s, retrying on next use: %v", a.userID, err)
+		return
+	}
+	a.folderIDs, a.skipIDs = folderIDs, skipIDs
+}
+
+func (a *Adapter) resolveFolderIDs(ctx context.Context, user string) (map[string]sync.Folder, map[string]bool, error) {
+	folderIDs := make(map[string]sync.Folder, len(wellKnownFolders))
+	for name, folder := range wellKnownFolders {
+		id, err := a.wellKnownFolderID(ctx, user, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id != "" {
+			folderIDs[id] = folder
+		}
+	}
+
+	skipIDs := make(map[string]bool, len(unsyncedFolders))
+	for _, name := range unsyncedFolders {
+		id, err := a.wellKnownFolderID(ctx, user, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if id != "" {
+			skipIDs[id] = true
 		}
 	}
+	return folderIDs, skipIDs, nil
+}
+
+// wellKnownFolderID resolves a well-known folder name to its id ("" if the
+// mailbox has no such folder)
+func (a *Adapter) wellKnownFolderID(ctx context.Context, user, name string) (string, error) {
+	ctx, cancel := sync.WithTimeout(ctx, a.timeouts.Get)
+	defer cancel()
+
+	f, err := a.client.Users().ByUserId(user).MailFolders().ByMailFolderId(name).Get(ctx, nil)
+	var apiErr abstractions.ApiErrorable
+	if errors.As(err, &apiErr) && apiErr.GetStatusCode() == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolve folder %s: %w", name, err)
+	}
+	if f == nil || f.GetId() == nil {
+		return "", nil
+	}
+	return *f.GetId(), nil
+}
 
-	return &sync.Checkpoint{Cursor: cp.Cursor}, nil
+// folderFor maps a message's parent folder id to a canonical folder
+func (a *Adapter) folderFor(parentFolderID *string) sync.Folder {
+	if parentFolderID == nil {
+		return sync.FolderCustom
+	}
+	a.folderMu.Lock()
+	defer a.folderMu.Unlock()
+	if folder, ok := a.folderIDs[*parentFolderID]; ok {
+		return folder
+	}
+	return sync.FolderCustom
+}
+
+// skipped reports whether a folder is a well-known one not synced by default
+func (a *Adapter) skipped(folderID string) bool {
+	a.folderMu.Lock()
+	defer a.folderMu.Unlock()
+	return a.skipIDs[folderID]
+}
+
+// CheckHealth verifies the token with a cheap Graph /me call
+func (a *Adapter) CheckHealth(ctx context.Context) error {
+	ctx, cancel := sync.WithTimeout(ctx, a.timeouts.Get)
+	defer cancel()
+
+	_, err := a.client.Me().Get(ctx, nil)
+	if err == nil {
+		return nil
+	}
+	return a.ClassifyError(fmt.Errorf("get /me: %w", err))
+}
+
+// ClassifyError tells Graph's token, permission, throttling and server errors
+// apart (see sync.ErrorClassifier)
+func (a *Adapter) ClassifyError(err error) error {
+	var apiErr abstractions.ApiErrorable
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.GetStatusCode(); {
+		case code == http.StatusUnauthorized:
+			return fmt.Errorf("%w: %w", sync.ErrTokenExpired, err)
+		case code == http.StatusForbidden:
+			return fmt.Errorf("%w: %w", sync.ErrMissingScopes, err)
+		case code == http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %w", sync.ErrRateLimited, err)
+		case code >= 500:
+			return fmt.Errorf("%w: %w", sync.ErrProviderUnavailable, err)
+		}
+	}
+	return err
+}
+
+// NewestInboxMessage returns the receive time of the newest message in the
+// inbox folder
+func (a *Adapter) NewestInboxMessage(ctx context.Context, user string) (time.Time, error) {
+	ctx, cancel := sync.WithTimeout(ctx, a.timeouts.List)
+	defer cancel()
+
+	result, err := a.client.Users().ByUserId(user).MailFolders().ByMailFolderId("inbox").Messages().Get(ctx, &users.ItemMailFoldersItemMessagesRequestBuilderGetRequestConfiguration{
+		QueryParameters: &users.ItemMailFoldersItemMessagesRequestBuilderGetQueryParameters{
+			Top:     Int32Ptr(1),
+			Orderby: []string{"receivedDateTime desc"},
+			Select:  []string{"receivedDateTime"},
+		},
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("list inbox: %w", err)
+	}
+
+	msgs := result.GetValue()
+	if len(msgs) == 0 || msgs[0].GetReceivedDateTime() == nil {
+		return time.Time{}, nil
+	}
+	return *msgs[0].GetReceivedDateTime(), nil
 }
 
 // normalizeOutlook converts Outlook message to MessageMeta
@@ -166,6 +505,16 @@ func normalizeOutlook(m models.Messageable, userID string) sync.MessageMeta {
 		meta.MessageDate = *rcvd
 	}
 
+	if isRead := m.GetIsRead(); isRead != nil {
+		meta.IsRead = *isRead
+	}
+
+	if flag := m.GetFlag(); flag != nil {
+		if status := flag.GetFlagStatus(); status != nil {
+			meta.IsFlagged = *status == models.FLAGGED_FOLLOWUPFLAGSTATUS
+		}
+	}
+
 	// Extract headers
 	meta.Headers = make(map[string]string)
 	if headers := m.GetInternetMessageHeaders(); headers != nil {
@@ -178,6 +527,9 @@ func normalizeOutlook(m models.Messageable, userID string) sync.MessageMeta {
 		}
 	}
 
+	meta.Kind = sync.ClassifyMessage(meta.Sender, meta.Headers)
+	meta.List = sync.DetectMailingList(meta.Headers)
+
 	return meta
 }
 
@@ -194,18 +546,61 @@ func extractAddresses(recipients []models.Recipientable) []string {
 	return addrs
 }
 
-// staticTokenCredential implements Azure credential interface
-type staticTokenCredential struct {
-	token string
+// tokenRefreshMargin is how long before its expiry an access token is
+// replaced, so calls in flight don't carry a lapsing token
+const tokenRefreshMargin = 5 * time.Minute
+
+// unknownTokenLifetime is the lifetime assumed for tokens without an expiry
+const unknownTokenLifetime = time.Hour
+
+// tokenCredential implements the Azure credential interface with the token
+// from BetterAuth, fetching a new one through refresh when it nears expiry
+type tokenCredential struct {
+	mu      gosync.Mutex
+	token   *auth.Token
+	refresh func(ctx context.Context) (*auth.Token, error) // nil keeps the token until it lapses
 }
 
-func (c *staticTokenCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+func (c *tokenCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiry, known := c.expiry()
+	if known && c.refresh != nil && time.Until(expiry) < tokenRefreshMargin {
+		tok, err := c.refresh(ctx)
+		switch {
+		case err == nil:
+			c.token = tok
+			expiry, known = c.expiry()
+		case time.Now().Before(expiry):
+			// Still valid; the next call tries again
+			log.Printf("Outlook token refresh failed, using current token until %s: %v", expiry.Format(time.RFC3339), err)
+		case errors.Is(err, auth.ErrAuthServer):
+			// BetterAuth is down, the grant may be fine
+			return azcore.AccessToken{}, fmt.Errorf("refresh failed: %w", err)
+		default:
+			return azcore.AccessToken{}, fmt.Errorf("%w: refresh failed: %v", sync.ErrTokenExpired, err)
+		}
+	}
+	if !known {
+		expiry = time.Now().Add(unknownTokenLifetime)
+	}
 	return azcore.AccessToken{
-		Token:     c.token,
-		ExpiresOn: time.Now().Add(1 * time.Hour),
+		Token:     c.token.AccessToken,
+		ExpiresOn: expiry,
+		RefreshOn: expiry.Add(-tokenRefreshMargin),
 	}, nil
 }
 
+// expiry returns when the current token expires, or false if BetterAuth
+// didn't say
+func (c *tokenCredential) expiry() (time.Time, bool) {
+	if c.token.Expiry.Unix() <= 0 {
+		return time.Time{}, false
+	}
+	return c.token.Expiry, true
+}
+
 // Int32Ptr returns a pointer to an int32
 func Int32Ptr(i int32) *int32 {
 	return &i
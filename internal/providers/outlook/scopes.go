@@ -0,0 +1,50 @@
+package outlook
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// readScopes grant message content. The sync reads bodyPreview and internet
+// message headers, which Mail.ReadBasic leaves out, so it needs them too.
+var readScopes = []string{"Mail.Read", "Mail.ReadWrite"}
+
+// scopeNeeds lists the Graph permissions a sync needs
+func scopeNeeds(_ sync.ProviderOptions, access []sync.Access) []sync.ScopeNeed {
+	needs := []sync.ScopeNeed{{Access: sync.AccessMetadata, AnyOf: readScopes}}
+	for _, a := range access {
+		switch a {
+		case sync.AccessBody:
+			needs = append(needs, sync.ScopeNeed{Access: a, AnyOf: readScopes})
+		case sync.AccessSend:
+			needs = append(needs, sync.ScopeNeed{Access: a, AnyOf: []string{"Mail.Send"}})
+		}
+	}
+	return needs
+}
+
+// grantedScopes reads the delegated permissions from the scp claim of a
+// Graph access token. Tokens of personal Microsoft accounts aren't JWTs and
+// can't be read; they aren't checked.
+func grantedScopes(_ context.Context, tok *auth.Token) ([]string, error) {
+	parts := strings.Split(tok.AccessToken, ".")
+	if len(parts) != 3 {
+		return nil, nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil
+	}
+	var claims struct {
+		Scp string `json:"scp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Scp == "" {
+		return nil, nil
+	}
+	return strings.Fields(claims.Scp), nil
+}
@@ -0,0 +1,74 @@
+package outlook
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/users"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// SendMessage sends msg with sendMail, or through the parent message's reply
+// action for replies so Outlook keeps the conversation. Graph returns no ids.
+func (a *Adapter) SendMessage(ctx context.Context, msg sync.OutgoingMessage) (*sync.SentMessage, error) {
+	message := models.NewMessage()
+	if msg.Subject != "" {
+		message.SetSubject(&msg.Subject)
+	}
+
+	body := models.NewItemBody()
+	contentType := models.TEXT_BODYTYPE
+	if msg.HTML {
+		contentType = models.HTML_BODYTYPE
+	}
+	body.SetContentType(&contentType)
+	body.SetContent(&msg.Body)
+	message.SetBody(body)
+
+	message.SetToRecipients(recipients(msg.To))
+	message.SetCcRecipients(recipients(msg.Cc))
+	message.SetBccRecipients(recipients(msg.Bcc))
+
+	if msg.ReplyToMessageID != "" {
+		reply := users.NewItemMessagesItemReplyPostRequestBody()
+		reply.SetMessage(message)
+		if err := a.client.Me().Messages().ByMessageId(msg.ReplyToMessageID).Reply().Post(ctx, reply, nil); err != nil {
+			return nil, fmt.Errorf("failed to send reply: %w", err)
+		}
+		return &sync.SentMessage{ThreadID: msg.ThreadID}, nil
+	}
+
+	req := users.NewItemSendMailPostRequestBody()
+	req.SetMessage(message)
+	save := true
+	req.SetSaveToSentItems(&save)
+	if err := a.client.Me().SendMail().Post(ctx, req, nil); err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return &sync.SentMessage{}, nil
+}
+
+// recipients converts addresses ("a@b" or "Name <a@b>") into Graph recipients
+func recipients(addrs []string) []models.Recipientable {
+	result := make([]models.Recipientable, 0, len(addrs))
+	for _, addr := range addrs {
+		email := models.NewEmailAddress()
+		if parsed, err := mail.ParseAddress(addr); err == nil {
+			email.SetAddress(&parsed.Address)
+			if parsed.Name != "" {
+				email.SetName(&parsed.Name)
+			}
+		} else {
+			address := addr
+			email.SetAddress(&address)
+		}
+		r := models.NewRecipient()
+		r.SetEmailAddress(email)
+		result = append(result, r)
+	}
+	return result
+}
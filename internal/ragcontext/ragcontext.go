@@ -0,0 +1,488 @@
+// Package ragcontext assembles what the user's brain knows about a topic into
+// one text block for other services' language model calls: the most relevant
+// emails, memory facts (memory.fact events posted to /events) and upcoming
+// calendar proposals, ranked together and cut to a token budget.
+//
+// With an embedding model, relevance is cosine similarity to the topic;
+// without one it is the share of the topic's words an item contains. Recent
+// items (and proposals close to now) get a small boost either way.
+package ragcontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+	"github.com/Martian-dev/ai-brain-infra/internal/semantic"
+)
+
+// ErrEmptyTopic is returned for a blank topic
+var ErrEmptyTopic = errors.New("topic is required")
+
+// Item kinds, also the values of Request.Include
+const (
+	KindEmail    = "email"
+	KindFact     = "fact"
+	KindCalendar = "calendar"
+)
+
+// Token budget limits
+const (
+	DefaultMaxTokens = 2000
+	MaxTokens        = 32000
+)
+
+// MaxFacts is how many memory facts are ranked, newest first
+const MaxFacts = 200
+
+const (
+	// candidates is how many emails and proposals are ranked
+	candidates = 50
+	// minSimilarity drops items an embedding model finds unrelated
+	minSimilarity = 0.2
+	// minTruncated is the smallest remainder an item is cut down to fit
+	minTruncated = 40
+	// recencyHalfLife halves the recency boost
+	recencyHalfLife = 30 * 24 * time.Hour
+	// bytesPerToken estimates tokens from text length; close enough for
+	// English with common tokenizers
+	bytesPerToken = 4
+)
+
+// sections are rendered in this order
+var sections = []struct{ kind, title string }{
+	{KindEmail, "Emails"},
+	{KindFact, "Memory"},
+	{KindCalendar, "Calendar"},
+}
+
+// Fact is a memory fact about the user
+type Fact struct {
+	ID        string
+	Text      string
+	CreatedAt int64
+}
+
+// Request asks for context on a topic
+type Request struct {
+	Topic     string
+	MaxTokens int      // 0 for DefaultMaxTokens
+	Include   []string // kinds to include, empty for all
+}
+
+// Item is one piece of the assembled context
+type Item struct {
+	Kind              string  `json:"kind"`
+	ID                string  `json:"id"` // email event id, fact event id, or provider message id of a proposal
+	Score             float64 `json:"score"`
+	Tokens            int     `json:"tokens"`
+	Truncated         bool    `json:"truncated,omitempty"`
+	Provider          string  `json:"provider,omitempty"`
+	ProviderMessageID string  `json:"provider_message_id,omitempty"`
+	ProviderThreadID  string  `json:"provider_thread_id,omitempty"`
+
+	text string
+}
+
+// Context is the assembled block and what went into it
+type Context struct {
+	Topic     string `json:"topic"`
+	Context   string `json:"context"`
+	Tokens    int    `json:"tokens"` // estimated
+	MaxTokens int    `json:"max_tokens"`
+	Items     []Item `json:"items"`
+	Dropped   int    `json:"dropped"` // relevant items that didn't fit
+	Semantic  bool   `json:"semantic"`
+}
+
+// Builder assembles context
+type Builder struct {
+	llm llm.Client // nil or without embeddings: lexical ranking
+	now func() time.Time
+}
+
+// New creates a builder. client may be nil.
+func New(client llm.Client) *Builder {
+	return &Builder{llm: client, now: time.Now}
+}
+
+// Build assembles context on req.Topic from the user's mail and calendar in
+// reader and their memory facts, newest first
+func (b *Builder) Build(ctx context.Context, reader eventstore.Reader, facts []Fact, req Request) (*Context, error) {
+	topic := strings.TrimSpace(req.Topic)
+	if topic == "" {
+		return nil, ErrEmptyTopic
+	}
+	budget := req.MaxTokens
+	if budget <= 0 {
+		budget = DefaultMaxTokens
+	}
+	include := map[string]bool{}
+	for _, kind := range req.Include {
+		include[kind] = true
+	}
+	wants := func(kind string) bool { return len(include) == 0 || include[kind] }
+
+	r := &ranker{now: b.now(), terms: terms(topic)}
+	if b.llm != nil && b.llm.EmbeddingModel() != "" {
+		r.llm = b.llm
+		vectors, err := b.llm.Embed(ctx, []string{topic})
+		if err != nil {
+			return nil, fmt.Errorf("embed topic: %w", err)
+		}
+		r.topic = vectors[0]
+	}
+
+	var items []Item
+	if wants(KindEmail) {
+		emails, err := r.emails(ctx, reader)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, emails...)
+	}
+	if wants(KindFact) {
+		ranked, err := r.facts(ctx, facts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, ranked...)
+	}
+	if wants(KindCalendar) {
+		suggestions, err := reader.CalendarSuggestions(ctx, r.now.Unix(), candidates)
+		if err != nil {
+			return nil, err
+		}
+		ranked, err := r.calendar(ctx, suggestions)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, ranked...)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Score > items[j].Score })
+	out := fill(items, budget)
+	out.Topic, out.MaxTokens, out.Semantic = topic, budget, r.topic != nil
+	return out, nil
+}
+
+// ranker scores items against the topic
+type ranker struct {
+	now   time.Time
+	terms []string
+	llm   llm.Client
+	topic []float32 // nil for lexical ranking
+}
+
+// emails ranks the user's messages: by embedding when available, otherwise
+// the messages containing any topic word
+func (r *ranker) emails(ctx context.Context, reader eventstore.Reader) ([]Item, error) {
+	var msgs []eventstore.ScoredMessage
+	if r.topic != nil {
+		found, err := reader.SemanticSearch(ctx, eventstore.SemanticQuery{
+			Vector:   r.topic,
+			Model:    r.llm.EmbeddingModel(),
+			MinScore: minSimilarity,
+			Limit:    candidates,
+		})
+		if err != nil {
+			return nil, err
+		}
+		msgs = found
+	} else {
+		seen := map[string]bool{}
+		for _, term := range r.terms {
+			q := &search.Query{Clauses: []search.Clause{{Field: search.FieldText, Value: term}}}
+			found, err := reader.SearchMessages(ctx, q, candidates)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range found {
+				if !seen[m.EventID] {
+					seen[m.EventID] = true
+					msgs = append(msgs, eventstore.ScoredMessage{StoredMessage: m, Score: r.lexical(semantic.Text(m.Subject, m.Sender, m.Snippet, ""))})
+				}
+			}
+		}
+	}
+
+	items := make([]Item, 0, len(msgs))
+	for _, m := range msgs {
+		text := fmt.Sprintf("- %s | From: %s | Subject: %s\n  %s",
+			time.Unix(m.MsgDate, 0).UTC().Format("2006-01-02 15:04 UTC"), m.Sender, m.Subject, oneLine(m.Snippet))
+		if tr := m.Translation; tr != nil {
+			text += fmt.Sprintf("\n  Translation (%s): %s - %s", tr.Language, tr.Subject, oneLine(tr.Snippet))
+		}
+		items = append(items, Item{
+			Kind:              KindEmail,
+			ID:                m.EventID,
+			Score:             round(m.Score * r.recency(m.MsgDate)),
+			Provider:          m.Provider,
+			ProviderMessageID: m.ProviderMessageID,
+			ProviderThreadID:  m.ProviderThreadID,
+			text:              text,
+		})
+	}
+	return items, nil
+}
+
+// facts ranks the newest MaxFacts memory facts
+func (r *ranker) facts(ctx context.Context, facts []Fact) ([]Item, error) {
+	if len(facts) > MaxFacts {
+		facts = facts[:MaxFacts]
+	}
+	texts := make([]string, len(facts))
+	for i, f := range facts {
+		texts[i] = f.Text
+	}
+	scores, err := r.similarities(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for i, f := range facts {
+		if scores[i] <= 0 {
+			continue
+		}
+		items = append(items, Item{
+			Kind:  KindFact,
+			ID:    f.ID,
+			Score: round(scores[i] * r.recency(f.CreatedAt)),
+			text:  "- " + oneLine(f.Text),
+		})
+	}
+	return items, nil
+}
+
+// calendar ranks upcoming meeting proposals; the sooner, the bigger the boost
+func (r *ranker) calendar(ctx context.Context, suggestions []eventstore.CalendarSuggestion) ([]Item, error) {
+	texts := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		texts[i] = s.Title + " " + strings.Join(s.Attendees, " ")
+	}
+	scores, err := r.similarities(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for i, s := range suggestions {
+		if scores[i] <= 0 {
+			continue
+		}
+		when := s.StartsAt
+		if when == 0 {
+			when = s.CreatedAt
+		}
+		items = append(items, Item{
+			Kind:              KindCalendar,
+			ID:                s.ProviderMessageID,
+			Score:             round(scores[i] * r.recency(when)),
+			Provider:          s.Provider,
+			ProviderMessageID: s.ProviderMessageID,
+			ProviderThreadID:  s.ProviderThreadID,
+			text:              proposal(s),
+		})
+	}
+	return items, nil
+}
+
+// similarities scores texts against the topic, 0 for unrelated ones
+func (r *ranker) similarities(ctx context.Context, texts []string) ([]float64, error) {
+	scores := make([]float64, len(texts))
+	if len(texts) == 0 {
+		return scores, nil
+	}
+	if r.topic == nil {
+		for i, text := range texts {
+			scores[i] = r.lexical(text)
+		}
+		return scores, nil
+	}
+
+	vectors, err := r.llm.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("embed context items: %w", err)
+	}
+	for i, v := range vectors {
+		if sim := llm.Cosine(r.topic, v); sim >= minSimilarity {
+			scores[i] = sim
+		}
+	}
+	return scores, nil
+}
+
+// lexical is the share of topic words text contains
+func (r *ranker) lexical(text string) float64 {
+	if len(r.terms) == 0 {
+		return 0
+	}
+	words := map[string]bool{}
+	for _, w := range terms(text) {
+		words[w] = true
+	}
+	matched := 0
+	for _, t := range r.terms {
+		if words[t] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(r.terms))
+}
+
+// recency is a boost between 0.85 and 1 that halves its bonus every
+// recencyHalfLife away from now
+func (r *ranker) recency(ts int64) float64 {
+	age := math.Abs(float64(r.now.Unix() - ts))
+	return 0.85 + 0.15*math.Pow(0.5, age/recencyHalfLife.Seconds())
+}
+
+// fill takes ranked items until the budget is spent and renders them by
+// section. No item may take more than a quarter of the budget, so one long
+// message can't crowd out the rest; an item that doesn't fit is cut down if
+// enough room is left.
+func fill(items []Item, budget int) *Context {
+	out := &Context{Items: []Item{}}
+	used := 0
+	itemCap := max(budget/4, minTruncated)
+	headed := map[string]bool{}
+	for _, it := range items {
+		cost := tokens(it.text + "\n")
+		if cost > itemCap {
+			it.text = truncate(it.text, (itemCap-1)*bytesPerToken)
+			it.Truncated = true
+			cost = tokens(it.text + "\n")
+		}
+		header := 0
+		if !headed[it.Kind] {
+			header = tokens("### " + sectionTitle(it.Kind) + "\n\n")
+		}
+
+		left := budget - used - header
+		if cost > left {
+			if left < minTruncated {
+				out.Dropped++
+				continue
+			}
+			it.text = truncate(it.text, (left-1)*bytesPerToken)
+			it.Truncated = true
+			cost = tokens(it.text + "\n")
+		}
+		headed[it.Kind] = true
+		used += header + cost
+		it.Tokens = cost
+		out.Items = append(out.Items, it)
+	}
+
+	var block strings.Builder
+	for _, sec := range sections {
+		if !headed[sec.kind] {
+			continue
+		}
+		if block.Len() > 0 {
+			block.WriteString("\n")
+		}
+		block.WriteString("### " + sec.title + "\n\n")
+		for _, it := range out.Items {
+			if it.Kind == sec.kind {
+				block.WriteString(it.text + "\n")
+			}
+		}
+	}
+	out.Context = block.String()
+	out.Tokens = used
+	return out
+}
+
+func sectionTitle(kind string) string {
+	for _, sec := range sections {
+		if sec.kind == kind {
+			return sec.title
+		}
+	}
+	return kind
+}
+
+// proposal renders a meeting proposal with its first candidate time
+func proposal(s eventstore.CalendarSuggestion) string {
+	var b strings.Builder
+	b.WriteString("- " + s.Title)
+	if len(s.Candidates) > 0 {
+		c := s.Candidates[0]
+		if c.AllDay {
+			b.WriteString(" | " + c.Start.Format("Mon 2006-01-02") + " (all day)")
+		} else {
+			b.WriteString(" | " + c.Start.Format("Mon 2006-01-02 15:04") + "-" + c.End.Format("15:04 -0700"))
+		}
+		if more := len(s.Candidates) - 1; more > 0 {
+			fmt.Fprintf(&b, " (or %d other times)", more)
+		}
+	}
+	if len(s.Attendees) > 0 {
+		b.WriteString(" | With: " + strings.Join(s.Attendees, ", "))
+	}
+	if s.ConferenceURL != "" {
+		b.WriteString(" | " + s.ConferenceURL)
+	}
+	return b.String()
+}
+
+// stopWords are skipped when matching topics word by word
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "about": true, "from": true,
+	"that": true, "this": true, "what": true, "when": true, "who": true, "are": true,
+	"was": true, "were": true, "has": true, "have": true, "any": true, "all": true,
+	"our": true, "your": true, "you": true, "did": true, "does": true, "how": true,
+}
+
+// terms returns the distinct lowercase words of text worth matching
+func terms(text string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if utf8.RuneCountInString(w) < 3 || stopWords[w] || seen[w] {
+			continue
+		}
+		seen[w] = true
+		out = append(out, w)
+	}
+	return out
+}
+
+// tokens estimates the tokens of text
+func tokens(text string) int {
+	return (len(text) + bytesPerToken - 1) / bytesPerToken
+}
+
+// truncate cuts text to at most n bytes on a rune boundary, marking the cut
+func truncate(text string, n int) string {
+	const ellipsis = "…"
+	if len(text) <= n {
+		return text
+	}
+	n -= len(ellipsis)
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:max(n, 0)] + ellipsis
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
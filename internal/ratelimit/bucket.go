@@ -0,0 +1,150 @@
+// Package ratelimit paces outgoing provider API calls with token buckets whose
+// rate adapts to throttling (additive increase, multiplicative decrease).
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// adjustInterval is the minimum time between two rate changes, so a burst of
+// in-flight requests throttled together only halves the rate once
+const adjustInterval = time.Second
+
+// Bucket is a token bucket whose refill rate moves between a floor and a
+// ceiling: it climbs back by a fixed step while calls succeed and halves when
+// the provider throttles.
+type Bucket struct {
+	mu         sync.Mutex
+	max        float64 // configured rate, tokens per second
+	min        float64 // floor the rate never drops below
+	rate       float64 // current rate
+	burst      float64
+	tokens     float64
+	last       time.Time // last refill
+	lastAdjust time.Time // last rate change
+}
+
+// NewBucket creates a full bucket refilled at rate tokens per second. A
+// non-positive rate means unlimited and returns nil, which never blocks.
+func NewBucket(rate float64, burst int) *Bucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(max(burst, 1))
+	return &Bucket{
+		max:    rate,
+		min:    math.Max(rate/20, 0.1),
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens earned since the last refill. Callers hold b.mu.
+func (b *Bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// Wait takes one token, sleeping until one is available or ctx is done
+func (b *Bucket) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.refill(now)
+	b.tokens-- // reserve now, possibly going negative; the debt is slept off
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// Give the token back so a cancelled call doesn't slow the others
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Allow takes one token if one is available without waiting. Otherwise it
+// takes nothing and returns how long until one is.
+func (b *Bucket) Allow() (bool, time.Duration) {
+	if b == nil {
+		return true, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Success raises the rate by a twentieth of the configured rate, up to it
+func (b *Bucket) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate >= b.max || time.Since(b.lastAdjust) < adjustInterval {
+		return
+	}
+	b.refill(time.Now())
+	b.rate = math.Min(b.max, b.rate+b.max/20)
+	b.lastAdjust = time.Now()
+}
+
+// Throttled halves the rate, down to the floor, and drops any saved burst
+func (b *Bucket) Throttled() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Since(b.lastAdjust) < adjustInterval {
+		return
+	}
+	b.refill(time.Now())
+	b.rate = math.Max(b.min, b.rate/2)
+	b.tokens = math.Min(b.tokens, 0)
+	b.lastAdjust = time.Now()
+}
+
+// Rate returns the current rate in tokens per second (0 for unlimited)
+func (b *Bucket) Rate() float64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+// idle reports whether the bucket is full at its configured rate and unused
+// since before cutoff, so dropping it loses nothing
+func (b *Bucket) idle(cutoff time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate >= b.max && b.last.Before(cutoff)
+}
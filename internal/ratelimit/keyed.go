@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Keyed throttles incoming requests with a fixed-rate bucket per key, such
+// as a user id. Unlike Limiter it never waits: callers reject what Allow
+// refuses.
+type Keyed struct {
+	rate      float64
+	burst     int
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// NewKeyed creates a limiter allowing rate requests per second per key with
+// bursts of burst. A non-positive rate means unlimited and returns nil, which
+// allows everything.
+func NewKeyed(rate float64, burst int) *Keyed {
+	if rate <= 0 {
+		return nil
+	}
+	return &Keyed{rate: rate, burst: burst, buckets: make(map[string]*Bucket), lastSweep: time.Now()}
+}
+
+// Allow takes a token from key's bucket. If none is left it returns false
+// and how long until one is.
+func (k *Keyed) Allow(key string) (bool, time.Duration) {
+	if k == nil {
+		return true, 0
+	}
+
+	k.mu.Lock()
+	now := time.Now()
+	if now.Sub(k.lastSweep) > userIdleTTL {
+		for id, b := range k.buckets {
+			if b.idle(now.Add(-userIdleTTL)) {
+				delete(k.buckets, id)
+			}
+		}
+		k.lastSweep = now
+	}
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.mu.Unlock()
+
+	return b.Allow()
+}
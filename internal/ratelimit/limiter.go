@@ -0,0 +1,211 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// userIdleTTL is how long an unused per-user bucket is kept
+const userIdleTTL = 30 * time.Minute
+
+// Limits configures pacing for one provider. Rates are requests per second; a
+// zero rate leaves that level unlimited.
+type Limits struct {
+	Global      float64 // across all users of this API instance
+	GlobalBurst int
+	User        float64 // per user
+	UserBurst   int
+}
+
+// String formats l in the form ParseLimits accepts
+func (l Limits) String() string {
+	return fmt.Sprintf("global=%g,global_burst=%d,user=%g,user_burst=%d", l.Global, l.GlobalBurst, l.User, l.UserBurst)
+}
+
+// ParseLimits overrides fields of defaults from a comma-separated list like
+// "user=10,user_burst=20,global=200,global_burst=400"
+func ParseLimits(s string, defaults Limits) (Limits, error) {
+	l := defaults
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return l, fmt.Errorf("invalid rate limit %q: want key=value", part)
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || n < 0 {
+			return l, fmt.Errorf("invalid rate limit %q: want a non-negative number", part)
+		}
+		switch strings.TrimSpace(key) {
+		case "global":
+			l.Global = n
+		case "global_burst":
+			l.GlobalBurst = int(n)
+		case "user":
+			l.User = n
+		case "user_burst":
+			l.UserBurst = int(n)
+		default:
+			return l, fmt.Errorf("unknown rate limit %q (want global, global_burst, user or user_burst)", key)
+		}
+	}
+	return l, nil
+}
+
+// Limiter paces one provider's calls with a global bucket shared by all users
+// and a bucket per user
+type Limiter struct {
+	provider  string
+	limits    Limits
+	global    *Bucket
+	mu        sync.Mutex
+	users     map[string]*Bucket
+	lastSweep time.Time
+}
+
+// New creates a limiter for provider (used as a metric attribute)
+func New(provider string, limits Limits) *Limiter {
+	return &Limiter{
+		provider:  provider,
+		limits:    limits,
+		global:    NewBucket(limits.Global, limits.GlobalBurst),
+		users:     make(map[string]*Bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Limits returns the configured limits
+func (l *Limiter) Limits() Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+// SetLimits replaces the limits. Pacers already handed out pick them up on
+// their next call with fresh buckets.
+func (l *Limiter) SetLimits(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	l.global = NewBucket(limits.Global, limits.GlobalBurst)
+	l.users = make(map[string]*Bucket)
+}
+
+// For returns the pacer for one user's calls. A nil limiter returns a nil
+// pacer, which doesn't limit anything.
+func (l *Limiter) For(userID string) *Pacer {
+	if l == nil {
+		return nil
+	}
+	return &Pacer{
+		limiter: l,
+		userID:  userID,
+		attrs:   metric.WithAttributes(attribute.String("provider", l.provider)),
+	}
+}
+
+// buckets returns the user's bucket and the global one
+func (l *Limiter) buckets(userID string) (user, global *Bucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > userIdleTTL {
+		for id, b := range l.users {
+			if b == nil || b.idle(now.Add(-userIdleTTL)) {
+				delete(l.users, id)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	user, ok := l.users[userID]
+	if !ok {
+		user = NewBucket(l.limits.User, l.limits.UserBurst)
+		l.users[userID] = user
+	}
+	return user, l.global
+}
+
+// Pacer paces one user's calls to a provider. It looks its buckets up on
+// every call, so SetLimits applies to adapters already running.
+type Pacer struct {
+	limiter *Limiter
+	userID  string
+	attrs   metric.MeasurementOption
+}
+
+// Wait blocks until both the user's and the global bucket allow a call
+func (p *Pacer) Wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	start := time.Now()
+	user, global := p.limiter.buckets(p.userID)
+	if err := user.Wait(ctx); err != nil {
+		return err
+	}
+	if err := global.Wait(ctx); err != nil {
+		return err
+	}
+	waitSeconds.Record(ctx, time.Since(start).Seconds(), p.attrs)
+	return nil
+}
+
+// Success records a call the provider accepted
+func (p *Pacer) Success() {
+	if p == nil {
+		return
+	}
+	user, global := p.limiter.buckets(p.userID)
+	user.Success()
+	global.Success()
+}
+
+// Throttled records a call the provider rejected for exceeding its limits.
+// Only the user's rate backs off, unless the provider signalled a quota
+// shared by the whole project (global).
+func (p *Pacer) Throttled(ctx context.Context, global bool) {
+	if p == nil {
+		return
+	}
+	user, globalBucket := p.limiter.buckets(p.userID)
+	user.Throttled()
+	if global {
+		globalBucket.Throttled()
+	}
+	throttled.Add(ctx, 1, p.attrs)
+}
+
+// Rate instruments, recorded through the global MeterProvider
+var (
+	waitSeconds metric.Float64Histogram
+	throttled   metric.Int64Counter
+)
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/ratelimit")
+
+	var err error
+	if waitSeconds, err = meter.Float64Histogram("provider.ratelimit.wait",
+		metric.WithDescription("Time provider calls spent waiting for the rate limiter"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	if throttled, err = meter.Int64Counter("provider.ratelimit.throttled",
+		metric.WithDescription("Provider responses rejecting a call for exceeding rate limits"),
+		metric.WithUnit("{response}")); err != nil {
+		otel.Handle(err)
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// maxErrorPeek bounds how much of a 403 body is read to tell a quota error
+// from a permission error
+const maxErrorPeek = 64 << 10
+
+// globalQuotaReasons are Google API error reasons for quotas shared by every
+// user of the project, as opposed to userRateLimitExceeded
+var globalQuotaReasons = [][]byte{[]byte(`"rateLimitExceeded"`), []byte(`"quotaExceeded"`)}
+
+// transport paces requests through a Pacer and adapts it to responses
+type transport struct {
+	base  http.RoundTripper
+	pacer *Pacer
+}
+
+// NewTransport wraps base so every request waits for p and every response
+// adjusts it: 429s, 503s and Google's rate-limit 403s back off, anything else
+// counts as a success. Adapters install it beneath their SDK's retry logic so
+// each retry is paced too. A nil p returns base unchanged.
+func NewTransport(base http.RoundTripper, p *Pacer) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if p == nil {
+		return base
+	}
+	return &transport{base: base, pacer: p}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.pacer.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		t.pacer.Throttled(req.Context(), false)
+	case http.StatusForbidden:
+		// Gmail reports rate limits as 403 with a reason in the body
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorPeek))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+
+		switch {
+		case bytes.Contains(body, []byte(`"userRateLimitExceeded"`)):
+			t.pacer.Throttled(req.Context(), false)
+		case containsAny(body, globalQuotaReasons):
+			t.pacer.Throttled(req.Context(), true)
+		}
+	default:
+		if resp.StatusCode < 500 {
+			t.pacer.Success()
+		}
+	}
+	return resp, nil
+}
+
+func containsAny(b []byte, subs [][]byte) bool {
+	for _, s := range subs {
+		if bytes.Contains(b, s) {
+			return true
+		}
+	}
+	return false
+}
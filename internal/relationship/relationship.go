@@ -0,0 +1,186 @@
+// Package relationship scores how close the user is to each contact from the
+// mail they exchange: how often the user answers the contact, whether both
+// start conversations, how much they write and how recently. A scheduled job
+// stores the scores on the contacts table and publishes contact.scored when
+// one moves; ingest reads the sender's score as an input to importance.
+package relationship
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// EventScored is published when a contact's score changes by at least
+// MinChange, or is scored for the first time
+const EventScored = "contact.scored"
+
+// Defaults for New
+const (
+	DefaultHalfLife = 30 * 24 * time.Hour
+	DefaultWindow   = 180 * 24 * time.Hour
+)
+
+// MinChange is the smallest score change published as contact.scored;
+// smaller drifts are stored quietly
+const MinChange = 0.05
+
+// Component weights; they sum to 1 so a score stays within 0-1
+const (
+	weightReplyRate = 0.4
+	weightBalance   = 0.3
+	weightVolume    = 0.3
+
+	// volumeScale is the number of messages at which volume reaches ~63%
+	volumeScale = 10.0
+)
+
+// Scorer computes and stores relationship scores
+type Scorer struct {
+	stores   eventstore.Opener
+	halfLife time.Duration // a score halves after this long without contact
+	window   time.Duration // exchanges older than this don't count
+}
+
+// New creates a scorer. Scores halve every halfLife since the last message
+// either way; only messages from the last window count.
+func New(stores eventstore.Opener, halfLife, window time.Duration) *Scorer {
+	return &Scorer{stores: stores, halfLife: halfLife, window: window}
+}
+
+// Score computes a contact's score at now. The reply rate is the share of
+// the contact's messages the user answered (0.5 when they never wrote but
+// the user did); the initiation balance is 1 when both start threads equally
+// and 0 when only one side does (0.5 when neither started one); volume grows
+// with the messages exchanged. Their weighted sum decays with the time since
+// the last message.
+func (s *Scorer) Score(st eventstore.ContactStats, now time.Time) eventstore.ContactScore {
+	score := eventstore.ContactScore{Email: st.Email, ScoredAt: now.Unix()}
+	exchanged := st.Received + st.Sent
+	if exchanged == 0 {
+		return score
+	}
+
+	switch {
+	case st.Received > 0:
+		score.ReplyRate = float64(st.Replied) / float64(st.Received)
+	default:
+		score.ReplyRate = 0.5
+	}
+
+	started := st.TheyStarted + st.UserStarted
+	if started > 0 {
+		score.InitiationBalance = 1 - math.Abs(float64(st.TheyStarted-st.UserStarted))/float64(started)
+	} else {
+		score.InitiationBalance = 0.5
+	}
+
+	volume := 1 - math.Exp(-float64(exchanged)/volumeScale)
+	age := max(now.Unix()-st.LastSeen, 0)
+	decay := math.Pow(0.5, float64(age)/s.halfLife.Seconds())
+
+	score.Score = round(decay * (weightReplyRate*score.ReplyRate + weightBalance*score.InitiationBalance + weightVolume*volume))
+	score.ReplyRate = round(score.ReplyRate)
+	score.InitiationBalance = round(score.InitiationBalance)
+	return score
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// Run rescores the users' contacts and returns how many contact.scored
+// events it published. A failed user doesn't stop the others.
+func (s *Scorer) Run(ctx context.Context, userIDs []string) (int, error) {
+	published := 0
+	var errs []error
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := s.runUser(ctx, userID)
+		published += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+		}
+	}
+	return published, errors.Join(errs...)
+}
+
+// runUser stores a user's scores and queues their events in one transaction
+func (s *Scorer) runUser(ctx context.Context, userID string) (int, error) {
+	store, err := s.stores.Open(userID)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	now := time.Now()
+	stats, err := store.ContactStats(ctx, now.Add(-s.window).Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	err = store.WithTx(ctx, func(tx eventstore.Tx) error {
+		published = 0
+		for _, st := range stats {
+			score := s.Score(st, now)
+			if err := tx.SaveContactScore(ctx, score); err != nil {
+				return err
+			}
+			if !changed(st, score) {
+				continue
+			}
+			entry, err := outboxEntry(ctx, userID, st, score)
+			if err != nil {
+				return err
+			}
+			if err := tx.AppendOutbox(ctx, entry); err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	return published, err
+}
+
+// changed reports whether a new score is worth publishing
+func changed(st eventstore.ContactStats, score eventstore.ContactScore) bool {
+	if st.ScoredAt == 0 {
+		return score.Score > 0
+	}
+	return math.Abs(score.Score-st.Score) >= MinChange
+}
+
+func outboxEntry(ctx context.Context, userID string, st eventstore.ContactStats, score eventstore.ContactScore) (eventstore.OutboxEntry, error) {
+	payload, err := json.Marshal(map[string]any{
+		"user_id":            userID,
+		"ts":                 score.ScoredAt,
+		"email":              score.Email,
+		"score":              score.Score,
+		"previous_score":     st.Score,
+		"reply_rate":         score.ReplyRate,
+		"initiation_balance": score.InitiationBalance,
+		"received":           st.Received,
+		"sent":               st.Sent,
+		"last_seen":          st.LastSeen,
+	})
+	if err != nil {
+		return eventstore.OutboxEntry{}, fmt.Errorf("encode event: %w", err)
+	}
+	return eventstore.OutboxEntry{
+		Subject:     fmt.Sprintf("user.%s.%s", userID, EventScored),
+		EventType:   EventScored,
+		Payload:     payload,
+		MsgID:       fmt.Sprintf("%s|%s|%d", EventScored, score.Email, score.ScoredAt),
+		TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+	}, nil
+}
@@ -0,0 +1,242 @@
+// Package replica ships copies of the per-user event stores to a standby blob
+// store (another region's bucket or a mounted volume) for disaster recovery,
+// and restores them when the standby is promoted.
+//
+// Each round snapshots the users whose database changed since their latest
+// replica with the SQLite backup API, gzips it and uploads it as
+// replicas/{user_id}/events-{unix nanos}.db.gz, then deletes that user's
+// older snapshots. The snapshot time in the key is taken before the copy
+// starts, so writes made during a copy are shipped the next round.
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// prefix is the root of all replica keys
+const prefix = "replicas/"
+
+// dbFile is the per-user database file name under the users root
+const dbFile = "events.db"
+
+// Snapshot is a user's database copy in the replica store
+type Snapshot struct {
+	UserID  string    `json:"user_id"`
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	TakenAt time.Time `json:"taken_at"`
+}
+
+// Replicator ships and restores per-user databases
+type Replicator struct {
+	stores eventstore.Opener
+	root   string // per-user databases: {root}/{user_id}/events.db
+	target blob.Store
+}
+
+// New creates a replicator for the databases under root
+func New(stores eventstore.Opener, root string, target blob.Store) *Replicator {
+	return &Replicator{stores: stores, root: root, target: target}
+}
+
+// Ship uploads a snapshot of every user whose database changed since their
+// latest replica and returns how many it shipped. A failed user doesn't stop
+// the others; their errors are joined.
+func (r *Replicator) Ship(ctx context.Context) (int, error) {
+	latest, err := r.Snapshots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(r.root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list user databases: %w", err)
+	}
+
+	shipped := 0
+	var errs []error
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if !e.IsDir() {
+			continue
+		}
+		userID := e.Name()
+		changed, err := r.modTime(userID)
+		if err != nil || changed.IsZero() {
+			continue // no database (yet)
+		}
+		if snap, ok := latest[userID]; ok && !changed.After(snap.TakenAt) {
+			continue
+		}
+
+		if err := r.ship(ctx, userID, latest[userID]); err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+			continue
+		}
+		shipped++
+	}
+	return shipped, errors.Join(errs...)
+}
+
+// modTime is the last time a user's database or its WAL was written
+func (r *Replicator) modTime(userID string) (time.Time, error) {
+	var newest time.Time
+	for _, name := range []string{dbFile, dbFile + "-wal"} {
+		info, err := os.Stat(filepath.Join(r.root, userID, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// ship uploads one user's snapshot and deletes the one it replaces
+func (r *Replicator) ship(ctx context.Context, userID string, previous Snapshot) error {
+	tmp, err := os.CreateTemp("", "replica-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	store, err := r.stores.Open(userID)
+	if err != nil {
+		return err
+	}
+	takenAt := time.Now()
+	err = store.Backup(ctx, tmp.Name())
+	store.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := blob.PutFileGzip(ctx, r.target, snapshotKey(userID, takenAt), tmp.Name()); err != nil {
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+
+	if previous.Key != "" {
+		if err := r.target.Delete(ctx, previous.Key); err != nil {
+			log.Printf("Replica: failed to delete old snapshot %s: %v", previous.Key, err)
+		}
+	}
+	return nil
+}
+
+// Snapshots returns the latest snapshot of every replicated user
+func (r *Replicator) Snapshots(ctx context.Context) (map[string]Snapshot, error) {
+	latest := make(map[string]Snapshot)
+	err := r.target.List(ctx, prefix, func(obj blob.Object) error {
+		snap, ok := parseKey(obj.Key)
+		if !ok {
+			return nil
+		}
+		snap.Size = obj.Size
+		if cur, ok := latest[snap.UserID]; !ok || snap.TakenAt.After(cur.TakenAt) {
+			latest[snap.UserID] = snap
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicas: %w", err)
+	}
+	return latest, nil
+}
+
+// Promote restores the latest snapshot of every replicated user that has no
+// local database, turning the standby into the primary. Existing local
+// databases are never overwritten. It returns how many users it restored.
+func (r *Replicator) Promote(ctx context.Context) (int, error) {
+	latest, err := r.Snapshots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	var errs []error
+	for userID, snap := range latest {
+		dst := filepath.Join(r.root, userID, dbFile)
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		// Through a temp file, so a failed download leaves no database
+		if err := blob.GetFileGzip(ctx, r.target, snap.Key, dst); err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+			continue
+		}
+		restored++
+	}
+	return restored, errors.Join(errs...)
+}
+
+// RemoveUser deletes all of an offboarded user's snapshots, so a promotion
+// can't bring their database back, and returns how many it deleted
+func (r *Replicator) RemoveUser(ctx context.Context, userID string) (int, error) {
+	var keys []string
+	err := r.target.List(ctx, prefix+userID+"/", func(obj blob.Object) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list replicas: %w", err)
+	}
+
+	for i, key := range keys {
+		if err := r.target.Delete(ctx, key); err != nil {
+			return i, fmt.Errorf("failed to delete snapshot %s: %w", key, err)
+		}
+	}
+	return len(keys), nil
+}
+
+// snapshotKey names a user's snapshot taken at t
+func snapshotKey(userID string, t time.Time) string {
+	return fmt.Sprintf("%s%s/events-%d.db.gz", prefix, userID, t.UnixNano())
+}
+
+// parseKey reads a snapshot key written by snapshotKey
+func parseKey(key string) (Snapshot, bool) {
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return Snapshot{}, false
+	}
+	userID, name, ok := strings.Cut(rest, "/")
+	if !ok || userID == "" {
+		return Snapshot{}, false
+	}
+	name, ok = strings.CutPrefix(name, "events-")
+	if !ok {
+		return Snapshot{}, false
+	}
+	name, ok = strings.CutSuffix(name, ".db.gz")
+	if !ok {
+		return Snapshot{}, false
+	}
+	nanos, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		return Snapshot{}, false
+	}
+	return Snapshot{UserID: userID, Key: key, TakenAt: time.Unix(0, nanos)}, true
+}
@@ -0,0 +1,173 @@
+// Package retention keeps the event-type registry of TTLs (e.g. keep
+// email.received two years but presence.ping seven days) and the janitor
+// that deletes events past them from every user's event store.
+package retention
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+// MinTTL is the shortest TTL accepted, so a typo can't wipe a type at once
+const MinTTL = time.Hour
+
+// ErrInvalidTTL is returned for an unusable event type or TTL
+var ErrInvalidTTL = errors.New("invalid event type TTL")
+
+// validEventType matches event types such as email.received
+var validEventType = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// TTL is how long events of one type are kept
+type TTL struct {
+	EventType  string `json:"event_type"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+	UpdatedBy  string `json:"updated_by,omitempty"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+// Duration returns the TTL as a duration
+func (t TTL) Duration() time.Duration {
+	return time.Duration(t.TTLSeconds) * time.Second
+}
+
+// Store keeps the registry in a SQLite database shared by the API and
+// workers
+type Store struct {
+	DB *sql.DB
+}
+
+// Open opens or creates the retention database
+func Open(dbPath string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if _, err := db.Exec(schemaSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+
+	return &Store{DB: db}, nil
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+// Set registers or replaces the TTL of an event type
+func (s *Store) Set(ctx context.Context, eventType string, ttl time.Duration, by string) (*TTL, error) {
+	if !validEventType.MatchString(eventType) {
+		return nil, fmt.Errorf("%w: %q is not an event type", ErrInvalidTTL, eventType)
+	}
+	if ttl < MinTTL {
+		return nil, fmt.Errorf("%w: ttl must be at least %s", ErrInvalidTTL, MinTTL)
+	}
+
+	t := &TTL{EventType: eventType, TTLSeconds: int64(ttl / time.Second), UpdatedBy: by, UpdatedAt: time.Now().Unix()}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO event_type_ttls (event_type, ttl_seconds, updated_by, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(event_type) DO UPDATE SET
+			ttl_seconds = excluded.ttl_seconds, updated_by = excluded.updated_by, updated_at = excluded.updated_at
+	`, t.EventType, t.TTLSeconds, t.UpdatedBy, t.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save TTL of %s: %w", eventType, err)
+	}
+	return t, nil
+}
+
+// Delete removes an event type's TTL, so its events are kept forever. It
+// returns false if the type had none.
+func (s *Store) Delete(ctx context.Context, eventType string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM event_type_ttls WHERE event_type = ?`, eventType)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete TTL of %s: %w", eventType, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// List returns every registered TTL by event type
+func (s *Store) List(ctx context.Context) ([]TTL, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT event_type, ttl_seconds, updated_by, updated_at FROM event_type_ttls ORDER BY event_type
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query TTLs: %w", err)
+	}
+	defer rows.Close()
+
+	ttls := []TTL{}
+	for rows.Next() {
+		var t TTL
+		if err := rows.Scan(&t.EventType, &t.TTLSeconds, &t.UpdatedBy, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan TTL: %w", err)
+		}
+		ttls = append(ttls, t)
+	}
+	return ttls, rows.Err()
+}
+
+// Sweep deletes the users' events older than their type's TTL and returns
+// how many were removed. A user whose store fails is reported and the rest
+// are still swept.
+func (s *Store) Sweep(ctx context.Context, stores eventstore.Opener, users []string, now time.Time) (int64, error) {
+	ttls, err := s.List(ctx)
+	if err != nil || len(ttls) == 0 {
+		return 0, err
+	}
+
+	var (
+		expired int64
+		errs    []error
+	)
+	for _, userID := range users {
+		if err := ctx.Err(); err != nil {
+			return expired, err
+		}
+		n, err := sweepUser(ctx, stores, userID, ttls, now)
+		expired += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+		}
+	}
+	return expired, errors.Join(errs...)
+}
+
+// sweepUser applies every TTL to one user's store
+func sweepUser(ctx context.Context, stores eventstore.Opener, userID string, ttls []TTL, now time.Time) (int64, error) {
+	store, err := stores.Open(userID)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	var expired int64
+	for _, t := range ttls {
+		n, err := store.ExpireEvents(ctx, t.EventType, now.Add(-t.Duration()).Unix())
+		expired += n
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
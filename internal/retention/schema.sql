@@ -0,0 +1,12 @@
+PRAGMA journal_mode=WAL;
+PRAGMA synchronous=NORMAL;
+PRAGMA busy_timeout=5000;
+
+-- How long events of each type are kept. Types without a row are kept
+-- forever.
+CREATE TABLE IF NOT EXISTS event_type_ttls (
+  event_type          TEXT PRIMARY KEY,
+  ttl_seconds         INTEGER NOT NULL,
+  updated_by          TEXT NOT NULL DEFAULT '',
+  updated_at          INTEGER NOT NULL
+);
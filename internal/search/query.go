@@ -0,0 +1,191 @@
+// Package search parses Gmail-like mail search queries such as
+//
+//	from:alice subject:"quarterly report" after:2024/01/01 -label:promotions has:attachment invoice
+//
+// into structured clauses that stores translate into their own query language.
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Field is the operator a clause applies to
+type Field string
+
+const (
+	FieldText    Field = "text"    // free text (full-text search)
+	FieldFrom    Field = "from"    // sender
+	FieldTo      Field = "to"      // to/cc recipients
+	FieldSubject Field = "subject" // subject substring
+	FieldLabel   Field = "label"   // provider label / category
+	FieldIn      Field = "in"      // canonical folder (inbox, sent, archive, spam, trash)
+	FieldIs      Field = "is"      // read, unread, starred/flagged
+	FieldHas     Field = "has"     // attachment
+	FieldBefore  Field = "before"  // message date before (exclusive)
+	FieldAfter   Field = "after"   // message date on or after
+	FieldLang    Field = "lang"    // detected language (ISO 639-1)
+)
+
+// Values accepted by is: and has:
+var (
+	isValues  = map[string]bool{"read": true, "unread": true, "starred": true, "flagged": true}
+	hasValues = map[string]bool{"attachment": true}
+)
+
+// dateLayouts are accepted by before: and after:
+var dateLayouts = []string{"2006/01/02", "2006-01-02", "2006/1/2"}
+
+// Clause is a single search term. All clauses of a query must match.
+type Clause struct {
+	Field   Field
+	Value   string
+	Negated bool      // prefixed with '-'
+	Time    time.Time // parsed date for before:/after:
+}
+
+// Query is a parsed search query
+type Query struct {
+	Clauses []Clause
+}
+
+// Empty reports whether the query has no clauses
+func (q *Query) Empty() bool {
+	return len(q.Clauses) == 0
+}
+
+// Parse parses a Gmail-like query. Terms are ANDed; a leading '-' negates a
+// term; values with spaces are double-quoted. Unknown operators are treated as
+// free text, like Gmail does.
+func Parse(input string) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	for _, tok := range tokens {
+		clause, err := parseToken(tok)
+		if err != nil {
+			return nil, err
+		}
+		if clause.Value == "" {
+			continue
+		}
+		q.Clauses = append(q.Clauses, clause)
+	}
+	return q, nil
+}
+
+// token is a raw term; op is set for "op:value" terms
+type token struct {
+	op      string
+	value   string
+	negated bool
+	quoted  bool
+}
+
+// parseToken turns a token into a clause
+func parseToken(tok token) (Clause, error) {
+	clause := Clause{Field: FieldText, Value: tok.value, Negated: tok.negated}
+	if tok.op == "" {
+		return clause, nil
+	}
+
+	field := Field(strings.ToLower(tok.op))
+	value := tok.value
+	switch field {
+	case FieldFrom, FieldTo, FieldSubject, FieldLabel:
+	case FieldIn, FieldLang:
+		value = strings.ToLower(value)
+	case FieldIs:
+		value = strings.ToLower(value)
+		if !isValues[value] {
+			return clause, fmt.Errorf("unsupported is:%s", value)
+		}
+	case FieldHas:
+		value = strings.ToLower(value)
+		if !hasValues[value] {
+			return clause, fmt.Errorf("unsupported has:%s", value)
+		}
+	case FieldBefore, FieldAfter:
+		t, err := parseDate(value)
+		if err != nil {
+			return clause, fmt.Errorf("%s: %w", field, err)
+		}
+		clause.Time = t
+	default:
+		// Not an operator - keep the whole term as text
+		clause.Value = tok.op + ":" + tok.value
+		return clause, nil
+	}
+
+	clause.Field = field
+	clause.Value = value
+	return clause, nil
+}
+
+// parseDate parses a before:/after: date (UTC midnight)
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY/MM/DD)", s)
+}
+
+// tokenize splits input on whitespace, honouring double quotes in values
+func tokenize(input string) ([]token, error) {
+	var (
+		tokens []token
+		cur    token
+		buf    strings.Builder
+		inTerm bool
+		quoted bool
+	)
+
+	flush := func() {
+		if inTerm {
+			cur.value = buf.String()
+			tokens = append(tokens, cur)
+		}
+		cur = token{}
+		buf.Reset()
+		inTerm = false
+	}
+
+	for _, r := range input {
+		switch {
+		case quoted:
+			if r == '"' {
+				quoted = false
+				continue
+			}
+			buf.WriteRune(r)
+		case r == '"':
+			quoted = true
+			inTerm = true
+			cur.quoted = true
+		case unicode.IsSpace(r):
+			flush()
+		case r == '-' && !inTerm:
+			cur.negated = true
+			inTerm = true
+		case r == ':' && cur.op == "" && !cur.quoted && buf.Len() > 0:
+			cur.op = buf.String()
+			buf.Reset()
+		default:
+			inTerm = true
+			buf.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	flush()
+
+	return tokens, nil
+}
@@ -0,0 +1,185 @@
+package semantic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+)
+
+// Backfill defaults
+const (
+	DefaultBackfillBatch    = 50
+	DefaultBackfillInterval = 2 * time.Second
+	DefaultBackfillSlice    = 2 * time.Minute
+)
+
+// backfillStale is how long a running backfill may go without progress before
+// it's considered abandoned (its job failed for good) and started again
+const backfillStale = time.Hour
+
+// Backfiller embeds mail stored before embeddings were enabled, or while the
+// indexer couldn't reach the model. It works through a user's messages in
+// store order, a batch at a time, and saves its cursor after every batch, so
+// a restart resumes where it stopped.
+type Backfiller struct {
+	stores   eventstore.Opener
+	llm      llm.Client
+	batch    int
+	interval time.Duration // pause between batches
+	slice    time.Duration // work per run before yielding
+	now      func() time.Time
+}
+
+// NewBackfiller creates a backfiller that embeds batch messages per model
+// call and pauses interval between calls. client must have an embedding
+// model.
+func NewBackfiller(stores eventstore.Opener, client llm.Client, batch int, interval time.Duration) *Backfiller {
+	if batch <= 0 {
+		batch = DefaultBackfillBatch
+	}
+	return &Backfiller{
+		stores:   stores,
+		llm:      client,
+		batch:    batch,
+		interval: interval,
+		slice:    DefaultBackfillSlice,
+		now:      time.Now,
+	}
+}
+
+// Slice is how long one Run works before yielding
+func (b *Backfiller) Slice() time.Duration { return b.slice }
+
+// Interval is the pause between batches
+func (b *Backfiller) Interval() time.Duration { return b.interval }
+
+// Start marks a backfill as running for the user and reports whether the
+// caller should queue a run: false while another run is making progress.
+func (b *Backfiller) Start(ctx context.Context, userID string) (bool, error) {
+	store, err := b.stores.Open(userID)
+	if err != nil {
+		return false, err
+	}
+	defer store.Close()
+
+	model := b.llm.EmbeddingModel()
+	p, err := store.LoadEmbeddingBackfill(ctx, model)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case p == nil:
+		p = &eventstore.EmbeddingBackfill{Model: model}
+	case p.Status == eventstore.BackfillRunning && b.now().Sub(time.Unix(p.UpdatedAt, 0)) < backfillStale:
+		return false, nil
+	case p.Remaining == 0:
+		if p.Status == eventstore.BackfillDone {
+			return false, nil
+		}
+		// An abandoned run that had already caught up
+		p.Status, p.LastError, p.FinishedAt = eventstore.BackfillDone, "", b.now().Unix()
+		return false, store.SaveEmbeddingBackfill(ctx, p)
+	}
+	p.Status, p.FinishedAt = eventstore.BackfillRunning, 0
+	return true, store.SaveEmbeddingBackfill(ctx, p)
+}
+
+// Run embeds the user's unembedded messages for up to a slice and reports
+// whether it caught up. Progress is saved after every batch; a model error
+// is recorded and returned, leaving the cursor at the last saved batch.
+func (b *Backfiller) Run(ctx context.Context, userID string) (bool, error) {
+	store, err := b.stores.Open(userID)
+	if err != nil {
+		return false, err
+	}
+	defer store.Close()
+
+	model := b.llm.EmbeddingModel()
+	p, err := store.LoadEmbeddingBackfill(ctx, model)
+	if err != nil {
+		return false, err
+	}
+	if p == nil {
+		p = &eventstore.EmbeddingBackfill{Model: model}
+	}
+	p.Status = eventstore.BackfillRunning
+
+	deadline := b.now().Add(b.slice)
+	for {
+		msgs, err := store.UnembeddedMessages(ctx, model, p.Cursor, b.batch)
+		if err != nil {
+			return false, err
+		}
+		if len(msgs) == 0 {
+			p.Status, p.LastError, p.FinishedAt = eventstore.BackfillDone, "", b.now().Unix()
+			return true, store.SaveEmbeddingBackfill(ctx, p)
+		}
+
+		if err := b.embed(ctx, store, msgs, p); err != nil {
+			p.LastError = err.Error()
+			if saveErr := store.SaveEmbeddingBackfill(ctx, p); saveErr != nil {
+				return false, saveErr
+			}
+			return false, err
+		}
+		p.Cursor, p.LastError = msgs[len(msgs)-1].Seq, ""
+		if err := store.SaveEmbeddingBackfill(ctx, p); err != nil {
+			return false, err
+		}
+
+		if !b.now().Add(b.interval).Before(deadline) {
+			return false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(b.interval):
+		}
+	}
+}
+
+// embed embeds one batch and saves the vectors
+func (b *Backfiller) embed(ctx context.Context, store eventstore.Store, msgs []eventstore.EmbeddingSource, p *eventstore.EmbeddingBackfill) error {
+	var (
+		texts []string
+		keep  []eventstore.EmbeddingSource
+	)
+	for _, m := range msgs {
+		if text := Text(m.Subject, m.Sender, m.Snippet, m.Attachments); text != "" {
+			texts = append(texts, text)
+			keep = append(keep, m)
+		}
+	}
+	if len(texts) == 0 {
+		p.Skipped += int64(len(msgs))
+		return nil
+	}
+
+	vectors, err := b.llm.Embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("embed messages: %w", err)
+	}
+	for i, m := range keep {
+		err := store.SaveEmbedding(ctx, eventstore.MessageEmbedding{
+			Provider:          m.Provider,
+			ProviderMessageID: m.ProviderMessageID,
+			Model:             p.Model,
+			Vector:            vectors[i],
+		})
+		if err != nil {
+			return err
+		}
+		p.Embedded++
+	}
+	p.Skipped += int64(len(msgs) - len(keep))
+	return nil
+}
+
+// Progress returns the user's backfill progress for the current model, nil
+// if it never ran
+func (b *Backfiller) Progress(ctx context.Context, reader eventstore.Reader) (*eventstore.EmbeddingBackfill, error) {
+	return reader.LoadEmbeddingBackfill(ctx, b.llm.EmbeddingModel())
+}
@@ -0,0 +1,141 @@
+// Package semantic embeds received mail so questions can find messages by
+// meaning rather than exact words. The indexer runs as a projection over
+// email.received and stores one vector per message; Search embeds a query
+// and ranks the user's messages against it.
+package semantic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+)
+
+// maxTextLen caps the text embedded per message, in bytes
+const maxTextLen = 4000
+
+// Indexer embeds received mail
+type Indexer struct {
+	stores eventstore.Opener
+	llm    llm.Client
+}
+
+// NewIndexer creates an indexer. client must have an embedding model.
+func NewIndexer(stores eventstore.Opener, client llm.Client) *Indexer {
+	return &Indexer{stores: stores, llm: client}
+}
+
+// message is the part of an email.received event the indexer embeds
+type message struct {
+	Provider          string `json:"provider"`
+	ProviderMessageID string `json:"provider_message_id"`
+	Subject           string `json:"subject"`
+	Sender            string `json:"sender"`
+	Snippet           string `json:"snippet"`
+	PayloadRef        string `json:"payload_ref"`
+}
+
+// Projection returns the projection that embeds new mail. Re-embedding a
+// message replaces its vector, so redeliveries and rebuilds are harmless.
+func (ix *Indexer) Projection() projection.Projection {
+	return projection.Projection{
+		Name:   "embeddings",
+		Events: []string{"email.received"},
+		Apply:  ix.apply,
+	}
+}
+
+func (ix *Indexer) apply(ctx context.Context, ev projection.Event) error {
+	var msg message
+	if err := json.Unmarshal(ev.Data, &msg); err != nil || msg.ProviderMessageID == "" {
+		return nil // not ours to fix
+	}
+
+	store, err := ix.stores.Open(ev.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	// The stored message also has any attachment text extracted by now
+	src, err := store.LoadEmbeddingSource(ctx, msg.Provider, msg.ProviderMessageID)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		if msg.PayloadRef != "" {
+			return nil // offloaded payloads carry no text to embed
+		}
+		src = &eventstore.EmbeddingSource{
+			Provider:          msg.Provider,
+			ProviderMessageID: msg.ProviderMessageID,
+			Subject:           msg.Subject,
+			Sender:            msg.Sender,
+			Snippet:           msg.Snippet,
+		}
+	}
+	return ix.Embed(ctx, store, src)
+}
+
+// Embed stores the vector of a message, replacing an earlier one
+func (ix *Indexer) Embed(ctx context.Context, store eventstore.Store, src *eventstore.EmbeddingSource) error {
+	text := Text(src.Subject, src.Sender, src.Snippet, src.Attachments)
+	if text == "" {
+		return nil
+	}
+
+	vectors, err := ix.llm.Embed(ctx, []string{text})
+	if err != nil {
+		return fmt.Errorf("embed message: %w", err)
+	}
+	return store.SaveEmbedding(ctx, eventstore.MessageEmbedding{
+		Provider:          src.Provider,
+		ProviderMessageID: src.ProviderMessageID,
+		Model:             ix.llm.EmbeddingModel(),
+		Vector:            vectors[0],
+	})
+}
+
+// Text is what gets embedded for a message: its subject, sender, snippet and
+// the text of its attachments, capped at maxTextLen. Returns "" when there's
+// nothing to embed.
+func Text(subject, sender, snippet, attachments string) string {
+	var b strings.Builder
+	if subject = strings.TrimSpace(subject); subject != "" {
+		b.WriteString("Subject: " + subject + "\n")
+	}
+	if sender = strings.TrimSpace(sender); sender != "" {
+		b.WriteString("From: " + sender + "\n")
+	}
+	if snippet = strings.TrimSpace(snippet); snippet != "" {
+		b.WriteString(snippet + "\n")
+	}
+	if attachments = strings.TrimSpace(attachments); attachments != "" {
+		b.WriteString("Attachments: " + attachments)
+	}
+	text := strings.TrimSpace(b.String())
+	if len(text) > maxTextLen {
+		text = strings.ToValidUTF8(text[:maxTextLen], "")
+	}
+	return text
+}
+
+// Search embeds text and returns the user's most similar messages that also
+// match filter's operators (nil for all messages), best first
+func Search(ctx context.Context, reader eventstore.Reader, client llm.Client, text string, filter *search.Query, limit int) ([]eventstore.ScoredMessage, error) {
+	vectors, err := client.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	return reader.SemanticSearch(ctx, eventstore.SemanticQuery{
+		Vector: vectors[0],
+		Model:  client.EmbeddingModel(),
+		Filter: filter,
+		Limit:  limit,
+	})
+}
@@ -0,0 +1,146 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Membership defaults: workers rewrite their key every HeartbeatInterval and
+// drop out of the membership when it is older than TTL
+const (
+	Bucket            = "SYNC_WORKERS"
+	TTL               = 30 * time.Second
+	HeartbeatInterval = 10 * time.Second
+)
+
+// Membership tracks the live sync workers in a NATS key-value bucket: each
+// worker keeps a key alive while it runs, and the live keys are the
+// membership. Until the bucket is reachable the membership is just this
+// worker, so a single worker keeps syncing when NATS is down.
+type Membership struct {
+	self     string
+	open     func() (nats.KeyValue, error)
+	onChange func()
+
+	mu      gosync.RWMutex
+	members []string
+}
+
+// NewMembership creates the membership for worker self. open returns the
+// bucket (see natsjs.Publisher.KeyValue); onChange is called after the
+// membership changes.
+func NewMembership(self string, open func() (nats.KeyValue, error), onChange func()) *Membership {
+	return &Membership{self: self, open: open, onChange: onChange, members: []string{self}}
+}
+
+// WorkerID returns WORKER_ID, or hostname-pid, reduced to characters valid
+// in a key-value key
+func WorkerID() string {
+	id := os.Getenv("WORKER_ID")
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+// Self returns this worker's id
+func (m *Membership) Self() string {
+	return m.self
+}
+
+// Members returns the live workers, sorted
+func (m *Membership) Members() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.members)
+}
+
+// Owns reports whether this worker owns userID
+func (m *Membership) Owns(userID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return Owner(userID, m.members) == m.self
+}
+
+// Start joins the membership and keeps this worker's key alive until ctx is
+// cancelled, then removes the key so peers take over its users at once. The
+// first refresh happens before Start returns, so a starting worker doesn't
+// briefly claim every user.
+func (m *Membership) Start(ctx context.Context) {
+	kv := m.beat(nil)
+	go func() {
+		ticker := time.NewTicker(HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				if kv != nil {
+					_ = kv.Delete(m.self)
+				}
+				return
+			case <-ticker.C:
+				kv = m.beat(kv)
+			}
+		}
+	}()
+}
+
+// beat opens the bucket if needed and refreshes the membership, returning
+// the bucket (nil while it is unreachable)
+func (m *Membership) beat(kv nats.KeyValue) nats.KeyValue {
+	if kv == nil {
+		var err error
+		if kv, err = m.open(); err != nil {
+			log.Printf("Worker membership unavailable, keeping last known members: %v", err)
+			return nil
+		}
+	}
+	if err := m.refresh(kv); err != nil {
+		log.Printf("Error refreshing worker membership: %v", err)
+	}
+	return kv
+}
+
+// refresh rewrites this worker's key and reloads the live keys
+func (m *Membership) refresh(kv nats.KeyValue) error {
+	if _, err := kv.Put(m.self, []byte(time.Now().UTC().Format(time.RFC3339))); err != nil {
+		return err
+	}
+	keys, err := kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return err
+	}
+	if !slices.Contains(keys, m.self) {
+		keys = append(keys, m.self)
+	}
+	slices.Sort(keys)
+
+	m.mu.Lock()
+	changed := !slices.Equal(keys, m.members)
+	prev := len(m.members)
+	m.members = keys
+	m.mu.Unlock()
+
+	if changed {
+		log.Printf("Worker membership changed: %d → %d workers (%s)", prev, len(keys), strings.Join(keys, ", "))
+		if m.onChange != nil {
+			m.onChange()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+// Package shard assigns users to sync workers. Each user belongs to the live
+// worker with the highest rendezvous hash for it, so every worker computes
+// the same owner from the same membership, and when a worker joins or leaves
+// only the users it gains or loses move.
+package shard
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Owner returns the member that owns key, "" if there are no members
+func Owner(key string, members []string) string {
+	var (
+		owner string
+		best  uint64
+	)
+	for _, m := range members {
+		if w := weight(m, key); owner == "" || w > best || (w == best && m < owner) {
+			owner, best = m, w
+		}
+	}
+	return owner
+}
+
+// weight is the rendezvous score of member for key
+func weight(member, key string) uint64 {
+	h := sha256.New()
+	h.Write([]byte(member))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	var sum [sha256.Size]byte
+	return binary.BigEndian.Uint64(h.Sum(sum[:0]))
+}
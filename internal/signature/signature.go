@@ -0,0 +1,252 @@
+// Package signature pulls contact details out of email signatures: job
+// title, company, phone numbers, postal address and website. It finds the
+// signature block (after a "-- " delimiter or a sign-off such as "Best
+// regards"), ignores quoted replies, and classifies the block's lines with
+// plain heuristics, so it only reports what it is fairly sure of.
+package signature
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Signature is what a message's signature says about its sender
+type Signature struct {
+	Name    string   `json:"name,omitempty"`
+	Title   string   `json:"title,omitempty"`
+	Company string   `json:"company,omitempty"`
+	Phones  []string `json:"phones,omitempty"`
+	Address string   `json:"address,omitempty"`
+	Website string   `json:"website,omitempty"`
+}
+
+// Empty reports whether the signature found no details
+func (s *Signature) Empty() bool {
+	return s == nil || (s.Title == "" && s.Company == "" && len(s.Phones) == 0 && s.Address == "" && s.Website == "")
+}
+
+const (
+	maxBlockLines = 10  // a signature is short; longer blocks are prose
+	maxLineLen    = 100 // longer lines are prose
+	searchLines   = 25  // how far from the end of the reply to look for a sign-off
+)
+
+var (
+	// quoteStart marks where the quoted message of a reply begins
+	quoteStart = regexp.MustCompile(`(?im)^(on .{4,200}wrote:|-{2,}\s*original message\s*-{2,}|_{10,}|from:\s.+@.+|>)`)
+
+	signOff = regexp.MustCompile(`(?i)^(best|kind|warm|many)?\s*(regards|wishes|thanks|thank you|cheers|sincerely|best|yours truly|yours|greetings|respectfully|cordialement|mit freundlichen grüßen|viele grüße|saludos|un saludo)[,.!]?$`)
+
+	phone     = regexp.MustCompile(`(?:\+|\(?\b)\d[\d\s().\-/]{6,}\d`)
+	phoneHint = regexp.MustCompile(`(?i)\b(tel|phone|mobile|mob|cell|office|direct|fax|t|m|p|o|d)\b\.?\s*[:.]`)
+	faxHint   = regexp.MustCompile(`(?i)\bfax\b`)
+	website   = regexp.MustCompile(`(?i)\b(?:https?://)?(?:www\.)[a-z0-9][a-z0-9.\-]*\.[a-z]{2,}(?:/\S*)?|\bhttps?://[a-z0-9][a-z0-9.\-]*\.[a-z]{2,}(?:/\S*)?`)
+	email     = regexp.MustCompile(`\S+@\S+\.\S+`)
+
+	titleWords   = regexp.MustCompile(`(?i)\b(ceo|cto|cfo|coo|cmo|cio|vp|svp|evp|chief|president|founder|co-founder|cofounder|director|manager|head of|lead|engineer|developer|designer|architect|analyst|consultant|partner|associate|officer|coordinator|specialist|administrator|assistant|counsel|attorney|lawyer|recruiter|scientist|researcher|professor|editor|producer|owner|principal|advisor|representative|executive|accountant)\b`)
+	companyWords = regexp.MustCompile(`(?i)\b(inc|llc|ltd|limited|gmbh|ag|corp|corporation|co|company|plc|s\.a|sa|sarl|bv|b\.v|oy|ab|pty|group|holdings|labs|technologies|systems|partners|solutions|consulting|studio|agency|foundation|university)\b\.?`)
+	addressWords = regexp.MustCompile(`(?i)\b(street|st|avenue|ave|road|rd|boulevard|blvd|lane|ln|drive|dr|suite|ste|floor|fl|way|place|pl|square|sq|court|ct|highway|hwy|parkway|pkwy|str|straße|strasse|platz|weg|rue|via|calle|po box)\b\.?`)
+	postalCode   = regexp.MustCompile(`\b(\d{5}(-\d{4})?|[A-Z]{1,2}\d[A-Z\d]?\s?\d[A-Z]{2}|\d{4}\s?[A-Z]{2}|[A-Z]\d[A-Z]\s?\d[A-Z]\d)\b`)
+	titleAt      = regexp.MustCompile(`(?i)^(.+?)\s+(?:at|@)\s+(.+)$`)
+	separators   = regexp.MustCompile(`\s+[|•·–—]\s+|\s+-\s+|,\s+`)
+)
+
+// Parse returns the signature details in a plain-text message body, nil if
+// it finds none
+func Parse(body string) *Signature {
+	block := findBlock(body)
+	if len(block) == 0 {
+		return nil
+	}
+
+	sig := &Signature{}
+	for i, line := range block {
+		sig.classify(line, i == 0)
+	}
+	if sig.Empty() {
+		return nil
+	}
+	return sig
+}
+
+// findBlock returns the trimmed, non-empty lines of the signature block
+func findBlock(body string) []string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	if loc := quoteStart.FindStringIndex(body); loc != nil {
+		body = body[:loc[0]]
+	}
+	lines := strings.Split(body, "\n")
+
+	start := -1
+	for i, line := range lines {
+		if line == "-- " || strings.TrimSpace(line) == "--" {
+			start = i + 1 // the standard delimiter wins
+		}
+	}
+	if start < 0 {
+		for i := len(lines) - 1; i >= 0 && i >= len(lines)-searchLines; i-- {
+			if signOff.MatchString(strings.TrimSpace(lines[i])) {
+				start = i + 1
+				break
+			}
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	var block []string
+	for _, line := range lines[start:] {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(block) == maxBlockLines {
+			return nil // too long for a signature
+		}
+		block = append(block, line)
+	}
+	return block
+}
+
+// classify files a signature line under the detail it looks like. A line
+// may hold several parts ("CTO | Acme Inc | +1 555 0100").
+func (s *Signature) classify(line string, first bool) {
+	if len(line) > maxLineLen {
+		return
+	}
+
+	if m := website.FindString(line); m != "" && s.Website == "" {
+		s.Website = strings.TrimRight(m, ".,;)")
+		line = strings.Replace(line, m, "", 1)
+	}
+	line = email.ReplaceAllString(line, "")
+
+	hinted := phoneHint.MatchString(line)
+	if !hinted && s.Address == "" && isAddress(line) {
+		s.Address = strings.Trim(line, " |•·,;")
+		return
+	}
+	if hinted || phone.MatchString(line) {
+		if !faxHint.MatchString(line) {
+			for _, p := range phone.FindAllString(line, -1) {
+				if digits(p) >= 7 && digits(p) <= 15 {
+					s.addPhone(strings.TrimSpace(p))
+				}
+			}
+		}
+		line = phone.ReplaceAllString(line, "")
+		line = phoneHint.ReplaceAllString(line, "")
+	}
+
+	line = strings.Trim(strings.TrimSpace(line), "|•·–—-,:;")
+	if line == "" {
+		return
+	}
+
+	if s.Address == "" && isAddress(line) {
+		s.Address = line
+		return
+	}
+
+	// "Title at Company"
+	if m := titleAt.FindStringSubmatch(line); m != nil && titleWords.MatchString(m[1]) {
+		s.setTitle(m[1])
+		s.setCompany(m[2])
+		return
+	}
+
+	parts := separators.Split(line, -1)
+	var title bool
+	var rest []string
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "":
+		case titleWords.MatchString(part) && len(part) <= 60:
+			s.setTitle(part)
+			title = true
+		case companyWords.MatchString(part) && len(part) <= 60:
+			s.setCompany(part)
+		case first && len(parts) == 1 && isName(part):
+			s.Name = part
+		default:
+			rest = append(rest, part)
+		}
+	}
+
+	// "Founder, Tinylabs": the other half of a title line is the company
+	if title && len(parts) == 2 && len(rest) == 1 && isProperNoun(rest[0]) {
+		s.setCompany(rest[0])
+	}
+}
+
+// isProperNoun accepts a short capitalized phrase without digits
+func isProperNoun(v string) bool {
+	r := []rune(v)
+	return len(r) > 1 && len(r) <= 40 && unicode.IsUpper(r[0]) && strings.IndexFunc(v, unicode.IsDigit) < 0
+}
+
+func (s *Signature) setTitle(v string) {
+	if s.Title == "" {
+		s.Title = strings.TrimSpace(v)
+	}
+}
+
+func (s *Signature) setCompany(v string) {
+	if s.Company == "" {
+		s.Company = strings.TrimSpace(v)
+	}
+}
+
+func (s *Signature) addPhone(p string) {
+	for _, have := range s.Phones {
+		if digitsOf(have) == digitsOf(p) {
+			return
+		}
+	}
+	s.Phones = append(s.Phones, p)
+}
+
+// isAddress looks for a street word next to a number, or a postal code
+// alongside a comma-separated place
+func isAddress(line string) bool {
+	hasDigit := strings.IndexFunc(line, unicode.IsDigit) >= 0
+	if !hasDigit {
+		return false
+	}
+	if addressWords.MatchString(line) {
+		return true
+	}
+	return postalCode.MatchString(line) && strings.Contains(line, ",")
+}
+
+// isName accepts two to four capitalized words without digits
+func isName(line string) bool {
+	words := strings.Fields(line)
+	if len(words) < 2 || len(words) > 4 {
+		return false
+	}
+	for _, w := range words {
+		r := []rune(w)
+		if !unicode.IsUpper(r[0]) || strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func digits(s string) int {
+	return len(digitsOf(s))
+}
+
+func digitsOf(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
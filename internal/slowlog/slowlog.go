@@ -0,0 +1,170 @@
+// Package slowlog logs database statements and provider API calls that take
+// longer than a threshold, so performance regressions show up in logs before
+// users notice them.
+package slowlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// Kind is a class of operation with its own threshold
+type Kind string
+
+const (
+	SQL      Kind = "sql"
+	Provider Kind = "provider"
+)
+
+// Default thresholds
+const (
+	DefaultSQLThreshold      = 250 * time.Millisecond
+	DefaultProviderThreshold = 5 * time.Second
+)
+
+// maxOpLen bounds the operation name in a log line
+const maxOpLen = 160
+
+// thresholds in nanoseconds; 0 disables logging for the kind
+var (
+	sqlThreshold      atomic.Int64
+	providerThreshold atomic.Int64
+)
+
+func init() {
+	sqlThreshold.Store(int64(DefaultSQLThreshold))
+	providerThreshold.Store(int64(DefaultProviderThreshold))
+}
+
+// SetThreshold changes the threshold for kind; 0 disables it
+func SetThreshold(kind Kind, d time.Duration) {
+	switch kind {
+	case SQL:
+		sqlThreshold.Store(int64(d))
+	case Provider:
+		providerThreshold.Store(int64(d))
+	}
+}
+
+// Threshold returns the threshold for kind
+func Threshold(kind Kind) time.Duration {
+	switch kind {
+	case SQL:
+		return time.Duration(sqlThreshold.Load())
+	case Provider:
+		return time.Duration(providerThreshold.Load())
+	}
+	return 0
+}
+
+// ConfigureFromEnv reads SLOW_QUERY_THRESHOLD and
+// SLOW_PROVIDER_CALL_THRESHOLD (durations, 0 disables)
+func ConfigureFromEnv() error {
+	for env, kind := range map[string]Kind{
+		"SLOW_QUERY_THRESHOLD":         SQL,
+		"SLOW_PROVIDER_CALL_THRESHOLD": Provider,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid %s %q: want a duration like 250ms", env, v)
+		}
+		SetThreshold(kind, d)
+	}
+	return nil
+}
+
+// UserHash returns a short stable hash of a user id, so log lines can be
+// correlated per user without containing the id
+func UserHash(userID string) string {
+	if userID == "" {
+		return "-"
+	}
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Observe logs op if it took longer than kind's threshold. user is a
+// UserHash (or a label such as "shared").
+func Observe(kind Kind, op, user string, d time.Duration) {
+	t := Threshold(kind)
+	if t <= 0 || d < t {
+		return
+	}
+	log.Printf("SLOW %s %s user=%s op=%q", kind, d.Round(time.Millisecond), user, compact(op))
+}
+
+// compact collapses whitespace and truncates op for a single log line
+func compact(op string) string {
+	op = strings.Join(strings.Fields(op), " ")
+	if len(op) > maxOpLen {
+		op = op[:maxOpLen] + "..."
+	}
+	return op
+}
+
+// transport times provider HTTP calls
+type transport struct {
+	base     http.RoundTripper
+	provider string
+	user     string
+}
+
+// Transport wraps base to log slow provider calls. Install it beneath rate
+// limiting so time spent waiting for the limiter isn't counted.
+func Transport(base http.RoundTripper, provider, userID string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, provider: provider, user: UserHash(userID)}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if d := time.Since(start); d >= Threshold(Provider) && Threshold(Provider) > 0 {
+		status := "error"
+		if err == nil {
+			status = resp.Status
+		}
+		Observe(Provider, fmt.Sprintf("%s %s %s %s (%s)", t.provider, req.Method, req.URL.Host, templatePath(req.URL.Path), status), t.user, d)
+	}
+	return resp, err
+}
+
+// templatePath replaces path segments that look like ids (message, folder,
+// thread ids) with {id} so slow calls group by endpoint and leak no ids
+func templatePath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if looksLikeID(s) {
+			segs[i] = "{id}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func looksLikeID(s string) bool {
+	if len(s) < 12 {
+		return false
+	}
+	var digits int
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	return digits > 0 || strings.ContainsAny(s, "=-_@.")
+}
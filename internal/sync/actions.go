@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ApplyAction executes a write-back action against the provider, then applies
+// the resulting state to the local store and queues the matching events
+// (email.labels_changed, email.read/unread, email.moved) like a synced change
+func (m *Manager) ApplyAction(ctx context.Context, userJWT, userID string, provider ProviderName, messageID string, action MessageAction) (*MessageChange, error) {
+	if err := action.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := requireCapability(provider, CapActions, "message actions"); err != nil {
+		return nil, err
+	}
+	mailProvider, err := m.providerFor(ctx, userJWT, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, ok := mailProvider.(MessageActor)
+	if !ok {
+		return nil, fmt.Errorf("message actions %w %s", ErrNotSupported, provider)
+	}
+
+	change, err := actor.ApplyAction(ctx, messageID, action)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", action.Type, err)
+	}
+	change.ChangeID = "action:" + uuid.NewString()
+
+	store, err := m.stores.Open(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open user DB: %w", err)
+	}
+	defer store.Close()
+
+	runner := &Runner{ProviderName: provider}
+	if err := runner.createChangeProcessor(ctx, store, userID, m.inboxID(ctx, userID, provider))(*change); err != nil {
+		return nil, fmt.Errorf("action applied at provider but not recorded: %w", err)
+	}
+
+	return change, nil
+}
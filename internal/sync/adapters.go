@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+// adapterIdleTTL is how long an adapter no sync holds stays cached for
+// one-off calls
+const adapterIdleTTL = 10 * time.Minute
+
+// adapterExpiryMargin retires a cached adapter this long before the token it
+// was built with expires, so one-off calls don't start with a dying token
+const adapterExpiryMargin = 5 * time.Minute
+
+// account is a user's linked account at a provider. BetterAuth links one
+// account per provider, so its token is shared by all of the user's inboxes.
+type account struct {
+	userID   string
+	provider ProviderName
+}
+
+// adapterVariant is the part of ProviderOptions adapters are built with.
+// Syncs of the same account with the same variant share an adapter.
+type adapterVariant struct {
+	includeSpam    bool
+	backfillWindow time.Duration
+}
+
+func variantOf(opts ProviderOptions) adapterVariant {
+	return adapterVariant{includeSpam: opts.IncludeSpam, backfillWindow: opts.BackfillWindow}
+}
+
+// adapterCache shares provider adapters, with their HTTP client and OAuth
+// transport, between the syncs and one-off calls (actions, sending) of an
+// account, so they fetch one token and keep one set of connections. Calls
+// are paced by the user's rate limiter either way. Adapters are safe for
+// concurrent use.
+type adapterCache struct {
+	mu      sync.Mutex
+	entries map[account]map[adapterVariant]*adapterEntry
+}
+
+// adapterEntry is a cached adapter, or one being built while ready is open
+type adapterEntry struct {
+	ready    chan struct{}
+	provider MailProvider
+	err      error
+	expires  time.Time // retire before; zero if the token doesn't expire
+	refs     int       // syncs holding the adapter
+	lastUsed time.Time
+}
+
+func newAdapterCache() *adapterCache {
+	return &adapterCache{entries: make(map[account]map[adapterVariant]*adapterEntry)}
+}
+
+// usable reports whether a built entry may be handed out. Callers hold c.mu.
+func (e *adapterEntry) usable(now time.Time) bool {
+	select {
+	case <-e.ready:
+	default:
+		return true // being built; wait for it
+	}
+	return e.err == nil && (e.expires.IsZero() || now.Before(e.expires))
+}
+
+// acquire returns the account's adapter for variant, building it with build
+// if none is cached. Concurrent callers wait for one build. With hold, the
+// adapter stays cached until release is called (a sync); otherwise release
+// is a no-op and the adapter is kept for adapterIdleTTL.
+func (c *adapterCache) acquire(ctx context.Context, acct account, variant adapterVariant, hold bool, build func() (MailProvider, *auth.Token, error)) (MailProvider, func(), error) {
+	now := time.Now()
+	c.mu.Lock()
+	c.sweep(now)
+	variants := c.entries[acct]
+	if variants == nil {
+		variants = make(map[adapterVariant]*adapterEntry)
+		c.entries[acct] = variants
+	}
+	entry, ok := variants[variant]
+	if ok && !entry.usable(now) {
+		ok = false
+	}
+	if !ok {
+		entry = &adapterEntry{ready: make(chan struct{})}
+		variants[variant] = entry
+	}
+	if hold {
+		entry.refs++
+	}
+	entry.lastUsed = now
+	c.mu.Unlock()
+
+	if !ok {
+		provider, token, err := build()
+		c.mu.Lock()
+		entry.provider, entry.err = provider, err
+		if token != nil && !token.Expiry.IsZero() && token.Expiry.Unix() > 0 {
+			entry.expires = token.Expiry.Add(-adapterExpiryMargin)
+		}
+		if err != nil && variants[variant] == entry {
+			delete(variants, variant)
+		}
+		close(entry.ready)
+		c.mu.Unlock()
+	}
+
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		c.release(entry, hold)
+		return nil, nil, ctx.Err()
+	}
+	if entry.err != nil {
+		c.release(entry, hold)
+		return nil, nil, entry.err
+	}
+
+	var once sync.Once
+	return entry.provider, func() { once.Do(func() { c.release(entry, hold) }) }, nil
+}
+
+// release drops a sync's hold on an entry
+func (c *adapterCache) release(entry *adapterEntry, hold bool) {
+	if !hold {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	entry.lastUsed = time.Now()
+}
+
+// any returns a usable cached adapter of the account, whatever its variant,
+// for one-off calls that don't depend on sync options
+func (c *adapterCache) any(acct account) MailProvider {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.entries[acct] {
+		select {
+		case <-entry.ready:
+		default:
+			continue
+		}
+		if entry.usable(now) {
+			entry.lastUsed = now
+			return entry.provider
+		}
+	}
+	return nil
+}
+
+// forget drops the account's cached adapters, e.g. after its token was
+// revoked. Syncs holding one keep using it until they stop.
+func (c *adapterCache) forget(acct account) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, acct)
+}
+
+// sweep drops adapters no sync holds that are idle or expired. Callers hold
+// c.mu.
+func (c *adapterCache) sweep(now time.Time) {
+	for acct, variants := range c.entries {
+		for variant, entry := range variants {
+			if entry.refs > 0 {
+				continue
+			}
+			if now.Sub(entry.lastUsed) > adapterIdleTTL || !entry.usable(now) {
+				delete(variants, variant)
+			}
+		}
+		if len(variants) == 0 {
+			delete(c.entries, acct)
+		}
+	}
+}
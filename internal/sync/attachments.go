@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/extract"
+)
+
+// Attachment is a file attached to a message, supplied by providers that read
+// whole messages (archive import)
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	Data        []byte // nil if the provider didn't keep the content
+}
+
+// AttachmentPolicy decides which attachments are kept for text extraction
+type AttachmentPolicy struct {
+	Types   map[string]bool // document types (see internal/extract)
+	MaxSize int64           // bytes
+}
+
+// pendingAttachment is an attachment record and the content to upload once
+// its message is stored
+type pendingAttachment struct {
+	record eventstore.Attachment
+	data   []byte
+}
+
+// attachmentRecords builds the records of a message's attachments. Those the
+// policy allows are pending extraction and need their content uploaded;
+// the rest are recorded as skipped with the reason.
+func (r *Runner) attachmentRecords(userID, eventID string, meta *MessageMeta) ([]pendingAttachment, error) {
+	now := time.Now().Unix()
+	var out []pendingAttachment
+	for _, a := range meta.Attachments {
+		rec := eventstore.Attachment{
+			ID:                uuid.NewString(),
+			EventID:           eventID,
+			Provider:          string(meta.Provider),
+			ProviderMessageID: meta.MessageID,
+			Filename:          a.Filename,
+			ContentType:       a.ContentType,
+			Size:              a.Size,
+			Status:            eventstore.AttachmentSkipped,
+			CreatedAt:         now,
+		}
+
+		docType := extract.Type(a.ContentType, a.Filename)
+		switch {
+		case r.Attachments == nil || r.Blobs == nil:
+			rec.Error = "attachment extraction is not enabled"
+		case docType == "" || !r.Attachments.Types[docType]:
+			rec.Error = "type not allowed"
+		case a.Size > r.Attachments.MaxSize || a.Data == nil:
+			rec.Error = fmt.Sprintf("larger than %d bytes", r.Attachments.MaxSize)
+		default:
+			key, err := blob.UserKey(userID, "attachments", eventID, rec.ID)
+			if err != nil {
+				return nil, err
+			}
+			rec.BlobKey = key
+			rec.Status = eventstore.AttachmentPending
+			rec.Error = ""
+			out = append(out, pendingAttachment{record: rec, data: a.Data})
+			continue
+		}
+		out = append(out, pendingAttachment{record: rec})
+	}
+	return out, nil
+}
+
+// uploadAttachments stores the content of pending attachments after their
+// message was committed. A failed upload fails the record rather than the
+// message.
+func (r *Runner) uploadAttachments(ctx context.Context, store eventstore.Store, pending []pendingAttachment) {
+	for _, p := range pending {
+		if p.record.Status != eventstore.AttachmentPending {
+			continue
+		}
+		err := r.Blobs.Put(ctx, p.record.BlobKey, bytes.NewReader(p.data), int64(len(p.data)), p.record.ContentType)
+		if err == nil {
+			continue
+		}
+		log.Printf("Error storing attachment %s of %s: %v", p.record.ID, p.record.ProviderMessageID, err)
+		rec := p.record
+		rec.Status = eventstore.AttachmentFailed
+		rec.Error = "upload failed: " + err.Error()
+		if err := store.SaveAttachmentText(ctx, &rec); err != nil {
+			log.Printf("Error saving attachment %s: %v", rec.ID, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sync
+
+import "strings"
+
+// MessageKind classifies a message for downstream consumers
+type MessageKind string
+
+const (
+	KindMessage   MessageKind = "message"
+	KindAutoReply MessageKind = "auto_reply" // out-of-office and other automatic replies
+	KindBounce    MessageKind = "bounce"     // delivery failure notifications
+)
+
+// EventType returns the event type published for messages of this kind
+func (k MessageKind) EventType() string {
+	switch k {
+	case KindAutoReply:
+		return "email.auto_reply"
+	case KindBounce:
+		return "email.bounce"
+	default:
+		return "email.received"
+	}
+}
+
+// ClassifyMessage detects bounces and auto-replies from message headers
+func ClassifyMessage(sender string, headers map[string]string) MessageKind {
+	if isBounce(sender, headers) {
+		return KindBounce
+	}
+	if isAutoReply(headers) {
+		return KindAutoReply
+	}
+	return KindMessage
+}
+
+// isBounce checks for delivery status notifications (RFC 3464)
+func isBounce(sender string, headers map[string]string) bool {
+	if HeaderValue(headers, "X-Failed-Recipients") != "" {
+		return true
+	}
+
+	contentType := strings.ToLower(HeaderValue(headers, "Content-Type"))
+	if strings.Contains(contentType, "multipart/report") && strings.Contains(contentType, "delivery-status") {
+		return true
+	}
+
+	from := strings.ToLower(sender)
+	return strings.Contains(from, "mailer-daemon@") || strings.Contains(from, "postmaster@")
+}
+
+// isAutoReply checks for automatic responses (RFC 3834 and common vendor headers)
+func isAutoReply(headers map[string]string) bool {
+	if v := strings.ToLower(HeaderValue(headers, "Auto-Submitted")); v != "" && v != "no" {
+		return true
+	}
+	if HeaderValue(headers, "X-Autoreply") != "" || HeaderValue(headers, "X-Autorespond") != "" {
+		return true
+	}
+	return strings.EqualFold(HeaderValue(headers, "Precedence"), "auto_reply")
+}
+
+// MailingList describes the list or bulk sender a message came from
+type MailingList struct {
+	ID          string // List-Id (angle brackets stripped), empty for bulk mail without one
+	Name        string // display name from List-Id, if any
+	Unsubscribe string // raw List-Unsubscribe value (mailto: and/or https: URIs)
+}
+
+// DetectMailingList parses List-Id, List-Unsubscribe and Precedence headers.
+// Returns nil for regular person-to-person mail.
+func DetectMailingList(headers map[string]string) *MailingList {
+	listID := strings.TrimSpace(HeaderValue(headers, "List-Id"))
+	unsubscribe := strings.TrimSpace(HeaderValue(headers, "List-Unsubscribe"))
+	precedence := strings.ToLower(strings.TrimSpace(HeaderValue(headers, "Precedence")))
+
+	if listID == "" && unsubscribe == "" && precedence != "bulk" && precedence != "list" {
+		return nil
+	}
+
+	list := &MailingList{Unsubscribe: unsubscribe}
+
+	// List-Id: "Display Name <list.example.com>" or just "<list.example.com>"
+	if open := strings.LastIndex(listID, "<"); open >= 0 {
+		if close := strings.Index(listID[open:], ">"); close > 0 {
+			list.ID = listID[open+1 : open+close]
+			list.Name = strings.Trim(strings.TrimSpace(listID[:open]), `"`)
+		}
+	} else {
+		list.ID = listID
+	}
+
+	return list
+}
+
+// HeaderValue looks up a header case-insensitively
+func HeaderValue(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/slowlog"
+)
+
+// debugRefreshInterval bounds how long a runner takes to notice that debug
+// mode was toggled while it is busy backfilling
+const debugRefreshInterval = 30 * time.Second
+
+// DebugTrace writes verbose log lines for one user's sync while an admin has
+// debug mode on for them. The runner refreshes it from the user DB; the
+// provider adapter's transport logs through it. A nil DebugTrace logs
+// nothing.
+type DebugTrace struct {
+	provider ProviderName
+	user     string // slowlog.UserHash of the user
+	mode     atomic.Pointer[eventstore.DebugMode]
+	checked  atomic.Int64 // unix nanos of the last refresh
+}
+
+// NewDebugTrace creates a trace for userID's provider sync, off until
+// refreshed
+func NewDebugTrace(userID string, provider ProviderName) *DebugTrace {
+	return &DebugTrace{provider: provider, user: slowlog.UserHash(userID)}
+}
+
+// refresh reloads the debug mode from the user's store
+func (d *DebugTrace) refresh(ctx context.Context, store eventstore.Store) {
+	if d == nil {
+		return
+	}
+	d.checked.Store(time.Now().UnixNano())
+	mode, err := store.LoadDebugMode(ctx)
+	if err != nil {
+		log.Printf("Error loading debug mode: %v", err)
+		return
+	}
+	if prev := d.mode.Swap(mode); (prev == nil) != (mode == nil) {
+		if mode != nil {
+			log.Printf("DEBUG %s user=%s debug mode on (sample_rate=%g, set by %s)", d.provider, d.user, mode.SampleRate, mode.SetBy)
+		} else {
+			log.Printf("DEBUG %s user=%s debug mode off", d.provider, d.user)
+		}
+	}
+}
+
+// maybeRefresh reloads the debug mode if the last refresh is older than the
+// interval
+func (d *DebugTrace) maybeRefresh(ctx context.Context, store eventstore.Store) {
+	if d != nil && time.Since(time.Unix(0, d.checked.Load())) >= debugRefreshInterval {
+		d.refresh(ctx, store)
+	}
+}
+
+// active returns the debug mode in effect, nil if debug mode is off
+func (d *DebugTrace) active() *eventstore.DebugMode {
+	if d == nil {
+		return nil
+	}
+	mode := d.mode.Load()
+	if mode == nil || time.Now().Unix() >= mode.ExpiresAt {
+		return nil
+	}
+	return mode
+}
+
+// sampled reports whether debug mode is on and this operation falls in the
+// sample
+func (d *DebugTrace) sampled() bool {
+	mode := d.active()
+	return mode != nil && rand.Float64() < mode.SampleRate
+}
+
+// logf writes a debug line for the user
+func (d *DebugTrace) logf(format string, args ...any) {
+	log.Printf("DEBUG %s user=%s %s", d.provider, d.user, fmt.Sprintf(format, args...))
+}
+
+// checkpoint logs a checkpoint write. Checkpoint writes are rare, so they
+// are logged whatever the sample rate.
+func (d *DebugTrace) checkpoint(what string, err error) {
+	if d.active() == nil {
+		return
+	}
+	d.logf("checkpoint %s err=%v", what, err)
+}
+
+// event logs a sample of ingested messages and changes with the trace id
+// that follows them through the outbox and NATS
+func (d *DebugTrace) event(ctx context.Context, op, messageID string) {
+	if !d.sampled() {
+		return
+	}
+	d.logf("%s message=%s trace=%s", op, messageID, trace.SpanContextFromContext(ctx).TraceID())
+}
+
+// messages refreshes the debug mode while messages are being processed, so
+// a toggle takes effect during a long backfill
+func (d *DebugTrace) messages(ctx context.Context, store eventstore.Store, fn func(MessageMeta) error) func(MessageMeta) error {
+	if d == nil {
+		return fn
+	}
+	return func(meta MessageMeta) error {
+		d.maybeRefresh(ctx, store)
+		return fn(meta)
+	}
+}
+
+// debugTransport logs a sample of provider calls while debug mode is on
+type debugTransport struct {
+	base  http.RoundTripper
+	debug *DebugTrace
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.debug.sampled() {
+		return t.base.RoundTrip(req)
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = resp.Status
+	}
+	t.debug.logf("call %s %s%s %s in %s err=%v", req.Method, req.URL.Host, req.URL.Path, status,
+		time.Since(start).Round(time.Millisecond), err)
+	return resp, err
+}
@@ -0,0 +1,80 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// Errors providers wrap (see ErrorClassifier) for failures that aren't the
+// user's token
+var (
+	ErrRateLimited         = errors.New("provider rate limit exceeded")
+	ErrProviderUnavailable = errors.New("provider unavailable")
+)
+
+// ErrorCode tells the user what to do about a failed sync. It is recorded in
+// the sync state next to the error message.
+type ErrorCode string
+
+const (
+	// ErrorReauthRequired: the token expired or was revoked, or the account
+	// was unlinked; reconnect the account
+	ErrorReauthRequired ErrorCode = "REAUTH_REQUIRED"
+	// ErrorScopeMissing: the token lacks permissions the sync needs;
+	// reconnect and grant them
+	ErrorScopeMissing ErrorCode = "SCOPE_MISSING"
+	// ErrorRateLimited: the provider is throttling the account; the sync
+	// resumes on its own
+	ErrorRateLimited ErrorCode = "RATE_LIMITED"
+	// ErrorProviderOutage: the provider or the auth server is failing or
+	// unreachable; the sync resumes on its own
+	ErrorProviderOutage ErrorCode = "PROVIDER_OUTAGE"
+	// ErrorSyncFailed: anything else; the sync is retried
+	ErrorSyncFailed ErrorCode = "SYNC_FAILED"
+)
+
+// ErrorClassifier is implemented by providers that can tell their API's
+// failures apart. ClassifyError returns err wrapped with ErrTokenExpired,
+// ErrMissingScopes, ErrRateLimited or ErrProviderUnavailable when it is one of
+// those, err unchanged otherwise.
+type ErrorClassifier interface {
+	ClassifyError(err error) error
+}
+
+// classify lets the runner's provider classify err, if it can
+func (r *Runner) classify(err error) error {
+	if c, ok := r.Provider.(ErrorClassifier); ok && err != nil {
+		return c.ClassifyError(err)
+	}
+	return err
+}
+
+// markError records a failed sync cycle with its ErrorCode and returns err
+// as classified by the provider
+func (r *Runner) markError(ctx context.Context, store eventstore.Store, err error) error {
+	err = r.classify(err)
+	_ = store.UpdateSyncStatus(ctx, string(r.ProviderName), "ERROR", string(CodeOf(err)), err.Error())
+	return err
+}
+
+// CodeOf maps a sync failure to the ErrorCode shown to the user
+func CodeOf(err error) ErrorCode {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrTokenExpired), errors.Is(err, auth.ErrAccountNotConnected):
+		return ErrorReauthRequired
+	case errors.Is(err, ErrMissingScopes):
+		return ErrorScopeMissing
+	case errors.Is(err, ErrRateLimited):
+		return ErrorRateLimited
+	case errors.Is(err, ErrProviderUnavailable), errors.Is(err, auth.ErrAuthServer),
+		errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return ErrorProviderOutage
+	default:
+		return ErrorSyncFailed
+	}
+}
@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// DispatchPolicy orders the outbox dispatchers of different users within a
+// round of turns, when more of them have messages ready than may publish at
+// once. Either way each waiting user publishes one batch per round.
+type DispatchPolicy string
+
+const (
+	// DispatchRoundRobin serves a round's users in the order they started
+	// waiting
+	DispatchRoundRobin DispatchPolicy = "round_robin"
+	// DispatchOldestFirst serves first the users whose oldest ready message
+	// was queued earliest, evening out publish latency
+	DispatchOldestFirst DispatchPolicy = "oldest_first"
+)
+
+// DefaultDispatchConcurrency is how many outbox batches a process publishes
+// at once across users
+const DefaultDispatchConcurrency = 4
+
+// ParseDispatchPolicy parses a DispatchPolicy; empty is round_robin
+func ParseDispatchPolicy(s string) (DispatchPolicy, error) {
+	switch p := DispatchPolicy(s); p {
+	case "":
+		return DispatchRoundRobin, nil
+	case DispatchRoundRobin, DispatchOldestFirst:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown dispatch policy %q: want round_robin or oldest_first", s)
+	}
+}
+
+// dispatchWait records how long dispatchers wait for a turn
+var dispatchWait metric.Float64Histogram
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/sync")
+
+	var err error
+	if dispatchWait, err = meter.Float64Histogram("outbox.dispatch.wait",
+		metric.WithDescription("Time an outbox dispatcher waited for its turn to publish a batch"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// dispatchTurns schedules outbox batches across the users dispatched by one
+// process, so a user with a large backlog (e.g. a backfill) can't keep the
+// publisher to itself. Each turn publishes one batch; a user waits for its
+// next turn until every other waiting user had one.
+type dispatchTurns struct {
+	mu      sync.Mutex
+	limit   int
+	policy  DispatchPolicy
+	active  int
+	served  map[string]bool // users that had a turn this round
+	waiting []*turnWaiter   // in arrival order
+}
+
+// turnWaiter is a dispatcher waiting for a turn
+type turnWaiter struct {
+	userID  string
+	oldest  int64 // when the batch's oldest message was queued
+	ready   chan struct{}
+	granted bool
+}
+
+func newDispatchTurns(limit int, policy DispatchPolicy) *dispatchTurns {
+	return &dispatchTurns{limit: max(limit, 1), policy: policy, served: make(map[string]bool)}
+}
+
+// acquire waits for userID's turn to publish a batch whose oldest message was
+// queued at oldest. Release the turn with the returned func, which may be
+// called more than once. A nil dispatchTurns never waits.
+func (t *dispatchTurns) acquire(ctx context.Context, userID string, oldest int64) (func(), error) {
+	if t == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+
+	t.mu.Lock()
+	if t.active < t.limit && len(t.waiting) == 0 {
+		t.grant(userID)
+		t.mu.Unlock()
+		return t.releaser(), nil
+	}
+	w := &turnWaiter{userID: userID, oldest: oldest, ready: make(chan struct{})}
+	t.waiting = append(t.waiting, w)
+	t.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		dispatchWait.Record(ctx, time.Since(start).Seconds())
+		return t.releaser(), nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if w.granted {
+			t.release()
+		} else {
+			for i, other := range t.waiting {
+				if other == w {
+					t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+					break
+				}
+			}
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (t *dispatchTurns) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.release()
+		})
+	}
+}
+
+// grant starts a turn for userID. Callers hold t.mu.
+func (t *dispatchTurns) grant(userID string) {
+	t.active++
+	t.served[userID] = true
+}
+
+// release ends a turn and hands free turns to the next waiters. Callers hold
+// t.mu.
+func (t *dispatchTurns) release() {
+	t.active--
+	for t.active < t.limit && len(t.waiting) > 0 {
+		i := t.next()
+		w := t.waiting[i]
+		t.waiting = append(t.waiting[:i], t.waiting[i+1:]...)
+		t.grant(w.userID)
+		w.granted = true
+		close(w.ready)
+	}
+	if t.active == 0 {
+		// Idle: nobody is owed a turn
+		clear(t.served)
+	}
+}
+
+// next picks the waiter to serve next, starting a new round once every
+// waiting user was served in this one. Callers hold t.mu.
+func (t *dispatchTurns) next() int {
+	best := -1
+	for i, w := range t.waiting {
+		if t.served[w.userID] {
+			continue
+		}
+		if best < 0 || t.policy == DispatchOldestFirst && w.oldest < t.waiting[best].oldest {
+			best = i
+		}
+	}
+	if best < 0 {
+		clear(t.served)
+		return t.next()
+	}
+	return best
+}
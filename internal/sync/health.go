@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+// TokenState describes the health of a provider connection
+type TokenState string
+
+const (
+	TokenHealthy       TokenState = "healthy"
+	TokenExpired       TokenState = "expired"
+	TokenMissingScopes TokenState = "missing_scopes"
+	TokenNotConnected  TokenState = "not_connected"
+	TokenError         TokenState = "error"
+)
+
+// TokenStatus is the result of a provider token health check
+type TokenStatus struct {
+	Provider  ProviderName `json:"provider"`
+	State     TokenState   `json:"state"`
+	Detail    string       `json:"detail,omitempty"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+	CheckedAt time.Time    `json:"checked_at"`
+}
+
+// CheckToken fetches the provider token from BetterAuth and performs a cheap
+// authenticated call to verify the connection actually works
+func (m *Manager) CheckToken(ctx context.Context, userJWT, userID string, provider ProviderName) (*TokenStatus, error) {
+	authProvider, err := authProviderFor(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TokenStatus{
+		Provider:  provider,
+		CheckedAt: time.Now(),
+	}
+
+	token := &auth.Token{} // providers without OAuth need none
+	if authProvider != "" {
+		token, err = m.authClient.GetToken(ctx, userJWT, authProvider)
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrAccountNotConnected) {
+			status.State = TokenNotConnected
+		} else {
+			status.State = TokenError
+		}
+		status.Detail = err.Error()
+		return status, nil
+	}
+
+	if !token.Expiry.IsZero() && token.Expiry.Unix() > 0 {
+		expiry := token.Expiry
+		status.ExpiresAt = &expiry
+	}
+
+	mailProvider, err := m.newProvider(ctx, token, userID, provider, ProviderOptions{})
+	if err != nil {
+		status.State = TokenError
+		status.Detail = err.Error()
+		return status, nil
+	}
+
+	checker, ok := mailProvider.(HealthChecker)
+	if !ok {
+		status.State = TokenError
+		status.Detail = "provider does not support health checks"
+		return status, nil
+	}
+
+	switch err := checker.CheckHealth(ctx); {
+	case err == nil:
+		status.State = TokenHealthy
+	case errors.Is(err, ErrTokenExpired):
+		status.State = TokenExpired
+		status.Detail = err.Error()
+	case errors.Is(err, ErrMissingScopes):
+		status.State = TokenMissingScopes
+		status.Detail = err.Error()
+	default:
+		status.State = TokenError
+		status.Detail = err.Error()
+	}
+
+	return status, nil
+}
@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// heartbeatInterval bounds how often a runner rewrites its heartbeat while
+// it is processing messages
+const heartbeatInterval = 30 * time.Second
+
+// backfillBeatInterval is the heartbeat interval during an initial backfill,
+// short enough for progress bars
+const backfillBeatInterval = 2 * time.Second
+
+// HeartbeatStaleAfter is how old the heartbeat of a live runner may get. The
+// loop beats every 30s and provider calls time out well within this, so an
+// older beat means the runner is stuck or gone.
+const HeartbeatStaleAfter = 3 * time.Minute
+
+// Runner phases recorded in heartbeats
+const (
+	PhaseStarting    = "starting"
+	PhaseBackfill    = "backfill"
+	PhaseIncremental = "incremental"
+	PhaseIdle        = "idle"
+	PhaseStopped     = "stopped"
+)
+
+// Liveness values reported by Liveness
+const (
+	LivenessRunning = "running" // beating recently
+	LivenessStuck   = "stuck"   // registered in this process but not beating
+	LivenessDead    = "dead"    // stopped beating without shutting down cleanly
+	LivenessStopped = "stopped" // not running
+)
+
+// instanceID identifies this API process in heartbeats
+var instanceID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}()
+
+// heartbeat tracks a runner's progress and persists it to the user DB. It is
+// only used from the runner's sync loop.
+type heartbeat struct {
+	ctx   context.Context
+	store eventstore.Store
+	hb    eventstore.Heartbeat
+	last  time.Time // last write
+
+	observe func(phase string) // optional, told of every phase change
+}
+
+func newHeartbeat(ctx context.Context, store eventstore.Store, provider ProviderName, inboxID string) *heartbeat {
+	return &heartbeat{
+		ctx:   ctx,
+		store: store,
+		hb: eventstore.Heartbeat{
+			Provider:  string(provider),
+			InboxID:   inboxID,
+			Instance:  instanceID,
+			Phase:     PhaseStarting,
+			StartedAt: time.Now().Unix(),
+		},
+	}
+}
+
+// beat writes the heartbeat now
+func (h *heartbeat) beat() {
+	h.write(h.ctx)
+}
+
+func (h *heartbeat) write(ctx context.Context) {
+	h.last = time.Now()
+	h.hb.BeatAt = h.last.Unix()
+	if err := h.store.SaveHeartbeat(ctx, h.hb); err != nil && ctx.Err() == nil {
+		log.Printf("Error saving heartbeat: %v", err)
+	}
+}
+
+// maybeBeat writes the heartbeat if the last write is older than the interval
+func (h *heartbeat) maybeBeat() {
+	interval := heartbeatInterval
+	if h.hb.Phase == PhaseBackfill {
+		interval = backfillBeatInterval
+	}
+	if time.Since(h.last) >= interval {
+		h.beat()
+	}
+}
+
+// backfill enters the backfill phase. window is the age limit of the
+// backfill, 0 for all mail.
+func (h *heartbeat) backfill(window time.Duration) {
+	h.hb.BackfillFrom, h.hb.OldestSeen, h.hb.NewestSeen = 0, 0, 0
+	if window > 0 {
+		h.hb.BackfillFrom = time.Now().Add(-window).Unix()
+	}
+	h.phase(PhaseBackfill)
+}
+
+// phase records the phase the runner is entering
+func (h *heartbeat) phase(p string) {
+	h.setPhase(p)
+	h.beat()
+}
+
+// cycleDone records the outcome of a sync cycle and returns to idle
+func (h *heartbeat) cycleDone(err error) {
+	if err != nil {
+		h.hb.Errors++
+		h.hb.LastError = err.Error()
+	} else {
+		h.hb.Cycles++
+	}
+	h.phase(PhaseIdle)
+}
+
+// stop records a clean shutdown. The runner's context is already cancelled,
+// so it writes with a fresh one.
+func (h *heartbeat) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	h.setPhase(PhaseStopped)
+	h.write(ctx)
+}
+
+func (h *heartbeat) setPhase(p string) {
+	h.hb.Phase = p
+	if h.observe != nil {
+		h.observe(p)
+	}
+}
+
+// messages counts messages passed to fn. During a backfill it also tracks
+// the range of message dates covered so far.
+func (h *heartbeat) messages(fn func(MessageMeta) error) func(MessageMeta) error {
+	return func(meta MessageMeta) error {
+		err := fn(meta)
+		h.hb.Messages++
+		if h.hb.Phase == PhaseBackfill && !meta.MessageDate.IsZero() {
+			date := meta.MessageDate.Unix()
+			if h.hb.OldestSeen == 0 || date < h.hb.OldestSeen {
+				h.hb.OldestSeen = date
+			}
+			if date > h.hb.NewestSeen {
+				h.hb.NewestSeen = date
+			}
+		}
+		h.maybeBeat()
+		return err
+	}
+}
+
+// changes counts message changes passed to fn
+func (h *heartbeat) changes(fn func(MessageChange) error) func(MessageChange) error {
+	return func(change MessageChange) error {
+		err := fn(change)
+		h.hb.Changes++
+		h.maybeBeat()
+		return err
+	}
+}
+
+// Liveness classifies a sync from its heartbeat and whether this process has
+// a runner registered for it. A fresh beat counts as running even if another
+// API instance owns the runner.
+func Liveness(registered bool, hb *eventstore.Heartbeat, now time.Time) string {
+	beating := hb != nil && hb.Phase != PhaseStopped
+	switch {
+	case beating && now.Sub(time.Unix(hb.BeatAt, 0)) <= HeartbeatStaleAfter:
+		return LivenessRunning
+	case registered:
+		return LivenessStuck
+	case beating:
+		return LivenessDead
+	default:
+		return LivenessStopped
+	}
+}
@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// ImportResult reports what an archive import did
+type ImportResult struct {
+	Processed int `json:"processed"`
+	Failed    int `json:"failed"`
+}
+
+// ImportSource feeds normalized messages to fn (e.g. an mbox parser). Returning
+// an error from the source aborts the import.
+type ImportSource func(fn func(MessageMeta) error) error
+
+// ImportMessages runs messages from an archive through the same processor as
+// provider sync: stored as provider IMPORT (re-imports are deduplicated by
+// message id) and published as email.received events
+func (m *Manager) ImportMessages(ctx context.Context, userID string, source ImportSource) (*ImportResult, error) {
+	store, err := m.stores.Open(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open user DB: %w", err)
+	}
+	defer store.Close()
+
+	runner := &Runner{
+		Stores:       m.stores,
+		Publisher:    m.publisher,
+		ProviderName: ProviderImport,
+		Pipeline:     m.pipeline,
+		Payload:      m.payload,
+		Blobs:        m.blobs,
+		Attachments:  m.attachments,
+		turns:        m.turns,
+	}
+	proc := runner.createProcessor(ctx, store, userID, "import")
+
+	result := &ImportResult{}
+	err = source(func(meta MessageMeta) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		meta.Provider = ProviderImport
+		meta.UserID = userID
+		if err := proc(meta); err != nil {
+			log.Printf("Error importing message %s for user %s: %v", meta.MessageID, userID, err)
+			result.Failed++
+			return nil
+		}
+		result.Processed++
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("import: %w", err)
+	}
+
+	// No runner publishes IMPORT events, so drain the outbox now
+	if err := m.publisher.EnsureStream(ctx); err != nil {
+		return result, fmt.Errorf("failed to ensure NATS stream: %w", err)
+	}
+	for {
+		n, err := runner.dispatchOnce(ctx, store)
+		if err != nil {
+			return result, fmt.Errorf("publish: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package sync
+
+import "strings"
+
+// Importance rates how likely a received message needs the user's attention,
+// from 0 to 1. The sender's relationship score (see internal/relationship)
+// carries most of the weight; the provider's own importance markers and a
+// flag add to it, and list mail is discounted. Sent mail, bounces and
+// auto-replies get 0.
+func Importance(meta *MessageMeta, senderScore float64) float64 {
+	if meta.Folder == FolderSent || (meta.Kind != "" && meta.Kind != KindMessage) {
+		return 0
+	}
+
+	score := 0.2 + 0.5*senderScore
+	if markedImportant(meta) {
+		score += 0.15
+	}
+	if meta.IsFlagged {
+		score += 0.15
+	}
+	if meta.List != nil {
+		score *= 0.3
+	}
+	score = min(max(score, 0), 1)
+	return float64(int(score*100+0.5)) / 100
+}
+
+// markedImportant reports Gmail's IMPORTANT label or a high Importance or
+// X-Priority header (Outlook and most clients)
+func markedImportant(meta *MessageMeta) bool {
+	for _, label := range meta.ProviderLabels {
+		if label == "IMPORTANT" {
+			return true
+		}
+	}
+	if strings.EqualFold(HeaderValue(meta.Headers, "Importance"), "high") {
+		return true
+	}
+	priority := strings.TrimSpace(HeaderValue(meta.Headers, "X-Priority"))
+	return strings.HasPrefix(priority, "1") || strings.HasPrefix(priority, "2")
+}
@@ -0,0 +1,192 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/ics"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// eventInviteReceived is published for each event of a calendar invite sent
+// with a stored message
+const eventInviteReceived = "calendar.invite.received"
+
+// maxInviteSize bounds the iCalendar data read from one part
+const maxInviteSize = 1 << 20
+
+// inviteMethods are the iCalendar methods that invite the user or call an
+// invite off. Replies, counter-proposals and refresh requests are answers to
+// the user's own invites.
+var inviteMethods = map[string]bool{"": true, "REQUEST": true, "PUBLISH": true, "ADD": true, "CANCEL": true}
+
+// inviteEvent is an event of an invite, with the calendar it came in
+type inviteEvent struct {
+	cal   *ics.Calendar
+	event ics.Event
+}
+
+// pendingInvites are a message's invites, to store with it
+type pendingInvites struct {
+	suggestion eventstore.CalendarSuggestion
+	events     []eventstore.OutboxEntry
+}
+
+// isCalendar reports whether an attachment holds iCalendar data
+func isCalendar(a Attachment) bool {
+	if mediaType, _, err := mime.ParseMediaType(a.ContentType); err == nil {
+		switch strings.ToLower(mediaType) {
+		case "text/calendar", "application/ics":
+			return true
+		}
+	}
+	return strings.EqualFold(path.Ext(a.Filename), ".ics")
+}
+
+// findInvites parses the iCalendar parts and attachments of a message. An
+// invite sent both inline and as invite.ics is read once.
+func findInvites(meta *MessageMeta) []inviteEvent {
+	parts := meta.CalendarParts
+	for _, a := range meta.Attachments {
+		if isCalendar(a) && a.Data != nil {
+			parts = append(parts, a.Data)
+		}
+	}
+
+	var found []inviteEvent
+	seen := map[string]bool{}
+	for _, data := range parts {
+		if len(data) > maxInviteSize {
+			continue
+		}
+		cal, err := ics.Parse(data)
+		if err != nil {
+			log.Printf("Skipping calendar part of %s: %v", meta.MessageID, err)
+			continue
+		}
+		if !inviteMethods[cal.Method] {
+			continue
+		}
+		for _, e := range cal.Events {
+			key := fmt.Sprintf("%s|%d|%d", e.UID, e.Sequence, e.Start.Unix())
+			if !seen[key] {
+				seen[key] = true
+				found = append(found, inviteEvent{cal, e})
+			}
+		}
+	}
+	return found
+}
+
+// inviteRecords builds what a message's invites store: one calendar
+// suggestion for the message, keyed by its first event's UID, and a
+// calendar.invite.received event per event, linked to the message. nil if
+// the message carries no invite.
+func inviteRecords(userID, inboxID, eventID string, ts int64, meta *MessageMeta) (*pendingInvites, error) {
+	invites := findInvites(meta)
+	if len(invites) == 0 {
+		return nil, nil
+	}
+
+	first := invites[0]
+	p := &pendingInvites{suggestion: eventstore.CalendarSuggestion{
+		Provider:          string(meta.Provider),
+		ProviderMessageID: meta.MessageID,
+		ProviderThreadID:  meta.ThreadID,
+		SourceEventID:     eventID,
+		Title:             first.event.Summary,
+		Candidates:        []eventstore.CalendarSlot{},
+		Attendees:         []string{},
+		ConferenceURL:     first.event.Conference,
+		CreatedAt:         ts,
+		Source:            eventstore.SuggestionFromInvite,
+		InviteUID:         first.event.UID,
+		InviteSequence:    first.event.Sequence,
+		Status:            eventstore.SuggestionActive,
+	}}
+	if p.suggestion.Title == "" {
+		p.suggestion.Title = meta.Subject
+	}
+	if first.cal.Cancelled(&first.event) {
+		p.suggestion.Status = eventstore.SuggestionCancelled
+	}
+	if p.suggestion.InviteUID == "" {
+		// Without a UID its versions can't be told apart; it stands alone
+		p.suggestion.InviteUID = meta.MessageID
+	}
+
+	s := &p.suggestion
+	attendees := map[string]bool{}
+	for i, inv := range invites {
+		e := inv.event
+		s.Candidates = append(s.Candidates, eventstore.CalendarSlot{Start: e.Start, End: e.End, AllDay: e.AllDay})
+		if start := e.Start.Unix(); s.StartsAt == 0 || start < s.StartsAt {
+			s.StartsAt = start
+		}
+		s.EndsAt = max(s.EndsAt, e.End.Unix())
+		for _, a := range append([]string{e.Organizer}, e.Attendees...) {
+			if a != "" && !attendees[a] {
+				attendees[a] = true
+				s.Attendees = append(s.Attendees, a)
+			}
+		}
+		if s.ConferenceURL == "" {
+			s.ConferenceURL = e.Conference
+		}
+
+		payload, err := json.Marshal(map[string]interface{}{
+			"user_id":             userID,
+			"ts":                  time.Now().Unix(),
+			"provider":            string(meta.Provider),
+			"inbox_id":            inboxID,
+			"source_event_id":     eventID,
+			"provider_message_id": meta.MessageID,
+			"provider_thread_id":  meta.ThreadID,
+			"method":              inv.cal.Method,
+			"uid":                 e.UID,
+			"sequence":            e.Sequence,
+			"status":              e.Status,
+			"cancelled":           inv.cal.Cancelled(&e),
+			"title":               e.Summary,
+			"start":               e.Start,
+			"end":                 e.End,
+			"all_day":             e.AllDay,
+			"recurring":           e.Recurring,
+			"location":            e.Location,
+			"conference_url":      e.Conference,
+			"organizer":           e.Organizer,
+			"attendees":           e.Attendees,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("encode %s event: %w", eventInviteReceived, err)
+		}
+		p.events = append(p.events, eventstore.OutboxEntry{
+			Subject:   fmt.Sprintf("user.%s.%s", userID, eventInviteReceived),
+			EventType: eventInviteReceived,
+			Payload:   payload,
+			MsgID:     fmt.Sprintf("%s|%s|%s|%d", eventInviteReceived, meta.Provider, meta.MessageID, i),
+		})
+	}
+	return p, nil
+}
+
+// save stores the invites' suggestion and queues their events
+func (p *pendingInvites) save(ctx context.Context, tx eventstore.Tx) error {
+	if err := tx.SaveCalendarSuggestion(ctx, p.suggestion); err != nil {
+		return err
+	}
+	for _, out := range p.events {
+		out.TraceParent = natsjs.TraceParent(ctx)
+		if err := tx.AppendOutbox(ctx, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// DefaultLagSLO is how long the newest inbox message may be missing from the
+// store before a sync counts as behind
+const DefaultLagSLO = 15 * time.Minute
+
+// lagCheckInterval bounds how often the provider is asked for its newest
+// message
+const lagCheckInterval = 5 * time.Minute
+
+// Lag instruments, recorded through the global MeterProvider
+var (
+	lagSeconds  metric.Float64Histogram
+	sloBreaches metric.Int64Counter
+)
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/sync")
+
+	var err error
+	if lagSeconds, err = meter.Float64Histogram("sync.lag",
+		metric.WithDescription("How long the newest provider inbox message has been missing from the store"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	if sloBreaches, err = meter.Int64Counter("sync.lag.slo_breaches",
+		metric.WithDescription("Lag measurements above the freshness SLO"),
+		metric.WithUnit("{measurement}")); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// computeLag measures freshness at now: zero if the store has the provider's
+// newest inbox message, otherwise how long that message has been waiting
+func computeLag(providerNewest time.Time, localNewest int64, now time.Time) eventstore.SyncLag {
+	lag := eventstore.SyncLag{LocalNewestAt: localNewest, CheckedAt: now.Unix()}
+	if providerNewest.IsZero() {
+		return lag
+	}
+	lag.ProviderNewestAt = providerNewest.Unix()
+	if localNewest < lag.ProviderNewestAt {
+		lag.LagSeconds = max(now.Unix()-lag.ProviderNewestAt, 0)
+	}
+	return lag
+}
+
+// checkLag measures and stores the inbox's sync lag, for providers that can
+// report their newest message
+func (r *Runner) checkLag(ctx context.Context, store eventstore.Store, userID string) {
+	fc, ok := r.Provider.(FreshnessChecker)
+	if !ok {
+		return
+	}
+
+	providerNewest, err := fc.NewestInboxMessage(ctx, "me")
+	if err != nil {
+		log.Printf("Error checking newest message for user %s: %v", userID, err)
+		return
+	}
+	localNewest, err := store.NewestMessageDate(ctx, string(r.ProviderName), string(FolderInbox))
+	if err != nil {
+		log.Printf("Error loading newest stored message for user %s: %v", userID, err)
+		return
+	}
+
+	lag := computeLag(providerNewest, localNewest, time.Now())
+	if err := store.SaveSyncLag(ctx, string(r.ProviderName), lag); err != nil {
+		log.Printf("Error saving sync lag: %v", err)
+	}
+
+	attrs := metric.WithAttributes(attribute.String("provider", string(r.ProviderName)))
+	lagSeconds.Record(ctx, float64(lag.LagSeconds), attrs)
+
+	slo := r.LagSLO
+	if slo <= 0 {
+		slo = DefaultLagSLO
+	}
+	if time.Duration(lag.LagSeconds)*time.Second > slo {
+		sloBreaches.Add(ctx, 1, attrs)
+		log.Printf("Sync for user %s (%s) is %ds behind the provider (SLO %s)", userID, r.ProviderName, lag.LagSeconds, slo)
+	}
+}
+
+// WithinSLO reports whether a measured lag meets the freshness SLO. States
+// that were never measured count as within it.
+func WithinSLO(lag eventstore.SyncLag, slo time.Duration) bool {
+	if slo <= 0 {
+		slo = DefaultLagSLO
+	}
+	return time.Duration(lag.LagSeconds)*time.Second <= slo
+}
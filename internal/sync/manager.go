@@ -2,102 +2,548 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
 	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Errors callers can match with errors.Is
+var (
+	// ErrSyncAlreadyRunning is returned by StartSync for an inbox that is already syncing
+	ErrSyncAlreadyRunning = errors.New("sync already running")
+	// ErrSyncNotRunning is returned by StopSync for an inbox that isn't syncing
+	ErrSyncNotRunning = errors.New("no sync running")
+	// ErrUnsupportedProvider is returned for providers without an adapter
+	ErrUnsupportedProvider = errors.New("unsupported provider")
+	// ErrNotSupported is returned for operations a provider adapter doesn't implement
+	ErrNotSupported = errors.New("not supported by provider")
+	// ErrMessageNotFound is returned when a referenced message isn't stored
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrNoUnsubscribe is returned for lists without a usable List-Unsubscribe
+	ErrNoUnsubscribe = errors.New("list has no one-click or mailto unsubscribe")
+	// ErrUnsubscribeFailed is returned when a list's unsubscribe endpoint
+	// rejects the request
+	ErrUnsubscribeFailed = errors.New("unsubscribe request failed")
+	// ErrInboxConflict is returned by Connect for a provider the user already
+	// syncs under another inbox id
+	ErrInboxConflict = errors.New("provider already connected under another inbox")
+)
+
+// DefaultPollInterval is the time between incremental syncs
+const DefaultPollInterval = 30 * time.Second
+
 // InboxConfig config for user inbox sync
 type InboxConfig struct {
 	UserID   string
 	InboxID  string
 	Provider ProviderName
 	UserJWT  string // JWT to fetch tokens from BetterAuth
+	Options  ProviderOptions
+
+	// Access is what the client asked to do with the inbox besides syncing
+	// it, checked against the token's scopes by Connect. It isn't stored.
+	Access []Access
+}
+
+// ProviderOptions are per-inbox sync settings
+type ProviderOptions struct {
+	IncludeSpam bool // also sync spam/junk folders (tagged with folder "spam")
+
+	// BackfillWindow limits the initial backfill to mail received this
+	// recently; zero backfills all mail
+	BackfillWindow time.Duration
+
+	// Folders limits sync to these canonical folders; empty syncs the
+	// provider's defaults. Folder-aware providers select them in the folder
+	// tree when the initial backfill starts; for others messages in other
+	// folders are skipped.
+	Folders []Folder
+
+	// PollInterval is the time between incremental syncs; zero uses
+	// DefaultPollInterval
+	PollInterval time.Duration
+
+	// UserID and Provider identify whose calls the adapter makes. Set by the
+	// manager.
+	UserID   string
+	Provider ProviderName
+
+	// Timeouts bound each provider call. Set by the manager from its own
+	// configuration; zero values in the factory mean no timeout.
+	Timeouts Timeouts
+
+	// Pacer paces the user's calls to the provider, shared with the user's
+	// other syncs and the global limit. Nil when the provider isn't limited.
+	Pacer *ratelimit.Pacer
+
+	// Debug logs the adapter's calls while debug mode is on for the user.
+	// Set by the manager for syncs; nil for adapters built for one-off calls.
+	Debug *DebugTrace
+
+	// RefreshToken fetches a fresh provider token from BetterAuth, for
+	// adapters whose token expires while they are in use. Set by the manager.
+	RefreshToken func(ctx context.Context) (*auth.Token, error)
 }
 
-// ProviderFactory creates MailProvider
-type ProviderFactory func(ctx context.Context, token *auth.Token, userID string, provider ProviderName) (MailProvider, error)
+// DisconnectOptions controls what happens beyond stopping the runner
+type DisconnectOptions struct {
+	Revoke bool // revoke the provider token through BetterAuth
+	Purge  bool // delete synced data for the provider
+}
+
+// DisconnectResult reports what a disconnect actually did
+type DisconnectResult struct {
+	Stopped      bool  `json:"stopped"`
+	Revoked      bool  `json:"revoked"`
+	PurgedEvents int64 `json:"purged_events"`
+}
+
+// ProviderFactory creates MailProvider. RegisteredProviders creates the
+// adapters in the provider registry.
+type ProviderFactory func(ctx context.Context, token *auth.Token, userID string, provider ProviderName, opts ProviderOptions) (MailProvider, error)
 
 // Manager manages multi-user sync workers
 type Manager struct {
-	dataRoot        string
+	stores          eventstore.Opener
 	authClient      *auth.BetterAuthClient
 	publisher       *natsjs.Publisher
 	providerFactory ProviderFactory
-	runners         map[string]context.CancelFunc
+	serviceTokens   *auth.ServiceTokenIssuer // optional, for work without a user JWT
+	pipeline        *Pipeline                // nil uses DefaultStages
+	payload         *PayloadPolicy           // optional, fields of published events
+	blobs           blob.Store               // optional, for offloaded payloads and attachments
+	attachments     *AttachmentPolicy        // optional, attachments kept for text extraction
+	reporter        errreport.Reporter       // receives runner and job failures
+	lagSLO          time.Duration            // freshness SLO for sync lag
+	timeouts        Timeouts                 // per-call provider timeouts
+	limiters        map[ProviderName]*ratelimit.Limiter
+	baseLimits      map[ProviderName]ratelimit.Limits // startup limits that runtime settings override
+	live            liveSettings                      // runtime settings, see ApplySettings
+	configs         *syncconfig.Store                 // optional, inboxes that should be syncing
+	notify          func(ctx context.Context)         // called after configs change
+	remote          bool                              // syncs run in separate worker processes
+	ownership       Ownership                         // optional, users this process syncs
+	runners         map[string]*runnerHandle
 	runnersMutex    sync.RWMutex
+	runnersCtx      context.Context // parent of every runner, cancelled by StopAll
+	stopRunners     context.CancelFunc
+	draining        sync.Map       // users whose outbox DispatchOutbox is publishing
+	turns           *dispatchTurns // outbox batches published at once, across users
+	adapters        *adapterCache
+}
+
+// runnerHandle is a running sync: its cancel func and the runner, which
+// takes sync-now requests
+type runnerHandle struct {
+	cancel    context.CancelFunc
+	done      chan struct{} // closed once the runner has exited
+	runner    *Runner
+	userID    string
+	inboxID   string
+	provider  ProviderName
+	startedAt time.Time
+}
+
+// RunningSync is a sync running in this process
+type RunningSync struct {
+	UserID    string       `json:"user_id"`
+	InboxID   string       `json:"inbox_id"`
+	Provider  ProviderName `json:"provider"`
+	StartedAt int64        `json:"started_at"` // unix seconds
+	Phase     string       `json:"phase"`      // see Runner.Phase
 }
 
 // NewManager creates sync manager
-func NewManager(dataRoot string, authClient *auth.BetterAuthClient, publisher *natsjs.Publisher, providerFactory ProviderFactory) *Manager {
+func NewManager(stores eventstore.Opener, authClient *auth.BetterAuthClient, publisher *natsjs.Publisher, providerFactory ProviderFactory) *Manager {
+	runnersCtx, stopRunners := context.WithCancel(context.Background())
 	return &Manager{
-		dataRoot:        dataRoot,
+		stores:          stores,
 		authClient:      authClient,
 		publisher:       publisher,
 		providerFactory: providerFactory,
-		runners:         make(map[string]context.CancelFunc),
+		reporter:        errreport.Nop{},
+		lagSLO:          DefaultLagSLO,
+		timeouts:        DefaultTimeouts,
+		limiters:        make(map[ProviderName]*ratelimit.Limiter),
+		baseLimits:      make(map[ProviderName]ratelimit.Limits),
+		live:            liveSettings{backfills: newSlots(), rateLimits: make(map[ProviderName]string)},
+		runners:         make(map[string]*runnerHandle),
+		runnersCtx:      runnersCtx,
+		stopRunners:     stopRunners,
+		adapters:        newAdapterCache(),
+		turns:           newDispatchTurns(DefaultDispatchConcurrency, DispatchRoundRobin),
+	}
+}
+
+// SetServiceTokens lets the manager fetch provider tokens without a user JWT
+// (scheduled jobs) using service tokens with the tokens:read scope
+func (m *Manager) SetServiceTokens(issuer *auth.ServiceTokenIssuer) {
+	m.serviceTokens = issuer
+}
+
+// SetPipeline sets the transformation pipeline applied to received messages
+func (m *Manager) SetPipeline(p *Pipeline) {
+	m.pipeline = p
+}
+
+// SetPayloadPolicy selects the fields of published mail events
+func (m *Manager) SetPayloadPolicy(p *PayloadPolicy) {
+	m.payload = p
+}
+
+// SetBlobStore enables offloading of oversized event payloads
+func (m *Manager) SetBlobStore(store blob.Store) {
+	m.blobs = store
+}
+
+// SetAttachmentPolicy enables storing attachments for text extraction (needs
+// a blob store)
+func (m *Manager) SetAttachmentPolicy(p *AttachmentPolicy) {
+	m.attachments = p
+}
+
+// SetErrorReporter sets where runner and scheduled job failures are reported
+func (m *Manager) SetErrorReporter(r errreport.Reporter) {
+	m.reporter = r
+}
+
+// SetLagSLO sets how far a sync may fall behind its provider before it is
+// reported as outside the freshness SLO
+func (m *Manager) SetLagSLO(slo time.Duration) {
+	m.lagSLO = slo
+}
+
+// LagSLO returns the freshness SLO
+func (m *Manager) LagSLO() time.Duration {
+	return m.lagSLO
+}
+
+// SetProviderTimeouts sets the per-call timeouts for provider requests made by
+// syncs started afterwards
+func (m *Manager) SetProviderTimeouts(t Timeouts) {
+	m.timeouts = t
+}
+
+// SetDispatchFairness sets how many outbox batches this process publishes at
+// once and how users with ready messages take turns beyond that. Call it
+// during setup, before syncs start.
+func (m *Manager) SetDispatchFairness(concurrency int, policy DispatchPolicy) {
+	m.turns = newDispatchTurns(concurrency, policy)
+}
+
+// SetAssignments records connected inboxes in configs so workers, and this
+// process after a restart, run their syncs. notify, if set, is called after
+// every change so workers reconcile without waiting for their next poll.
+func (m *Manager) SetAssignments(configs *syncconfig.Store, notify func(ctx context.Context)) {
+	m.configs = configs
+	m.notify = notify
+}
+
+// SetRemoteSyncs makes Connect only record the assignment, leaving the sync
+// to a worker process (API-only mode). Requires SetAssignments.
+func (m *Manager) SetRemoteSyncs(remote bool) {
+	m.remote = remote
+}
+
+// Ownership decides which users' syncs a process runs when several workers
+// share the sync configs
+type Ownership interface {
+	Owns(userID string) bool
+}
+
+// SetOwnership restricts this process to the users o assigns it. Without it
+// the process runs every assigned sync.
+func (m *Manager) SetOwnership(o Ownership) {
+	m.ownership = o
+}
+
+// owns reports whether this process runs userID's syncs
+func (m *Manager) owns(userID string) bool {
+	return m.ownership == nil || m.ownership.Owns(userID)
+}
+
+// SetRateLimits paces calls to provider for adapters created afterwards. Call
+// it during setup, before syncs start; runtime settings override it later.
+func (m *Manager) SetRateLimits(provider ProviderName, limits ratelimit.Limits) {
+	m.limiters[provider] = ratelimit.New(string(provider), limits)
+	m.baseLimits[provider] = limits
+}
+
+// newProvider creates a provider adapter with the manager's call timeouts and
+// the user's rate limiter
+func (m *Manager) newProvider(ctx context.Context, token *auth.Token, userID string, provider ProviderName, opts ProviderOptions) (MailProvider, error) {
+	opts.UserID = userID
+	opts.Provider = provider
+	opts.Timeouts = m.timeouts
+	opts.Pacer = m.limiters[provider].For(userID)
+	return m.providerFactory(ctx, token, userID, provider, opts)
+}
+
+// Connect records that an inbox should sync and starts it in this process,
+// unless syncs run in workers or another worker owns the user. started is
+// false when a worker will pick the sync up.
+func (m *Manager) Connect(ctx context.Context, config InboxConfig) (started bool, err error) {
+	if err := m.checkInbox(ctx, config); err != nil {
+		return false, err
+	}
+
+	local := !m.remote && m.owns(config.UserID)
+	if !local && m.configs == nil {
+		return false, fmt.Errorf("sync workers are not configured")
+	}
+
+	// Fail fast if the account isn't linked or the token lacks scopes rather
+	// than leaving it to the runner or a worker
+	if err := m.checkToken(ctx, config); err != nil {
+		return false, err
+	}
+
+	if local {
+		if err := m.StartSync(ctx, config); err != nil {
+			return false, err
+		}
+	}
+
+	if m.configs != nil {
+		err := m.configs.Put(ctx, storedConfig(config))
+		if err != nil && !local {
+			return false, err
+		}
+		if err != nil {
+			// The sync is running; it just won't resume after a restart
+			log.Printf("Error saving sync config: %v", err)
+		} else {
+			m.assignmentsChanged(ctx)
+		}
+	}
+	return local, nil
+}
+
+// checkToken fetches the account's token and checks its scopes against the
+// sync's options and the access asked for
+func (m *Manager) checkToken(ctx context.Context, config InboxConfig) error {
+	info, ok := LookupProvider(config.Provider)
+	if !ok {
+		return ErrUnsupportedProvider
+	}
+	if info.AuthProvider == "" {
+		return nil
+	}
+	token, err := m.token(ctx, config.UserJWT, config.UserID, info.AuthProvider)
+	if err != nil {
+		return fmt.Errorf("get token: %w", err)
+	}
+	return checkScopes(ctx, info, token, config.Options, config.Access)
+}
+
+// checkInbox refuses a second inbox id for a provider the user already
+// syncs: a user's sync state and stored mail are kept per provider
+func (m *Manager) checkInbox(ctx context.Context, config InboxConfig) error {
+	if m.configs != nil {
+		configs, err := m.configs.ListUser(ctx, config.UserID)
+		if err != nil {
+			return err
+		}
+		for _, cfg := range configs {
+			if cfg.Provider == string(config.Provider) && cfg.InboxID != config.InboxID {
+				return fmt.Errorf("%w: %s is connected as inbox %q", ErrInboxConflict, config.Provider, cfg.InboxID)
+			}
+		}
+	}
+
+	m.runnersMutex.RLock()
+	defer m.runnersMutex.RUnlock()
+	prefix, suffix := config.UserID+":", ":"+string(config.Provider)
+	for key := range m.runners {
+		if !strings.HasPrefix(key, prefix) || !strings.HasSuffix(key, suffix) || len(key) < len(prefix)+len(suffix) {
+			continue
+		}
+		if inboxID := key[len(prefix) : len(key)-len(suffix)]; inboxID != config.InboxID {
+			return fmt.Errorf("%w: %s is connected as inbox %q", ErrInboxConflict, config.Provider, inboxID)
+		}
+	}
+	return nil
+}
+
+// inboxID returns the inbox id a provider is connected under, "primary" if
+// it isn't known
+func (m *Manager) inboxID(ctx context.Context, userID string, provider ProviderName) string {
+	if m.configs != nil {
+		configs, err := m.configs.ListUser(ctx, userID)
+		if err == nil {
+			for _, cfg := range configs {
+				if cfg.Provider == string(provider) {
+					return cfg.InboxID
+				}
+			}
+		}
+	}
+	return "primary"
+}
+
+// storedConfig is the sync config persisted for an inbox
+func storedConfig(config InboxConfig) syncconfig.Config {
+	opts := config.Options
+	cfg := syncconfig.Config{
+		UserID:       config.UserID,
+		InboxID:      config.InboxID,
+		Provider:     string(config.Provider),
+		IncludeSpam:  opts.IncludeSpam,
+		BackfillDays: int(opts.BackfillWindow / (24 * time.Hour)),
+		PollInterval: int(opts.PollInterval / time.Second),
+	}
+	for _, f := range opts.Folders {
+		cfg.Folders = append(cfg.Folders, string(f))
+	}
+	return cfg
+}
+
+// inboxConfig is the inbox a stored sync config describes
+func inboxConfig(cfg syncconfig.Config) InboxConfig {
+	opts := ProviderOptions{
+		IncludeSpam:    cfg.IncludeSpam,
+		BackfillWindow: time.Duration(cfg.BackfillDays) * 24 * time.Hour,
+		PollInterval:   time.Duration(cfg.PollInterval) * time.Second,
+	}
+	for _, f := range cfg.Folders {
+		opts.Folders = append(opts.Folders, Folder(f))
+	}
+	return InboxConfig{
+		UserID:   cfg.UserID,
+		InboxID:  cfg.InboxID,
+		Provider: ProviderName(cfg.Provider),
+		Options:  opts,
+	}
+}
+
+// unassign removes an inbox's sync config. Returns false if it had none.
+func (m *Manager) unassign(ctx context.Context, config InboxConfig) (bool, error) {
+	if m.configs == nil {
+		return false, nil
+	}
+	deleted, err := m.configs.Delete(ctx, config.UserID, config.InboxID, string(config.Provider))
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		m.assignmentsChanged(ctx)
+	}
+	return deleted, nil
+}
+
+// assignmentsChanged tells workers to reconcile
+func (m *Manager) assignmentsChanged(ctx context.Context) {
+	if m.notify != nil {
+		m.notify(ctx)
 	}
 }
 
-// StartSync starts syncing for user inbox
+// StartSync starts syncing for user inbox. ctx (typically the request's)
+// bounds only the setup, at most Timeouts.Start; the runner outlives it and
+// runs until StopSync or StopAll.
 func (m *Manager) StartSync(ctx context.Context, config InboxConfig) error {
 	key := fmt.Sprintf("%s:%s:%s", config.UserID, config.InboxID, config.Provider)
 
+	ctx, span := tracer.Start(ctx, "sync.start", trace.WithAttributes(
+		attribute.String("user.id", config.UserID),
+		attribute.String("mail.provider", string(config.Provider)),
+	))
+	defer span.End()
+	ctx, cancelSetup := WithTimeout(ctx, m.timeouts.Start)
+	defer cancelSetup()
+
 	m.runnersMutex.Lock()
 	defer m.runnersMutex.Unlock()
 
 	if _, exists := m.runners[key]; exists {
-		return fmt.Errorf("sync already running")
+		return ErrSyncAlreadyRunning
 	}
 
 	// Map provider
-	var authProvider auth.Provider
-	switch config.Provider {
-	case ProviderGoogle:
-		authProvider = auth.ProviderGoogle
-	case ProviderMicrosoft:
-		authProvider = auth.ProviderMicrosoft
-	default:
-		return fmt.Errorf("unsupported provider")
-	}
-
-	// Fetch token from BetterAuth
-	token, err := m.authClient.GetToken(ctx, config.UserJWT, authProvider)
+	authProvider, err := authProviderFor(config.Provider)
 	if err != nil {
-		return fmt.Errorf("get token: %w", err)
+		return err
 	}
 
-	// Create provider adapter
-	mailProvider, err := m.providerFactory(ctx, token, config.UserID, config.Provider)
+	// Get the account's provider adapter, shared with its other syncs and
+	// one-off calls, or build one with a token from BetterAuth (a service
+	// token when a worker starts the sync without a user request)
+	debug := NewDebugTrace(config.UserID, config.Provider)
+	config.Options.Debug = debug
+	config.Options.RefreshToken = func(ctx context.Context) (*auth.Token, error) {
+		return m.refreshToken(ctx, config.UserJWT, config.UserID, authProvider)
+	}
+	acct := account{userID: config.UserID, provider: config.Provider}
+	mailProvider, release, err := m.adapters.acquire(ctx, acct, variantOf(config.Options), true, func() (MailProvider, *auth.Token, error) {
+		return m.buildProvider(ctx, config.UserJWT, config.UserID, config.Provider, authProvider, config.Options)
+	})
 	if err != nil {
-		return fmt.Errorf("create provider: %w", err)
+		return err
 	}
 
 	// Create runner
 	runner := &Runner{
-		DataRoot:     m.dataRoot,
-		AuthClient:   m.authClient,
-		UserJWT:      config.UserJWT,
-		Publisher:    m.publisher,
-		Provider:     mailProvider,
-		ProviderName: config.Provider,
+		Stores:         m.stores,
+		AuthClient:     m.authClient,
+		UserJWT:        config.UserJWT,
+		Publisher:      m.publisher,
+		Provider:       mailProvider,
+		ProviderName:   config.Provider,
+		IncludeSpam:    config.Options.IncludeSpam,
+		Folders:        config.Options.Folders,
+		BackfillWindow: config.Options.BackfillWindow,
+		PollInterval:   config.Options.PollInterval,
+		Pipeline:       m.pipeline,
+		Payload:        m.payload,
+		Blobs:          m.blobs,
+		Reporter:       m.reporter,
+		LagSLO:         m.lagSLO,
+		Debug:          debug,
+		wake:           make(chan struct{}, 1),
+		defaultPoll:    m.DefaultPollInterval,
+		backfills:      m.live.backfills,
+		turns:          m.turns,
 	}
 
-	// Start background worker
-	runnerCtx, cancel := context.WithCancel(ctx)
-	m.runners[key] = cancel
+	// Start background worker, detached from ctx: the runner belongs to the
+	// manager, not to the request that started it
+	runnerCtx, cancel := context.WithCancel(m.runnersCtx)
+	handle := &runnerHandle{
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		runner:    runner,
+		userID:    config.UserID,
+		inboxID:   config.InboxID,
+		provider:  config.Provider,
+		startedAt: time.Now(),
+	}
+	m.runners[key] = handle
 
 	go func() {
+		defer close(handle.done)
 		log.Printf("sync start: %s", key)
-		if err := runner.RunInbox(runnerCtx, config.UserID, config.InboxID); err != nil {
-			log.Printf("sync error %s: %v", key, err)
-		}
+		m.supervise(runnerCtx, key, runner, config)
+		release()
 
+		// StopSync may have made way for a new runner already
 		m.runnersMutex.Lock()
-		delete(m.runners, key)
+		if m.runners[key] == handle {
+			delete(m.runners, key)
+		}
 		m.runnersMutex.Unlock()
 		log.Printf("sync stop: %s", key)
 	}()
@@ -105,23 +551,290 @@ func (m *Manager) StartSync(ctx context.Context, config InboxConfig) error {
 	return nil
 }
 
-// StopSync stops syncing for a user inbox
+// Restart backoff after a runner panics
+const (
+	restartDelayMin = 30 * time.Second
+	restartDelayMax = 10 * time.Minute
+)
+
+// supervise runs the runner until it returns. A panic (typically in a
+// provider adapter) is recovered, reported and recorded as an ERROR sync
+// status, and the runner is restarted with backoff until the sync is stopped.
+func (m *Manager) supervise(ctx context.Context, key string, runner *Runner, config InboxConfig) {
+	delay := restartDelayMin
+	for {
+		err := errreport.Catch(func() error {
+			return runner.RunInbox(ctx, config.UserID, config.InboxID)
+		})
+		var panicErr *errreport.PanicError
+		if !errors.As(err, &panicErr) {
+			if err != nil {
+				log.Printf("sync error %s: %v", key, err)
+				runner.report(ctx, config.UserID, err)
+			}
+			return
+		}
+
+		log.Printf("sync panic %s: %v\n%s", key, panicErr.Value, panicErr.Stack)
+		runner.report(ctx, config.UserID, err)
+		m.markSyncError(config.UserID, config.Provider, err)
+
+		log.Printf("sync restart %s in %s", key, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, restartDelayMax)
+	}
+}
+
+// markSyncError records a sync failure outside the runner, which has already
+// released its store
+func (m *Manager) markSyncError(userID string, provider ProviderName, cause error) {
+	store, err := m.stores.Open(userID)
+	if err != nil {
+		log.Printf("Error opening user DB to record sync error: %v", err)
+		return
+	}
+	defer store.Close()
+
+	if err := store.UpdateSyncStatus(context.Background(), string(provider), "ERROR", string(CodeOf(cause)), cause.Error()); err != nil {
+		log.Printf("Error recording sync error: %v", err)
+	}
+}
+
+// StopSync stops syncing for a user inbox. It doesn't wait for the runner
+// to exit.
 func (m *Manager) StopSync(userID, inboxID string, provider ProviderName) error {
+	_, err := m.stopSync(userID, inboxID, provider)
+	return err
+}
+
+// stopSync stops syncing for a user inbox and returns a channel closed once
+// the runner has exited
+func (m *Manager) stopSync(userID, inboxID string, provider ProviderName) (<-chan struct{}, error) {
 	key := fmt.Sprintf("%s:%s:%s", userID, inboxID, provider)
 
 	m.runnersMutex.Lock()
 	defer m.runnersMutex.Unlock()
 
-	cancel, exists := m.runners[key]
+	handle, exists := m.runners[key]
 	if !exists {
-		return fmt.Errorf("no sync running for %s", key)
+		return nil, fmt.Errorf("%w for %s", ErrSyncNotRunning, key)
 	}
 
-	cancel()
+	handle.cancel()
 	delete(m.runners, key)
+	return handle.done, nil
+}
+
+// stopWait bounds how long Disconnect waits for a stopped sync to exit
+const stopWait = 30 * time.Second
+
+// awaitStopped waits until the inbox's runner has exited. done is closed
+// when it ran in this process (nil otherwise). With remote, a runner in a
+// worker process is waited for too: it marks its heartbeat stopped once it
+// has seen the sync unassigned, and a heartbeat gone stale counts as
+// stopped.
+func (m *Manager) awaitStopped(ctx context.Context, config InboxConfig, done <-chan struct{}, remote bool) error {
+	ctx, cancel := context.WithTimeout(ctx, stopWait)
+	defer cancel()
+
+	if done != nil {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("sync %s/%s still running: %w", config.Provider, config.InboxID, ctx.Err())
+		}
+	}
+	if !remote {
+		return nil
+	}
+
+	store, err := m.stores.Open(config.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to open user DB: %w", err)
+	}
+	defer store.Close()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		states, err := store.SyncStates(ctx)
+		if err != nil {
+			return fmt.Errorf("read sync state: %w", err)
+		}
+		running := false
+		for _, st := range states {
+			hb := st.Heartbeat
+			if hb != nil && hb.Provider == string(config.Provider) && hb.InboxID == config.InboxID {
+				running = Liveness(false, hb, time.Now()) == LivenessRunning
+			}
+		}
+		if !running {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("sync %s/%s still running: %w", config.Provider, config.InboxID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncNow asks a running sync to start an incremental sync right away
+// instead of at its next poll. Requests made while one is pending are
+// merged. Syncs run by worker processes can't be reached this way.
+func (m *Manager) SyncNow(userID, inboxID string, provider ProviderName) error {
+	key := fmt.Sprintf("%s:%s:%s", userID, inboxID, provider)
+
+	m.runnersMutex.RLock()
+	defer m.runnersMutex.RUnlock()
+
+	handle, exists := m.runners[key]
+	if !exists {
+		return fmt.Errorf("%w for %s", ErrSyncNotRunning, key)
+	}
+	handle.runner.SyncNow()
 	return nil
 }
 
+// Disconnect stops syncing for a user inbox, waits for a runner in this
+// process to exit, and optionally revokes the provider token and purges the
+// inbox's synced data. A purge also waits for a worker process's runner to
+// stop, so nothing is written back after it.
+func (m *Manager) Disconnect(ctx context.Context, config InboxConfig, opts DisconnectOptions) (*DisconnectResult, error) {
+	result := &DisconnectResult{}
+
+	// Unassign first so a worker doesn't restart the sync
+	unassigned, err := m.unassign(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := m.stopSync(config.UserID, config.InboxID, config.Provider)
+	if err == nil || unassigned {
+		result.Stopped = true
+	} else if !opts.Revoke && !opts.Purge {
+		return nil, err
+	}
+	if err := m.awaitStopped(ctx, config, done, opts.Purge); err != nil {
+		return nil, err
+	}
+
+	if opts.Revoke {
+		authProvider, err := authProviderFor(config.Provider)
+		if err != nil {
+			return nil, err
+		}
+		if authProvider != "" {
+			if err := m.authClient.RevokeToken(ctx, config.UserJWT, authProvider); err != nil {
+				return nil, fmt.Errorf("revoke token: %w", err)
+			}
+			m.adapters.forget(account{userID: config.UserID, provider: config.Provider})
+			result.Revoked = true
+		}
+	}
+
+	if opts.Purge {
+		store, err := m.stores.Open(config.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open user DB: %w", err)
+		}
+		defer store.Close()
+
+		deleted, err := store.PurgeInbox(ctx, string(config.Provider), config.InboxID)
+		if err != nil {
+			return nil, fmt.Errorf("purge: %w", err)
+		}
+		result.PurgedEvents = deleted
+	}
+
+	return result, nil
+}
+
+// providerFor returns an adapter for one-off calls outside a sync runner:
+// the account's cached adapter if there is one, or a new one built with a
+// token from BetterAuth and kept for later calls. Without a user JWT the
+// token is fetched with a service token.
+func (m *Manager) providerFor(ctx context.Context, userJWT, userID string, provider ProviderName) (MailProvider, error) {
+	authProvider, err := authProviderFor(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	acct := account{userID: userID, provider: provider}
+	if mailProvider := m.adapters.any(acct); mailProvider != nil {
+		return mailProvider, nil
+	}
+
+	opts := ProviderOptions{
+		RefreshToken: func(ctx context.Context) (*auth.Token, error) {
+			return m.refreshToken(ctx, userJWT, userID, authProvider)
+		},
+	}
+	mailProvider, _, err := m.adapters.acquire(ctx, acct, adapterVariant{}, false, func() (MailProvider, *auth.Token, error) {
+		return m.buildProvider(ctx, userJWT, userID, provider, authProvider, opts)
+	})
+	return mailProvider, err
+}
+
+// buildProvider fetches the account's token with ctx and builds an adapter.
+// The adapter is cached and outlives ctx, so it isn't created with it.
+func (m *Manager) buildProvider(ctx context.Context, userJWT, userID string, provider ProviderName, authProvider auth.Provider, opts ProviderOptions) (MailProvider, *auth.Token, error) {
+	token, err := m.token(ctx, userJWT, userID, authProvider)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get token: %w", err)
+	}
+
+	mailProvider, err := m.newProvider(context.Background(), token, userID, provider, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create provider: %w", err)
+	}
+	if mailProvider == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, provider)
+	}
+	return mailProvider, token, nil
+}
+
+// token fetches a user's provider token with their JWT, or with a service
+// token when there is none
+func (m *Manager) token(ctx context.Context, userJWT, userID string, provider auth.Provider) (*auth.Token, error) {
+	if provider == "" {
+		return &auth.Token{}, nil // the provider needs no OAuth token
+	}
+	if userJWT != "" {
+		return m.authClient.GetToken(ctx, userJWT, provider)
+	}
+	return m.serviceToken(ctx, userID, provider)
+}
+
+// refreshToken fetches a replacement token for a running sync. The user JWT
+// that started the sync may have expired by then, so the service token is
+// preferred when configured.
+func (m *Manager) refreshToken(ctx context.Context, userJWT, userID string, provider auth.Provider) (*auth.Token, error) {
+	if provider != "" && m.serviceTokens != nil {
+		return m.serviceToken(ctx, userID, provider)
+	}
+	return m.token(ctx, userJWT, userID, provider)
+}
+
+// serviceToken fetches a user's provider token on behalf of the API itself
+func (m *Manager) serviceToken(ctx context.Context, userID string, provider auth.Provider) (*auth.Token, error) {
+	if m.serviceTokens == nil {
+		return nil, fmt.Errorf("no user token and service tokens are not configured")
+	}
+
+	svcToken, err := m.serviceTokens.Issue("sync-manager", []string{auth.ScopeTokensRead}, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	return m.authClient.GetTokenForUser(ctx, svcToken, userID, provider)
+}
+
 // IsRunning checks if sync is running for a user inbox
 func (m *Manager) IsRunning(userID, inboxID string, provider ProviderName) bool {
 	key := fmt.Sprintf("%s:%s:%s", userID, inboxID, provider)
@@ -138,22 +851,53 @@ func (m *Manager) StopAll() {
 	m.runnersMutex.Lock()
 	defer m.runnersMutex.Unlock()
 
-	for key, cancel := range m.runners {
+	for key, handle := range m.runners {
 		log.Printf("Stopping sync for %s", key)
-		cancel()
+		handle.cancel()
 	}
+	m.stopRunners()
 
-	m.runners = make(map[string]context.CancelFunc)
+	m.runners = make(map[string]*runnerHandle)
+	m.runnersCtx, m.stopRunners = context.WithCancel(context.Background())
 }
 
-// GetRunningSyncs returns list of currently running syncs
-func (m *Manager) GetRunningSyncs() []string {
+// GetRunningSyncs returns the syncs running in this process by user, inbox
+// and provider. A non-empty userID returns only that user's.
+func (m *Manager) GetRunningSyncs(userID string) []RunningSync {
 	m.runnersMutex.RLock()
-	defer m.runnersMutex.RUnlock()
-
-	var syncs []string
-	for key := range m.runners {
-		syncs = append(syncs, key)
+	syncs := []RunningSync{}
+	for _, h := range m.runners {
+		if userID != "" && h.userID != userID {
+			continue
+		}
+		syncs = append(syncs, RunningSync{
+			UserID:    h.userID,
+			InboxID:   h.inboxID,
+			Provider:  h.provider,
+			StartedAt: h.startedAt.Unix(),
+			Phase:     h.runner.Phase(),
+		})
 	}
+	m.runnersMutex.RUnlock()
+
+	sort.Slice(syncs, func(i, j int) bool {
+		a, b := syncs[i], syncs[j]
+		if a.UserID != b.UserID {
+			return a.UserID < b.UserID
+		}
+		if a.InboxID != b.InboxID {
+			return a.InboxID < b.InboxID
+		}
+		return a.Provider < b.Provider
+	})
 	return syncs
 }
+
+// authProviderFor maps a sync provider to its BetterAuth provider id
+func authProviderFor(provider ProviderName) (auth.Provider, error) {
+	info, ok := LookupProvider(provider)
+	if !ok {
+		return "", ErrUnsupportedProvider
+	}
+	return info.AuthProvider, nil
+}
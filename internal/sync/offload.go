@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+)
+
+// maxInlinePayload is the largest event payload published as-is. Bigger
+// payloads (huge header sets, long recipient lists) are offloaded to blob
+// storage when it's configured; NATS rejects messages over 1 MiB by default.
+const maxInlinePayload = 256 << 10
+
+// offloadedFields are copied from the event into the reference payload so
+// consumers can route and deduplicate without fetching the blob
+var offloadedFields = []string{"event_id", "ts", "provider", "inbox_id", "user_id", "provider_message_id", "provider_thread_id"}
+
+// offloadPayload stores payload under users/{user_id}/payloads/{event_id}.json
+// and returns the reference payload to publish instead
+func (r *Runner) offloadPayload(ctx context.Context, userID, eventID string, event map[string]interface{}, payload []byte) ([]byte, error) {
+	key, err := blob.UserKey(userID, "payloads", eventID+".json")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Blobs.Put(ctx, key, bytes.NewReader(payload), int64(len(payload)), "application/json"); err != nil {
+		return nil, fmt.Errorf("failed to offload payload: %w", err)
+	}
+
+	ref := make(map[string]interface{}, len(offloadedFields)+2)
+	for _, f := range offloadedFields {
+		ref[f] = event[f]
+	}
+	ref["payload_ref"] = key
+	ref["payload_size"] = len(payload)
+	return json.Marshal(ref)
+}
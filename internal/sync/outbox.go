@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// DispatchOutbox publishes userID's queued outbox entries in the background,
+// for events queued outside a sync (e.g. posted through /events). Runners
+// already drain their user's outbox, so it does nothing while one runs in
+// this process, or while an earlier drain for the user is still going.
+func (m *Manager) DispatchOutbox(userID string) {
+	if m.publisher == nil {
+		return
+	}
+
+	m.runnersMutex.RLock()
+	for key := range m.runners {
+		if strings.HasPrefix(key, userID+":") {
+			m.runnersMutex.RUnlock()
+			return
+		}
+	}
+	ctx := m.runnersCtx
+	m.runnersMutex.RUnlock()
+
+	if _, busy := m.draining.LoadOrStore(userID, true); busy {
+		return
+	}
+	go func() {
+		defer m.draining.Delete(userID)
+		if err := m.drainOutbox(ctx, userID); err != nil {
+			log.Printf("Error dispatching outbox for user %s: %v", userID, err)
+		}
+	}()
+}
+
+// drainOutbox publishes batches until nothing is ready. Entries that fail
+// are left for retry by the user's next drain or runner.
+func (m *Manager) drainOutbox(ctx context.Context, userID string) error {
+	store, err := m.stores.Open(userID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := m.publisher.EnsureStream(ctx); err != nil {
+		return err
+	}
+	dispatcher := &Runner{Publisher: m.publisher, turns: m.turns}
+	for {
+		n, err := dispatcher.dispatchOnce(ctx, store)
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// PayloadFields are the fields of an email.received event payload (see
+// MAIL_SYNC.md "Event Format")
+var PayloadFields = []string{
+	"event_id", "ts", "msg_date", "provider", "inbox_id", "user_id",
+	"provider_message_id", "provider_thread_id", "subject", "sender",
+	"to_addrs", "cc_addrs", "bcc_addrs", "snippet", "headers", "labels",
+	"folder", "is_read", "is_flagged", "kind", "is_list", "importance",
+	"language", "attachments", "list",
+}
+
+// PayloadPolicy selects the fields of mail events (email.received and its
+// auto-reply and bounce variants, email.sent) published to NATS. It doesn't
+// change what is stored locally. Fields consumers route and deduplicate by
+// (offloadedFields) are always published.
+type PayloadPolicy struct {
+	drop map[string]bool
+}
+
+// NewPayloadPolicy publishes the include fields (every field when empty)
+// except the exclude ones. Unknown fields, and excluding an always published
+// one, are errors.
+func NewPayloadPolicy(include, exclude []string) (*PayloadPolicy, error) {
+	for _, f := range slices.Concat(include, exclude) {
+		if !slices.Contains(PayloadFields, f) {
+			return nil, fmt.Errorf("unknown payload field %q", f)
+		}
+	}
+	for _, f := range exclude {
+		if slices.Contains(offloadedFields, f) {
+			return nil, fmt.Errorf("payload field %q is always published", f)
+		}
+	}
+
+	p := &PayloadPolicy{drop: make(map[string]bool)}
+	for _, f := range PayloadFields {
+		switch {
+		case slices.Contains(offloadedFields, f):
+		case slices.Contains(exclude, f), len(include) > 0 && !slices.Contains(include, f):
+			p.drop[f] = true
+		}
+	}
+	return p, nil
+}
+
+// ParsePayloadPolicy builds a policy from comma-separated include and exclude
+// lists (e.g. the EVENT_PAYLOAD_FIELDS and EVENT_PAYLOAD_EXCLUDE env vars)
+func ParsePayloadPolicy(include, exclude string) (*PayloadPolicy, error) {
+	return NewPayloadPolicy(splitFields(include), splitFields(exclude))
+}
+
+func splitFields(spec string) []string {
+	var fields []string
+	for _, f := range strings.Split(spec, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Dropped returns the fields left out of published payloads, in payload order
+func (p *PayloadPolicy) Dropped() []string {
+	if p == nil {
+		return nil
+	}
+	var fields []string
+	for _, f := range PayloadFields {
+		if p.drop[f] {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// apply removes the dropped fields from event. A nil policy keeps them all.
+func (p *PayloadPolicy) apply(event map[string]interface{}) {
+	if p == nil {
+		return
+	}
+	for f := range p.drop {
+		delete(event, f)
+	}
+}
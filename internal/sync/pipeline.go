@@ -0,0 +1,112 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StageFunc transforms a message in place before it is stored and published.
+// Returning keep=false drops the message; an error fails its processing.
+type StageFunc func(ctx context.Context, meta *MessageMeta) (keep bool, err error)
+
+// Stage is a named pipeline step
+type Stage struct {
+	Name  string
+	Apply StageFunc
+}
+
+var (
+	stageRegistry = map[string]StageFunc{}
+	stageMu       sync.RWMutex
+)
+
+// RegisterStage makes a stage available to NewPipeline by name. Registering
+// the same name twice replaces the earlier stage.
+func RegisterStage(name string, fn StageFunc) {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	stageRegistry[name] = fn
+}
+
+// RegisteredStages lists the names of all registered stages
+func RegisteredStages() []string {
+	stageMu.RLock()
+	defer stageMu.RUnlock()
+
+	names := make([]string, 0, len(stageRegistry))
+	for name := range stageRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultStages run when no pipeline is configured
+var DefaultStages = []string{"classify", "mailing_list", "language", "signature"}
+
+// Pipeline applies stages in order to every received message
+type Pipeline struct {
+	stages []Stage
+}
+
+// NewPipeline builds a pipeline from registered stage names
+func NewPipeline(names []string) (*Pipeline, error) {
+	stageMu.RLock()
+	defer stageMu.RUnlock()
+
+	p := &Pipeline{}
+	for _, name := range names {
+		fn, ok := stageRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pipeline stage %q", name)
+		}
+		p.stages = append(p.stages, Stage{Name: name, Apply: fn})
+	}
+	return p, nil
+}
+
+// ParsePipeline builds a pipeline from a comma-separated stage list (e.g. the
+// EVENT_PIPELINE env var). An empty spec yields DefaultStages.
+func ParsePipeline(spec string) (*Pipeline, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = DefaultStages
+	}
+	return NewPipeline(names)
+}
+
+// Stages returns the stage names in order
+func (p *Pipeline) Stages() []string {
+	names := make([]string, 0, len(p.stages))
+	for _, s := range p.stages {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// Run applies every stage to meta, stopping early when a stage drops it
+func (p *Pipeline) Run(ctx context.Context, meta *MessageMeta) (bool, error) {
+	for _, s := range p.stages {
+		keep, err := s.Apply(ctx, meta)
+		if err != nil {
+			return false, fmt.Errorf("pipeline stage %s: %w", s.Name, err)
+		}
+		if !keep {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// defaultPipeline is used by runners created without an explicit pipeline.
+// It is built by the init that registers the built-in stages, since package
+// variables are initialized before any init runs.
+var defaultPipeline *Pipeline
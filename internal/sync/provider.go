@@ -2,7 +2,11 @@ package sync
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/signature"
 )
 
 // ProviderName represents email provider types
@@ -11,6 +15,20 @@ type ProviderName string
 const (
 	ProviderGoogle    ProviderName = "GOOGLE"
 	ProviderMicrosoft ProviderName = "MICROSOFT"
+	ProviderImport    ProviderName = "IMPORT" // mbox/EML archives uploaded by the user
+)
+
+// Folder is the canonical folder taxonomy shared across providers, so downstream
+// consumers don't need to know Gmail label ids or Outlook folder ids
+type Folder string
+
+const (
+	FolderInbox   Folder = "inbox"
+	FolderSent    Folder = "sent"
+	FolderArchive Folder = "archive"
+	FolderSpam    Folder = "spam"
+	FolderTrash   Folder = "trash"
+	FolderCustom  Folder = "custom"
 )
 
 // MessageMeta represents normalized email metadata across providers
@@ -26,18 +44,70 @@ type MessageMeta struct {
 	Cc               []string
 	Bcc              []string
 	Snippet          string
+	Body             string // plain-text body when the provider supplies it (archive import); not stored
+	Attachments      []Attachment // attachments when the provider supplies them (archive import)
+	CalendarParts    [][]byte     // inline text/calendar parts (invites) when the provider supplies them
 	ProviderLabels   []string
+	Folder           Folder // canonical folder derived from labels/parent folder
+	IsRead           bool
+	IsFlagged        bool   // Gmail: STARRED; Outlook: flagged for follow-up
+	Kind             MessageKind
+	List             *MailingList // set for mailing lists and newsletters
 	Headers          map[string]string
 	MessageDate      time.Time
+	Language         string // ISO 639-1 code set by the language stage, "" if unknown
+	Signature        *signature.Signature // sender details set by the signature stage
 }
 
 // Checkpoint represents sync state for a provider
 type Checkpoint struct {
-	// Gmail: LastHistoryID; Outlook: DeltaLink (cursor)
+	// Gmail: LastHistoryID; Outlook: time of last delta round
 	Cursor string
+
+	// FolderCursors holds per-folder cursors (Outlook delta links) keyed by
+	// provider folder id. Folder-aware providers sync exactly these folders;
+	// an empty cursor means the folder has not been synced yet.
+	FolderCursors map[string]string
 }
 
-// MailProvider interface for provider-agnostic mail sync
+// MailFolder is a folder in the user's provider folder tree
+type MailFolder struct {
+	ID       string
+	ParentID string
+	Name     string
+	Folder   Folder // canonical mapping
+	Selected bool   // default selection for newly discovered folders
+}
+
+// ChangeType identifies a state change to an already-synced message
+type ChangeType string
+
+const (
+	ChangeLabelsAdded   ChangeType = "labels_added"
+	ChangeLabelsRemoved ChangeType = "labels_removed"
+	ChangeDeleted       ChangeType = "deleted"
+	ChangeMoved         ChangeType = "moved" // Outlook: moving a message changes its id
+	ChangeState         ChangeType = "state" // read/flag state only, no label change
+)
+
+// MessageChange describes a change to a message that was already ingested
+type MessageChange struct {
+	Provider      ProviderName
+	MessageID     string
+	ThreadID      string
+	ChangeID      string // provider change id (Gmail: history id), used for idempotency
+	Type          ChangeType
+	Labels        []string // labels added or removed
+	CurrentLabels []string // full label set after the change (nil if unknown)
+	Folder        Folder   // canonical folder after the change ("" if unknown)
+	IsRead        *bool    // read state after the change (nil if unknown)
+	IsFlagged     *bool    // flag state after the change (nil if unknown)
+	NewMessageID  string   // provider id after a move (ChangeMoved)
+}
+
+// MailProvider interface for provider-agnostic mail sync. Implementations
+// must be safe for concurrent use: the manager shares an adapter between an
+// account's syncs and one-off calls.
 type MailProvider interface {
 	// InitialBackfill performs full import or deep backfill window
 	InitialBackfill(ctx context.Context, user string, cp *Checkpoint, fn func(MessageMeta) error) (*Checkpoint, error)
@@ -45,3 +115,114 @@ type MailProvider interface {
 	// IncrementalSync performs incremental sync from a checkpoint
 	IncrementalSync(ctx context.Context, user string, cp Checkpoint, fn func(MessageMeta) error) (*Checkpoint, error)
 }
+
+// ChangeSyncer is implemented by providers whose incremental sync also reports
+// changes to already-synced messages (label changes, deletions)
+type ChangeSyncer interface {
+	IncrementalSyncChanges(ctx context.Context, user string, cp Checkpoint, fn func(MessageMeta) error, onChange func(MessageChange) error) (*Checkpoint, error)
+}
+
+// FolderSyncer is implemented by providers that sync each folder independently
+// (Outlook delta queries are per folder)
+type FolderSyncer interface {
+	ListFolders(ctx context.Context, user string) ([]MailFolder, error)
+}
+
+// HealthChecker is implemented by providers that can verify their credentials
+// with a cheap authenticated call (Gmail getProfile, Graph /me)
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// FreshnessChecker is implemented by providers that can cheaply report the
+// date of the newest inbox message, used to measure sync lag
+type FreshnessChecker interface {
+	// NewestInboxMessage returns the newest inbox message date, or the zero
+	// time if the inbox is empty
+	NewestInboxMessage(ctx context.Context, user string) (time.Time, error)
+}
+
+// OutgoingMessage is a message to send through the user's provider
+type OutgoingMessage struct {
+	To      []string `json:"to,omitempty"`
+	Cc      []string `json:"cc,omitempty"`
+	Bcc     []string `json:"bcc,omitempty"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body"`
+	HTML    bool     `json:"html,omitempty"` // Body is HTML rather than plain text
+
+	// Reply linkage. ReplyToMessageID is the provider id of the message being
+	// answered; ThreadID and the RFC 5322 headers are filled from the local store.
+	ReplyToMessageID string `json:"reply_to_message_id,omitempty"`
+	ThreadID         string `json:"thread_id,omitempty"`
+	InReplyTo        string `json:"in_reply_to,omitempty"` // parent Message-ID header
+	References       string `json:"references,omitempty"`  // parent References plus its Message-ID
+}
+
+// SentMessage identifies a sent message at the provider. Graph's sendMail
+// doesn't return ids, so fields may be empty.
+type SentMessage struct {
+	MessageID string `json:"provider_message_id,omitempty"`
+	ThreadID  string `json:"provider_thread_id,omitempty"`
+}
+
+// Sender is implemented by providers that can send mail (Gmail messages.send,
+// Graph sendMail)
+type Sender interface {
+	SendMessage(ctx context.Context, msg OutgoingMessage) (*SentMessage, error)
+}
+
+// ActionType is a write-back operation on a single message
+type ActionType string
+
+const (
+	ActionRead         ActionType = "read"
+	ActionUnread       ActionType = "unread"
+	ActionArchive      ActionType = "archive"
+	ActionAddLabels    ActionType = "add_labels"
+	ActionRemoveLabels ActionType = "remove_labels"
+	ActionMove         ActionType = "move"
+)
+
+// MessageAction is an operation to execute against the provider
+type MessageAction struct {
+	Type   ActionType
+	Labels []string // add_labels/remove_labels: Gmail label ids, Outlook categories
+
+	// Destination for move: a canonical folder (inbox, archive, spam, trash) or a
+	// provider folder id / Gmail label id
+	Destination string
+}
+
+// Validate checks that the action has the arguments it needs
+func (a MessageAction) Validate() error {
+	switch a.Type {
+	case ActionRead, ActionUnread, ActionArchive:
+		return nil
+	case ActionAddLabels, ActionRemoveLabels:
+		if len(a.Labels) == 0 {
+			return fmt.Errorf("%s requires labels", a.Type)
+		}
+		return nil
+	case ActionMove:
+		if a.Destination == "" {
+			return fmt.Errorf("move requires a destination")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown action: %s", a.Type)
+	}
+}
+
+// MessageActor is implemented by providers that can modify messages. The
+// returned change describes the message state afterwards so it can be applied
+// locally exactly like a synced change.
+type MessageActor interface {
+	ApplyAction(ctx context.Context, messageID string, action MessageAction) (*MessageChange, error)
+}
+
+// Errors returned by HealthChecker implementations to classify token problems
+var (
+	ErrTokenExpired  = errors.New("token expired or revoked")
+	ErrMissingScopes = errors.New("token missing required scopes")
+)
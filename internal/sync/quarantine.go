@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// maxEventPayload is the largest event the dispatcher can publish: NATS
+// rejects messages over its max_payload, 1 MiB by default
+const maxEventPayload = 1 << 20
+
+// maxMessageIDLength bounds provider message ids, which end up in NATS
+// message ids and outbox keys
+const maxMessageIDLength = 512
+
+// requeueBatch is how many requeued messages a sync cycle ingests
+const requeueBatch = 50
+
+// quarantined counts messages held back, by reason
+var quarantined metric.Int64Counter
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/sync")
+
+	var err error
+	if quarantined, err = meter.Int64Counter("sync.quarantined",
+		metric.WithDescription("Received messages held back in quarantine instead of being ingested"),
+		metric.WithUnit("{message}")); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// validateMessage is the schema check a message passes after the pipeline,
+// before its event is built
+func validateMessage(meta *MessageMeta) error {
+	switch {
+	case meta.MessageID == "":
+		return errors.New("missing provider message id")
+	case len(meta.MessageID) > maxMessageIDLength:
+		return fmt.Errorf("provider message id longer than %d bytes", maxMessageIDLength)
+	case !utf8.ValidString(meta.MessageID):
+		return errors.New("provider message id is not valid UTF-8")
+	}
+	switch meta.Kind {
+	case "", KindMessage, KindAutoReply, KindBounce:
+	default:
+		return fmt.Errorf("unknown message kind %q", meta.Kind)
+	}
+	switch meta.Folder {
+	case "", FolderInbox, FolderSent, FolderArchive, FolderSpam, FolderTrash, FolderCustom:
+	default:
+		return fmt.Errorf("unknown folder %q", meta.Folder)
+	}
+	return nil
+}
+
+// quarantine holds a message back for review instead of failing the sync
+// cycle on it or dropping it. received is the message as the provider
+// returned it, before the pipeline. Cancellation and busy stores aren't the
+// message's fault, so those errors are returned to retry the cycle.
+func (r *Runner) quarantine(ctx context.Context, store eventstore.Store, inboxID string, received *MessageMeta, reason string, cause error) error {
+	if ctx.Err() != nil || errors.Is(cause, eventstore.ErrBusy) {
+		return cause
+	}
+
+	// Attachment content can be fetched again; keep the message small
+	kept := *received
+	if len(kept.Attachments) > 0 {
+		kept.Attachments = make([]Attachment, len(received.Attachments))
+		for i, a := range received.Attachments {
+			a.Data = nil
+			kept.Attachments[i] = a
+		}
+	}
+	message, err := json.Marshal(kept)
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantined message: %w", err)
+	}
+
+	err = store.QuarantineMessage(ctx, &eventstore.QuarantinedMessage{
+		Provider:          string(r.ProviderName),
+		InboxID:           inboxID,
+		ProviderMessageID: received.MessageID,
+		Reason:            reason,
+		Detail:            cause.Error(),
+		Message:           message,
+	})
+	if err != nil {
+		return err
+	}
+	quarantined.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("provider", string(r.ProviderName)),
+		attribute.String("reason", reason)))
+	r.Debug.event(ctx, "quarantined:"+reason, received.MessageID)
+	log.Printf("Quarantined message %s for user %s (%s): %v", received.MessageID, store.UserID(), reason, cause)
+	return nil
+}
+
+// ingestRequeued feeds messages an admin requeued from quarantine back
+// through proc. Messages failing again are quarantined again by proc; errors
+// that fail the whole message (a busy store) leave it requeued.
+func (r *Runner) ingestRequeued(ctx context.Context, store eventstore.Store, inboxID string, proc func(MessageMeta) error) {
+	requeued, err := store.RequeuedMessages(ctx, string(r.ProviderName), requeueBatch)
+	if err != nil {
+		log.Printf("Error loading requeued messages for user %s: %v", store.UserID(), err)
+		return
+	}
+
+	for _, q := range requeued {
+		if q.InboxID != "" && q.InboxID != inboxID {
+			continue
+		}
+		var meta MessageMeta
+		if err := json.Unmarshal(q.Message, &meta); err != nil {
+			log.Printf("Error decoding requeued message %d for user %s: %v", q.ID, store.UserID(), err)
+			continue
+		}
+
+		// Released first: proc quarantines it again (pending) if it still fails
+		if _, err := store.SetQuarantineStatus(ctx, q.ID, eventstore.QuarantineReleased, eventstore.QuarantineRequeued); err != nil {
+			log.Printf("Error releasing requeued message %d for user %s: %v", q.ID, store.UserID(), err)
+			return
+		}
+		if err := proc(meta); err != nil {
+			log.Printf("Error ingesting requeued message %d for user %s: %v", q.ID, store.UserID(), err)
+			if _, err := store.SetQuarantineStatus(ctx, q.ID, eventstore.QuarantineRequeued, eventstore.QuarantineReleased); err != nil {
+				log.Printf("Error requeueing message %d for user %s: %v", q.ID, store.UserID(), err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
+)
+
+// Capability is an optional feature of a provider adapter
+type Capability string
+
+const (
+	CapChanges   Capability = "changes"   // ChangeSyncer: read/label/delete changes
+	CapFolders   Capability = "folders"   // FolderSyncer: per-folder sync
+	CapHealth    Capability = "health"    // HealthChecker
+	CapFreshness Capability = "freshness" // FreshnessChecker
+	CapSend      Capability = "send"      // Sender
+	CapActions   Capability = "actions"   // MessageActor
+)
+
+// ProviderInfo describes a provider adapter. Adapters register themselves
+// from init, so adding one (or leaving one out with a build tag) doesn't
+// touch the manager or the API.
+type ProviderInfo struct {
+	Name         ProviderName
+	Aliases      []string      // other names accepted by the API, e.g. "google"
+	AuthProvider auth.Provider // BetterAuth provider id its tokens come from; "" if it needs none
+	Capabilities []Capability
+	RateLimits   ratelimit.Limits // defaults; RATE_LIMIT_<NAME> overrides
+	New          func(ctx context.Context, token *auth.Token, opts ProviderOptions) (MailProvider, error)
+
+	// ScopeNeeds lists the OAuth scopes a sync with opts and the access a
+	// client asked for need, and GrantedScopes looks up the scopes a token
+	// was granted (nil when it can't tell). Connecting an inbox is refused
+	// when a need isn't met; without them scopes aren't checked.
+	ScopeNeeds    func(opts ProviderOptions, access []Access) []ScopeNeed
+	GrantedScopes func(ctx context.Context, token *auth.Token) ([]string, error)
+}
+
+// Has reports whether the provider declares capability c
+func (p ProviderInfo) Has(c Capability) bool {
+	for _, have := range p.Capabilities {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[ProviderName]ProviderInfo)
+	aliases    = make(map[string]ProviderName)
+)
+
+// RegisterProvider adds a provider adapter. It panics if the name or an
+// alias is taken or the constructor is missing.
+func RegisterProvider(info ProviderInfo) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if info.Name == "" || info.New == nil {
+		panic("sync: RegisterProvider needs a name and a constructor")
+	}
+	names := append([]string{string(info.Name)}, info.Aliases...)
+	for _, name := range names {
+		if _, dup := aliases[name]; dup {
+			panic(fmt.Sprintf("sync: provider %q registered twice", name))
+		}
+	}
+	for _, name := range names {
+		aliases[name] = info.Name
+	}
+	registry[info.Name] = info
+}
+
+// LookupProvider returns the registered provider with name
+func LookupProvider(name ProviderName) (ProviderInfo, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	info, ok := registry[name]
+	return info, ok
+}
+
+// ParseProvider maps a provider name used in API requests ("google",
+// "GOOGLE") to a registered provider
+func ParseProvider(name string) (ProviderName, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if p, ok := aliases[name]; ok {
+		return p, true
+	}
+	p, ok := aliases[strings.ToUpper(name)]
+	return p, ok
+}
+
+// Providers returns the registered providers sorted by name
+func Providers() []ProviderInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	infos := make([]ProviderInfo, 0, len(registry))
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// RegisteredProviders is a ProviderFactory that creates adapters from the
+// registry
+func RegisteredProviders(ctx context.Context, token *auth.Token, _ string, provider ProviderName, opts ProviderOptions) (MailProvider, error) {
+	info, ok := LookupProvider(provider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, provider)
+	}
+	return info.New(ctx, token, opts)
+}
+
+// requireCapability fails fast, before a token is fetched, when a provider
+// doesn't declare c
+func requireCapability(provider ProviderName, c Capability, what string) error {
+	info, ok := LookupProvider(provider)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedProvider, provider)
+	}
+	if !info.Has(c) {
+		return fmt.Errorf("%s %w %s", what, ErrNotSupported, provider)
+	}
+	return nil
+}
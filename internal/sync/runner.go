@@ -3,44 +3,135 @@ package sync
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"path/filepath"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/Martian-dev/ai-brain-infra/internal/auth"
-	"github.com/Martian-dev/ai-brain-infra/internal/eventstore/sqlite"
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
 	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
 )
 
+// tracer records sync spans through the global OpenTelemetry TracerProvider
+var tracer = otel.Tracer("github.com/Martian-dev/ai-brain-infra/internal/sync")
+
 // Runner orchestrates mail sync for user inbox
 type Runner struct {
-	DataRoot     string
-	AuthClient   *auth.BetterAuthClient
-	UserJWT      string
-	Publisher    *natsjs.Publisher
-	Provider     MailProvider
-	ProviderName ProviderName
+	Stores         eventstore.Opener
+	AuthClient     *auth.BetterAuthClient
+	UserJWT        string
+	Publisher      *natsjs.Publisher
+	Provider       MailProvider
+	ProviderName   ProviderName
+	IncludeSpam    bool               // keep spam/junk folders selected for sync
+	Folders        []Folder           // optional, the only folders synced; see ProviderOptions
+	BackfillWindow time.Duration      // age limit of the initial backfill, for progress; 0 for all mail
+	PollInterval   time.Duration      // time between incremental syncs; 0 uses DefaultPollInterval
+	Pipeline       *Pipeline          // transforms applied before storage; nil uses DefaultStages
+	Payload        *PayloadPolicy     // optional, fields of published events; nil publishes all
+	Blobs          blob.Store         // optional, receives oversized event payloads and attachments
+	Attachments    *AttachmentPolicy  // optional, attachments kept for text extraction
+	Reporter       errreport.Reporter // optional, receives sync failures
+	LagSLO         time.Duration      // freshness SLO; 0 uses DefaultLagSLO
+	Debug          *DebugTrace        // optional, verbose logging while debug mode is on
+
+	wake        chan struct{}                // sync-now requests; nil if the runner takes none
+	senderRules atomic.Pointer[senderFilter] // the user's sender rules, reloaded every loop
+	phase       atomic.Value                 // the sync loop's current phase, see Phase
+	defaultPoll func() time.Duration         // optional, the interval when PollInterval is 0
+	backfills   *slots                       // optional, caps initial backfills running at once
+	turns       *dispatchTurns               // optional, shares publishing fairly with other users
+}
+
+// pollInterval returns the time between incremental syncs. It is read on
+// every tick, so a changed default applies to running syncs.
+func (r *Runner) pollInterval() time.Duration {
+	if r.PollInterval > 0 {
+		return r.PollInterval
+	}
+	if r.defaultPoll != nil {
+		return r.defaultPoll()
+	}
+	return DefaultPollInterval
+}
+
+// Phase returns what the runner is doing: one of PhaseStarting,
+// PhaseBackfill, PhaseIncremental, PhaseIdle or PhaseStopped
+func (r *Runner) Phase() string {
+	if p, ok := r.phase.Load().(string); ok {
+		return p
+	}
+	return PhaseStarting
+}
+
+// SyncNow requests an incremental sync without waiting for the next poll.
+// It doesn't block; a request made while one is pending is dropped.
+func (r *Runner) SyncNow() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// report sends a sync failure to the error reporter. Cancellation is part of
+// stopping a sync, not a failure.
+func (r *Runner) report(ctx context.Context, userID string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	errreport.Report(ctx, r.Reporter, errreport.Event{
+		Source:   errreport.SourceRunner,
+		Err:      err,
+		UserID:   userID,
+		Provider: string(r.ProviderName),
+	})
 }
 
 // RunInbox runs continuous sync for a user inbox
 func (r *Runner) RunInbox(ctx context.Context, userID, inboxID string) error {
-	dbPath := filepath.Join(r.DataRoot, userID, "events.db")
-	store, err := sqlite.OpenUserDB(dbPath)
+	store, err := r.Stores.Open(userID)
 	if err != nil {
 		return fmt.Errorf("failed to open user DB: %w", err)
 	}
 	defer store.Close()
 
-	// Ensure NATS stream exists
+	// Liveness record, rewritten on every loop
+	hb := newHeartbeat(ctx, store, r.ProviderName, inboxID)
+	hb.observe = func(p string) { r.phase.Store(p) }
+	r.phase.Store(PhaseStarting)
+	hb.beat()
+	defer hb.stop()
+
+	// Per-user debug mode, re-read on every loop
+	r.Debug.refresh(ctx, store)
+
+	// Ensure NATS stream exists. If NATS is down, sync anyway: events queue
+	// in the outbox and the dispatcher retries until NATS is back.
 	if err := r.Publisher.EnsureStream(ctx); err != nil {
-		return fmt.Errorf("failed to ensure NATS stream: %w", err)
+		log.Printf("NATS unavailable for user %s, queueing events in the outbox: %v", userID, err)
 	}
 
-	// Start outbox dispatcher in background
-	go r.dispatchLoop(ctx, store)
+	// Start outbox dispatcher in background. It stops with this run, failed
+	// or not, and has exited before the store is closed.
+	dctx, cancel := context.WithCancel(ctx)
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		r.superviseDispatch(dctx, store, userID)
+	}()
+	defer func() {
+		cancel()
+		<-dispatched
+	}()
 
 	// Load checkpoint
 	cursor, err := store.LoadCheckpoint(ctx, string(r.ProviderName))
@@ -48,43 +139,66 @@ func (r *Runner) RunInbox(ctx context.Context, userID, inboxID string) error {
 		log.Printf("Error loading checkpoint: %v", err)
 	}
 
+	// Refresh folder tree for folder-aware providers
+	lastFolderRefresh := time.Now()
+	if err := r.refreshFolders(ctx, store, cursor == ""); err != nil {
+		log.Printf("Error refreshing folders for user %s: %v", userID, err)
+	}
+
 	cp := Checkpoint{Cursor: cursor}
+	r.loadFolderCursors(ctx, store, &cp)
 
-	// Processor function for messages
-	proc := r.createProcessor(ctx, store, userID, inboxID)
+	// Processor functions for new messages and changes to existing ones
+	proc := hb.messages(r.Debug.messages(ctx, store, r.createProcessor(ctx, store, userID, inboxID)))
+	changeProc := hb.changes(r.createChangeProcessor(ctx, store, userID, inboxID))
 
 	// Perform initial or incremental sync
 	var newCP *Checkpoint
 	if cp.Cursor == "" {
+		release, err := r.backfills.acquire(ctx)
+		if err != nil {
+			return nil // stopped while waiting for a backfill slot
+		}
+		defer release() // on panic; released right after the backfill otherwise
+
 		log.Printf("Starting initial backfill for user %s", userID)
-		if err := store.SaveCheckpoint(ctx, string(r.ProviderName), inboxID, "", "SYNCING"); err != nil {
+		hb.backfill(r.BackfillWindow)
+		if err := r.saveCheckpoint(ctx, store, inboxID, "", "SYNCING"); err != nil {
 			log.Printf("Error saving checkpoint: %v", err)
 		}
 		newCP, err = r.Provider.InitialBackfill(ctx, "me", &cp, proc)
+		release()
 	} else {
 		log.Printf("Starting incremental sync for user %s from cursor %s", userID, cp.Cursor)
-		if err := store.SaveCheckpoint(ctx, string(r.ProviderName), inboxID, cp.Cursor, "SYNCING"); err != nil {
+		hb.phase(PhaseIncremental)
+		if err := r.saveCheckpoint(ctx, store, inboxID, cp.Cursor, "SYNCING"); err != nil {
 			log.Printf("Error saving checkpoint: %v", err)
 		}
-		newCP, err = r.Provider.IncrementalSync(ctx, "me", cp, proc)
+		newCP, err = r.incrementalSync(ctx, cp, proc, changeProc)
 	}
 
+	hb.cycleDone(err)
 	if err != nil {
-		_ = store.UpdateSyncStatus(ctx, string(r.ProviderName), "ERROR", err.Error())
+		err = r.markError(ctx, store, err)
 		return fmt.Errorf("sync failed: %w", err)
 	}
 
 	// Save new checkpoint
 	if newCP != nil {
-		if err := store.SaveCheckpoint(ctx, string(r.ProviderName), inboxID, newCP.Cursor, "HOOKED"); err != nil {
+		r.saveFolderCursors(ctx, store, newCP)
+		if err := r.saveCheckpoint(ctx, store, inboxID, newCP.Cursor, "HOOKED"); err != nil {
 			log.Printf("Error saving checkpoint: %v", err)
 		}
 	}
 
 	log.Printf("Initial sync complete for user %s", userID)
+	r.ingestRequeued(ctx, store, inboxID, proc)
+	r.checkLag(ctx, store, userID)
+	lastLagCheck := time.Now()
 
 	// Start continuous incremental sync loop
-	ticker := time.NewTicker(30 * time.Second)
+	interval := r.pollInterval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -93,40 +207,202 @@ func (r *Runner) RunInbox(ctx context.Context, userID, inboxID string) error {
 			log.Printf("Stopping sync for user %s", userID)
 			return nil
 		case <-ticker.C:
-			// Load current checkpoint
-			cursor, err := store.LoadCheckpoint(ctx, string(r.ProviderName))
-			if err != nil {
-				log.Printf("Error loading checkpoint: %v", err)
-				continue
-			}
+		case <-r.wake:
+			log.Printf("Sync requested for user %s", userID)
+			ticker.Reset(interval)
+		}
+		if next := r.pollInterval(); next != interval {
+			interval = next
+			ticker.Reset(interval)
+		}
 
-			cp := Checkpoint{Cursor: cursor}
-			if cp.Cursor == "" {
-				continue
-			}
+		hb.beat()
+		r.Debug.refresh(ctx, store)
+		r.refreshSenderRules(ctx, store)
 
-			// Incremental sync
-			newCP, err := r.Provider.IncrementalSync(ctx, "me", cp, proc)
-			if err != nil {
-				log.Printf("Incremental sync error for user %s: %v", userID, err)
-				_ = store.UpdateSyncStatus(ctx, string(r.ProviderName), "ERROR", err.Error())
-				continue
+		// Load current checkpoint
+		cursor, err := store.LoadCheckpoint(ctx, string(r.ProviderName))
+		if err != nil {
+			log.Printf("Error loading checkpoint: %v", err)
+			continue
+		}
+
+		cp := Checkpoint{Cursor: cursor}
+		if cp.Cursor == "" {
+			continue
+		}
+
+		if time.Since(lastFolderRefresh) > folderRefreshInterval {
+			lastFolderRefresh = time.Now()
+			if err := r.refreshFolders(ctx, store, false); err != nil {
+				log.Printf("Error refreshing folders for user %s: %v", userID, err)
 			}
+		}
+		r.loadFolderCursors(ctx, store, &cp)
 
-			// Save new checkpoint
-			if newCP != nil && newCP.Cursor != cp.Cursor {
-				if err := store.SaveCheckpoint(ctx, string(r.ProviderName), inboxID, newCP.Cursor, "HOOKED"); err != nil {
-					log.Printf("Error saving checkpoint: %v", err)
-				}
-				log.Printf("Synced new messages for user %s, new cursor: %s", userID, newCP.Cursor)
+		// Incremental sync
+		hb.phase(PhaseIncremental)
+		newCP, err := r.incrementalSync(ctx, cp, proc, changeProc)
+		hb.cycleDone(err)
+		if err != nil {
+			log.Printf("Incremental sync error for user %s: %v", userID, err)
+			r.report(ctx, userID, err)
+			_ = r.markError(ctx, store, err)
+			continue
+		}
+
+		// Save new checkpoint
+		if newCP != nil {
+			r.saveFolderCursors(ctx, store, newCP)
+		}
+		if newCP != nil && newCP.Cursor != cp.Cursor {
+			if err := r.saveCheckpoint(ctx, store, inboxID, newCP.Cursor, "HOOKED"); err != nil {
+				log.Printf("Error saving checkpoint: %v", err)
 			}
+			log.Printf("Synced new messages for user %s, new cursor: %s", userID, newCP.Cursor)
+		}
+
+		// Messages an admin requeued from quarantine
+		r.ingestRequeued(ctx, store, inboxID, proc)
+
+		if time.Since(lastLagCheck) > lagCheckInterval {
+			lastLagCheck = time.Now()
+			r.checkLag(ctx, store, userID)
+		}
+	}
+}
+
+// saveCheckpoint stores the sync cursor and status
+func (r *Runner) saveCheckpoint(ctx context.Context, store eventstore.Store, inboxID, cursor, status string) error {
+	err := store.SaveCheckpoint(ctx, string(r.ProviderName), inboxID, cursor, status)
+	r.Debug.checkpoint(fmt.Sprintf("cursor=%q status=%s", cursor, status), err)
+	return err
+}
+
+// folderRefreshInterval is how often the provider folder tree is re-read
+const folderRefreshInterval = 15 * time.Minute
+
+// refreshFolders syncs the provider folder tree into the store (folder-aware
+// providers only). Before the initial backfill the configured folders are
+// selected; later selections made through the folders API are kept.
+func (r *Runner) refreshFolders(ctx context.Context, store eventstore.Store, initial bool) error {
+	fs, ok := r.Provider.(FolderSyncer)
+	if !ok {
+		return nil
+	}
+
+	folders, err := fs.ListFolders(ctx, "me")
+	if err != nil {
+		return err
+	}
+
+	rows := make([]eventstore.MailFolder, 0, len(folders))
+	for _, f := range folders {
+		rows = append(rows, eventstore.MailFolder{
+			ID:          f.ID,
+			ParentID:    f.ParentID,
+			DisplayName: f.Name,
+			Folder:      string(f.Folder),
+			Selected:    f.Selected,
+		})
+	}
+
+	if err := store.UpsertFolders(ctx, string(r.ProviderName), rows); err != nil {
+		return err
+	}
+
+	if initial && len(r.Folders) > 0 {
+		selected := make([]string, 0, len(r.Folders)+1)
+		for _, f := range r.Folders {
+			selected = append(selected, string(f))
 		}
+		if r.IncludeSpam {
+			selected = append(selected, string(FolderSpam))
+		}
+		return store.SelectFolders(ctx, string(r.ProviderName), selected)
+	}
+	if r.IncludeSpam {
+		return store.SelectFoldersByCategory(ctx, string(r.ProviderName), string(FolderSpam))
+	}
+	return nil
+}
+
+// loadFolderCursors fills cp with the stored delta links of selected folders
+func (r *Runner) loadFolderCursors(ctx context.Context, store eventstore.Store, cp *Checkpoint) {
+	if _, ok := r.Provider.(FolderSyncer); !ok {
+		return
+	}
+
+	cursors, err := store.LoadFolderCursors(ctx, string(r.ProviderName))
+	if err != nil {
+		log.Printf("Error loading folder cursors: %v", err)
+		return
+	}
+	cp.FolderCursors = cursors
+}
+
+// saveFolderCursors persists per-folder cursors returned by the provider
+func (r *Runner) saveFolderCursors(ctx context.Context, store eventstore.Store, cp *Checkpoint) {
+	if len(cp.FolderCursors) == 0 {
+		return
+	}
+	err := store.SaveFolderCursors(ctx, string(r.ProviderName), cp.FolderCursors)
+	r.Debug.checkpoint(fmt.Sprintf("folder_cursors=%d", len(cp.FolderCursors)), err)
+	if err != nil {
+		log.Printf("Error saving folder cursors: %v", err)
 	}
 }
 
 // createProcessor creates a message processor function
-func (r *Runner) createProcessor(ctx context.Context, store *sqlite.Store, userID, inboxID string) func(MessageMeta) error {
+func (r *Runner) createProcessor(ctx context.Context, store eventstore.Store, userID, inboxID string) func(MessageMeta) error {
+	pipeline := r.Pipeline
+	if pipeline == nil {
+		pipeline = defaultPipeline
+	}
+	r.refreshSenderRules(ctx, store)
+
+	// Providers without a folder tree list every folder; skip the rest here
+	var only map[Folder]bool
+	if _, ok := r.Provider.(FolderSyncer); !ok && len(r.Folders) > 0 {
+		only = map[Folder]bool{}
+		for _, f := range r.Folders {
+			only[f] = true
+		}
+		if r.IncludeSpam {
+			only[FolderSpam] = true
+		}
+	}
+
 	return func(meta MessageMeta) error {
+		if only != nil && !only[meta.Folder] {
+			return nil
+		}
+
+		// Each message starts its own trace, continued by the dispatcher and consumers
+		ctx, span := tracer.Start(natsjs.EnsureTrace(ctx), "mail.ingest",
+			trace.WithAttributes(attribute.String("mail.provider", string(meta.Provider))))
+		defer span.End()
+		r.Debug.event(ctx, "ingest", meta.MessageID)
+
+		// Blocked senders never reach the store or NATS
+		if rule := r.senderRules.Load().blocked(&meta); rule != nil {
+			r.Debug.event(ctx, "blocked:"+rule.ID, meta.MessageID)
+			return nil
+		}
+
+		// Stages change meta in place; quarantine keeps the message as received
+		received := meta
+		keep, err := pipeline.Run(ctx, &meta)
+		if err != nil {
+			return r.quarantine(ctx, store, inboxID, &received, eventstore.QuarantineStage, err)
+		}
+		if !keep {
+			return nil
+		}
+		if err := validateMessage(&meta); err != nil {
+			return r.quarantine(ctx, store, inboxID, &received, eventstore.QuarantineValidation, err)
+		}
+
 		// Create event
 		eventID := uuid.NewString()
 		ts := time.Now().Unix()
@@ -157,94 +433,483 @@ func (r *Runner) createProcessor(ctx context.Context, store *sqlite.Store, userI
 			"snippet":             meta.Snippet,
 			"headers":             meta.Headers,
 			"labels":              meta.ProviderLabels,
+			"folder":              meta.Folder,
+			"is_read":             meta.IsRead,
+			"is_flagged":          meta.IsFlagged,
+			"kind":                meta.Kind,
+			"is_list":             meta.List != nil,
+		}
+		if meta.Folder != FolderSent {
+			// A failed lookup only costs the relationship signal
+			senderScore, err := store.LoadContactScore(ctx, meta.Sender)
+			if err != nil {
+				log.Printf("Error loading contact score for %s: %v", userID, err)
+			}
+			event["importance"] = Importance(&meta, senderScore)
+		}
+		if meta.Language != "" {
+			event["language"] = meta.Language
+		}
+		attachments, err := r.attachmentRecords(userID, eventID, &meta)
+		if err != nil {
+			return err
+		}
+		invites, err := inviteRecords(userID, inboxID, eventID, ts, &meta)
+		if err != nil {
+			return err
 		}
+		if len(attachments) > 0 {
+			list := make([]map[string]interface{}, len(attachments))
+			for i, a := range attachments {
+				list[i] = map[string]interface{}{
+					"id":           a.record.ID,
+					"filename":     a.record.Filename,
+					"content_type": a.record.ContentType,
+					"size":         a.record.Size,
+				}
+			}
+			event["attachments"] = list
+		}
+		if meta.List != nil {
+			event["list"] = map[string]string{
+				"id":          meta.List.ID,
+				"name":        meta.List.Name,
+				"unsubscribe": meta.List.Unsubscribe,
+			}
+		}
+
+		// Auto-replies and bounces get their own event types so consumers can skip them
+		eventType := meta.Kind.EventType()
 
+		// The store keeps every field; the deployment picks what is published
+		r.Payload.apply(event)
 		payload, _ := json.Marshal(event)
-		msgID := fmt.Sprintf("email.received|%s|%s", meta.Provider, meta.MessageID)
-		subject := fmt.Sprintf("user.%s.email.received", userID)
+		if len(payload) > maxInlinePayload && r.Blobs != nil {
+			ref, err := r.offloadPayload(ctx, userID, eventID, event, payload)
+			if err != nil {
+				return err
+			}
+			payload = ref
+		}
+		if len(payload) > maxEventPayload {
+			return r.quarantine(ctx, store, inboxID, &received, eventstore.QuarantineSize,
+				fmt.Errorf("event is %d bytes, over the %d byte limit (set a blob store to offload large events)", len(payload), maxEventPayload))
+		}
+		msgID := fmt.Sprintf("%s|%s|%s", eventType, meta.Provider, meta.MessageID)
+		subject := fmt.Sprintf("user.%s.%s", userID, eventType)
 
-		// Start transaction
-		tx, err := store.DB.BeginTx(ctx, nil)
-		if err != nil {
-			return fmt.Errorf("failed to begin transaction: %w", err)
-		}
-
-		// Append email event and outbox entry
-		err = store.AppendEmailReceivedTx(
-			ctx, tx,
-			eventID,
-			ts,
-			msgDate,
-			string(meta.Provider),
-			inboxID,
-			userID,
-			meta.MessageID,
-			meta.ThreadID,
-			meta.Subject,
-			meta.Sender,
-			string(toAddrsJSON),
-			string(ccAddrsJSON),
-			string(bccAddrsJSON),
-			meta.Snippet,
-			string(headersJSON),
-			string(labelsJSON),
-			subject,
-			"email.received",
-			payload,
-			msgID,
+		var list MailingList
+		if meta.List != nil {
+			list = *meta.List
+		}
+
+		// Append email event and outbox entry in one transaction
+		var (
+			stored   bool
+			storeErr error
 		)
+		err = store.WithTx(ctx, func(tx eventstore.Tx) error {
+			inserted, err := tx.AppendEmailReceived(ctx,
+				eventstore.EmailEvent{
+					EventID:           eventID,
+					TS:                ts,
+					MsgDate:           msgDate,
+					Provider:          string(meta.Provider),
+					InboxID:           inboxID,
+					UserID:            userID,
+					ProviderMessageID: meta.MessageID,
+					ProviderThreadID:  meta.ThreadID,
+					Subject:           meta.Subject,
+					Sender:            meta.Sender,
+					ToAddrs:           string(toAddrsJSON),
+					CcAddrs:           string(ccAddrsJSON),
+					BccAddrs:          string(bccAddrsJSON),
+					Snippet:           meta.Snippet,
+					HeadersJSON:       string(headersJSON),
+					LabelsJSON:        string(labelsJSON),
+					Folder:            string(meta.Folder),
+					IsRead:            meta.IsRead,
+					IsFlagged:         meta.IsFlagged,
+					Kind:              string(meta.Kind),
+					IsList:            meta.List != nil,
+					ListID:            list.ID,
+					ListName:          list.Name,
+					ListUnsubscribe:   list.Unsubscribe,
+					Language:          meta.Language,
+				},
+				eventstore.OutboxEntry{
+					Subject:     subject,
+					EventType:   eventType,
+					Payload:     payload,
+					MsgID:       msgID,
+					TraceParent: natsjs.TraceParent(ctx),
+				},
+			)
+			if err != nil {
+				// A busy database is retried by WithTx; other failures
+				// quarantine the message
+				if errors.Is(err, eventstore.ErrBusy) {
+					return err
+				}
+				storeErr = err
+				return errSkipMessage
+			}
 
-		if err != nil {
-			_ = tx.Rollback()
-			// Ignore duplicate errors (UNIQUE constraint violations)
+			// Already stored: providers re-deliver updated messages (Outlook delta),
+			// so pick up read/flag transitions instead
+			if !inserted {
+				return r.applyStateTx(ctx, tx, userID, inboxID, meta.Provider, meta.MessageID, meta.ThreadID, &meta.IsRead, &meta.IsFlagged)
+			}
+			stored = true
+			for _, a := range attachments {
+				if err := tx.AddAttachment(ctx, a.record); err != nil {
+					return err
+				}
+			}
+			if invites != nil {
+				if err := invites.save(ctx, tx); err != nil {
+					return err
+				}
+			}
+			if meta.Signature != nil {
+				return enrichContactTx(ctx, tx, userID, eventID, msgDate, &meta)
+			}
 			return nil
+		})
+		if errors.Is(err, errSkipMessage) {
+			return r.quarantine(ctx, store, inboxID, &received, eventstore.QuarantineStore, storeErr)
+		}
+		if err == nil && stored {
+			r.uploadAttachments(ctx, store, attachments)
 		}
+		return err
+	}
+}
 
-		// Commit transaction
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit transaction: %w", err)
+// enrichContactTx merges the sender's signature into their contact and
+// queues contact.enriched if any detail changed
+func enrichContactTx(ctx context.Context, tx eventstore.Tx, userID, eventID string, msgDate int64, meta *MessageMeta) error {
+	sig := meta.Signature
+	email := normalizeAddrs([]string{meta.Sender})[0]
+	changed, err := tx.EnrichContact(ctx, eventstore.ContactEnrichment{
+		Email:             email,
+		Title:             sig.Title,
+		Company:           sig.Company,
+		Phones:            sig.Phones,
+		Address:           sig.Address,
+		Website:           sig.Website,
+		EventID:           eventID,
+		Provider:          string(meta.Provider),
+		ProviderMessageID: meta.MessageID,
+		MsgDate:           msgDate,
+	})
+	if err != nil || len(changed) == 0 {
+		return err
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"user_id":   userID,
+		"ts":        time.Now().Unix(),
+		"email":     email,
+		"changed":   changed,
+		"signature": sig,
+		"source": map[string]interface{}{
+			"event_id":            eventID,
+			"provider":            string(meta.Provider),
+			"provider_message_id": meta.MessageID,
+			"msg_date":            msgDate,
+		},
+	})
+	const eventType = "contact.enriched"
+	return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+		Subject:     fmt.Sprintf("user.%s.%s", userID, eventType),
+		EventType:   eventType,
+		Payload:     payload,
+		MsgID:       fmt.Sprintf("%s|%s|%s", eventType, meta.Provider, meta.MessageID),
+		TraceParent: natsjs.TraceParent(ctx),
+	})
+}
+
+// errSkipMessage aborts the ingest transaction of a message that can't be
+// stored, which is then quarantined
+var errSkipMessage = errors.New("skip message")
+
+// incrementalSync runs an incremental sync, including message changes when the provider supports them
+func (r *Runner) incrementalSync(ctx context.Context, cp Checkpoint, proc func(MessageMeta) error, changeProc func(MessageChange) error) (*Checkpoint, error) {
+	if cs, ok := r.Provider.(ChangeSyncer); ok {
+		return cs.IncrementalSyncChanges(ctx, "me", cp, proc, changeProc)
+	}
+	return r.Provider.IncrementalSync(ctx, "me", cp, proc)
+}
+
+// createChangeProcessor creates a processor that applies changes to already-synced
+// messages locally and emits email.labels_changed / email.deleted / email.moved events
+func (r *Runner) createChangeProcessor(ctx context.Context, store eventstore.Store, userID, inboxID string) func(MessageChange) error {
+	return func(change MessageChange) error {
+		ctx, span := tracer.Start(natsjs.EnsureTrace(ctx), "mail.change",
+			trace.WithAttributes(attribute.String("mail.provider", string(change.Provider))))
+		defer span.End()
+		r.Debug.event(ctx, "change "+string(change.Type), change.MessageID)
+
+		provider := string(change.Provider)
+
+		// Work out the label state after the change if the provider didn't say
+		labels := change.CurrentLabels
+		if labels == nil && change.Type != ChangeDeleted && change.Type != ChangeMoved && change.Type != ChangeState {
+			stored, err := store.LoadMessageLabels(ctx, provider, change.MessageID)
+			if err != nil {
+				return err
+			}
+			if stored == "" {
+				return nil // not ingested locally
+			}
+			_ = json.Unmarshal([]byte(stored), &labels)
+			labels = applyLabelChange(labels, change)
 		}
 
-		return nil
+		eventID := uuid.NewString()
+		ts := time.Now().Unix()
+
+		var eventType string
+		event := map[string]interface{}{
+			"event_id":            eventID,
+			"ts":                  ts,
+			"provider":            provider,
+			"inbox_id":            inboxID,
+			"user_id":             userID,
+			"provider_message_id": change.MessageID,
+			"provider_thread_id":  change.ThreadID,
+		}
+
+		switch change.Type {
+		case ChangeDeleted:
+			eventType = "email.deleted"
+		case ChangeMoved:
+			eventType = "email.moved"
+			event["provider_message_id"] = change.NewMessageID
+			event["previous_provider_message_id"] = change.MessageID
+			event["folder"] = change.Folder
+		case ChangeState:
+			// read/flag transitions are emitted by applyStateTx
+		default:
+			eventType = "email.labels_changed"
+			event["change"] = change.Type
+			event["changed_labels"] = change.Labels
+			event["labels"] = labels
+			if change.Folder != "" {
+				event["folder"] = change.Folder
+			}
+		}
+
+		payload, _ := json.Marshal(event)
+
+		return store.WithTx(ctx, func(tx eventstore.Tx) error {
+			messageID := change.MessageID
+			known := true
+			var err error
+			switch change.Type {
+			case ChangeDeleted:
+				known, err = tx.MarkMessageDeleted(ctx, provider, change.MessageID, ts)
+			case ChangeMoved:
+				known, err = tx.MoveMessage(ctx, provider, change.MessageID, change.NewMessageID, string(change.Folder))
+				messageID = change.NewMessageID
+			case ChangeState:
+				// stored by applyStateTx, which ignores unknown messages
+			default:
+				labelsJSON, _ := json.Marshal(labels)
+				known, err = tx.UpdateMessageLabels(ctx, provider, change.MessageID, string(labelsJSON), string(change.Folder))
+			}
+			if err != nil {
+				return err
+			}
+			if !known {
+				return nil // not ingested locally (or already deleted) - nothing to emit
+			}
+
+			if change.IsRead != nil || change.IsFlagged != nil {
+				if err := r.applyStateTx(ctx, tx, userID, inboxID, change.Provider, messageID, change.ThreadID, change.IsRead, change.IsFlagged); err != nil {
+					return err
+				}
+			}
+
+			if eventType == "" {
+				return nil
+			}
+
+			return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+				Subject:     fmt.Sprintf("user.%s.%s", userID, eventType),
+				EventType:   eventType,
+				Payload:     payload,
+				MsgID:       fmt.Sprintf("%s|%s|%s|%s|%s", eventType, change.Provider, change.MessageID, change.Type, change.ChangeID),
+				TraceParent: natsjs.TraceParent(ctx),
+			})
+		})
+	}
+}
+
+// applyStateTx stores new read/flag state for a message and queues email.read,
+// email.unread and email.flagged events for each transition
+func (r *Runner) applyStateTx(ctx context.Context, tx eventstore.Tx, userID, inboxID string, provider ProviderName, messageID, threadID string, isRead, isFlagged *bool) error {
+	prev, known, err := tx.UpdateMessageState(ctx, string(provider), messageID, isRead, isFlagged)
+	if err != nil || !known {
+		return err
 	}
+
+	type transition struct {
+		eventType string
+		extra     map[string]interface{}
+	}
+
+	// Unknown previous state (rows stored before state tracking) is recorded without an event
+	var transitions []transition
+	if isRead != nil && prev.IsRead.Valid && prev.IsRead.Bool != *isRead {
+		eventType := "email.unread"
+		if *isRead {
+			eventType = "email.read"
+		}
+		transitions = append(transitions, transition{eventType: eventType})
+	}
+	if isFlagged != nil && prev.IsFlagged.Valid && prev.IsFlagged.Bool != *isFlagged {
+		transitions = append(transitions, transition{"email.flagged", map[string]interface{}{"flagged": *isFlagged}})
+	}
+
+	for _, t := range transitions {
+		eventID := uuid.NewString()
+		event := map[string]interface{}{
+			"event_id":            eventID,
+			"ts":                  time.Now().Unix(),
+			"provider":            string(provider),
+			"inbox_id":            inboxID,
+			"user_id":             userID,
+			"provider_message_id": messageID,
+			"provider_thread_id":  threadID,
+		}
+		for k, v := range t.extra {
+			event[k] = v
+		}
+
+		payload, _ := json.Marshal(event)
+		err := tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+			Subject:     fmt.Sprintf("user.%s.%s", userID, t.eventType),
+			EventType:   t.eventType,
+			Payload:     payload,
+			MsgID:       fmt.Sprintf("%s|%s|%s|%s", t.eventType, provider, messageID, eventID),
+			TraceParent: natsjs.TraceParent(ctx),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyLabelChange applies an added/removed label change to a label set
+func applyLabelChange(labels []string, change MessageChange) []string {
+	set := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		set[l] = true
+	}
+	for _, l := range change.Labels {
+		set[l] = change.Type == ChangeLabelsAdded
+	}
+
+	result := make([]string, 0, len(set))
+	for _, l := range labels {
+		if set[l] {
+			result = append(result, l)
+			delete(set, l)
+		}
+	}
+	for _, l := range change.Labels {
+		if set[l] {
+			result = append(result, l)
+			delete(set, l)
+		}
+	}
+	return result
 }
 
 // dispatchLoop continuously dispatches messages from outbox to NATS
-func (r *Runner) dispatchLoop(ctx context.Context, store *sqlite.Store) {
+func (r *Runner) dispatchLoop(ctx context.Context, store eventstore.Store) {
 	for {
+		var wait time.Duration
+		if err := r.Publisher.EnsureStream(ctx); err != nil {
+			wait = 5 * time.Second
+		} else if n, err := r.dispatchOnce(ctx, store); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error dequeuing outbox: %v", err)
+			}
+			wait = time.Second
+		} else if n == 0 {
+			wait = 500 * time.Millisecond
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		default:
+		case <-time.After(wait):
 		}
+	}
+}
 
-		// Dequeue outbox messages
-		messages, err := store.DequeueOutbox(ctx, 100)
-		if err != nil {
-			log.Printf("Error dequeuing outbox: %v", err)
-			time.Sleep(time.Second)
-			continue
+// superviseDispatch runs the dispatcher, restarting it after a panic so a
+// malformed outbox row can't stop publishing (or crash the process)
+func (r *Runner) superviseDispatch(ctx context.Context, store eventstore.Store, userID string) {
+	for {
+		err := errreport.Catch(func() error {
+			r.dispatchLoop(ctx, store)
+			return nil
+		})
+		if err == nil || ctx.Err() != nil {
+			return
 		}
 
-		if len(messages) == 0 {
-			time.Sleep(500 * time.Millisecond)
-			continue
+		log.Printf("Outbox dispatcher panic for user %s: %v", userID, err)
+		r.report(ctx, userID, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
 		}
+	}
+}
 
-		// Publish each message
-		for _, msg := range messages {
-			err := r.Publisher.Publish(msg.Subject, msg.Payload, msg.MsgID)
-			if err != nil {
-				log.Printf("Error publishing message %d: %v", msg.ID, err)
-				// Mark for retry with backoff
-				_ = store.MarkOutboxRetry(ctx, msg.ID, 10*time.Second)
-				continue
-			}
+// dispatchOnce publishes one batch of ready outbox messages and returns the
+// batch size (0 when the outbox has nothing ready)
+func (r *Runner) dispatchOnce(ctx context.Context, store eventstore.Store) (int, error) {
+	// Dequeue outbox messages
+	messages, err := store.DequeueOutbox(ctx, 100)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
 
-			// Mark as published
-			if err := store.MarkPublished(ctx, msg.ID); err != nil {
-				log.Printf("Error marking message %d as published: %v", msg.ID, err)
-			}
+	// Wait for this user's turn while other users' batches publish
+	release, err := r.turns.acquire(ctx, store.UserID(), messages[0].TS)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	// Publish each message
+	for _, msg := range messages {
+		pubCtx, span := tracer.Start(natsjs.WithTraceParent(ctx, msg.TraceParent), "outbox.publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attribute.String("messaging.destination.name", msg.Subject)))
+		ack, err := r.Publisher.PublishAck(pubCtx, msg.Subject, msg.Payload, msg.MsgID)
+		span.End()
+		if err != nil {
+			log.Printf("Error publishing message %d: %v", msg.ID, err)
+			// Mark for retry with backoff
+			_ = store.MarkOutboxRetry(ctx, msg.ID, 10*time.Second, err.Error())
+			continue
+		}
+
+		// Mark as published
+		if err := store.MarkPublished(ctx, msg.ID, ack.Stream, ack.Sequence); err != nil {
+			log.Printf("Error marking message %d as published: %v", msg.ID, err)
 		}
 	}
+
+	return len(messages), nil
 }
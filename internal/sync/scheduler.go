@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+)
+
+// Scheduled job kinds
+const (
+	JobSnooze    = "snooze"     // move an archived message back to the inbox
+	JobSendLater = "send_later" // send a composed message
+)
+
+const jobMaxAttempts = 5
+
+// SnoozePayload is the payload of a snooze job
+type SnoozePayload struct {
+	Provider  ProviderName `json:"provider"`
+	MessageID string       `json:"provider_message_id"`
+}
+
+// SendLaterPayload is the payload of a send_later job
+type SendLaterPayload struct {
+	Provider ProviderName    `json:"provider"`
+	Message  OutgoingMessage `json:"message"`
+}
+
+// Scheduler schedules deferred mail actions in the jobs store and executes
+// them through a jobs.Runner. Jobs run without a user request, so provider
+// tokens come from service tokens.
+type Scheduler struct {
+	manager *Manager
+	jobs    *jobs.Store
+}
+
+// NewScheduler creates a scheduler for manager
+func NewScheduler(manager *Manager, store *jobs.Store) *Scheduler {
+	return &Scheduler{manager: manager, jobs: store}
+}
+
+// Snooze archives a message now and schedules its return to the inbox at until
+func (s *Scheduler) Snooze(ctx context.Context, userJWT, userID string, provider ProviderName, messageID string, until time.Time) (*jobs.Job, error) {
+	change, err := s.manager.ApplyAction(ctx, userJWT, userID, provider, messageID, MessageAction{Type: ActionArchive})
+	if err != nil {
+		return nil, err
+	}
+
+	// Outlook assigns archived messages a new id
+	if change.NewMessageID != "" {
+		messageID = change.NewMessageID
+	}
+
+	return s.jobs.Enqueue(ctx, userID, JobSnooze, SnoozePayload{Provider: provider, MessageID: messageID}, until)
+}
+
+// SendLater schedules msg to be sent at sendAt
+func (s *Scheduler) SendLater(ctx context.Context, userID string, provider ProviderName, msg OutgoingMessage, sendAt time.Time) (*jobs.Job, error) {
+	return s.jobs.Enqueue(ctx, userID, JobSendLater, SendLaterPayload{Provider: provider, Message: msg}, sendAt)
+}
+
+// Pending lists a user's scheduled jobs
+func (s *Scheduler) Pending(ctx context.Context, userID string) ([]jobs.Job, error) {
+	return s.jobs.ListPending(ctx, userID)
+}
+
+// Cancel cancels a pending job
+func (s *Scheduler) Cancel(ctx context.Context, userID, jobID string) (bool, error) {
+	return s.jobs.Cancel(ctx, userID, jobID)
+}
+
+// Register adds the snooze and send-later kinds to runner
+func (s *Scheduler) Register(runner *jobs.Runner) {
+	for _, kind := range []string{JobSnooze, JobSendLater} {
+		runner.Register(kind, jobs.Kind{
+			Handler:     s.execute,
+			MaxAttempts: jobMaxAttempts,
+			OnFinish:    s.finished,
+		})
+	}
+}
+
+// finished publishes the outcome of a job that fired or gave up
+func (s *Scheduler) finished(ctx context.Context, job jobs.Job, err error) {
+	if err != nil {
+		s.publish(ctx, job, "failed", err)
+		return
+	}
+	s.publish(ctx, job, "fired", nil)
+}
+
+// execute runs a single job
+func (s *Scheduler) execute(ctx context.Context, job jobs.Job) error {
+	switch job.Kind {
+	case JobSnooze:
+		var p SnoozePayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return fmt.Errorf("decode payload: %w", err)
+		}
+		_, err := s.manager.ApplyAction(ctx, "", job.UserID, p.Provider, p.MessageID, MessageAction{
+			Type:        ActionMove,
+			Destination: string(FolderInbox),
+		})
+		return err
+
+	case JobSendLater:
+		var p SendLaterPayload
+		if err := json.Unmarshal(job.Payload, &p); err != nil {
+			return fmt.Errorf("decode payload: %w", err)
+		}
+		_, err := s.manager.SendMail(ctx, "", job.UserID, p.Provider, p.Message)
+		return err
+
+	default:
+		return fmt.Errorf("unknown job kind: %s", job.Kind)
+	}
+}
+
+// publish queues an email.scheduled_action event for a finished job
+func (s *Scheduler) publish(ctx context.Context, job jobs.Job, status string, jobErr error) {
+	store, err := s.manager.stores.Open(job.UserID)
+	if err != nil {
+		log.Printf("Error opening user DB for job %s: %v", job.ID, err)
+		return
+	}
+	defer store.Close()
+
+	event := map[string]interface{}{
+		"job_id":   job.ID,
+		"ts":       time.Now().Unix(),
+		"user_id":  job.UserID,
+		"kind":     job.Kind,
+		"status":   status,
+		"run_at":   job.RunAt.Unix(),
+		"payload":  job.Payload,
+		"attempts": job.Attempts,
+	}
+	if jobErr != nil {
+		event["error"] = jobErr.Error()
+	}
+
+	msgID := fmt.Sprintf("email.scheduled_action|%s|%s", job.ID, status)
+	if err := queueEvent(ctx, store, job.UserID, "email.scheduled_action", msgID, event); err != nil {
+		log.Printf("Error queueing event for job %s: %v", job.ID, err)
+	}
+}
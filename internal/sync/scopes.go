@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+// Access is a kind of mailbox access a client asks for when connecting an
+// inbox. The sync itself always needs AccessMetadata.
+type Access string
+
+const (
+	AccessMetadata Access = "metadata" // headers, labels and folders, what the sync reads
+	AccessBody     Access = "body"     // message content
+	AccessSend     Access = "send"     // sending mail (POST /mail/send)
+)
+
+// ParseAccess parses an Access
+func ParseAccess(s string) (Access, bool) {
+	switch a := Access(s); a {
+	case AccessMetadata, AccessBody, AccessSend:
+		return a, true
+	default:
+		return "", false
+	}
+}
+
+// ScopeNeed is an Access and the OAuth scopes that grant it, any one of which
+// is enough
+type ScopeNeed struct {
+	Access Access
+	AnyOf  []string
+}
+
+// ScopeError is returned when a token wasn't granted any of the scopes an
+// Access needs. It wraps ErrMissingScopes.
+type ScopeError struct {
+	Access  Access
+	AnyOf   []string // scopes that would grant Access
+	Granted []string
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("%s: %s access needs one of %s", ErrMissingScopes, e.Access, strings.Join(e.AnyOf, ", "))
+}
+
+func (e *ScopeError) Unwrap() error {
+	return ErrMissingScopes
+}
+
+// checkScopes verifies that token was granted the scopes a sync with opts
+// and the access asked for need. Providers that don't declare their scopes,
+// and tokens whose scopes can't be looked up, aren't checked: the sync then
+// reports SCOPE_MISSING when the provider refuses a call.
+func checkScopes(ctx context.Context, info ProviderInfo, token *auth.Token, opts ProviderOptions, access []Access) error {
+	if info.ScopeNeeds == nil || info.GrantedScopes == nil {
+		return nil
+	}
+	granted, err := info.GrantedScopes(ctx, token)
+	if errors.Is(err, ErrTokenExpired) {
+		return err
+	}
+	if err != nil {
+		log.Printf("scope check skipped for %s: %v", info.Name, err)
+		return nil
+	}
+	if granted == nil {
+		return nil
+	}
+
+	for _, need := range info.ScopeNeeds(opts, access) {
+		ok := slices.ContainsFunc(need.AnyOf, func(scope string) bool {
+			return slices.ContainsFunc(granted, func(g string) bool { return strings.EqualFold(g, scope) })
+		})
+		if !ok {
+			return &ScopeError{Access: need.Access, AnyOf: need.AnyOf, Granted: granted}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// SendResult is returned by SendMail
+type SendResult struct {
+	EventID string       `json:"event_id"`
+	Sent    *SentMessage `json:"sent"`
+}
+
+// SendMail sends a message through the user's connected provider and records an
+// email.sent event in the user's outbox. Replies are linked to the parent's
+// thread using the locally stored copy of the parent message.
+func (m *Manager) SendMail(ctx context.Context, userJWT, userID string, provider ProviderName, msg OutgoingMessage) (*SendResult, error) {
+	store, err := m.stores.Open(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open user DB: %w", err)
+	}
+	defer store.Close()
+
+	if msg.ReplyToMessageID != "" {
+		if err := linkReply(ctx, store, provider, &msg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := requireCapability(provider, CapSend, "sending"); err != nil {
+		return nil, err
+	}
+	mailProvider, err := m.providerFor(ctx, userJWT, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, ok := mailProvider.(Sender)
+	if !ok {
+		return nil, fmt.Errorf("sending %w %s", ErrNotSupported, provider)
+	}
+
+	sent, err := sender.SendMessage(ctx, msg)
+	if err != nil {
+		return nil, fmt.Errorf("send: %w", err)
+	}
+
+	eventID := uuid.NewString()
+	event := map[string]interface{}{
+		"event_id":            eventID,
+		"ts":                  time.Now().Unix(),
+		"provider":            string(provider),
+		"user_id":             userID,
+		"provider_message_id": sent.MessageID,
+		"provider_thread_id":  sent.ThreadID,
+		"subject":             msg.Subject,
+		"to_addrs":            msg.To,
+		"cc_addrs":            msg.Cc,
+		"bcc_addrs":           msg.Bcc,
+		"in_reply_to":         msg.ReplyToMessageID,
+	}
+	m.payload.apply(event)
+	// The message is already sent, so a failure here only loses the event
+	msgID := fmt.Sprintf("email.sent|%s|%s", provider, eventID)
+	if err := queueEvent(ctx, store, userID, "email.sent", msgID, event); err != nil {
+		return nil, fmt.Errorf("message sent but event not recorded: %w", err)
+	}
+
+	return &SendResult{EventID: eventID, Sent: sent}, nil
+}
+
+// queueEvent appends a standalone event to the user's outbox
+func queueEvent(ctx context.Context, store eventstore.Store, userID, eventType, msgID string, event map[string]interface{}) error {
+	payload, _ := json.Marshal(event)
+
+	return store.WithTx(ctx, func(tx eventstore.Tx) error {
+		return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+			Subject:     fmt.Sprintf("user.%s.%s", userID, eventType),
+			EventType:   eventType,
+			Payload:     payload,
+			MsgID:       msgID,
+			TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+		})
+	})
+}
+
+// linkReply fills thread id, reply headers and a default subject from the
+// stored parent message
+func linkReply(ctx context.Context, store eventstore.Store, provider ProviderName, msg *OutgoingMessage) error {
+	parent, err := store.LoadMessageRef(ctx, string(provider), msg.ReplyToMessageID)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fmt.Errorf("%w: %s", ErrMessageNotFound, msg.ReplyToMessageID)
+	}
+
+	var headers map[string]string
+	_ = json.Unmarshal([]byte(parent.HeadersJSON), &headers)
+
+	msg.ThreadID = parent.ThreadID
+	msg.InReplyTo = HeaderValue(headers, "Message-ID")
+	msg.References = strings.TrimSpace(HeaderValue(headers, "References") + " " + msg.InReplyTo)
+
+	if msg.Subject == "" {
+		msg.Subject = parent.Subject
+		if !strings.HasPrefix(strings.ToLower(msg.Subject), "re:") {
+			msg.Subject = "Re: " + msg.Subject
+		}
+	}
+	if len(msg.To) == 0 {
+		if from := HeaderValue(headers, "Reply-To"); from != "" {
+			msg.To = []string{from}
+		} else if from := HeaderValue(headers, "From"); from != "" {
+			msg.To = []string{from}
+		}
+	}
+	return nil
+}
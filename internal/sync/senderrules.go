@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// maxSenderRuleValue bounds rule values and header names
+const maxSenderRuleValue = 320
+
+// NormalizeSenderRule checks a rule and brings its value into the form it is
+// matched in: lowercase addresses and domains, canonical header names and
+// lowercase header substrings
+func NormalizeSenderRule(rule *eventstore.SenderRule) error {
+	switch rule.Action {
+	case eventstore.SenderRuleBlock, eventstore.SenderRuleAllow:
+	default:
+		return fmt.Errorf("%w: action must be block or allow", eventstore.ErrInvalidSenderRule)
+	}
+
+	value := strings.ToLower(strings.TrimSpace(rule.Value))
+	if len(value) > maxSenderRuleValue || len(rule.Header) > maxSenderRuleValue {
+		return fmt.Errorf("%w: value too long", eventstore.ErrInvalidSenderRule)
+	}
+	switch rule.Kind {
+	case eventstore.SenderRuleSender:
+		value = senderAddress(value)
+		if !strings.Contains(value, "@") {
+			return fmt.Errorf("%w: sender must be an email address", eventstore.ErrInvalidSenderRule)
+		}
+		rule.Header = ""
+	case eventstore.SenderRuleDomain:
+		value = strings.TrimPrefix(value, "@")
+		if value == "" || strings.ContainsAny(value, "@ ") {
+			return fmt.Errorf("%w: domain must be a domain name like example.com", eventstore.ErrInvalidSenderRule)
+		}
+		rule.Header = ""
+	case eventstore.SenderRuleHeader:
+		rule.Header = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(rule.Header))
+		if rule.Header == "" || strings.ContainsAny(rule.Header, ": ") {
+			return fmt.Errorf("%w: header rules need a header name", eventstore.ErrInvalidSenderRule)
+		}
+	default:
+		return fmt.Errorf("%w: kind must be sender, domain or header", eventstore.ErrInvalidSenderRule)
+	}
+	rule.Value = value
+	return nil
+}
+
+// senderAddress returns the lowercase address of a From value
+func senderAddress(from string) string {
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		from = parsed.Address
+	}
+	return strings.ToLower(strings.TrimSpace(from))
+}
+
+// senderFilter holds a user's sender rules by kind
+type senderFilter struct {
+	block, allow []eventstore.SenderRule
+}
+
+func newSenderFilter(rules []eventstore.SenderRule) *senderFilter {
+	f := &senderFilter{}
+	for _, r := range rules {
+		if r.Action == eventstore.SenderRuleAllow {
+			f.allow = append(f.allow, r)
+		} else {
+			f.block = append(f.block, r)
+		}
+	}
+	return f
+}
+
+// blocked returns the block rule that drops a message, nil if it is synced.
+// Allow rules only override block rules; without block rules every message
+// is synced.
+func (f *senderFilter) blocked(meta *MessageMeta) *eventstore.SenderRule {
+	if f == nil || len(f.block) == 0 || meta.Folder == FolderSent {
+		return nil
+	}
+	sender := senderAddress(meta.Sender)
+	for i := range f.block {
+		if !ruleMatches(&f.block[i], sender, meta.Headers) {
+			continue
+		}
+		for j := range f.allow {
+			if ruleMatches(&f.allow[j], sender, meta.Headers) {
+				return nil
+			}
+		}
+		return &f.block[i]
+	}
+	return nil
+}
+
+func ruleMatches(rule *eventstore.SenderRule, sender string, headers map[string]string) bool {
+	switch rule.Kind {
+	case eventstore.SenderRuleSender:
+		return sender == rule.Value
+	case eventstore.SenderRuleDomain:
+		at := strings.LastIndex(sender, "@")
+		if at < 0 {
+			return false
+		}
+		domain := sender[at+1:]
+		return domain == rule.Value || strings.HasSuffix(domain, "."+rule.Value)
+	case eventstore.SenderRuleHeader:
+		for k, v := range headers {
+			if strings.EqualFold(k, rule.Header) && strings.Contains(strings.ToLower(v), rule.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refreshSenderRules reloads the user's sender rules. On failure the rules
+// loaded before stay in use.
+func (r *Runner) refreshSenderRules(ctx context.Context, store eventstore.Store) {
+	rules, err := store.ListSenderRules(ctx)
+	if err != nil {
+		log.Printf("Error loading sender rules: %v", err)
+		return
+	}
+	r.senderRules.Store(newSenderFilter(rules))
+}
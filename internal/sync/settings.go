@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// ErrInvalidSettings is returned by UpdateSettings for unusable settings
+var ErrInvalidSettings = errors.New("invalid sync settings")
+
+// Bounds of the runtime settings
+const (
+	MinPollInterval        = 10 * time.Second
+	MaxPollInterval        = time.Hour
+	MaxBackfillConcurrency = 256
+)
+
+// liveSettings is the runtime configuration runners read while they run
+type liveSettings struct {
+	defaultPoll atomic.Int64 // nanoseconds, 0 for DefaultPollInterval
+	backfills   *slots       // initial backfills running at once
+
+	mu         sync.Mutex
+	rateLimits map[ProviderName]string // overrides applied to the limiters
+}
+
+// DefaultPollInterval returns the time between incremental syncs of inboxes
+// without their own interval
+func (m *Manager) DefaultPollInterval() time.Duration {
+	if d := time.Duration(m.live.defaultPoll.Load()); d > 0 {
+		return d
+	}
+	return DefaultPollInterval
+}
+
+// RateLimits returns the limits currently pacing each provider
+func (m *Manager) RateLimits() map[ProviderName]ratelimit.Limits {
+	limits := make(map[ProviderName]ratelimit.Limits, len(m.limiters))
+	for provider, l := range m.limiters {
+		limits[provider] = l.Limits()
+	}
+	return limits
+}
+
+// Settings returns the saved runtime settings. Requires SetAssignments.
+func (m *Manager) Settings(ctx context.Context) (*syncconfig.Settings, error) {
+	if m.configs == nil {
+		return nil, fmt.Errorf("sync configs are not configured")
+	}
+	return m.configs.LoadSettings(ctx)
+}
+
+// UpdateSettings validates and saves runtime settings, applies them to this
+// process and tells workers, which apply them on their next reconcile.
+// Requires SetAssignments.
+func (m *Manager) UpdateSettings(ctx context.Context, s *syncconfig.Settings, by string) error {
+	if m.configs == nil {
+		return fmt.Errorf("sync configs are not configured")
+	}
+	if err := m.validateSettings(s); err != nil {
+		return err
+	}
+	if err := m.configs.SaveSettings(ctx, s, by); err != nil {
+		return err
+	}
+	m.ApplySettings(s)
+	m.assignmentsChanged(ctx)
+	return nil
+}
+
+func (m *Manager) validateSettings(s *syncconfig.Settings) error {
+	poll := time.Duration(s.PollInterval) * time.Second
+	if s.PollInterval != 0 && (poll < MinPollInterval || poll > MaxPollInterval) {
+		return fmt.Errorf("%w: poll interval must be between %s and %s", ErrInvalidSettings, MinPollInterval, MaxPollInterval)
+	}
+	if s.BackfillConcurrency < 0 || s.BackfillConcurrency > MaxBackfillConcurrency {
+		return fmt.Errorf("%w: backfill concurrency must be between 0 and %d", ErrInvalidSettings, MaxBackfillConcurrency)
+	}
+	for provider, spec := range s.RateLimits {
+		base, ok := m.baseLimits[ProviderName(provider)]
+		if !ok {
+			return fmt.Errorf("%w: no rate limits for provider %q", ErrInvalidSettings, provider)
+		}
+		if _, err := ratelimit.ParseLimits(spec, base); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidSettings, provider, err)
+		}
+	}
+	return nil
+}
+
+// ApplySettings puts runtime settings into effect for running and future
+// syncs: the default poll interval on each runner's next tick, the backfill
+// cap on the next backfill to start and rate limits on the next provider
+// call. Rate limits reset only when a provider's override changed, so calling
+// it again with the same settings is cheap.
+func (m *Manager) ApplySettings(s *syncconfig.Settings) {
+	m.live.defaultPoll.Store(int64(time.Duration(s.PollInterval) * time.Second))
+	m.live.backfills.setLimit(s.BackfillConcurrency)
+
+	m.live.mu.Lock()
+	defer m.live.mu.Unlock()
+	for provider, limiter := range m.limiters {
+		spec := s.RateLimits[string(provider)]
+		if spec == m.live.rateLimits[provider] {
+			continue
+		}
+		limits, err := ratelimit.ParseLimits(spec, m.baseLimits[provider])
+		if err != nil {
+			log.Printf("Ignoring rate limits for %s: %v", provider, err)
+			continue
+		}
+		limiter.SetLimits(limits)
+		m.live.rateLimits[provider] = spec
+		log.Printf("Rate limits (%s): %s", provider, limits)
+	}
+}
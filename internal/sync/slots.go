@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"context"
+	"sync"
+)
+
+// slots caps how many runners do something at once, e.g. initial backfills.
+// The cap can change while runners hold or wait for slots; lowering it lets
+// current holders finish.
+type slots struct {
+	mu      sync.Mutex
+	limit   int // 0 for unlimited
+	used    int
+	changed chan struct{} // closed when a slot frees up or the limit changes
+}
+
+func newSlots() *slots {
+	return &slots{changed: make(chan struct{})}
+}
+
+// setLimit changes the cap; 0 removes it
+func (s *slots) setLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n == s.limit {
+		return
+	}
+	s.limit = n
+	s.broadcast()
+}
+
+// acquire waits for a slot. Release it with the returned func, which may be
+// called more than once. A nil slots never waits.
+func (s *slots) acquire(ctx context.Context) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	for {
+		s.mu.Lock()
+		if s.limit <= 0 || s.used < s.limit {
+			s.used++
+			s.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(s.release) }, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used--
+	s.broadcast()
+}
+
+// broadcast wakes every waiter. Callers hold s.mu.
+func (s *slots) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
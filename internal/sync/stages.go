@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/langdetect"
+	"github.com/Martian-dev/ai-brain-infra/internal/signature"
+)
+
+// Built-in pipeline stages. classify, mailing_list, language and signature
+// run by default; the rest are opt-in via EVENT_PIPELINE.
+func init() {
+	RegisterStage("classify", classifyStage)
+	RegisterStage("mailing_list", mailingListStage)
+	RegisterStage("language", languageStage)
+	RegisterStage("signature", signatureStage)
+	RegisterStage("normalize_addresses", normalizeAddressesStage)
+	RegisterStage("redact_snippet", redactSnippetStage)
+	RegisterStage("strip_headers", stripHeadersStage)
+	RegisterStage("drop_auto", dropAutoStage)
+
+	p, err := NewPipeline(DefaultStages)
+	if err != nil {
+		panic(err)
+	}
+	defaultPipeline = p
+}
+
+// classifyStage detects bounces and auto-replies unless the provider already did
+func classifyStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	if meta.Kind == "" {
+		meta.Kind = ClassifyMessage(meta.Sender, meta.Headers)
+	}
+	return true, nil
+}
+
+// mailingListStage detects list and bulk mail unless the provider already did
+func mailingListStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	if meta.List == nil {
+		meta.List = DetectMailingList(meta.Headers)
+	}
+	return true, nil
+}
+
+// languageStage detects the language of the subject and snippet unless the
+// provider already did. It must run before redact_snippet.
+func languageStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	if meta.Language == "" {
+		meta.Language = langdetect.Detect(meta.Subject + "\n" + meta.Snippet)
+	}
+	return true, nil
+}
+
+// signatureStage parses the sender's signature from the body, or the snippet
+// when the provider has no body. Sent, list and automatic mail is skipped, so
+// it must run after classify and mailing_list.
+func signatureStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	if meta.Folder == FolderSent || meta.List != nil || (meta.Kind != "" && meta.Kind != KindMessage) {
+		return true, nil
+	}
+	text := meta.Body
+	if text == "" {
+		text = meta.Snippet
+	}
+	if sig := signature.Parse(text); !sig.Empty() {
+		meta.Signature = sig
+	}
+	return true, nil
+}
+
+// normalizeAddressesStage lowercases recipient addresses and strips display
+// names, so the same person always appears the same way
+func normalizeAddressesStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	meta.To = normalizeAddrs(meta.To)
+	meta.Cc = normalizeAddrs(meta.Cc)
+	meta.Bcc = normalizeAddrs(meta.Bcc)
+	return true, nil
+}
+
+func normalizeAddrs(addrs []string) []string {
+	for i, a := range addrs {
+		if parsed, err := mail.ParseAddress(a); err == nil {
+			a = parsed.Address
+		}
+		addrs[i] = strings.ToLower(strings.TrimSpace(a))
+	}
+	return addrs
+}
+
+// redactSnippetStage drops message snippets for deployments that must not
+// store any message content
+func redactSnippetStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	meta.Snippet = ""
+	return true, nil
+}
+
+// keptHeaders are the headers strip_headers retains
+var keptHeaders = []string{
+	"Subject", "From", "To", "Cc", "Date", "Message-ID", "In-Reply-To", "References",
+	"List-Id", "List-Unsubscribe", "List-Unsubscribe-Post", "Content-Type",
+}
+
+// stripHeadersStage reduces stored headers to keptHeaders. It must run after
+// classify and mailing_list, which read the full header set.
+func stripHeadersStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	stripped := make(map[string]string, len(keptHeaders))
+	for _, name := range keptHeaders {
+		if v := HeaderValue(meta.Headers, name); v != "" {
+			stripped[name] = v
+		}
+	}
+	meta.Headers = stripped
+	return true, nil
+}
+
+// dropAutoStage discards bounces and auto-replies. Runs after classify.
+func dropAutoStage(_ context.Context, meta *MessageMeta) (bool, error) {
+	return meta.Kind != KindAutoReply && meta.Kind != KindBounce, nil
+}
@@ -0,0 +1,33 @@
+package sync
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bound individual provider API calls, so a hung request fails the
+// sync cycle (and is retried on the next one) instead of stalling it forever.
+// A zero value disables that timeout.
+type Timeouts struct {
+	List  time.Duration // listing pages: messages, folders
+	Get   time.Duration // single calls: message metadata, profile, folder lookups
+	Delta time.Duration // change feed pages: Gmail history, Graph delta
+	Start time.Duration // starting a sync: token fetch and adapter setup
+}
+
+// DefaultTimeouts are used unless the manager is configured otherwise
+var DefaultTimeouts = Timeouts{
+	List:  30 * time.Second,
+	Get:   15 * time.Second,
+	Delta: 60 * time.Second,
+	Start: 20 * time.Second,
+}
+
+// WithTimeout returns a context for one provider call, bounded by d when d is
+// positive
+func WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
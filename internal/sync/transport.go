@@ -0,0 +1,22 @@
+package sync
+
+import (
+	"net/http"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/chaos"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
+	"github.com/Martian-dev/ai-brain-infra/internal/slowlog"
+)
+
+// Transport wraps an adapter's base HTTP transport with the per-call
+// middleware every adapter installs beneath its SDK: rate limiting, per-user
+// debug logging, fault injection in chaos mode, and slow-call logging
+// (innermost, so neither limiter waits nor injected faults are timed).
+func (o ProviderOptions) Transport(base http.RoundTripper) http.RoundTripper {
+	rt := slowlog.Transport(base, string(o.Provider), o.UserID)
+	rt = chaos.Transport(rt)
+	if o.Debug != nil {
+		rt = &debugTransport{base: rt, debug: o.Debug}
+	}
+	return ratelimit.NewTransport(rt, o.Pacer)
+}
@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+)
+
+// Unsubscribe methods
+const (
+	UnsubscribeOneClick = "one_click" // RFC 8058 POST to the list's https URI
+	UnsubscribeMailto   = "mailto"    // message to the list's address, sent through the provider
+)
+
+// UnsubscribeTargets are the URIs of a List-Unsubscribe header, in the
+// sender's order of preference
+type UnsubscribeTargets struct {
+	HTTPS  []string
+	Mailto []string
+}
+
+// ParseListUnsubscribe reads a List-Unsubscribe value such as
+// "<mailto:leave@list.example>, <https://list.example/u/123>". Plain http
+// URIs are ignored.
+func ParseListUnsubscribe(header string) UnsubscribeTargets {
+	var t UnsubscribeTargets
+	for _, part := range strings.Split(header, ",") {
+		uri := strings.TrimSpace(part)
+		if !strings.HasPrefix(uri, "<") || !strings.HasSuffix(uri, ">") {
+			continue
+		}
+		uri = strings.TrimSpace(uri[1 : len(uri)-1])
+		switch lower := strings.ToLower(uri); {
+		case strings.HasPrefix(lower, "https://"):
+			t.HTTPS = append(t.HTTPS, uri)
+		case strings.HasPrefix(lower, "mailto:"):
+			t.Mailto = append(t.Mailto, uri)
+		}
+	}
+	return t
+}
+
+// UnsubscribeResult is returned by Unsubscribe
+type UnsubscribeResult struct {
+	EventID string `json:"event_id"`
+	Method  string `json:"method"`
+	Target  string `json:"target"`
+}
+
+// Unsubscribe leaves a list using its List-Unsubscribe header: a one-click
+// POST when the list supports it, otherwise a message to its mailto address
+// sent through the user's provider. The list is then marked unsubscribed and
+// subscription.unsubscribed is queued.
+func (m *Manager) Unsubscribe(ctx context.Context, userJWT, userID string, provider ProviderName, key string) (*UnsubscribeResult, error) {
+	store, err := m.stores.Open(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open user DB: %w", err)
+	}
+	defer store.Close()
+
+	sub, err := store.LoadSubscription(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, fmt.Errorf("subscription %q %w", key, eventstore.ErrNotFound)
+	}
+
+	targets := ParseListUnsubscribe(sub.Unsubscribe)
+	result := &UnsubscribeResult{EventID: uuid.NewString()}
+	switch {
+	case sub.OneClick && len(targets.HTTPS) > 0:
+		result.Method, result.Target = UnsubscribeOneClick, targets.HTTPS[0]
+		if err := postOneClick(ctx, result.Target); err != nil {
+			return nil, err
+		}
+	case len(targets.Mailto) > 0:
+		msg, err := unsubscribeMessage(targets.Mailto[0])
+		if err != nil {
+			return nil, err
+		}
+		result.Method, result.Target = UnsubscribeMailto, msg.To[0]
+		if _, err := m.SendMail(ctx, userJWT, userID, provider, *msg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNoUnsubscribe
+	}
+
+	// The list was left already, so failures here only lose the record
+	event := map[string]interface{}{
+		"event_id": result.EventID,
+		"ts":       time.Now().Unix(),
+		"provider": string(provider),
+		"user_id":  userID,
+		"key":      sub.Key,
+		"list_id":  sub.ListID,
+		"sender":   sub.Sender,
+		"method":   result.Method,
+		"target":   result.Target,
+	}
+	msgID := fmt.Sprintf("subscription.unsubscribed|%s", result.EventID)
+	if err := queueEvent(ctx, store, userID, "subscription.unsubscribed", msgID, event); err != nil {
+		return nil, fmt.Errorf("unsubscribed but event not recorded: %w", err)
+	}
+	err = store.SetUnsubscribeStatus(ctx, eventstore.UnsubscribeSuggestion{
+		Key:    sub.Key,
+		ListID: sub.ListID,
+		Name:   sub.Name,
+		Sender: sub.Sender,
+		Status: eventstore.UnsubscribeUnsubscribed,
+		Method: result.Method,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unsubscribed but not recorded: %w", err)
+	}
+	return result, nil
+}
+
+// unsubscribeMessage builds the message for a mailto URI, using its subject
+// and body when given
+func unsubscribeMessage(uri string) (*OutgoingMessage, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Opaque == "" {
+		return nil, fmt.Errorf("%w: invalid mailto URI %q", ErrNoUnsubscribe, uri)
+	}
+	to, err := url.PathUnescape(u.Opaque)
+	if err != nil || !strings.Contains(to, "@") {
+		return nil, fmt.Errorf("%w: invalid mailto URI %q", ErrNoUnsubscribe, uri)
+	}
+
+	q := u.Query()
+	msg := &OutgoingMessage{To: []string{to}, Subject: q.Get("subject"), Body: q.Get("body")}
+	if msg.Subject == "" {
+		msg.Subject = "unsubscribe"
+	}
+	if msg.Body == "" {
+		msg.Body = "unsubscribe"
+	}
+	return msg, nil
+}
+
+// unsubscribeClient posts one-click requests. The URIs come from mail
+// senders, so it only connects to public addresses and doesn't follow
+// redirects.
+var unsubscribeClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 10 * time.Second, Control: publicAddressOnly}).DialContext,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// publicAddressOnly refuses connections to loopback, private and link-local
+// addresses, checked after DNS resolution
+func publicAddressOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
+
+// postOneClick sends an RFC 8058 one-click unsubscribe request
+func postOneClick(ctx context.Context, uri string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader("List-Unsubscribe=One-Click"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsubscribeFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := unsubscribeClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsubscribeFailed, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%w: %s answered %s", ErrUnsubscribeFailed, req.URL.Host, resp.Status)
+	}
+	return nil
+}
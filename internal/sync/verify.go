@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// Publish verification defaults
+const (
+	DefaultVerifySample = 20        // messages checked per user and run
+	DefaultVerifyWindow = time.Hour // how far back published messages are sampled
+)
+
+// Verification instruments, recorded through the global MeterProvider
+var (
+	verifyChecked metric.Int64Counter
+	verifyLost    metric.Int64Counter
+)
+
+func init() {
+	meter := otel.Meter("github.com/Martian-dev/ai-brain-infra/internal/sync")
+
+	var err error
+	if verifyChecked, err = meter.Int64Counter("outbox.verify.checked",
+		metric.WithDescription("Published outbox messages looked up in JetStream"),
+		metric.WithUnit("{message}")); err != nil {
+		otel.Handle(err)
+	}
+	if verifyLost, err = meter.Int64Counter("outbox.verify.lost",
+		metric.WithDescription("Published outbox messages JetStream acknowledged but doesn't have"),
+		metric.WithUnit("{message}")); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// PublishVerifier samples a user's published outbox messages and checks that
+// JetStream still stores them where it acknowledged them, to detect publishes
+// lost after the ack (e.g. a leader change dropping unreplicated writes).
+// Only messages published since verification existed have a sequence.
+type PublishVerifier struct {
+	stores    eventstore.Opener
+	publisher *natsjs.Publisher
+	reporter  errreport.Reporter
+	sample    int
+	window    time.Duration
+}
+
+// VerifyResult counts one user's checked messages by outcome
+type VerifyResult struct {
+	Checked  int `json:"checked"`
+	Missing  int `json:"missing"`
+	Mismatch int `json:"mismatch"`
+}
+
+// NewPublishVerifier checks up to sample messages per user published within
+// window. Lost messages are reported to reporter, which may be nil.
+func NewPublishVerifier(stores eventstore.Opener, publisher *natsjs.Publisher, reporter errreport.Reporter, sample int, window time.Duration) *PublishVerifier {
+	if sample <= 0 {
+		sample = DefaultVerifySample
+	}
+	if window <= 0 {
+		window = DefaultVerifyWindow
+	}
+	return &PublishVerifier{stores: stores, publisher: publisher, reporter: reporter, sample: sample, window: window}
+}
+
+// Verify checks a sample of the user's recently published messages
+func (v *PublishVerifier) Verify(ctx context.Context, userID string) (VerifyResult, error) {
+	var result VerifyResult
+
+	store, err := v.stores.Open(userID)
+	if err != nil {
+		return result, err
+	}
+	defer store.Close()
+
+	sample, err := store.SamplePublished(ctx, time.Now().Add(-v.window).Unix(), v.sample)
+	if err != nil {
+		return result, err
+	}
+
+	for _, msg := range sample {
+		outcome, err := v.publisher.CheckPublished(ctx, msg.Stream, msg.Sequence, msg.MsgID)
+		if err != nil {
+			return result, err
+		}
+		result.Checked++
+		verifyChecked.Add(ctx, 1, metric.WithAttributes(attribute.String("stream", msg.Stream)))
+
+		switch outcome {
+		case natsjs.PublishMissing:
+			result.Missing++
+		case natsjs.PublishMismatch:
+			result.Mismatch++
+		default:
+			continue
+		}
+		verifyLost.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("stream", msg.Stream),
+			attribute.String("outcome", outcome)))
+		log.Printf("Outbox message %d of user %s (%s) is %s from %s at sequence %d", msg.ID, userID, msg.MsgID, outcome, msg.Stream, msg.Sequence)
+		errreport.Report(ctx, v.reporter, errreport.Event{
+			Source: errreport.SourceOutbox,
+			Err:    fmt.Errorf("published message %s is %s from stream %s at sequence %d", msg.MsgID, outcome, msg.Stream, msg.Sequence),
+			UserID: userID,
+			Tags: map[string]string{
+				"outbox_id": fmt.Sprint(msg.ID),
+				"subject":   msg.Subject,
+				"stream":    msg.Stream,
+				"outcome":   outcome,
+			},
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// DefaultReconcileInterval is how often a worker re-reads the sync configs
+// when it isn't nudged
+const DefaultReconcileInterval = 30 * time.Second
+
+// Worker runs the syncs recorded in the sync config store for the users the
+// manager owns. It reconciles on an interval and whenever it is nudged (the
+// API announces changes over NATS, membership changes rebalance), starting
+// owned syncs that aren't running and stopping the ones that were
+// unassigned or moved to another worker. Syncs that fail to start or exit
+// with an error are retried with backoff.
+type Worker struct {
+	manager  *Manager
+	configs  *syncconfig.Store
+	interval time.Duration
+	nudge    chan struct{}
+
+	started  map[string]InboxConfig // syncs this worker started, by key
+	attempts map[string]startAttempt
+}
+
+// startAttempt tracks restart backoff for one sync
+type startAttempt struct {
+	n    int
+	next time.Time
+}
+
+// NewWorker creates a worker that runs syncs through manager. Provider tokens
+// are fetched with service tokens, so the manager needs SetServiceTokens.
+func NewWorker(manager *Manager, configs *syncconfig.Store, interval time.Duration) *Worker {
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	return &Worker{
+		manager:  manager,
+		configs:  configs,
+		interval: interval,
+		nudge:    make(chan struct{}, 1),
+		started:  make(map[string]InboxConfig),
+		attempts: make(map[string]startAttempt),
+	}
+}
+
+// Nudge asks the worker to reconcile now. It never blocks.
+func (w *Worker) Nudge() {
+	select {
+	case w.nudge <- struct{}{}:
+	default:
+	}
+}
+
+// Run reconciles until ctx is cancelled, then stops the syncs it started
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			for key, config := range w.started {
+				_ = w.manager.StopSync(config.UserID, config.InboxID, config.Provider)
+				delete(w.started, key)
+			}
+			return
+		case <-ticker.C:
+		case <-w.nudge:
+		}
+	}
+}
+
+// reconcile brings the running syncs in line with the configs and applies
+// the runtime sync settings
+func (w *Worker) reconcile(ctx context.Context) {
+	if settings, err := w.configs.LoadSettings(ctx); err != nil {
+		log.Printf("Error loading sync settings: %v", err)
+	} else {
+		w.manager.ApplySettings(settings)
+	}
+
+	configs, err := w.configs.List(ctx)
+	if err != nil {
+		log.Printf("Error listing sync configs: %v", err)
+		return
+	}
+
+	now := time.Now()
+	wanted := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		config := inboxConfig(cfg)
+		key := fmt.Sprintf("%s:%s:%s", config.UserID, config.InboxID, config.Provider)
+		if !w.manager.owns(config.UserID) {
+			// Another worker owns the user now; hand the sync over
+			if w.manager.StopSync(config.UserID, config.InboxID, config.Provider) == nil {
+				log.Printf("Released sync %s to its new owner", key)
+			}
+			delete(w.attempts, key)
+			continue
+		}
+		wanted[key] = true
+
+		// A sync that has outlived its backoff window counts as healthy
+		attempt, retrying := w.attempts[key]
+		if w.manager.IsRunning(config.UserID, config.InboxID, config.Provider) {
+			if retrying && now.After(attempt.next) {
+				delete(w.attempts, key)
+			}
+			continue
+		}
+		if retrying && now.Before(attempt.next) {
+			continue
+		}
+
+		attempt.n++
+		attempt.next = now.Add(min(restartDelayMin<<min(attempt.n-1, 8), restartDelayMax))
+		w.attempts[key] = attempt
+
+		if err := w.manager.StartSync(ctx, config); err != nil {
+			log.Printf("Error starting assigned sync %s (attempt %d): %v", key, attempt.n, err)
+			if errors.Is(err, auth.ErrAuthServer) {
+				// The auth server's outage, not the sync's: keep the backoff short
+				w.attempts[key] = startAttempt{next: now.Add(restartDelayMin)}
+			}
+			if CodeOf(err) != ErrorSyncFailed {
+				// Something the user can act on, e.g. a revoked token
+				w.manager.markSyncError(config.UserID, config.Provider, err)
+			}
+			continue
+		}
+		w.started[key] = config
+	}
+
+	for key, config := range w.started {
+		if wanted[key] {
+			continue
+		}
+		if err := w.manager.StopSync(config.UserID, config.InboxID, config.Provider); err == nil {
+			log.Printf("Stopped unassigned sync %s", key)
+		}
+		delete(w.started, key)
+		delete(w.attempts, key)
+	}
+}
@@ -0,0 +1,27 @@
+PRAGMA journal_mode=WAL;
+PRAGMA synchronous=NORMAL;
+PRAGMA busy_timeout=5000;
+
+-- Connected inboxes that should be syncing, shared across users. The API
+-- writes it on connect/disconnect; sync workers reconcile against it.
+CREATE TABLE IF NOT EXISTS sync_configs (
+  user_id             TEXT NOT NULL,
+  inbox_id            TEXT NOT NULL,
+  provider            TEXT NOT NULL,                  -- GOOGLE|MICROSOFT
+  include_spam        INTEGER NOT NULL DEFAULT 0,
+  backfill_days       INTEGER NOT NULL DEFAULT 0,     -- 0 backfills all mail
+  folders             TEXT,                           -- JSON array of canonical folders, NULL for the provider's defaults
+  poll_interval       INTEGER NOT NULL DEFAULT 0,     -- seconds, 0 for the default
+  created_at          INTEGER NOT NULL,
+  updated_at          INTEGER NOT NULL,
+  PRIMARY KEY (user_id, inbox_id, provider)
+);
+
+-- Runtime sync settings changed by admins (one row). Workers re-read it on
+-- every reconcile and apply changes to running syncs.
+CREATE TABLE IF NOT EXISTS sync_settings (
+  id                  INTEGER PRIMARY KEY CHECK (id = 1),
+  settings            TEXT NOT NULL,                  -- JSON Settings
+  updated_by          TEXT NOT NULL DEFAULT '',
+  updated_at          INTEGER NOT NULL
+);
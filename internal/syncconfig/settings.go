@@ -0,0 +1,71 @@
+package syncconfig
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Settings are the sync settings admins change at runtime. Zero values keep
+// the process's startup configuration.
+type Settings struct {
+	// PollInterval is the seconds between incremental syncs of inboxes
+	// without their own interval
+	PollInterval int `json:"poll_interval_seconds,omitempty"`
+
+	// BackfillConcurrency caps the initial backfills a process runs at once
+	BackfillConcurrency int `json:"backfill_concurrency,omitempty"`
+
+	// RateLimits overrides provider rate limits, by provider, in the form of
+	// RATE_LIMIT_<PROVIDER> (e.g. "user=5,user_burst=10")
+	RateLimits map[string]string `json:"rate_limits,omitempty"`
+
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoadSettings returns the runtime settings, zero if none were saved
+func (s *Store) LoadSettings(ctx context.Context) (*Settings, error) {
+	var (
+		raw       string
+		settings  Settings
+		updatedAt int64
+	)
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT settings, updated_by, updated_at FROM sync_settings WHERE id = 1
+	`).Scan(&raw, &settings.UpdatedBy, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Settings{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync settings: %w", err)
+	}
+	if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+		return nil, fmt.Errorf("failed to decode sync settings: %w", err)
+	}
+	settings.UpdatedAt = time.Unix(updatedAt, 0)
+	return &settings, nil
+}
+
+// SaveSettings replaces the runtime settings, stamping who changed them
+func (s *Store) SaveSettings(ctx context.Context, settings *Settings, by string) error {
+	settings.UpdatedBy = by
+	settings.UpdatedAt = time.Now()
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode sync settings: %w", err)
+	}
+
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO sync_settings (id, settings, updated_by, updated_at) VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			settings = excluded.settings, updated_by = excluded.updated_by, updated_at = excluded.updated_at
+	`, string(raw), by, settings.UpdatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save sync settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package syncconfig persists which inboxes should be syncing, so sync
+// workers can run separately from the API and resume syncs after a restart.
+package syncconfig
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+// Config is an inbox that should be syncing
+type Config struct {
+	UserID       string    `json:"user_id"`
+	InboxID      string    `json:"inbox_id"`
+	Provider     string    `json:"provider"`
+	IncludeSpam  bool      `json:"include_spam"`
+	BackfillDays int       `json:"backfill_days,omitempty"` // initial backfill window, 0 for all mail
+	Folders      []string  `json:"folders,omitempty"`       // canonical folders, empty for the provider's defaults
+	PollInterval int       `json:"poll_interval,omitempty"` // seconds between incremental syncs, 0 for the default
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// addedColumns were added to sync_configs after its initial release
+var addedColumns = []struct{ name, decl string }{
+	{"backfill_days", "INTEGER NOT NULL DEFAULT 0"},
+	{"folders", "TEXT"},
+	{"poll_interval", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// Store keeps sync configs in a single SQLite database
+type Store struct {
+	DB *sql.DB
+}
+
+// Open opens or creates the sync config database
+func Open(dbPath string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if _, err := db.Exec(schemaSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{DB: db}, nil
+}
+
+// migrate adds columns missing from databases created by older versions
+func migrate(db *sql.DB) error {
+	for _, col := range addedColumns {
+		var exists int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('sync_configs') WHERE name = ?`, col.name).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check sync_configs.%s: %w", col.name, err)
+		}
+		if exists == 0 {
+			if _, err := db.Exec("ALTER TABLE sync_configs ADD COLUMN " + col.name + " " + col.decl); err != nil {
+				return fmt.Errorf("failed to add sync_configs.%s: %w", col.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+// Put records that an inbox should be syncing, updating its options if it
+// already is
+func (s *Store) Put(ctx context.Context, cfg Config) error {
+	var folders sql.NullString
+	if len(cfg.Folders) > 0 {
+		b, _ := json.Marshal(cfg.Folders)
+		folders = sql.NullString{String: string(b), Valid: true}
+	}
+
+	now := time.Now().Unix()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO sync_configs (user_id, inbox_id, provider, include_spam, backfill_days, folders, poll_interval, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, inbox_id, provider) DO UPDATE SET
+			include_spam = excluded.include_spam,
+			backfill_days = excluded.backfill_days,
+			folders = excluded.folders,
+			poll_interval = excluded.poll_interval,
+			updated_at = excluded.updated_at
+	`, cfg.UserID, cfg.InboxID, cfg.Provider, cfg.IncludeSpam, cfg.BackfillDays, folders, cfg.PollInterval, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save sync config: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an inbox's config. Returns false if there was none.
+func (s *Store) Delete(ctx context.Context, userID, inboxID, provider string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM sync_configs WHERE user_id = ? AND inbox_id = ? AND provider = ?
+	`, userID, inboxID, provider)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete sync config: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// List returns every config
+func (s *Store) List(ctx context.Context) ([]Config, error) {
+	return s.query(ctx, `ORDER BY user_id, inbox_id, provider`)
+}
+
+// ListUser returns a user's configs
+func (s *Store) ListUser(ctx context.Context, userID string) ([]Config, error) {
+	return s.query(ctx, `WHERE user_id = ? ORDER BY inbox_id, provider`, userID)
+}
+
+func (s *Store) query(ctx context.Context, where string, args ...any) ([]Config, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT user_id, inbox_id, provider, include_spam, backfill_days, COALESCE(folders, ''), poll_interval,
+		       created_at, updated_at
+		FROM sync_configs `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync configs: %w", err)
+	}
+	defer rows.Close()
+
+	var configs []Config
+	for rows.Next() {
+		var (
+			cfg                  Config
+			folders              string
+			createdAt, updatedAt int64
+		)
+		if err := rows.Scan(&cfg.UserID, &cfg.InboxID, &cfg.Provider, &cfg.IncludeSpam, &cfg.BackfillDays, &folders,
+			&cfg.PollInterval, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sync config: %w", err)
+		}
+		if folders != "" {
+			_ = json.Unmarshal([]byte(folders), &cfg.Folders)
+		}
+		cfg.CreatedAt = time.Unix(createdAt, 0)
+		cfg.UpdatedAt = time.Unix(updatedAt, 0)
+		configs = append(configs, cfg)
+	}
+	return configs, rows.Err()
+}
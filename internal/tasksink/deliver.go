@@ -0,0 +1,278 @@
+package tasksink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+	"github.com/Martian-dev/ai-brain-infra/internal/workflow"
+)
+
+// Delivery outcome events
+const (
+	EventDelivered      = "task.delivered"
+	EventDeliveryFailed = "task.delivery_failed"
+)
+
+// JobDeliver pushes one delivery to its sink
+const JobDeliver = "task_delivery"
+
+const deliverMaxAttempts = 5
+
+// TokenFunc fetches a user's OAuth token for a task system account
+type TokenFunc func(ctx context.Context, userID string, provider auth.Provider) (*auth.Token, error)
+
+// deliverPayload is the payload of a task_delivery job
+type deliverPayload struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// extracted is the payload of a tasks.extracted event
+type extracted struct {
+	WorkflowID string            `json:"workflow_id"`
+	Provider   string            `json:"provider"`
+	ThreadID   string            `json:"thread_id"`
+	Tasks      []json.RawMessage `json:"tasks"`
+}
+
+// Deliverer pushes extracted action items to the users' connected sinks
+type Deliverer struct {
+	stores eventstore.Opener
+	jobs   *jobs.Store
+	token  TokenFunc
+}
+
+// New creates a deliverer. Jobs run without a user request, so token
+// fetches the users' tokens from BetterAuth with a service token.
+func New(stores eventstore.Opener, store *jobs.Store, token TokenFunc) *Deliverer {
+	return &Deliverer{stores: stores, jobs: store, token: token}
+}
+
+// Projection returns the projection that turns tasks.extracted into
+// deliveries. Delivery ids derive from the workflow and item, so a
+// redelivered event queues nothing new.
+func (d *Deliverer) Projection() projection.Projection {
+	return projection.Projection{
+		Name:   "tasksink",
+		Events: []string{workflow.EventTasksExtracted},
+		Apply:  d.apply,
+	}
+}
+
+// Register adds the task_delivery kind to runner
+func (d *Deliverer) Register(runner *jobs.Runner) {
+	runner.Register(JobDeliver, jobs.Kind{
+		Handler:     d.deliver,
+		MaxAttempts: deliverMaxAttempts,
+		OnFinish:    d.finished,
+	})
+}
+
+// apply records a delivery per item and connected sink and queues its job
+func (d *Deliverer) apply(ctx context.Context, ev projection.Event) error {
+	var e extracted
+	if err := json.Unmarshal(ev.Data, &e); err != nil || e.WorkflowID == "" {
+		return nil // not ours to fix
+	}
+	items := Items(e.Tasks)
+	if len(items) == 0 {
+		return nil
+	}
+
+	store, err := d.stores.Open(ev.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	sinks, err := store.ListTaskSinks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, sink := range sinks {
+		for i, item := range items {
+			delivery := &eventstore.TaskDelivery{
+				ID:               fmt.Sprintf("%s:%s:%d", e.WorkflowID, sink.Name, i),
+				Sink:             sink.Name,
+				Provider:         e.Provider,
+				ProviderThreadID: e.ThreadID,
+				SourceID:         e.WorkflowID,
+				Title:            item.Title,
+				Notes:            item.Notes,
+				Due:              item.Due,
+				Status:           eventstore.TaskDeliveryPending,
+			}
+			created, err := store.CreateTaskDelivery(ctx, delivery)
+			if err != nil {
+				return err
+			}
+			if !created {
+				continue
+			}
+			if _, err := d.jobs.Enqueue(ctx, ev.UserID, JobDeliver, deliverPayload{delivery.ID}, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Retry queues a failed delivery again
+func (d *Deliverer) Retry(ctx context.Context, store eventstore.Store, delivery *eventstore.TaskDelivery) error {
+	delivery.Status, delivery.LastError = eventstore.TaskDeliveryPending, ""
+	if err := store.WithTx(ctx, func(tx eventstore.Tx) error {
+		return tx.UpdateTaskDelivery(ctx, delivery)
+	}); err != nil {
+		return err
+	}
+	_, err := d.jobs.Enqueue(ctx, store.UserID(), JobDeliver, deliverPayload{delivery.ID}, time.Now())
+	return err
+}
+
+// deliver pushes one delivery. Errors retrying can't fix fail the delivery
+// right away; others are retried by the job runner.
+func (d *Deliverer) deliver(ctx context.Context, job jobs.Job) error {
+	var p deliverPayload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+
+	store, err := d.stores.Open(job.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	delivery, err := store.LoadTaskDelivery(ctx, p.DeliveryID)
+	if err != nil {
+		return err
+	}
+	if delivery == nil || delivery.Status != eventstore.TaskDeliveryPending {
+		return nil // purged, or settled by an earlier run
+	}
+
+	delivery.Attempts++
+	created, err := d.push(ctx, store, job.UserID, delivery)
+	if err != nil {
+		delivery.LastError = err.Error()
+		if Permanent(err) {
+			return d.settle(ctx, store, delivery, eventstore.TaskDeliveryFailed)
+		}
+		if err := store.WithTx(ctx, func(tx eventstore.Tx) error {
+			return tx.UpdateTaskDelivery(ctx, delivery)
+		}); err != nil {
+			log.Printf("Error recording task delivery attempt %s: %v", delivery.ID, err)
+		}
+		return err
+	}
+
+	delivery.ExternalID, delivery.ExternalURL, delivery.LastError = created.ID, created.URL, ""
+	return d.settle(ctx, store, delivery, eventstore.TaskDeliveryDelivered)
+}
+
+// push creates the delivery's task with the user's current sink settings
+func (d *Deliverer) push(ctx context.Context, store eventstore.Store, userID string, delivery *eventstore.TaskDelivery) (*Created, error) {
+	sink, err := Get(delivery.Sink)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := store.ListTaskSinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]string
+	for _, cfg := range configs {
+		if cfg.Name == delivery.Sink {
+			settings = cfg.Settings
+		}
+	}
+	if settings == nil {
+		return nil, fmt.Errorf("%w: %s is no longer connected", ErrInvalidSettings, delivery.Sink)
+	}
+
+	token, err := d.token(ctx, userID, sink.Account())
+	if err != nil {
+		return nil, err
+	}
+	return sink.Push(ctx, token.AccessToken, settings, Item{Title: delivery.Title, Notes: delivery.Notes, Due: delivery.Due})
+}
+
+// finished fails a delivery whose job ran out of attempts
+func (d *Deliverer) finished(ctx context.Context, job jobs.Job, jobErr error) {
+	if jobErr == nil {
+		return
+	}
+	var p deliverPayload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return
+	}
+
+	store, err := d.stores.Open(job.UserID)
+	if err != nil {
+		log.Printf("Error opening user DB for job %s: %v", job.ID, err)
+		return
+	}
+	defer store.Close()
+
+	delivery, err := store.LoadTaskDelivery(ctx, p.DeliveryID)
+	if err != nil || delivery == nil || delivery.Status != eventstore.TaskDeliveryPending {
+		return
+	}
+	delivery.LastError = jobErr.Error()
+	if err := d.settle(ctx, store, delivery, eventstore.TaskDeliveryFailed); err != nil {
+		log.Printf("Error failing task delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// settle saves a delivery's final status and queues its outcome event
+func (d *Deliverer) settle(ctx context.Context, store eventstore.Store, delivery *eventstore.TaskDelivery, status string) error {
+	delivery.Status = status
+	eventType := EventDelivered
+	if status == eventstore.TaskDeliveryFailed {
+		eventType = EventDeliveryFailed
+	}
+
+	event := map[string]any{
+		"user_id":            store.UserID(),
+		"ts":                 time.Now().Unix(),
+		"delivery_id":        delivery.ID,
+		"sink":               delivery.Sink,
+		"provider":           delivery.Provider,
+		"provider_thread_id": delivery.ProviderThreadID,
+		"workflow_id":        delivery.SourceID,
+		"title":              delivery.Title,
+		"attempts":           delivery.Attempts,
+	}
+	if delivery.ExternalID != "" {
+		event["external_id"] = delivery.ExternalID
+		event["external_url"] = delivery.ExternalURL
+	}
+	if delivery.LastError != "" {
+		event["error"] = delivery.LastError
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	return store.WithTx(ctx, func(tx eventstore.Tx) error {
+		if err := tx.UpdateTaskDelivery(ctx, delivery); err != nil {
+			return err
+		}
+		return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+			Subject:   fmt.Sprintf("user.%s.%s", store.UserID(), eventType),
+			EventType: eventType,
+			Payload:   payload,
+			// A retried delivery settles again with more attempts
+			MsgID:       fmt.Sprintf("%s|%s|%d", eventType, delivery.ID, delivery.Attempts),
+			TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package tasksink
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+func init() {
+	Register(&linear{baseURL: "https://api.linear.app"})
+}
+
+// linear creates issues through the Linear GraphQL API. Settings: team_id
+// (required), project_id (optional).
+type linear struct {
+	baseURL string
+}
+
+func (l *linear) Name() string           { return "linear" }
+func (l *linear) Account() auth.Provider { return auth.ProviderLinear }
+
+func (l *linear) Validate(settings map[string]string) error {
+	return checkSettings(settings, []string{"team_id"}, []string{"project_id"})
+}
+
+const linearIssueCreate = `mutation IssueCreate($input: IssueCreateInput!) {
+  issueCreate(input: $input) { success issue { id url } }
+}`
+
+func (l *linear) Push(ctx context.Context, token string, settings map[string]string, item Item) (*Created, error) {
+	input := map[string]any{
+		"teamId": settings["team_id"],
+		"title":  item.Title,
+	}
+	if item.Notes != "" {
+		input["description"] = item.Notes
+	}
+	if item.Due != "" {
+		input["dueDate"] = item.Due
+	}
+	if id := settings["project_id"]; id != "" {
+		input["projectId"] = id
+	}
+
+	var resp struct {
+		Data struct {
+			IssueCreate struct {
+				Success bool `json:"success"`
+				Issue   struct {
+					ID  string `json:"id"`
+					URL string `json:"url"`
+				} `json:"issue"`
+			} `json:"issueCreate"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	body := map[string]any{"query": linearIssueCreate, "variables": map[string]any{"input": input}}
+	if err := postJSON(ctx, l.Name(), l.baseURL+"/graphql", token, nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	// GraphQL reports rejected input with a 200
+	if len(resp.Errors) > 0 || !resp.Data.IssueCreate.Success {
+		msgs := []string{"issueCreate failed"}
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return nil, &StatusError{Sink: l.Name(), Status: http.StatusBadRequest, Body: strings.Join(msgs, ": ")}
+	}
+	issue := resp.Data.IssueCreate.Issue
+	if issue.ID == "" {
+		return nil, fmt.Errorf("linear returned no issue")
+	}
+	return &Created{ID: issue.ID, URL: issue.URL}, nil
+}
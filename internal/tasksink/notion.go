@@ -0,0 +1,68 @@
+package tasksink
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+func init() {
+	Register(&notion{baseURL: "https://api.notion.com"})
+}
+
+// notionVersion is the API version the requests are written against
+const notionVersion = "2022-06-28"
+
+// notion adds pages to a Notion tasks database. Settings: database_id
+// (required), title_property (default "Name") and due_property (a date
+// property; without it due dates are left out).
+type notion struct {
+	baseURL string
+}
+
+func (n *notion) Name() string           { return "notion" }
+func (n *notion) Account() auth.Provider { return auth.ProviderNotion }
+
+func (n *notion) Validate(settings map[string]string) error {
+	return checkSettings(settings, []string{"database_id"}, []string{"title_property", "due_property"})
+}
+
+func (n *notion) Push(ctx context.Context, token string, settings map[string]string, item Item) (*Created, error) {
+	titleProperty := settings["title_property"]
+	if titleProperty == "" {
+		titleProperty = "Name"
+	}
+	properties := map[string]any{
+		titleProperty: map[string]any{
+			"title": []any{map[string]any{"text": map[string]any{"content": item.Title}}},
+		},
+	}
+	if due := settings["due_property"]; due != "" && item.Due != "" {
+		properties[due] = map[string]any{"date": map[string]any{"start": item.Due}}
+	}
+
+	body := map[string]any{
+		"parent":     map[string]any{"database_id": settings["database_id"]},
+		"properties": properties,
+	}
+	if item.Notes != "" {
+		body["children"] = []any{map[string]any{
+			"object": "block",
+			"type":   "paragraph",
+			"paragraph": map[string]any{
+				"rich_text": []any{map[string]any{"type": "text", "text": map[string]any{"content": item.Notes}}},
+			},
+		}}
+	}
+
+	var resp struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	header := http.Header{"Notion-Version": {notionVersion}}
+	if err := postJSON(ctx, n.Name(), n.baseURL+"/v1/pages", token, header, body, &resp); err != nil {
+		return nil, err
+	}
+	return &Created{ID: resp.ID, URL: resp.URL}, nil
+}
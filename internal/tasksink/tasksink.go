@@ -0,0 +1,230 @@
+// Package tasksink pushes action items extracted from mail to external task
+// systems. Each system is a TaskSink; users connect one by linking its
+// account in BetterAuth and saving its settings. The Deliverer turns
+// tasks.extracted events into one delivery per item and connected sink, and
+// pushes each from a job so failures are retried.
+package tasksink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+// ErrUnknownSink is returned for task sink names nobody registered
+var ErrUnknownSink = errors.New("unknown task sink")
+
+// ErrInvalidSettings is returned when a sink's settings are incomplete
+var ErrInvalidSettings = errors.New("invalid task sink settings")
+
+// Item is one action item to create as a task
+type Item struct {
+	Title string `json:"title"`
+	Notes string `json:"notes,omitempty"`
+	Due   string `json:"due,omitempty"` // YYYY-MM-DD
+}
+
+// Created identifies the task a sink created
+type Created struct {
+	ID  string
+	URL string
+}
+
+// TaskSink creates tasks in one external system
+type TaskSink interface {
+	// Name identifies the sink in settings and deliveries
+	Name() string
+
+	// Account is the BetterAuth provider whose OAuth token Push gets
+	Account() auth.Provider
+
+	// Validate checks a user's settings when they connect the sink
+	Validate(settings map[string]string) error
+
+	// Push creates a task for item
+	Push(ctx context.Context, token string, settings map[string]string, item Item) (*Created, error)
+}
+
+var (
+	registry   = map[string]TaskSink{}
+	registryMu sync.RWMutex
+)
+
+// Register makes a sink available by name. Registering the same name twice
+// replaces the earlier sink.
+func Register(sink TaskSink) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[sink.Name()] = sink
+}
+
+// Get returns a registered sink
+func Get(name string) (TaskSink, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	sink, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSink, name)
+	}
+	return sink, nil
+}
+
+// Names lists the registered sinks
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maxTitle bounds task titles; agents sometimes return a paragraph
+const maxTitle = 250
+
+// Items reads the tasks of an extract_tasks output. Agents return either
+// plain strings or objects with a title (or task/text), optional notes (or
+// description) and an optional due date; anything else is skipped.
+func Items(tasks []json.RawMessage) []Item {
+	var items []Item
+	for _, raw := range tasks {
+		var item Item
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			item.Title = text
+		} else {
+			var obj map[string]any
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				continue
+			}
+			item.Title = firstString(obj, "title", "task", "text")
+			item.Notes = firstString(obj, "notes", "description")
+			item.Due = dueDate(firstString(obj, "due", "due_date"))
+		}
+
+		item.Title = strings.Join(strings.Fields(item.Title), " ")
+		if item.Title == "" {
+			continue
+		}
+		if len(item.Title) > maxTitle {
+			item.Title = strings.ToValidUTF8(item.Title[:maxTitle], "") + "…"
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func firstString(obj map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := obj[key].(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+// dueDate keeps the date of a YYYY-MM-DD or RFC 3339 due value
+func dueDate(s string) string {
+	if len(s) >= 10 {
+		if _, err := time.Parse(time.DateOnly, s[:10]); err == nil {
+			return s[:10]
+		}
+	}
+	return ""
+}
+
+// StatusError is a task system's error response
+type StatusError struct {
+	Sink   string
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Sink, e.Status, e.Body)
+}
+
+// Permanent reports whether retrying the request can't help: the account is
+// gone or the task system rejected it
+func Permanent(err error) bool {
+	if errors.Is(err, auth.ErrAccountNotConnected) || errors.Is(err, ErrUnknownSink) || errors.Is(err, ErrInvalidSettings) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status >= 400 && statusErr.Status < 500 &&
+			statusErr.Status != http.StatusRequestTimeout && statusErr.Status != http.StatusTooManyRequests
+	}
+	return false
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON sends body to url with the token and decodes the response into out
+func postJSON(ctx context.Context, sink, url, token string, header http.Header, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", sink, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", sink, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := strings.TrimSpace(string(respBody))
+		if len(msg) > 500 {
+			msg = strings.ToValidUTF8(msg[:500], "")
+		}
+		return &StatusError{Sink: sink, Status: resp.StatusCode, Body: msg}
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", sink, err)
+	}
+	return nil
+}
+
+// checkSettings rejects settings other than required and optional ones, and
+// missing required ones
+func checkSettings(settings map[string]string, required, optional []string) error {
+	for _, key := range required {
+		if strings.TrimSpace(settings[key]) == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidSettings, key)
+		}
+	}
+	for key := range settings {
+		if !slices.Contains(required, key) && !slices.Contains(optional, key) {
+			return fmt.Errorf("%w: unknown setting %s", ErrInvalidSettings, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package tasksink
+
+import (
+	"context"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+)
+
+func init() {
+	Register(&todoist{baseURL: "https://api.todoist.com"})
+}
+
+// todoist creates tasks through the Todoist REST API. Settings: project_id
+// (optional, default the inbox).
+type todoist struct {
+	baseURL string
+}
+
+func (t *todoist) Name() string           { return "todoist" }
+func (t *todoist) Account() auth.Provider { return auth.ProviderTodoist }
+
+func (t *todoist) Validate(settings map[string]string) error {
+	return checkSettings(settings, nil, []string{"project_id"})
+}
+
+func (t *todoist) Push(ctx context.Context, token string, settings map[string]string, item Item) (*Created, error) {
+	body := map[string]any{"content": item.Title}
+	if item.Notes != "" {
+		body["description"] = item.Notes
+	}
+	if item.Due != "" {
+		body["due_date"] = item.Due
+	}
+	if id := settings["project_id"]; id != "" {
+		body["project_id"] = id
+	}
+
+	var resp struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := postJSON(ctx, t.Name(), t.baseURL+"/rest/v2/tasks", token, nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return &Created{ID: resp.ID, URL: resp.URL}, nil
+}
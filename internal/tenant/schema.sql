@@ -0,0 +1,11 @@
+PRAGMA journal_mode=WAL;
+PRAGMA synchronous=NORMAL;
+PRAGMA busy_timeout=5000;
+
+-- The org each user's events are published under (org.{org_id}.user.*),
+-- recorded from the org_id claim of their JWT
+CREATE TABLE IF NOT EXISTS user_orgs (
+  user_id             TEXT PRIMARY KEY,
+  org_id              TEXT NOT NULL,
+  updated_at          INTEGER NOT NULL
+);
@@ -0,0 +1,125 @@
+// Package tenant maps users to the org (tenant) their events belong to in
+// multi-org deployments. The NATS publisher reads the mapping to route each
+// user's events to their org's subjects and stream.
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed schema.sql
+var schemaSQL string
+
+// cacheTTL is how long a lookup is trusted before reading the database
+// again, which bounds how long other processes take to see a change
+const cacheTTL = time.Minute
+
+// validOrgID is a single NATS subject token that is also valid in a stream
+// name
+var validOrgID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidOrgID reports whether id can be used as an org id
+func ValidOrgID(id string) bool {
+	return validOrgID.MatchString(id)
+}
+
+// Store keeps user→org assignments in a SQLite database shared by the API
+// and workers
+type Store struct {
+	DB *sql.DB
+
+	mu    sync.RWMutex
+	cache map[string]cached
+}
+
+type cached struct {
+	orgID string
+	at    time.Time
+}
+
+// Open opens or creates the tenants database
+func Open(dbPath string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if _, err := db.Exec(schemaSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+
+	return &Store{DB: db, cache: make(map[string]cached)}, nil
+}
+
+// Close closes the database connection
+func (s *Store) Close() error {
+	return s.DB.Close()
+}
+
+// OrgFor returns the org of a user, "" if they have none
+func (s *Store) OrgFor(ctx context.Context, userID string) (string, error) {
+	s.mu.RLock()
+	c, ok := s.cache[userID]
+	s.mu.RUnlock()
+	if ok && time.Since(c.at) < cacheTTL {
+		return c.orgID, nil
+	}
+
+	var orgID string
+	err := s.DB.QueryRowContext(ctx, `SELECT org_id FROM user_orgs WHERE user_id = ?`, userID).Scan(&orgID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to look up org of %s: %w", userID, err)
+	}
+	s.remember(userID, orgID)
+	return orgID, nil
+}
+
+// Assign records a user's org; an empty orgID removes them from their org.
+// It only writes when the assignment changed.
+func (s *Store) Assign(ctx context.Context, userID, orgID string) error {
+	if orgID != "" && !ValidOrgID(orgID) {
+		return fmt.Errorf("invalid org id %q", orgID)
+	}
+	if current, err := s.OrgFor(ctx, userID); err != nil {
+		return err
+	} else if current == orgID {
+		return nil
+	}
+
+	var err error
+	if orgID == "" {
+		_, err = s.DB.ExecContext(ctx, `DELETE FROM user_orgs WHERE user_id = ?`, userID)
+	} else {
+		_, err = s.DB.ExecContext(ctx, `
+			INSERT INTO user_orgs (user_id, org_id, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET org_id = excluded.org_id, updated_at = excluded.updated_at
+		`, userID, orgID, time.Now().Unix())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to assign org of %s: %w", userID, err)
+	}
+	s.remember(userID, orgID)
+	return nil
+}
+
+// remember caches a lookup
+func (s *Store) remember(userID, orgID string) {
+	s.mu.Lock()
+	s.cache[userID] = cached{orgID: orgID, at: time.Now()}
+	s.mu.Unlock()
+}
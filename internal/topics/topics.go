@@ -0,0 +1,427 @@
+// Package topics groups a user's recent mail into named topics: projects,
+// recurring threads of conversation, newsletters on one theme. The clusterer
+// runs k-means over the message embeddings (see internal/semantic), drops
+// clusters too small to mean anything, and asks the language model to name
+// the rest from their most central subjects, falling back to the subjects'
+// most common words.
+package topics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+)
+
+// Defaults for New
+const (
+	DefaultWindow      = 90 * 24 * time.Hour
+	DefaultMaxMessages = 2000
+)
+
+const (
+	minMessages    = 12 // fewer and the user's mail is left unclustered
+	minClusterSize = 3
+	maxClusters    = 25
+	iterations     = 20
+	mergeSimilar   = 0.85 // clusters whose centroids are closer are one topic
+	namingSamples  = 8    // central subjects shown to the model per cluster
+	maxKeywords    = 5
+)
+
+// Clusterer computes and stores topics
+type Clusterer struct {
+	stores      eventstore.Opener
+	llm         llm.Client
+	window      time.Duration
+	maxMessages int
+	now         func() time.Time
+}
+
+// New creates a clusterer over the newest maxMessages messages within window.
+// client must have an embedding model.
+func New(stores eventstore.Opener, client llm.Client, window time.Duration, maxMessages int) *Clusterer {
+	if maxMessages <= 0 {
+		maxMessages = DefaultMaxMessages
+	}
+	return &Clusterer{stores: stores, llm: client, window: window, maxMessages: maxMessages, now: time.Now}
+}
+
+// Run reclusters the users' mail and returns how many topics it stored. A
+// failed user doesn't stop the others.
+func (c *Clusterer) Run(ctx context.Context, userIDs []string) (int, error) {
+	stored := 0
+	var errs []error
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := c.runUser(ctx, userID)
+		stored += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+		}
+	}
+	return stored, errors.Join(errs...)
+}
+
+func (c *Clusterer) runUser(ctx context.Context, userID string) (int, error) {
+	store, err := c.stores.Open(userID)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	now := c.now()
+	model := c.llm.EmbeddingModel()
+	vectors, err := store.MessageVectors(ctx, model, now.Add(-c.window).Unix(), c.maxMessages)
+	if err != nil {
+		return 0, err
+	}
+
+	var topics []eventstore.Topic
+	if len(vectors) >= minMessages {
+		clusters := cluster(vectors, seed(userID))
+		c.name(ctx, clusters)
+		for _, cl := range clusters {
+			topics = append(topics, cl.topic(model, now))
+		}
+	}
+	return len(topics), store.ReplaceTopics(ctx, topics)
+}
+
+// seed makes a user's clustering repeatable
+func seed(userID string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(userID))
+	return int64(h.Sum64() >> 1)
+}
+
+// group is a cluster being built
+type group struct {
+	centroid []float64
+	members  []member
+	name     string
+	keywords []string
+}
+
+type member struct {
+	msg        *eventstore.MessageVector
+	similarity float64
+}
+
+// cluster runs spherical k-means (cosine similarity on unit vectors) with
+// k-means++ seeding and returns the clusters with at least minClusterSize
+// members, largest first, each sorted most central first
+func cluster(msgs []eventstore.MessageVector, seed int64) []*group {
+	// Vectors from one model share a length; skip strays from a bad row
+	dims := len(msgs[0].Vector)
+	var points [][]float64
+	var kept []*eventstore.MessageVector
+	for i := range msgs {
+		if len(msgs[i].Vector) != dims {
+			continue
+		}
+		points = append(points, normalize(msgs[i].Vector))
+		kept = append(kept, &msgs[i])
+	}
+
+	k := int(math.Round(math.Sqrt(float64(len(points)) / 2)))
+	k = max(2, min(k, maxClusters))
+
+	rng := rand.New(rand.NewSource(seed))
+	centroids := seedCentroids(points, k, rng)
+	assign := make([]int, len(points))
+	for iter := 0; iter < iterations; iter++ {
+		moved := false
+		for i, p := range points {
+			if best := nearest(p, centroids); best != assign[i] {
+				assign[i], moved = best, true
+			}
+		}
+		if !moved && iter > 0 {
+			break
+		}
+		centroids = recenter(points, assign, centroids)
+	}
+	centroids = merge(points, assign, centroids)
+
+	groups := make([]*group, len(centroids))
+	for j := range groups {
+		groups[j] = &group{centroid: centroids[j]}
+	}
+	for i, p := range points {
+		g := groups[assign[i]]
+		g.members = append(g.members, member{msg: kept[i], similarity: dot(p, g.centroid)})
+	}
+
+	var out []*group
+	for _, g := range groups {
+		if len(g.members) < minClusterSize {
+			continue
+		}
+		sort.SliceStable(g.members, func(i, j int) bool { return g.members[i].similarity > g.members[j].similarity })
+		out = append(out, g)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return len(out[i].members) > len(out[j].members) })
+	return out
+}
+
+// seedCentroids picks k starting centroids with k-means++: each next one is
+// drawn with probability proportional to its distance from the nearest
+// centroid so far
+func seedCentroids(points [][]float64, k int, rng *rand.Rand) [][]float64 {
+	centroids := [][]float64{points[rng.Intn(len(points))]}
+	dist := make([]float64, len(points))
+	for len(centroids) < k {
+		total := 0.0
+		for i, p := range points {
+			d := 1 - dot(p, centroids[nearest(p, centroids)])
+			dist[i] = max(d, 0) * max(d, 0)
+			total += dist[i]
+		}
+		if total == 0 {
+			break // fewer distinct points than k
+		}
+		r := rng.Float64() * total
+		i := 0
+		for ; i < len(points)-1 && r >= dist[i]; i++ {
+			r -= dist[i]
+		}
+		centroids = append(centroids, points[i])
+	}
+	return centroids
+}
+
+// merge joins clusters whose centroids are within mergeSimilar of each
+// other, closest pair first; k-means splits a large topic rather than leave a
+// centroid idle. Returns the recentered centroids.
+func merge(points [][]float64, assign []int, centroids [][]float64) [][]float64 {
+	for {
+		used := make([]bool, len(centroids))
+		for _, j := range assign {
+			used[j] = true
+		}
+		a, b, best := -1, -1, mergeSimilar
+		for i := range centroids {
+			for j := i + 1; j < len(centroids); j++ {
+				if used[i] && used[j] {
+					if sim := dot(centroids[i], centroids[j]); sim > best {
+						a, b, best = i, j, sim
+					}
+				}
+			}
+		}
+		if a < 0 {
+			return centroids
+		}
+		for i := range assign {
+			if assign[i] == b {
+				assign[i] = a
+			}
+		}
+		centroids = recenter(points, assign, centroids)
+	}
+}
+
+// recenter moves each centroid to the normalized mean of its points; a
+// centroid that lost all its points stays put
+func recenter(points [][]float64, assign []int, centroids [][]float64) [][]float64 {
+	sums := make([][]float64, len(centroids))
+	counts := make([]int, len(centroids))
+	for i, p := range points {
+		j := assign[i]
+		if sums[j] == nil {
+			sums[j] = make([]float64, len(p))
+		}
+		for d, v := range p {
+			sums[j][d] += v
+		}
+		counts[j]++
+	}
+	next := make([][]float64, len(centroids))
+	for j := range centroids {
+		if counts[j] == 0 {
+			next[j] = centroids[j]
+			continue
+		}
+		next[j] = unit(sums[j])
+	}
+	return next
+}
+
+func nearest(p []float64, centroids [][]float64) int {
+	best, bestSim := 0, math.Inf(-1)
+	for j, c := range centroids {
+		if sim := dot(p, c); sim > bestSim {
+			best, bestSim = j, sim
+		}
+	}
+	return best
+}
+
+func dot(a, b []float64) float64 {
+	var s float64
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func normalize(v []float32) []float64 {
+	out := make([]float64, len(v))
+	for i, x := range v {
+		out[i] = float64(x)
+	}
+	return unit(out)
+}
+
+func unit(v []float64) []float64 {
+	norm := math.Sqrt(dot(v, v))
+	if norm == 0 {
+		return v
+	}
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// topic converts a finished cluster into the stored topic
+func (g *group) topic(model string, now time.Time) eventstore.Topic {
+	t := eventstore.Topic{
+		ID:         uuid.NewString(),
+		Name:       g.name,
+		Keywords:   g.keywords,
+		Model:      model,
+		Size:       len(g.members),
+		ComputedAt: now.Unix(),
+	}
+	for _, m := range g.members {
+		t.LatestAt = max(t.LatestAt, m.msg.MsgDate)
+		t.Members = append(t.Members, eventstore.TopicMember{
+			EventID:    m.msg.EventID,
+			Provider:   m.msg.Provider,
+			Similarity: math.Round(m.similarity*1000) / 1000,
+		})
+	}
+	return t
+}
+
+// name gives every cluster keywords from its subjects, then asks the model
+// for names in one call. Clusters the model doesn't name (or every cluster,
+// if the call fails) are named after their keywords.
+func (c *Clusterer) name(ctx context.Context, groups []*group) {
+	if len(groups) == 0 {
+		return
+	}
+	for _, g := range groups {
+		g.keywords = keywords(g.members)
+	}
+
+	var prompt strings.Builder
+	for i, g := range groups {
+		fmt.Fprintf(&prompt, "Cluster %d:\n", i+1)
+		for _, m := range g.members[:min(namingSamples, len(g.members))] {
+			fmt.Fprintf(&prompt, "- %s\n", m.msg.Subject)
+		}
+		prompt.WriteString("\n")
+	}
+
+	reply, err := c.llm.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{Role: "system", Content: `You name clusters of related email by their subjects. For each cluster give a
+short name (2-5 words) for the project, theme or correspondent it is about, and
+up to five keywords. Reply with a JSON object:
+{"topics": [{"cluster": <n>, "name": "<name>", "keywords": ["<word>", ...]}]}`},
+			{Role: "user", Content: prompt.String()},
+		},
+		JSON:      true,
+		MaxTokens: 60 * len(groups),
+	})
+	if err == nil {
+		var parsed struct {
+			Topics []struct {
+				Cluster  int      `json:"cluster"`
+				Name     string   `json:"name"`
+				Keywords []string `json:"keywords"`
+			} `json:"topics"`
+		}
+		if llm.DecodeJSON(reply, &parsed) == nil {
+			for _, t := range parsed.Topics {
+				if t.Cluster < 1 || t.Cluster > len(groups) || strings.TrimSpace(t.Name) == "" {
+					continue
+				}
+				g := groups[t.Cluster-1]
+				g.name = strings.TrimSpace(t.Name)
+				if len(t.Keywords) > 0 {
+					g.keywords = t.Keywords[:min(maxKeywords, len(t.Keywords))]
+				}
+			}
+		}
+	}
+
+	for _, g := range groups {
+		if g.name != "" {
+			continue
+		}
+		g.name = "Untitled"
+		if len(g.keywords) > 0 {
+			g.name = strings.Join(g.keywords[:min(3, len(g.keywords))], ", ")
+		}
+	}
+}
+
+// keywords returns a cluster's most common subject words
+func keywords(members []member) []string {
+	counts := map[string]int{}
+	for _, m := range members {
+		seen := map[string]bool{}
+		for _, w := range strings.FieldsFunc(strings.ToLower(m.msg.Subject), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(w) < 3 || stopwords[w] || seen[w] {
+				continue
+			}
+			seen[w] = true
+			counts[w]++
+		}
+	}
+
+	words := make([]string, 0, len(counts))
+	for w, n := range counts {
+		if n >= 2 {
+			words = append(words, w)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > maxKeywords {
+		words = words[:maxKeywords]
+	}
+	return words
+}
+
+// stopwords are subject words that say nothing about a topic
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "you": true, "your": true, "with": true,
+	"from": true, "this": true, "that": true, "are": true, "our": true, "has": true,
+	"have": true, "was": true, "new": true, "now": true, "out": true, "not": true,
+	"fwd": true, "fw": true, "re": true, "aw": true, "about": true, "just": true,
+	"into": true, "will": true, "can": true, "all": true, "get": true, "its": true,
+}
@@ -0,0 +1,99 @@
+// Package translate attaches machine translations to mail not written in the
+// user's language. The projection here reads the language detected on ingest
+// (see internal/langdetect), asks the language model to translate the subject
+// and snippet, and stores the result on the message row, where the full-text
+// index, questions and context blocks pick it up.
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+)
+
+// Translator translates received mail into one target language
+type Translator struct {
+	stores eventstore.Opener
+	llm    llm.Client
+	target string
+}
+
+// New creates a translator into target (an ISO 639-1 code)
+func New(stores eventstore.Opener, client llm.Client, target string) *Translator {
+	return &Translator{stores: stores, llm: client, target: strings.ToLower(target)}
+}
+
+// message is the part of an email.received event the translator reads
+type message struct {
+	Provider          string `json:"provider"`
+	ProviderMessageID string `json:"provider_message_id"`
+	Subject           string `json:"subject"`
+	Snippet           string `json:"snippet"`
+	Language          string `json:"language"`
+	PayloadRef        string `json:"payload_ref"`
+}
+
+// Projection returns the projection that translates new mail. Translating a
+// message again replaces its translation.
+func (t *Translator) Projection() projection.Projection {
+	return projection.Projection{
+		Name:   "translations",
+		Events: []string{"email.received"},
+		Apply:  t.apply,
+	}
+}
+
+func (t *Translator) apply(ctx context.Context, ev projection.Event) error {
+	var msg message
+	if err := json.Unmarshal(ev.Data, &msg); err != nil || msg.ProviderMessageID == "" {
+		return nil // not ours to fix
+	}
+	if msg.PayloadRef != "" || msg.Language == "" || msg.Language == t.target {
+		return nil
+	}
+	if strings.TrimSpace(msg.Subject) == "" && strings.TrimSpace(msg.Snippet) == "" {
+		return nil
+	}
+
+	tr, err := t.Translate(ctx, msg.Language, msg.Subject, msg.Snippet)
+	if err != nil {
+		return err
+	}
+
+	store, err := t.stores.Open(ev.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.SaveTranslation(ctx, msg.Provider, msg.ProviderMessageID, *tr)
+}
+
+// Translate translates a subject and snippet from one language to the target
+func (t *Translator) Translate(ctx context.Context, from, subject, snippet string) (*eventstore.Translation, error) {
+	input, _ := json.Marshal(map[string]string{"subject": subject, "snippet": snippet})
+	reply, err := t.llm.Complete(ctx, llm.Request{
+		Messages: []llm.Message{
+			{Role: "system", Content: fmt.Sprintf(`You translate email text from the language with ISO 639-1 code %q into the
+language with code %q. Keep names, addresses, numbers and dates as they are.
+Reply with a JSON object: {"subject": "<translated subject>", "snippet": "<translated snippet>"}`, from, t.target)},
+			{Role: "user", Content: string(input)},
+		},
+		JSON:      true,
+		MaxTokens: 400,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("translate message: %w", err)
+	}
+
+	tr := eventstore.Translation{Language: t.target}
+	if err := llm.DecodeJSON(reply, &tr); err != nil {
+		return nil, fmt.Errorf("translate message: %w", err)
+	}
+	tr.Language = t.target
+	return &tr, nil
+}
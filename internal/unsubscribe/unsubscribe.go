@@ -0,0 +1,162 @@
+// Package unsubscribe suggests leaving mailing lists and newsletters the user
+// ignores. Lists come from the mailing_list pipeline stage (is_list); the
+// engagement signals are how many of a list's recent messages the user read,
+// flagged or replied to. A list is suggested once, with
+// subscription.unsubscribe_suggested; the user then unsubscribes in one click
+// (sync.Manager.Unsubscribe) or dismisses the suggestion.
+package unsubscribe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// EventSuggested is published once per list the user ignores
+const EventSuggested = "subscription.unsubscribe_suggested"
+
+// Defaults for New
+const (
+	DefaultWindow      = 90 * 24 * time.Hour
+	DefaultMinMessages = 5
+	DefaultMaxReadRate = 0.1
+)
+
+// Advisor finds ignored lists and publishes suggestions
+type Advisor struct {
+	stores      eventstore.Opener
+	window      time.Duration // engagement is measured over mail this recent
+	minMessages int64         // fewer messages in the window is too little to judge
+	maxReadRate float64       // read share at or below which a list is ignored
+}
+
+// New creates an advisor that suggests lists with at least minMessages in
+// window, a read rate of at most maxReadRate and nothing flagged or replied to
+func New(stores eventstore.Opener, window time.Duration, minMessages int, maxReadRate float64) *Advisor {
+	return &Advisor{stores: stores, window: window, minMessages: int64(minMessages), maxReadRate: maxReadRate}
+}
+
+// Method returns how a list can be left in one click (sync.UnsubscribeOneClick
+// or sync.UnsubscribeMailto), "" if it can't
+func Method(sub eventstore.Subscription) string {
+	targets := sync.ParseListUnsubscribe(sub.Unsubscribe)
+	switch {
+	case sub.OneClick && len(targets.HTTPS) > 0:
+		return sync.UnsubscribeOneClick
+	case len(targets.Mailto) > 0:
+		return sync.UnsubscribeMailto
+	}
+	return ""
+}
+
+// Ignored reports whether the user ignores a list, with its read rate
+func (a *Advisor) Ignored(sub eventstore.Subscription) (bool, float64) {
+	if sub.MessageCount == 0 {
+		return false, 0
+	}
+	readRate := float64(sub.MessageCount-sub.UnreadCount) / float64(sub.MessageCount)
+	ignored := sub.MessageCount >= a.minMessages && readRate <= a.maxReadRate &&
+		sub.FlaggedCount == 0 && sub.RepliedCount == 0
+	return ignored, readRate
+}
+
+// Suggest publishes suggestions for each of the users' ignored lists that
+// weren't suggested before, and returns how many it published. A failed user
+// doesn't stop the others.
+func (a *Advisor) Suggest(ctx context.Context, userIDs []string) (int, error) {
+	published := 0
+	var errs []error
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := a.suggestUser(ctx, userID)
+		published += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+		}
+	}
+	return published, errors.Join(errs...)
+}
+
+func (a *Advisor) suggestUser(ctx context.Context, userID string) (int, error) {
+	store, err := a.stores.Open(userID)
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+
+	now := time.Now()
+	subs, err := store.ListSubscriptions(ctx, now.Add(-a.window).Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, sub := range subs {
+		ignored, readRate := a.Ignored(sub)
+		method := Method(sub)
+		if !ignored || method == "" {
+			continue
+		}
+		created, err := a.publish(ctx, store, userID, sub, readRate, method, now)
+		if err != nil {
+			return published, err
+		}
+		if created {
+			published++
+		}
+	}
+	return published, nil
+}
+
+// publish records a suggestion and queues its event in one transaction,
+// unless the list was suggested or dismissed before
+func (a *Advisor) publish(ctx context.Context, store eventstore.Store, userID string, sub eventstore.Subscription, readRate float64, method string, now time.Time) (bool, error) {
+	payload, err := json.Marshal(map[string]any{
+		"user_id":         userID,
+		"ts":              now.Unix(),
+		"key":             sub.Key,
+		"list_id":         sub.ListID,
+		"name":            sub.Name,
+		"sender":          sub.Sender,
+		"message_count":   sub.MessageCount,
+		"read_rate":       readRate,
+		"window_days":     int(a.window / (24 * time.Hour)),
+		"last_message_at": sub.LastMessageAt,
+		"method":          method,
+	})
+	if err != nil {
+		return false, fmt.Errorf("encode event: %w", err)
+	}
+
+	var created bool
+	err = store.WithTx(ctx, func(tx eventstore.Tx) error {
+		var err error
+		created, err = tx.SuggestUnsubscribe(ctx, eventstore.UnsubscribeSuggestion{
+			Key:          sub.Key,
+			ListID:       sub.ListID,
+			Name:         sub.Name,
+			Sender:       sub.Sender,
+			MessageCount: sub.MessageCount,
+			ReadRate:     readRate,
+		})
+		if err != nil || !created {
+			return err
+		}
+		return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+			Subject:     fmt.Sprintf("user.%s.%s", userID, EventSuggested),
+			EventType:   EventSuggested,
+			Payload:     payload,
+			MsgID:       fmt.Sprintf("%s|%s", EventSuggested, sub.Key),
+			TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+		})
+	})
+	return created, err
+}
@@ -0,0 +1,497 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+)
+
+// JobKind is the job kind that runs workflow steps
+const JobKind = "workflow"
+
+// Job actions
+const (
+	actionRun        = ""           // run the instance's current step
+	actionTimeout    = "timeout"    // fail the instance if it is still waiting for an event
+	actionCompensate = "compensate" // undo a cancelled instance
+)
+
+// ErrFinished is returned when cancelling an instance that already finished
+var ErrFinished = errors.New("workflow already finished")
+
+// errNotReady makes a job that raced ahead of its instance's update retry
+var errNotReady = errors.New("workflow step not saved yet")
+
+// jobPayload is the payload of a workflow job
+type jobPayload struct {
+	WorkflowID string `json:"workflow_id"`
+	Step       int    `json:"step"`
+	Action     string `json:"action,omitempty"`
+}
+
+// Engine starts workflow instances and advances them. Steps run as jobs; each
+// job names the step it runs, and a job for a step the instance has already
+// moved past does nothing, so duplicate jobs and retries are harmless.
+type Engine struct {
+	stores eventstore.Opener
+	jobs   *jobs.Store
+	defs   map[string]Definition
+}
+
+// NewEngine creates an engine keeping instances in the users' event stores
+// and scheduling steps in jobStore
+func NewEngine(stores eventstore.Opener, jobStore *jobs.Store) *Engine {
+	return &Engine{stores: stores, jobs: jobStore, defs: make(map[string]Definition)}
+}
+
+// Register adds a workflow definition. Register before running jobs or
+// projections.
+func (e *Engine) Register(def Definition) {
+	if _, ok := e.defs[def.Name]; ok {
+		panic(fmt.Sprintf("workflow %q registered twice", def.Name))
+	}
+	if len(def.Steps) == 0 {
+		panic(fmt.Sprintf("workflow %q has no steps", def.Name))
+	}
+	e.defs[def.Name] = def
+}
+
+// Names returns the registered workflow names, sorted
+func (e *Engine) Names() []string {
+	names := make([]string, 0, len(e.defs))
+	for name := range e.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start creates an instance of a workflow and queues its first step
+func (e *Engine) Start(ctx context.Context, userID, name string, input map[string]any) (*eventstore.Workflow, error) {
+	def, ok := e.defs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownWorkflow, name)
+	}
+
+	store, err := e.stores.Open(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	return e.start(ctx, store, userID, def, input, "")
+}
+
+// start creates an instance, returning nil if triggerKey was already used
+func (e *Engine) start(ctx context.Context, store eventstore.Store, userID string, def Definition, input map[string]any, triggerKey string) (*eventstore.Workflow, error) {
+	if input == nil {
+		input = map[string]any{}
+	}
+	state, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("encode input: %w", err)
+	}
+
+	wf := &eventstore.Workflow{
+		ID:         uuid.NewString(),
+		Name:       def.Name,
+		Status:     StatusRunning,
+		State:      state,
+		TriggerKey: triggerKey,
+	}
+	created, err := store.CreateWorkflow(ctx, wf)
+	if err != nil || !created {
+		return nil, err
+	}
+
+	if _, err := e.jobs.Enqueue(ctx, userID, JobKind, jobPayload{WorkflowID: wf.ID}, time.Now()); err != nil {
+		wf.Status, wf.LastError = StatusFailed, err.Error()
+		if _, uerr := store.UpdateWorkflow(ctx, wf, StatusRunning, 0); uerr != nil {
+			log.Printf("Workflow %s: %v", wf.ID, uerr)
+		}
+		return nil, fmt.Errorf("failed to queue workflow: %w", err)
+	}
+	return wf, nil
+}
+
+// Cancel stops an instance and queues the compensation of its completed
+// steps. It returns nil if the instance doesn't exist.
+func (e *Engine) Cancel(ctx context.Context, userID, id string) (*eventstore.Workflow, error) {
+	store, err := e.stores.Open(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	// Retry if a step moves the instance on while we cancel it
+	for attempt := 0; attempt < 3; attempt++ {
+		wf, err := store.LoadWorkflow(ctx, id)
+		if err != nil || wf == nil {
+			return nil, err
+		}
+		switch wf.Status {
+		case StatusCancelling:
+			return wf, nil
+		case StatusCompleted, StatusFailed, StatusCancelled:
+			return wf, ErrFinished
+		}
+
+		fromStatus, step := wf.Status, wf.Step
+		wf.Status = StatusCancelling
+		clearWait(wf)
+		ok, err := e.transition(ctx, store, userID, wf, fromStatus, step,
+			jobPayload{WorkflowID: wf.ID, Step: step, Action: actionCompensate}, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return wf, nil
+		}
+	}
+	return nil, fmt.Errorf("workflow %s is changing too fast to cancel, try again", id)
+}
+
+// transition queues a job and then saves wf if it is still at fromStatus and
+// fromStep. The job is queued first so a saved transition always has one;
+// if the save loses a race the job is cancelled again.
+func (e *Engine) transition(ctx context.Context, store eventstore.Store, userID string, wf *eventstore.Workflow, fromStatus string, fromStep int, next jobPayload, runAt time.Time) (bool, error) {
+	job, err := e.jobs.Enqueue(ctx, userID, JobKind, next, runAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to queue workflow step: %w", err)
+	}
+	ok, err := store.UpdateWorkflow(ctx, wf, fromStatus, fromStep)
+	if err != nil || !ok {
+		if _, cerr := e.jobs.Cancel(ctx, userID, job.ID); cerr != nil {
+			log.Printf("Workflow %s: %v", wf.ID, cerr)
+		}
+	}
+	return ok, err
+}
+
+// RegisterJobs adds the workflow job kind to runner
+func (e *Engine) RegisterJobs(runner *jobs.Runner) {
+	runner.Register(JobKind, jobs.Kind{
+		Handler:  e.execute,
+		Timeout:  5 * time.Minute,
+		OnFinish: e.finished,
+	})
+}
+
+// execute runs one workflow job
+func (e *Engine) execute(ctx context.Context, job jobs.Job) error {
+	var p jobPayload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+
+	store, err := e.stores.Open(job.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	wf, err := store.LoadWorkflow(ctx, p.WorkflowID)
+	if err != nil {
+		return err
+	}
+	if wf == nil {
+		return nil
+	}
+	def, ok := e.defs[wf.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownWorkflow, wf.Name)
+	}
+
+	switch p.Action {
+	case actionCompensate:
+		if wf.Status != StatusCancelling {
+			return nil
+		}
+		return e.compensate(ctx, store, job.UserID, def, wf, StatusCancelled, "")
+
+	case actionTimeout:
+		if wf.Status != StatusWaiting || wf.Step != p.Step || wf.WaitEvent == "" {
+			return nil
+		}
+		return e.compensate(ctx, store, job.UserID, def, wf, StatusFailed,
+			fmt.Sprintf("timed out waiting for %s", wf.WaitEvent))
+	}
+
+	switch {
+	case p.Step < wf.Step:
+		return nil // stale
+	case p.Step > wf.Step:
+		return errNotReady
+	}
+	sleeping := wf.Status == StatusWaiting && wf.WaitEvent == ""
+	if wf.Status != StatusRunning && !sleeping {
+		return nil
+	}
+	return e.runStep(ctx, store, job.UserID, def, wf)
+}
+
+// runStep runs the instance's current step and moves it on. A step error is
+// returned, so the job retries the step.
+func (e *Engine) runStep(ctx context.Context, store eventstore.Store, userID string, def Definition, wf *eventstore.Workflow) error {
+	run, err := newRun(userID, wf, store)
+	if err != nil {
+		return err
+	}
+	fromStatus, step := wf.Status, wf.Step
+
+	next, err := def.Steps[step].Run(ctx, run)
+	if err != nil {
+		wf.LastError = err.Error()
+		if _, uerr := store.UpdateWorkflow(ctx, wf, fromStatus, step); uerr != nil {
+			log.Printf("Workflow %s: %v", wf.ID, uerr)
+		}
+		return fmt.Errorf("step %s: %w", def.Steps[step].Name, err)
+	}
+
+	// The event that resumed the instance belongs to this step
+	delete(run.state, eventKey)
+	if wf.State, err = json.Marshal(run.state); err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+	wf.Step++
+	wf.LastError = ""
+	clearWait(wf)
+
+	now := time.Now()
+	var ok bool
+	switch {
+	case next.done || wf.Step >= len(def.Steps):
+		wf.Status = StatusCompleted
+		ok, err = store.UpdateWorkflow(ctx, wf, fromStatus, step)
+
+	case next.waitEvent != "":
+		if !waitsFor(def, next.waitEvent) {
+			return fmt.Errorf("step %s waits for %s, which %s doesn't list in Events", def.Steps[step].Name, next.waitEvent, def.Name)
+		}
+		wf.Status = StatusWaiting
+		wf.WaitEvent, wf.WaitField, wf.WaitValue = next.waitEvent, next.waitField, next.waitValue
+		if next.timeout > 0 {
+			wf.WakeAt = now.Add(next.timeout).Unix()
+			ok, err = e.transition(ctx, store, userID, wf, fromStatus, step,
+				jobPayload{WorkflowID: wf.ID, Step: wf.Step, Action: actionTimeout}, now.Add(next.timeout))
+		} else {
+			ok, err = store.UpdateWorkflow(ctx, wf, fromStatus, step)
+		}
+
+	case next.sleep > 0:
+		wf.Status = StatusWaiting
+		wf.WakeAt = now.Add(next.sleep).Unix()
+		ok, err = e.transition(ctx, store, userID, wf, fromStatus, step,
+			jobPayload{WorkflowID: wf.ID, Step: wf.Step}, now.Add(next.sleep))
+
+	default:
+		wf.Status = StatusRunning
+		ok, err = e.transition(ctx, store, userID, wf, fromStatus, step,
+			jobPayload{WorkflowID: wf.ID, Step: wf.Step}, now)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Printf("Workflow %s: changed while step %s ran (cancelled?); dropping its result", wf.ID, def.Steps[step].Name)
+	}
+	return nil
+}
+
+// finished fails an instance whose step job gave up
+func (e *Engine) finished(ctx context.Context, job jobs.Job, jobErr error) {
+	if jobErr == nil {
+		return
+	}
+	var p jobPayload
+	if err := json.Unmarshal(job.Payload, &p); err != nil || p.Action != actionRun {
+		return
+	}
+
+	store, err := e.stores.Open(job.UserID)
+	if err != nil {
+		log.Printf("Error opening user DB for workflow %s: %v", p.WorkflowID, err)
+		return
+	}
+	defer store.Close()
+
+	wf, err := store.LoadWorkflow(ctx, p.WorkflowID)
+	if err != nil || wf == nil || wf.Step != p.Step {
+		return
+	}
+	if wf.Status != StatusRunning && wf.Status != StatusWaiting {
+		return
+	}
+	def := e.defs[wf.Name]
+	if err := e.compensate(ctx, store, job.UserID, def, wf, StatusFailed, jobErr.Error()); err != nil {
+		log.Printf("Workflow %s: %v", wf.ID, err)
+	}
+}
+
+// compensate runs the compensations of the completed steps in reverse and
+// finishes the instance with status. Compensation errors are kept in
+// LastError; they don't stop the remaining compensations.
+func (e *Engine) compensate(ctx context.Context, store eventstore.Store, userID string, def Definition, wf *eventstore.Workflow, status, reason string) error {
+	run, err := newRun(userID, wf, store)
+	if err != nil {
+		return err
+	}
+	fromStatus, step := wf.Status, wf.Step
+
+	errs := []string{}
+	if reason != "" {
+		errs = append(errs, reason)
+	}
+	for i := min(step, len(def.Steps)) - 1; i >= 0; i-- {
+		if def.Steps[i].Compensate == nil {
+			continue
+		}
+		run.step = i
+		if err := def.Steps[i].Compensate(ctx, run); err != nil {
+			errs = append(errs, fmt.Sprintf("compensate %s: %v", def.Steps[i].Name, err))
+		}
+	}
+
+	wf.Status = status
+	wf.LastError = strings.Join(errs, "; ")
+	clearWait(wf)
+	if _, err := store.UpdateWorkflow(ctx, wf, fromStatus, step); err != nil {
+		return err
+	}
+	log.Printf("Workflow %s (%s): %s after step %d", wf.ID, wf.Name, status, step)
+	return nil
+}
+
+// Projection routes user events to the engine: events of a definition's
+// Trigger start instances, and events matching a waiting instance resume it.
+// Register it with the projection engine after registering definitions.
+func (e *Engine) Projection() projection.Projection {
+	types := map[string]bool{}
+	for _, def := range e.defs {
+		if def.Trigger != "" {
+			types[def.Trigger] = true
+		}
+		for _, t := range def.Events {
+			types[t] = true
+		}
+	}
+	events := make([]string, 0, len(types))
+	for t := range types {
+		events = append(events, t)
+	}
+	sort.Strings(events)
+
+	return projection.Projection{
+		Name:   "workflows",
+		Events: events,
+		Apply:  e.route,
+	}
+}
+
+// route delivers one user event
+func (e *Engine) route(ctx context.Context, pev projection.Event) error {
+	ev := Event{UserID: pev.UserID, Type: pev.Type, ID: fmt.Sprint(pev.Sequence), Data: pev.Data}
+
+	store, err := e.stores.Open(ev.UserID)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := e.resume(ctx, store, ev); err != nil {
+		return err
+	}
+
+	for _, name := range e.Names() {
+		def := e.defs[name]
+		if def.Trigger != ev.Type {
+			continue
+		}
+		input := map[string]any{}
+		if def.Input != nil {
+			var ok bool
+			if input, ok = def.Input(ev); !ok {
+				continue
+			}
+		}
+		// Keyed by the event, so redelivery doesn't start a second instance
+		if _, err := e.start(ctx, store, ev.UserID, def, input, def.Name+":"+ev.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resume wakes the instances waiting for ev
+func (e *Engine) resume(ctx context.Context, store eventstore.Store, ev Event) error {
+	waiting, err := store.WaitingWorkflows(ctx, ev.Type)
+	if err != nil || len(waiting) == 0 {
+		return err
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(ev.Data, &payload); err != nil {
+		return nil // not an object; nothing can match
+	}
+
+	for i := range waiting {
+		wf := &waiting[i]
+		if wf.WaitField != "" && fmt.Sprint(payload[wf.WaitField]) != wf.WaitValue {
+			continue
+		}
+
+		state := map[string]json.RawMessage{}
+		if err := json.Unmarshal(wf.State, &state); err != nil {
+			return fmt.Errorf("decode workflow %s state: %w", wf.ID, err)
+		}
+		state[eventKey] = ev.Data
+		if wf.State, err = json.Marshal(state); err != nil {
+			return fmt.Errorf("encode workflow %s state: %w", wf.ID, err)
+		}
+		wf.Status = StatusRunning
+		clearWait(wf)
+
+		if _, err := e.transition(ctx, store, ev.UserID, wf, StatusWaiting, wf.Step,
+			jobPayload{WorkflowID: wf.ID, Step: wf.Step}, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newRun decodes an instance's state for a step
+func newRun(userID string, wf *eventstore.Workflow, store eventstore.Store) (*Run, error) {
+	state := map[string]json.RawMessage{}
+	if len(wf.State) > 0 {
+		if err := json.Unmarshal(wf.State, &state); err != nil {
+			return nil, fmt.Errorf("decode workflow %s state: %w", wf.ID, err)
+		}
+	}
+	return &Run{UserID: userID, Workflow: wf, Store: store, state: state, step: wf.Step}, nil
+}
+
+// clearWait clears an instance's timer and event wait
+func clearWait(wf *eventstore.Workflow) {
+	wf.WaitEvent, wf.WaitField, wf.WaitValue, wf.WakeAt = "", "", "", 0
+}
+
+// waitsFor reports whether def lists eventType in Events
+func waitsFor(def Definition, eventType string) bool {
+	for _, t := range def.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
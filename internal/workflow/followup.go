@@ -0,0 +1,214 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// EventTasksExtracted carries the action items extract_tasks found in a
+// thread, for task sinks (see internal/tasksink)
+const EventTasksExtracted = "tasks.extracted"
+
+// Agent task events. The engine requests work with workflow.task_requested;
+// an agent does it and publishes user.{user_id}.agent.task_completed with the
+// same task_id and its output.
+const (
+	EventTaskRequested = "workflow.task_requested"
+	EventTaskCompleted = "agent.task_completed"
+	EventTaskCancelled = "workflow.task_cancelled"
+)
+
+const (
+	agentTaskTimeout     = time.Hour
+	defaultFollowUpAfter = 72 * time.Hour
+)
+
+// taskResult is the payload of an agent.task_completed event
+type taskResult struct {
+	TaskID string         `json:"task_id"`
+	Output map[string]any `json:"output"`
+}
+
+// ThreadFollowUp summarizes a thread, extracts its tasks and, if there are
+// any, follows up when nobody replied within follow_up_after (default 72h).
+// Input: provider, thread_id, follow_up_after (a duration like "48h").
+func ThreadFollowUp() Definition {
+	return Definition{
+		Name:   "thread_follow_up",
+		Events: []string{EventTaskCompleted},
+		Steps: []Step{
+			{
+				Name:       "summarize",
+				Run:        requestTask("summarize_thread", nil),
+				Compensate: cancelTask,
+			},
+			{
+				Name:       "extract_tasks",
+				Run:        requestTask("extract_tasks", []string{"summary"}),
+				Compensate: cancelTask,
+			},
+			{
+				Name:       "schedule_follow_up",
+				Run:        scheduleFollowUp,
+				Compensate: cancelFollowUp,
+			},
+			{
+				Name: "follow_up",
+				Run:  followUp,
+			},
+		},
+	}
+}
+
+// requestTask returns a step that saves the output of the previous agent
+// task, asks an agent for the next one and waits for its reply
+func requestTask(task string, keep []string) func(ctx context.Context, run *Run) (Next, error) {
+	return func(ctx context.Context, run *Run) (Next, error) {
+		if err := saveTaskOutput(run, keep); err != nil {
+			return Next{}, err
+		}
+
+		input := map[string]any{}
+		for _, key := range []string{"provider", "thread_id", "summary"} {
+			var v any
+			if ok, err := run.Get(key, &v); err != nil {
+				return Next{}, err
+			} else if ok {
+				input[key] = v
+			}
+		}
+
+		taskID := run.TaskID()
+		if err := run.Publish(ctx, EventTaskRequested, map[string]any{
+			"task_id": taskID,
+			"task":    task,
+			"input":   input,
+		}); err != nil {
+			return Next{}, err
+		}
+		return WaitFor(EventTaskCompleted, "task_id", taskID, agentTaskTimeout), nil
+	}
+}
+
+// saveTaskOutput copies the keep fields of the agent reply into the state
+func saveTaskOutput(run *Run, keep []string) error {
+	if len(keep) == 0 {
+		return nil
+	}
+	var result taskResult
+	if ok, err := run.Event(&result); err != nil || !ok {
+		return err
+	}
+	for _, key := range keep {
+		if v, ok := result.Output[key]; ok {
+			if err := run.Set(key, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cancelTask tells agents to drop the task a step requested
+func cancelTask(ctx context.Context, run *Run) error {
+	return run.Publish(ctx, EventTaskCancelled, map[string]any{
+		"task_id": run.TaskID(),
+		"reason":  run.Workflow.Status,
+	})
+}
+
+// scheduleFollowUp saves and publishes the extracted tasks and sleeps until
+// the follow-up is due; without tasks there is nothing to follow up
+func scheduleFollowUp(ctx context.Context, run *Run) (Next, error) {
+	if err := saveTaskOutput(run, []string{"tasks"}); err != nil {
+		return Next{}, err
+	}
+	var tasks []any
+	if _, err := run.Get("tasks", &tasks); err != nil {
+		return Next{}, err
+	}
+	if len(tasks) == 0 {
+		return Done(), nil
+	}
+
+	var provider, threadID any
+	if _, err := run.Get("provider", &provider); err != nil {
+		return Next{}, err
+	}
+	if _, err := run.Get("thread_id", &threadID); err != nil {
+		return Next{}, err
+	}
+	if err := run.Publish(ctx, EventTasksExtracted, map[string]any{
+		"provider":  provider,
+		"thread_id": threadID,
+		"tasks":     tasks,
+	}); err != nil {
+		return Next{}, err
+	}
+
+	after := defaultFollowUpAfter
+	var raw string
+	if ok, err := run.Get("follow_up_after", &raw); err != nil {
+		return Next{}, err
+	} else if ok {
+		if after, err = time.ParseDuration(raw); err != nil || after <= 0 {
+			return Next{}, fmt.Errorf("invalid follow_up_after %q", raw)
+		}
+	}
+
+	now := time.Now()
+	due := now.Add(after)
+	if err := run.Set("scheduled_at", now.Unix()); err != nil {
+		return Next{}, err
+	}
+	if err := run.Publish(ctx, "workflow.follow_up_scheduled", map[string]any{
+		"thread_id": threadID,
+		"tasks":     tasks,
+		"due_at":    due.Unix(),
+	}); err != nil {
+		return Next{}, err
+	}
+	return Sleep(after), nil
+}
+
+// cancelFollowUp withdraws a scheduled follow-up
+func cancelFollowUp(ctx context.Context, run *Run) error {
+	return run.Publish(ctx, "workflow.follow_up_cancelled", map[string]any{})
+}
+
+// followUp publishes workflow.follow_up_due unless someone replied to the
+// thread since the follow-up was scheduled
+func followUp(ctx context.Context, run *Run) (Next, error) {
+	var provider, threadID string
+	if _, err := run.Get("provider", &provider); err != nil {
+		return Next{}, err
+	}
+	if _, err := run.Get("thread_id", &threadID); err != nil {
+		return Next{}, err
+	}
+	var tasks []any
+	if _, err := run.Get("tasks", &tasks); err != nil {
+		return Next{}, err
+	}
+
+	msgs, err := run.Store.ThreadMessages(ctx, provider, threadID)
+	if err != nil {
+		return Next{}, err
+	}
+	var scheduledAt int64
+	if _, err := run.Get("scheduled_at", &scheduledAt); err != nil {
+		return Next{}, err
+	}
+	for _, m := range msgs {
+		if m.Folder != "sent" && m.MsgDate > scheduledAt {
+			return Done(), nil
+		}
+	}
+
+	return Done(), run.Publish(ctx, "workflow.follow_up_due", map[string]any{
+		"provider":  provider,
+		"thread_id": threadID,
+		"tasks":     tasks,
+	})
+}
@@ -0,0 +1,164 @@
+// Package workflow runs durable multi-step workflows (sagas) for a user, such
+// as "summarize a thread, extract its tasks, schedule a follow-up" carried out
+// by AI agents. Instances are stored in the user's event store; each step runs
+// as a job, so progress survives restarts and failed steps are retried. A step
+// can continue, sleep, or wait for a user event from NATS. When a step fails
+// for good, or the user cancels, the compensations of the completed steps run
+// in reverse.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+)
+
+// Instance statuses
+const (
+	StatusRunning    = "running"    // a step is queued or running
+	StatusWaiting    = "waiting"    // sleeping or waiting for an event
+	StatusCompleted  = "completed"  // every step ran
+	StatusFailed     = "failed"     // a step failed for good; completed steps were compensated
+	StatusCancelling = "cancelling" // cancelled by the user, compensations queued
+	StatusCancelled  = "cancelled"
+)
+
+// ErrUnknownWorkflow is returned when starting a workflow that isn't
+// registered
+var ErrUnknownWorkflow = errors.New("unknown workflow")
+
+// Definition is a registered workflow
+type Definition struct {
+	Name  string
+	Steps []Step
+
+	// Events lists the event types its steps WaitFor
+	Events []string
+
+	// Trigger, if set, starts an instance for every user event of this type
+	// (once per event). Input builds the instance's input from the event;
+	// returning false skips the event.
+	Trigger string
+	Input   func(ev Event) (map[string]any, bool)
+}
+
+// Step is one unit of a workflow
+type Step struct {
+	Name string
+	Run  func(ctx context.Context, run *Run) (Next, error)
+
+	// Compensate undoes the step when a later step fails or the instance is
+	// cancelled. Optional.
+	Compensate func(ctx context.Context, run *Run) error
+}
+
+// Next tells the engine what happens after a step
+type Next struct {
+	done      bool
+	sleep     time.Duration
+	waitEvent string
+	waitField string
+	waitValue string
+	timeout   time.Duration
+}
+
+// Continue runs the next step right away
+func Continue() Next { return Next{} }
+
+// Done completes the instance, skipping any remaining steps
+func Done() Next { return Next{done: true} }
+
+// Sleep runs the next step after d
+func Sleep(d time.Duration) Next { return Next{sleep: d} }
+
+// WaitFor runs the next step when the user receives an event of eventType
+// whose payload field equals value, failing the instance after timeout. The
+// next step reads the event with Run.Event.
+func WaitFor(eventType, field, value string, timeout time.Duration) Next {
+	return Next{waitEvent: eventType, waitField: field, waitValue: value, timeout: timeout}
+}
+
+// Event is a user event delivered to the engine
+type Event struct {
+	UserID string
+	Type   string
+	ID     string // unique per event (stream sequence)
+	Data   json.RawMessage
+}
+
+// Run gives a step access to its instance
+type Run struct {
+	UserID   string
+	Workflow *eventstore.Workflow
+	Store    eventstore.Store // the user's store, for reads and publishing
+
+	state map[string]json.RawMessage
+	step  int // the step running or being compensated
+}
+
+// Get decodes a state value (an input or an earlier step's output) into v.
+// It returns false if the key is unset.
+func (r *Run) Get(key string, v any) (bool, error) {
+	raw, ok := r.state[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return true, fmt.Errorf("decode %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// Set stores a state value for later steps. It is saved with the step's
+// result.
+func (r *Run) Set(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", key, err)
+	}
+	r.state[key] = raw
+	return nil
+}
+
+// Event decodes the payload of the event that ended the previous step's
+// WaitFor into v
+func (r *Run) Event(v any) (bool, error) {
+	return r.Get(eventKey, v)
+}
+
+// TaskID identifies the step of the instance, for correlating agent replies.
+// A compensation sees the id of the step it undoes.
+func (r *Run) TaskID() string {
+	return fmt.Sprintf("%s:%d", r.Workflow.ID, r.step)
+}
+
+// Publish queues a user event through the store's outbox. Retries of a step
+// publish the same message id, so NATS deduplicates them.
+func (r *Run) Publish(ctx context.Context, eventType string, payload map[string]any) error {
+	payload["workflow_id"] = r.Workflow.ID
+	payload["workflow"] = r.Workflow.Name
+	payload["user_id"] = r.UserID
+	payload["ts"] = time.Now().Unix()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	return r.Store.WithTx(ctx, func(tx eventstore.Tx) error {
+		return tx.AppendOutbox(ctx, eventstore.OutboxEntry{
+			Subject:     fmt.Sprintf("user.%s.%s", r.UserID, eventType),
+			EventType:   eventType,
+			Payload:     data,
+			MsgID:       fmt.Sprintf("%s|%s|%d", eventType, r.Workflow.ID, r.step),
+			TraceParent: natsjs.TraceParent(natsjs.EnsureTrace(ctx)),
+		})
+	})
+}
+
+// eventKey holds the event that resumed a waiting instance
+const eventKey = "_event"
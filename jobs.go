@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// System job kinds. System jobs belong to no user (empty user id).
+const (
+	jobBlobLifecycle = "blob_lifecycle" // delete blobs past their BLOB_LIFECYCLE age
+	jobPruneJobs     = "prune_jobs"     // delete old finished one-off jobs
+)
+
+// finishedJobRetention is how long done, failed and cancelled jobs stay
+// listed before prune_jobs deletes them
+const finishedJobRetention = 30 * 24 * time.Hour
+
+// registerSystemJobs registers the recurring maintenance jobs with runner.
+// blobStore may be nil.
+func registerSystemJobs(ctx context.Context, runner *jobs.Runner, store *jobs.Store, blobStore blob.Store, rules []blob.LifecycleRule) error {
+	runner.Register(jobPruneJobs, jobs.Kind{
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			n, err := store.PruneFinished(ctx, time.Now().Add(-finishedJobRetention))
+			if n > 0 {
+				log.Printf("Jobs: pruned %d finished jobs", n)
+			}
+			return err
+		},
+	})
+	if _, err := store.EnsureRecurring(ctx, "", jobPruneJobs, jobPruneJobs, "@daily", nil); err != nil {
+		return err
+	}
+
+	// Registered even without a blob store, so a leftover job doesn't sit
+	// unclaimed
+	runner.Register(jobBlobLifecycle, jobs.Kind{
+		Timeout: 30 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			if blobStore == nil {
+				return nil
+			}
+			n, err := blob.Sweep(ctx, blobStore, rules, time.Now())
+			if n > 0 {
+				log.Printf("Blob lifecycle: deleted %d expired blobs", n)
+			}
+			return err
+		},
+	})
+	if blobStore == nil || len(rules) == 0 {
+		return nil
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobBlobLifecycle, jobBlobLifecycle, "@hourly", nil)
+	return err
+}
+
+// connectedUsers lists the users with at least one connected inbox, for jobs
+// that sweep every user
+func connectedUsers(ctx context.Context, configs *syncconfig.Store) ([]string, error) {
+	all, err := configs.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	seen := map[string]bool{}
+	for _, cfg := range all {
+		if !seen[cfg.UserID] {
+			seen[cfg.UserID] = true
+			users = append(users, cfg.UserID)
+		}
+	}
+	return users, nil
+}
@@ -2,32 +2,82 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Martian-dev/ai-brain-infra/internal/attachments"
+	"github.com/Martian-dev/ai-brain-infra/internal/audit"
 	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/calendar"
+	"github.com/Martian-dev/ai-brain-infra/internal/chaos"
+	"github.com/Martian-dev/ai-brain-infra/internal/enrich"
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
 	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
-	"github.com/Martian-dev/ai-brain-infra/internal/providers/gmail"
-	"github.com/Martian-dev/ai-brain-infra/internal/providers/outlook"
-	"github.com/Martian-dev/ai-brain-infra/internal/store"
+	"github.com/Martian-dev/ai-brain-infra/internal/nlquery"
+	"github.com/Martian-dev/ai-brain-infra/internal/projection"
+	"github.com/Martian-dev/ai-brain-infra/internal/providers/archive"
+	"github.com/Martian-dev/ai-brain-infra/internal/ragcontext"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
+	"github.com/Martian-dev/ai-brain-infra/internal/retention"
+	"github.com/Martian-dev/ai-brain-infra/internal/search"
+	"github.com/Martian-dev/ai-brain-infra/internal/semantic"
+	"github.com/Martian-dev/ai-brain-infra/internal/shard"
+	"github.com/Martian-dev/ai-brain-infra/internal/slowlog"
 	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+	"github.com/Martian-dev/ai-brain-infra/internal/tasksink"
+	"github.com/Martian-dev/ai-brain-infra/internal/tenant"
+	"github.com/Martian-dev/ai-brain-infra/internal/topics"
+	"github.com/Martian-dev/ai-brain-infra/internal/translate"
+	"github.com/Martian-dev/ai-brain-infra/internal/workflow"
 	"github.com/gin-gonic/gin"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
 	jwtVerifier *auth.JWTVerifier
 	syncManager *sync.Manager
+	scheduler   *sync.Scheduler // nil unless service tokens are configured
+	auditLog    *audit.Logger
+	eventStores eventstore.Opener  // mail and generic events, outbox, sync state
+	reporter    errreport.Reporter = errreport.Nop{}
+	projections *projection.Store  // projection positions and read models
+	tenants     *tenant.Store      // user→org assignments; nil unless NATS_TENANCY=org
 )
 
+// maxImportSize bounds uploaded mail archives for POST /mail/import
+const maxImportSize = 1 << 30
+
 type EventRequest struct {
 	Type string `json:"type" binding:"required"`
 	Data string `json:"data" binding:"required"`
 }
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "issue-service-token" {
+		os.Exit(issueServiceToken(os.Args[2:]))
+	}
+
+	// --mode=api|worker|all: the API and sync workers can run separately
+	mode, err := parseRunMode(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("✓ Run mode: %s", mode)
+	if mode == modeBench {
+		os.Exit(runBench())
+	}
+
 	// Create data directory if it doesn't exist
 	if err := os.MkdirAll("data/users", 0755); err != nil {
 		log.Fatal(err)
@@ -39,106 +89,629 @@ func main() {
 		jwksURL = "http://localhost:3000/api/auth/jwks"
 	}
 
-	// Initialize JWT verifier with JWKS caching
-	var err error
-	jwtVerifier, err = auth.NewJWTVerifier(jwksURL)
+	// Slow SQL statement and provider call logging
+	if err := slowlog.ConfigureFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Fault injection for resilience testing (CHAOS_MODE, never in production)
+	chaosConfig, err := chaos.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if chaosConfig != nil {
+		chaos.Enable(chaosConfig)
+		log.Printf("⚠ CHAOS MODE: injecting faults (%s)", chaosConfig)
+	}
+
+	// Dependencies may come up after us; retry, then optionally start degraded
+	startupWait, startDegraded, err := startupSettings()
 	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Initialize JWT verifier with JWKS caching (workers serve no user requests)
+	if mode.servesAPI() {
+		err = retryStartup("JWKS", startupWait, func() error {
+			var err error
+			jwtVerifier, err = auth.NewJWTVerifier(jwksURL)
+			return err
+		})
+	}
+	switch {
+	case !mode.servesAPI():
+	case err == nil:
+		log.Printf("✓ JWT verifier initialized with JWKS from: %s", jwksURL)
+	case startDegraded:
+		if jwtVerifier, err = auth.NewLazyJWTVerifier(jwksURL); err != nil {
+			log.Fatalf("Failed to initialize JWT verifier: %v", err)
+		}
+		log.Printf("⚠ JWKS unavailable, starting degraded (requests get 503 until keys load): %s", jwksURL)
+	default:
 		log.Fatalf("Failed to initialize JWT verifier: %v", err)
 	}
-	log.Printf("✓ JWT verifier initialized with JWKS from: %s", jwksURL)
+	if v := os.Getenv("JWT_VERIFY_CACHE_TTL"); v != "" && jwtVerifier != nil {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 || ttl > auth.MaxVerifyCacheTTL {
+			log.Fatalf("Invalid JWT_VERIFY_CACHE_TTL %q: want 0 to %s", v, auth.MaxVerifyCacheTTL)
+		}
+		jwtVerifier.SetVerifyCacheTTL(ttl)
+		log.Printf("✓ JWT verification cache: %s", ttl)
+	}
+	// How long the last fetched keys are trusted while the JWKS endpoint is
+	// down (0: indefinitely)
+	if v := os.Getenv("JWKS_MAX_STALENESS"); v != "" && jwtVerifier != nil {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid JWKS_MAX_STALENESS %q: want a duration like 24h, or 0", v)
+		}
+		jwtVerifier.SetMaxStaleness(d)
+	}
 
 	// Initialize NATS publisher
 	natsURL := os.Getenv("NATS_URL")
 	if natsURL == "" {
 		natsURL = "nats://localhost:4222"
 	}
-	
-	publisher, err := natsjs.NewPublisher(natsURL)
-	if err != nil {
+
+	// Single-binary installs can run NATS in-process instead
+	if os.Getenv("NATS_EMBEDDED") == "true" {
+		listen := os.Getenv("NATS_EMBEDDED_LISTEN")
+		if listen == "" {
+			listen = "127.0.0.1:4222"
+		}
+		embedded, err := natsjs.StartEmbedded(natsjs.EmbeddedConfig{Dir: filepath.Join("data", "nats"), Listen: listen})
+		if err != nil {
+			log.Fatalf("Failed to start embedded NATS: %v", err)
+		}
+		defer embedded.Shutdown()
+		natsURL = embedded.URL()
+		log.Printf("✓ Embedded NATS with JetStream: %s (data/nats)", natsURL)
+	}
+
+	var publisher *natsjs.Publisher
+	err = retryStartup("NATS", startupWait, func() error {
+		var err error
+		publisher, err = natsjs.NewPublisher(natsURL)
+		return err
+	})
+	switch {
+	case err == nil:
+		log.Printf("✓ NATS publisher: %s", natsURL)
+	case startDegraded:
+		if publisher, err = natsjs.NewLazyPublisher(natsURL); err != nil {
+			log.Fatalf("Failed to initialize NATS publisher: %v", err)
+		}
+		log.Printf("⚠ NATS unavailable, starting degraded (events queue in the outbox): %s", natsURL)
+	default:
 		log.Fatalf("Failed to initialize NATS publisher: %v", err)
 	}
 	defer publisher.Close()
-	log.Printf("✓ NATS publisher: %s", natsURL)
+
+	// Multi-org isolation: each org's events on org.{org_id}.user.* in
+	// their own stream
+	switch v := os.Getenv("NATS_TENANCY"); v {
+	case "":
+	case "org":
+		tenants, err = tenant.Open(filepath.Join("data", "tenants.db"))
+		if err != nil {
+			log.Fatalf("Failed to open tenants store: %v", err)
+		}
+		defer tenants.Close()
+		publisher.SetTenants(tenants)
+		log.Printf("✓ NATS tenancy: per-org subjects and streams")
+	default:
+		log.Fatalf("Invalid NATS_TENANCY %q: want org or unset", v)
+	}
+
+	// Error reporting for runner failures, panics and 5xx responses
+	reporter, err = errreport.FromEnv(publisher)
+	if err != nil {
+		log.Fatalf("Invalid error reporter configuration: %v", err)
+	}
+	publisher.SetErrorReporter(reporter)
+	if v := os.Getenv("ERROR_REPORTERS"); v != "" {
+		log.Printf("✓ Error reporting: %s", v)
+	}
 
 	// Initialize BetterAuth client for OAuth tokens
 	authServerURL := os.Getenv("BETTER_AUTH_URL")
 	if authServerURL == "" {
 		authServerURL = "http://localhost:3000"
 	}
-	
+
 	authClient := auth.NewBetterAuthClient(authServerURL)
 	log.Printf("✓ BetterAuth client: %s", authServerURL)
 
-	// Provider factory
-	providerFactory := func(ctx context.Context, token *auth.Token, userID string, provider sync.ProviderName) (sync.MailProvider, error) {
-		switch provider {
-		case sync.ProviderGoogle:
-			return gmail.New(ctx, token)
-		case sync.ProviderMicrosoft:
-			return outlook.New(ctx, token, userID)
-		default:
-			return nil, nil
+	// User storage: one database per user, or one shared database
+	eventStores, err = openStores()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer eventStores.Close()
+	if eventStores.Shared() {
+		log.Printf("✓ Storage: shared database")
+	} else {
+		log.Printf("✓ Storage: per-user databases")
+	}
+
+	// Replication of the per-user databases to a standby location; a promoted
+	// standby restores them before anything opens them
+	replicator, err := newReplicator(eventStores)
+	if err != nil {
+		log.Fatalf("Invalid replication configuration: %v", err)
+	}
+	if replicator != nil {
+		log.Printf("✓ Replicating user databases to %s", os.Getenv("REPLICA_STORE"))
+	}
+	if err := promoteReplicas(context.Background(), replicator); err != nil {
+		log.Fatalf("Failed to promote replica: %v", err)
+	}
+
+	// Simulated mail provider for local development, connectable as "fake"
+	if devMode() {
+		if err := registerFakeProvider(); err != nil {
+			log.Fatal(err)
 		}
 	}
 
 	// Initialize sync manager
 	syncManager = sync.NewManager(
-		filepath.Join("data", "users"),
+		eventStores,
 		authClient,
 		publisher,
-		providerFactory,
+		sync.RegisteredProviders,
 	)
+	syncManager.SetErrorReporter(reporter)
+	if v := os.Getenv("SYNC_LAG_SLO"); v != "" {
+		slo, err := time.ParseDuration(v)
+		if err != nil || slo <= 0 {
+			log.Fatalf("Invalid SYNC_LAG_SLO %q: want a positive duration like 15m", v)
+		}
+		syncManager.SetLagSLO(slo)
+	}
+	dispatchConcurrency, dispatchPolicy, err := outboxDispatchFairness()
+	if err != nil {
+		log.Fatal(err)
+	}
+	syncManager.SetDispatchFairness(dispatchConcurrency, dispatchPolicy)
+
+	// Provider timeouts (PROVIDER_TIMEOUT_LIST/GET/DELTA per call,
+	// PROVIDER_TIMEOUT_START for starting a sync; 0 disables)
+	timeouts := sync.DefaultTimeouts
+	for env, dst := range map[string]*time.Duration{
+		"PROVIDER_TIMEOUT_LIST":  &timeouts.List,
+		"PROVIDER_TIMEOUT_GET":   &timeouts.Get,
+		"PROVIDER_TIMEOUT_DELTA": &timeouts.Delta,
+		"PROVIDER_TIMEOUT_START": &timeouts.Start,
+	} {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				log.Fatalf("Invalid %s %q: want a duration like 30s", env, v)
+			}
+			*dst = d
+		}
+	}
+	syncManager.SetProviderTimeouts(timeouts)
+
+	// Provider rate limits (RATE_LIMIT_<PROVIDER> overrides the adapter's defaults)
+	for _, provider := range sync.Providers() {
+		env := "RATE_LIMIT_" + strings.ToUpper(string(provider.Name))
+		limits, err := ratelimit.ParseLimits(os.Getenv(env), provider.RateLimits)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", env, err)
+		}
+		syncManager.SetRateLimits(provider.Name, limits)
+		log.Printf("✓ Rate limits (%s): %s", provider.Name, limits)
+	}
 	log.Printf("✓ Sync manager ready")
 
+	// Event transformation pipeline (comma-separated stage names)
+	pipeline, err := sync.ParsePipeline(os.Getenv("EVENT_PIPELINE"))
+	if err != nil {
+		log.Fatalf("Invalid EVENT_PIPELINE: %v", err)
+	}
+	syncManager.SetPipeline(pipeline)
+	log.Printf("✓ Event pipeline: %s", strings.Join(pipeline.Stages(), ", "))
+
+	// Fields of published events (EVENT_PAYLOAD_FIELDS keeps only the listed
+	// ones, EVENT_PAYLOAD_EXCLUDE drops fields); storage keeps them all
+	payloadPolicy, err := sync.ParsePayloadPolicy(os.Getenv("EVENT_PAYLOAD_FIELDS"), os.Getenv("EVENT_PAYLOAD_EXCLUDE"))
+	if err != nil {
+		log.Fatalf("Invalid event payload fields: %v", err)
+	}
+	syncManager.SetPayloadPolicy(payloadPolicy)
+	if dropped := payloadPolicy.Dropped(); len(dropped) > 0 {
+		log.Printf("✓ Event payload: without %s", strings.Join(dropped, ", "))
+	}
+
+	// Blob storage for attachments and oversized event payloads (optional)
+	blobStore, err := newBlobStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize blob store: %v", err)
+	}
+	blobRules, err := blob.ParseLifecycle(os.Getenv("BLOB_LIFECYCLE"))
+	if err != nil {
+		log.Fatalf("Invalid BLOB_LIFECYCLE: %v", err)
+	}
+	if blobStore != nil {
+		syncManager.SetBlobStore(blobStore)
+		log.Printf("✓ Blob store: %s", os.Getenv("BLOB_STORE"))
+	}
+
+	// Imported attachments kept for text extraction (needs the blob store)
+	if blobStore != nil {
+		policy, err := attachmentPolicy()
+		if err != nil {
+			log.Fatal(err)
+		}
+		syncManager.SetAttachmentPolicy(policy)
+	}
+
+	// Tiered storage: mail past ARCHIVE_AFTER_DAYS moves to the blob store;
+	// message reads merge it back in
+	archiver, err := newArchiver(eventStores, blobStore)
+	if err != nil {
+		log.Fatalf("Invalid archive configuration: %v", err)
+	}
+	if archiver != nil {
+		eventStores = archiver.Opener()
+		log.Printf("✓ Archiving mail older than %s days to the blob store", os.Getenv("ARCHIVE_AFTER_DAYS"))
+	}
+
+	// Sync configs: connected inboxes, run by workers (and resumed after restarts)
+	syncConfigs, err := syncconfig.Open(filepath.Join("data", "sync_config.db"))
+	if err != nil {
+		log.Fatalf("Failed to open sync config store: %v", err)
+	}
+	defer syncConfigs.Close()
+	syncManager.SetAssignments(syncConfigs, notifyAssignments(publisher))
+	syncManager.SetRemoteSyncs(!mode.runsSyncs())
+	if settings, err := syncManager.Settings(context.Background()); err != nil {
+		log.Printf("⚠ Sync settings not loaded, using the startup configuration: %v", err)
+	} else {
+		syncManager.ApplySettings(settings)
+	}
+
+	// Follow-up reminders for threads the user is waiting on
+	followUps, err := newFollowUpTracker(eventStores)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Relationship scores on contacts, an input to importance at ingest
+	scorer, err := newRelationshipScorer(eventStores)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Unsubscribe suggestions for lists the user ignores
+	advisor, err := newUnsubscribeAdvisor(eventStores)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Language model for questions about mail; embeddings power semantic search
+	llmClient, err := newLLMClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var queries *nlquery.Engine
+	var (
+		indexer    *semantic.Indexer
+		backfiller *semantic.Backfiller
+		clusterer  *topics.Clusterer
+	)
+	if llmClient != nil {
+		queries = nlquery.New(llmClient)
+		if llmClient.EmbeddingModel() != "" {
+			indexer = semantic.NewIndexer(eventStores, llmClient)
+			if backfiller, err = newEmbeddingBackfiller(eventStores, llmClient); err != nil {
+				log.Fatalf("Failed to configure embedding backfill: %v", err)
+			}
+			if clusterer, err = newTopicClusterer(eventStores, llmClient); err != nil {
+				log.Fatalf("Failed to configure topics: %v", err)
+			}
+		}
+	}
+
+	// Scheduled jobs: deferred mail actions and recurring maintenance. Jobs
+	// are leased, so every worker can share data/jobs.db.
+	jobStore, err := jobs.Open(filepath.Join("data", "jobs.db"))
+	if err != nil {
+		log.Fatalf("Failed to open jobs store: %v", err)
+	}
+	defer jobStore.Close()
+
+	// Event-type TTLs, enforced by the retention janitor job
+	retentionStore, err := retention.Open(filepath.Join("data", "retention.db"))
+	if err != nil {
+		log.Fatalf("Failed to open retention store: %v", err)
+	}
+	defer retentionStore.Close()
+
+	// Enrichment outputs are labelled with ENRICHMENT_VERSION so admins can
+	// re-enrich stored mail and compare versions
+	enrichVersion, err := enrichmentVersion()
+	if err != nil {
+		log.Fatalf("Failed to configure enrichment: %v", err)
+	}
+
+	jobRunner := jobs.NewRunner(jobStore, shard.WorkerID())
+	jobRunner.SetErrorReporter(reporter)
+	var enricher *enrich.Worker
+	if mode.runsSyncs() {
+		// Enrichment: events derived from received mail (comma-separated
+		// enricher names, default all), run by a projection registered below
+		enricher, err = enrich.New(eventStores, blobStore, os.Getenv("ENRICHERS"))
+		if err != nil {
+			log.Fatalf("Invalid ENRICHERS: %v", err)
+		}
+		enricher.SetVersion(enrichVersion)
+		registerReenrichJob(jobRunner, jobStore, enricher)
+
+		if err := registerSystemJobs(context.Background(), jobRunner, jobStore, blobStore, blobRules); err != nil {
+			log.Fatalf("Failed to register system jobs: %v", err)
+		}
+		if err := registerRetentionJob(context.Background(), jobRunner, jobStore, retentionStore, eventStores, syncConfigs); err != nil {
+			log.Fatalf("Failed to register retention: %v", err)
+		}
+		if err := registerReplicationJob(context.Background(), jobRunner, jobStore, replicator); err != nil {
+			log.Fatalf("Failed to register replication: %v", err)
+		}
+		verifier, err := newPublishVerifier(eventStores, publisher, reporter)
+		if err != nil {
+			log.Fatalf("Failed to configure outbox verification: %v", err)
+		}
+		if err := registerOutboxVerifyJob(context.Background(), jobRunner, jobStore, verifier, syncConfigs); err != nil {
+			log.Fatalf("Failed to register outbox verification: %v", err)
+		}
+		if err := registerArchiveJob(context.Background(), jobRunner, jobStore, archiver); err != nil {
+			log.Fatalf("Failed to register archiving: %v", err)
+		}
+		if err := registerFollowUpJob(context.Background(), jobRunner, jobStore, followUps, syncConfigs); err != nil {
+			log.Fatalf("Failed to register follow-ups: %v", err)
+		}
+		if err := registerContactScoreJob(context.Background(), jobRunner, jobStore, scorer, syncConfigs); err != nil {
+			log.Fatalf("Failed to register contact scoring: %v", err)
+		}
+		if err := registerUnsubscribeJob(context.Background(), jobRunner, jobStore, advisor, syncConfigs); err != nil {
+			log.Fatalf("Failed to register unsubscribe suggestions: %v", err)
+		}
+		if backfiller != nil {
+			if err := registerEmbeddingBackfillJobs(context.Background(), jobRunner, jobStore, backfiller, syncConfigs); err != nil {
+				log.Fatalf("Failed to register embedding backfill: %v", err)
+			}
+		}
+		if blobStore != nil {
+			registerAttachmentJob(jobRunner, jobStore, attachments.New(eventStores, blobStore, indexer, 0))
+		}
+		if clusterer != nil {
+			if err := registerTopicJob(context.Background(), jobRunner, jobStore, clusterer, syncConfigs); err != nil {
+				log.Fatalf("Failed to register topics: %v", err)
+			}
+		}
+	}
+
+	// Audit log for privileged access (service tokens, admin actions)
+	auditLog, err = audit.NewLogger(filepath.Join("data", "audit.log"))
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	// Service tokens for internal workers (optional)
+	var serviceTokens *auth.ServiceTokenIssuer
+	if secret := os.Getenv("SERVICE_TOKEN_SECRET"); secret != "" {
+		serviceTokens, err = auth.NewServiceTokenIssuer([]byte(secret))
+		if err != nil {
+			log.Fatalf("Failed to initialize service tokens: %v", err)
+		}
+		log.Printf("✓ Service tokens enabled for /internal routes")
+
+		// Scheduled actions run without a user request, so they need service
+		// tokens to fetch provider tokens from BetterAuth
+		syncManager.SetServiceTokens(serviceTokens)
+
+		scheduler = sync.NewScheduler(syncManager, jobStore)
+		scheduler.Register(jobRunner)
+	}
+
+	// Workflows: multi-step agent pipelines whose steps run as jobs and
+	// resume on user events (routed by a projection, registered below)
+	workflows := workflow.NewEngine(eventStores, jobStore)
+	workflows.Register(workflow.ThreadFollowUp())
+
+	// Task sinks: extracted action items pushed to Todoist, Linear or Notion.
+	// Deliveries run without a user request, so they need service tokens.
+	var taskSinks *tasksink.Deliverer
+	if serviceTokens != nil {
+		taskSinks = tasksink.New(eventStores, jobStore, taskTokens(authClient, serviceTokens))
+	}
+
+	if mode.runsSyncs() {
+		workflows.RegisterJobs(jobRunner)
+		if taskSinks != nil {
+			taskSinks.Register(jobRunner)
+		}
+		go jobRunner.Run(context.Background())
+		log.Printf("✓ Job runner: %s", strings.Join(jobRunner.Kinds(), ", "))
+	}
+
+	// Projections: read models built from the USER_EVENTS stream
+	projections, err = projection.Open(filepath.Join("data", "projections.db"))
+	if err != nil {
+		log.Fatalf("Failed to open projections store: %v", err)
+	}
+	defer projections.Close()
+	projectionEngine := projection.NewEngine(publisher, projections)
+	if v := os.Getenv("PROJECTION_SNAPSHOT_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			log.Fatalf("Invalid PROJECTION_SNAPSHOT_INTERVAL %q: want a duration like 24h, 0 disables", v)
+		}
+		projectionEngine.SetSnapshotInterval(d)
+	}
+	projectionEngine.Register(projection.Activity(projections))
+	if mode.runsSyncs() {
+		projectionEngine.Register(workflows.Projection())
+
+		projectionEngine.Register(enricher.Projection())
+		log.Printf("✓ Enrichers: %s (version %s)", strings.Join(enricher.Names(), ", "), enricher.Version())
+
+		if taskSinks != nil {
+			projectionEngine.Register(taskSinks.Projection())
+		} else {
+			log.Printf("⚠ SERVICE_TOKEN_SECRET not set: action items are not pushed to task sinks")
+		}
+
+		// Meeting proposals, kept for context and calendar readers
+		projectionEngine.Register(calendar.Projection(eventStores))
+
+		switch {
+		case llmClient == nil:
+			log.Printf("⚠ LLM_API_KEY not set: POST /query is disabled")
+		case indexer != nil:
+			projectionEngine.Register(indexer.Projection())
+		}
+
+		// Machine translations of mail not in TRANSLATE_TO (optional)
+		if to := os.Getenv("TRANSLATE_TO"); to != "" {
+			if llmClient == nil {
+				log.Fatalf("TRANSLATE_TO needs a language model (LLM_API_KEY)")
+			}
+			if len(to) != 2 {
+				log.Fatalf("Invalid TRANSLATE_TO %q: want an ISO 639-1 code like en", to)
+			}
+			projectionEngine.Register(translate.New(eventStores, llmClient, to).Projection())
+		}
+	}
+
+	var membership *shard.Membership
+	switch {
+	case mode.runsSyncs() && serviceTokens != nil:
+		if membership, err = startWorker(context.Background(), publisher, syncManager, syncConfigs); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("✓ Sync worker running")
+	case mode == modeWorker:
+		log.Fatalf("Worker mode requires SERVICE_TOKEN_SECRET to fetch provider tokens")
+	case mode == modeAll:
+		log.Printf("⚠ SERVICE_TOKEN_SECRET not set: syncs run only while connected here and don't resume after a restart")
+	}
+
+	if mode.runsSyncs() {
+		// One worker runs the projections; another takes over if it leaves
+		if membership != nil {
+			projectionEngine.SetLeader(func() bool { return membership.Owns(projectionsLeaderKey) })
+		}
+		go projectionEngine.Run(context.Background())
+		log.Printf("✓ Projections: %s", strings.Join(projectionEngine.Names(), ", "))
+	}
+
 	// Set Gin to release mode for production (can be overridden with GIN_MODE env var)
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	r := gin.Default()
+	// Structured access log with request ids and redacted credentials/PII
+	accessLogCfg, err := accessLogSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := gin.New()
+	r.Use(releaseUsers(), requestID(), accessLog(accessLogCfg), gin.CustomRecovery(recoverPanic))
 
 	// Health check endpoint - no auth required
-	r.GET("/health", func(c *gin.Context) {
-		stats := jwtVerifier.GetCacheStats()
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"service": "ai-brain-api",
-			"jwks_cache": stats,
-		})
-	})
+	health := &healthChecker{
+		mode:       mode,
+		publisher:  publisher,
+		authClient: authClient,
+		usersRoot:  filepath.Join("data", "users"),
+	}
+	r.GET("/health", health.handle)
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// Workers only serve /health
+	if !mode.servesAPI() {
+		log.Printf("🚀 AI Brain sync worker starting (health on port %s)", port)
+		log.Fatal(r.Run(":" + port))
+	}
+
+	// Per-user throttle on generic event writes
+	eventWrites, err := newEventWriteLimiter()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Internal routes - service tokens only
+	if serviceTokens != nil {
+		registerInternalRoutes(r, serviceTokens, auditLog, eventWrites)
+	}
 
 	// Protected routes - all require JWT authentication
 	authorized := r.Group("/")
 	authorized.Use(jwtAuthMiddleware())
 
+	if blobStore != nil {
+		registerBlobRoutes(r, authorized, blobStore)
+	}
+
+	// Admin support routes - JWT role admin
+	offboarding := &offboarder{
+		configs:    syncConfigs,
+		publisher:  publisher,
+		blobs:      blobStore,
+		archiver:   archiver,
+		replicator: replicator,
+		archiveDir: filepath.Join("data", "offboarded"),
+	}
+	registerAdminRoutes(authorized, auditLog, projectionEngine, retentionStore, syncConfigs, offboarding, jobStore, enrichVersion)
+
+	registerWorkflowRoutes(authorized, workflows)
+	registerFollowUpRoutes(authorized, followUps)
+	registerSubscriptionRoutes(authorized)
+	registerContactMergeRoutes(authorized)
+	registerSenderRuleRoutes(authorized)
+	registerOutboxRoutes(authorized)
+	registerAckRoutes(authorized)
+	registerProgressRoutes(authorized)
+	registerTaskRoutes(authorized, taskSinks, authClient)
+	registerConnectionRoutes(authorized, authClient, syncConfigs)
+	registerQueryRoutes(authorized, queries)
+	registerEmbeddingRoutes(authorized, backfiller)
+	registerTopicRoutes(authorized, clusterer)
+	registerContextRoutes(authorized, ragcontext.New(llmClient))
+	registerAttachmentRoutes(authorized)
+
 	// Store event endpoint
-	authorized.POST("/events", func(c *gin.Context) {
+	authorized.POST("/events", eventWriteLimit(eventWrites), func(c *gin.Context) {
 		var req EventRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, invalidRequest(err))
 			return
 		}
 
 		// Get user from context (set by middleware)
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+			respondError(c, errUnauthenticated)
 			return
 		}
 
 		authUser := user.(*auth.User)
-		
-		// Use user ID for storage (not username)
-		userStore, err := store.NewUserStore(filepath.Join("data", "users"), authUser.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		defer userStore.Close()
 
-		event, err := userStore.StoreEvent(req.Type, req.Data)
+		// Use user ID for storage (not username); the event is published to
+		// user.{id}.{type} through the outbox
+		event, err := storeUserEvent(c.Request.Context(), authUser.ID, req, eventSourceAPI)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
@@ -152,34 +725,89 @@ func main() {
 		// Get user from context
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+			respondError(c, errUnauthenticated)
 			return
 		}
 
 		authUser := user.(*auth.User)
 
 		// Use user ID for storage
-		userStore, err := store.NewUserStore(filepath.Join("data", "users"), authUser.ID)
+		reader, err := openEventReader(authUser.ID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		defer userStore.Close()
+		defer reader.Close()
 
-		events, err := userStore.GetEvents(eventType)
+		events, err := reader.GetEvents(c.Request.Context(), eventType)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, events)
 	})
 
+	// Stream events as newline-delimited JSON
+	authorized.GET("/events/export", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		filter := eventstore.EventFilter{Type: c.Query("type")}
+		for param, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if v := c.Query(param); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					respondError(c, invalidParam(param, param+" must be RFC3339"))
+					return
+				}
+				*dst = t
+			}
+		}
+		if v := c.Query("after_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				respondError(c, invalidParam("after_id", "after_id must be an integer"))
+				return
+			}
+			filter.AfterID = id
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+
+		// Flush periodically so clients see data as it's read (chunked transfer)
+		enc := json.NewEncoder(c.Writer)
+		written := 0
+		err = reader.ExportEvents(c.Request.Context(), filter, func(event eventstore.Event) error {
+			if err := enc.Encode(event); err != nil {
+				return err
+			}
+			if written++; written%500 == 0 {
+				c.Writer.Flush()
+			}
+			return c.Request.Context().Err()
+		})
+		if err != nil && c.Request.Context().Err() == nil {
+			// Headers are gone; report the failure as a final line
+			log.Printf("export for user %s failed: %v", authUser.ID, err)
+			_ = enc.Encode(errInternal)
+		}
+		c.Writer.Flush()
+	})
+
 	// Get current user info endpoint
 	authorized.GET("/me", func(c *gin.Context) {
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+			respondError(c, errUnauthenticated)
 			return
 		}
 
@@ -187,15 +815,27 @@ func main() {
 	})
 
 	// Mail sync endpoints
-	
+
 	// Connect mail - BetterAuth already has OAuth tokens
 	authorized.POST("/mail/connect", func(c *gin.Context) {
-		var req struct {
-			Provider string `json:"provider" binding:"required"`
-		}
-
+		var req connectRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, invalidRequest(err))
+			return
+		}
+		inboxID, err := parseInboxID(req.InboxID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		opts, err := req.options()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		access, err := req.access()
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 
@@ -203,41 +843,47 @@ func main() {
 		authUser := user.(*auth.User)
 
 		// Map provider
-		var syncProvider sync.ProviderName
-		switch req.Provider {
-		case "google", "GOOGLE":
-			syncProvider = sync.ProviderGoogle
-		case "microsoft", "MICROSOFT":
-			syncProvider = sync.ProviderMicrosoft
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported provider"})
+		syncProvider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
 			return
 		}
 
 		// Get JWT from header
-		jwt := c.GetHeader("Authorization")
+		jwt := bearerToken(c)
 		if jwt == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+			respondError(c, errTokenMissing)
 			return
 		}
-		jwt = jwt[7:] // Remove "Bearer "
 
 		// Start sync - tokens fetched from BetterAuth automatically
 		config := sync.InboxConfig{
 			UserID:   authUser.ID,
-			InboxID:  "primary",
+			InboxID:  inboxID,
 			Provider: syncProvider,
 			UserJWT:  jwt,
+			Options:  opts,
+			Access:   access,
 		}
 
-		if err := syncManager.StartSync(context.Background(), config); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		started, err := syncManager.Connect(c.Request.Context(), config)
+		if err != nil {
+			respondError(c, scopeError(err))
 			return
 		}
 
+		if !started {
+			c.JSON(http.StatusAccepted, gin.H{
+				"message":  "sync assigned to a worker",
+				"provider": req.Provider,
+				"inbox_id": inboxID,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"message":  "sync started",
 			"provider": req.Provider,
+			"inbox_id": inboxID,
 		})
 	})
 
@@ -246,57 +892,813 @@ func main() {
 		user, _ := c.Get("user")
 		authUser := user.(*auth.User)
 
-		running := syncManager.GetRunningSyncs()
-		var userSyncs []string
-		for _, key := range running {
-			if len(key) > len(authUser.ID) && key[:len(authUser.ID)] == authUser.ID {
-				userSyncs = append(userSyncs, key)
-			}
+		userSyncs := syncManager.GetRunningSyncs(authUser.ID)
+
+		// Per-provider state and lag, for alerting on syncs that report
+		// HOOKED but have fallen behind
+		store, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		states, err := store.SyncStates(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		now := time.Now()
+		inboxes := make([]inboxStatus, 0, len(states))
+		for _, st := range states {
+			inboxes = append(inboxes, newInboxStatus(authUser.ID, st, now))
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"user_id":       authUser.ID,
-			"running_syncs": userSyncs,
+			"user_id":         authUser.ID,
+			"running_syncs":   userSyncs,
+			"inboxes":         inboxes,
+			"lag_slo_seconds": int64(syncManager.LagSLO().Seconds()),
 		})
 	})
 
-	// Stop mail sync
-	authorized.POST("/mail/disconnect", func(c *gin.Context) {
-		var req struct {
-			Provider string `json:"provider" binding:"required"`
+	// One provider's sync state: status, cursor, last sync, last error and
+	// failures since the last successful sync
+	authorized.GET("/mail/status/:provider", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(c.Param("provider"))
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		store, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		st, err := store.SyncState(c.Request.Context(), string(provider))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if st == nil {
+			respondError(c, notFound("provider has never synced"))
+			return
+		}
+		c.JSON(http.StatusOK, newInboxStatus(authUser.ID, *st, time.Now()))
+	})
+
+	// Run an incremental sync now instead of at the next poll, e.g. when the
+	// user knows a mail just arrived
+	authorized.POST("/mail/sync-now", func(c *gin.Context) {
+		var req struct {
+			Provider string `json:"provider" binding:"required"`
+			InboxID  string `json:"inbox_id"` // default "primary"
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+		inboxID, err := parseInboxID(req.InboxID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		if err := syncManager.SyncNow(authUser.ID, inboxID, provider); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "sync requested",
+			"provider": req.Provider,
+			"inbox_id": inboxID,
+		})
+	})
+
+	// Stop mail sync
+	authorized.POST("/mail/disconnect", func(c *gin.Context) {
+		var req struct {
+			Provider string `json:"provider" binding:"required"`
+			InboxID  string `json:"inbox_id"` // default "primary"
+			Revoke   bool   `json:"revoke"`   // revoke the OAuth token via BetterAuth
+			Purge    bool   `json:"purge"`    // delete synced data for this provider
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		inboxID, err := parseInboxID(req.InboxID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		config := sync.InboxConfig{
+			UserID:   authUser.ID,
+			InboxID:  inboxID,
+			Provider: provider,
+			UserJWT:  bearerToken(c),
+		}
+
+		result, err := syncManager.Disconnect(c.Request.Context(), config, sync.DisconnectOptions{
+			Revoke: req.Revoke,
+			Purge:  req.Purge,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "mail sync stopped",
+			"result":  result,
+		})
+	})
+
+	// Check provider token health
+	authorized.GET("/mail/token-status", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(c.Query("provider"))
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		jwt := bearerToken(c)
+		if jwt == "" {
+			respondError(c, errTokenMissing)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+		defer cancel()
+
+		status, err := syncManager.CheckToken(ctx, jwt, authUser.ID, provider)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, status)
+	})
+
+	// List the synced provider folder tree (Outlook)
+	authorized.GET("/mail/folders", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(c.Query("provider"))
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		folders, err := eventStore.ListFolders(c.Request.Context(), string(provider))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"provider": provider,
+			"folders":  folders,
+		})
+	})
+
+	// Select or deselect a folder for sync
+	authorized.PUT("/mail/folders/:folder_id", func(c *gin.Context) {
+		var req struct {
+			Provider string `json:"provider" binding:"required"`
+			Selected *bool  `json:"selected" binding:"required"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		eventStore, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		if err := eventStore.SetFolderSelected(c.Request.Context(), string(provider), c.Param("folder_id"), *req.Selected); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"folder_id": c.Param("folder_id"),
+			"selected":  *req.Selected,
+		})
+	})
+
+	// Mailing lists and newsletters the user receives
+	authorized.GET("/mail/subscriptions", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		subs, err := eventStore.ListSubscriptions(c.Request.Context(), 0)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"subscriptions": subs,
+		})
+	})
+
+	// Send mail through the connected provider
+	authorized.POST("/mail/send", func(c *gin.Context) {
+		var req struct {
+			Provider         string     `json:"provider" binding:"required"`
+			To               []string   `json:"to"`
+			Cc               []string   `json:"cc"`
+			Bcc              []string   `json:"bcc"`
+			Subject          string     `json:"subject"`
+			Body             string     `json:"body"`
+			HTML             bool       `json:"html"`
+			ReplyToMessageID string     `json:"reply_to_message_id"` // provider message id
+			SendAt           *time.Time `json:"send_at"`             // schedule instead of sending now
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		if len(req.To)+len(req.Cc)+len(req.Bcc) == 0 && req.ReplyToMessageID == "" {
+			respondError(c, badRequest("at least one recipient is required"))
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		jwt := bearerToken(c)
+		if jwt == "" {
+			respondError(c, errTokenMissing)
+			return
+		}
+
+		msg := sync.OutgoingMessage{
+			To:               req.To,
+			Cc:               req.Cc,
+			Bcc:              req.Bcc,
+			Subject:          req.Subject,
+			Body:             req.Body,
+			HTML:             req.HTML,
+			ReplyToMessageID: req.ReplyToMessageID,
+		}
+
+		// Send later
+		if req.SendAt != nil && req.SendAt.After(time.Now()) {
+			if scheduler == nil {
+				respondError(c, errSchedulerDisabled)
+				return
+			}
+			job, err := scheduler.SendLater(c.Request.Context(), authUser.ID, provider, msg, *req.SendAt)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			c.JSON(http.StatusAccepted, gin.H{"scheduled": job})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		result, err := syncManager.SendMail(ctx, jwt, authUser.ID, provider, msg)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	})
+
+	// Execute a write-back action (read/unread, archive, labels, move) on a message
+	authorized.POST("/mail/messages/:id/actions", func(c *gin.Context) {
+		var req struct {
+			Provider    string   `json:"provider" binding:"required"`
+			Action      string   `json:"action" binding:"required"`
+			Labels      []string `json:"labels"`      // add_labels/remove_labels
+			Destination string   `json:"destination"` // move: canonical folder or provider folder/label id
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		action := sync.MessageAction{
+			Type:        sync.ActionType(req.Action),
+			Labels:      req.Labels,
+			Destination: req.Destination,
+		}
+		if err := action.Validate(); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		jwt := bearerToken(c)
+		if jwt == "" {
+			respondError(c, errTokenMissing)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		change, err := syncManager.ApplyAction(ctx, jwt, authUser.ID, provider, c.Param("id"), action)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		messageID := change.MessageID
+		if change.NewMessageID != "" {
+			messageID = change.NewMessageID
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"provider_message_id": messageID,
+			"action":              req.Action,
+			"labels":              change.CurrentLabels,
+			"folder":              change.Folder,
+			"is_read":             change.IsRead,
+		})
+	})
+
+	// Snooze a message: archive now, move back to the inbox at `until`
+	authorized.POST("/mail/messages/:id/snooze", func(c *gin.Context) {
+		var req struct {
+			Provider string    `json:"provider" binding:"required"`
+			Until    time.Time `json:"until" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		if scheduler == nil {
+			respondError(c, errSchedulerDisabled)
+			return
+		}
+
+		if !req.Until.After(time.Now()) {
+			respondError(c, invalidParam("until", "until must be in the future"))
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		jwt := bearerToken(c)
+		if jwt == "" {
+			respondError(c, errTokenMissing)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		job, err := scheduler.Snooze(ctx, jwt, authUser.ID, provider, c.Param("id"), req.Until)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"scheduled": job})
+	})
+
+	// List pending scheduled actions
+	authorized.GET("/mail/scheduled", func(c *gin.Context) {
+		if scheduler == nil {
+			respondError(c, errSchedulerDisabled)
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		pending, err := scheduler.Pending(c.Request.Context(), authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"scheduled": pending})
+	})
+
+	// Cancel a pending scheduled action
+	authorized.DELETE("/mail/scheduled/:job_id", func(c *gin.Context) {
+		if scheduler == nil {
+			respondError(c, errSchedulerDisabled)
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		cancelled, err := scheduler.Cancel(c.Request.Context(), authUser.ID, c.Param("job_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !cancelled {
+			respondError(c, notFound("no pending job with that id"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"cancelled": c.Param("job_id")})
+	})
+
+	// Traffic analytics computed in the user's store
+	authorized.GET("/mail/analytics", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days < 1 || days > 365 {
+			respondError(c, invalidParam("days", "days must be between 1 and 365"))
+			return
+		}
+
+		top, err := strconv.Atoi(c.DefaultQuery("top", "10"))
+		if err != nil || top < 1 || top > 100 {
+			respondError(c, invalidParam("top", "top must be between 1 and 100"))
+			return
+		}
+
+		loc, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+		if err != nil {
+			respondError(c, invalidParam("tz", "invalid tz"))
+			return
+		}
+		_, tzOffset := time.Now().In(loc).Zone()
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		since := time.Now().AddDate(0, 0, -days).Unix()
+		analytics, err := eventStore.Analytics(c.Request.Context(), since, tzOffset, top)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 
+		c.JSON(http.StatusOK, analytics)
+	})
+
+	// Daily event counts from the activity projection
+	authorized.GET("/activity", func(c *gin.Context) {
 		user, _ := c.Get("user")
 		authUser := user.(*auth.User)
 
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if err != nil || days < 1 || days > 365 {
+			respondError(c, invalidParam("days", "days must be between 1 and 365"))
+			return
+		}
+
+		activity, err := projections.Activity(c.Request.Context(), authUser.ID, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"days": activity})
+	})
+
+	// Thread detail from the local store
+	authorized.GET("/mail/threads/:thread_id", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		// Thread ids are provider specific; provider is optional
 		var provider sync.ProviderName
-		switch req.Provider {
-		case "google", "GOOGLE":
-			provider = sync.ProviderGoogle
-		case "microsoft", "MICROSOFT":
-			provider = sync.ProviderMicrosoft
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported provider"})
+		if name := c.Query("provider"); name != "" {
+			var ok bool
+			if provider, ok = parseProvider(name); !ok {
+				respondError(c, errProviderUnsupported)
+				return
+			}
+		}
+
+		// as_of reconstructs the thread as it was at that time
+		var asOf time.Time
+		if v := c.Query("as_of"); v != "" {
+			var err error
+			if asOf, err = time.Parse(time.RFC3339, v); err != nil {
+				respondError(c, invalidParam("as_of", "as_of must be RFC3339"))
+				return
+			}
+		}
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
+		defer eventStore.Close()
 
-		if err := syncManager.StopSync(authUser.ID, "primary", provider); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var msgs []eventstore.StoredMessage
+		if asOf.IsZero() {
+			msgs, err = eventStore.ThreadMessages(c.Request.Context(), string(provider), c.Param("thread_id"))
+		} else {
+			msgs, err = eventStore.MessagesAsOf(c.Request.Context(), eventstore.AsOfQuery{
+				At:       asOf.Unix(),
+				Provider: string(provider),
+				ThreadID: c.Param("thread_id"),
+			})
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if len(msgs) == 0 {
+			respondError(c, notFound("thread not found"))
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "mail sync stopped"})
+		resp := gin.H{
+			"thread_id": c.Param("thread_id"),
+			"summary":   eventstore.SummarizeThread(msgs),
+			"messages":  msgs,
+		}
+		if !asOf.IsZero() {
+			resp["as_of"] = asOf.UTC().Format(time.RFC3339)
+		}
+		c.JSON(http.StatusOK, resp)
 	})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	// Mailbox state as of a point in time, replayed from the event history
+	authorized.GET("/mail/as-of", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		at, err := time.Parse(time.RFC3339, c.Query("at"))
+		if err != nil {
+			respondError(c, invalidParam("at", "at is required (RFC3339)"))
+			return
+		}
+
+		var provider sync.ProviderName
+		if name := c.Query("provider"); name != "" {
+			var ok bool
+			if provider, ok = parseProvider(name); !ok {
+				respondError(c, errProviderUnsupported)
+				return
+			}
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 1000"))
+			return
+		}
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		msgs, err := eventStore.MessagesAsOf(c.Request.Context(), eventstore.AsOfQuery{
+			At:       at.Unix(),
+			Provider: string(provider),
+			Folder:   c.Query("folder"),
+			Limit:    limit,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"as_of":    at.UTC().Format(time.RFC3339),
+			"messages": msgs,
+		})
+	})
+
+	// Search the local store with Gmail-like operators
+	authorized.GET("/mail/search", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		query, err := search.Parse(c.Query("q"))
+		if err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		if query.Empty() {
+			respondError(c, invalidParam("q", "q is required"))
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 500"))
+			return
+		}
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		msgs, err := eventStore.SearchMessages(c.Request.Context(), query, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"query":    c.Query("q"),
+			"messages": msgs,
+		})
+	})
+
+	authorized.GET("/contacts", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 1000"))
+			return
+		}
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		contacts, err := eventStore.ListContacts(c.Request.Context(), eventstore.ContactQuery{
+			Sort:   c.Query("sort"),
+			Search: c.Query("q"),
+			Limit:  limit,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":  authUser.ID,
+			"contacts": contacts,
+		})
+	})
+
+	authorized.GET("/contacts/:email/details", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		eventStore, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer eventStore.Close()
+
+		details, err := eventStore.ContactDetails(c.Request.Context(), c.Param("email"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"email":   strings.ToLower(c.Param("email")),
+			"details": details,
+		})
+	})
+
+	authorized.POST("/mail/import", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+		header, err := c.FormFile("file")
+		if err != nil {
+			respondError(c, invalidParam("file", "file is required (mbox, zip of .eml, or .eml)"))
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		defer file.Close()
+
+		var skipped int
+		result, err := syncManager.ImportMessages(c.Request.Context(), authUser.ID, func(fn func(sync.MessageMeta) error) error {
+			var err error
+			skipped, err = archive.Read(file, header.Size, fn)
+			return err
+		})
+		if result != nil {
+			result.Failed += skipped
+		}
+		if err != nil {
+			respondError(c, errInternal.withDetail("result", result).withCause(err))
+			return
+		}
+		if blobStore != nil && result.Processed > 0 {
+			if err := queueAttachmentText(c.Request.Context(), jobStore, authUser.ID); err != nil {
+				log.Printf("Error queuing attachment extraction for %s: %v", authUser.ID, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, result)
+	})
 
 	log.Printf("🚀 AI Brain API server starting on port %s", port)
 	log.Fatal(r.Run(":" + port))
@@ -311,14 +1713,113 @@ func jwtAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract and validate JWT token
 		user, err := jwtVerifier.UserFromRequest(c.Request)
+		if errors.Is(err, auth.ErrKeysUnavailable) {
+			respondError(c, errAuthUnavailable)
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
+			respondError(c, errInvalidToken)
+			return
+		}
+
+		// Admin support mode: act as another user for debugging. Read-only, and
+		// every impersonated request is written to the audit log.
+		if target := c.GetHeader("X-Impersonate-User"); target != "" {
+			if !user.IsAdmin() {
+				respondError(c, forbidden("impersonation requires admin role"))
+				return
+			}
+			if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				respondError(c, forbidden("impersonation is read-only"))
+				return
+			}
+
+			c.Set("user", &auth.User{ID: target})
+			c.Set("impersonator", user)
+			c.Next()
+
+			auditLog.Log(audit.Entry{
+				Actor:   user.ID,
+				Action:  "impersonate " + c.Request.Method + " " + c.FullPath(),
+				Target:  target,
+				Status:  c.Writer.Status(),
+				Details: map[string]string{"query": c.Request.URL.RawQuery},
+			})
 			return
 		}
 
+		// Multi-org: the org_id claim decides which org's stream gets the
+		// user's events (a missing claim removes them from their org)
+		if tenants != nil {
+			if err := tenants.Assign(c.Request.Context(), user.ID, user.OrgID); err != nil {
+				log.Printf("Tenancy: %v", err)
+			}
+		}
+
 		// Store user in context for handlers to use
 		c.Set("user", user)
 		c.Next()
 	}
 }
+
+// releaseUsers returns the request's authenticated users to the verifier's
+// pool once every other middleware, the access log included, is done
+func releaseUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		for _, key := range []string{"user", "impersonator"} {
+			if v, ok := c.Get(key); ok {
+				if u, ok := v.(*auth.User); ok {
+					auth.ReleaseUser(u)
+				}
+			}
+		}
+	}
+}
+
+// parseProvider maps the provider name used in API requests to a registered
+// sync provider
+func parseProvider(name string) (sync.ProviderName, bool) {
+	return sync.ParseProvider(name)
+}
+
+// inboxStatus is a provider's stored sync state with its freshness and
+// liveness
+type inboxStatus struct {
+	eventstore.SyncState
+	WithinSLO bool   `json:"within_slo"`
+	Liveness  string `json:"liveness"` // running, stuck, dead or stopped
+}
+
+func newInboxStatus(userID string, st eventstore.SyncState, now time.Time) inboxStatus {
+	registered := syncManager.IsRunning(userID, st.InboxID, sync.ProviderName(st.Provider))
+	return inboxStatus{
+		SyncState: st,
+		WithinSLO: sync.WithinSLO(st.SyncLag, syncManager.LagSLO()),
+		Liveness:  sync.Liveness(registered, st.Heartbeat, now),
+	}
+}
+
+// bearerToken returns the raw JWT from the Authorization header. Impersonated
+// requests get no token so the admin's own provider tokens are never used.
+func bearerToken(c *gin.Context) string {
+	if _, impersonating := c.Get("impersonator"); impersonating {
+		return ""
+	}
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return header[7:]
+}
+
+// openEventStore opens the user's mail event store
+func openEventStore(userID string) (eventstore.Store, error) {
+	return eventStores.Open(userID)
+}
+
+// openEventReader opens a read-only handle on the user's mail event store for
+// query endpoints, so they don't queue behind sync writes
+func openEventReader(userID string) (eventstore.Reader, error) {
+	return eventStores.OpenReader(userID)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/shard"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// runMode selects what a process runs, so the HTTP API and sync workers can
+// be scaled separately
+type runMode string
+
+const (
+	modeAPI    runMode = "api"    // HTTP API only; syncs are assigned to workers
+	modeWorker runMode = "worker" // sync workers and scheduled jobs; /health only
+	modeAll    runMode = "all"    // both in one process (default)
+	modeBench  runMode = "bench"  // load generator against a throwaway store; see runBench
+)
+
+// assignmentsSubject carries plain NATS notifications that sync configs
+// changed, so workers reconcile without waiting for their next poll
+const assignmentsSubject = "sync.assignments"
+
+// parseRunMode reads --mode, falling back to RUN_MODE and then "all"
+func parseRunMode(args []string) (runMode, error) {
+	def := os.Getenv("RUN_MODE")
+	if def == "" {
+		def = string(modeAll)
+	}
+
+	fs := flag.NewFlagSet("ai-brain-api", flag.ContinueOnError)
+	mode := fs.String("mode", def, "what to run: api, worker, all or bench")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+
+	switch m := runMode(*mode); m {
+	case modeAPI, modeWorker, modeAll, modeBench:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q: want api, worker, all or bench", *mode)
+	}
+}
+
+// servesAPI reports whether the process serves the HTTP API
+func (m runMode) servesAPI() bool {
+	return m != modeWorker
+}
+
+// runsSyncs reports whether the process runs sync workers
+func (m runMode) runsSyncs() bool {
+	return m != modeAPI
+}
+
+// reconcileInterval reads SYNC_RECONCILE_INTERVAL (default 30s)
+func reconcileInterval() (time.Duration, error) {
+	v := os.Getenv("SYNC_RECONCILE_INTERVAL")
+	if v == "" {
+		return sync.DefaultReconcileInterval, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid SYNC_RECONCILE_INTERVAL %q: want a positive duration like 30s", v)
+	}
+	return d, nil
+}
+
+// notifyAssignments returns the hook the sync manager calls after sync
+// configs change. A lost notification only delays workers until their next
+// poll.
+func notifyAssignments(publisher *natsjs.Publisher) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		payload, _ := json.Marshal(map[string]int64{"ts": time.Now().Unix()})
+		if err := publisher.PublishCore(ctx, assignmentsSubject, payload); err != nil {
+			log.Printf("Error announcing sync assignment change: %v", err)
+		}
+	}
+}
+
+// startWorker runs the sync worker, reconciling on an interval and whenever
+// the API announces a change. It returns the worker membership.
+func startWorker(ctx context.Context, publisher *natsjs.Publisher, manager *sync.Manager, configs *syncconfig.Store) (*shard.Membership, error) {
+	interval, err := reconcileInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	worker := sync.NewWorker(manager, configs, interval)
+
+	// Workers split users by rendezvous hashing over the live membership
+	membership := shard.NewMembership(shard.WorkerID(), func() (nats.KeyValue, error) {
+		return publisher.KeyValue(shard.Bucket, shard.TTL)
+	}, worker.Nudge)
+	membership.Start(ctx)
+	manager.SetOwnership(membership)
+	log.Printf("✓ Worker %s: %d live workers", membership.Self(), len(membership.Members()))
+
+	if err := publisher.Subscribe(ctx, assignmentsSubject, func(context.Context, *nats.Msg) {
+		worker.Nudge()
+	}); err != nil {
+		// Polling still picks changes up
+		log.Printf("Error subscribing to %s, relying on polling: %v", assignmentsSubject, err)
+	}
+	go worker.Run(ctx)
+	return membership, nil
+}
+
+// projectionsLeaderKey is hashed onto the membership like a user id; the
+// worker that owns it runs the projections
+const projectionsLeaderKey = "projections"
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/archive"
+	"github.com/Martian-dev/ai-brain-infra/internal/audit"
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/replica"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// maxOffboardUsers bounds one offboarding request
+const maxOffboardUsers = 100
+
+// offboardStopWait bounds the wait for a user's runners to exit before their
+// data is removed
+const offboardStopWait = 10 * time.Second
+
+// offboarder removes users who have left, e.g. when their org churns
+type offboarder struct {
+	configs    *syncconfig.Store
+	publisher  *natsjs.Publisher   // nil without NATS
+	blobs      blob.Store          // nil without a blob store
+	archiver   *archive.Archiver   // nil without tiered storage
+	replicator *replica.Replicator // nil without replication
+	archiveDir string              // data/offboarded
+}
+
+// offboardResult reports what was removed for one user
+type offboardResult struct {
+	UserID          string `json:"user_id"`
+	StoppedSyncs    int    `json:"stopped_syncs"`
+	HadData         bool   `json:"had_data"`
+	Archive         string `json:"archive,omitempty"` // SQLite copy of the user's rows
+	DeletedBlobs    int    `json:"deleted_blobs"`
+	DeletedSegments int    `json:"deleted_segments"` // archived mail segments
+	DeletedReplicas int    `json:"deleted_replicas"` // standby snapshots
+	PurgedEvents    bool   `json:"purged_events"`    // NATS subjects purged
+	Error           string `json:"error,omitempty"`
+}
+
+// offboard stops a user's syncs, archives and removes their stored data,
+// blobs, archived mail segments and standby snapshots, and purges their NATS
+// subjects. It stops at the first failure, so a retried request picks up
+// where it left off.
+func (o *offboarder) offboard(ctx context.Context, userID string, archive bool) offboardResult {
+	res := offboardResult{UserID: userID}
+	if err := o.run(ctx, userID, archive, &res); err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func (o *offboarder) run(ctx context.Context, userID string, archive bool, res *offboardResult) error {
+	// Unassign every inbox first so no worker restarts a sync
+	configs, err := o.configs.ListUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, cfg := range configs {
+		_, err := syncManager.Disconnect(ctx, sync.InboxConfig{
+			UserID:   userID,
+			InboxID:  cfg.InboxID,
+			Provider: sync.ProviderName(cfg.Provider),
+		}, sync.DisconnectOptions{})
+		if err != nil {
+			return fmt.Errorf("stop sync %s/%s: %w", cfg.Provider, cfg.InboxID, err)
+		}
+		res.StoppedSyncs++
+	}
+	for _, s := range syncManager.GetRunningSyncs(userID) {
+		if err := syncManager.StopSync(userID, s.InboxID, s.Provider); err == nil {
+			res.StoppedSyncs++
+		}
+	}
+	for deadline := time.Now().Add(offboardStopWait); len(syncManager.GetRunningSyncs(userID)) > 0; {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("syncs still running after %s", offboardStopWait)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	archivePath := ""
+	if archive {
+		archivePath = filepath.Join(o.archiveDir, userID+"-"+strconv.FormatInt(time.Now().Unix(), 10)+".db")
+	}
+	if res.HadData, err = eventStores.RemoveUser(ctx, userID, archivePath); err != nil {
+		return fmt.Errorf("remove data: %w", err)
+	}
+	if res.HadData {
+		res.Archive = archivePath
+	}
+
+	if o.blobs != nil {
+		prefix, _ := blob.UserKey(userID)
+		var keys []string
+		err := o.blobs.List(ctx, prefix+"/", func(obj blob.Object) error {
+			keys = append(keys, obj.Key)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("list blobs: %w", err)
+		}
+		for _, key := range keys {
+			if err := o.blobs.Delete(ctx, key); err != nil {
+				return fmt.Errorf("delete blob %s: %w", key, err)
+			}
+			res.DeletedBlobs++
+		}
+	}
+
+	if o.archiver != nil {
+		n, err := o.archiver.RemoveUser(ctx, userID)
+		res.DeletedSegments += n
+		if err != nil {
+			return fmt.Errorf("delete archived mail: %w", err)
+		}
+	}
+	if o.replicator != nil {
+		n, err := o.replicator.RemoveUser(ctx, userID)
+		res.DeletedReplicas += n
+		if err != nil {
+			return fmt.Errorf("delete replicas: %w", err)
+		}
+	}
+
+	if o.publisher != nil {
+		if err := o.publisher.PurgeUser(ctx, userID); err != nil {
+			return fmt.Errorf("purge events: %w", err)
+		}
+		res.PurgedEvents = true
+	}
+	return nil
+}
+
+// registerOffboardRoutes mounts bulk offboarding on the admin group
+func registerOffboardRoutes(admin *gin.RouterGroup, off *offboarder) {
+	// Remove users for good: stop their syncs, archive their stored data to
+	// data/offboarded (unless archive is false), delete it with their blobs,
+	// archived mail and replicas, and purge their NATS subjects. Each user gets an audit record.
+	admin.POST("/users/offboard", func(c *gin.Context) {
+		var req struct {
+			UserIDs []string `json:"user_ids" binding:"required"`
+			Archive *bool    `json:"archive"` // default true
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		if len(req.UserIDs) == 0 || len(req.UserIDs) > maxOffboardUsers {
+			respondError(c, invalidParam("user_ids", fmt.Sprintf("user_ids must list 1 to %d users", maxOffboardUsers)))
+			return
+		}
+		for _, id := range req.UserIDs {
+			if _, err := blob.UserKey(id); err != nil {
+				respondError(c, invalidParam("user_ids", fmt.Sprintf("invalid user id %q", id)))
+				return
+			}
+		}
+		archive := req.Archive == nil || *req.Archive
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		results := make([]offboardResult, 0, len(req.UserIDs))
+		failed := 0
+		for _, userID := range req.UserIDs {
+			res := off.offboard(c.Request.Context(), userID, archive)
+			results = append(results, res)
+
+			status := http.StatusOK
+			details := map[string]string{"archive": res.Archive}
+			if res.Error != "" {
+				failed++
+				status = http.StatusInternalServerError
+				details["error"] = res.Error
+				log.Printf("Offboarding %s failed: %s", userID, res.Error)
+			}
+			auditLog.Log(audit.Entry{
+				Actor:   authUser.ID,
+				Action:  "offboard user",
+				Target:  userID,
+				Status:  status,
+				Details: details,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"users": results, "failed": failed})
+	})
+}
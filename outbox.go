@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/errreport"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	natsjs "github.com/Martian-dev/ai-brain-infra/internal/nats"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// jobOutboxVerify checks that JetStream still has a sample of every
+// connected user's recently published events
+const jobOutboxVerify = "outbox_verify"
+
+// outboxErrorSamples is how many recent publish errors the outbox endpoints
+// return
+const outboxErrorSamples = 20
+
+// outboxResponse adds the age of the oldest pending message to a backlog
+func outboxResponse(backlog *eventstore.OutboxBacklog, now time.Time) gin.H {
+	age := int64(0)
+	if backlog.OldestPendingAt > 0 {
+		age = max(now.Unix()-backlog.OldestPendingAt, 0)
+	}
+	return gin.H{
+		"pending":                    backlog.Pending,
+		"oldest_pending_at":          backlog.OldestPendingAt,
+		"oldest_pending_age_seconds": age,
+		"retries":                    backlog.Retries,
+		"recent_errors":              backlog.RecentErrors,
+	}
+}
+
+// registerOutboxRoutes mounts the caller's outbox backlog, showing events
+// that were stored but haven't reached NATS yet
+func registerOutboxRoutes(authorized *gin.RouterGroup) {
+	authorized.GET("/mail/outbox", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		store, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		backlog, err := store.OutboxBacklog(c.Request.Context(), outboxErrorSamples)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, outboxResponse(backlog, time.Now()))
+	})
+}
+
+// userOutbox is one user's share of the admin outbox report
+type userOutbox struct {
+	UserID          string `json:"user_id"`
+	Pending         int64  `json:"pending"`
+	OldestPendingAt int64  `json:"oldest_pending_at"`
+}
+
+// registerOutboxAdminRoutes mounts the outbox backlog of every user with a
+// connected inbox on the admin group
+func registerOutboxAdminRoutes(admin *gin.RouterGroup, configs *syncconfig.Store) {
+	admin.GET("/outbox", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		users, err := connectedUsers(ctx, configs)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		total := &eventstore.OutboxBacklog{Retries: map[string]int64{}, RecentErrors: []eventstore.OutboxError{}}
+		for _, bucket := range eventstore.RetryBuckets {
+			total.Retries[bucket] = 0
+		}
+		perUser := []userOutbox{}
+		failed := []string{}
+		for _, userID := range users {
+			backlog, err := userOutboxBacklog(c, userID)
+			if err != nil {
+				log.Printf("Outbox backlog for %s: %v", userID, err)
+				failed = append(failed, userID)
+				continue
+			}
+			if backlog.Pending == 0 {
+				continue
+			}
+
+			perUser = append(perUser, userOutbox{UserID: userID, Pending: backlog.Pending, OldestPendingAt: backlog.OldestPendingAt})
+			total.Pending += backlog.Pending
+			if total.OldestPendingAt == 0 || backlog.OldestPendingAt < total.OldestPendingAt {
+				total.OldestPendingAt = backlog.OldestPendingAt
+			}
+			for bucket, n := range backlog.Retries {
+				total.Retries[bucket] += n
+			}
+			total.RecentErrors = append(total.RecentErrors, backlog.RecentErrors...)
+		}
+
+		sort.Slice(perUser, func(i, j int) bool { return perUser[i].Pending > perUser[j].Pending })
+		sort.Slice(total.RecentErrors, func(i, j int) bool {
+			return total.RecentErrors[i].FailedAt > total.RecentErrors[j].FailedAt
+		})
+		if len(total.RecentErrors) > outboxErrorSamples {
+			total.RecentErrors = total.RecentErrors[:outboxErrorSamples]
+		}
+
+		resp := outboxResponse(total, time.Now())
+		resp["users"] = perUser
+		resp["failed_users"] = failed
+		c.JSON(http.StatusOK, resp)
+	})
+}
+
+// userOutboxBacklog reads one user's outbox backlog
+func userOutboxBacklog(c *gin.Context, userID string) (*eventstore.OutboxBacklog, error) {
+	store, err := openEventReader(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	return store.OutboxBacklog(c.Request.Context(), outboxErrorSamples)
+}
+
+// outboxDispatchFairness reads OUTBOX_DISPATCH_CONCURRENCY, how many outbox
+// batches this process publishes at once (default 4), and
+// OUTBOX_DISPATCH_POLICY, how users take turns beyond that (round_robin or
+// oldest_first)
+func outboxDispatchFairness() (int, sync.DispatchPolicy, error) {
+	concurrency := sync.DefaultDispatchConcurrency
+	if v := os.Getenv("OUTBOX_DISPATCH_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 256 {
+			return 0, "", fmt.Errorf("invalid OUTBOX_DISPATCH_CONCURRENCY %q: want 1-256", v)
+		}
+		concurrency = n
+	}
+	policy, err := sync.ParseDispatchPolicy(os.Getenv("OUTBOX_DISPATCH_POLICY"))
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid OUTBOX_DISPATCH_POLICY: %w", err)
+	}
+	return concurrency, policy, nil
+}
+
+// newPublishVerifier configures publish verification when OUTBOX_VERIFY is
+// true: OUTBOX_VERIFY_SAMPLE messages per user (default 20) published within
+// OUTBOX_VERIFY_WINDOW (default 1h). It returns nil when verification is off.
+func newPublishVerifier(stores eventstore.Opener, publisher *natsjs.Publisher, reporter errreport.Reporter) (*sync.PublishVerifier, error) {
+	if os.Getenv("OUTBOX_VERIFY") != "true" {
+		return nil, nil
+	}
+	sample, window := sync.DefaultVerifySample, sync.DefaultVerifyWindow
+	if v := os.Getenv("OUTBOX_VERIFY_SAMPLE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			return nil, fmt.Errorf("invalid OUTBOX_VERIFY_SAMPLE %q: want 1-1000", v)
+		}
+		sample = n
+	}
+	if v := os.Getenv("OUTBOX_VERIFY_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("invalid OUTBOX_VERIFY_WINDOW %q: want a duration of at least 1m", v)
+		}
+		window = d
+	}
+	return sync.NewPublishVerifier(stores, publisher, reporter, sample, window), nil
+}
+
+// registerOutboxVerifyJob samples every user with a connected inbox on
+// OUTBOX_VERIFY_SCHEDULE (default every 15 minutes). verifier is nil when
+// verification is off.
+func registerOutboxVerifyJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, verifier *sync.PublishVerifier, configs *syncconfig.Store) error {
+	// Registered even when off, so a leftover job doesn't sit unclaimed
+	runner.Register(jobOutboxVerify, jobs.Kind{
+		Timeout: 10 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			if verifier == nil {
+				return nil
+			}
+			users, err := connectedUsers(ctx, configs)
+			if err != nil {
+				return err
+			}
+
+			var total sync.VerifyResult
+			for _, userID := range users {
+				result, err := verifier.Verify(ctx, userID)
+				if err != nil {
+					log.Printf("Outbox verification for %s: %v", userID, err)
+					continue
+				}
+				total.Checked += result.Checked
+				total.Missing += result.Missing
+				total.Mismatch += result.Mismatch
+			}
+			if total.Missing > 0 || total.Mismatch > 0 {
+				log.Printf("Outbox verification: %d of %d published events lost (%d missing, %d replaced)",
+					total.Missing+total.Mismatch, total.Checked, total.Missing, total.Mismatch)
+			}
+			return nil
+		},
+	})
+	if verifier == nil {
+		return nil
+	}
+
+	schedule := os.Getenv("OUTBOX_VERIFY_SCHEDULE")
+	if schedule == "" {
+		schedule = "@every 15m"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid OUTBOX_VERIFY_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobOutboxVerify, jobOutboxVerify, schedule, nil)
+	return err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// progressPollInterval is how often the progress stream re-reads sync state.
+// Runners write their heartbeat every couple of seconds while backfilling.
+const progressPollInterval = 2 * time.Second
+
+// progressKeepalive bounds the silence on a progress stream, so proxies
+// don't close it while a backfill waits for a slot
+const progressKeepalive = 15 * time.Second
+
+// backfillProgress is how far an inbox's initial backfill has come
+type backfillProgress struct {
+	Provider          string          `json:"provider"`
+	InboxID           string          `json:"inbox_id"`
+	Phase             string          `json:"phase"`
+	Done              bool            `json:"done"` // the initial backfill finished
+	MessagesProcessed int64           `json:"messages_processed"`
+	Window            *progressWindow `json:"window,omitempty"`        // message dates covered so far
+	BackfillFrom      int64           `json:"backfill_from,omitempty"` // start of the backfill window
+	Percent           *float64        `json:"percent,omitempty"`       // unknown when backfilling all mail
+	ETASeconds        *int64          `json:"eta_seconds,omitempty"`
+	LastError         string          `json:"last_error,omitempty"`
+	ErrorCode         string          `json:"error_code,omitempty"`
+}
+
+// progressWindow is the range of message dates an initial backfill has
+// processed
+type progressWindow struct {
+	Newest int64 `json:"newest"`
+	Oldest int64 `json:"oldest"`
+}
+
+// newBackfillProgress derives progress from a stored sync state. Providers
+// backfill newest mail first, so the share of the backfill window already
+// covered estimates completion; without a window there is no estimate.
+func newBackfillProgress(st eventstore.SyncState, now time.Time) backfillProgress {
+	p := backfillProgress{
+		Provider:  st.Provider,
+		InboxID:   st.InboxID,
+		Phase:     sync.PhaseStarting,
+		Done:      st.Cursor != "",
+		LastError: st.LastError,
+		ErrorCode: st.ErrorCode,
+	}
+	if p.Done {
+		done := 100.0
+		p.Percent = &done
+	}
+	hb := st.Heartbeat
+	if hb == nil {
+		return p
+	}
+	p.Phase = hb.Phase
+	if hb.Phase != sync.PhaseBackfill {
+		return p
+	}
+
+	p.MessagesProcessed = hb.Messages
+	p.BackfillFrom = hb.BackfillFrom
+	if hb.OldestSeen > 0 {
+		p.Window = &progressWindow{Newest: hb.NewestSeen, Oldest: hb.OldestSeen}
+	}
+	if hb.BackfillFrom == 0 || hb.OldestSeen == 0 || hb.NewestSeen <= hb.BackfillFrom {
+		return p
+	}
+
+	covered := float64(hb.NewestSeen-hb.OldestSeen) / float64(hb.NewestSeen-hb.BackfillFrom)
+	covered = min(max(covered, 0), 1)
+	percent := float64(int64(covered*1000)) / 10
+	p.Percent = &percent
+	if covered > 0 {
+		elapsed := now.Sub(time.Unix(hb.StartedAt, 0)).Seconds()
+		eta := int64(elapsed * (1 - covered) / covered)
+		p.ETASeconds = &eta
+	}
+	return p
+}
+
+// registerProgressRoutes mounts the live backfill progress stream
+func registerProgressRoutes(authorized *gin.RouterGroup) {
+	// Server-sent events with the initial backfill progress of the caller's
+	// inboxes (optionally one provider's): a "progress" event whenever it
+	// changes and a final "done" event once every backfill finished
+	authorized.GET("/mail/progress/stream", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		provider := ""
+		if name := c.Query("provider"); name != "" {
+			parsed, ok := parseProvider(name)
+			if !ok {
+				respondError(c, errProviderUnsupported)
+				return
+			}
+			provider = string(parsed)
+		}
+
+		store, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+
+		ctx := c.Request.Context()
+		ticker := time.NewTicker(progressPollInterval)
+		defer ticker.Stop()
+
+		var last []byte
+		lastSent := time.Now()
+		c.Stream(func(w io.Writer) bool {
+			states, err := store.SyncStates(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("progress stream for user %s failed: %v", authUser.ID, err)
+					c.SSEvent("error", errInternal)
+				}
+				return false
+			}
+
+			now := time.Now()
+			inboxes := []backfillProgress{}
+			done := true
+			for _, st := range states {
+				if provider != "" && st.Provider != provider {
+					continue
+				}
+				p := newBackfillProgress(st, now)
+				done = done && p.Done
+				inboxes = append(inboxes, p)
+			}
+			// Nothing connected yet keeps the stream open for the inbox
+			// that is about to be
+			if done && len(inboxes) > 0 {
+				c.SSEvent("done", gin.H{"inboxes": inboxes})
+				return false
+			}
+
+			body, _ := json.Marshal(inboxes)
+			switch {
+			case !bytes.Equal(body, last):
+				c.SSEvent("progress", gin.H{"inboxes": inboxes})
+				last, lastSent = body, now
+			case now.Sub(lastSent) >= progressKeepalive:
+				_, _ = io.WriteString(w, ": keepalive\n\n")
+				lastSent = now
+			}
+
+			select {
+			case <-ctx.Done():
+				return false
+			case <-ticker.C:
+				return true
+			}
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/providers/fake"
+)
+
+// devMode enables development-only features such as the fake mail provider
+func devMode() bool {
+	return os.Getenv("DEV_MODE") == "true"
+}
+
+// registerFakeProvider makes the fake provider connectable through
+// /mail/connect. It needs no OAuth account, so only dev mode registers it.
+func registerFakeProvider() error {
+	cfg, err := fakeProviderConfig()
+	if err != nil {
+		return err
+	}
+	fake.Register(cfg)
+	log.Printf("⚠ Dev mode: fake mail provider enabled (%d backfill messages, %g/min)", cfg.Backfill, cfg.Rate)
+	return nil
+}
+
+// fakeProviderConfig reads the generated traffic of the fake provider from
+// FAKE_MAIL_* variables, defaulting to fake.DefaultConfig
+func fakeProviderConfig() (fake.Config, error) {
+	cfg := fake.DefaultConfig
+	for env, dst := range map[string]*int{
+		"FAKE_MAIL_BACKFILL":    &cfg.Backfill,
+		"FAKE_MAIL_SENDERS":     &cfg.Senders,
+		"FAKE_MAIL_THREAD_SIZE": &cfg.ThreadSize,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s %q: want a number", env, v)
+			}
+			*dst = n
+		}
+	}
+	if v := os.Getenv("FAKE_MAIL_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid FAKE_MAIL_RATE %q: want messages per minute", v)
+		}
+		cfg.Rate = rate
+	}
+	if v := os.Getenv("FAKE_MAIL_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid FAKE_MAIL_DAYS %q: want a number of days", v)
+		}
+		cfg.Span = time.Duration(days) * 24 * time.Hour
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid FAKE_MAIL_* settings: %w", err)
+	}
+	return cfg, nil
+}
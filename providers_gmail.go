@@ -0,0 +1,6 @@
+//go:build !no_gmail
+
+package main
+
+// The gmail adapter registers itself with the sync provider registry
+import _ "github.com/Martian-dev/ai-brain-infra/internal/providers/gmail"
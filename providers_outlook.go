@@ -0,0 +1,6 @@
+//go:build !no_outlook
+
+package main
+
+// The outlook adapter registers itself with the sync provider registry
+import _ "github.com/Martian-dev/ai-brain-infra/internal/providers/outlook"
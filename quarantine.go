@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/sync"
+)
+
+// quarantineStatuses are the statuses GET /admin/users/:user_id/quarantine
+// filters by
+var quarantineStatuses = []string{
+	eventstore.QuarantinePending,
+	eventstore.QuarantineRequeued,
+	eventstore.QuarantineReleased,
+	eventstore.QuarantineDiscarded,
+}
+
+// quarantineID parses the :id path parameter
+func quarantineID(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, invalidParam("id", "id must be a positive integer")
+	}
+	return id, nil
+}
+
+// registerQuarantineRoutes lets admins review the messages a user's sync held
+// back and requeue or discard them
+func registerQuarantineRoutes(admin *gin.RouterGroup) {
+	// Held-back messages, newest first (status=pending by default, all for
+	// every status)
+	admin.GET("/users/:user_id/quarantine", func(c *gin.Context) {
+		status := c.DefaultQuery("status", eventstore.QuarantinePending)
+		if status == "all" {
+			status = ""
+		} else if !slices.Contains(quarantineStatuses, status) {
+			respondError(c, invalidParam("status", "status must be pending, requeued, released, discarded or all"))
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 500 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 500"))
+			return
+		}
+
+		reader, err := openEventReader(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		messages, err := reader.ListQuarantined(c.Request.Context(), status, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"messages": messages})
+	})
+
+	// One held-back message with the message as the provider returned it
+	admin.GET("/users/:user_id/quarantine/:id", func(c *gin.Context) {
+		id, err := quarantineID(c)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		reader, err := openEventReader(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		q, err := reader.LoadQuarantined(c.Request.Context(), id)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if q == nil {
+			respondError(c, notFound("no quarantined message with that id"))
+			return
+		}
+		c.JSON(http.StatusOK, q)
+	})
+
+	// Ingest a pending message again, e.g. after a fix was deployed. The
+	// inbox's sync picks it up on its next cycle, started right away when it
+	// runs on this worker.
+	admin.POST("/users/:user_id/quarantine/:id/requeue", func(c *gin.Context) {
+		setQuarantineStatus(c, eventstore.QuarantineRequeued, eventstore.QuarantinePending)
+	})
+
+	// Drop a message for good; it is only ingested again if the provider
+	// delivers it again
+	admin.DELETE("/users/:user_id/quarantine/:id", func(c *gin.Context) {
+		setQuarantineStatus(c, eventstore.QuarantineDiscarded, eventstore.QuarantinePending, eventstore.QuarantineRequeued)
+	})
+}
+
+// setQuarantineStatus moves the :id message of :user_id to status if it has
+// one of the from statuses
+func setQuarantineStatus(c *gin.Context, status string, from ...string) {
+	id, err := quarantineID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	userID := c.Param("user_id")
+
+	store, err := openEventStore(userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer store.Close()
+
+	q, err := store.LoadQuarantined(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if q == nil {
+		respondError(c, notFound("no quarantined message with that id"))
+		return
+	}
+	ok, err := store.SetQuarantineStatus(c.Request.Context(), id, status, from...)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !ok {
+		respondError(c, badRequest(fmt.Sprintf("quarantined message is %s, want %s", q.Status, strings.Join(from, " or "))))
+		return
+	}
+
+	if status == eventstore.QuarantineRequeued {
+		_ = syncManager.SyncNow(userID, q.InboxID, sync.ProviderName(q.Provider))
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "status": status})
+}
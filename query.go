@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/nlquery"
+)
+
+// newLLMClient configures the language model from LLM_BASE_URL (default
+// OpenAI), LLM_API_KEY, LLM_MODEL, LLM_EMBEDDING_MODEL ("none" turns
+// embeddings off) and LLM_TIMEOUT. It returns nil when neither LLM_BASE_URL
+// nor LLM_API_KEY is set.
+func newLLMClient() (llm.Client, error) {
+	cfg := llm.Config{
+		BaseURL:        os.Getenv("LLM_BASE_URL"),
+		APIKey:         os.Getenv("LLM_API_KEY"),
+		Model:          os.Getenv("LLM_MODEL"),
+		EmbeddingModel: os.Getenv("LLM_EMBEDDING_MODEL"),
+	}
+	if cfg.BaseURL == "" && cfg.APIKey == "" {
+		return nil, nil
+	}
+	switch cfg.EmbeddingModel {
+	case "":
+		cfg.EmbeddingModel = llm.DefaultEmbeddingModel
+	case "none":
+		cfg.EmbeddingModel = ""
+	}
+	if v := os.Getenv("LLM_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid LLM_TIMEOUT %q: want a duration like 60s", v)
+		}
+		cfg.Timeout = d
+	}
+	return llm.NewOpenAI(cfg), nil
+}
+
+// llmError reports a failed model call as a dependency outage
+func llmError(err error) error {
+	var statusErr *llm.StatusError
+	if errors.As(err, &statusErr) {
+		return &apiError{Status: http.StatusBadGateway, Code: CodeDependencyDown, Message: "language model request failed", cause: err}
+	}
+	return err
+}
+
+// registerQueryRoutes answers natural-language questions about the user's
+// mail. engine is nil when no language model is configured.
+func registerQueryRoutes(authorized *gin.RouterGroup, engine *nlquery.Engine) {
+	authorized.POST("/query", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		if engine == nil {
+			respondError(c, errLLMDisabled)
+			return
+		}
+
+		var req struct {
+			Question string `json:"question" binding:"required"`
+			Sources  int    `json:"sources"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		if req.Sources < 0 || req.Sources > nlquery.MaxSources {
+			respondError(c, invalidParam("sources", fmt.Sprintf("sources must be between 1 and %d", nlquery.MaxSources)))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		answer, err := engine.Ask(c.Request.Context(), reader, req.Question, req.Sources)
+		if err != nil {
+			respondError(c, llmError(err))
+			return
+		}
+		c.JSON(http.StatusOK, answer)
+	})
+}
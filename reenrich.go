@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/enrich"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// jobReenrich replays a user's stored mail through the enrichers for a
+// slice, queuing its own continuation until every message was replayed
+const jobReenrich = "reenrich"
+
+// reenrichSlice is how long a re-enrichment job works before yielding
+const reenrichSlice = 2 * time.Minute
+
+// enrichmentVersionPattern is what ENRICHMENT_VERSION may look like
+var enrichmentVersionPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// reenrichPayload is the payload of a re-enrichment job
+type reenrichPayload struct {
+	Version string `json:"version"`
+	Publish bool   `json:"publish"`
+	Restart bool   `json:"restart"` // start over from the first message
+}
+
+// enrichmentVersion reads ENRICHMENT_VERSION, the label of this build's
+// enrichment outputs (default enrich.DefaultVersion). Bump it with enricher
+// logic so re-enrichment results can be compared with the previous ones.
+func enrichmentVersion() (string, error) {
+	v := os.Getenv("ENRICHMENT_VERSION")
+	if v == "" {
+		return enrich.DefaultVersion, nil
+	}
+	if !enrichmentVersionPattern.MatchString(v) {
+		return "", fmt.Errorf("invalid ENRICHMENT_VERSION %q: want 1-32 letters, digits, '.', '_' or '-'", v)
+	}
+	return v, nil
+}
+
+// registerReenrichJob runs re-enrichment on sync workers. Jobs queued for
+// another version (e.g. by a worker not yet redeployed) fail and are retried.
+func registerReenrichJob(runner *jobs.Runner, store *jobs.Store, enricher *enrich.Worker) {
+	runner.Register(jobReenrich, jobs.Kind{
+		Timeout: reenrichSlice + time.Minute,
+		Handler: func(ctx context.Context, job jobs.Job) error {
+			var p reenrichPayload
+			if err := json.Unmarshal(job.Payload, &p); err != nil {
+				return fmt.Errorf("decode payload: %w", err)
+			}
+			if p.Version != enricher.Version() {
+				return fmt.Errorf("re-enrichment queued for version %s, this worker runs %s", p.Version, enricher.Version())
+			}
+
+			if p.Restart {
+				if err := enricher.StartReplay(ctx, job.UserID, p.Publish); err != nil {
+					return err
+				}
+			}
+			done, err := enricher.Replay(ctx, job.UserID, reenrichSlice)
+			if err != nil {
+				return err
+			}
+			if done {
+				log.Printf("Re-enrichment %s for %s: done", p.Version, job.UserID)
+				return nil
+			}
+			p.Restart = false
+			_, err = store.Enqueue(ctx, job.UserID, jobReenrich, p, time.Now())
+			return err
+		},
+	})
+}
+
+// registerReenrichRoutes lets admins re-enrich stored mail with the current
+// enrichment version and compare the outputs of two versions
+func registerReenrichRoutes(admin *gin.RouterGroup, store *jobs.Store, configs *syncconfig.Store, version string) {
+	// Queue re-enrichment for the listed users (default: every user with a
+	// connected inbox). With publish the derived events are published too.
+	admin.POST("/enrichment/reenrich", func(c *gin.Context) {
+		var req struct {
+			UserIDs []string `json:"user_ids"`
+			Publish bool     `json:"publish"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		users := req.UserIDs
+		if len(users) == 0 {
+			var err error
+			if users, err = connectedUsers(c.Request.Context(), configs); err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+
+		payload := reenrichPayload{Version: version, Publish: req.Publish, Restart: true}
+		for _, userID := range users {
+			if _, err := store.Enqueue(c.Request.Context(), userID, jobReenrich, payload, time.Now()); err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"version": version, "publish": req.Publish, "queued": len(users)})
+	})
+
+	// A user's re-enrichment runs, newest first
+	admin.GET("/users/:user_id/enrichment", func(c *gin.Context) {
+		reader, err := openEventReader(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		runs, err := reader.EnrichmentRuns(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"version": version, "runs": runs})
+	})
+
+	// Messages whose outputs differ between two versions (to defaults to
+	// the current one)
+	admin.GET("/users/:user_id/enrichment/compare", func(c *gin.Context) {
+		from, to := c.Query("from"), c.DefaultQuery("to", version)
+		if from == "" {
+			respondError(c, invalidParam("from", "from is required"))
+			return
+		}
+		if from == to {
+			respondError(c, invalidParam("to", "to must differ from from"))
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 500"))
+			return
+		}
+
+		reader, err := openEventReader(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		cmp, err := reader.CompareEnrichments(c.Request.Context(), from, to, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, cmp)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/blob"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/replica"
+)
+
+// jobReplicateUsers ships changed per-user databases to the replica store
+const jobReplicateUsers = "replicate_users"
+
+// newReplicator configures replication of the per-user databases from
+// REPLICA_STORE (local, s3, gcs). Returns nil when replication is off.
+func newReplicator(stores eventstore.Opener) (*replica.Replicator, error) {
+	var target blob.Store
+	var err error
+	switch os.Getenv("REPLICA_STORE") {
+	case "":
+		return nil, nil
+	case "local":
+		dir := os.Getenv("REPLICA_LOCAL_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("REPLICA_LOCAL_DIR is required with REPLICA_STORE=local")
+		}
+		// Replicas are never served, so signed URLs get a throwaway secret
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		target, err = blob.NewLocal(dir, "", secret)
+	case "s3":
+		target, err = blob.NewS3(blob.S3Config{
+			Endpoint:  os.Getenv("REPLICA_ENDPOINT"),
+			Region:    os.Getenv("REPLICA_REGION"),
+			Bucket:    os.Getenv("REPLICA_BUCKET"),
+			AccessKey: os.Getenv("REPLICA_ACCESS_KEY"),
+			SecretKey: os.Getenv("REPLICA_SECRET_KEY"),
+		})
+	case "gcs":
+		target, err = blob.NewGCS(os.Getenv("REPLICA_BUCKET"), os.Getenv("REPLICA_ACCESS_KEY"), os.Getenv("REPLICA_SECRET_KEY"))
+	default:
+		return nil, fmt.Errorf("unknown REPLICA_STORE %q (want local, s3 or gcs)", os.Getenv("REPLICA_STORE"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stores.Shared() {
+		return nil, fmt.Errorf("REPLICA_STORE needs per-user storage (STORAGE_MODE=per_user)")
+	}
+	return replica.New(stores, filepath.Join("data", "users"), target), nil
+}
+
+// promoteReplicas restores the users missing locally from the replica store
+// when REPLICA_PROMOTE=true, before anything opens their databases
+func promoteReplicas(ctx context.Context, replicator *replica.Replicator) error {
+	if os.Getenv("REPLICA_PROMOTE") != "true" {
+		return nil
+	}
+	if replicator == nil {
+		return fmt.Errorf("REPLICA_PROMOTE needs REPLICA_STORE")
+	}
+
+	start := time.Now()
+	n, err := replicator.Promote(ctx)
+	log.Printf("✓ Promoted replica: restored %d user databases in %s", n, time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+// registerReplicationJob ships changed databases on REPLICA_SCHEDULE (default
+// every 5 minutes). replicator may be nil.
+func registerReplicationJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, replicator *replica.Replicator) error {
+	// Registered even without replication, so a leftover job doesn't sit
+	// unclaimed
+	runner.Register(jobReplicateUsers, jobs.Kind{
+		Timeout: 30 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			if replicator == nil {
+				return nil
+			}
+			n, err := replicator.Ship(ctx)
+			if n > 0 {
+				log.Printf("Replica: shipped %d user databases", n)
+			}
+			return err
+		},
+	})
+	if replicator == nil {
+		return nil
+	}
+
+	schedule := os.Getenv("REPLICA_SCHEDULE")
+	if schedule == "" {
+		schedule = "@every 5m"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid REPLICA_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobReplicateUsers, jobReplicateUsers, schedule, nil)
+	return err
+}
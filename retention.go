@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/retention"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// jobEventRetention deletes events past their type's TTL
+const jobEventRetention = "event_retention"
+
+// registerRetentionJob sweeps every user with a connected inbox on
+// RETENTION_SCHEDULE (default hourly)
+func registerRetentionJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, registry *retention.Store, stores eventstore.Opener, configs *syncconfig.Store) error {
+	runner.Register(jobEventRetention, jobs.Kind{
+		Timeout: 30 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			users, err := connectedUsers(ctx, configs)
+			if err != nil {
+				return err
+			}
+
+			n, err := registry.Sweep(ctx, stores, users, time.Now())
+			if n > 0 {
+				log.Printf("Retention: deleted %d expired events", n)
+			}
+			return err
+		},
+	})
+
+	schedule := os.Getenv("RETENTION_SCHEDULE")
+	if schedule == "" {
+		schedule = "@hourly"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid RETENTION_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobEventRetention, jobEventRetention, schedule, nil)
+	return err
+}
+
+// registerEventTypeRoutes mounts the event-type TTL registry on the admin
+// group
+func registerEventTypeRoutes(admin *gin.RouterGroup, registry *retention.Store) {
+	// Registered TTLs; types not listed are kept forever
+	admin.GET("/event-types", func(c *gin.Context) {
+		ttls, err := registry.List(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"event_types": ttls})
+	})
+
+	// Set how long events of a type are kept; the janitor applies it on its
+	// next run
+	admin.PUT("/event-types/:type", func(c *gin.Context) {
+		var req struct {
+			TTL string `json:"ttl" binding:"required"` // e.g. 168h, at least 1h
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			respondError(c, invalidParam("ttl", "ttl must be a duration like 168h"))
+			return
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		t, err := registry.Set(c.Request.Context(), c.Param("type"), ttl, authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	})
+
+	// Keep events of a type forever again
+	admin.DELETE("/event-types/:type", func(c *gin.Context) {
+		deleted, err := registry.Delete(c.Request.Context(), c.Param("type"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !deleted {
+			respondError(c, notFound("event type has no TTL"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"event_type": c.Param("type"), "deleted": true})
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/audit"
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// issueServiceToken implements the issue-service-token subcommand:
+//
+//	ai-brain-api issue-service-token -name enricher -scopes events:read,events:write -ttl 720h
+func issueServiceToken(args []string) int {
+	fs := flag.NewFlagSet("issue-service-token", flag.ContinueOnError)
+	name := fs.String("name", "", "service name (e.g. enricher)")
+	scopes := fs.String("scopes", "", "comma-separated scopes (events:read, events:write)")
+	ttl := fs.Duration("ttl", 24*time.Hour, "token lifetime")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	secret := os.Getenv("SERVICE_TOKEN_SECRET")
+	if secret == "" {
+		fmt.Fprintln(os.Stderr, "SERVICE_TOKEN_SECRET is not set")
+		return 1
+	}
+
+	issuer, err := auth.NewServiceTokenIssuer([]byte(secret))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var scopeList []string
+	for _, s := range strings.Split(*scopes, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopeList = append(scopeList, s)
+		}
+	}
+
+	token, err := issuer.Issue(*name, scopeList, *ttl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(token)
+	return 0
+}
+
+// serviceAuthMiddleware validates service tokens, enforces the required scope,
+// and writes an audit entry for every request once it completes
+func serviceAuthMiddleware(issuer *auth.ServiceTokenIssuer, auditLog *audit.Logger, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := issuer.PrincipalFromRequest(c.Request)
+		if err != nil {
+			respondError(c, errInvalidServiceToken)
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			auditLog.Log(audit.Entry{
+				Actor:   "svc:" + principal.Name,
+				Action:  c.Request.Method + " " + c.FullPath(),
+				Target:  c.Param("user_id"),
+				Status:  http.StatusForbidden,
+				Details: map[string]string{"missing_scope": scope},
+			})
+			respondError(c, forbidden("missing scope "+scope).withDetail("scope", scope))
+			return
+		}
+
+		c.Set("service", principal)
+		c.Next()
+
+		auditLog.Log(audit.Entry{
+			Actor:  "svc:" + principal.Name,
+			Action: c.Request.Method + " " + c.FullPath(),
+			Target: c.Param("user_id"),
+			Status: c.Writer.Status(),
+		})
+	}
+}
+
+// validUserIDParam rejects a :user_id that isn't a user ID before a handler
+// opens a store with it
+func validUserIDParam(c *gin.Context) {
+	if !eventstore.ValidUserID(c.Param("user_id")) {
+		respondError(c, invalidParam("user_id", "invalid user_id"))
+		return
+	}
+	c.Next()
+}
+
+// registerInternalRoutes mounts routes used by internal workers (service tokens only)
+func registerInternalRoutes(r *gin.Engine, issuer *auth.ServiceTokenIssuer, auditLog *audit.Logger, eventWrites *ratelimit.Keyed) {
+	internal := r.Group("/internal")
+
+	// Read another user's events (e.g. enrichment workers)
+	internal.GET("/users/:user_id/events", serviceAuthMiddleware(issuer, auditLog, auth.ScopeEventsRead), validUserIDParam, func(c *gin.Context) {
+		reader, err := openEventReader(c.Param("user_id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		events, err := reader.GetEvents(c.Request.Context(), c.Query("type"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	})
+
+	// Write an event on behalf of a user (e.g. enrichment results)
+	internal.POST("/users/:user_id/events", serviceAuthMiddleware(issuer, auditLog, auth.ScopeEventsWrite), validUserIDParam, eventWriteLimit(eventWrites), func(c *gin.Context) {
+		var req EventRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		event, err := storeUserEvent(c.Request.Context(), c.Param("user_id"), req, eventSourceService)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, event)
+	})
+}
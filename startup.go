@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Startup retry defaults. Containers often start before NATS or the auth
+// server is ready, so initial connections are retried before giving up.
+const (
+	defaultStartupWait = 30 * time.Second
+	startupBackoffMin  = 500 * time.Millisecond
+	startupBackoffMax  = 5 * time.Second
+)
+
+// startupSettings reads STARTUP_WAIT (how long to retry each dependency,
+// default 30s) and STARTUP_DEGRADED (start anyway once that runs out)
+func startupSettings() (wait time.Duration, degraded bool, err error) {
+	wait = defaultStartupWait
+	if v := os.Getenv("STARTUP_WAIT"); v != "" {
+		if wait, err = time.ParseDuration(v); err != nil || wait < 0 {
+			return 0, false, fmt.Errorf("invalid STARTUP_WAIT %q", v)
+		}
+	}
+	if v := os.Getenv("STARTUP_DEGRADED"); v != "" {
+		if degraded, err = strconv.ParseBool(v); err != nil {
+			return 0, false, fmt.Errorf("invalid STARTUP_DEGRADED %q", v)
+		}
+	}
+	return wait, degraded, nil
+}
+
+// retryStartup calls connect with exponential backoff until it succeeds or
+// wait has passed, returning the last error
+func retryStartup(name string, wait time.Duration, connect func() error) error {
+	deadline := time.Now().Add(wait)
+	backoff := startupBackoffMin
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		log.Printf("%s unavailable (attempt %d), retrying in %s: %v", name, attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, startupBackoffMax)
+	}
+}
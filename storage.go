@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore/sqlite"
+)
+
+// openStores configures user storage from STORAGE_MODE: "per_user" (default)
+// keeps one database per user under data/users, "shared" puts every user in
+// one database (SHARED_DB_PATH, default data/shared.db) scoped by user_id.
+// Payloads and headers from STORE_COMPRESS_MIN_BYTES (default 1024, 0 turns
+// compression off) are stored zstd-compressed.
+func openStores() (eventstore.Opener, error) {
+	if v := os.Getenv("STORE_COMPRESS_MIN_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid STORE_COMPRESS_MIN_BYTES %q: want a byte count, 0 to disable", v)
+		}
+		sqlite.SetCompressThreshold(n)
+	}
+
+	switch mode := os.Getenv("STORAGE_MODE"); mode {
+	case "", "per_user":
+		root := filepath.Join("data", "users")
+		return sqlite.NewOpener(root), nil
+
+	case "shared":
+		path := os.Getenv("SHARED_DB_PATH")
+		if path == "" {
+			path = filepath.Join("data", "shared.db")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create data directory: %w", err)
+		}
+		opener, err := sqlite.NewSharedOpener(path)
+		if err != nil {
+			return nil, err
+		}
+		return opener, nil
+
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_MODE %q (want per_user or shared)", mode)
+	}
+}
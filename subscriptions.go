@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+	"github.com/Martian-dev/ai-brain-infra/internal/unsubscribe"
+)
+
+// jobUnsubscribeSuggestions publishes subscription.unsubscribe_suggested for
+// lists the user ignores
+const jobUnsubscribeSuggestions = "unsubscribe_suggestions"
+
+// newUnsubscribeAdvisor configures suggestions from UNSUBSCRIBE_WINDOW
+// (default 2160h of mail), UNSUBSCRIBE_MIN_MESSAGES (default 5) and
+// UNSUBSCRIBE_MAX_READ_RATE (default 0.1)
+func newUnsubscribeAdvisor(stores eventstore.Opener) (*unsubscribe.Advisor, error) {
+	window, minMessages, maxReadRate := unsubscribe.DefaultWindow, unsubscribe.DefaultMinMessages, unsubscribe.DefaultMaxReadRate
+	if v := os.Getenv("UNSUBSCRIBE_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid UNSUBSCRIBE_WINDOW %q: want a duration like 2160h", v)
+		}
+		window = d
+	}
+	if v := os.Getenv("UNSUBSCRIBE_MIN_MESSAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid UNSUBSCRIBE_MIN_MESSAGES %q: want a positive number", v)
+		}
+		minMessages = n
+	}
+	if v := os.Getenv("UNSUBSCRIBE_MAX_READ_RATE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f >= 1 {
+			return nil, fmt.Errorf("invalid UNSUBSCRIBE_MAX_READ_RATE %q: want 0 to below 1", v)
+		}
+		maxReadRate = f
+	}
+	return unsubscribe.New(stores, window, minMessages, maxReadRate), nil
+}
+
+// registerUnsubscribeJob checks every user with a connected inbox on
+// UNSUBSCRIBE_SCHEDULE (default daily)
+func registerUnsubscribeJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, advisor *unsubscribe.Advisor, configs *syncconfig.Store) error {
+	runner.Register(jobUnsubscribeSuggestions, jobs.Kind{
+		Timeout: 30 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			users, err := connectedUsers(ctx, configs)
+			if err != nil {
+				return err
+			}
+
+			n, err := advisor.Suggest(ctx, users)
+			if n > 0 {
+				log.Printf("Unsubscribe suggestions: %d published", n)
+			}
+			return err
+		},
+	})
+
+	schedule := os.Getenv("UNSUBSCRIBE_SCHEDULE")
+	if schedule == "" {
+		schedule = "@daily"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid UNSUBSCRIBE_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobUnsubscribeSuggestions, jobUnsubscribeSuggestions, schedule, nil)
+	return err
+}
+
+// registerSubscriptionRoutes lists unsubscribe suggestions and acts on them
+func registerSubscriptionRoutes(authorized *gin.RouterGroup) {
+	// Lists suggested for unsubscribing, newest first
+	authorized.GET("/mail/subscriptions/suggestions", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		status := c.DefaultQuery("status", eventstore.UnsubscribeSuggested)
+		switch status {
+		case eventstore.UnsubscribeSuggested, eventstore.UnsubscribeDismissed, eventstore.UnsubscribeUnsubscribed:
+		case "all":
+			status = ""
+		default:
+			respondError(c, invalidParam("status", "status must be suggested, dismissed, unsubscribed or all"))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		suggestions, err := reader.UnsubscribeSuggestions(c.Request.Context(), status)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	})
+
+	// Leave a list through its List-Unsubscribe header (one-click or mailto)
+	authorized.POST("/mail/subscriptions/unsubscribe", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Provider string `json:"provider" binding:"required"` // sends the mailto message
+			Key      string `json:"key" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		provider, ok := parseProvider(req.Provider)
+		if !ok {
+			respondError(c, errProviderUnsupported)
+			return
+		}
+
+		jwt := bearerToken(c)
+		if jwt == "" {
+			respondError(c, errTokenMissing)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		result, err := syncManager.Unsubscribe(ctx, jwt, authUser.ID, provider, req.Key)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// Keep a list; it isn't suggested again
+	authorized.POST("/mail/subscriptions/dismiss", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Key string `json:"key" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		ctx := c.Request.Context()
+		sub, err := store.LoadSubscription(ctx, req.Key)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if sub == nil {
+			respondError(c, notFound("no mail from this list"))
+			return
+		}
+		err = store.SetUnsubscribeStatus(ctx, eventstore.UnsubscribeSuggestion{
+			Key:    sub.Key,
+			ListID: sub.ListID,
+			Name:   sub.Name,
+			Sender: sub.Sender,
+			Status: eventstore.UnsubscribeDismissed,
+		})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"key": sub.Key, "status": eventstore.UnsubscribeDismissed})
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+)
+
+// syncSettingsResponse reports the saved settings and what this process runs
+// with
+func syncSettingsResponse(settings *syncconfig.Settings) gin.H {
+	limits := gin.H{}
+	for provider, l := range syncManager.RateLimits() {
+		limits[string(provider)] = l.String()
+	}
+	return gin.H{
+		"settings": settings,
+		"effective": gin.H{
+			"poll_interval_seconds": int(syncManager.DefaultPollInterval().Seconds()),
+			"backfill_concurrency":  settings.BackfillConcurrency,
+			"rate_limits":           limits,
+		},
+	}
+}
+
+// registerSyncSettingsRoutes mounts the runtime sync settings on the admin
+// group
+func registerSyncSettingsRoutes(admin *gin.RouterGroup) {
+	admin.GET("/sync-settings", func(c *gin.Context) {
+		settings, err := syncManager.Settings(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, syncSettingsResponse(settings))
+	})
+
+	// Change sync settings without a restart. Omitted fields are kept; 0
+	// (or "" for a provider's rate limits) goes back to the startup
+	// configuration. Running syncs pick changes up on their next poll, and
+	// workers on their next reconcile.
+	admin.PATCH("/sync-settings", func(c *gin.Context) {
+		var req struct {
+			PollInterval        *int              `json:"poll_interval_seconds"` // 10 to 3600
+			BackfillConcurrency *int              `json:"backfill_concurrency"`  // 0 for unlimited
+			RateLimits          map[string]string `json:"rate_limits"`           // provider → "user=5,user_burst=10"
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		settings, err := syncManager.Settings(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if req.PollInterval != nil {
+			settings.PollInterval = *req.PollInterval
+		}
+		if req.BackfillConcurrency != nil {
+			settings.BackfillConcurrency = *req.BackfillConcurrency
+		}
+		for name, spec := range req.RateLimits {
+			provider, ok := parseProvider(name)
+			if !ok {
+				respondError(c, errProviderUnsupported)
+				return
+			}
+			if settings.RateLimits == nil {
+				settings.RateLimits = map[string]string{}
+			}
+			if spec == "" {
+				delete(settings.RateLimits, string(provider))
+			} else {
+				settings.RateLimits[string(provider)] = spec
+			}
+		}
+
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		if err := syncManager.UpdateSettings(c.Request.Context(), settings, authUser.ID); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, syncSettingsResponse(settings))
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/tasksink"
+)
+
+// taskTokens fetches users' task system tokens from BetterAuth with a
+// service token, since deliveries run without a user request
+func taskTokens(client *auth.BetterAuthClient, issuer *auth.ServiceTokenIssuer) tasksink.TokenFunc {
+	return func(ctx context.Context, userID string, provider auth.Provider) (*auth.Token, error) {
+		svcToken, err := issuer.Issue("task-sinks", []string{auth.ScopeTokensRead}, time.Minute)
+		if err != nil {
+			return nil, fmt.Errorf("issue service token: %w", err)
+		}
+		return client.GetTokenForUser(ctx, svcToken, userID, provider)
+	}
+}
+
+// registerTaskRoutes lets users connect task sinks and follow deliveries.
+// deliverer is nil when deliveries are disabled.
+func registerTaskRoutes(authorized *gin.RouterGroup, deliverer *tasksink.Deliverer, authClient *auth.BetterAuthClient) {
+	// Connected sinks and the sinks available to connect
+	authorized.GET("/tasks/sinks", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		sinks, err := reader.ListTaskSinks(c.Request.Context())
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sinks": sinks, "available": tasksink.Names()})
+	})
+
+	// Connect a sink, or replace its settings. The sink's account must be
+	// linked in BetterAuth first.
+	authorized.PUT("/tasks/sinks/:name", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Settings map[string]string `json:"settings"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+		if req.Settings == nil {
+			req.Settings = map[string]string{}
+		}
+
+		sink, err := tasksink.Get(c.Param("name"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if err := sink.Validate(req.Settings); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		ctx := c.Request.Context()
+		if jwt := bearerToken(c); jwt != "" {
+			if _, err := authClient.GetToken(ctx, jwt, sink.Account()); err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		cfg := eventstore.TaskSinkConfig{Name: sink.Name(), Settings: req.Settings}
+		if err := store.SaveTaskSink(ctx, cfg); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, cfg)
+	})
+
+	// Disconnect a sink; pending deliveries to it fail
+	authorized.DELETE("/tasks/sinks/:name", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		deleted, err := store.DeleteTaskSink(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !deleted {
+			respondError(c, notFound("task sink not connected"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": c.Param("name")})
+	})
+
+	// Action items pushed to sinks, newest first
+	authorized.GET("/tasks/deliveries", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		status := c.Query("status")
+		switch status {
+		case "", eventstore.TaskDeliveryPending, eventstore.TaskDeliveryDelivered, eventstore.TaskDeliveryFailed:
+		default:
+			respondError(c, invalidParam("status", "status must be pending, delivered or failed"))
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 500 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 500"))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		deliveries, err := reader.ListTaskDeliveries(c.Request.Context(), status, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	})
+
+	// Push a failed delivery again, e.g. after reconnecting the account
+	authorized.POST("/tasks/deliveries/:id/retry", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		if deliverer == nil {
+			respondError(c, errTaskSinksDisabled)
+			return
+		}
+
+		store, err := openEventStore(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer store.Close()
+
+		ctx := c.Request.Context()
+		delivery, err := store.LoadTaskDelivery(ctx, c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if delivery == nil {
+			respondError(c, notFound("task delivery not found"))
+			return
+		}
+		if delivery.Status != eventstore.TaskDeliveryFailed {
+			respondError(c, badRequest("only failed deliveries can be retried"))
+			return
+		}
+		if err := deliverer.Retry(ctx, store, delivery); err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, delivery)
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/eventstore"
+	"github.com/Martian-dev/ai-brain-infra/internal/jobs"
+	"github.com/Martian-dev/ai-brain-infra/internal/llm"
+	"github.com/Martian-dev/ai-brain-infra/internal/syncconfig"
+	"github.com/Martian-dev/ai-brain-infra/internal/topics"
+)
+
+// jobTopics reclusters every connected user's mail into topics
+const jobTopics = "topic_clusters"
+
+// newTopicClusterer configures clustering from TOPIC_WINDOW (default 2160h of
+// mail) and TOPIC_MAX_MESSAGES (default 2000 newest messages)
+func newTopicClusterer(stores eventstore.Opener, client llm.Client) (*topics.Clusterer, error) {
+	window, maxMessages := topics.DefaultWindow, topics.DefaultMaxMessages
+	if v := os.Getenv("TOPIC_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid TOPIC_WINDOW %q: want a duration like 2160h", v)
+		}
+		window = d
+	}
+	if v := os.Getenv("TOPIC_MAX_MESSAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid TOPIC_MAX_MESSAGES %q: want a positive number", v)
+		}
+		maxMessages = n
+	}
+	return topics.New(stores, client, window, maxMessages), nil
+}
+
+// registerTopicJob clusters every user with a connected inbox on
+// TOPIC_SCHEDULE (default daily)
+func registerTopicJob(ctx context.Context, runner *jobs.Runner, store *jobs.Store, clusterer *topics.Clusterer, configs *syncconfig.Store) error {
+	runner.Register(jobTopics, jobs.Kind{
+		Timeout: 30 * time.Minute,
+		Handler: func(ctx context.Context, _ jobs.Job) error {
+			users, err := connectedUsers(ctx, configs)
+			if err != nil {
+				return err
+			}
+
+			n, err := clusterer.Run(ctx, users)
+			if n > 0 {
+				log.Printf("Topics: %d clusters for %d users", n, len(users))
+			}
+			return err
+		},
+	})
+
+	schedule := os.Getenv("TOPIC_SCHEDULE")
+	if schedule == "" {
+		schedule = "@daily"
+	}
+	if _, err := jobs.ParseSchedule(schedule); err != nil {
+		return fmt.Errorf("invalid TOPIC_SCHEDULE: %w", err)
+	}
+	_, err := store.EnsureRecurring(ctx, "", jobTopics, jobTopics, schedule, nil)
+	return err
+}
+
+// topicView is a topic with its newest messages
+type topicView struct {
+	eventstore.Topic
+	Messages []eventstore.StoredMessage `json:"messages"`
+}
+
+// registerTopicRoutes lists the user's topic clusters. clusterer is nil when
+// embeddings are off.
+func registerTopicRoutes(authorized *gin.RouterGroup, clusterer *topics.Clusterer) {
+	// Topics, largest first, each with its newest member messages
+	authorized.GET("/mail/topics", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		if clusterer == nil {
+			respondError(c, errEmbeddingsDisabled)
+			return
+		}
+		members, err := strconv.Atoi(c.DefaultQuery("members", "10"))
+		if err != nil || members < 0 || members > 100 {
+			respondError(c, invalidParam("members", "members must be between 0 and 100"))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		ctx := c.Request.Context()
+		list, err := reader.Topics(ctx)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		views := make([]topicView, len(list))
+		for i, t := range list {
+			views[i] = topicView{Topic: t, Messages: []eventstore.StoredMessage{}}
+			if members == 0 {
+				continue
+			}
+			if views[i].Messages, err = reader.TopicMessages(ctx, t.ID, members); err != nil {
+				respondError(c, err)
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"topics": views, "count": len(views)})
+	})
+
+	// One topic with up to limit of its messages, newest first
+	authorized.GET("/mail/topics/:topic_id", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		if clusterer == nil {
+			respondError(c, errEmbeddingsDisabled)
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit < 1 || limit > 1000 {
+			respondError(c, invalidParam("limit", "limit must be between 1 and 1000"))
+			return
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		ctx := c.Request.Context()
+		list, err := reader.Topics(ctx)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		for _, t := range list {
+			if t.ID != c.Param("topic_id") {
+				continue
+			}
+			msgs, err := reader.TopicMessages(ctx, t.ID, limit)
+			if err != nil {
+				respondError(c, err)
+				return
+			}
+			c.JSON(http.StatusOK, topicView{Topic: t, Messages: msgs})
+			return
+		}
+		respondError(c, notFound("topic not found"))
+	})
+}
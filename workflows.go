@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Martian-dev/ai-brain-infra/internal/auth"
+	"github.com/Martian-dev/ai-brain-infra/internal/workflow"
+)
+
+// registerWorkflowRoutes lets users start, follow and cancel workflows
+func registerWorkflowRoutes(authorized *gin.RouterGroup, engine *workflow.Engine) {
+	// Start a workflow; its steps run on the sync workers
+	authorized.POST("/workflows", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		var req struct {
+			Name  string         `json:"name" binding:"required"`
+			Input map[string]any `json:"input"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, invalidRequest(err))
+			return
+		}
+
+		wf, err := engine.Start(c.Request.Context(), authUser.ID, req.Name, req.Input)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, wf)
+	})
+
+	// List the user's workflows, newest first
+	authorized.GET("/workflows", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		status := c.Query("status")
+		switch status {
+		case "", workflow.StatusRunning, workflow.StatusWaiting, workflow.StatusCompleted,
+			workflow.StatusFailed, workflow.StatusCancelling, workflow.StatusCancelled:
+		default:
+			respondError(c, invalidParam("status", "unknown status "+status))
+			return
+		}
+		limit := 50
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 500 {
+				respondError(c, invalidParam("limit", "limit must be between 1 and 500"))
+				return
+			}
+			limit = n
+		}
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		workflows, err := reader.ListWorkflows(c.Request.Context(), status, limit)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"workflows": workflows, "available": engine.Names()})
+	})
+
+	authorized.GET("/workflows/:id", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		reader, err := openEventReader(authUser.ID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer reader.Close()
+
+		wf, err := reader.LoadWorkflow(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if wf == nil {
+			respondError(c, notFound("workflow not found"))
+			return
+		}
+		c.JSON(http.StatusOK, wf)
+	})
+
+	// Cancel a workflow; its completed steps are compensated in the background
+	authorized.POST("/workflows/:id/cancel", func(c *gin.Context) {
+		user, _ := c.Get("user")
+		authUser := user.(*auth.User)
+
+		wf, err := engine.Cancel(c.Request.Context(), authUser.ID, c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if wf == nil {
+			respondError(c, notFound("workflow not found"))
+			return
+		}
+		c.JSON(http.StatusAccepted, wf)
+	})
+}